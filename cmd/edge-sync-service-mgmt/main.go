@@ -3,14 +3,20 @@ package main
 import (
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/json"
 	"encoding/pem"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"math/big"
 	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -36,6 +42,8 @@ const (
 	statusLabel          = "Status"
 )
 
+const nextCursorHeader = "X-Sync-Service-Next-Cursor"
+
 var (
 	help           = flag.Bool("h", false, "Display usage information.")
 	cert           = flag.String("cert", "", "Specifiy the file containing the server's CA certificate")
@@ -44,6 +52,15 @@ var (
 	destType       = flag.String("dt", "", "The type of the destination whose information will be shown")
 	genCert        = flag.Bool("generate-cert", false, "Generate a development server certificate")
 	id             = flag.String("id", "", "The ID of the object/destination whose information will be shown")
+	list           = flag.Bool("list", false, "List the objects of the specified type, or the objects with a destination policy if no type is specified")
+	typePrefix     = flag.String("type-prefix", "", "List only the objects whose type starts with the prefix")
+	version        = flag.String("version", "", "List only the objects with the version")
+	inactive       = flag.String("inactive", "", "List only the inactive (true) or active (false) objects")
+	deleted        = flag.String("deleted", "", "List only the deleted (true) or not deleted (false) objects")
+	labels         = flag.String("labels", "", "List only the objects whose labels satisfy the label selector, e.g., env=prod,tier!=canary")
+	updatedSince   = flag.Int64("updated-since", 0, "List only the objects updated after the update with this instance ID")
+	limit          = flag.Int("limit", 0, "The maximal number of objects to list")
+	cursor         = flag.String("cursor", "", "List the objects that follow the cursor returned by a previous list")
 	objectType     = flag.String("type", "", "The type of the object whose information will be shown")
 	orgID          = flag.String("org", "", "Specify the organization ID to work with")
 	remove         = flag.Bool("remove", false, "Indicate that the specified user is to be removed from the ACL")
@@ -70,6 +87,12 @@ func main() {
 			"                      [-p <protocol> -s] [host][:port] [-cert <CA certificate>] -org orgID -security [-remove] [-dt <dest type> -id <user ID>]")
 		fmt.Fprintln(os.Stderr,
 			"                      [-p <protocol> -s] [host][:port] [-cert <CA certificate>] -org orgID -type <object type> -id <object ID>")
+		fmt.Fprintln(os.Stderr,
+			"                      [-p <protocol> -s] [host][:port] [-cert <CA certificate>] -org orgID -list [-type <object type> | -type-prefix <prefix>]")
+		fmt.Fprintln(os.Stderr,
+			"                           [-version <version>] [-inactive true|false] [-deleted true|false] [-updated-since <instance ID>] [-dt <dest type>]")
+		fmt.Fprintln(os.Stderr,
+			"                           [-labels <label selector>] [-limit <number of objects>] [-cursor <cursor>]")
 		flag.PrintDefaults()
 		os.Exit(0)
 	}
@@ -84,6 +107,8 @@ func main() {
 
 	if *destinations {
 		showDestinations()
+	} else if *list {
+		listObjects()
 	} else if *security {
 		workWithSecurity()
 	} else if len(*objectType) != 0 && len(*id) != 0 {
@@ -397,6 +422,124 @@ func showObjectInfo() {
 	}
 }
 
+func listObjects() {
+	if len(*orgID) == 0 {
+		fmt.Printf("To list objects, you must supply an organization ID.\n")
+		os.Exit(1)
+	}
+	host, port, message := parseHostAndPort(*serverAddress)
+	if message != "" {
+		fmt.Println(message)
+		os.Exit(1)
+	}
+
+	query := url.Values{}
+	path := "/api/v1/objects/" + url.PathEscape(*orgID)
+	if len(*objectType) != 0 {
+		path += "/" + url.PathEscape(*objectType)
+		query.Set("all_objects", "true")
+	} else {
+		query.Set("destination_policy", "true")
+		if len(*typePrefix) != 0 {
+			query.Set("type_prefix", *typePrefix)
+		}
+	}
+	if len(*version) != 0 {
+		query.Set("version", *version)
+	}
+	if len(*inactive) != 0 {
+		query.Set("inactive", *inactive)
+	}
+	if len(*deleted) != 0 {
+		query.Set("deleted", *deleted)
+	}
+	if *updatedSince != 0 {
+		query.Set("updated_since", strconv.FormatInt(*updatedSince, 10))
+	}
+	if len(*destType) != 0 {
+		query.Set("destination_type", *destType)
+	}
+	if len(*labels) != 0 {
+		query.Set("labels", *labels)
+	}
+	if *limit != 0 {
+		query.Set("limit", strconv.Itoa(*limit))
+	}
+	if len(*cursor) != 0 {
+		query.Set("cursor", *cursor)
+	}
+	requestURL := fmt.Sprintf("%s://%s:%d%s?%s", *serverProtocol, host, port, path, query.Encode())
+
+	httpClient := &http.Client{}
+	if len(*cert) != 0 {
+		certData, err := ioutil.ReadFile(*cert)
+		if err != nil {
+			fmt.Printf("Failed to read the CA certificate. Error: %s\n", err)
+			os.Exit(1)
+		}
+		caCertPool := x509.NewCertPool()
+		caCertPool.AppendCertsFromPEM(certData)
+		httpClient.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: caCertPool}}
+	}
+
+	request, err := http.NewRequest(http.MethodGet, requestURL, nil)
+	if err != nil {
+		fmt.Printf("Failed to create the request. Error: %s\n", err)
+		os.Exit(1)
+	}
+	if len(*appKey) > 0 {
+		request.SetBasicAuth(*appKey, *appSecret)
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		fmt.Printf("Failed to fetch the list of objects from the server. Error: %s\n", err)
+		os.Exit(1)
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		fmt.Printf("Failed to read the list of objects from the server. Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	objects := make([]common.ObjectDestinationPolicy, 0)
+	switch response.StatusCode {
+	case http.StatusOK:
+		if err = json.Unmarshal(body, &objects); err != nil {
+			fmt.Printf("Failed to unmarshal the list of objects. Error: %s\n", err)
+			os.Exit(1)
+		}
+	case http.StatusNotFound:
+	default:
+		fmt.Printf("Failed to fetch the list of objects from the server. Received %d: %s\n", response.StatusCode, string(body))
+		os.Exit(1)
+	}
+
+	objTypeLength := len(objectTypeLabel)
+	objIDLength := len(objectIDLabel)
+
+	for _, obj := range objects {
+		if len(obj.ObjectType) > objTypeLength {
+			objTypeLength = len(obj.ObjectType)
+		}
+		if len(obj.ObjectID) > objIDLength {
+			objIDLength = len(obj.ObjectID)
+		}
+	}
+
+	fmt.Printf("%*s  |  %s\n", -objTypeLength, objectTypeLabel, objectIDLabel)
+	fmt.Printf("%s  |  %s\n", strings.Repeat("-", objTypeLength), strings.Repeat("-", objIDLength))
+
+	for _, obj := range objects {
+		fmt.Printf("%*s  |  %s\n", -objTypeLength, obj.ObjectType, obj.ObjectID)
+	}
+
+	if nextCursor := response.Header.Get(nextCursorHeader); nextCursor != "" {
+		fmt.Printf("\nMore objects are available, list them with -cursor %s\n", nextCursor)
+	}
+}
+
 func workWithSecurity() {
 	if len(*destType) == 0 && len(*objectType) == 0 {
 		syncClient, message := createSyncClient()
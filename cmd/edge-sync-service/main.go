@@ -39,8 +39,12 @@ func main() {
 		authenticationHandler = &security.DummyAuthenticate{}
 	case "preset":
 		authenticationHandler = &security.PresetAuthenticate{}
+	case "jwt":
+		authenticationHandler = &security.JWTAuthenticate{}
+	case "certificate":
+		authenticationHandler = &security.CertificateAuthenticate{}
 	default:
-		fmt.Printf("Unknown Authentication handler identifier %s. Valid values are dummy.\n",
+		fmt.Printf("Unknown Authentication handler identifier %s. Valid values are dummy, preset, jwt and certificate.\n",
 			common.Configuration.AuthenticationHandler)
 		os.Exit(99)
 	}
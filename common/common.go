@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -119,6 +120,17 @@ type Destination struct {
 	// CodeVersion is the sync service code version used by the destination
 	//   required: true
 	CodeVersion string `json:"codeVersion" bson:"code-version"`
+
+	// Policy is the policy registered by the destination, its properties and constraints.
+	// A CSS with the PolicyEvaluation configuration property set matches it with the destination policies of objects.
+	//   required: false
+	Policy *Policy `json:"policy,omitempty" bson:"policy,omitempty"`
+
+	// Properties are key/value pairs that describe the destination, for example its site, hardware or software.
+	// They are published by the ESS when it registers, and can be edited by admins.
+	// They are added to the properties of the destination's policy when it is matched with the destination policies of objects.
+	//   required: false
+	Properties map[string]string `json:"properties,omitempty" bson:"properties,omitempty"`
 }
 
 // PolicyProperty is a property in a policy
@@ -201,6 +213,7 @@ type MetaData struct {
 	DestType string `json:"destinationType" bson:"destination-type"`
 
 	// DestinationsList is the list of destinations as type:id pairs to send the object to.
+	// An entry group:<name> targets all the destinations of the destination group <name>.
 	// When a DestinationsList is provided DestType and DestID must be omitted.
 	// This field is ignored when working with ESS (the destination is always the CSS).
 	DestinationsList []string `json:"destinationsList" bson:"destinations-list"`
@@ -210,6 +223,13 @@ type MetaData struct {
 	// When a DestinationPolicy is provided DestinationsList, DestType, and DestID must be omitted.
 	DestinationPolicy *Policy `json:"destinationPolicy" bson:"destination-policy"`
 
+	// Rollout specifies the delivery of the object to its destinations in waves, instead of to all of them at once.
+	// The rollout's state is provided by /api/v1/objects/{orgID}/{objectType}/{objectID}/rollout.
+	// A rollout can't be used together with a DestinationPolicy.
+	// This field is available only when working with the CSS.
+	// Optional field, if omitted the object is sent to all its destinations at once.
+	Rollout *Rollout `json:"rollout,omitempty" bson:"rollout,omitempty"`
+
 	// Expiration is a timestamp/date indicating when the object expires.
 	// When the object expires it is automatically deleted.
 	// The timestamp should be provided in RFC3339 format.
@@ -225,6 +245,12 @@ type MetaData struct {
 	// Optional field, empty by default.
 	Description string `json:"description" bson:"description"`
 
+	// Labels are key/value pairs used to group objects, for example by release, team or environment.
+	// Objects can be listed, deleted and activated by a selector of their labels, e.g., env=prod,tier!=canary.
+	// Keys may contain letters, digits, '-', '_', '.' and '/', values may contain letters, digits, '-', '_' and '.'.
+	// Optional field, empty by default.
+	Labels map[string]string `json:"labels,omitempty" bson:"labels,omitempty"`
+
 	// Link is a link to where the data for this object can be fetched from.
 	// The link is set and used by the application. The sync service does not access the link.
 	// Optional field, if omitted the data must be provided by the application.
@@ -270,6 +296,23 @@ type MetaData struct {
 	// This field is used only when working with the CSS. Objects are always deleted after delivery on the ESS.
 	AutoDelete bool `json:"autodelete" bson:"autodelete"`
 
+	// Signature is the base64 encoded signature of the SHA-256 digest of the object's data.
+	// The ESS verifies the signature after it receives the object's data, and rejects objects that fail the verification.
+	// RSA (PKCS #1 v1.5 or PSS) and ECDSA signatures are supported.
+	// This field is available only when working with the CSS.
+	// Optional field, if omitted the object is not signed.
+	Signature string `json:"signature" bson:"signature"`
+
+	// PublicKey is the public key to verify the signature with, as a PEM encoded or a base64 encoded DER (PKIX) key.
+	// The key must be one of the trusted signing keys configured on the ESS, it is used to find the trusted key
+	// if SigningKeyID is not provided.
+	// Optional field.
+	PublicKey string `json:"publicKey" bson:"public-key"`
+
+	// SigningKeyID is the ID of the trusted key, configured on the ESS, to verify the signature with.
+	// Optional field, either PublicKey or SigningKeyID must be provided for signed objects.
+	SigningKeyID string `json:"signingKeyID" bson:"signing-key-id"`
+
 	// OriginID is the ID of origin of the object. Set by the internal code.
 	// Read only field, should not be set by users.
 	OriginID string `json:"originID" bson:"origin-id"`
@@ -294,6 +337,20 @@ type MetaData struct {
 	// This field should not be set by users.
 	ObjectSize int64 `json:"objectSize" bson:"object-size"`
 
+	// OriginalSize is an internal field indicating the size of the object's data as it was provided by the application.
+	// It differs from ObjectSize, the size of the data as it is stored and transferred, when the data is compressed and encrypted.
+	// This field should not be set by users.
+	OriginalSize int64 `json:"originalSize" bson:"original-size"`
+
+	// Encrypted is an internal field indicating whether the object's data is encrypted.
+	// This field should not be set by users.
+	Encrypted bool `json:"encrypted" bson:"encrypted"`
+
+	// DataHash is an internal field with the hex encoded SHA-256 hash of the object's data, as it is stored and transferred.
+	// The receiver of the object verifies the data against it.
+	// This field should not be set by users.
+	DataHash string `json:"dataHash" bson:"data-hash"`
+
 	// ChunkSize is an internal field indicating the maximal message payload size.
 	// This field should not be set by users.
 	ChunkSize int `json:"chunkSize" bson:"chunk-size"`
@@ -319,6 +376,153 @@ type Notification struct {
 	ResendTime int64  `json:"resendTime" bson:"resend-time"`
 }
 
+// Webhook is a webhook registered for the objects of a type.
+// The requests of a webhook with a secret are signed with it.
+// A webhook without events is called for the updated event only.
+// swagger:ignore
+type Webhook struct {
+	URL    string   `json:"url" bson:"url"`
+	Secret string   `json:"secret,omitempty" bson:"secret,omitempty"`
+	Events []string `json:"events,omitempty" bson:"events,omitempty"`
+}
+
+// SubscribedTo returns true if the webhook is called for the event
+func (webhook *Webhook) SubscribedTo(event string) bool {
+	if len(webhook.Events) == 0 {
+		return event == WebhookEventUpdated
+	}
+	for _, e := range webhook.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookEvent is the payload posted to webhooks for the events of an object other than its update.
+// For the updated event the object's meta data is posted.
+// swagger:model
+type WebhookEvent struct {
+	// Event is the event: received, delivered, consumed, deleted, feedback, or completed
+	Event string `json:"event"`
+
+	// OrgID is the organization ID of the object
+	OrgID string `json:"orgID"`
+
+	// ObjectType is the object type of the object
+	ObjectType string `json:"objectType"`
+
+	// ObjectID is the object ID of the object
+	ObjectID string `json:"objectID"`
+
+	// InstanceID is the instance ID of the object
+	InstanceID int64 `json:"instanceID"`
+
+	// DestType is the destination type of the destination, not set for the completed event
+	DestType string `json:"destinationType,omitempty"`
+
+	// DestID is the destination ID of the destination, not set for the completed event
+	DestID string `json:"destinationID,omitempty"`
+
+	// Status is the delivery status of the object for the destination after the event
+	Status string `json:"status,omitempty"`
+
+	// Code is the code of the feedback
+	Code int `json:"code,omitempty"`
+
+	// Message is the message of the feedback
+	Message string `json:"message,omitempty"`
+
+	// Timestamp is the time of the event, in seconds since the epoch
+	Timestamp int64 `json:"timestamp"`
+}
+
+// WebhookDelivery is a delivery of an event of an object to a webhook.
+// A delivery that fails is retried with an exponential backoff, until the maximal number of attempts
+// is reached, and then it remains in the failed status.
+// swagger:model
+type WebhookDelivery struct {
+	// ID is the delivery's ID, sent in the X-Sync-Service-Delivery header of its requests
+	ID string `json:"id" bson:"id"`
+
+	// OrgID is the organization ID of the object
+	OrgID string `json:"orgID" bson:"org-id"`
+
+	// ObjectType is the object type of the object
+	ObjectType string `json:"objectType" bson:"object-type"`
+
+	// ObjectID is the object ID of the object
+	ObjectID string `json:"objectID" bson:"object-id"`
+
+	// URL is the webhook's URL
+	URL string `json:"url" bson:"url"`
+
+	// Event is the delivered event, sent in the X-Sync-Service-Event header of its requests
+	Event string `json:"event" bson:"event"`
+
+	// Payload is the posted meta data of the updated object, or the posted WebhookEvent. It is kept as is, since the signature is computed over its bytes.
+	Payload []byte `json:"payload" bson:"payload"`
+
+	// Signature is the hex encoded HMAC-SHA256 of the payload, computed with the webhook's secret
+	Signature string `json:"signature,omitempty" bson:"signature"`
+
+	// Status is the delivery's status, pending or failed
+	Status string `json:"status" bson:"status"`
+
+	// Attempts is the number of attempts to deliver the event
+	Attempts int `json:"attempts" bson:"attempts"`
+
+	// NextAttemptTime is the time of the next attempt, in seconds since the epoch
+	NextAttemptTime int64 `json:"nextAttemptTime" bson:"next-attempt-time"`
+
+	// LastError is the error of the last attempt
+	LastError string `json:"lastError,omitempty" bson:"last-error"`
+
+	// CreationTime is the time the delivery was created, in seconds since the epoch
+	CreationTime int64 `json:"creationTime" bson:"creation-time"`
+}
+
+// AuditEntry is an entry of the audit log, recording a call to a mutating API
+// swagger:model
+type AuditEntry struct {
+	// ID is the entry's ID
+	ID string `json:"id" bson:"id"`
+
+	// Timestamp is the time of the call
+	Timestamp time.Time `json:"timestamp" bson:"timestamp"`
+
+	// Identity is the authenticated identity of the caller, empty if the caller failed to authenticate
+	Identity string `json:"identity" bson:"identity"`
+
+	// UserOrgID is the organization ID of the caller
+	UserOrgID string `json:"userOrgID" bson:"user-org-id"`
+
+	// OrgID is the organization ID of the target of the call
+	OrgID string `json:"orgID" bson:"org-id"`
+
+	// Operation is the called operation, for example updateObject or deleteACL
+	Operation string `json:"operation" bson:"operation"`
+
+	// Target is the target of the operation, for example objectType/objectID for operations on objects
+	Target string `json:"target" bson:"target"`
+
+	// Code is the HTTP status code of the call's response
+	Code int `json:"code" bson:"code"`
+}
+
+// ObjectVersion is a previous version of an object, kept in the object's version history
+// swagger:model
+type ObjectVersion struct {
+	// Version is the instance ID the object had in this version
+	Version int64 `json:"version" bson:"version"`
+
+	// Timestamp is the time the version was replaced by a newer version of the object
+	Timestamp time.Time `json:"timestamp" bson:"timestamp"`
+
+	// MetaData is the object's meta data in this version
+	MetaData MetaData `json:"meta" bson:"meta"`
+}
+
 // StoreDestinationStatus is the information about destinations and their status for an object
 // swagger:ignore
 type StoreDestinationStatus struct {
@@ -422,6 +626,33 @@ type Organization struct {
 
 	// Address is the broker address to be used when connecting to this organization
 	Address string `json:"address" bson:"address"`
+
+	// MaxObjects is the maximal number of objects the organization can store.
+	// If it is zero, the OrgMaxObjects configuration parameter is used.
+	MaxObjects int `json:"maxObjects,omitempty" bson:"max-objects"`
+
+	// MaxDataSize is the maximal total size in bytes of the data of the objects the organization can store,
+	// including the data of the versions in the version history of the objects.
+	// If it is zero, the OrgMaxDataSize configuration parameter is used.
+	MaxDataSize int64 `json:"maxDataSize,omitempty" bson:"max-data-size"`
+
+	// MaxObjectSize is the maximal size in bytes of the data of a single object of the organization.
+	// If it is zero, the OrgMaxObjectSize configuration parameter is used.
+	MaxObjectSize int64 `json:"maxObjectSize,omitempty" bson:"max-object-size"`
+}
+
+// OrganizationUsage describes the objects stored by an organization
+// swagger:model
+type OrganizationUsage struct {
+	// OrgID is the organization ID of the organization
+	OrgID string `json:"orgID"`
+
+	// StoredObjects is the number of objects received from the application that are currently stored
+	StoredObjects uint32 `json:"storedObjects"`
+
+	// StoredBytes is the total size in bytes of the data of the stored objects.
+	// The data of the versions in the version history of the objects is included.
+	StoredBytes int64 `json:"storedBytes"`
 }
 
 // StoredOrganization contains organization and its update timestamp
@@ -473,6 +704,8 @@ const (
 	ConsumedByDestination = "consumedByDest"
 	Getdata               = "getdata"
 	Data                  = "data"
+	Getdelta              = "getdelta"
+	Delta                 = "delta"
 	UpdatePending         = "updatePending"
 	ConsumedPending       = "consumedPending"
 	Delete                = "delete"
@@ -573,6 +806,45 @@ const (
 	Bolt     = "bolt"
 	InMemory = "inmemory"
 	Mongo    = "mongo"
+	Postgres = "postgres"
+)
+
+// Data storage providers
+const (
+	S3 = "s3"
+)
+
+// Encryption key providers
+const (
+	FileKeyProvider = "file"
+)
+
+// Events of objects for which webhooks are called
+const (
+	WebhookEventUpdated   = "updated"   // The object was updated on this node
+	WebhookEventReceived  = "received"  // The destination received the object's update notification
+	WebhookEventDelivered = "delivered" // The destination received the object
+	WebhookEventConsumed  = "consumed"  // The object was consumed by the destination
+	WebhookEventDeleted   = "deleted"   // The destination deleted the object
+	WebhookEventFeedback  = "feedback"  // The destination sent a feedback about the object, e.g., an error
+	WebhookEventCompleted = "completed" // The object was delivered to all its destinations
+)
+
+// WebhookEvents are the events for which webhooks can be called
+var WebhookEvents = []string{WebhookEventUpdated, WebhookEventReceived, WebhookEventDelivered, WebhookEventConsumed,
+	WebhookEventDeleted, WebhookEventFeedback, WebhookEventCompleted}
+
+// Statuses of deliveries to webhooks
+const (
+	WebhookDeliveryPending = "pending"
+	WebhookDeliveryFailed  = "failed"
+)
+
+// Data compression algorithms
+const (
+	NoCompression   = "none"
+	GzipCompression = "gzip"
+	ZstdCompression = "zstd"
 )
 
 // HashStrings uses FNV-1a (Fowler/Noll/Vo) fast and well dispersed hash functions
@@ -647,6 +919,32 @@ func (locks *Locks) RUnlock(index uint32) {
 	locks.locks[index&(locks.numberOfLocks-1)].RUnlock()
 }
 
+// LockAll locks several objects. The locks are taken in ascending order to avoid a deadlock, and a lock shared by
+// several of the objects is taken once. Returns the taken locks to unlock with UnlockAll.
+func (locks *Locks) LockAll(indexes []uint32) []uint32 {
+	taken := make([]uint32, 0, len(indexes))
+	for _, index := range indexes {
+		taken = append(taken, index&(locks.numberOfLocks-1))
+	}
+	sort.Slice(taken, func(i, j int) bool { return taken[i] < taken[j] })
+
+	distinct := taken[:0]
+	for _, index := range taken {
+		if len(distinct) == 0 || distinct[len(distinct)-1] != index {
+			distinct = append(distinct, index)
+			locks.locks[index].Lock()
+		}
+	}
+	return distinct
+}
+
+// UnlockAll unlocks the locks taken by LockAll
+func (locks *Locks) UnlockAll(taken []uint32) {
+	for index := len(taken) - 1; index >= 0; index-- {
+		locks.locks[taken[index]].Unlock()
+	}
+}
+
 // ConditionalLock locks the object if the index doesn't correspond to a lock that is already taken
 func (locks *Locks) ConditionalLock(index uint32, lockedIndex uint32) {
 	if index&(locks.numberOfLocks-1) != lockedIndex&(locks.numberOfLocks-1) {
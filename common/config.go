@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"math"
 	"math/rand"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -95,6 +96,13 @@ type Config struct {
 	// property if it doesn't start with a slash (/).
 	ServerKey string `env:"SERVER_KEY"`
 
+	// ClientCACertificate specifies the CA certificate used to verify the client certificates presented to the
+	// HTTPS server. When it is set, clients may authenticate with a certificate signed by this CA, which is used
+	// by the certificate Authentication handler. This value can either be the CA certificate itself or the path of
+	// a file containing the CA certificate. If it is a path of a file, then it is relative to the
+	// PersistenceRootPath configuration property if it doesn't start with a slash (/).
+	ClientCACertificate string `env:"CLIENT_CA_CERTIFICATE"`
+
 	// CSSOnWIoTP indicates whether the CSS is inside or outside the WIoTP.
 	// The default value is false, i.e. outside.
 	CSSOnWIoTP bool `env:"CSS_ON_WIOTP"`
@@ -109,9 +117,51 @@ type Config struct {
 
 	// AuthenticationHandler indicates which Authentication handler should be used.
 	// The current possible values are:
-	//     dummy - for the dummyAuthenticate Authentication handler
+	//     dummy  - for the dummyAuthenticate Authentication handler
+	//     preset - for the presetAuthenticate Authentication handler
+	//     jwt    - for the jwtAuthenticate Authentication handler
+	//     certificate - for the certificateAuthenticate Authentication handler
 	AuthenticationHandler string `env:"AUTHENTICATION_HANDLER"`
 
+	// JWTKeysFile specifies the JWKS file of the public keys used by the jwt Authentication handler to verify tokens.
+	// The key is selected by the kid header of the token.
+	// The path is relative to the PersistenceRootPath configuration property if it doesn't start with a slash (/).
+	JWTKeysFile string `env:"JWT_KEYS_FILE"`
+
+	// JWTIssuerKeyFile specifies the PEM file of the public key of the issuer of the tokens.
+	// It is used by the jwt Authentication handler to verify the tokens when JWTKeysFile isn't set.
+	// The path is relative to the PersistenceRootPath configuration property if it doesn't start with a slash (/).
+	JWTIssuerKeyFile string `env:"JWT_ISSUER_KEY_FILE"`
+
+	// JWTIssuer specifies the issuer (iss claim) of the tokens accepted by the jwt Authentication handler.
+	// If empty, the issuer isn't checked.
+	JWTIssuer string `env:"JWT_ISSUER"`
+
+	// JWTAudience specifies the audience (aud claim) of the tokens accepted by the jwt Authentication handler.
+	// If empty, the audience isn't checked.
+	JWTAudience string `env:"JWT_AUDIENCE"`
+
+	// JWTTypeClaim specifies the claim holding the type of the user of a token.
+	// Nested claims are specified with dots, for example realm_access.roles.
+	JWTTypeClaim string `env:"JWT_TYPE_CLAIM"`
+
+	// JWTTypes maps the values of the type claim to user types.
+	// It is a comma separated list of value:type pairs, for example "org-admin:admin,device:edgenode".
+	// The user types are admin, edgenode, user, syncadmin and service. Values that aren't mapped are used as user types.
+	JWTTypes string `env:"JWT_TYPES"`
+
+	// JWTOrgClaim specifies the claim holding the organization of the user of a token
+	JWTOrgClaim string `env:"JWT_ORG_CLAIM"`
+
+	// JWTIdentityClaim specifies the claim holding the identity of the user of a token.
+	// The identity of an edge node is destType/destID, and the identity of a service is serviceOrg/version/serviceName.
+	JWTIdentityClaim string `env:"JWT_IDENTITY_CLAIM"`
+
+	// JWTTokenFile specifies the file of the token used by an ESS with the jwt Authentication handler to communicate
+	// with the CSS over HTTP. The file is read for each request, so that the token can be refreshed.
+	// The path is relative to the PersistenceRootPath configuration property if it doesn't start with a slash (/).
+	JWTTokenFile string `env:"JWT_TOKEN_FILE"`
+
 	// CommunicationProtocol is a comma separated list of protocols to be used for communication between CSS and ESS
 	//  The elements of the list can be 'http', 'mqtt', and 'wiotp'
 	//  wiotp indicates MQTT communication via the Watson IoT Platform and mqtt indicates direct MQTT communication to a broker
@@ -195,6 +245,17 @@ type Config struct {
 	// Default value: none
 	HTTPCSSCACertificate string `env:"HTTP_CSS_CA_CERTIFICATE"`
 
+	// HTTPCSSClientCertificate specifies the client certificate presented by the ESS to the CSS when
+	// HTTPCSSUseSSL is true. When it is set, the ESS authenticates with the certificate instead of an app key and secret.
+	// This value can either be the certificate itself or the path of a file containing the certificate. If it is
+	// a path of a file, then it is relative to the PersistenceRootPath configuration property if it doesn't start with a slash (/).
+	HTTPCSSClientCertificate string `env:"HTTP_CSS_CLIENT_CERTIFICATE"`
+
+	// HTTPCSSClientKey specifies the key of the client certificate presented by the ESS to the CSS.
+	// This value can either be the key itself or the path of a file containing the key. If it is a path of a file,
+	// then it is relative to the PersistenceRootPath configuration property if it doesn't start with a slash (/).
+	HTTPCSSClientKey string `env:"HTTP_CSS_CLIENT_KEY"`
+
 	// LogLevel specifies the logging level in string format
 	LogLevel string `env:"LOG_LEVEL"`
 
@@ -227,11 +288,25 @@ type Config struct {
 	// LogTraceMaintenanceInterval specifies the frequency in seconds of log and trace maintenance (memory consumption, etc.)
 	LogTraceMaintenanceInterval int16 `env:"LOG_TRACE_MAINTENANCE_INTERVAL"`
 
+	// TracingFile specifies the file to which OpenTelemetry spans of the delivery of objects are written, in JSON format.
+	// If it is not set, the spans are exported only if the application embedding the Sync Service registers
+	// an OpenTelemetry tracer provider.
+	// The path is relative to the TraceRootPath configuration property if it doesn't start with a slash (/).
+	TracingFile string `env:"TRACING_FILE"`
+
 	// ResendInterval specifies the frequency in seconds of checks to resend unacknowledged notifications
 	// ESS resends register notification with this interval
 	// Other notifications are resent with frequency equal to ResendInterval*6
 	ResendInterval int16 `env:"RESEND_INTERVAL"`
 
+	// WebhookMaxAttempts specifies the maximal number of attempts to deliver an update of an object to a webhook.
+	// A delivery that fails that many times is kept in the failed status and is no longer retried.
+	WebhookMaxAttempts int `env:"WEBHOOK_MAX_ATTEMPTS"`
+
+	// WebhookRetryInterval specifies the time in seconds before the first retry of a failed delivery to a webhook.
+	// The time is doubled with each retry, up to one hour.
+	WebhookRetryInterval int `env:"WEBHOOK_RETRY_INTERVAL"`
+
 	// ESSPingInterval specifies the frequency in hours of ping messages that ESS sends to CSS
 	ESSPingInterval int16 `env:"ESS_PING_INTERVAL"`
 
@@ -241,12 +316,118 @@ type Config struct {
 	// A value of zero means ESSs are never removed
 	RemoveESSRegistrationTime int16 `env:"REMOVE_ESS_REGISTRATION_TIME"`
 
+	// AuditLogRetention specifies the time period in days after which entries are removed from the audit log
+	// of mutating API calls
+	// A value of zero means the entries are never removed
+	AuditLogRetention int `env:"AUDIT_LOG_RETENTION"`
+
+	// OrgMaxObjects specifies the maximal number of objects an organization can store.
+	// It is used for organizations that don't specify their own limit.
+	// A value of zero means the number of objects isn't limited
+	OrgMaxObjects int `env:"ORG_MAX_OBJECTS"`
+
+	// OrgMaxDataSize specifies the maximal total size in bytes of the data of the objects an organization can store.
+	// The data of the versions in the version history of the objects is counted.
+	// It is used for organizations that don't specify their own limit.
+	// A value of zero means the total size isn't limited
+	OrgMaxDataSize int64 `env:"ORG_MAX_DATA_SIZE"`
+
+	// OrgMaxObjectSize specifies the maximal size in bytes of the data of a single object of an organization.
+	// It is used for organizations that don't specify their own limit.
+	// A value of zero means the size isn't limited
+	OrgMaxObjectSize int64 `env:"ORG_MAX_OBJECT_SIZE"`
+
+	// MaxObjectVersions specifies the number of previous versions of each object that are kept in the object's
+	// version history, so that the object can be rolled back to one of them.
+	// A value of zero means the previous versions aren't kept
+	MaxObjectVersions int `env:"MAX_OBJECT_VERSIONS"`
+
+	// MaxObjectVersionsByObjectType overrides MaxObjectVersions for specific object types.
+	// It is a comma separated list of objectType:versions pairs, for example "model:5,config:0".
+	MaxObjectVersionsByObjectType string `env:"MAX_OBJECT_VERSIONS_BY_OBJECT_TYPE"`
+
+	// RateLimitByRole specifies the maximal rate of the API calls of each user, by the role of the user.
+	// It is a comma separated list of role:rate pairs, where the rate is the number of calls per minute,
+	// for example "user:600,service:1200". The roles are admin, edgenode, user, syncadmin and service.
+	// The calls of users whose role isn't listed aren't limited.
+	// CSS only parameter, ignored on ESS
+	RateLimitByRole string `env:"RATE_LIMIT_BY_ROLE"`
+
+	// RateLimitByOrg specifies the maximal rate of the API calls of all the users of an organization.
+	// It is a comma separated list of orgID:rate pairs, where the rate is the number of calls per minute.
+	// The orgID * specifies the rate of the organizations that aren't listed.
+	// CSS only parameter, ignored on ESS
+	RateLimitByOrg string `env:"RATE_LIMIT_BY_ORG"`
+
+	// RateLimitESSPolling specifies the maximal rate of polling for updates by each ESS, in polls per minute.
+	// The polls have their own budget and aren't counted as API calls.
+	// CSS only parameter, ignored on ESS
+	// A value of zero means polling isn't limited
+	RateLimitESSPolling int `env:"RATE_LIMIT_ESS_POLLING"`
+
+	// RateLimitBurst specifies the size of the bursts of calls that are allowed above the rate limits,
+	// as the number of seconds worth of calls at the limit rate
+	RateLimitBurst int `env:"RATE_LIMIT_BURST"`
+
 	// Maximum size of data that can be sent in one message
 	MaxDataChunkSize int `env:"MAX_DATA_CHUNK_SIZE"`
 
 	// Max num of inflight chunks
 	MaxInflightChunks int `env:"MAX_INFLIGHT_CHUNKS"`
 
+	// EnableDeltaTransfer specifies whether the data of an updated object is transferred as a binary delta
+	// from the version of the object the receiving side already has. The data is transferred completely
+	// if there is no previous version of the data or if the delta is too large.
+	// The delta transfer is used only if it is enabled on both sides.
+	EnableDeltaTransfer bool `env:"ENABLE_DELTA_TRANSFER"`
+
+	// MaxDeltaSize specifies the maximum size in bytes of a delta. Deltas that are larger, or larger than
+	// half of the size of the object, are not sent, and the whole data is transferred instead.
+	// When MQTT is used, the delta is sent in one message and is also limited by MaxDataChunkSize.
+	MaxDeltaSize int `env:"MAX_DELTA_SIZE"`
+
+	// DataCompression specifies the compression of the data of objects sent in MQTT data messages: none, gzip or zstd.
+	// The data is compressed only if the receiving side supports the compression, and is sent uncompressed to older versions.
+	// The encrypted data of objects is instead compressed before it is encrypted, when it is stored.
+	DataCompression string `env:"DATA_COMPRESSION"`
+
+	// DataCompressionByObjectType overrides DataCompression for specific object types.
+	// It is a comma separated list of objectType:compression pairs, for example "model:zstd,video:none".
+	DataCompressionByObjectType string `env:"DATA_COMPRESSION_BY_OBJECT_TYPE"`
+
+	// DataCompressionByOrg overrides DataCompression for specific organizations.
+	// It is a comma separated list of orgID:compression pairs. DataCompressionByObjectType takes precedence over it.
+	DataCompressionByOrg string `env:"DATA_COMPRESSION_BY_ORG"`
+
+	// SigningKeysDir specifies the directory of the trusted public keys used by the ESS to verify the signatures of objects.
+	// The key with the ID keyID is read from the PEM file keyID.pem in this directory.
+	// Only objects signed with one of the trusted keys are accepted, signed objects are rejected if SigningKeysDir is not set.
+	// The path is relative to the PersistenceRootPath configuration property if it doesn't start with a slash (/).
+	SigningKeysDir string `env:"SIGNING_KEYS_DIR"`
+
+	// RequireSignedObjects specifies whether the ESS rejects objects with data that are not signed.
+	// SigningKeysDir must be set when RequireSignedObjects is true.
+	RequireSignedObjects bool `env:"REQUIRE_SIGNED_OBJECTS"`
+
+	// DestinationPolicyFile specifies a JSON file with the policy of the ESS, its properties and constraints.
+	// The policy is sent to the CSS when the ESS registers, and is used by a CSS with PolicyEvaluation set
+	// to match the ESS with the destination policies of objects. The file is read each time the ESS registers.
+	// The path is relative to the PersistenceRootPath configuration property if it doesn't start with a slash (/).
+	DestinationPolicyFile string `env:"DESTINATION_POLICY_FILE"`
+
+	// DestinationProperties specifies the properties of the ESS, a comma separated list of key=value pairs
+	// that describe it, for example region=eu,site=paris,hardware=rpi4.
+	// The properties are sent to the CSS when the ESS registers, and are listed with the destinations of the CSS.
+	// ESS only parameter, ignored on CSS
+	DestinationProperties string `env:"DESTINATION_PROPERTIES"`
+
+	// PolicyEvaluation specifies whether the CSS resolves the destination policies of objects to destinations.
+	// When it is set, the destinations of an object with a destination policy are the destinations whose registered
+	// policies match it, and they are updated when the object or the policy of a destination changes.
+	// When it isn't set, an external agent sets the destinations of such objects.
+	// CSS only parameter, ignored on ESS
+	PolicyEvaluation bool `env:"POLICY_EVALUATION"`
+
 	// MongoAddressCsv specifies one or more addresses of the mongo database
 	MongoAddressCsv string `env:"MONGO_ADDRESS_CSV"`
 
@@ -278,6 +459,30 @@ type Config struct {
 	// MongoSessionCacheSize specifies the number of MongoDB session copies to use
 	MongoSessionCacheSize int `env:"MONGO_SESSION_CACHE_SIZE"`
 
+	// PostgresAddress specifies the address (host:port) of the PostgreSQL database server
+	PostgresAddress string `env:"POSTGRES_ADDRESS"`
+
+	// PostgresDbName specifies the name of the PostgreSQL database to use
+	PostgresDbName string `env:"POSTGRES_DB_NAME"`
+
+	// PostgresUsername specifies the username of the PostgreSQL database
+	PostgresUsername string `env:"POSTGRES_USERNAME"`
+
+	// PostgresPassword specifies the password of the PostgreSQL database
+	PostgresPassword string `env:"POSTGRES_PASSWORD"`
+
+	// PostgresSSLMode specifies the SSL mode used when connecting to the PostgreSQL server.
+	// The options are 'disable' (the default), 'require', 'verify-ca', and 'verify-full'
+	PostgresSSLMode string `env:"POSTGRES_SSL_MODE"`
+
+	// PostgresCACertificate specifies the path of a file containing the CA certificate that was used to sign
+	// the server certificate used by the PostgreSQL server. The path is relative to the
+	// PersistenceRootPath configuration property if it doesn't start with a slash (/).
+	PostgresCACertificate string `env:"POSTGRES_CA_CERTIFICATE"`
+
+	// PostgresMaxOpenConnections specifies the maximum number of open connections to the PostgreSQL server
+	PostgresMaxOpenConnections int `env:"POSTGRES_MAX_OPEN_CONNECTIONS"`
+
 	// DatabaseConnectTimeout specifies that the timeout in seconds of database connection attempts on startup
 	// The default value is 300
 	DatabaseConnectTimeout int `env:"DATABASE_CONNECT_TIMEOUT"`
@@ -286,11 +491,11 @@ type Config struct {
 	StorageMaintenanceInterval int16 `env:"STORAGE_MAINTENANCE_INTERVAL"`
 
 	// ObjectActivationInterval specifies the frequency in seconds of checking if there are inactive objects
-	// that are ready to be activated
+	// that are ready to be activated, and on the CSS, if there are rollouts whose next waves can be started
 	ObjectActivationInterval int16 `env:"OBJECT_ACTIVATION_INTERVAL"`
 
 	// StorageProvider specifies the type of the storage to be used by this node.
-	// For the CSS the options are 'mongo' (the default), and 'bolt'
+	// For the CSS the options are 'mongo' (the default), 'postgres', and 'bolt'
 	// For the ESS the options are 'inmemory' (the default), and 'bolt'
 	StorageProvider string `env:"STORAGE_PROVIDER"`
 
@@ -315,6 +520,48 @@ type Config struct {
 	// The default is empty (not set) meaning that the object's data is persisted internally in a
 	// path selected by the Sync Service.
 	ObjectsDataPath string `env:"OBJECTS_DATA_PATH"`
+
+	// DataStorageProvider specifies where the objects' data is stored.
+	// The options are '' (the default), meaning that the data is kept by the StorageProvider,
+	// and 's3', meaning that the data is kept in an S3 compatible bucket while the objects' meta data
+	// is kept by the StorageProvider.
+	// DataStorageProvider can't be used when the StorageProvider is set to inmemory.
+	DataStorageProvider string `env:"DATA_STORAGE_PROVIDER"`
+
+	// S3Endpoint specifies the URL of the S3 compatible service, for example https://s3.amazonaws.com
+	// or http://localhost:9000. Buckets are always addressed using path-style requests.
+	S3Endpoint string `env:"S3_ENDPOINT"`
+
+	// S3Region specifies the region used to sign requests to the S3 compatible service
+	// The default value is us-east-1
+	S3Region string `env:"S3_REGION"`
+
+	// S3Bucket specifies the name of the bucket in which the objects' data is stored.
+	// If the bucket doesn't exist, the Sync Service creates it.
+	S3Bucket string `env:"S3_BUCKET"`
+
+	// S3AccessKeyID specifies the access key ID used to access the S3 compatible service
+	S3AccessKeyID string `env:"S3_ACCESS_KEY_ID"`
+
+	// S3SecretAccessKey specifies the secret access key used to access the S3 compatible service
+	S3SecretAccessKey string `env:"S3_SECRET_ACCESS_KEY"`
+
+	// S3PartSize specifies the size in bytes of the parts of multipart uploads to the S3 compatible service.
+	// Data chunks received by the Sync Service are combined into parts of this size.
+	// The minimum (and default) value is 5242880 (5MB)
+	S3PartSize int64 `env:"S3_PART_SIZE"`
+
+	// EncryptionKeyProvider specifies the provider of the keys used to encrypt objects' data.
+	// The options are '' (the default), meaning that objects' data is not encrypted, unless a key provider
+	// is set by the code embedding the Sync Service, and 'file', meaning that the keys are read from EncryptionKeyFile.
+	// The data of an object is encrypted only if the provider has a key for the object's organization.
+	// Objects with a source or destination data URI are not encrypted.
+	EncryptionKeyProvider string `env:"ENCRYPTION_KEY_PROVIDER"`
+
+	// EncryptionKeyFile specifies the path of the JSON file with the keys of the organizations,
+	// used when EncryptionKeyProvider is 'file'. The path is relative to the
+	// PersistenceRootPath configuration property if it doesn't start with a slash (/).
+	EncryptionKeyFile string `env:"ENCRYPTION_KEY_FILE"`
 }
 
 // Configuration contains the read in configuration
@@ -622,12 +869,49 @@ func ValidateConfig() error {
 		Configuration.MaxInflightChunks = 64
 	}
 
+	if Configuration.WebhookMaxAttempts < 1 {
+		Configuration.WebhookMaxAttempts = 1
+	}
+	if Configuration.WebhookRetryInterval < 1 {
+		Configuration.WebhookRetryInterval = 1
+	}
+
+	if Configuration.AuditLogRetention < 0 {
+		Configuration.AuditLogRetention = 0
+	}
+
+	if Configuration.OrgMaxObjects < 0 || Configuration.OrgMaxDataSize < 0 || Configuration.OrgMaxObjectSize < 0 {
+		return &configError{"The organization limits OrgMaxObjects, OrgMaxDataSize and OrgMaxObjectSize can't be negative"}
+	}
+
+	if Configuration.MaxObjectVersions < 0 {
+		return &configError{"MaxObjectVersions can't be negative"}
+	}
+
+	if _, err := ParseRateLimits(Configuration.RateLimitByRole, true); err != nil {
+		return &configError{"Invalid RateLimitByRole. " + err.Error()}
+	}
+	if _, err := ParseRateLimits(Configuration.RateLimitByOrg, false); err != nil {
+		return &configError{"Invalid RateLimitByOrg. " + err.Error()}
+	}
+	if Configuration.RateLimitESSPolling < 0 {
+		return &configError{"RateLimitESSPolling can't be negative"}
+	}
+	if Configuration.RateLimitBurst <= 0 {
+		Configuration.RateLimitBurst = 1
+	}
+
+	if Configuration.MaxDeltaSize <= 0 {
+		Configuration.MaxDeltaSize = 4 * 1024 * 1024
+	}
+
 	Configuration.StorageProvider = strings.ToLower(Configuration.StorageProvider)
 	if Configuration.NodeType == CSS {
 		if Configuration.StorageProvider == "" {
 			Configuration.StorageProvider = Mongo
-		} else if Configuration.StorageProvider != Mongo && Configuration.StorageProvider != Bolt {
-			return &configError{"Invalid StorageProvider, for CSS please specify any off: 'mongo', 'bolt', or leave as empty string"}
+		} else if Configuration.StorageProvider != Mongo && Configuration.StorageProvider != Postgres &&
+			Configuration.StorageProvider != Bolt {
+			return &configError{"Invalid StorageProvider, for CSS please specify any off: 'mongo', 'postgres', 'bolt', or leave as empty string"}
 		}
 	} else {
 		if Configuration.StorageProvider == "" {
@@ -636,6 +920,18 @@ func ValidateConfig() error {
 			return &configError{"Invalid StorageProvider, for ESS please specify any off: 'inmemory', 'bolt', or leave as empty string"}
 		}
 	}
+	if Configuration.StorageProvider == Postgres {
+		Configuration.PostgresSSLMode = strings.ToLower(Configuration.PostgresSSLMode)
+		if Configuration.PostgresSSLMode == "" {
+			Configuration.PostgresSSLMode = "disable"
+		} else if Configuration.PostgresSSLMode != "disable" && Configuration.PostgresSSLMode != "require" &&
+			Configuration.PostgresSSLMode != "verify-ca" && Configuration.PostgresSSLMode != "verify-full" {
+			return &configError{"Invalid PostgresSSLMode, please specify any of: 'disable', 'require', 'verify-ca', 'verify-full'"}
+		}
+		if Configuration.PostgresMaxOpenConnections <= 0 {
+			Configuration.PostgresMaxOpenConnections = 32
+		}
+	}
 	if len(Configuration.ObjectsDataPath) > 0 {
 		if Configuration.StorageProvider == Bolt {
 			if path, err := filepath.Abs(Configuration.ObjectsDataPath); err == nil {
@@ -648,9 +944,261 @@ func ValidateConfig() error {
 		}
 	}
 
+	Configuration.DataStorageProvider = strings.ToLower(Configuration.DataStorageProvider)
+	if Configuration.DataStorageProvider != "" {
+		if Configuration.DataStorageProvider != S3 {
+			return &configError{"Invalid DataStorageProvider, please specify 's3' or leave as empty string"}
+		}
+		if Configuration.StorageProvider == InMemory {
+			return &configError{"Invalid DataStorageProvider, it can't be set when StorageProvider is 'inmemory'"}
+		}
+		if len(Configuration.ObjectsDataPath) > 0 {
+			return &configError{"Invalid DataStorageProvider, it can't be set together with ObjectsDataPath"}
+		}
+		if Configuration.S3Endpoint == "" || Configuration.S3Bucket == "" {
+			return &configError{"S3Endpoint and S3Bucket must be specified when DataStorageProvider is 's3'"}
+		}
+		if endpoint, err := url.Parse(Configuration.S3Endpoint); err != nil ||
+			(endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+			return &configError{fmt.Sprintf("Invalid S3Endpoint (%s), please specify an http or https URL", Configuration.S3Endpoint)}
+		}
+		if Configuration.S3Region == "" {
+			Configuration.S3Region = "us-east-1"
+		}
+		if Configuration.S3PartSize == 0 {
+			Configuration.S3PartSize = 5 * 1024 * 1024
+		} else if Configuration.S3PartSize < 5*1024*1024 {
+			return &configError{"Invalid S3PartSize, the minimum value is 5242880"}
+		}
+	}
+
+	if Configuration.RequireSignedObjects && Configuration.SigningKeysDir == "" {
+		return &configError{"SigningKeysDir must be specified when RequireSignedObjects is true"}
+	}
+	if Configuration.SigningKeysDir != "" && !strings.HasPrefix(Configuration.SigningKeysDir, "/") {
+		Configuration.SigningKeysDir = Configuration.PersistenceRootPath + Configuration.SigningKeysDir
+	}
+
+	if strings.ToLower(Configuration.AuthenticationHandler) == "certificate" && Configuration.ClientCACertificate == "" {
+		return &configError{"ClientCACertificate must be specified when AuthenticationHandler is 'certificate'"}
+	}
+	if (Configuration.HTTPCSSClientCertificate == "") != (Configuration.HTTPCSSClientKey == "") {
+		return &configError{"HTTPCSSClientCertificate and HTTPCSSClientKey must be specified together"}
+	}
+	if Configuration.HTTPCSSClientCertificate != "" && !Configuration.HTTPCSSUseSSL {
+		return &configError{"HTTPCSSClientCertificate can only be specified when HTTPCSSUseSSL is true"}
+	}
+
+	if strings.ToLower(Configuration.AuthenticationHandler) == "jwt" {
+		if Configuration.JWTKeysFile == "" && Configuration.JWTIssuerKeyFile == "" {
+			return &configError{"JWTKeysFile or JWTIssuerKeyFile must be specified when AuthenticationHandler is 'jwt'"}
+		}
+		if Configuration.JWTTypeClaim == "" || Configuration.JWTOrgClaim == "" || Configuration.JWTIdentityClaim == "" {
+			return &configError{"JWTTypeClaim, JWTOrgClaim and JWTIdentityClaim can't be empty"}
+		}
+		if _, err := ParseJWTTypes(Configuration.JWTTypes); err != nil {
+			return &configError{"Invalid JWTTypes. " + err.Error()}
+		}
+	}
+	if Configuration.JWTKeysFile != "" && !strings.HasPrefix(Configuration.JWTKeysFile, "/") {
+		Configuration.JWTKeysFile = Configuration.PersistenceRootPath + Configuration.JWTKeysFile
+	}
+	if Configuration.JWTIssuerKeyFile != "" && !strings.HasPrefix(Configuration.JWTIssuerKeyFile, "/") {
+		Configuration.JWTIssuerKeyFile = Configuration.PersistenceRootPath + Configuration.JWTIssuerKeyFile
+	}
+	if Configuration.JWTTokenFile != "" && !strings.HasPrefix(Configuration.JWTTokenFile, "/") {
+		Configuration.JWTTokenFile = Configuration.PersistenceRootPath + Configuration.JWTTokenFile
+	}
+	if Configuration.DestinationPolicyFile != "" && !strings.HasPrefix(Configuration.DestinationPolicyFile, "/") {
+		Configuration.DestinationPolicyFile = Configuration.PersistenceRootPath + Configuration.DestinationPolicyFile
+	}
+	if _, err := ParseDestinationProperties(Configuration.DestinationProperties); err != nil {
+		return &configError{"Invalid DestinationProperties. " + err.Error()}
+	}
+
+	if Configuration.TracingFile != "" && !strings.HasPrefix(Configuration.TracingFile, "/") {
+		Configuration.TracingFile = filepath.Join(Configuration.TraceRootPath, Configuration.TracingFile)
+	}
+
+	Configuration.DataCompression = strings.ToLower(Configuration.DataCompression)
+	if Configuration.DataCompression == "" {
+		Configuration.DataCompression = NoCompression
+	} else if !isValidCompression(Configuration.DataCompression) {
+		return &configError{"Invalid DataCompression, please specify 'none', 'gzip' or 'zstd'"}
+	}
+	var err error
+	if dataCompressionByObjectType, err = parseDataCompressionPairs(Configuration.DataCompressionByObjectType); err != nil {
+		return &configError{"Invalid DataCompressionByObjectType. " + err.Error()}
+	}
+	if dataCompressionByOrg, err = parseDataCompressionPairs(Configuration.DataCompressionByOrg); err != nil {
+		return &configError{"Invalid DataCompressionByOrg. " + err.Error()}
+	}
+
+	if maxObjectVersionsByObjectType, err = parseObjectVersionsPairs(Configuration.MaxObjectVersionsByObjectType); err != nil {
+		return &configError{"Invalid MaxObjectVersionsByObjectType. " + err.Error()}
+	}
+
+	Configuration.EncryptionKeyProvider = strings.ToLower(Configuration.EncryptionKeyProvider)
+	if Configuration.EncryptionKeyProvider != "" {
+		if Configuration.EncryptionKeyProvider != FileKeyProvider {
+			return &configError{"Invalid EncryptionKeyProvider, please specify 'file' or leave as empty string"}
+		}
+		if Configuration.EncryptionKeyFile == "" {
+			return &configError{"EncryptionKeyFile must be specified when EncryptionKeyProvider is 'file'"}
+		}
+		if !strings.HasPrefix(Configuration.EncryptionKeyFile, "/") {
+			Configuration.EncryptionKeyFile = Configuration.PersistenceRootPath + Configuration.EncryptionKeyFile
+		}
+	}
+
 	return nil
 }
 
+var dataCompressionByObjectType map[string]string
+var dataCompressionByOrg map[string]string
+
+func isValidCompression(compression string) bool {
+	return compression == NoCompression || compression == GzipCompression || compression == ZstdCompression
+}
+
+func parseDataCompressionPairs(pairs string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(pairs, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		index := strings.LastIndex(pair, ":")
+		if index <= 0 {
+			return nil, &configError{fmt.Sprintf("%s is not a name:compression pair", pair)}
+		}
+		compression := strings.ToLower(strings.TrimSpace(pair[index+1:]))
+		if !isValidCompression(compression) {
+			return nil, &configError{fmt.Sprintf("Invalid compression %s, please specify 'none', 'gzip' or 'zstd'", compression)}
+		}
+		result[strings.TrimSpace(pair[:index])] = compression
+	}
+	return result, nil
+}
+
+// ParseJWTTypes parses a comma separated list of value:type pairs mapping the values of the type claim of tokens to user types
+func ParseJWTTypes(pairs string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(pairs, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		index := strings.LastIndex(pair, ":")
+		if index <= 0 {
+			return nil, &configError{fmt.Sprintf("%s is not a value:type pair", pair)}
+		}
+		userType := strings.ToLower(strings.TrimSpace(pair[index+1:]))
+		switch userType {
+		case "admin", "edgenode", "user", "syncadmin", "service":
+		default:
+			return nil, &configError{fmt.Sprintf("Invalid user type %s, please specify 'admin', 'edgenode', 'user', 'syncadmin' or 'service'", userType)}
+		}
+		result[strings.TrimSpace(pair[:index])] = userType
+	}
+	return result, nil
+}
+
+// ParseRateLimits parses a comma separated list of name:rate pairs of rate limits in calls per minute.
+// If roles is true, the names must be user roles.
+func ParseRateLimits(pairs string, roles bool) (map[string]int, error) {
+	result := make(map[string]int)
+	for _, pair := range strings.Split(pairs, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		index := strings.LastIndex(pair, ":")
+		if index <= 0 {
+			return nil, &configError{fmt.Sprintf("%s is not a name:rate pair", pair)}
+		}
+		rate, err := strconv.Atoi(strings.TrimSpace(pair[index+1:]))
+		if err != nil || rate <= 0 {
+			return nil, &configError{fmt.Sprintf("Invalid rate in %s, please specify a positive number of calls per minute", pair)}
+		}
+		name := strings.TrimSpace(pair[:index])
+		if roles {
+			name = strings.ToLower(name)
+			switch name {
+			case "admin", "edgenode", "user", "syncadmin", "service":
+			default:
+				return nil, &configError{fmt.Sprintf("Invalid role %s, please specify 'admin', 'edgenode', 'user', 'syncadmin' or 'service'", name)}
+			}
+		}
+		result[name] = rate
+	}
+	return result, nil
+}
+
+// ParseDestinationProperties parses a comma separated list of key=value pairs of the properties of a destination
+func ParseDestinationProperties(pairs string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(pairs, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		index := strings.Index(pair, "=")
+		if index <= 0 {
+			return nil, &configError{fmt.Sprintf("%s is not a key=value pair", pair)}
+		}
+		result[strings.TrimSpace(pair[:index])] = strings.TrimSpace(pair[index+1:])
+	}
+	if err := ValidateLabels(result); err != nil {
+		return nil, &configError{err.Error()}
+	}
+	return result, nil
+}
+
+var maxObjectVersionsByObjectType map[string]int
+
+func parseObjectVersionsPairs(pairs string) (map[string]int, error) {
+	result := make(map[string]int)
+	for _, pair := range strings.Split(pairs, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		index := strings.LastIndex(pair, ":")
+		if index <= 0 {
+			return nil, &configError{fmt.Sprintf("%s is not an objectType:versions pair", pair)}
+		}
+		versions, err := strconv.Atoi(strings.TrimSpace(pair[index+1:]))
+		if err != nil || versions < 0 {
+			return nil, &configError{fmt.Sprintf("Invalid number of versions in %s, please specify a non-negative number", pair)}
+		}
+		result[strings.TrimSpace(pair[:index])] = versions
+	}
+	return result, nil
+}
+
+// GetMaxObjectVersions returns the number of previous versions kept in the version history of objects of the given type
+func GetMaxObjectVersions(objectType string) int {
+	if versions, ok := maxObjectVersionsByObjectType[objectType]; ok {
+		return versions
+	}
+	return Configuration.MaxObjectVersions
+}
+
+// GetDataCompression returns the compression configured for the data of objects of the given organization and type
+func GetDataCompression(orgID string, objectType string) string {
+	if compression, ok := dataCompressionByObjectType[objectType]; ok {
+		return compression
+	}
+	if compression, ok := dataCompressionByOrg[orgID]; ok {
+		return compression
+	}
+	if Configuration.DataCompression == "" {
+		return NoCompression
+	}
+	return Configuration.DataCompression
+}
+
 func init() {
 	SetDefaultConfig(&Configuration)
 }
@@ -664,6 +1212,9 @@ func SetDefaultConfig(config *Config) {
 	config.UnsecureListeningPort = 8080
 	config.LeadershipTimeout = 30
 	config.AuthenticationHandler = "dummy"
+	config.JWTTypeClaim = "type"
+	config.JWTOrgClaim = "org"
+	config.JWTIdentityClaim = "sub"
 	config.CSSOnWIoTP = false
 	config.UsingEdgeConnector = false
 	config.MQTTUseSSL = true
@@ -683,9 +1234,15 @@ func SetDefaultConfig(config *Config) {
 	config.LogTraceMaintenanceInterval = 60
 	config.ResendInterval = 5
 	config.ESSPingInterval = 1
+	config.WebhookMaxAttempts = 10
+	config.WebhookRetryInterval = 10
 	config.RemoveESSRegistrationTime = 30
+	config.AuditLogRetention = 90
+	config.RateLimitBurst = 10
 	config.MaxDataChunkSize = 120 * 1024
 	config.MaxInflightChunks = 1
+	config.MaxDeltaSize = 4 * 1024 * 1024
+	config.DataCompression = NoCompression
 	config.MongoAddressCsv = "localhost:27017"
 	config.MongoDbName = "d_edge"
 	config.MongoAuthDbName = "admin"
@@ -695,6 +1252,15 @@ func SetDefaultConfig(config *Config) {
 	config.MongoCACertificate = ""
 	config.MongoAllowInvalidCertificates = false
 	config.MongoSessionCacheSize = 1
+	config.PostgresAddress = "localhost:5432"
+	config.PostgresDbName = "d_edge"
+	config.PostgresUsername = ""
+	config.PostgresPassword = ""
+	config.PostgresSSLMode = "disable"
+	config.PostgresCACertificate = ""
+	config.PostgresMaxOpenConnections = 32
+	config.S3Region = "us-east-1"
+	config.S3PartSize = 5 * 1024 * 1024
 	config.DatabaseConnectTimeout = 300
 	config.StorageMaintenanceInterval = 30
 	config.ObjectActivationInterval = 30
@@ -702,6 +1268,8 @@ func SetDefaultConfig(config *Config) {
 	config.HTTPPollingInterval = 10
 	config.HTTPCSSUseSSL = false
 	config.HTTPCSSCACertificate = ""
+	config.HTTPCSSClientCertificate = ""
+	config.HTTPCSSClientKey = ""
 	config.MessagingGroupCacheExpiration = 60
 	config.ShutdownQuiesceTime = 60
 	config.ESSConsumedObjectsKept = 1000
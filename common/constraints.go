@@ -0,0 +1,412 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The types of policy properties that can't be interpreted from their values
+const (
+	PropertyTypeVersion       = "version"
+	PropertyTypeListOfStrings = "list of strings"
+)
+
+// A constraint is an expression over the properties of the other side of a policy match, for example
+// "hardware == gpu && (region in eu,us || priority > 3)". An expression is made of comparisons of the form
+// name operator value, where the operator is one of ==, = (same as ==), !=, <, <=, >, >=, and in,
+// combined with && (or AND), || (or OR), and parentheses. && takes precedence over ||.
+// A value is either a double quoted string or a sequence of characters without spaces, the value of the in operator
+// is a comma separated list of values, or a version range, such as [1.0.0,2.0.0), for properties of type version.
+// A comparison with a property that doesn't exist is false.
+
+type constraintNode interface {
+	evaluate(properties []PolicyProperty) bool
+}
+
+type constraintAnd []constraintNode
+
+type constraintOr []constraintNode
+
+type constraintComparison struct {
+	name     string
+	operator string
+	value    string
+}
+
+var constraintOperators = []string{"==", "!=", "<=", ">=", "=", "<", ">"}
+
+type constraintParser struct {
+	input string
+	pos   int
+}
+
+// ValidateConstraints verifies that the constraints of a policy are valid constraint expressions
+func ValidateConstraints(constraints []string) SyncServiceError {
+	for _, constraint := range constraints {
+		if _, err := parseConstraint(constraint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SatisfiesConstraints returns true if the properties satisfy all the constraints
+func SatisfiesConstraints(properties []PolicyProperty, constraints []string) (bool, SyncServiceError) {
+	for _, constraint := range constraints {
+		node, err := parseConstraint(constraint)
+		if err != nil {
+			return false, err
+		}
+		if !node.evaluate(properties) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// PoliciesMatch returns true if the properties of each of the policies satisfy the constraints of the other policy.
+// A nil policy has no properties and no constraints.
+func PoliciesMatch(first *Policy, second *Policy) (bool, SyncServiceError) {
+	if first == nil {
+		first = &Policy{}
+	}
+	if second == nil {
+		second = &Policy{}
+	}
+	if ok, err := SatisfiesConstraints(second.Properties, first.Constraints); !ok || err != nil {
+		return false, err
+	}
+	return SatisfiesConstraints(first.Properties, second.Constraints)
+}
+
+func parseConstraint(constraint string) (constraintNode, SyncServiceError) {
+	parser := &constraintParser{input: constraint}
+	node, err := parser.parseOr()
+	if err == nil {
+		parser.skipSpaces()
+		if parser.pos < len(parser.input) {
+			err = fmt.Errorf("unexpected %s", parser.input[parser.pos:])
+		}
+	}
+	if err != nil {
+		return nil, &InvalidRequest{Message: fmt.Sprintf("Invalid constraint (%s): %s", constraint, err.Error())}
+	}
+	return node, nil
+}
+
+func (parser *constraintParser) parseOr() (constraintNode, error) {
+	node, err := parser.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	result := constraintOr{node}
+	for parser.nextKeyword("||", "OR") {
+		if node, err = parser.parseAnd(); err != nil {
+			return nil, err
+		}
+		result = append(result, node)
+	}
+	if len(result) == 1 {
+		return result[0], nil
+	}
+	return result, nil
+}
+
+func (parser *constraintParser) parseAnd() (constraintNode, error) {
+	node, err := parser.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	result := constraintAnd{node}
+	for parser.nextKeyword("&&", "AND") {
+		if node, err = parser.parseTerm(); err != nil {
+			return nil, err
+		}
+		result = append(result, node)
+	}
+	if len(result) == 1 {
+		return result[0], nil
+	}
+	return result, nil
+}
+
+func (parser *constraintParser) parseTerm() (constraintNode, error) {
+	parser.skipSpaces()
+	if parser.pos < len(parser.input) && parser.input[parser.pos] == '(' {
+		parser.pos++
+		node, err := parser.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		parser.skipSpaces()
+		if parser.pos >= len(parser.input) || parser.input[parser.pos] != ')' {
+			return nil, fmt.Errorf("missing )")
+		}
+		parser.pos++
+		return node, nil
+	}
+
+	name := parser.readName()
+	if name == "" {
+		return nil, fmt.Errorf("missing property name")
+	}
+	parser.skipSpaces()
+	operator := ""
+	for _, op := range constraintOperators {
+		if strings.HasPrefix(parser.input[parser.pos:], op) {
+			operator = op
+			parser.pos += len(op)
+			break
+		}
+	}
+	if operator == "" && parser.nextKeyword("in") {
+		operator = "in"
+	}
+	if operator == "" {
+		return nil, fmt.Errorf("missing operator after %s", name)
+	}
+	if operator == "=" {
+		operator = "=="
+	}
+	value, err := parser.readValue()
+	if err != nil {
+		return nil, err
+	}
+	return &constraintComparison{name: name, operator: operator, value: value}, nil
+}
+
+func (parser *constraintParser) skipSpaces() {
+	for parser.pos < len(parser.input) && (parser.input[parser.pos] == ' ' || parser.input[parser.pos] == '\t') {
+		parser.pos++
+	}
+}
+
+// nextKeyword consumes the next token if it is one of the keywords.
+// A keyword made of letters is matched regardless of case, and must be followed by a space or a parenthesis.
+func (parser *constraintParser) nextKeyword(keywords ...string) bool {
+	parser.skipSpaces()
+	rest := parser.input[parser.pos:]
+	for _, keyword := range keywords {
+		if len(rest) < len(keyword) || !strings.EqualFold(rest[:len(keyword)], keyword) {
+			continue
+		}
+		if isConstraintNameChar(keyword[0]) && len(rest) > len(keyword) && isConstraintNameChar(rest[len(keyword)]) {
+			continue
+		}
+		parser.pos += len(keyword)
+		return true
+	}
+	return false
+}
+
+func isConstraintNameChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || strings.IndexByte("_-./:", c) != -1
+}
+
+func (parser *constraintParser) readName() string {
+	start := parser.pos
+	for parser.pos < len(parser.input) && isConstraintNameChar(parser.input[parser.pos]) {
+		parser.pos++
+	}
+	return parser.input[start:parser.pos]
+}
+
+func (parser *constraintParser) readValue() (string, error) {
+	parser.skipSpaces()
+	if parser.pos >= len(parser.input) {
+		return "", fmt.Errorf("missing value")
+	}
+	start := parser.pos
+	switch parser.input[parser.pos] {
+	case '"':
+		end := strings.IndexByte(parser.input[start+1:], '"')
+		if end == -1 {
+			return "", fmt.Errorf("missing closing quote")
+		}
+		parser.pos = start + end + 2
+		return parser.input[start+1 : start+end+1], nil
+	case '[', '(':
+		// A version range
+		end := strings.IndexAny(parser.input[start+1:], "])")
+		if end == -1 {
+			return "", fmt.Errorf("missing end of version range")
+		}
+		parser.pos = start + end + 2
+		return parser.input[start:parser.pos], nil
+	}
+	for parser.pos < len(parser.input) && strings.IndexByte(" \t()&|\"", parser.input[parser.pos]) == -1 {
+		parser.pos++
+	}
+	if parser.pos == start {
+		return "", fmt.Errorf("missing value")
+	}
+	return parser.input[start:parser.pos], nil
+}
+
+func (node constraintAnd) evaluate(properties []PolicyProperty) bool {
+	for _, child := range node {
+		if !child.evaluate(properties) {
+			return false
+		}
+	}
+	return true
+}
+
+func (node constraintOr) evaluate(properties []PolicyProperty) bool {
+	for _, child := range node {
+		if child.evaluate(properties) {
+			return true
+		}
+	}
+	return false
+}
+
+func (node *constraintComparison) evaluate(properties []PolicyProperty) bool {
+	var property *PolicyProperty
+	for index := range properties {
+		if properties[index].Name == node.name {
+			property = &properties[index]
+			break
+		}
+	}
+	if property == nil {
+		return false
+	}
+
+	if property.Type == PropertyTypeVersion {
+		version, err := ParseSemVer(fmt.Sprint(property.Value))
+		if err != nil {
+			return false
+		}
+		if node.operator == "in" {
+			versionRange, err := ParseSemVerRange(node.value)
+			return err == nil && versionRange.IsInRange(version)
+		}
+		value, err := ParseSemVer(node.value)
+		return err == nil && compareConstraint(version.Compare(value), node.operator)
+	}
+
+	switch value := property.Value.(type) {
+	case bool:
+		expected, err := strconv.ParseBool(node.value)
+		if err != nil {
+			return false
+		}
+		switch node.operator {
+		case "==":
+			return value == expected
+		case "!=":
+			return value != expected
+		}
+		return false
+	case string:
+		if property.Type == PropertyTypeListOfStrings {
+			return evaluateListConstraint(strings.Split(value, ","), node)
+		}
+		switch node.operator {
+		case "==":
+			return value == node.value
+		case "!=":
+			return value != node.value
+		case "in":
+			return containsConstraintValue(strings.Split(node.value, ","), value)
+		}
+		number, err := strconv.ParseFloat(value, 64)
+		return err == nil && evaluateNumberConstraint(number, node)
+	case []interface{}:
+		list := make([]string, len(value))
+		for index, element := range value {
+			list[index] = fmt.Sprint(element)
+		}
+		return evaluateListConstraint(list, node)
+	}
+
+	number, ok := numericPropertyValue(property.Value)
+	return ok && evaluateNumberConstraint(number, node)
+}
+
+// evaluateNumberConstraint evaluates a comparison with a numeric property
+func evaluateNumberConstraint(number float64, node *constraintComparison) bool {
+	if node.operator == "in" {
+		for _, element := range strings.Split(node.value, ",") {
+			if expected, err := strconv.ParseFloat(strings.TrimSpace(element), 64); err == nil && expected == number {
+				return true
+			}
+		}
+		return false
+	}
+	expected, err := strconv.ParseFloat(node.value, 64)
+	if err != nil {
+		return false
+	}
+	comparison := 0
+	if number < expected {
+		comparison = -1
+	} else if number > expected {
+		comparison = 1
+	}
+	return compareConstraint(comparison, node.operator)
+}
+
+// evaluateListConstraint evaluates a comparison with a property that is a list of strings:
+// == is true if the list contains the value, != if it doesn't, and in if the list contains one of the values
+func evaluateListConstraint(list []string, node *constraintComparison) bool {
+	switch node.operator {
+	case "==":
+		return containsConstraintValue(list, node.value)
+	case "!=":
+		return !containsConstraintValue(list, node.value)
+	case "in":
+		for _, value := range strings.Split(node.value, ",") {
+			if containsConstraintValue(list, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsConstraintValue(list []string, value string) bool {
+	value = strings.TrimSpace(value)
+	for _, element := range list {
+		if strings.TrimSpace(element) == value {
+			return true
+		}
+	}
+	return false
+}
+
+func compareConstraint(comparison int, operator string) bool {
+	switch operator {
+	case "==":
+		return comparison == 0
+	case "!=":
+		return comparison != 0
+	case "<":
+		return comparison < 0
+	case "<=":
+		return comparison <= 0
+	case ">":
+		return comparison > 0
+	case ">=":
+		return comparison >= 0
+	}
+	return false
+}
+
+func numericPropertyValue(value interface{}) (float64, bool) {
+	switch number := value.(type) {
+	case float64:
+		return number, true
+	case float32:
+		return float64(number), true
+	case int:
+		return float64(number), true
+	case int32:
+		return float64(number), true
+	case int64:
+		return float64(number), true
+	}
+	return 0, false
+}
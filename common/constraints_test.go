@@ -0,0 +1,122 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestConstraints(t *testing.T) {
+	properties := []PolicyProperty{
+		{Name: "hardware", Value: "gpu"},
+		{Name: "region", Value: "eu"},
+		{Name: "cores", Value: float64(8)},
+		{Name: "memory", Value: int64(16)},
+		{Name: "production", Value: true},
+		{Name: "os-version", Value: "2.1.3", Type: PropertyTypeVersion},
+		{Name: "features", Value: "camera,lidar", Type: PropertyTypeListOfStrings},
+		{Name: "sensors", Value: []interface{}{"temperature", "humidity"}},
+		{Name: "rack", Value: "12"},
+	}
+
+	tests := []struct {
+		constraint string
+		satisfied  bool
+	}{
+		{"hardware == gpu", true},
+		{"hardware = gpu", true},
+		{"hardware=gpu", true},
+		{`hardware == "gpu"`, true},
+		{"hardware != gpu", false},
+		{"hardware == cpu", false},
+		{"region in eu,us", true},
+		{"region in us,asia", false},
+		{"cores > 4", true},
+		{"cores >= 8", true},
+		{"cores < 8", false},
+		{"cores <= 8.5", true},
+		{"cores in 2,4,8", true},
+		{"cores == many", false},
+		{"memory == 16", true},
+		{"memory > 32", false},
+		{"production == true", true},
+		{"production != true", false},
+		{"production > true", false},
+		{"os-version >= 2.0.0", true},
+		{"os-version < 2.1.3", false},
+		{"os-version in [2.0.0,3.0.0)", true},
+		{"os-version in (2.1.3,INFINITY)", false},
+		{"features == lidar", true},
+		{"features != lidar", false},
+		{"features in radar,camera", true},
+		{"sensors == humidity", true},
+		{"sensors == pressure", false},
+		{"rack > 10", true},
+		{"missing == x", false},
+		{"missing != x", false},
+		{"hardware == gpu && region == eu", true},
+		{"hardware == gpu AND region == us", false},
+		{"hardware == cpu || region == eu", true},
+		{"hardware == cpu or region == eu", true},
+		{"hardware == cpu || region == eu && cores > 16", false},
+		{"(hardware == cpu || region == eu) && cores > 4", true},
+		{"hardware == gpu && (region == us || (cores > 4 && production == true))", true},
+		{"(os-version in [2.0.0,3.0.0))", true},
+	}
+
+	for _, test := range tests {
+		satisfied, err := SatisfiesConstraints(properties, []string{test.constraint})
+		if err != nil {
+			t.Errorf("Failed to evaluate the constraint %s. Error: %s", test.constraint, err.Error())
+		} else if satisfied != test.satisfied {
+			t.Errorf("The constraint %s is satisfied: %t instead of %t", test.constraint, satisfied, test.satisfied)
+		}
+	}
+
+	if satisfied, err := SatisfiesConstraints(properties, []string{"hardware == gpu", "region == us"}); err != nil || satisfied {
+		t.Errorf("Constraints that aren't all satisfied were satisfied. Error: %v", err)
+	}
+	if satisfied, err := SatisfiesConstraints(nil, nil); err != nil || !satisfied {
+		t.Errorf("Empty constraints weren't satisfied. Error: %v", err)
+	}
+
+	invalid := []string{"", "hardware", "hardware ==", "== gpu", "hardware ~ gpu", "(hardware == gpu", "hardware == gpu)",
+		`hardware == "gpu`, "hardware == gpu &&", "hardware == gpu region == eu", "os-version in [1.0.0,2.0.0"}
+	for _, constraint := range invalid {
+		if err := ValidateConstraints([]string{constraint}); err == nil {
+			t.Errorf("The invalid constraint %s was accepted", constraint)
+		} else if !IsInvalidRequest(err) {
+			t.Errorf("Validating the constraint %s returned an error that isn't an InvalidRequest", constraint)
+		}
+	}
+}
+
+func TestPoliciesMatch(t *testing.T) {
+	objectPolicy := &Policy{
+		Properties:  []PolicyProperty{{Name: "purpose", Value: "model"}},
+		Constraints: []string{"hardware == gpu"},
+	}
+
+	tests := []struct {
+		policy  *Policy
+		matches bool
+	}{
+		{&Policy{Properties: []PolicyProperty{{Name: "hardware", Value: "gpu"}}}, true},
+		{&Policy{Properties: []PolicyProperty{{Name: "hardware", Value: "gpu"}}, Constraints: []string{"purpose == model"}}, true},
+		{&Policy{Properties: []PolicyProperty{{Name: "hardware", Value: "gpu"}}, Constraints: []string{"purpose == config"}}, false},
+		{&Policy{Properties: []PolicyProperty{{Name: "hardware", Value: "cpu"}}}, false},
+		{nil, false},
+	}
+	for index, test := range tests {
+		if matches, err := PoliciesMatch(objectPolicy, test.policy); err != nil {
+			t.Errorf("PoliciesMatch failed (test %d). Error: %s", index, err.Error())
+		} else if matches != test.matches {
+			t.Errorf("PoliciesMatch returned %t instead of %t (test %d)", matches, test.matches, index)
+		}
+	}
+
+	if matches, err := PoliciesMatch(&Policy{}, nil); err != nil || !matches {
+		t.Errorf("A policy without constraints didn't match a destination without a policy. Error: %v", err)
+	}
+	if _, err := PoliciesMatch(&Policy{Constraints: []string{"hardware =="}}, tests[0].policy); err == nil {
+		t.Errorf("PoliciesMatch accepted an invalid constraint")
+	}
+}
@@ -0,0 +1,77 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DestinationGroupPrefix is the prefix of the entries of the destinations list of an object that target a destination group,
+// i.e., group:<name> targets all the destinations of the group <name>
+const DestinationGroupPrefix = "group:"
+
+// DestinationGroup is a named group of destinations of an organization.
+// Objects target all the destinations of a group by including group:<name> in their destinations list,
+// and are added to or removed from destinations when they are added to or removed from the group.
+// swagger:model
+type DestinationGroup struct {
+	// OrgID is the organization ID of the group
+	OrgID string `json:"orgID" bson:"org-id"`
+
+	// Name is the name of the group
+	Name string `json:"name" bson:"name"`
+
+	// Destinations are the destinations of the group as type:id pairs.
+	// A destination can be added to a group before it registers.
+	Destinations []string `json:"destinations" bson:"destinations"`
+
+	// LastUpdate is the time the group was last updated
+	LastUpdate time.Time `json:"lastUpdate" bson:"last-update"`
+}
+
+// GetDestinationGroupName returns the name of the group targeted by an entry of a destinations list,
+// and false if the entry is a type:id pair of a destination
+func GetDestinationGroupName(destination string) (string, bool) {
+	if !strings.HasPrefix(destination, DestinationGroupPrefix) {
+		return "", false
+	}
+	return destination[len(DestinationGroupPrefix):], true
+}
+
+// Validate verifies that the name of the group is valid and that its destinations are valid type:id pairs
+func (group *DestinationGroup) Validate() SyncServiceError {
+	if !IsValidName(group.Name) {
+		return &InvalidRequest{Message: fmt.Sprintf("Invalid destination group name (%s)", group.Name)}
+	}
+	for _, destination := range group.Destinations {
+		parts := strings.Split(destination, ":")
+		if len(parts) != 2 || !IsValidName(parts[0]) || !IsValidName(parts[1]) {
+			return &InvalidRequest{Message: fmt.Sprintf("Invalid destination %s in destination group %s", destination, group.Name)}
+		}
+		if parts[0]+":" == DestinationGroupPrefix {
+			return &InvalidRequest{Message: fmt.Sprintf("A destination group (%s) can't be a member of destination group %s",
+				destination, group.Name)}
+		}
+	}
+	return nil
+}
+
+// Contains returns true if the destination is in the group
+func (group *DestinationGroup) Contains(destType string, destID string) bool {
+	for _, destination := range group.Destinations {
+		if destination == destType+":"+destID {
+			return true
+		}
+	}
+	return false
+}
+
+// TargetsDestinationGroup returns true if the destinations list includes the destination group
+func TargetsDestinationGroup(destinationsList []string, name string) bool {
+	for _, destination := range destinationsList {
+		if groupName, ok := GetDestinationGroupName(destination); ok && groupName == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestDestinationGroupValidate(t *testing.T) {
+	tests := []struct {
+		group DestinationGroup
+		valid bool
+	}{
+		{DestinationGroup{Name: "fleet1", Destinations: []string{"device:dev1", "gateway:gw1"}}, true},
+		{DestinationGroup{Name: "fleet1"}, true},
+		{DestinationGroup{Name: "", Destinations: []string{"device:dev1"}}, false},
+		{DestinationGroup{Name: "fleet/1", Destinations: []string{"device:dev1"}}, false},
+		{DestinationGroup{Name: "fleet1", Destinations: []string{"device"}}, false},
+		{DestinationGroup{Name: "fleet1", Destinations: []string{"device:dev1:dev2"}}, false},
+		{DestinationGroup{Name: "fleet1", Destinations: []string{":dev1"}}, false},
+		{DestinationGroup{Name: "fleet1", Destinations: []string{"group:fleet2"}}, false},
+	}
+	for index, test := range tests {
+		err := test.group.Validate()
+		if test.valid && err != nil {
+			t.Errorf("Validate failed (test %d). Error: %s", index, err.Error())
+		} else if !test.valid && err == nil {
+			t.Errorf("Validate accepted an invalid destination group (test %d)", index)
+		} else if !test.valid && !IsInvalidRequest(err) {
+			t.Errorf("Validate returned an error that isn't an InvalidRequest (test %d)", index)
+		}
+	}
+
+	group := DestinationGroup{Name: "fleet1", Destinations: []string{"device:dev1"}}
+	if !group.Contains("device", "dev1") || group.Contains("device", "dev2") {
+		t.Errorf("Contains returned incorrect results for %v", group.Destinations)
+	}
+	if !TargetsDestinationGroup([]string{"device:dev2", "group:fleet1"}, "fleet1") ||
+		TargetsDestinationGroup([]string{"device:fleet1", "group:fleet2"}, "fleet1") {
+		t.Errorf("TargetsDestinationGroup returned incorrect results")
+	}
+}
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"sync/atomic"
 	"time"
 )
 
@@ -57,6 +58,16 @@ type UsageInfo struct {
 	StoredObjects  uint32 `json:"storedObjects"`
 }
 
+// TrafficInfo describes the traffic of the sync-service node, it is reported only by the metrics endpoint.
+// The counters are updated atomically, without the health status lock.
+type TrafficInfo struct {
+	NotificationResends uint64
+	MQTTBytesSent       uint64
+	MQTTBytesReceived   uint64
+	HTTPBytesSent       uint64
+	HTTPBytesReceived   uint64
+}
+
 // HealthStatus describes the health status of the sync-service node
 var HealthStatus HealthStatusInfo
 
@@ -69,6 +80,9 @@ var MQTTHealth MQTTHealthStatusInfo
 // HealthUsageInfo describes the usage of the sync-service node
 var HealthUsageInfo UsageInfo
 
+// Traffic describes the traffic of the sync-service node
+var Traffic TrafficInfo
+
 func init() {
 	DBHealth = DBHealthStatusInfo{DisconnectedFromDB: true}
 	MQTTHealth = MQTTHealthStatusInfo{DisconnectedFromMQTTBroker: true}
@@ -185,6 +199,55 @@ func (hs *HealthStatusInfo) ClientRequestReceived() {
 	HealthUsageInfo.ClientRequests++
 }
 
+// GetUsage returns a copy of the usage of the node, taken under the health status lock
+func (hs *HealthStatusInfo) GetUsage() UsageInfo {
+	hs.lock()
+	defer hs.unLock()
+	return HealthUsageInfo
+}
+
+// GetHealth returns a copy of the health status of the node, its database and its MQTT connection,
+// taken under the health status lock
+func (hs *HealthStatusInfo) GetHealth() (HealthStatusInfo, DBHealthStatusInfo, MQTTHealthStatusInfo) {
+	hs.lock()
+	defer hs.unLock()
+	return *hs, DBHealth, MQTTHealth
+}
+
+// NotificationResent increments the notification resends counter
+func (hs *HealthStatusInfo) NotificationResent() {
+	atomic.AddUint64(&Traffic.NotificationResends, 1)
+}
+
+// DataSent adds the number of bytes sent using the protocol (MQTT or HTTP) to the traffic counters
+func (hs *HealthStatusInfo) DataSent(protocol string, bytes int) {
+	if protocol == HTTPProtocol {
+		atomic.AddUint64(&Traffic.HTTPBytesSent, uint64(bytes))
+	} else {
+		atomic.AddUint64(&Traffic.MQTTBytesSent, uint64(bytes))
+	}
+}
+
+// DataReceived adds the number of bytes received using the protocol (MQTT or HTTP) to the traffic counters
+func (hs *HealthStatusInfo) DataReceived(protocol string, bytes int) {
+	if protocol == HTTPProtocol {
+		atomic.AddUint64(&Traffic.HTTPBytesReceived, uint64(bytes))
+	} else {
+		atomic.AddUint64(&Traffic.MQTTBytesReceived, uint64(bytes))
+	}
+}
+
+// GetTraffic returns a snapshot of the traffic counters
+func (hs *HealthStatusInfo) GetTraffic() TrafficInfo {
+	return TrafficInfo{
+		NotificationResends: atomic.LoadUint64(&Traffic.NotificationResends),
+		MQTTBytesSent:       atomic.LoadUint64(&Traffic.MQTTBytesSent),
+		MQTTBytesReceived:   atomic.LoadUint64(&Traffic.MQTTBytesReceived),
+		HTTPBytesSent:       atomic.LoadUint64(&Traffic.HTTPBytesSent),
+		HTTPBytesReceived:   atomic.LoadUint64(&Traffic.HTTPBytesReceived),
+	}
+}
+
 // UpdateHealthInfo updates the current health status of the sync service node
 func (hs *HealthStatusInfo) UpdateHealthInfo(details bool, registeredESS uint32, storedObjects uint32) {
 	hs.lock()
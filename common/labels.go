@@ -0,0 +1,130 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The operators of the requirements of a label selector
+const (
+	LabelEquals     = "="
+	LabelNotEquals  = "!="
+	LabelExists     = "exists"
+	LabelNotExists  = "!exists"
+	maxLabelKeySize = 253
+	maxLabelSize    = 63
+)
+
+// IsValidLabelKey checks that a label key starts with a letter or digit, and contains only letters, digits, '-', '_', '.' and '/'
+var IsValidLabelKey = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9\-_./]*$`).MatchString
+
+// IsValidLabelValue checks that a label value contains only letters, digits, '-', '_' and '.'
+var IsValidLabelValue = regexp.MustCompile(`^[a-zA-Z0-9\-_.]*$`).MatchString
+
+// LabelRequirement is a requirement of a label selector on one of the labels of an object
+type LabelRequirement struct {
+	Key      string
+	Operator string
+	Value    string
+}
+
+// LabelSelector selects objects by their labels, an object is selected if it satisfies all the requirements
+type LabelSelector []LabelRequirement
+
+// ValidateLabels verifies that the keys and values of the labels of an object are valid
+func ValidateLabels(labels map[string]string) SyncServiceError {
+	for key, value := range labels {
+		if len(key) > maxLabelKeySize || !IsValidLabelKey(key) {
+			return &InvalidRequest{Message: fmt.Sprintf("Label key (%s) is invalid", key)}
+		}
+		if len(value) > maxLabelSize || !IsValidLabelValue(value) {
+			return &InvalidRequest{Message: fmt.Sprintf("Value (%s) of label %s is invalid", value, key)}
+		}
+	}
+	return nil
+}
+
+// ParseLabelSelector parses a comma separated list of label requirements, for example env=prod,tier!=canary.
+// A requirement is one of key=value (or key==value), key!=value, key (the object has the label),
+// and !key (the object doesn't have the label).
+func ParseLabelSelector(selector string) (LabelSelector, SyncServiceError) {
+	result := make(LabelSelector, 0)
+	if strings.TrimSpace(selector) == "" {
+		return result, nil
+	}
+	for _, part := range strings.Split(selector, ",") {
+		part = strings.TrimSpace(part)
+		var requirement LabelRequirement
+		if index := strings.Index(part, "!="); index != -1 {
+			requirement = LabelRequirement{Key: part[:index], Operator: LabelNotEquals, Value: part[index+2:]}
+		} else if index := strings.Index(part, "="); index != -1 {
+			requirement = LabelRequirement{Key: part[:index], Operator: LabelEquals,
+				Value: strings.TrimPrefix(part[index+1:], "=")}
+		} else if strings.HasPrefix(part, "!") {
+			requirement = LabelRequirement{Key: part[1:], Operator: LabelNotExists}
+		} else {
+			requirement = LabelRequirement{Key: part, Operator: LabelExists}
+		}
+		requirement.Key = strings.TrimSpace(requirement.Key)
+		requirement.Value = strings.TrimSpace(requirement.Value)
+		if !IsValidLabelKey(requirement.Key) || !IsValidLabelValue(requirement.Value) {
+			return nil, &InvalidRequest{Message: fmt.Sprintf("Invalid requirement (%s) in label selector %s", part, selector)}
+		}
+		result = append(result, requirement)
+	}
+	return result, nil
+}
+
+// Matches returns true if the labels satisfy all the requirements of the selector
+func (selector LabelSelector) Matches(labels map[string]string) bool {
+	for _, requirement := range selector {
+		value, ok := labels[requirement.Key]
+		switch requirement.Operator {
+		case LabelEquals:
+			if !ok || value != requirement.Value {
+				return false
+			}
+		case LabelNotEquals:
+			if ok && value == requirement.Value {
+				return false
+			}
+		case LabelExists:
+			if !ok {
+				return false
+			}
+		case LabelNotExists:
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// EqualityRequirement returns the first requirement of the selector that requires a label to have a value,
+// such a requirement can be used to look up the objects in an index of the labels
+func (selector LabelSelector) EqualityRequirement() (LabelRequirement, bool) {
+	for _, requirement := range selector {
+		if requirement.Operator == LabelEquals {
+			return requirement, true
+		}
+	}
+	return LabelRequirement{}, false
+}
+
+// String returns the selector in the syntax parsed by ParseLabelSelector
+func (selector LabelSelector) String() string {
+	parts := make([]string, len(selector))
+	for index, requirement := range selector {
+		switch requirement.Operator {
+		case LabelExists:
+			parts[index] = requirement.Key
+		case LabelNotExists:
+			parts[index] = "!" + requirement.Key
+		default:
+			parts[index] = requirement.Key + requirement.Operator + requirement.Value
+		}
+	}
+	return strings.Join(parts, ",")
+}
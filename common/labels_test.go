@@ -0,0 +1,63 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestLabelSelector(t *testing.T) {
+	labels := map[string]string{"env": "prod", "tier": "web", "team/owner": "edge"}
+
+	tests := []struct {
+		selector string
+		valid    bool
+		matches  bool
+	}{
+		{"", true, true},
+		{"env=prod", true, true},
+		{"env==prod", true, true},
+		{" env = prod , tier != canary ", true, true},
+		{"env=prod,tier!=web", true, false},
+		{"env=dev", true, false},
+		{"team/owner", true, true},
+		{"release", true, false},
+		{"!release", true, true},
+		{"!env", true, false},
+		{"region!=eu", true, true},
+		{"env=prod,", false, false},
+		{"=prod", false, false},
+		{"env=pr od", false, false},
+		{"-env=prod", false, false},
+	}
+
+	for _, test := range tests {
+		selector, err := ParseLabelSelector(test.selector)
+		if (err == nil) != test.valid {
+			t.Errorf("Parsing the selector %s returned the error %v", test.selector, err)
+			continue
+		}
+		if err != nil {
+			if !IsInvalidRequest(err) {
+				t.Errorf("Parsing the selector %s returned an error that isn't an InvalidRequest", test.selector)
+			}
+			continue
+		}
+		if selector.Matches(labels) != test.matches {
+			t.Errorf("The selector %s returned %t instead of %t", test.selector, !test.matches, test.matches)
+		}
+		if parsed, err := ParseLabelSelector(selector.String()); err != nil || parsed.String() != selector.String() {
+			t.Errorf("The selector %s was formatted as %s", test.selector, selector.String())
+		}
+	}
+}
+
+func TestValidateLabels(t *testing.T) {
+	if err := ValidateLabels(map[string]string{"env": "prod", "example.com/team": "", "a_b-c": "1.0_x-y"}); err != nil {
+		t.Errorf("Valid labels were rejected. Error: %s", err)
+	}
+	if err := ValidateLabels(map[string]string{"env=prod": "x"}); err == nil {
+		t.Errorf("A label key with '=' was accepted")
+	}
+	if err := ValidateLabels(map[string]string{"env": "a,b"}); err == nil {
+		t.Errorf("A label value with ',' was accepted")
+	}
+}
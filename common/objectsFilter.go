@@ -0,0 +1,117 @@
+package common
+
+import (
+	"encoding/base64"
+	"strings"
+)
+
+// ObjectsFilter specifies the objects returned by the APIs that list objects, and the page of the list to return.
+// The objects are listed in the order of their types and IDs.
+type ObjectsFilter struct {
+	// ObjectTypePrefix selects the objects whose type starts with the prefix
+	ObjectTypePrefix string
+
+	// Version selects the objects with the version
+	Version string
+
+	// Inactive selects the inactive (true) or active (false) objects
+	Inactive *bool
+
+	// Deleted selects the deleted (true) or not deleted (false) objects
+	Deleted *bool
+
+	// UpdatedSince selects the objects whose instance ID is greater than UpdatedSince,
+	// i.e., the objects that were updated after the update with this instance ID
+	UpdatedSince int64
+
+	// DestinationType selects the objects whose destination type is the type,
+	// or whose destinations list includes destinations of the type
+	DestinationType string
+
+	// Labels selects the objects whose labels satisfy the selector
+	Labels LabelSelector
+
+	// AfterObjectType and AfterObjectID select the objects that come after the object with this type and ID
+	// in the order of the list. They are set from the cursor of a page.
+	AfterObjectType string
+	AfterObjectID   string
+
+	// Limit is the maximal number of objects to return, zero means no limit
+	Limit int
+}
+
+// IsEmpty returns true if the filter selects all the objects in a single page
+func (filter *ObjectsFilter) IsEmpty() bool {
+	return filter.ObjectTypePrefix == "" && filter.Version == "" && filter.Inactive == nil && filter.Deleted == nil &&
+		filter.UpdatedSince == 0 && filter.DestinationType == "" && len(filter.Labels) == 0 &&
+		filter.AfterObjectType == "" && filter.Limit == 0
+}
+
+// Matches returns true if the object with the meta data is selected by the filter
+func (filter *ObjectsFilter) Matches(metaData MetaData) bool {
+	if filter.ObjectTypePrefix != "" && !strings.HasPrefix(metaData.ObjectType, filter.ObjectTypePrefix) {
+		return false
+	}
+	if filter.Version != "" && metaData.Version != filter.Version {
+		return false
+	}
+	if filter.Inactive != nil && metaData.Inactive != *filter.Inactive {
+		return false
+	}
+	if filter.Deleted != nil && metaData.Deleted != *filter.Deleted {
+		return false
+	}
+	if filter.UpdatedSince != 0 && metaData.InstanceID <= filter.UpdatedSince {
+		return false
+	}
+	if filter.DestinationType != "" && metaData.DestType != filter.DestinationType {
+		found := false
+		for _, destination := range metaData.DestinationsList {
+			if strings.HasPrefix(destination, filter.DestinationType+":") {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if !filter.Labels.Matches(metaData.Labels) {
+		return false
+	}
+	return filter.IsAfterCursor(metaData.ObjectType, metaData.ObjectID)
+}
+
+// IsAfterCursor returns true if the object with the type and ID comes after the cursor of the filter
+func (filter *ObjectsFilter) IsAfterCursor(objectType string, objectID string) bool {
+	if filter.AfterObjectType == "" {
+		return true
+	}
+	return IsObjectBefore(filter.AfterObjectType, filter.AfterObjectID, objectType, objectID)
+}
+
+// SetCursor sets the filter to select the objects of the page that starts after the cursor
+func (filter *ObjectsFilter) SetCursor(cursor string) SyncServiceError {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return &InvalidRequest{"Invalid cursor " + cursor}
+	}
+	// Object types can't include slashes
+	parts := strings.SplitN(string(decoded), "/", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return &InvalidRequest{"Invalid cursor " + cursor}
+	}
+	filter.AfterObjectType = parts[0]
+	filter.AfterObjectID = parts[1]
+	return nil
+}
+
+// ObjectsCursor returns the cursor of the page that starts after the object with the type and ID
+func ObjectsCursor(objectType string, objectID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(objectType + "/" + objectID))
+}
+
+// IsObjectBefore returns true if the first object comes before the second object in the order of the lists of objects
+func IsObjectBefore(objectType1 string, objectID1 string, objectType2 string, objectID2 string) bool {
+	return objectType1 < objectType2 || (objectType1 == objectType2 && objectID1 < objectID2)
+}
@@ -0,0 +1,208 @@
+package common
+
+import (
+	"fmt"
+	"time"
+)
+
+// Statuses of rollouts
+const (
+	RolloutInProgress = "inProgress" // The rollout starts its next wave when the current wave succeeds
+	RolloutPaused     = "paused"     // The rollout doesn't start more waves until it is resumed
+	RolloutCompleted  = "completed"  // All the destinations of the object were notified
+)
+
+// Rollout specifies the delivery of an object to its destinations in waves.
+// The first wave starts when the object is ready to be sent, and each of the following waves starts
+// after the previous wave succeeds: SuccessThreshold percent of its destinations have the object delivered
+// or consumed, and WaitTime seconds have passed since the wave started.
+// The destinations that are left after the listed waves are notified in a final wave.
+// swagger:model
+type Rollout struct {
+	// Waves are the sizes of the waves in the order of the waves
+	Waves []RolloutWave `json:"waves" bson:"waves"`
+
+	// WaitTime is the minimal time in seconds between the starts of consecutive waves
+	// Optional field, zero by default.
+	WaitTime int `json:"waitTime,omitempty" bson:"wait-time,omitempty"`
+
+	// SuccessThreshold is the percentage of the destinations of a wave that must have the object delivered or consumed
+	// for the next wave to start
+	// Optional field, 100 by default.
+	SuccessThreshold int `json:"successThreshold,omitempty" bson:"success-threshold,omitempty"`
+
+	// MaxErrorRate is the percentage of the notified destinations that may report an error; when it is exceeded the rollout is paused
+	// Optional field, zero (never pause) by default.
+	MaxErrorRate int `json:"maxErrorRate,omitempty" bson:"max-error-rate,omitempty"`
+}
+
+// RolloutWave is the size of a wave of a rollout, either a count or a percentage of the object's destinations
+// swagger:model
+type RolloutWave struct {
+	// Count is the number of destinations of the wave
+	Count int `json:"count,omitempty" bson:"count,omitempty"`
+
+	// Percentage is the percentage of the object's destinations in the wave
+	Percentage int `json:"percentage,omitempty" bson:"percentage,omitempty"`
+}
+
+// RolloutStatus is the state of the rollout of an instance of an object, kept by the CSS
+// swagger:model
+type RolloutStatus struct {
+	// OrgID is the organization ID of the object
+	OrgID string `json:"orgID" bson:"org-id"`
+
+	// ObjectType is the object type of the object
+	ObjectType string `json:"objectType" bson:"object-type"`
+
+	// ObjectID is the object ID of the object
+	ObjectID string `json:"objectID" bson:"object-id"`
+
+	// InstanceID is the instance ID of the object that is rolled out
+	InstanceID int64 `json:"instanceID" bson:"instance-id"`
+
+	// Status is the status of the rollout: inProgress, paused, or completed
+	Status string `json:"status" bson:"status"`
+
+	// Message is the reason the rollout was paused
+	Message string `json:"message,omitempty" bson:"message,omitempty"`
+
+	// Wave is the number of waves that were started
+	Wave int `json:"wave" bson:"wave"`
+
+	// WaveStartTime is the time the last wave was started
+	WaveStartTime time.Time `json:"waveStartTime" bson:"wave-start-time"`
+
+	// ResumedWave is the number of waves that were started when the rollout was last resumed.
+	// The errors reported by the destinations of these waves don't pause the rollout again.
+	ResumedWave int `json:"resumedWave,omitempty" bson:"resumed-wave,omitempty"`
+
+	// Destinations are the destinations that were notified, with their waves
+	Destinations []RolloutDestination `json:"destinations" bson:"destinations"`
+}
+
+// RolloutReport is the state of the rollout of an object with the progress of its waves
+// swagger:model
+type RolloutReport struct {
+	RolloutStatus
+
+	// TotalDestinations is the number of the object's destinations
+	TotalDestinations int `json:"totalDestinations"`
+
+	// Waves is the progress of the started waves
+	Waves []RolloutWaveProgress `json:"waves"`
+}
+
+// RolloutWaveProgress is the progress of a wave of a rollout
+// swagger:model
+type RolloutWaveProgress struct {
+	// Wave is the wave, starting from 1
+	Wave int `json:"wave"`
+
+	// Destinations is the number of destinations of the wave
+	Destinations int `json:"destinations"`
+
+	// Succeeded is the number of destinations of the wave that have the object delivered or consumed
+	Succeeded int `json:"succeeded"`
+
+	// Errors is the number of destinations of the wave that reported an error
+	Errors int `json:"errors"`
+}
+
+// RolloutDestination is a destination that was notified by a wave of a rollout
+// swagger:model
+type RolloutDestination struct {
+	// DestType is the destination type of the destination
+	DestType string `json:"destinationType" bson:"destination-type"`
+
+	// DestID is the destination ID of the destination
+	DestID string `json:"destinationID" bson:"destination-id"`
+
+	// Wave is the wave of the destination, starting from 1
+	Wave int `json:"wave" bson:"wave"`
+}
+
+// Progress returns the progress of the started waves of the rollout, given the delivery statuses of the object's destinations.
+// The notified destinations that are no longer destinations of the object are not counted.
+func (rollout *RolloutStatus) Progress(destinations []StoreDestinationStatus) []RolloutWaveProgress {
+	statuses := make(map[string]string, len(destinations))
+	for _, destination := range destinations {
+		statuses[destination.Destination.DestType+":"+destination.Destination.DestID] = destination.Status
+	}
+	progress := make([]RolloutWaveProgress, rollout.Wave)
+	for index := range progress {
+		progress[index].Wave = index + 1
+	}
+	for _, destination := range rollout.Destinations {
+		status, ok := statuses[destination.DestType+":"+destination.DestID]
+		if !ok || destination.Wave < 1 || destination.Wave > rollout.Wave {
+			continue
+		}
+		wave := &progress[destination.Wave-1]
+		wave.Destinations++
+		switch status {
+		case Delivered, Consumed:
+			wave.Succeeded++
+		case Error:
+			wave.Errors++
+		}
+	}
+	return progress
+}
+
+// Validate verifies that the rollout specification is valid
+func (rollout *Rollout) Validate() SyncServiceError {
+	if len(rollout.Waves) == 0 {
+		return &InvalidRequest{"A rollout must include at least one wave"}
+	}
+	for index, wave := range rollout.Waves {
+		if (wave.Count > 0) == (wave.Percentage > 0) || wave.Count < 0 || wave.Percentage < 0 || wave.Percentage > 100 {
+			return &InvalidRequest{fmt.Sprintf("Wave %d of the rollout must have either a positive count or a percentage between 1 and 100", index+1)}
+		}
+	}
+	if rollout.WaitTime < 0 {
+		return &InvalidRequest{"The wait time of a rollout can't be negative"}
+	}
+	if rollout.SuccessThreshold < 0 || rollout.SuccessThreshold > 100 {
+		return &InvalidRequest{"The success threshold of a rollout must be a percentage between 0 and 100"}
+	}
+	if rollout.MaxErrorRate < 0 || rollout.MaxErrorRate > 100 {
+		return &InvalidRequest{"The maximal error rate of a rollout must be a percentage between 0 and 100"}
+	}
+	return nil
+}
+
+// WaveSize returns the number of destinations of a wave, starting from 1, of a rollout to the given number of destinations.
+// The wave after the listed waves includes all the destinations.
+func (rollout *Rollout) WaveSize(wave int, destinations int) int {
+	if wave > len(rollout.Waves) {
+		return destinations
+	}
+	spec := rollout.Waves[wave-1]
+	if spec.Count > 0 {
+		return spec.Count
+	}
+	size := (destinations*spec.Percentage + 99) / 100
+	if size == 0 {
+		size = 1
+	}
+	return size
+}
+
+// IsWaveSucceeded returns true if the current wave, that was started at startTime and has the given number of
+// destinations of which succeeded have the object delivered or consumed, allows the next wave to start
+func (rollout *Rollout) IsWaveSucceeded(startTime time.Time, destinations int, succeeded int) bool {
+	if time.Since(startTime) < time.Duration(rollout.WaitTime)*time.Second {
+		return false
+	}
+	threshold := rollout.SuccessThreshold
+	if threshold == 0 {
+		threshold = 100
+	}
+	return succeeded*100 >= threshold*destinations
+}
+
+// IsErrorRateExceeded returns true if the given number of errors among the notified destinations exceeds the maximal error rate
+func (rollout *Rollout) IsErrorRateExceeded(destinations int, errors int) bool {
+	return rollout.MaxErrorRate > 0 && destinations > 0 && errors*100 > rollout.MaxErrorRate*destinations
+}
@@ -0,0 +1,107 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRolloutValidate(t *testing.T) {
+	tests := []struct {
+		rollout Rollout
+		valid   bool
+	}{
+		{Rollout{Waves: []RolloutWave{{Count: 1}, {Percentage: 50}}}, true},
+		{Rollout{Waves: []RolloutWave{{Percentage: 100}}, WaitTime: 60, SuccessThreshold: 90, MaxErrorRate: 10}, true},
+		{Rollout{}, false},
+		{Rollout{Waves: []RolloutWave{{}}}, false},
+		{Rollout{Waves: []RolloutWave{{Count: 1, Percentage: 10}}}, false},
+		{Rollout{Waves: []RolloutWave{{Count: -1}}}, false},
+		{Rollout{Waves: []RolloutWave{{Percentage: 101}}}, false},
+		{Rollout{Waves: []RolloutWave{{Count: 1}}, WaitTime: -1}, false},
+		{Rollout{Waves: []RolloutWave{{Count: 1}}, SuccessThreshold: 101}, false},
+		{Rollout{Waves: []RolloutWave{{Count: 1}}, MaxErrorRate: -5}, false},
+	}
+
+	for index, test := range tests {
+		err := test.rollout.Validate()
+		if (err == nil) != test.valid {
+			t.Errorf("Validating rollout %d returned the error %v", index, err)
+		} else if err != nil && !IsInvalidRequest(err) {
+			t.Errorf("Validating rollout %d returned an error that isn't an InvalidRequest", index)
+		}
+	}
+}
+
+func TestRolloutWaves(t *testing.T) {
+	rollout := Rollout{Waves: []RolloutWave{{Count: 2}, {Percentage: 25}, {Percentage: 1}}}
+
+	tests := []struct {
+		wave         int
+		destinations int
+		size         int
+	}{
+		{1, 10, 2},
+		{2, 10, 3},
+		{2, 3, 1},
+		{3, 10, 1},
+		{3, 0, 1},
+		{4, 10, 10},
+	}
+	for _, test := range tests {
+		if size := rollout.WaveSize(test.wave, test.destinations); size != test.size {
+			t.Errorf("The size of wave %d of %d destinations is %d instead of %d", test.wave, test.destinations, size, test.size)
+		}
+	}
+
+	if !rollout.IsWaveSucceeded(time.Now(), 4, 4) || rollout.IsWaveSucceeded(time.Now(), 4, 3) {
+		t.Errorf("The default success threshold isn't 100 percent")
+	}
+	rollout.SuccessThreshold = 75
+	rollout.WaitTime = 60
+	if rollout.IsWaveSucceeded(time.Now(), 4, 4) {
+		t.Errorf("A wave succeeded before the wait time passed")
+	}
+	if !rollout.IsWaveSucceeded(time.Now().Add(-time.Minute), 4, 3) || rollout.IsWaveSucceeded(time.Now().Add(-time.Minute), 4, 2) {
+		t.Errorf("The success threshold wasn't applied")
+	}
+
+	if rollout.IsErrorRateExceeded(10, 10) {
+		t.Errorf("A rollout without a maximal error rate exceeded it")
+	}
+	rollout.MaxErrorRate = 20
+	if rollout.IsErrorRateExceeded(10, 2) || !rollout.IsErrorRateExceeded(10, 3) || rollout.IsErrorRateExceeded(0, 0) {
+		t.Errorf("The maximal error rate wasn't applied")
+	}
+}
+
+func TestRolloutProgress(t *testing.T) {
+	status := RolloutStatus{Wave: 2, Destinations: []RolloutDestination{
+		{DestType: "device", DestID: "dev1", Wave: 1},
+		{DestType: "device", DestID: "dev2", Wave: 1},
+		{DestType: "device", DestID: "dev3", Wave: 2},
+		{DestType: "device", DestID: "dev4", Wave: 2},
+		{DestType: "device", DestID: "dev5", Wave: 2},
+	}}
+	destinations := []StoreDestinationStatus{
+		{Destination: Destination{DestType: "device", DestID: "dev1"}, Status: Consumed},
+		{Destination: Destination{DestType: "device", DestID: "dev2"}, Status: Error},
+		{Destination: Destination{DestType: "device", DestID: "dev3"}, Status: Delivered},
+		{Destination: Destination{DestType: "device", DestID: "dev4"}, Status: Delivering},
+		{Destination: Destination{DestType: "device", DestID: "dev6"}, Status: Pending},
+	}
+
+	progress := status.Progress(destinations)
+	expected := []RolloutWaveProgress{
+		{Wave: 1, Destinations: 2, Succeeded: 1, Errors: 1},
+		{Wave: 2, Destinations: 2, Succeeded: 1, Errors: 0},
+	}
+	if len(progress) != len(expected) {
+		t.Errorf("Progress returned %d waves instead of %d", len(progress), len(expected))
+		return
+	}
+	for index := range expected {
+		if progress[index] != expected[index] {
+			t.Errorf("The progress of wave %d is %v instead of %v", index+1, progress[index], expected[index])
+		}
+	}
+}
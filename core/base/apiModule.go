@@ -1,11 +1,16 @@
 package base
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math"
 	"net/url"
 	"os"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -13,7 +18,10 @@ import (
 	"github.com/open-horizon/edge-sync-service/common"
 	"github.com/open-horizon/edge-sync-service/core/communications"
 	"github.com/open-horizon/edge-sync-service/core/dataURI"
+	"github.com/open-horizon/edge-sync-service/core/encryption"
+	"github.com/open-horizon/edge-sync-service/core/signature"
 	"github.com/open-horizon/edge-sync-service/core/storage"
+	"github.com/open-horizon/edge-sync-service/core/tracing"
 	"github.com/open-horizon/edge-utilities/logger"
 	"github.com/open-horizon/edge-utilities/logger/log"
 	"github.com/open-horizon/edge-utilities/logger/trace"
@@ -22,18 +30,41 @@ import (
 var apiLock sync.RWMutex
 var apiObjectLocks common.Locks
 
+// destinationGroupsLock serializes the updates of destination groups. The updates of objects that target destination groups
+// hold it for reading, so that a group isn't deleted while an object that targets it is stored. It is taken before the objects'
+// locks (apiObjectLocks).
+var destinationGroupsLock sync.RWMutex
+
 func init() {
 	apiObjectLocks = *common.NewLocks("api")
 }
 
 // UpdateObject invoked when an app sends an updated object
+// The update starts a new trace of the delivery of the object
 func UpdateObject(orgID string, objectType string, objectID string, metaData common.MetaData, data []byte) common.SyncServiceError {
+	span := tracing.StartDeliverySpan("UpdateObject", orgID, objectType, objectID, nil)
+	err := updateObject(orgID, objectType, objectID, metaData, data)
+	span.End(err)
+	return err
+}
+
+func updateObject(orgID string, objectType string, objectID string, metaData common.MetaData, data []byte) common.SyncServiceError {
 	if trace.IsLogging(logger.DEBUG) {
 		trace.Debug("In UpdateObject. Update %s %s %s\n", orgID, objectType, objectID)
 	}
 
 	common.HealthStatus.ClientRequestReceived()
 
+	notificationsInfo, err := storeUpdatedObject(orgID, objectType, objectID, metaData, data)
+	if err != nil {
+		return err
+	}
+	return communications.SendNotifications(notificationsInfo)
+}
+
+// validateObject verifies that the object's meta data and data are valid for an update of the object.
+// It sets the size of an object whose data is read from a source data URI.
+func validateObject(orgID string, objectType string, objectID string, metaData *common.MetaData, data []byte) common.SyncServiceError {
 	if !common.IsValidName(orgID) {
 		return &common.InvalidRequest{Message: fmt.Sprintf("Organization ID (%s) contains invalid characters", orgID)}
 	}
@@ -78,6 +109,27 @@ func UpdateObject(orgID string, objectType string, objectID string, metaData com
 		return &common.InvalidRequest{Message: "Can't update data if MetaOnly is true"}
 	}
 
+	if err := common.ValidateLabels(metaData.Labels); err != nil {
+		return err
+	}
+
+	if metaData.Signature != "" {
+		if common.Configuration.NodeType == common.ESS {
+			return &common.InvalidRequest{Message: "Object signatures are not supported on ESS"}
+		}
+		if _, err := signature.DecodeSignature(metaData.Signature); err != nil {
+			return &common.InvalidRequest{Message: err.Error()}
+		}
+		if metaData.PublicKey == "" && metaData.SigningKeyID == "" {
+			return &common.InvalidRequest{Message: "A signed object must have a public key or a signing key ID"}
+		}
+	}
+	if metaData.PublicKey != "" {
+		if _, err := signature.ParsePublicKey(metaData.PublicKey); err != nil {
+			return &common.InvalidRequest{Message: err.Error()}
+		}
+	}
+
 	if metaData.DestID != "" && metaData.DestType == "" {
 		return &common.InvalidRequest{Message: "Destination ID provided without destination type in object's meta data"}
 	}
@@ -88,6 +140,18 @@ func UpdateObject(orgID string, objectType string, objectID string, metaData com
 		return &common.InvalidRequest{Message: "Both destinations list and destination type are specified"}
 	}
 
+	if metaData.Rollout != nil {
+		if common.Configuration.NodeType == common.ESS {
+			return &common.InvalidRequest{Message: "Rollouts are not supported on ESS"}
+		}
+		if metaData.DestinationPolicy != nil {
+			return &common.InvalidRequest{Message: "Both destination policy and rollout are specified"}
+		}
+		if err := metaData.Rollout.Validate(); err != nil {
+			return err
+		}
+	}
+
 	if metaData.DestinationPolicy != nil {
 		if metaData.DestType != "" {
 			return &common.InvalidRequest{Message: "Both destination policy and destination type are specified"}
@@ -104,6 +168,12 @@ func UpdateObject(orgID string, objectType string, objectID string, metaData com
 			}
 		}
 
+		if communications.IsPolicyEvaluated() {
+			if err := common.ValidateConstraints(metaData.DestinationPolicy.Constraints); err != nil {
+				return err
+			}
+		}
+
 		services := metaData.DestinationPolicy.Services
 		for _, service := range services {
 			if len(service.OrgID) == 0 || len(service.Arch) == 0 || len(service.ServiceName) == 0 || len(service.Version) == 0 {
@@ -163,12 +233,55 @@ func UpdateObject(orgID string, objectType string, objectID string, metaData com
 		}
 		if fi, err := os.Stat(uri.Path); err == nil {
 			metaData.ObjectSize = fi.Size()
+			metaData.OriginalSize = fi.Size()
 		} else {
 			log.Error(" Invalid source data URI: %s, failed to get file information for the file, err= %v\n", metaData.SourceDataURI, err)
 			return &common.InvalidRequest{Message: "Invalid source data URI"}
 		}
 	}
 
+	return nil
+}
+
+// storeUpdatedObject stores the updated object and prepares the notifications of its update,
+// the caller sends the notifications
+func storeUpdatedObject(orgID string, objectType string, objectID string, metaData common.MetaData,
+	data []byte) ([]common.NotificationInfo, common.SyncServiceError) {
+	destOrgID := metaData.DestOrgID
+	if destOrgID == "" {
+		destOrgID = orgID
+	}
+	unlockGroups := lockDestinationGroups(metaData.DestinationsList)
+	defer unlockGroups()
+
+	lockIndex := common.HashStrings(destOrgID, objectType, objectID)
+	apiObjectLocks.Lock(lockIndex)
+	defer apiObjectLocks.Unlock(lockIndex)
+
+	return storeUpdatedObjectLocked(orgID, objectType, objectID, metaData, data)
+}
+
+// lockDestinationGroups takes the destination groups lock (destinationGroupsLock) for reading if the destinations list
+// targets destination groups, and returns the function that releases it
+func lockDestinationGroups(destinationsList []string) func() {
+	for _, destination := range destinationsList {
+		if _, ok := common.GetDestinationGroupName(destination); ok {
+			destinationGroupsLock.RLock()
+			return destinationGroupsLock.RUnlock
+		}
+	}
+	return func() {}
+}
+
+// storeUpdatedObjectLocked stores the updated object and prepares the notifications of its update,
+// the caller sends the notifications
+// This function should not acquire an object lock (apiObjectLocks) as the caller has already acquired one.
+func storeUpdatedObjectLocked(orgID string, objectType string, objectID string, metaData common.MetaData,
+	data []byte) ([]common.NotificationInfo, common.SyncServiceError) {
+	if err := validateObject(orgID, objectType, objectID, &metaData, data); err != nil {
+		return nil, err
+	}
+
 	if metaData.OriginType == "" || metaData.OriginID == "" {
 		// Set the origin so the other side can respond
 		metaData.OriginType = common.Configuration.DestinationType
@@ -187,75 +300,112 @@ func UpdateObject(orgID string, objectType string, objectID string, metaData com
 
 	// Store the object in the storage module
 	status := common.NotReadyToSend
+	metaData.DataHash = ""
+	metaData.Encrypted = false
 	if data != nil || metaData.Link != "" || metaData.NoData || metaData.SourceDataURI != "" {
 		status = common.ReadyToSend
 	} else if metaData.MetaOnly {
 		reader, err := store.RetrieveObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if reader != nil {
 			status = common.ReadyToSend
 			store.CloseDataReader(reader)
 		}
+		// The data is unchanged, keep its hash and size
+		if existingMetaData, err := store.RetrieveObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); err == nil &&
+			existingMetaData != nil {
+			metaData.DataHash = existingMetaData.DataHash
+			metaData.OriginalSize = existingMetaData.OriginalSize
+			metaData.Encrypted = existingMetaData.Encrypted
+		}
 	}
 	if metaData.NoData {
 		data = nil
 		metaData.Link = ""
 		metaData.SourceDataURI = ""
 	} else if data != nil {
+		metaData.OriginalSize = int64(len(data))
+		if metaData.DestinationDataURI == "" {
+			var err common.SyncServiceError
+			if data, metaData.Encrypted, err = encryption.EncryptData(metaData.DestOrgID, metaData.ObjectType, data); err != nil {
+				return nil, err
+			}
+		}
 		metaData.ObjectSize = int64(len(data))
+		hash := sha256.Sum256(data)
+		metaData.DataHash = hex.EncodeToString(hash[:])
 	}
 	metaData.ChunkSize = common.Configuration.MaxDataChunkSize
 
+	var dataSize int64
+	if data != nil || metaData.SourceDataURI != "" {
+		dataSize = metaData.ObjectSize
+	}
 	lockIndex := common.HashStrings(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
-	apiObjectLocks.Lock(lockIndex)
-	defer apiObjectLocks.Unlock(lockIndex)
-
 	common.ObjectLocks.Lock(lockIndex)
-	deletedDestinations, err := store.StoreObject(metaData, data, status)
+	release, err := checkObjectQuota(metaData, dataSize, metaData.MetaOnly)
 	if err != nil {
 		common.ObjectLocks.Unlock(lockIndex)
-		return err
+		return nil, err
+	}
+	if err := storeObjectVersion(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); err != nil {
+		release()
+		common.ObjectLocks.Unlock(lockIndex)
+		return nil, err
+	}
+
+	notificationsInfo, err := storeObjectAndPrepareNotifications(metaData, data, status)
+	release()
+	common.ObjectLocks.Unlock(lockIndex)
+	return notificationsInfo, err
+}
+
+// storeObjectAndPrepareNotifications stores the object and prepares the notifications of its update,
+// the caller sends the notifications
+// This function should not acquire an object lock (common.ObjectLocks) as the caller has already acquired one.
+func storeObjectAndPrepareNotifications(metaData common.MetaData, data []byte, status string) ([]common.NotificationInfo,
+	common.SyncServiceError) {
+	deletedDestinations, err := store.StoreObject(metaData, data, status)
+	if err != nil {
+		return nil, err
+	}
+
+	if metaData.DestinationPolicy != nil && communications.IsPolicyEvaluated() {
+		policyDeletedDestinations, err := communications.UpdatePolicyDestinations(metaData)
+		if err != nil {
+			return nil, err
+		}
+		deletedDestinations = append(deletedDestinations, policyDeletedDestinations...)
 	}
 
 	store.DeleteNotificationRecords(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, "", "")
 
 	if status == common.NotReadyToSend || metaData.Inactive {
-		common.ObjectLocks.Unlock(lockIndex)
-		return nil
+		return nil, nil
 	}
 
 	// StoreObject increments the instance id, we need to fetch the updated meta data
 	updatedMetaData, err := store.RetrieveObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
 	if err != nil {
-		common.ObjectLocks.Unlock(lockIndex)
-		return err
+		return nil, err
 	}
 
 	var deleteNotificationsInfo []common.NotificationInfo
 	if len(deletedDestinations) != 0 {
 		deleteNotificationsInfo, err = communications.PrepareNotificationsForDestinations(*updatedMetaData, deletedDestinations, common.Delete)
 		if err != nil {
-			common.ObjectLocks.Unlock(lockIndex)
-			return err
+			return nil, err
 		}
 	}
 
 	updateNotificationsInfo, err := communications.PrepareObjectNotifications(*updatedMetaData)
-	common.ObjectLocks.Unlock(lockIndex)
-
 	if err != nil {
-		return err
-	}
-
-	if deleteNotificationsInfo != nil {
-		if err := communications.SendNotifications(deleteNotificationsInfo); err != nil {
-			return err
-		}
+		return nil, err
 	}
 
-	return communications.SendNotifications(updateNotificationsInfo)
+	return append(deleteNotificationsInfo, updateNotificationsInfo...), nil
 }
 
 // GetObjectStatus sends the status of the object to the app
@@ -276,13 +426,14 @@ func GetObjectStatus(orgID string, objectType string, objectID string) (string,
 
 // ListUpdatedObjects provides a list of edge updated objects
 // Call the storage module to get the list of edge updated objects and send it to the app
-func ListUpdatedObjects(orgID string, objectType string, received bool) ([]common.MetaData, common.SyncServiceError) {
+// The objects are selected by the filter, which also specifies the page of the list to return
+func ListUpdatedObjects(orgID string, objectType string, received bool, filter common.ObjectsFilter) ([]common.MetaData, common.SyncServiceError) {
 	apiLock.RLock()
 	defer apiLock.RUnlock()
 
 	common.HealthStatus.ClientRequestReceived()
 
-	updatedObjects, err := store.RetrieveUpdatedObjects(orgID, objectType, received)
+	updatedObjects, err := store.RetrieveUpdatedObjects(orgID, objectType, received, filter)
 
 	if trace.IsLogging(logger.DEBUG) {
 		trace.Debug("In ListUpdatedObjects. Get %s %s. returned %d objects\n", orgID, objectType, len(updatedObjects))
@@ -292,13 +443,14 @@ func ListUpdatedObjects(orgID string, objectType string, received bool) ([]commo
 }
 
 // ListObjectsWithDestinationPolicy provides a list of objects that have a DestinationPolicy
-func ListObjectsWithDestinationPolicy(orgID string, received bool) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
+// The objects are selected by the filter, which also specifies the page of the list to return
+func ListObjectsWithDestinationPolicy(orgID string, received bool, filter common.ObjectsFilter) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
 	apiLock.RLock()
 	defer apiLock.RUnlock()
 
 	common.HealthStatus.ClientRequestReceived()
 
-	objects, err := store.RetrieveObjectsWithDestinationPolicy(orgID, received)
+	objects, err := store.RetrieveObjectsWithDestinationPolicy(orgID, received, filter)
 
 	if trace.IsLogging(logger.DEBUG) {
 		trace.Debug("In ListObjectsWithDestinationPolicy. Get %s. Returned %d objects\n", orgID, len(objects))
@@ -343,13 +495,14 @@ func ListObjectsWithDestinationPolicyUpdatedSince(orgID string, since int64) ([]
 }
 
 // ListAllObjects provides a list of all objects with the specified type
-func ListAllObjects(orgID string, objectType string) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
+// The objects are selected by the filter, which also specifies the page of the list to return
+func ListAllObjects(orgID string, objectType string, filter common.ObjectsFilter) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
 	apiLock.RLock()
 	defer apiLock.RUnlock()
 
 	common.HealthStatus.ClientRequestReceived()
 
-	objects, err := store.RetrieveAllObjects(orgID, objectType)
+	objects, err := store.RetrieveAllObjects(orgID, objectType, filter)
 
 	if trace.IsLogging(logger.DEBUG) {
 		trace.Debug("In ListAllObjects. Get %s:%s. Returned %d objects\n", orgID, objectType, len(objects))
@@ -400,7 +553,19 @@ func GetObjectData(orgID string, objectType string, objectID string) (io.Reader,
 	if metaData.SourceDataURI != "" && status == common.ReadyToSend {
 		return dataURI.GetData(metaData.SourceDataURI)
 	}
-	return store.RetrieveObjectData(orgID, objectType, objectID)
+
+	dataReader, err := store.RetrieveObjectData(orgID, objectType, objectID)
+	if err != nil || dataReader == nil {
+		return nil, err
+	}
+	// The returned reader closes the data reader of the storage when it is passed to CloseDataReader
+	decryptedReader, err := encryption.Decrypt(orgID, metaData.Encrypted, dataReader,
+		func() error { return store.CloseDataReader(dataReader) })
+	if err != nil {
+		store.CloseDataReader(dataReader)
+		return nil, err
+	}
+	return decryptedReader, nil
 }
 
 // PutObjectData stores an object's data
@@ -438,7 +603,46 @@ func PutObjectData(orgID string, objectType string, objectID string, dataReader
 		return false, &common.InvalidRequest{Message: "Can't update data, the NoData flag is set to true"}
 	}
 
-	if exists, err := store.StoreObjectData(orgID, objectType, objectID, dataReader); err != nil || !exists {
+	maxSize, release, err := maxObjectDataSize(orgID, objectType, metaData.ObjectSize)
+	if err != nil {
+		common.ObjectLocks.Unlock(lockIndex)
+		return false, err
+	}
+
+	if err := storeObjectVersion(orgID, objectType, objectID); err != nil {
+		release()
+		common.ObjectLocks.Unlock(lockIndex)
+		return false, err
+	}
+
+	originalReader := &countingReader{reader: dataReader}
+	dataReader = originalReader
+	encrypted := false
+	if metaData.DestinationDataURI == "" {
+		if dataReader, encrypted, err = encryption.Encrypt(orgID, objectType, dataReader); err != nil {
+			release()
+			common.ObjectLocks.Unlock(lockIndex)
+			return false, err
+		}
+	}
+	var limitedReader *quotaReader
+	if maxSize >= 0 {
+		limitedReader = &quotaReader{reader: dataReader, remaining: maxSize}
+		dataReader = limitedReader
+	}
+
+	hash := sha256.New()
+	exists, err := store.StoreObjectData(orgID, objectType, objectID, io.TeeReader(dataReader, hash))
+	release()
+	if err != nil || !exists {
+		common.ObjectLocks.Unlock(lockIndex)
+		if limitedReader != nil && limitedReader.exceeded {
+			return false, &common.InvalidRequest{Message: fmt.Sprintf("The object's data exceeds the limits of organization %s", orgID)}
+		}
+		return false, err
+	}
+	dataHash := hex.EncodeToString(hash.Sum(nil))
+	if err = store.UpdateObjectDataInfo(orgID, objectType, objectID, dataHash, originalReader.count, encrypted); err != nil {
 		common.ObjectLocks.Unlock(lockIndex)
 		return false, err
 	}
@@ -473,10 +677,29 @@ func PutObjectData(orgID string, objectType string, objectID string, dataReader
 	return true, communications.SendNotifications(notificationsInfo)
 }
 
+// countingReader counts the bytes of the object's data provided by the application
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (reader *countingReader) Read(p []byte) (int, error) {
+	n, err := reader.reader.Read(p)
+	reader.count += int64(n)
+	return n, err
+}
+
 // ObjectConsumed is used when an app indicates that it consumed the object
 // Send "consumed" notification to the object's origin
 // Call the storage module to mark the object as consumed
 func ObjectConsumed(orgID string, objectType string, objectID string) common.SyncServiceError {
+	span := tracing.StartSpan("ObjectConsumed", orgID, objectType, objectID, nil)
+	err := objectConsumed(orgID, objectType, objectID)
+	span.End(err)
+	return err
+}
+
+func objectConsumed(orgID string, objectType string, objectID string) common.SyncServiceError {
 	if trace.IsLogging(logger.DEBUG) {
 		trace.Debug("In ObjectConsumed. Consumed %s %s\n", objectType, objectID)
 	}
@@ -683,51 +906,70 @@ func DeleteObject(orgID string, objectType string, objectID string) common.SyncS
 
 	common.HealthStatus.ClientRequestReceived()
 
+	notificationsInfo, err := deleteObject(orgID, objectType, objectID)
+	if err != nil {
+		return err
+	}
+	return communications.SendNotifications(notificationsInfo)
+}
+
+// deleteObject deletes the object and prepares the notifications of its deletion, the caller sends the notifications
+func deleteObject(orgID string, objectType string, objectID string) ([]common.NotificationInfo, common.SyncServiceError) {
 	lockIndex := common.HashStrings(orgID, objectType, objectID)
 	apiObjectLocks.Lock(lockIndex)
 	defer apiObjectLocks.Unlock(lockIndex)
 
+	return deleteObjectLocked(orgID, objectType, objectID)
+}
+
+// deleteObjectLocked deletes the object and prepares the notifications of its deletion, the caller sends the notifications
+// This function should not acquire an object lock (apiObjectLocks) as the caller has already acquired one.
+func deleteObjectLocked(orgID string, objectType string, objectID string) ([]common.NotificationInfo, common.SyncServiceError) {
+	lockIndex := common.HashStrings(orgID, objectType, objectID)
 	common.ObjectLocks.Lock(lockIndex)
 
 	metaData, status, err := store.RetrieveObjectAndStatus(orgID, objectType, objectID)
 	if err != nil {
 		common.ObjectLocks.Unlock(lockIndex)
-		return err
+		return nil, err
 	}
 	if metaData == nil {
 		common.ObjectLocks.Unlock(lockIndex)
-		return &common.InvalidRequest{Message: "Object not found"}
+		return nil, &common.InvalidRequest{Message: "Object not found"}
 	}
 	if status != common.NotReadyToSend && status != common.ReadyToSend {
 		// This node is not the originator of the object being deleted.
 		// ESS is not allowed to remove such objects
 		if common.Configuration.NodeType == common.ESS {
 			common.ObjectLocks.Unlock(lockIndex)
-			return &common.InvalidRequest{Message: "Can't delete object on the receiving side for ESS"}
+			return nil, &common.InvalidRequest{Message: "Can't delete object on the receiving side for ESS"}
 		}
 		// CSS removes them without notifying the other side
 		err = storage.DeleteStoredObject(store, *metaData)
 		common.ObjectLocks.Unlock(lockIndex)
-		return err
+		return nil, err
 	}
 
 	if err := storage.DeleteStoredData(store, *metaData); err != nil {
 		common.ObjectLocks.Unlock(lockIndex)
-		return err
+		return nil, err
 	}
 
 	if err := store.MarkObjectDeleted(orgID, objectType, objectID); err != nil {
 		common.ObjectLocks.Unlock(lockIndex)
-		return err
+		return nil, err
+	}
+
+	// A deleted object can't be rolled back to its previous versions
+	if err := store.DeleteObjectVersions(orgID, objectType, objectID); err != nil {
+		common.ObjectLocks.Unlock(lockIndex)
+		return nil, err
 	}
 
 	// Notify the receivers of the object that it was deleted
 	notificationsInfo, err := communications.PrepareDeleteNotifications(*metaData)
 	common.ObjectLocks.Unlock(lockIndex)
-	if err != nil {
-		return err
-	}
-	return communications.SendNotifications(notificationsInfo)
+	return notificationsInfo, err
 }
 
 // ActivateObject activates an inactive object
@@ -739,46 +981,116 @@ func ActivateObject(orgID string, objectType string, objectID string) common.Syn
 
 	common.HealthStatus.ClientRequestReceived()
 
+	notificationsInfo, err := activateObject(orgID, objectType, objectID)
+	if err != nil {
+		return err
+	}
+	return communications.SendNotifications(notificationsInfo)
+}
+
+// activateObject activates the object and prepares the notifications of its update, the caller sends the notifications
+func activateObject(orgID string, objectType string, objectID string) ([]common.NotificationInfo, common.SyncServiceError) {
 	lockIndex := common.HashStrings(orgID, objectType, objectID)
 	apiObjectLocks.Lock(lockIndex)
 	defer apiObjectLocks.Unlock(lockIndex)
 
+	return activateObjectLocked(orgID, objectType, objectID)
+}
+
+// activateObjectLocked activates the object and prepares the notifications of its update, the caller sends the notifications
+// This function should not acquire an object lock (apiObjectLocks) as the caller has already acquired one.
+func activateObjectLocked(orgID string, objectType string, objectID string) ([]common.NotificationInfo, common.SyncServiceError) {
+	lockIndex := common.HashStrings(orgID, objectType, objectID)
 	common.ObjectLocks.Lock(lockIndex)
 
 	metaData, status, err := store.RetrieveObjectAndStatus(orgID, objectType, objectID)
 	if err != nil {
 		common.ObjectLocks.Unlock(lockIndex)
-		return err
+		return nil, err
 	}
 	if metaData == nil {
 		common.ObjectLocks.Unlock(lockIndex)
-		return &common.InvalidRequest{Message: "Object not found"}
+		return nil, &common.InvalidRequest{Message: "Object not found"}
 	}
 	if status != common.NotReadyToSend && status != common.ReadyToSend {
 		common.ObjectLocks.Unlock(lockIndex)
-		return &common.InvalidRequest{Message: "Can't activate object on the receiving side"}
+		return nil, &common.InvalidRequest{Message: "Can't activate object on the receiving side"}
 	}
 
 	if err := store.ActivateObject(orgID, objectType, objectID); err != nil {
 		common.ObjectLocks.Unlock(lockIndex)
-		return err
+		return nil, err
 	}
 
+	var notificationsInfo []common.NotificationInfo
 	if status == common.ReadyToSend {
-		notificationsInfo, err := communications.PrepareObjectNotifications(*metaData)
-		common.ObjectLocks.Unlock(lockIndex)
+		notificationsInfo, err = communications.PrepareObjectNotifications(*metaData)
+	}
+	common.ObjectLocks.Unlock(lockIndex)
+	return notificationsInfo, err
+}
+
+// DeleteObjects deletes the objects of the object type whose labels satisfy the selector
+// Returns the IDs of the deleted objects
+func DeleteObjects(orgID string, objectType string, selector common.LabelSelector) ([]string, common.SyncServiceError) {
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In DeleteObjects. Delete %s %s\n", objectType, selector)
+	}
+	deleted := false
+	return applyToLabeledObjects(orgID, objectType, selector, common.ObjectsFilter{Deleted: &deleted}, deleteObject)
+}
+
+// ActivateObjects activates the inactive objects of the object type whose labels satisfy the selector
+// Returns the IDs of the activated objects
+func ActivateObjects(orgID string, objectType string, selector common.LabelSelector) ([]string, common.SyncServiceError) {
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In ActivateObjects. Activate %s %s\n", objectType, selector)
+	}
+	inactive := true
+	return applyToLabeledObjects(orgID, objectType, selector, common.ObjectsFilter{Inactive: &inactive}, activateObject)
+}
+
+// applyToLabeledObjects applies an operation to the objects of the object type that are selected by the filter
+// and whose labels satisfy the selector. The objects the operation can't be applied to, e.g., the objects
+// on the receiving side, are skipped. The notifications of all the objects are sent after the operation
+// is applied to them.
+func applyToLabeledObjects(orgID string, objectType string, selector common.LabelSelector, filter common.ObjectsFilter,
+	operation func(string, string, string) ([]common.NotificationInfo, common.SyncServiceError)) ([]string, common.SyncServiceError) {
+	common.HealthStatus.ClientRequestReceived()
+
+	if len(selector) == 0 {
+		return nil, &common.InvalidRequest{Message: "A label selector must be specified"}
+	}
+	filter.Labels = selector
+	objects, err := store.RetrieveAllObjects(orgID, objectType, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(objects))
+	notificationsInfo := make([]common.NotificationInfo, 0)
+	var result common.SyncServiceError
+	for _, object := range objects {
+		objectNotificationsInfo, err := operation(orgID, objectType, object.ObjectID)
 		if err != nil {
-			return err
+			if common.IsInvalidRequest(err) {
+				continue
+			}
+			result = err
+			break
 		}
-		return communications.SendNotifications(notificationsInfo)
+		ids = append(ids, object.ObjectID)
+		notificationsInfo = append(notificationsInfo, objectNotificationsInfo...)
 	}
 
-	common.ObjectLocks.Unlock(lockIndex)
-	return nil
+	if err := communications.SendBatchNotifications(notificationsInfo); err != nil && result == nil {
+		result = err
+	}
+	return ids, result
 }
 
-// ListDestinations lists all destinations
-func ListDestinations(orgID string) ([]common.Destination, common.SyncServiceError) {
+// ListDestinations lists all destinations whose properties satisfy the selector
+func ListDestinations(orgID string, selector common.LabelSelector) ([]common.Destination, common.SyncServiceError) {
 	if trace.IsLogging(logger.DEBUG) {
 		trace.Debug("In ListDestinations.\n")
 	}
@@ -788,7 +1100,61 @@ func ListDestinations(orgID string) ([]common.Destination, common.SyncServiceErr
 	apiLock.RLock()
 	defer apiLock.RUnlock()
 
-	return store.RetrieveDestinations(orgID, "")
+	dests, err := store.RetrieveDestinations(orgID, "")
+	if err != nil || len(selector) == 0 {
+		return dests, err
+	}
+	result := make([]common.Destination, 0)
+	for _, dest := range dests {
+		if selector.Matches(dest.Properties) {
+			result = append(result, dest)
+		}
+	}
+	return result, nil
+}
+
+// UpdateDestinationProperties replaces the properties of a destination
+// Returns false if the destination doesn't exist
+func UpdateDestinationProperties(orgID string, destType string, destID string, properties map[string]string) (bool, common.SyncServiceError) {
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In UpdateDestinationProperties. Update the properties of %s %s\n", destType, destID)
+	}
+
+	common.HealthStatus.ClientRequestReceived()
+
+	if common.Configuration.NodeType != common.CSS {
+		return false, &common.InvalidRequest{Message: "Destination properties can only be updated on a CSS"}
+	}
+	if err := common.ValidateLabels(properties); err != nil {
+		return false, &common.InvalidRequest{Message: "Invalid destination properties. " + err.Error()}
+	}
+
+	apiLock.RLock()
+	defer apiLock.RUnlock()
+
+	exists, err := store.DestinationExists(orgID, destType, destID)
+	if err != nil || !exists {
+		return false, err
+	}
+	dest, err := store.RetrieveDestination(orgID, destType, destID)
+	if err != nil || dest == nil {
+		return false, err
+	}
+	if len(properties) == 0 {
+		properties = nil
+	}
+	stored := *dest
+	dest.Properties = properties
+	if err := store.StoreDestination(*dest); err != nil {
+		return true, err
+	}
+
+	if log.IsLogging(logger.INFO) {
+		log.Info("Updated the properties of the destination %s %s %s", orgID, destType, destID)
+	}
+
+	// The properties are matched with the destination policies of objects
+	return true, communications.EvaluateChangedDestinationPolicy(&stored, *dest)
 }
 
 // ResendObjects asks the other side to resend all the relevant objects
@@ -858,6 +1224,10 @@ func updateOrganization(orgID string, org common.Organization) common.SyncServic
 		return &common.InvalidRequest{Message: fmt.Sprintf("Org ID (%s) in the URL doesn't match the org-id (%s) in the payload", orgID, org.OrgID)}
 	}
 
+	if org.MaxObjects < 0 || org.MaxDataSize < 0 || org.MaxObjectSize < 0 {
+		return &common.InvalidRequest{Message: "The limits of the organization can't be negative"}
+	}
+
 	apiLock.Lock()
 	defer apiLock.Unlock()
 
@@ -947,33 +1317,31 @@ func UpdateObjectDestinations(orgID string, objectType string, objectID string,
 		return &common.InvalidRequest{Message: "ESS doesn't support destinations update"}
 	}
 
+	unlockGroups := lockDestinationGroups(destinationsList)
 	lockIndex := common.HashStrings(orgID, objectType, objectID)
 	apiObjectLocks.Lock(lockIndex)
 
 	metaData, status, deletedDestinations, addedDestinations, err := store.UpdateObjectDestinations(orgID, objectType, objectID, destinationsList)
 	if err != nil {
 		apiObjectLocks.Unlock(lockIndex)
+		unlockGroups()
 		return err
 	}
 
-	var deleteNotificationsInfo, updateNotificationsInfo []common.NotificationInfo
-	if len(deletedDestinations) != 0 {
-		deleteNotificationsInfo, err = communications.PrepareNotificationsForDestinations(*metaData, deletedDestinations, common.Delete)
-		if err != nil {
-			apiObjectLocks.Unlock(lockIndex)
-			return err
-		}
-	}
-
-	if len(addedDestinations) != 0 && status == common.ReadyToSend {
-		updateNotificationsInfo, err = communications.PrepareNotificationsForDestinations(*metaData, addedDestinations, common.Update)
-		if err != nil {
-			apiObjectLocks.Unlock(lockIndex)
-			return err
-		}
+	deleteNotificationsInfo, updateNotificationsInfo, err := communications.PrepareObjectDestinationsNotifications(*metaData, status,
+		deletedDestinations, addedDestinations)
+	apiObjectLocks.Unlock(lockIndex)
+	unlockGroups()
+	if err != nil {
+		return err
 	}
+	return sendObjectDestinationsNotifications(deleteNotificationsInfo, updateNotificationsInfo)
+}
 
-	apiObjectLocks.Unlock(lockIndex)
+// sendObjectDestinationsNotifications sends the notifications of the destinations that were removed from an object,
+// and then the notifications of the destinations that were added to it
+func sendObjectDestinationsNotifications(deleteNotificationsInfo []common.NotificationInfo,
+	updateNotificationsInfo []common.NotificationInfo) common.SyncServiceError {
 	if len(deleteNotificationsInfo) != 0 {
 		if err := communications.SendNotifications(deleteNotificationsInfo); err != nil {
 			return err
@@ -987,17 +1355,389 @@ func UpdateObjectDestinations(orgID string, objectType string, objectID string,
 	return nil
 }
 
+// ListDestinationGroups lists the destination groups of an organization
+func ListDestinationGroups(orgID string) ([]common.DestinationGroup, common.SyncServiceError) {
+	common.HealthStatus.ClientRequestReceived()
+
+	if common.Configuration.NodeType != common.CSS {
+		return nil, &common.InvalidRequest{Message: "ESS doesn't support destination groups"}
+	}
+
+	apiLock.RLock()
+	defer apiLock.RUnlock()
+
+	return store.RetrieveDestinationGroups(orgID)
+}
+
+// GetDestinationGroup gets a destination group, or returns nil if the group doesn't exist
+func GetDestinationGroup(orgID string, name string) (*common.DestinationGroup, common.SyncServiceError) {
+	common.HealthStatus.ClientRequestReceived()
+
+	if common.Configuration.NodeType != common.CSS {
+		return nil, &common.InvalidRequest{Message: "ESS doesn't support destination groups"}
+	}
+
+	apiLock.RLock()
+	defer apiLock.RUnlock()
+
+	return store.RetrieveDestinationGroup(orgID, name)
+}
+
+// UpdateDestinationGroup creates a destination group or replaces its destinations.
+// The objects that target the group are added to the destinations that were added to the group,
+// and removed from the destinations that were removed from it.
+func UpdateDestinationGroup(orgID string, name string, destinations []string) common.SyncServiceError {
+	common.HealthStatus.ClientRequestReceived()
+
+	if common.Configuration.NodeType != common.CSS {
+		return &common.InvalidRequest{Message: "ESS doesn't support destination groups"}
+	}
+
+	if destinations == nil {
+		destinations = make([]string, 0)
+	}
+	group := common.DestinationGroup{OrgID: orgID, Name: name, Destinations: destinations, LastUpdate: time.Now().UTC()}
+	if err := group.Validate(); err != nil {
+		return err
+	}
+
+	apiLock.RLock()
+	destinationGroupsLock.Lock()
+	deleteNotificationsInfo, updateNotificationsInfo, err := storeDestinationGroup(group)
+	destinationGroupsLock.Unlock()
+	apiLock.RUnlock()
+
+	// The notifications are sent after the locks are released, the notifications that fail to be sent are resent later
+	if sendErr := sendObjectDestinationsNotifications(deleteNotificationsInfo, updateNotificationsInfo); sendErr != nil &&
+		log.IsLogging(logger.ERROR) {
+		log.Error("Failed to send the notifications of the update of the destination group %s:%s. Error: %s\n", group.OrgID,
+			group.Name, sendErr)
+	}
+	return err
+}
+
+// storeDestinationGroup stores a destination group and updates the destinations of the objects that target the group,
+// and prepares the notifications of the objects, the caller sends the notifications.
+// The update of the other objects continues if the update of an object fails, the returned error reports the objects that failed.
+// This function should not acquire the destination groups lock (destinationGroupsLock) as the caller has already acquired it.
+func storeDestinationGroup(group common.DestinationGroup) ([]common.NotificationInfo, []common.NotificationInfo,
+	common.SyncServiceError) {
+	if err := store.StoreDestinationGroup(group); err != nil {
+		return nil, nil, err
+	}
+	if log.IsLogging(logger.INFO) {
+		log.Info("Updated the destination group %s:%s with %d destinations", group.OrgID, group.Name, len(group.Destinations))
+	}
+
+	objects, err := store.RetrieveObjectsWithDestinationGroup(group.OrgID, group.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	deleteNotificationsInfo := make([]common.NotificationInfo, 0)
+	updateNotificationsInfo := make([]common.NotificationInfo, 0)
+	failures := make([]string, 0)
+	for _, object := range objects {
+		objectDeleteNotificationsInfo, objectUpdateNotificationsInfo, err := updateDestinationGroupObject(object, group.Name)
+		if err != nil {
+			if log.IsLogging(logger.ERROR) {
+				log.Error("Failed to update the destinations of %s:%s:%s after the destination group %s was updated. Error: %s\n",
+					object.DestOrgID, object.ObjectType, object.ObjectID, group.Name, err)
+			}
+			failures = append(failures, fmt.Sprintf("%s:%s (%s)", object.ObjectType, object.ObjectID, err))
+			continue
+		}
+		deleteNotificationsInfo = append(deleteNotificationsInfo, objectDeleteNotificationsInfo...)
+		updateNotificationsInfo = append(updateNotificationsInfo, objectUpdateNotificationsInfo...)
+	}
+	if len(failures) != 0 {
+		return deleteNotificationsInfo, updateNotificationsInfo, &common.InternalError{Message: fmt.Sprintf(
+			"The destination group %s was updated, but the destinations of %d objects failed to be updated: %s", group.Name,
+			len(failures), strings.Join(failures, ", "))}
+	}
+	return deleteNotificationsInfo, updateNotificationsInfo, nil
+}
+
+// updateDestinationGroupObject updates the destinations of an object that targets a destination group
+// after the destinations of the group changed, and prepares the notifications of the removed and the added destinations,
+// the caller sends the notifications
+func updateDestinationGroupObject(object common.MetaData, name string) ([]common.NotificationInfo, []common.NotificationInfo,
+	common.SyncServiceError) {
+	lockIndex := common.HashStrings(object.DestOrgID, object.ObjectType, object.ObjectID)
+	apiObjectLocks.Lock(lockIndex)
+	defer apiObjectLocks.Unlock(lockIndex)
+
+	// The object may have been updated since it was retrieved
+	metaData, status, err := store.RetrieveObjectAndStatus(object.DestOrgID, object.ObjectType, object.ObjectID)
+	if err != nil || metaData == nil || metaData.Deleted || metaData.DestinationPolicy != nil ||
+		(status != common.ReadyToSend && status != common.NotReadyToSend) ||
+		!common.TargetsDestinationGroup(metaData.DestinationsList, name) {
+		return nil, nil, err
+	}
+
+	updatedMetaData, status, deletedDestinations, addedDestinations, err := store.UpdateObjectDestinations(metaData.DestOrgID,
+		metaData.ObjectType, metaData.ObjectID, metaData.DestinationsList)
+	if err != nil || updatedMetaData == nil {
+		return nil, nil, err
+	}
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("The destination group %s removed %d destinations and added %d destinations to %s:%s:%s\n", name,
+			len(deletedDestinations), len(addedDestinations), metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	}
+
+	return communications.PrepareObjectDestinationsNotifications(*updatedMetaData, status, deletedDestinations, addedDestinations)
+}
+
+// DeleteDestinationGroup deletes a destination group. A group can't be deleted while objects target it.
+// Returns false if the group doesn't exist.
+func DeleteDestinationGroup(orgID string, name string) (bool, common.SyncServiceError) {
+	common.HealthStatus.ClientRequestReceived()
+
+	if common.Configuration.NodeType != common.CSS {
+		return false, &common.InvalidRequest{Message: "ESS doesn't support destination groups"}
+	}
+
+	apiLock.RLock()
+	defer apiLock.RUnlock()
+
+	destinationGroupsLock.Lock()
+	defer destinationGroupsLock.Unlock()
+
+	group, err := store.RetrieveDestinationGroup(orgID, name)
+	if err != nil || group == nil {
+		return false, err
+	}
+	objects, err := store.RetrieveObjectsWithDestinationGroup(orgID, name)
+	if err != nil {
+		return false, err
+	}
+	for _, object := range objects {
+		// Deleted objects are kept until their destinations are notified, and no longer depend on the group
+		if !object.Deleted {
+			return false, &common.InvalidRequest{Message: fmt.Sprintf("The destination group %s is the target of %s:%s",
+				name, object.ObjectType, object.ObjectID)}
+		}
+	}
+	if err := store.DeleteDestinationGroup(orgID, name); err != nil {
+		return false, err
+	}
+	if log.IsLogging(logger.INFO) {
+		log.Info("Deleted the destination group %s:%s", orgID, name)
+	}
+	return true, nil
+}
+
+// GetObjectRollout returns the state of the rollout of an object with the progress of its waves,
+// or nil if the rollout of the object's current instance hasn't started
+func GetObjectRollout(orgID string, objectType string, objectID string) (*common.RolloutReport, common.SyncServiceError) {
+	common.HealthStatus.ClientRequestReceived()
+
+	if common.Configuration.NodeType != common.CSS {
+		return nil, &common.InvalidRequest{Message: "ESS doesn't support rollouts"}
+	}
+
+	lockIndex := common.HashStrings(orgID, objectType, objectID)
+	apiObjectLocks.RLock(lockIndex)
+	defer apiObjectLocks.RUnlock(lockIndex)
+
+	rollout, err := retrieveObjectRollout(orgID, objectType, objectID)
+	if err != nil || rollout == nil {
+		return nil, err
+	}
+	destinations, err := store.GetObjectDestinationsList(orgID, objectType, objectID)
+	if err != nil {
+		return nil, err
+	}
+	return &common.RolloutReport{RolloutStatus: *rollout, TotalDestinations: len(destinations), Waves: rollout.Progress(destinations)}, nil
+}
+
+// UpdateObjectRollout pauses or resumes the rollout of an object. The errors reported by the destinations of the waves
+// that were started before the rollout was resumed don't pause it again.
+func UpdateObjectRollout(orgID string, objectType string, objectID string, paused bool) common.SyncServiceError {
+	common.HealthStatus.ClientRequestReceived()
+
+	if common.Configuration.NodeType != common.CSS {
+		return &common.InvalidRequest{Message: "ESS doesn't support rollouts"}
+	}
+
+	lockIndex := common.HashStrings(orgID, objectType, objectID)
+	apiObjectLocks.Lock(lockIndex)
+	defer apiObjectLocks.Unlock(lockIndex)
+	common.ObjectLocks.Lock(lockIndex)
+	defer common.ObjectLocks.Unlock(lockIndex)
+
+	rollout, err := retrieveObjectRollout(orgID, objectType, objectID)
+	if err != nil {
+		return err
+	}
+	if rollout == nil {
+		return &common.InvalidRequest{Message: "The object has no rollout in progress"}
+	}
+	if rollout.Status == common.RolloutCompleted {
+		return &common.InvalidRequest{Message: "The rollout of the object is completed"}
+	}
+
+	if paused {
+		rollout.Status = common.RolloutPaused
+		rollout.Message = "Paused by the user"
+	} else if rollout.Status == common.RolloutPaused {
+		rollout.Status = common.RolloutInProgress
+		rollout.Message = ""
+		rollout.ResumedWave = rollout.Wave
+	}
+	return store.StoreRollout(*rollout)
+}
+
+// retrieveObjectRollout returns the state of the rollout of the object's current instance, or nil if it hasn't started
+func retrieveObjectRollout(orgID string, objectType string, objectID string) (*common.RolloutStatus, common.SyncServiceError) {
+	metaData, err := store.RetrieveObject(orgID, objectType, objectID)
+	if err != nil || metaData == nil || metaData.Rollout == nil {
+		return nil, err
+	}
+	rollout, err := store.RetrieveRollout(orgID, objectType, objectID)
+	if err != nil || rollout == nil || rollout.InstanceID != metaData.InstanceID {
+		return nil, err
+	}
+	return rollout, nil
+}
+
+// GetObjectVersions returns the previous versions of an object that are kept in its version history, from the newest to the oldest
+// Returns nil if the object doesn't exist
+func GetObjectVersions(orgID string, objectType string, objectID string) ([]common.ObjectVersion, common.SyncServiceError) {
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In GetObjectVersions. Get versions of %s %s\n", objectType, objectID)
+	}
+
+	common.HealthStatus.ClientRequestReceived()
+
+	lockIndex := common.HashStrings(orgID, objectType, objectID)
+	apiObjectLocks.RLock(lockIndex)
+	defer apiObjectLocks.RUnlock(lockIndex)
+
+	metaData, err := store.RetrieveObject(orgID, objectType, objectID)
+	if err != nil || metaData == nil || metaData.Deleted {
+		return nil, err
+	}
+	return store.RetrieveObjectVersions(orgID, objectType, objectID)
+}
+
+// RollbackObject replaces an object with a previous version from its version history.
+// The version is published as a new instance of the object to all of the object's destinations,
+// and the replaced version is kept in the version history.
+// Returns false if the object or the version don't exist
+func RollbackObject(orgID string, objectType string, objectID string, version int64) (bool, common.SyncServiceError) {
+	span := tracing.StartDeliverySpan("RollbackObject", orgID, objectType, objectID, nil)
+	found, err := rollbackObject(orgID, objectType, objectID, version)
+	span.End(err)
+	return found, err
+}
+
+func rollbackObject(orgID string, objectType string, objectID string, version int64) (bool, common.SyncServiceError) {
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In RollbackObject. Roll back %s %s to version %d\n", objectType, objectID, version)
+	}
+
+	common.HealthStatus.ClientRequestReceived()
+
+	metaData, data, err := retrieveObjectVersion(orgID, objectType, objectID, version)
+	if err != nil || metaData == nil {
+		return false, err
+	}
+	notificationsInfo, err := storeUpdatedObject(orgID, objectType, objectID, *metaData, data)
+	if err != nil {
+		return true, err
+	}
+	return true, communications.SendNotifications(notificationsInfo)
+}
+
+// retrieveObjectVersion returns the meta data and the decrypted data of a version of an object, ready to be stored
+// as a new instance of the object, or nil if the object or the version don't exist
+func retrieveObjectVersion(orgID string, objectType string, objectID string, version int64) (*common.MetaData, []byte,
+	common.SyncServiceError) {
+	lockIndex := common.HashStrings(orgID, objectType, objectID)
+	apiObjectLocks.RLock(lockIndex)
+	defer apiObjectLocks.RUnlock(lockIndex)
+
+	current, status, err := store.RetrieveObjectAndStatus(orgID, objectType, objectID)
+	if err != nil || current == nil || current.Deleted {
+		return nil, nil, err
+	}
+	if status != common.NotReadyToSend && status != common.ReadyToSend {
+		return nil, nil, &common.InvalidRequest{Message: "Can't roll back an object on the receiving side"}
+	}
+
+	versions, err := store.RetrieveObjectVersions(orgID, objectType, objectID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var metaData *common.MetaData
+	for _, v := range versions {
+		if v.Version == version {
+			metaData = &v.MetaData
+			break
+		}
+	}
+	if metaData == nil {
+		return nil, nil, nil
+	}
+
+	// The version is sent to all the destinations as soon as it is stored
+	metaData.Rollout = nil
+	metaData.Inactive = false
+	metaData.ActivationTime = ""
+	metaData.MetaOnly = false
+
+	if metaData.NoData {
+		return metaData, nil, nil
+	}
+	storedData, err := store.RetrieveObjectVersionData(orgID, objectType, objectID, version)
+	if err != nil || storedData == nil {
+		return metaData, nil, err
+	}
+	dataReader, err := encryption.Decrypt(orgID, metaData.Encrypted, bytes.NewReader(storedData), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := ioutil.ReadAll(dataReader)
+	if err != nil {
+		return nil, nil, &common.IOError{Message: "Failed to read the data of the object's version. Error: " + err.Error()}
+	}
+	return metaData, data, nil
+}
+
+// storeObjectVersion keeps the current version of an object in its version history before the object is replaced,
+// if a version history is kept for objects of its type. Only versions that were ready to be sent are kept.
+// This function should not acquire an object lock (common.ObjectLocks) as the caller has already acquired one.
+func storeObjectVersion(orgID string, objectType string, objectID string) common.SyncServiceError {
+	maxVersions := common.GetMaxObjectVersions(objectType)
+	if maxVersions == 0 {
+		return nil
+	}
+	metaData, status, err := store.RetrieveObjectAndStatus(orgID, objectType, objectID)
+	if err != nil || metaData == nil || metaData.Deleted || status != common.ReadyToSend {
+		return err
+	}
+
+	// The storage copies the object's data to the version, or shares the data of a version with the same data
+	version := common.ObjectVersion{Version: metaData.InstanceID, Timestamp: time.Now().UTC(), MetaData: *metaData}
+	return store.StoreObjectVersion(version, maxVersions)
+}
+
 // DeleteWebhook deletes a WebHook
 func DeleteWebhook(orgID string, objectType string, url string) common.SyncServiceError {
 	common.HealthStatus.ClientRequestReceived()
 
 	apiLock.Lock()
 	defer apiLock.Unlock()
-	return store.DeleteWebhook(orgID, objectType, url)
+	if err := store.DeleteWebhook(orgID, objectType, url); err != nil {
+		return err
+	}
+	return communications.DeleteWebhookDeliveries(orgID, objectType, url)
 }
 
 // RegisterWebhook registers a WebHook
-func RegisterWebhook(orgID string, objectType string, webhook string) common.SyncServiceError {
+// If a secret is provided, the requests to the webhook are signed with it
+// The webhook is called for the provided events, or for updates of objects if no events are provided
+func RegisterWebhook(orgID string, objectType string, webhook string, secret string, events []string) common.SyncServiceError {
 	common.HealthStatus.ClientRequestReceived()
 
 	apiLock.Lock()
@@ -1010,7 +1750,60 @@ func RegisterWebhook(orgID string, objectType string, webhook string) common.Syn
 		return &common.InvalidRequest{Message: "Invalid destination data URI"}
 	}
 
-	return store.AddWebhook(orgID, objectType, webhook)
+	for _, event := range events {
+		valid := false
+		for _, e := range common.WebhookEvents {
+			if event == e {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return &common.InvalidRequest{Message: "Invalid webhook event " + event}
+		}
+	}
+
+	return store.AddWebhook(orgID, objectType, common.Webhook{URL: webhook, Secret: secret, Events: events})
+}
+
+// ListWebhookDeliveries lists the pending and failed deliveries to the webhooks of an organization
+// If a status is provided, only the deliveries with that status are listed
+func ListWebhookDeliveries(orgID string, status string) ([]common.WebhookDelivery, common.SyncServiceError) {
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In ListWebhookDeliveries.\n")
+	}
+
+	common.HealthStatus.ClientRequestReceived()
+
+	if status != "" && status != common.WebhookDeliveryPending && status != common.WebhookDeliveryFailed {
+		return nil, &common.InvalidRequest{Message: "Invalid status of webhook deliveries"}
+	}
+
+	apiLock.RLock()
+	defer apiLock.RUnlock()
+
+	deliveries, err := store.RetrieveWebhookDeliveries(orgID, status)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].CreationTime < deliveries[j].CreationTime })
+	return deliveries, nil
+}
+
+// ListAuditEntries lists the entries of the audit log of an organization with timestamps in the range [from, to)
+// An empty orgID lists the entries of all the organizations, and a zero from or to leaves the range open
+func ListAuditEntries(orgID string, from time.Time, to time.Time) ([]common.AuditEntry, common.SyncServiceError) {
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In ListAuditEntries.\n")
+	}
+
+	common.HealthStatus.ClientRequestReceived()
+
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return nil, &common.InvalidRequest{Message: "Invalid time range, from must be before to"}
+	}
+
+	return store.RetrieveAuditEntries(orgID, from, to)
 }
 
 // AddUsersToACL adds users to an ACL.
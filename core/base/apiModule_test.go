@@ -2,13 +2,20 @@ package base
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io/ioutil"
 	"math"
 	"os"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/open-horizon/edge-sync-service/common"
 	"github.com/open-horizon/edge-sync-service/core/communications"
+	"github.com/open-horizon/edge-sync-service/core/encryption"
 	"github.com/open-horizon/edge-sync-service/core/storage"
 )
 
@@ -169,6 +176,12 @@ func testObjectAPI(store storage.Storage, t *testing.T) {
 				},
 				Constraints: []string{"Plover=34", "asdf=true"},
 			}}, nil, ""},
+		{"myorg777", "type1", "123456", common.MetaData{ObjectID: "123456", ObjectType: "type1", DestOrgID: "myorg777",
+			Signature: "not base64!", SigningKeyID: "key1"}, nil, "updateObject didn't check the signature"},
+		{"myorg777", "type1", "123456", common.MetaData{ObjectID: "123456", ObjectType: "type1", DestOrgID: "myorg777",
+			Signature: "c2lnbmF0dXJl"}, nil, "updateObject didn't check that a signed object has a key"},
+		{"myorg777", "type1", "123456", common.MetaData{ObjectID: "123456", ObjectType: "type1", DestOrgID: "myorg777",
+			Signature: "c2lnbmF0dXJl", PublicKey: "bm90IGEga2V5"}, nil, "updateObject didn't check the public key"},
 		{"myorg777", "type1", "777", common.MetaData{ObjectID: "777", ObjectType: "type1", DestOrgID: "myorg777", MetaOnly: true}, nil,
 			"updateObject didn't check that the object had a policy and the update doesn't"},
 		{"myorg777", "type1", "888", common.MetaData{ObjectID: "888", ObjectType: "type1", DestOrgID: "myorg777", MetaOnly: true}, nil,
@@ -890,7 +903,7 @@ func testObjectWithPolicyAPI(store storage.Storage, t *testing.T) {
 		}
 	}
 
-	objects, err := ListAllObjects("myorg000", "type1")
+	objects, err := ListAllObjects("myorg000", "type1", common.ObjectsFilter{})
 	if err != nil {
 		t.Errorf("ListAllObjects failed to retrieve objects. Error: %s\n", err)
 	} else {
@@ -899,7 +912,7 @@ func testObjectWithPolicyAPI(store storage.Storage, t *testing.T) {
 		}
 	}
 
-	policyInfo, err := ListObjectsWithDestinationPolicy("myorg000", false)
+	policyInfo, err := ListObjectsWithDestinationPolicy("myorg000", false, common.ObjectsFilter{})
 	if err != nil {
 		t.Errorf("Failed to retrieve the objects with a destination policy. Error: %s\n", err)
 	}
@@ -918,7 +931,7 @@ func testObjectWithPolicyAPI(store storage.Storage, t *testing.T) {
 		}
 	}
 
-	policyInfo, err = ListObjectsWithDestinationPolicy("myorg000", false)
+	policyInfo, err = ListObjectsWithDestinationPolicy("myorg000", false, common.ObjectsFilter{})
 	if err != nil {
 		t.Errorf("Failed to retrieve the objects with a destination policy. Error: %s\n", err)
 	}
@@ -927,7 +940,7 @@ func testObjectWithPolicyAPI(store storage.Storage, t *testing.T) {
 			len(policyInfo), len(tests)-objectsMarkedReceived, len(tests)-1, objectsMarkedReceived)
 	}
 
-	policyInfo, err = ListObjectsWithDestinationPolicy("myorg000", true)
+	policyInfo, err = ListObjectsWithDestinationPolicy("myorg000", true, common.ObjectsFilter{})
 	if err != nil {
 		t.Errorf("Failed to retrieve the objects with a destination policy. Error: %s\n", err)
 	}
@@ -946,7 +959,7 @@ func testObjectWithPolicyAPI(store storage.Storage, t *testing.T) {
 		}
 	}
 
-	policyInfo, err = ListObjectsWithDestinationPolicy("myorg000", false)
+	policyInfo, err = ListObjectsWithDestinationPolicy("myorg000", false, common.ObjectsFilter{})
 	if err != nil {
 		t.Errorf("Failed to retrieve the objects with a destination policy. Error: %s\n", err)
 	}
@@ -964,3 +977,942 @@ func testObjectWithPolicyAPI(store storage.Storage, t *testing.T) {
 			len(policyInfo), 1)
 	}
 }
+
+func TestEncryptedObjectAPI(t *testing.T) {
+	setupDB(common.Mongo)
+	testEncryptedObjectAPI(store, t)
+
+	setupDB(common.Bolt)
+	testEncryptedObjectAPI(store, t)
+}
+
+func testEncryptedObjectAPI(store storage.Storage, t *testing.T) {
+	communications.Store = store
+	common.InitObjectLocks()
+
+	keysFile, err := ioutil.TempFile("", "keys")
+	if err != nil {
+		t.Fatalf("Failed to create the keys file. Error: %s", err.Error())
+	}
+	defer os.Remove(keysFile.Name())
+	keysFile.WriteString(`{"myorg888": {"currentKey": "key1", "keys": {"key1": "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="}}}`)
+	keysFile.Close()
+	encryption.SetKeyProvider(&encryption.FileKeyProvider{Path: keysFile.Name()})
+	defer encryption.SetKeyProvider(nil)
+	if err := encryption.Init(); err != nil {
+		t.Fatalf("Failed to initialize the key provider. Error: %s", err.Error())
+	}
+	// The encrypted data is compressed before it is encrypted
+	common.Configuration.DataCompression = common.GzipCompression
+	defer func() { common.Configuration.DataCompression = common.NoCompression }()
+
+	if err := store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+	}
+	defer store.Stop()
+
+	communications.Comm = &communications.TestComm{}
+	if err := communications.Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start test communication. Error: %s", err.Error())
+	}
+
+	tests := []struct {
+		orgID     string
+		encrypted bool
+	}{
+		{"myorg888", true},
+		{"myorg889", false},
+	}
+
+	for _, test := range tests {
+		metaData := common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: test.orgID, DestID: "dev1", DestType: "device"}
+		data := []byte("0123456789abcdef")
+		newData := []byte("abcdefghijklmnopqrstuvwxyz")
+
+		if err := UpdateObject(test.orgID, metaData.ObjectType, metaData.ObjectID, metaData, data); err != nil {
+			t.Errorf("Failed to update object (orgID = %s). Error: %s", test.orgID, err.Error())
+			continue
+		}
+		checkEncryptedData(store, test.orgID, data, test.encrypted, t)
+
+		if ok, err := PutObjectData(test.orgID, metaData.ObjectType, metaData.ObjectID, bytes.NewReader(newData)); err != nil || !ok {
+			t.Errorf("Failed to update object's data (orgID = %s). Error: %v", test.orgID, err)
+			continue
+		}
+		checkEncryptedData(store, test.orgID, newData, test.encrypted, t)
+	}
+}
+
+func checkEncryptedData(store storage.Storage, orgID string, data []byte, encrypted bool, t *testing.T) {
+	storedReader, err := store.RetrieveObjectData(orgID, "type1", "1")
+	if err != nil || storedReader == nil {
+		t.Errorf("Failed to retrieve the stored data (orgID = %s). Error: %v", orgID, err)
+		return
+	}
+	storedData, _ := ioutil.ReadAll(storedReader)
+	store.CloseDataReader(storedReader)
+	if encrypted == bytes.Equal(storedData, data) {
+		t.Errorf("The stored data is encrypted: %t, expected: %t (orgID = %s)", !encrypted, encrypted, orgID)
+	}
+
+	hash := sha256.Sum256(storedData)
+	if metaData, err := store.RetrieveObject(orgID, "type1", "1"); err != nil || metaData == nil {
+		t.Errorf("Failed to retrieve object (orgID = %s). Error: %v", orgID, err)
+	} else if metaData.DataHash != hex.EncodeToString(hash[:]) {
+		t.Errorf("Wrong data hash (orgID = %s)", orgID)
+	} else if metaData.OriginalSize != int64(len(data)) {
+		t.Errorf("Wrong original size of the data (orgID = %s): %d instead of %d", orgID, metaData.OriginalSize, len(data))
+	} else if metaData.Encrypted != encrypted {
+		t.Errorf("The meta data records that the data is encrypted: %t, expected: %t (orgID = %s)", metaData.Encrypted, encrypted, orgID)
+	}
+
+	dataReader, err := GetObjectData(orgID, "type1", "1")
+	if err != nil || dataReader == nil {
+		t.Errorf("Failed to get object's data (orgID = %s). Error: %v", orgID, err)
+		return
+	}
+	returnedData, _ := ioutil.ReadAll(dataReader)
+	store.CloseDataReader(dataReader)
+	if !bytes.Equal(returnedData, data) {
+		t.Errorf("getObjectData returned incorrect data (orgID = %s): %s instead of %s", orgID, string(returnedData), string(data))
+	}
+}
+
+func TestOrganizationQuotas(t *testing.T) {
+	setupDB(common.Mongo)
+	testOrganizationQuotas(store, t)
+
+	setupDB(common.Bolt)
+	testOrganizationQuotas(store, t)
+}
+
+func testOrganizationQuotas(store storage.Storage, t *testing.T) {
+	communications.Store = store
+	common.InitObjectLocks()
+
+	if err := store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+	}
+	defer store.Stop()
+
+	communications.Comm = &communications.TestComm{}
+	if err := communications.Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start test communication. Error: %s", err.Error())
+	}
+
+	orgID := "myorg990"
+	for _, id := range []string{"1", "2", "3"} {
+		store.DeleteStoredObject(orgID, "type1", id)
+		store.DeleteObjectVersions(orgID, "type1", id)
+	}
+
+	common.Configuration.OrgMaxObjects = 2
+	common.Configuration.OrgMaxDataSize = 20
+	common.Configuration.OrgMaxObjectSize = 15
+	defer func() {
+		common.Configuration.OrgMaxObjects = 0
+		common.Configuration.OrgMaxDataSize = 0
+		common.Configuration.OrgMaxObjectSize = 0
+	}()
+
+	tests := []struct {
+		objectID string
+		data     []byte
+		metaOnly bool
+		ok       bool
+	}{
+		{"1", []byte("0123456789"), false, true},
+		{"2", []byte("0123456789abcdef"), false, false}, // exceeds the object size limit
+		{"2", []byte("0123456789a"), false, false},      // exceeds the data size limit
+		{"2", []byte("0123456789"), false, true},
+		{"3", []byte("0"), false, false}, // exceeds the number of objects limit
+		{"1", []byte("01234"), false, true},
+		{"1", nil, true, true},
+	}
+
+	for index, test := range tests {
+		metaData := common.MetaData{ObjectID: test.objectID, ObjectType: "type1", DestOrgID: orgID, DestID: "dev1",
+			DestType: "device", MetaOnly: test.metaOnly}
+		err := UpdateObject(orgID, metaData.ObjectType, metaData.ObjectID, metaData, test.data)
+		if test.ok && err != nil {
+			t.Errorf("Failed to update object (test %d). Error: %s", index, err.Error())
+		} else if !test.ok {
+			if err == nil {
+				t.Errorf("Updated object that exceeds the limits (test %d)", index)
+			} else if _, ok := err.(*common.InvalidRequest); !ok {
+				t.Errorf("Wrong error type (test %d). Error: %s", index, err.Error())
+			}
+		}
+	}
+
+	// Object 1 has 5 bytes and object 2 has 10 bytes
+	if ok, err := PutObjectData(orgID, "type1", "1", bytes.NewReader([]byte("0123456789abcdef"))); err == nil || ok {
+		t.Errorf("Updated object's data that exceeds the object size limit")
+	} else if _, ok := err.(*common.InvalidRequest); !ok {
+		t.Errorf("Wrong error type. Error: %s", err.Error())
+	}
+	if ok, err := PutObjectData(orgID, "type1", "1", bytes.NewReader([]byte("0123456789"))); err != nil || !ok {
+		t.Errorf("Failed to update object's data. Error: %v", err)
+	}
+	common.Configuration.OrgMaxObjectSize = 0
+	if ok, err := PutObjectData(orgID, "type1", "2", bytes.NewReader([]byte("0123456789a"))); err == nil || ok {
+		t.Errorf("Updated object's data that exceeds the data size limit")
+	} else if _, ok := err.(*common.InvalidRequest); !ok {
+		t.Errorf("Wrong error type. Error: %s", err.Error())
+	}
+
+	usage, err := getOrgUsage(orgID)
+	if err != nil {
+		t.Errorf("Failed to retrieve the usage of the organization. Error: %s", err.Error())
+	} else if usage.StoredObjects != 2 || usage.StoredBytes != 20 {
+		t.Errorf("Wrong usage: %d objects and %d bytes instead of 2 objects and 20 bytes", usage.StoredObjects, usage.StoredBytes)
+	}
+
+	// The organization's limits override the configuration
+	if _, err := store.StoreOrganization(common.Organization{OrgID: orgID, Address: "address", MaxObjects: 3}); err != nil {
+		t.Errorf("Failed to store organization. Error: %s", err.Error())
+	}
+	defer store.DeleteOrganization(orgID)
+	common.Configuration.OrgMaxDataSize = 0
+	metaData := common.MetaData{ObjectID: "3", ObjectType: "type1", DestOrgID: orgID, DestID: "dev1", DestType: "device"}
+	if err := UpdateObject(orgID, metaData.ObjectType, metaData.ObjectID, metaData, []byte("01234")); err != nil {
+		t.Errorf("Failed to update object. Error: %s", err.Error())
+	}
+
+	// The data kept in the version history of the objects counts against the limits
+	maxVersions := common.Configuration.MaxObjectVersions
+	common.Configuration.MaxObjectVersions = 1
+	common.Configuration.OrgMaxDataSize = 30
+	defer func() { common.Configuration.MaxObjectVersions = maxVersions }()
+	if ok, err := PutObjectData(orgID, "type1", "3", bytes.NewReader([]byte("0123"))); err != nil || !ok {
+		t.Errorf("Failed to update object's data. Error: %v", err)
+	}
+	usage, err = getOrgUsage(orgID)
+	if err != nil {
+		t.Errorf("Failed to retrieve the usage of the organization. Error: %s", err.Error())
+	} else if usage.StoredObjects != 3 || usage.StoredBytes != 29 {
+		t.Errorf("Wrong usage: %d objects and %d bytes instead of 3 objects and 29 bytes", usage.StoredObjects, usage.StoredBytes)
+	}
+	if ok, err := PutObjectData(orgID, "type1", "3", bytes.NewReader([]byte("01"))); err == nil || ok {
+		t.Errorf("Updated object's data whose version exceeds the data size limit")
+	} else if _, ok := err.(*common.InvalidRequest); !ok {
+		t.Errorf("Wrong error type. Error: %s", err.Error())
+	}
+}
+
+func TestLabeledObjects(t *testing.T) {
+	setupDB(common.Mongo)
+	testLabeledObjects(store, t)
+
+	setupDB(common.Bolt)
+	testLabeledObjects(store, t)
+}
+
+func testLabeledObjects(store storage.Storage, t *testing.T) {
+	communications.Store = store
+	common.InitObjectLocks()
+
+	if err := store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+	}
+	defer store.Stop()
+
+	communications.Comm = &communications.TestComm{}
+	if err := communications.Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start test communication. Error: %s", err.Error())
+	}
+
+	orgID := "myorg991"
+	objects := []struct {
+		objectID string
+		labels   map[string]string
+	}{
+		{"1", map[string]string{"env": "prod", "tier": "web"}},
+		{"2", map[string]string{"env": "prod", "tier": "canary"}},
+		{"3", map[string]string{"env": "dev"}},
+	}
+	for _, object := range objects {
+		store.DeleteStoredObject(orgID, "type1", object.objectID)
+		metaData := common.MetaData{ObjectID: object.objectID, ObjectType: "type1", DestOrgID: orgID, NoData: true,
+			Inactive: true, Labels: object.labels}
+		if err := UpdateObject(orgID, "type1", object.objectID, metaData, nil); err != nil {
+			t.Errorf("Failed to update object %s. Error: %s", object.objectID, err.Error())
+		}
+	}
+
+	metaData := common.MetaData{ObjectID: "4", ObjectType: "type1", DestOrgID: orgID, NoData: true,
+		Labels: map[string]string{"env": "prod,dev"}}
+	if err := UpdateObject(orgID, "type1", "4", metaData, nil); err == nil {
+		t.Errorf("UpdateObject accepted an object with an invalid label")
+	}
+
+	selector, _ := common.ParseLabelSelector("env=prod,tier!=canary")
+	if ids, err := ActivateObjects(orgID, "type1", selector); err != nil {
+		t.Errorf("Failed to activate objects. Error: %s", err.Error())
+	} else if strings.Join(ids, " ") != "1" {
+		t.Errorf("ActivateObjects activated %v instead of [1]", ids)
+	}
+	if storedMetaData, err := store.RetrieveObject(orgID, "type1", "1"); err != nil || storedMetaData == nil {
+		t.Errorf("Failed to retrieve object. Error: %v", err)
+	} else if storedMetaData.Inactive {
+		t.Errorf("The selected object wasn't activated")
+	}
+	// The object is already active
+	if ids, err := ActivateObjects(orgID, "type1", selector); err != nil || len(ids) != 0 {
+		t.Errorf("ActivateObjects returned %v, %v instead of no objects", ids, err)
+	}
+
+	selector, _ = common.ParseLabelSelector("env=prod")
+	if ids, err := DeleteObjects(orgID, "type1", selector); err != nil {
+		t.Errorf("Failed to delete objects. Error: %s", err.Error())
+	} else if sort.Strings(ids); strings.Join(ids, " ") != "1 2" {
+		t.Errorf("DeleteObjects deleted %v instead of [1 2]", ids)
+	}
+	if ids, err := DeleteObjects(orgID, "type1", selector); err != nil || len(ids) != 0 {
+		t.Errorf("DeleteObjects returned %v, %v instead of no objects", ids, err)
+	}
+	if status, err := GetObjectStatus(orgID, "type1", "3"); err != nil || status == "" {
+		t.Errorf("The object that wasn't selected was deleted")
+	}
+
+	if _, err := DeleteObjects(orgID, "type1", common.LabelSelector{}); err == nil || !common.IsInvalidRequest(err) {
+		t.Errorf("DeleteObjects without a selector didn't return an InvalidRequest")
+	}
+
+	for _, object := range objects {
+		store.DeleteStoredObject(orgID, "type1", object.objectID)
+	}
+}
+
+func TestObjectOperationsBatch(t *testing.T) {
+	setupDB(common.Mongo)
+	testObjectOperationsBatch(store, t)
+
+	setupDB(common.Bolt)
+	testObjectOperationsBatch(store, t)
+}
+
+func testObjectOperationsBatch(store storage.Storage, t *testing.T) {
+	communications.Store = store
+	common.InitObjectLocks()
+
+	if err := store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+	}
+	defer store.Stop()
+
+	communications.Comm = &communications.TestComm{}
+	if err := communications.Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start test communication. Error: %s", err.Error())
+	}
+
+	orgID := "myorg992"
+	for _, objectID := range []string{"1", "2", "3", "4"} {
+		store.DeleteStoredObject(orgID, "type1", objectID)
+	}
+	newObject := func(objectID string, labels map[string]string) *common.MetaData {
+		return &common.MetaData{ObjectID: objectID, ObjectType: "type1", DestOrgID: orgID, NoData: true,
+			Inactive: true, Labels: labels}
+	}
+
+	operations := []ObjectOperation{
+		{Operation: BatchUpdate, ObjectType: "type1", ObjectID: "1", Meta: newObject("1", map[string]string{"env": "prod"})},
+		{Operation: BatchUpdate, ObjectType: "type1", ObjectID: "2", Meta: newObject("2", map[string]string{"env": "prod"})},
+		{Operation: BatchUpdate, ObjectType: "type1", ObjectID: "3", Meta: newObject("3", map[string]string{"env": "dev"})},
+	}
+	results, err := ApplyObjectOperations(orgID, operations, true)
+	if err != nil {
+		t.Errorf("Failed to apply the operations. Error: %s", err.Error())
+	} else if len(results) != 3 {
+		t.Errorf("ApplyObjectOperations returned %d results instead of 3", len(results))
+	} else {
+		for _, result := range results {
+			if result.Status != BatchSucceeded {
+				t.Errorf("The update of object %s %s: %s", result.ObjectID, result.Status, result.Message)
+			}
+		}
+	}
+
+	// An invalid operation prevents applying an atomic batch
+	operations = []ObjectOperation{
+		{Operation: BatchActivate, ObjectType: "type1", ObjectID: "1"},
+		{Operation: BatchDelete, ObjectType: "type1", ObjectID: "5"},
+	}
+	results, err = ApplyObjectOperations(orgID, operations, true)
+	if err != nil {
+		t.Errorf("Failed to apply the operations. Error: %s", err.Error())
+	} else if len(results) != 2 || results[0].Status != BatchSkipped || results[1].Status != BatchFailed {
+		t.Errorf("ApplyObjectOperations returned %v instead of a skipped and a failed operation", results)
+	}
+	if metaData, err := store.RetrieveObject(orgID, "type1", "1"); err != nil || metaData == nil || !metaData.Inactive {
+		t.Errorf("An operation of an invalid atomic batch was applied")
+	}
+
+	// Without atomic, the valid operations are applied
+	results, err = ApplyObjectOperations(orgID, operations, false)
+	if err != nil {
+		t.Errorf("Failed to apply the operations. Error: %s", err.Error())
+	} else if len(results) != 2 || results[0].Status != BatchSucceeded || results[1].Status != BatchFailed {
+		t.Errorf("ApplyObjectOperations returned %v instead of a succeeded and a failed operation", results)
+	}
+	if metaData, err := store.RetrieveObject(orgID, "type1", "1"); err != nil || metaData == nil || metaData.Inactive {
+		t.Errorf("The object wasn't activated")
+	}
+
+	// The operations with labels are expanded to the selected objects
+	operations = []ObjectOperation{
+		{Operation: BatchActivate, ObjectType: "type1", Labels: "env=prod"},
+		{Operation: BatchDelete, ObjectType: "type1", Labels: "env=dev"},
+	}
+	results, err = ApplyObjectOperations(orgID, operations, true)
+	if err != nil {
+		t.Errorf("Failed to apply the operations. Error: %s", err.Error())
+	} else if len(results) != 2 || results[0].ObjectID != "2" || results[0].Status != BatchSucceeded ||
+		results[1].ObjectID != "3" || results[1].Status != BatchSucceeded {
+		t.Errorf("ApplyObjectOperations returned %v instead of activating object 2 and deleting object 3", results)
+	}
+	if metaData, err := store.RetrieveObject(orgID, "type1", "3"); err != nil || (metaData != nil && !metaData.Deleted) {
+		t.Errorf("The selected object wasn't deleted")
+	}
+
+	// An operation of an atomic batch that fails after the batch was validated undoes the applied operations
+	updated := newObject("2", map[string]string{"env": "test"})
+	updated.NoData = false
+	updated.Inactive = false
+	created := newObject("4", nil)
+	created.NoData = false
+	withPolicy := newObject("1", nil)
+	withPolicy.DestinationPolicy = &common.Policy{}
+	operations = []ObjectOperation{
+		{Operation: BatchUpdate, ObjectType: "type1", ObjectID: "4", Meta: created, Data: []byte("data4")},
+		{Operation: BatchUpdate, ObjectType: "type1", ObjectID: "2", Meta: updated, Data: []byte("data2")},
+		{Operation: BatchDelete, ObjectType: "type1", ObjectID: "1"},
+		{Operation: BatchUpdate, ObjectType: "type1", ObjectID: "1", Meta: withPolicy},
+		{Operation: BatchActivate, ObjectType: "type1", ObjectID: "2"},
+	}
+	results, err = ApplyObjectOperations(orgID, operations, true)
+	if err != nil {
+		t.Errorf("Failed to apply the operations. Error: %s", err.Error())
+	} else if len(results) != 5 || results[0].Status != BatchSkipped || results[1].Status != BatchSkipped ||
+		results[2].Status != BatchSkipped || results[3].Status != BatchFailed || results[4].Status != BatchSkipped {
+		t.Errorf("ApplyObjectOperations returned %v instead of undoing the operations before the failed operation", results)
+	}
+	if metaData, err := store.RetrieveObject(orgID, "type1", "4"); err != nil || metaData != nil {
+		t.Errorf("The created object wasn't removed")
+	}
+	if metaData, err := store.RetrieveObject(orgID, "type1", "2"); err != nil || metaData == nil || !metaData.NoData ||
+		metaData.Labels["env"] != "prod" {
+		t.Errorf("The updated object wasn't restored")
+	}
+	if metaData, err := store.RetrieveObject(orgID, "type1", "1"); err != nil || metaData == nil || metaData.Deleted ||
+		metaData.DestinationPolicy != nil {
+		t.Errorf("The deleted object wasn't restored")
+	}
+
+	invalidBatches := [][]ObjectOperation{
+		{},
+		{{Operation: "rename", ObjectType: "type1", ObjectID: "1"}},
+		{{Operation: BatchUpdate, ObjectType: "type1", ObjectID: "4"}},
+		{{Operation: BatchDelete, ObjectType: "type1", ObjectID: "1", Labels: "env=prod"}},
+		{{Operation: BatchActivate, ObjectType: "type1", Labels: "env=a b"}},
+		{{Operation: BatchUpdate, ObjectType: "type1", ObjectID: "4", Meta: newObject("5", nil)}},
+	}
+	for index, operations := range invalidBatches {
+		results, err := ApplyObjectOperations(orgID, operations, false)
+		if index == 0 {
+			if err == nil || !common.IsInvalidRequest(err) {
+				t.Errorf("ApplyObjectOperations accepted an empty batch")
+			}
+		} else if err != nil || len(results) != 1 || results[0].Status != BatchFailed {
+			t.Errorf("ApplyObjectOperations returned %v, %v for the invalid batch %d", results, err, index)
+		}
+	}
+
+	for _, objectID := range []string{"1", "2", "3", "4"} {
+		store.DeleteStoredObject(orgID, "type1", objectID)
+	}
+}
+
+func TestObjectRollout(t *testing.T) {
+	setupDB(common.Mongo)
+	testObjectRollout(store, t)
+
+	setupDB(common.Bolt)
+	testObjectRollout(store, t)
+}
+
+func testObjectRollout(store storage.Storage, t *testing.T) {
+	communications.Store = store
+	common.InitObjectLocks()
+
+	if err := store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+	}
+	defer store.Stop()
+
+	communications.Comm = &communications.TestComm{}
+	if err := communications.Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start test communication. Error: %s", err.Error())
+	}
+
+	nodeType := common.Configuration.NodeType
+	common.Configuration.NodeType = common.CSS
+	defer func() { common.Configuration.NodeType = nodeType }()
+
+	orgID := "myorg993"
+	store.DeleteStoredObject(orgID, "type1", "1")
+	store.DeleteRollout(orgID, "type1", "1")
+	destinations := []string{"device:dev4", "device:dev3", "device:dev2", "device:dev1"}
+	for _, destination := range destinations {
+		parts := strings.Split(destination, ":")
+		if err := store.StoreDestination(common.Destination{DestOrgID: orgID, DestType: parts[0], DestID: parts[1],
+			Communication: common.MQTTProtocol}); err != nil {
+			t.Errorf("Failed to store destination. Error: %s", err.Error())
+		}
+	}
+
+	// Invalid rollouts
+	invalid := []common.MetaData{
+		{ObjectID: "1", ObjectType: "type1", DestOrgID: orgID, NoData: true, Rollout: &common.Rollout{}},
+		{ObjectID: "1", ObjectType: "type1", DestOrgID: orgID, NoData: true,
+			Rollout: &common.Rollout{Waves: []common.RolloutWave{{Count: 1}}}, DestinationPolicy: &common.Policy{}},
+	}
+	for _, metaData := range invalid {
+		if err := UpdateObject(orgID, "type1", "1", metaData, nil); err == nil || !common.IsInvalidRequest(err) {
+			t.Errorf("UpdateObject accepted an invalid rollout")
+		}
+	}
+
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: orgID, NoData: true, DestinationsList: destinations,
+		Rollout: &common.Rollout{Waves: []common.RolloutWave{{Count: 1}, {Percentage: 50}}, MaxErrorRate: 40}}
+	if err := UpdateObject(orgID, "type1", "1", metaData, nil); err != nil {
+		t.Errorf("UpdateObject failed. Error: %s", err.Error())
+		return
+	}
+
+	checkRollout := func(status string, wave int, notified int) {
+		report, err := GetObjectRollout(orgID, "type1", "1")
+		if err != nil {
+			t.Errorf("GetObjectRollout failed. Error: %s", err.Error())
+		} else if report == nil {
+			t.Errorf("GetObjectRollout didn't return the rollout")
+		} else if report.Status != status || report.Wave != wave || len(report.Destinations) != notified ||
+			report.TotalDestinations != len(destinations) || len(report.Waves) != wave {
+			t.Errorf("GetObjectRollout returned status %s, wave %d, and %d notified destinations instead of %s, %d, and %d",
+				report.Status, report.Wave, len(report.Destinations), status, wave, notified)
+		}
+	}
+	setStatus := func(status string, destIDs ...string) {
+		for _, destID := range destIDs {
+			if _, err := store.UpdateObjectDeliveryStatus(status, "", orgID, "type1", "1", "device", destID); err != nil {
+				t.Errorf("Failed to update the delivery status. Error: %s", err.Error())
+			}
+		}
+	}
+
+	// The first wave is notified
+	checkRollout(common.RolloutInProgress, 1, 1)
+	if notification, err := store.RetrieveNotificationRecord(orgID, "type1", "1", "device", "dev1"); err != nil || notification == nil {
+		t.Errorf("The destination of the first wave wasn't notified")
+	}
+	if notification, err := store.RetrieveNotificationRecord(orgID, "type1", "1", "device", "dev2"); err != nil || notification != nil {
+		t.Errorf("A destination that isn't in the first wave was notified")
+	}
+
+	// The next wave starts after the current wave succeeds
+	communications.AdvanceRollouts()
+	checkRollout(common.RolloutInProgress, 1, 1)
+	setStatus(common.Delivered, "dev1")
+	communications.AdvanceRollouts()
+	checkRollout(common.RolloutInProgress, 2, 3)
+
+	// The rollout is paused when the error rate exceeds the limit
+	setStatus(common.Error, "dev2", "dev3")
+	communications.AdvanceRollouts()
+	checkRollout(common.RolloutPaused, 2, 3)
+	communications.AdvanceRollouts()
+	checkRollout(common.RolloutPaused, 2, 3)
+
+	// The errors of the previous waves don't pause the resumed rollout
+	if err := UpdateObjectRollout(orgID, "type1", "1", false); err != nil {
+		t.Errorf("UpdateObjectRollout failed. Error: %s", err.Error())
+	}
+	communications.AdvanceRollouts()
+	checkRollout(common.RolloutInProgress, 2, 3)
+	setStatus(common.Consumed, "dev2", "dev3")
+	communications.AdvanceRollouts()
+	checkRollout(common.RolloutCompleted, 3, 4)
+	if notification, err := store.RetrieveNotificationRecord(orgID, "type1", "1", "device", "dev4"); err != nil || notification == nil {
+		t.Errorf("The destination of the last wave wasn't notified")
+	}
+
+	if err := UpdateObjectRollout(orgID, "type1", "1", true); err == nil || !common.IsInvalidRequest(err) {
+		t.Errorf("UpdateObjectRollout paused a completed rollout")
+	}
+
+	// A new instance of the object starts a new rollout
+	if err := UpdateObject(orgID, "type1", "1", metaData, nil); err != nil {
+		t.Errorf("UpdateObject failed. Error: %s", err.Error())
+	}
+	checkRollout(common.RolloutInProgress, 1, 1)
+	if err := UpdateObjectRollout(orgID, "type1", "1", true); err != nil {
+		t.Errorf("UpdateObjectRollout failed. Error: %s", err.Error())
+	}
+	setStatus(common.Delivered, "dev1")
+	communications.AdvanceRollouts()
+	checkRollout(common.RolloutPaused, 1, 1)
+
+	if err := DeleteObject(orgID, "type1", "1"); err != nil {
+		t.Errorf("DeleteObject failed. Error: %s", err.Error())
+	}
+	store.DeleteRollout(orgID, "type1", "1")
+}
+
+func TestObjectVersions(t *testing.T) {
+	setupDB(common.Mongo)
+	testObjectVersions(store, t)
+
+	setupDB(common.Bolt)
+	testObjectVersions(store, t)
+}
+
+func testObjectVersions(store storage.Storage, t *testing.T) {
+	communications.Store = store
+	common.InitObjectLocks()
+
+	if err := store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+	}
+	defer store.Stop()
+
+	communications.Comm = &communications.TestComm{}
+	if err := communications.Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start test communication. Error: %s", err.Error())
+	}
+
+	nodeType := common.Configuration.NodeType
+	common.Configuration.NodeType = common.CSS
+	maxVersions := common.Configuration.MaxObjectVersions
+	common.Configuration.MaxObjectVersions = 2
+	defer func() {
+		common.Configuration.NodeType = nodeType
+		common.Configuration.MaxObjectVersions = maxVersions
+	}()
+
+	orgID := "myorg994"
+	store.DeleteStoredObject(orgID, "type1", "1")
+	store.DeleteObjectVersions(orgID, "type1", "1")
+
+	if versions, err := GetObjectVersions(orgID, "type1", "1"); err != nil {
+		t.Errorf("GetObjectVersions failed. Error: %s", err.Error())
+	} else if versions != nil {
+		t.Errorf("GetObjectVersions returned versions of an object that doesn't exist")
+	}
+
+	instanceIDs := make([]int64, 0)
+	for _, version := range []string{"1.0.0", "1.0.1", "1.0.2"} {
+		metaData := common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: orgID, Version: version}
+		if err := UpdateObject(orgID, "type1", "1", metaData, []byte("data "+version)); err != nil {
+			t.Errorf("UpdateObject failed. Error: %s", err.Error())
+			return
+		}
+		stored, err := GetObject(orgID, "type1", "1")
+		if err != nil || stored == nil {
+			t.Errorf("GetObject failed. Error: %v", err)
+			return
+		}
+		instanceIDs = append(instanceIDs, stored.InstanceID)
+	}
+
+	// The two versions before the current one are kept
+	versions, err := GetObjectVersions(orgID, "type1", "1")
+	if err != nil {
+		t.Errorf("GetObjectVersions failed. Error: %s", err.Error())
+		return
+	}
+	if len(versions) != 2 || versions[0].Version != instanceIDs[1] || versions[0].MetaData.Version != "1.0.1" ||
+		versions[1].Version != instanceIDs[0] || versions[1].MetaData.Version != "1.0.0" {
+		t.Errorf("GetObjectVersions returned incorrect versions: %v", versions)
+		return
+	}
+
+	if found, err := RollbackObject(orgID, "type1", "1", instanceIDs[2]+100); err != nil {
+		t.Errorf("RollbackObject failed. Error: %s", err.Error())
+	} else if found {
+		t.Errorf("RollbackObject found a version that doesn't exist")
+	}
+
+	if found, err := RollbackObject(orgID, "type1", "1", instanceIDs[0]); err != nil {
+		t.Errorf("RollbackObject failed. Error: %s", err.Error())
+	} else if !found {
+		t.Errorf("RollbackObject didn't find the version")
+	}
+	if metaData, err := GetObject(orgID, "type1", "1"); err != nil || metaData == nil {
+		t.Errorf("GetObject failed. Error: %v", err)
+	} else if metaData.Version != "1.0.0" || metaData.InstanceID <= instanceIDs[2] {
+		t.Errorf("The object wasn't rolled back as a new instance: version %s, instance ID %d", metaData.Version, metaData.InstanceID)
+	}
+	if dataReader, err := GetObjectData(orgID, "type1", "1"); err != nil || dataReader == nil {
+		t.Errorf("GetObjectData failed. Error: %v", err)
+	} else {
+		data, _ := ioutil.ReadAll(dataReader)
+		store.CloseDataReader(dataReader)
+		if string(data) != "data 1.0.0" {
+			t.Errorf("The rolled back object has incorrect data: %s", string(data))
+		}
+	}
+
+	// The replaced version is kept in the version history
+	if versions, err := GetObjectVersions(orgID, "type1", "1"); err != nil {
+		t.Errorf("GetObjectVersions failed. Error: %s", err.Error())
+	} else if len(versions) != 2 || versions[0].Version != instanceIDs[2] || versions[0].MetaData.Version != "1.0.2" {
+		t.Errorf("GetObjectVersions returned incorrect versions after the rollback: %v", versions)
+	}
+
+	if err := DeleteObject(orgID, "type1", "1"); err != nil {
+		t.Errorf("DeleteObject failed. Error: %s", err.Error())
+	}
+	if versions, err := store.RetrieveObjectVersions(orgID, "type1", "1"); err != nil {
+		t.Errorf("RetrieveObjectVersions failed. Error: %s", err.Error())
+	} else if len(versions) != 0 {
+		t.Errorf("The versions of a deleted object weren't deleted")
+	}
+}
+
+func TestPolicyEvaluation(t *testing.T) {
+	setupDB(common.Mongo)
+	testPolicyEvaluation(store, t)
+
+	setupDB(common.Bolt)
+	testPolicyEvaluation(store, t)
+}
+
+func testPolicyEvaluation(store storage.Storage, t *testing.T) {
+	communications.Store = store
+	common.InitObjectLocks()
+
+	if err := store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+	}
+	defer store.Stop()
+
+	communications.Comm = &communications.TestComm{}
+	if err := communications.Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start test communication. Error: %s", err.Error())
+	}
+
+	nodeType := common.Configuration.NodeType
+	common.Configuration.NodeType = common.CSS
+	common.Configuration.PolicyEvaluation = true
+	defer func() {
+		common.Configuration.NodeType = nodeType
+		common.Configuration.PolicyEvaluation = false
+	}()
+
+	orgID := "myorg995"
+	store.DeleteStoredObject(orgID, "type1", "1")
+	destinations := []common.Destination{
+		{DestOrgID: orgID, DestType: "device", DestID: "dev1", Communication: common.MQTTProtocol,
+			Policy: &common.Policy{Properties: []common.PolicyProperty{{Name: "region", Value: "eu"}, {Name: "cores", Value: float64(8)}}}},
+		{DestOrgID: orgID, DestType: "device", DestID: "dev2", Communication: common.MQTTProtocol,
+			Policy: &common.Policy{Properties: []common.PolicyProperty{{Name: "region", Value: "us"}, {Name: "cores", Value: float64(2)}}}},
+		{DestOrgID: orgID, DestType: "device", DestID: "dev3", Communication: common.MQTTProtocol,
+			Policy: &common.Policy{Properties: []common.PolicyProperty{{Name: "region", Value: "eu"}},
+				Constraints: []string{"purpose == config"}}},
+	}
+	for _, destination := range destinations {
+		if err := store.StoreDestination(destination); err != nil {
+			t.Errorf("Failed to store destination. Error: %s", err.Error())
+		}
+	}
+
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: orgID, NoData: true,
+		DestinationPolicy: &common.Policy{Constraints: []string{"region == eu &&"}}}
+	if err := UpdateObject(orgID, "type1", "1", metaData, nil); err == nil || !common.IsInvalidRequest(err) {
+		t.Errorf("UpdateObject accepted an invalid constraint")
+	}
+
+	checkDestinations := func(expected ...string) {
+		statuses, err := GetObjectDestinationsStatus(orgID, "type1", "1")
+		if err != nil {
+			t.Errorf("GetObjectDestinationsStatus failed. Error: %s", err.Error())
+			return
+		}
+		result := make([]string, 0)
+		for _, status := range statuses {
+			result = append(result, status.DestID)
+		}
+		sort.Strings(result)
+		if strings.Join(result, ",") != strings.Join(expected, ",") {
+			t.Errorf("The object's destinations are %v instead of %v", result, expected)
+		}
+	}
+
+	metaData.DestinationPolicy = &common.Policy{Properties: []common.PolicyProperty{{Name: "purpose", Value: "model"}},
+		Constraints: []string{"region == eu"}}
+	if err := UpdateObject(orgID, "type1", "1", metaData, nil); err != nil {
+		t.Errorf("UpdateObject failed. Error: %s", err.Error())
+	}
+	checkDestinations("dev1")
+
+	metaData.DestinationPolicy = &common.Policy{Properties: []common.PolicyProperty{{Name: "purpose", Value: "config"}},
+		Constraints: []string{"region == eu || cores < 4"}}
+	if err := UpdateObject(orgID, "type1", "1", metaData, nil); err != nil {
+		t.Errorf("UpdateObject failed. Error: %s", err.Error())
+	}
+	checkDestinations("dev1", "dev2", "dev3")
+
+	metaData.DestinationPolicy.Constraints = []string{"cores > 4"}
+	if err := UpdateObject(orgID, "type1", "1", metaData, nil); err != nil {
+		t.Errorf("UpdateObject failed. Error: %s", err.Error())
+	}
+	checkDestinations("dev1")
+
+	if err := DeleteObject(orgID, "type1", "1"); err != nil {
+		t.Errorf("DeleteObject failed. Error: %s", err.Error())
+	}
+}
+
+func TestDestinationGroups(t *testing.T) {
+	setupDB(common.Mongo)
+	testDestinationGroups(store, t)
+
+	setupDB(common.Bolt)
+	testDestinationGroups(store, t)
+}
+
+func testDestinationGroups(store storage.Storage, t *testing.T) {
+	communications.Store = store
+	common.InitObjectLocks()
+
+	if err := store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+	}
+	defer store.Stop()
+
+	communications.Comm = &communications.TestComm{}
+	if err := communications.Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start test communication. Error: %s", err.Error())
+	}
+
+	nodeType := common.Configuration.NodeType
+	common.Configuration.NodeType = common.CSS
+	defer func() { common.Configuration.NodeType = nodeType }()
+
+	orgID := "myorg995"
+	store.DeleteStoredObject(orgID, "type1", "1")
+	store.DeleteDestinationGroup(orgID, "fleet")
+	for _, destID := range []string{"dev1", "dev2", "dev3"} {
+		if err := store.StoreDestination(common.Destination{DestOrgID: orgID, DestType: "device", DestID: destID,
+			Communication: common.MQTTProtocol}); err != nil {
+			t.Errorf("Failed to store destination. Error: %s", err.Error())
+		}
+	}
+
+	if err := UpdateDestinationGroup(orgID, "fleet", []string{"device:dev1", "group:other"}); err == nil || !common.IsInvalidRequest(err) {
+		t.Errorf("UpdateDestinationGroup accepted a destination group as a member of a group")
+	}
+	if err := UpdateDestinationGroup(orgID, "fleet", []string{"device:dev1", "device:dev2"}); err != nil {
+		t.Errorf("UpdateDestinationGroup failed. Error: %s", err.Error())
+	}
+
+	metaData := common.MetaData{ObjectID: "2", ObjectType: "type1", DestOrgID: orgID, NoData: true,
+		DestinationsList: []string{"group:other"}}
+	if err := UpdateObject(orgID, "type1", "2", metaData, nil); err == nil || !common.IsInvalidRequest(err) {
+		t.Errorf("UpdateObject accepted an object that targets a destination group that doesn't exist")
+	}
+
+	checkDestinations := func(expected ...string) {
+		dests, err := GetObjectDestinationsStatus(orgID, "type1", "1")
+		if err != nil {
+			t.Errorf("GetObjectDestinationsStatus failed. Error: %s", err.Error())
+			return
+		}
+		result := make([]string, 0)
+		for _, dest := range dests {
+			result = append(result, dest.DestID)
+		}
+		sort.Strings(result)
+		if strings.Join(result, ",") != strings.Join(expected, ",") {
+			t.Errorf("The object's destinations are %v instead of %v", result, expected)
+		}
+	}
+	checkNotification := func(destID string, status string) {
+		notification, err := store.RetrieveNotificationRecord(orgID, "type1", "1", "device", destID)
+		if err != nil {
+			t.Errorf("An error occurred in notification fetch. Error: %s", err.Error())
+		} else if notification == nil && status != "" {
+			t.Errorf("No notification record of %s", destID)
+		} else if notification != nil && notification.Status != status {
+			t.Errorf("Wrong notification status of %s: %s instead of %s", destID, notification.Status, status)
+		}
+	}
+
+	metaData = common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: orgID, NoData: true,
+		DestinationsList: []string{"group:fleet"}}
+	if err := UpdateObject(orgID, "type1", "1", metaData, nil); err != nil {
+		t.Errorf("UpdateObject failed. Error: %s", err.Error())
+	}
+	checkDestinations("dev1", "dev2")
+	if err := store.DeleteNotificationRecords(orgID, "type1", "1", "", ""); err != nil {
+		t.Errorf("DeleteNotificationRecords failed. Error: %s", err.Error())
+	}
+
+	// Changing the members of the group updates the destinations of the object
+	if err := UpdateDestinationGroup(orgID, "fleet", []string{"device:dev2", "device:dev3"}); err != nil {
+		t.Errorf("UpdateDestinationGroup failed. Error: %s", err.Error())
+	}
+	checkDestinations("dev2", "dev3")
+	checkNotification("dev1", common.Delete)
+	checkNotification("dev2", "")
+	checkNotification("dev3", common.Update)
+
+	if group, err := GetDestinationGroup(orgID, "fleet"); err != nil || group == nil {
+		t.Errorf("GetDestinationGroup failed. Error: %v", err)
+	} else if strings.Join(group.Destinations, ",") != "device:dev2,device:dev3" {
+		t.Errorf("The destinations of the group are %v", group.Destinations)
+	}
+	if groups, err := ListDestinationGroups(orgID); err != nil || len(groups) != 1 {
+		t.Errorf("ListDestinationGroups returned %d groups instead of 1. Error: %v", len(groups), err)
+	}
+
+	if _, err := DeleteDestinationGroup(orgID, "fleet"); err == nil || !common.IsInvalidRequest(err) {
+		t.Errorf("DeleteDestinationGroup deleted a group that is the target of an object")
+	}
+	if err := store.DeleteStoredObject(orgID, "type1", "1"); err != nil {
+		t.Errorf("DeleteStoredObject failed. Error: %s", err.Error())
+	}
+	if found, err := DeleteDestinationGroup(orgID, "fleet"); err != nil || !found {
+		t.Errorf("DeleteDestinationGroup failed. Error: %v", err)
+	}
+	if found, err := DeleteDestinationGroup(orgID, "fleet"); err != nil || found {
+		t.Errorf("DeleteDestinationGroup found a deleted group. Error: %v", err)
+	}
+
+	// A group isn't deleted while an object that targets it is stored
+	metaData = common.MetaData{ObjectID: "3", ObjectType: "type1", DestOrgID: orgID, NoData: true,
+		DestinationsList: []string{"group:fleet"}}
+	for i := 0; i < 10; i++ {
+		if err := UpdateDestinationGroup(orgID, "fleet", []string{"device:dev1"}); err != nil {
+			t.Errorf("UpdateDestinationGroup failed. Error: %s", err.Error())
+		}
+		var updateErr error
+		var deleted bool
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			updateErr = UpdateObject(orgID, "type1", "3", metaData, nil)
+		}()
+		go func() {
+			defer wg.Done()
+			deleted, _ = DeleteDestinationGroup(orgID, "fleet")
+		}()
+		wg.Wait()
+		if deleted && updateErr == nil {
+			t.Errorf("DeleteDestinationGroup deleted a group while an object that targets it was stored")
+		}
+		store.DeleteStoredObject(orgID, "type1", "3")
+		store.DeleteDestinationGroup(orgID, "fleet")
+	}
+}
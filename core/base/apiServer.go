@@ -26,14 +26,25 @@ const resendURL = "/api/v1/resend"
 const securityURL = "/api/v1/security/"
 const shutdownURL = "/api/v1/shutdown"
 const healthURL = "/api/v1/health"
+const metricsURL = "/metrics"
+const destinationGroupsURL = "/api/v1/destinationGroups"
+const webhooksURL = "/api/v1/webhooks"
+const auditURL = "/api/v1/audit"
 
 const (
 	contentType     = "Content-Type"
 	applicationJSON = "application/json"
+	textEventStream = "text/event-stream"
 )
 
+// The interval of the comments sent to keep idle streams of updates open
+const streamKeepAliveInterval = 30 * time.Second
+
 var unauthorizedBytes = []byte("Unauthorized")
 
+// nextCursorHeader is the header of the responses to the APIs that list objects with the cursor of the next page
+const nextCursorHeader = "X-Sync-Service-Next-Cursor"
+
 // objectUpdate includes the object's metadata and data
 // A sync service object includes metadata and optionally binary data.
 // When an object is created the metadata must be provided. The metadata and the data can then be updated together or one at a time.
@@ -56,6 +67,18 @@ type webhookUpdate struct {
 
 	// URL is the URL to invoke when new information for the object is available
 	URL string `json:"url"`
+
+	// Secret is an optional secret used to sign the requests to the webhook.
+	// The signature is sent in the X-Sync-Service-Signature header as sha256= followed by the hex encoded
+	// HMAC-SHA256 of the request's body.
+	Secret string `json:"secret"`
+
+	// Events are the events of the objects for which the webhook is called: updated, received, delivered, consumed,
+	// deleted, feedback, and completed (the object was delivered to all its destinations).
+	// The webhook is called for the updated event if no events are provided.
+	// The event is sent in the X-Sync-Service-Event header. The object's meta data is posted for the updated event,
+	// and a WebhookEvent with the destination and its status is posted for the other events.
+	Events []string `json:"events"`
 }
 
 // organization includes the organization's id and broker address
@@ -79,19 +102,61 @@ type bulkACLUpdate struct {
 	Usernames []string `json:"usernames"`
 }
 
+// rolloutUpdate is the payload used to pause or resume the rollout of an object
+// swagger:model
+type rolloutUpdate struct {
+	// Action is an action, which can be either pause or resume
+	Action string `json:"action"`
+}
+
+// objectRollback is the payload used to roll back an object to a previous version
+// swagger:model
+type objectRollback struct {
+	// Version is the version to roll back to, as listed in the object's version history
+	Version int64 `json:"version"`
+}
+
+// objectsBatch is the payload of a batch of operations on objects
+// swagger:model
+type objectsBatch struct {
+	// Atomic indicates that the operations are applied only if all of them are valid, and that if applying
+	// an operation fails, the remaining operations are skipped and the applied operations are undone
+	Atomic bool `json:"atomic"`
+
+	// Operations are the operations to apply in order
+	Operations []ObjectOperation `json:"operations"`
+}
+
+// destinationGroupPayload is the payload used to create or update a destination group
+// swagger:model
+type destinationGroupPayload struct {
+	// Destinations are the destinations of the group as type:id pairs
+	Destinations []string `json:"destinations"`
+}
+
 func setupAPIServer() {
 	if common.Configuration.NodeType == common.CSS {
-		http.Handle(destinationsURL+"/", http.StripPrefix(destinationsURL+"/", http.HandlerFunc(handleDestinations)))
-		http.Handle(securityURL, http.StripPrefix(securityURL, http.HandlerFunc(handleSecurity)))
+		http.Handle(destinationsURL+"/", security.RateLimited(http.StripPrefix(destinationsURL+"/", audited(auditDestinations, http.HandlerFunc(handleDestinations)))))
+		http.Handle(destinationGroupsURL+"/", security.RateLimited(http.StripPrefix(destinationGroupsURL+"/",
+			audited(auditDestinationGroups, http.HandlerFunc(handleDestinationGroups)))))
+		http.Handle(securityURL, security.RateLimited(http.StripPrefix(securityURL, audited(auditSecurity, http.HandlerFunc(handleSecurity)))))
 	} else {
 		http.HandleFunc(destinationsURL, handleDestinations)
 	}
-	http.Handle(objectsURL, http.StripPrefix(objectsURL, http.HandlerFunc(handleObjects)))
-	http.HandleFunc(shutdownURL, handleShutdown)
-	http.HandleFunc(resendURL, handleResend)
-	http.Handle(getOrganizationsURL, http.StripPrefix(getOrganizationsURL, http.HandlerFunc(handleGetOrganizations)))
-	http.Handle(organizationURL, http.StripPrefix(organizationURL, http.HandlerFunc(handleOrganizations)))
+	if common.Configuration.NodeType == common.CSS {
+		http.Handle(webhooksURL+"/", security.RateLimited(http.StripPrefix(webhooksURL+"/", http.HandlerFunc(handleWebhookDeliveries))))
+		http.Handle(auditURL+"/", security.RateLimited(http.StripPrefix(auditURL+"/", http.HandlerFunc(handleAuditLog))))
+	} else {
+		http.HandleFunc(webhooksURL, handleWebhookDeliveries)
+		http.HandleFunc(auditURL, handleAuditLog)
+	}
+	http.Handle(objectsURL, security.RateLimited(http.StripPrefix(objectsURL, audited(auditObjects, http.HandlerFunc(handleObjects)))))
+	http.Handle(shutdownURL, security.RateLimited(audited(auditShutdown, http.HandlerFunc(handleShutdown))))
+	http.Handle(resendURL, security.RateLimited(audited(auditResend, http.HandlerFunc(handleResend))))
+	http.Handle(getOrganizationsURL, security.RateLimited(http.StripPrefix(getOrganizationsURL, http.HandlerFunc(handleGetOrganizations))))
+	http.Handle(organizationURL, security.RateLimited(http.StripPrefix(organizationURL, audited(auditOrganizations, http.HandlerFunc(handleOrganizations)))))
 	http.HandleFunc(healthURL, handleHealth)
+	http.HandleFunc(metricsURL, handleMetrics)
 }
 
 func handleDestinations(writer http.ResponseWriter, request *http.Request) {
@@ -107,7 +172,7 @@ func handleDestinations(writer http.ResponseWriter, request *http.Request) {
 		return
 	}
 
-	if request.Method != http.MethodGet {
+	if request.Method != http.MethodGet && request.Method != http.MethodPut {
 		writer.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
@@ -140,12 +205,32 @@ func handleDestinations(writer http.ResponseWriter, request *http.Request) {
 		return
 	}
 
+	if (len(parts) == 3 || (len(parts) == 4 && len(parts[3]) == 0)) && parts[2] == "properties" {
+		if request.Method != http.MethodPut {
+			writer.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if code != security.AuthAdmin && code != security.AuthSyncAdmin {
+			writer.WriteHeader(http.StatusForbidden)
+			writer.Write(unauthorizedBytes)
+			return
+		}
+		handleDestinationProperties(orgID, parts[0], parts[1], writer, request)
+		return
+	}
+	if request.Method != http.MethodGet {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
 	if len(parts) == 0 || (len(parts) == 1 && len(parts[0]) == 0) {
 		// swagger:operation GET /api/v1/destinations/{orgID} handleDestinations
 		//
 		// List all known destinations.
 		//
 		// Provides a list of destinations for an organization, i.e., ESS nodes (belonging to orgID) that have registered with the CSS.
+		// The destinations can be filtered by their properties, for example, ?properties=region=eu lists the destinations
+		// in the eu region.
 		// This is a CSS only API.
 		//
 		// ---
@@ -160,6 +245,11 @@ func handleDestinations(writer http.ResponseWriter, request *http.Request) {
 		//   description: The orgID of the destinations to return.
 		//   required: true
 		//   type: string
+		// - name: properties
+		//   in: query
+		//   description: Return only the destinations whose properties satisfy the selector, a comma separated list of requirements (key=value, key!=value, key, or !key), e.g., region=eu,hardware!=rpi3
+		//   required: false
+		//   type: string
 		//
 		// responses:
 		//   '200':
@@ -168,6 +258,10 @@ func handleDestinations(writer http.ResponseWriter, request *http.Request) {
 		//       type: array
 		//       items:
 		//         "$ref": "#/definitions/Destination"
+		//   '400':
+		//     description: Invalid properties selector
+		//     schema:
+		//       type: string
 		//   '404':
 		//     description: No destinations found
 		//     schema:
@@ -176,7 +270,12 @@ func handleDestinations(writer http.ResponseWriter, request *http.Request) {
 		//     description: Failed to retrieve the destinations
 		//     schema:
 		//       type: string
-		if dests, err := ListDestinations(orgID); err != nil {
+		selector, err := common.ParseLabelSelector(request.URL.Query().Get("properties"))
+		if err != nil {
+			communications.SendErrorResponse(writer, err, "", 0)
+			return
+		}
+		if dests, err := ListDestinations(orgID, selector); err != nil {
 			communications.SendErrorResponse(writer, err, "Failed to fetch the list of destinations. Error: ", 0)
 		} else {
 			if len(dests) == 0 {
@@ -261,152 +360,733 @@ func handleDestinations(writer http.ResponseWriter, request *http.Request) {
 	}
 }
 
-// swagger:operation POST /api/v1/resend handleResend
+// swagger:operation PUT /api/v1/destinations/{orgID}/{destType}/{destID}/properties handleDestinationProperties
 //
-// Request to resend objects.
+// Update the properties of a destination.
 //
-// Used by an ESS to ask the CSS to resend it all the objects (supported only for ESS to CSS requests).
-// An application only needs to use this API in case the data it previously obtained from the ESS was lost.
+// Replaces the properties of a destination, key/value pairs that describe it, for example its site, hardware or software.
+// The properties are kept when the ESS registers again, unless it publishes its own properties (the DestinationProperties
+// configuration property of the ESS), which replace them.
+// This is a CSS only API, that can be called only by admins.
 //
 // ---
 //
+// consumes:
+// - application/json
+//
 // produces:
 // - text/plain
 //
+// parameters:
+// - name: orgID
+//   in: path
+//   description: The orgID of the destination
+//   required: true
+//   type: string
+// - name: destType
+//   in: path
+//   description: The destType of the destination
+//   required: true
+//   type: string
+// - name: destID
+//   in: path
+//   description: The destID of the destination
+//   required: true
+//   type: string
+// - name: payload
+//   in: body
+//   description: The properties of the destination, an empty object removes them
+//   required: true
+//   schema:
+//     type: object
+//     additionalProperties:
+//       type: string
+//
 // responses:
 //   '204':
-//     description: The request will be sent
+//     description: The properties were updated
 //     schema:
 //       type: string
 //   '400':
-//     description: The request is not allowed on Cloud Sync-Service
+//     description: Invalid properties
 //     schema:
 //       type: string
-func handleResend(writer http.ResponseWriter, request *http.Request) {
+//   '404':
+//     description: The destination was not found
+//     schema:
+//       type: string
+//   '500':
+//     description: Failed to update the properties
+//     schema:
+//       type: string
+func handleDestinationProperties(orgID string, destType string, destID string, writer http.ResponseWriter, request *http.Request) {
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In handleDestinations. Update the properties of %s %s\n", destType, destID)
+	}
+	var properties map[string]string
+	if err := json.NewDecoder(request.Body).Decode(&properties); err != nil {
+		communications.SendErrorResponse(writer, err, "Invalid JSON for destination properties. Error: ", http.StatusBadRequest)
+		return
+	}
+	if found, err := UpdateDestinationProperties(orgID, destType, destID, properties); err != nil {
+		communications.SendErrorResponse(writer, err, "", 0)
+	} else if !found {
+		writer.WriteHeader(http.StatusNotFound)
+	} else {
+		writer.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func handleDestinationGroups(writer http.ResponseWriter, request *http.Request) {
 	if !common.Running {
 		writer.WriteHeader(http.StatusServiceUnavailable)
 		return
 	}
 
-	code, _, _ := security.Authenticate(request)
-	if code != security.AuthAdmin && code != security.AuthUser && code != security.AuthSyncAdmin {
+	code, userOrg, _ := security.Authenticate(request)
+	if code == security.AuthFailed || code == security.AuthEdgeNode {
 		writer.WriteHeader(http.StatusForbidden)
 		writer.Write(unauthorizedBytes)
 		return
 	}
 
-	if request.Method == http.MethodPost {
-		if trace.IsLogging(logger.DEBUG) {
-			trace.Debug("In handleResend\n")
-		}
-		if err := ResendObjects(); err != nil {
-			communications.SendErrorResponse(writer, err, "Failed to send resend objects request. Error: ", 0)
-		} else {
-			writer.WriteHeader(http.StatusNoContent)
-		}
-	} else {
-		writer.WriteHeader(http.StatusMethodNotAllowed)
+	parts := strings.Split(strings.TrimSuffix(request.URL.Path, "/"), "/")
+	if len(parts) == 0 || len(parts[0]) == 0 || len(parts) > 2 {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
 	}
-}
-
-func handleShutdown(writer http.ResponseWriter, request *http.Request) {
-	code, _, _ := security.Authenticate(request)
-	if code != security.AuthSyncAdmin {
+	orgID := parts[0]
+	if userOrg != orgID && code != security.AuthSyncAdmin {
 		writer.WriteHeader(http.StatusForbidden)
 		writer.Write(unauthorizedBytes)
 		return
 	}
 
-	if request.Method == http.MethodPost {
-		writer.WriteHeader(http.StatusNoContent)
-
-		restart := strings.ToLower(request.URL.Query().Get("restart"))
-		quiesceString := request.URL.Query().Get("quiesce")
-
-		go func() {
-			timer := time.NewTimer(time.Duration(1) * time.Second)
-			<-timer.C
-
-			quieceTime := 3
-			if len(quiesceString) != 0 {
-				var quieceTemp int
-				_, err := fmt.Sscanf(quiesceString, "%d", &quieceTemp)
-				if err == nil {
-					quieceTime = quieceTemp
-				}
-			}
-
-			if restart == "true" || restart == "yes" {
-				// If BlockUntilShutdown was called, don't let Stop() unblock
-				blocking := waitingOnBlockChannel
-				waitingOnBlockChannel = false
-				Stop(quieceTime)
-
-				if log.IsLogging(logger.INFO) {
-					log.Info("Restarting the Sync Service")
-				}
-				Start("", false)
-				waitingOnBlockChannel = blocking
-			} else {
-				Stop(quieceTime)
-			}
-		}()
-	} else {
-		writer.WriteHeader(http.StatusMethodNotAllowed)
-	}
-}
-
-func handleObjects(writer http.ResponseWriter, request *http.Request) {
-	if !common.Running {
-		writer.WriteHeader(http.StatusServiceUnavailable)
+	if len(parts) == 1 {
+		if request.Method != http.MethodGet {
+			writer.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		// swagger:operation GET /api/v1/destinationGroups/{orgID} handleListDestinationGroups
+		//
+		// List the destination groups.
+		//
+		// Provides a list of the destination groups of an organization.
+		// This is a CSS only API.
+		//
+		// ---
+		//
+		// produces:
+		// - application/json
+		// - text/plain
+		//
+		// parameters:
+		// - name: orgID
+		//   in: path
+		//   description: The orgID of the destination groups to return
+		//   required: true
+		//   type: string
+		//
+		// responses:
+		//   '200':
+		//     description: Destination groups response
+		//     schema:
+		//       type: array
+		//       items:
+		//         "$ref": "#/definitions/DestinationGroup"
+		//   '404':
+		//     description: No destination groups found
+		//     schema:
+		//       type: string
+		//   '500':
+		//     description: Failed to retrieve the destination groups
+		//     schema:
+		//       type: string
+		if groups, err := ListDestinationGroups(orgID); err != nil {
+			communications.SendErrorResponse(writer, err, "Failed to fetch the list of destination groups. Error: ", 0)
+		} else if len(groups) == 0 {
+			writer.WriteHeader(http.StatusNotFound)
+		} else {
+			writeDestinationGroupsResponse(groups, writer)
+		}
 		return
 	}
 
-	if len(request.URL.Path) != 0 {
-		parts := strings.Split(request.URL.Path, "/")
-		var orgID string
-		if common.Configuration.NodeType == common.CSS {
-			orgID = parts[0]
-			parts = parts[1:]
+	name := parts[1]
+	switch request.Method {
+	case http.MethodGet:
+		// swagger:operation GET /api/v1/destinationGroups/{orgID}/{name} handleGetDestinationGroup
+		//
+		// Get a destination group.
+		//
+		// Get the destinations of a destination group.
+		// This is a CSS only API.
+		//
+		// ---
+		//
+		// produces:
+		// - application/json
+		// - text/plain
+		//
+		// parameters:
+		// - name: orgID
+		//   in: path
+		//   description: The orgID of the destination group
+		//   required: true
+		//   type: string
+		// - name: name
+		//   in: path
+		//   description: The name of the destination group
+		//   required: true
+		//   type: string
+		//
+		// responses:
+		//   '200':
+		//     description: Destination group response
+		//     schema:
+		//       "$ref": "#/definitions/DestinationGroup"
+		//   '404':
+		//     description: The destination group was not found
+		//     schema:
+		//       type: string
+		//   '500':
+		//     description: Failed to retrieve the destination group
+		//     schema:
+		//       type: string
+		if group, err := GetDestinationGroup(orgID, name); err != nil {
+			communications.SendErrorResponse(writer, err, "Failed to fetch the destination group. Error: ", 0)
+		} else if group == nil {
+			writer.WriteHeader(http.StatusNotFound)
 		} else {
-			orgID = common.Configuration.OrgID
+			writeDestinationGroupsResponse(group, writer)
 		}
 
-		if len(parts) == 0 {
-			// GET     /api/v1/objects/orgID?destination_policy=true
-			if request.Method != http.MethodGet {
-				writer.WriteHeader(http.StatusMethodNotAllowed)
-				return
-			}
-			destPolicyString := request.URL.Query().Get("destination_policy")
-			destPolicy := false
-			if destPolicyString != "" {
-				var err error
-				destPolicy, err = strconv.ParseBool(destPolicyString)
-				if err == nil && destPolicy {
-					handleListObjectsWithDestinationPolicy(orgID, writer, request)
-					return
-				}
-			}
-			writer.WriteHeader(http.StatusBadRequest)
-			return
-		} else if len(parts) == 1 || (len(parts) == 2 && len(parts[1]) == 0) {
-			// /api/v1/objects/orgID/type
-			// GET - get updated objects
-			// PUT - register/delete a webhook
-			switch request.Method {
-			case http.MethodGet:
-
-				allObjectsString := request.URL.Query().Get("all_objects")
-				allObjects := false
-				if allObjectsString != "" {
-					var err error
-					allObjects, err = strconv.ParseBool(allObjectsString)
-					if err != nil {
-						writer.WriteHeader(http.StatusBadRequest)
-						return
-					}
-				}
+	case http.MethodPut:
+		// swagger:operation PUT /api/v1/destinationGroups/{orgID}/{name} handleUpdateDestinationGroup
+		//
+		// Create or update a destination group.
+		//
+		// Sets the destinations of a destination group, creating the group if it doesn't exist.
+		// Objects target all the destinations of a group by including group:{name} in their destinations list.
+		// The objects that target the group are sent to the destinations that are added to the group,
+		// and are deleted from the destinations that are removed from it.
+		// This is a CSS only API, that can be called only by admins.
+		//
+		// ---
+		//
+		// consumes:
+		// - application/json
+		//
+		// produces:
+		// - text/plain
+		//
+		// parameters:
+		// - name: orgID
+		//   in: path
+		//   description: The orgID of the destination group
+		//   required: true
+		//   type: string
+		// - name: name
+		//   in: path
+		//   description: The name of the destination group
+		//   required: true
+		//   type: string
+		// - name: payload
+		//   in: body
+		//   description: The destinations of the group
+		//   required: true
+		//   schema:
+		//     "$ref": "#/definitions/destinationGroupPayload"
+		//
+		// responses:
+		//   '204':
+		//     description: The destination group was updated
+		//     schema:
+		//       type: string
+		//   '400':
+		//     description: Invalid destination group
+		//     schema:
+		//       type: string
+		//   '500':
+		//     description: Failed to update the destination group
+		//     schema:
+		//       type: string
+		if code != security.AuthAdmin && code != security.AuthSyncAdmin {
+			writer.WriteHeader(http.StatusForbidden)
+			writer.Write(unauthorizedBytes)
+			return
+		}
+		if trace.IsLogging(logger.DEBUG) {
+			trace.Debug("In handleDestinationGroups. Update the destination group %s %s\n", orgID, name)
+		}
+		var payload destinationGroupPayload
+		if err := json.NewDecoder(request.Body).Decode(&payload); err != nil {
+			communications.SendErrorResponse(writer, err, "Invalid JSON for destination group. Error: ", http.StatusBadRequest)
+			return
+		}
+		if err := UpdateDestinationGroup(orgID, name, payload.Destinations); err != nil {
+			communications.SendErrorResponse(writer, err, "", 0)
+		} else {
+			writer.WriteHeader(http.StatusNoContent)
+		}
+
+	case http.MethodDelete:
+		// swagger:operation DELETE /api/v1/destinationGroups/{orgID}/{name} handleDeleteDestinationGroup
+		//
+		// Delete a destination group.
+		//
+		// Deletes a destination group. A group can't be deleted while objects target it.
+		// This is a CSS only API, that can be called only by admins.
+		//
+		// ---
+		//
+		// produces:
+		// - text/plain
+		//
+		// parameters:
+		// - name: orgID
+		//   in: path
+		//   description: The orgID of the destination group
+		//   required: true
+		//   type: string
+		// - name: name
+		//   in: path
+		//   description: The name of the destination group
+		//   required: true
+		//   type: string
+		//
+		// responses:
+		//   '204':
+		//     description: The destination group was deleted
+		//     schema:
+		//       type: string
+		//   '400':
+		//     description: Objects target the destination group
+		//     schema:
+		//       type: string
+		//   '404':
+		//     description: The destination group was not found
+		//     schema:
+		//       type: string
+		//   '500':
+		//     description: Failed to delete the destination group
+		//     schema:
+		//       type: string
+		if code != security.AuthAdmin && code != security.AuthSyncAdmin {
+			writer.WriteHeader(http.StatusForbidden)
+			writer.Write(unauthorizedBytes)
+			return
+		}
+		if trace.IsLogging(logger.DEBUG) {
+			trace.Debug("In handleDestinationGroups. Delete the destination group %s %s\n", orgID, name)
+		}
+		if found, err := DeleteDestinationGroup(orgID, name); err != nil {
+			communications.SendErrorResponse(writer, err, "", 0)
+		} else if !found {
+			writer.WriteHeader(http.StatusNotFound)
+		} else {
+			writer.WriteHeader(http.StatusNoContent)
+		}
+
+	default:
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func writeDestinationGroupsResponse(response interface{}, writer http.ResponseWriter) {
+	if data, err := json.MarshalIndent(response, "", "  "); err != nil {
+		communications.SendErrorResponse(writer, err, "Failed to marshal the destination groups. Error: ", 0)
+	} else {
+		writer.Header().Add(contentType, applicationJSON)
+		writer.WriteHeader(http.StatusOK)
+		if _, err := writer.Write(data); err != nil && log.IsLogging(logger.ERROR) {
+			log.Error("Failed to write response body, error: " + err.Error())
+		}
+	}
+}
+
+// swagger:operation GET /api/v1/webhooks/{orgID} handleWebhookDeliveries
+//
+// List the deliveries to webhooks.
+//
+// Provides a list of the deliveries of updates of objects to the webhooks of an organization that haven't succeeded yet.
+// Pending deliveries are retried with an exponential backoff. Deliveries that failed the maximal number of attempts
+// are in the failed status, and are no longer retried. The deliveries to a webhook are removed when the webhook is deleted.
+// Only the deliveries of the objects the user can access are returned.
+//
+// ---
+//
+// produces:
+// - application/json
+// - text/plain
+//
+// parameters:
+// - name: orgID
+//   in: path
+//   description: The orgID of the webhooks. Present only when working with a CSS, removed from the path when working with an ESS
+//   required: true
+//   type: string
+// - name: status
+//   in: query
+//   description: The status of the deliveries to return, pending or failed. All the deliveries are returned if it is omitted
+//   required: false
+//   type: string
+//
+// responses:
+//   '200':
+//     description: Webhook deliveries response
+//     schema:
+//       type: array
+//       items:
+//         "$ref": "#/definitions/WebhookDelivery"
+//   '404':
+//     description: No webhook deliveries found
+//     schema:
+//       type: string
+//   '500':
+//     description: Failed to retrieve the webhook deliveries
+//     schema:
+//       type: string
+func handleWebhookDeliveries(writer http.ResponseWriter, request *http.Request) {
+	if !common.Running {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	code, userOrg, _ := security.Authenticate(request)
+	if code == security.AuthFailed || code == security.AuthEdgeNode {
+		writer.WriteHeader(http.StatusForbidden)
+		writer.Write(unauthorizedBytes)
+		return
+	}
+
+	if request.Method != http.MethodGet {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var orgID string
+	if common.Configuration.NodeType == common.CSS {
+		orgID = strings.TrimSuffix(request.URL.Path, "/")
+		if len(orgID) == 0 || strings.Contains(orgID, "/") {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	} else {
+		orgID = common.Configuration.OrgID
+	}
+
+	if userOrg != orgID && code != security.AuthSyncAdmin {
+		writer.WriteHeader(http.StatusForbidden)
+		writer.Write(unauthorizedBytes)
+		return
+	}
+
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In handleWebhookDeliveries. List the deliveries of %s\n", orgID)
+	}
+	if deliveries, err := ListWebhookDeliveries(orgID, request.URL.Query().Get("status")); err != nil {
+		communications.SendErrorResponse(writer, err, "Failed to fetch the list of webhook deliveries. Error: ", 0)
+	} else {
+		// The payloads contain the meta data of the objects, only the deliveries of the objects the user can access are returned
+		accessible := make([]common.WebhookDelivery, 0, len(deliveries))
+		for _, delivery := range deliveries {
+			if code, _ := canUserAccessObject(request, orgID, delivery.ObjectType, delivery.ObjectID); code != security.AuthFailed {
+				accessible = append(accessible, delivery)
+			}
+		}
+		deliveries = accessible
+		if len(deliveries) == 0 {
+			writer.WriteHeader(http.StatusNotFound)
+		} else {
+			if data, err := json.MarshalIndent(deliveries, "", "  "); err != nil {
+				communications.SendErrorResponse(writer, err, "Failed to marshal the list of webhook deliveries. Error: ", 0)
+			} else {
+				writer.Header().Add(contentType, applicationJSON)
+				writer.WriteHeader(http.StatusOK)
+				if _, err := writer.Write(data); err != nil && log.IsLogging(logger.ERROR) {
+					log.Error("Failed to write response body, error: " + err.Error())
+				}
+			}
+		}
+	}
+}
+
+// swagger:operation GET /api/v1/audit/{orgID} handleAuditLog
+//
+// List the entries of the audit log.
+//
+// Provides a list of the calls to the mutating APIs of the sync service with the calling user, the organization,
+// operation and target of the call, the status code of its response, and its time. The entries are sorted by time.
+// Org admins can list the entries of their organization, and sync admins can list the entries of any organization.
+// On a CSS a sync admin can omit the orgID to list the entries of all the organizations.
+//
+// ---
+//
+// produces:
+// - application/json
+// - text/plain
+//
+// parameters:
+// - name: orgID
+//   in: path
+//   description: The orgID of the entries. Present only when working with a CSS, removed from the path when working with an ESS
+//   required: true
+//   type: string
+// - name: from
+//   in: query
+//   description: Only entries at or after this time (RFC3339) are returned
+//   required: false
+//   type: string
+// - name: to
+//   in: query
+//   description: Only entries before this time (RFC3339) are returned
+//   required: false
+//   type: string
+//
+// responses:
+//   '200':
+//     description: Audit log response
+//     schema:
+//       type: array
+//       items:
+//         "$ref": "#/definitions/AuditEntry"
+//   '400':
+//     description: Invalid time range
+//     schema:
+//       type: string
+//   '404':
+//     description: No audit log entries found
+//     schema:
+//       type: string
+//   '500':
+//     description: Failed to retrieve the audit log entries
+//     schema:
+//       type: string
+func handleAuditLog(writer http.ResponseWriter, request *http.Request) {
+	if !common.Running {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	code, userOrg, _ := security.Authenticate(request)
+	if code != security.AuthAdmin && code != security.AuthSyncAdmin {
+		writer.WriteHeader(http.StatusForbidden)
+		writer.Write(unauthorizedBytes)
+		return
+	}
+
+	if request.Method != http.MethodGet {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var orgID string
+	if common.Configuration.NodeType == common.CSS {
+		orgID = strings.TrimSuffix(request.URL.Path, "/")
+		if strings.Contains(orgID, "/") {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	} else {
+		orgID = common.Configuration.OrgID
+	}
+
+	if code != security.AuthSyncAdmin && (userOrg != orgID || orgID == "") {
+		writer.WriteHeader(http.StatusForbidden)
+		writer.Write(unauthorizedBytes)
+		return
+	}
+
+	var from, to time.Time
+	for name, value := range map[string]*time.Time{"from": &from, "to": &to} {
+		if param := request.URL.Query().Get(name); param != "" {
+			var err error
+			if *value, err = time.Parse(time.RFC3339, param); err != nil {
+				communications.SendErrorResponse(writer, nil, fmt.Sprintf("Invalid %s time %s", name, param), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In handleAuditLog. List the audit log of %s\n", orgID)
+	}
+	if entries, err := ListAuditEntries(orgID, from, to); err != nil {
+		communications.SendErrorResponse(writer, err, "Failed to fetch the audit log. Error: ", 0)
+	} else {
+		if len(entries) == 0 {
+			writer.WriteHeader(http.StatusNotFound)
+		} else {
+			if data, err := json.MarshalIndent(entries, "", "  "); err != nil {
+				communications.SendErrorResponse(writer, err, "Failed to marshal the audit log. Error: ", 0)
+			} else {
+				writer.Header().Add(contentType, applicationJSON)
+				writer.WriteHeader(http.StatusOK)
+				if _, err := writer.Write(data); err != nil && log.IsLogging(logger.ERROR) {
+					log.Error("Failed to write response body, error: " + err.Error())
+				}
+			}
+		}
+	}
+}
+
+// swagger:operation POST /api/v1/resend handleResend
+//
+// Request to resend objects.
+//
+// Used by an ESS to ask the CSS to resend it all the objects (supported only for ESS to CSS requests).
+// An application only needs to use this API in case the data it previously obtained from the ESS was lost.
+//
+// ---
+//
+// produces:
+// - text/plain
+//
+// responses:
+//   '204':
+//     description: The request will be sent
+//     schema:
+//       type: string
+//   '400':
+//     description: The request is not allowed on Cloud Sync-Service
+//     schema:
+//       type: string
+func handleResend(writer http.ResponseWriter, request *http.Request) {
+	if !common.Running {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	code, _, _ := security.Authenticate(request)
+	if code != security.AuthAdmin && code != security.AuthUser && code != security.AuthSyncAdmin {
+		writer.WriteHeader(http.StatusForbidden)
+		writer.Write(unauthorizedBytes)
+		return
+	}
+
+	if request.Method == http.MethodPost {
+		if trace.IsLogging(logger.DEBUG) {
+			trace.Debug("In handleResend\n")
+		}
+		if err := ResendObjects(); err != nil {
+			communications.SendErrorResponse(writer, err, "Failed to send resend objects request. Error: ", 0)
+		} else {
+			writer.WriteHeader(http.StatusNoContent)
+		}
+	} else {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func handleShutdown(writer http.ResponseWriter, request *http.Request) {
+	code, _, _ := security.Authenticate(request)
+	if code != security.AuthSyncAdmin {
+		writer.WriteHeader(http.StatusForbidden)
+		writer.Write(unauthorizedBytes)
+		return
+	}
+
+	if request.Method == http.MethodPost {
+		writer.WriteHeader(http.StatusNoContent)
+
+		restart := strings.ToLower(request.URL.Query().Get("restart"))
+		quiesceString := request.URL.Query().Get("quiesce")
+
+		go func() {
+			timer := time.NewTimer(time.Duration(1) * time.Second)
+			<-timer.C
+
+			quieceTime := 3
+			if len(quiesceString) != 0 {
+				var quieceTemp int
+				_, err := fmt.Sscanf(quiesceString, "%d", &quieceTemp)
+				if err == nil {
+					quieceTime = quieceTemp
+				}
+			}
+
+			if restart == "true" || restart == "yes" {
+				// If BlockUntilShutdown was called, don't let Stop() unblock
+				blocking := waitingOnBlockChannel
+				waitingOnBlockChannel = false
+				Stop(quieceTime)
+
+				if log.IsLogging(logger.INFO) {
+					log.Info("Restarting the Sync Service")
+				}
+				Start("", false)
+				waitingOnBlockChannel = blocking
+			} else {
+				Stop(quieceTime)
+			}
+		}()
+	} else {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func handleObjects(writer http.ResponseWriter, request *http.Request) {
+	if !common.Running {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	if len(request.URL.Path) != 0 {
+		parts := strings.Split(request.URL.Path, "/")
+		var orgID string
+		if common.Configuration.NodeType == common.CSS {
+			orgID = parts[0]
+			parts = parts[1:]
+		} else {
+			orgID = common.Configuration.OrgID
+		}
+
+		if len(parts) == 0 {
+			// GET     /api/v1/objects/orgID?destination_policy=true
+			// POST    /api/v1/objects/orgID
+			if request.Method == http.MethodPost {
+				handleObjectsBatch(orgID, writer, request)
+				return
+			}
+			if request.Method != http.MethodGet {
+				writer.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			destPolicyString := request.URL.Query().Get("destination_policy")
+			destPolicy := false
+			if destPolicyString != "" {
+				var err error
+				destPolicy, err = strconv.ParseBool(destPolicyString)
+				if err == nil && destPolicy {
+					handleListObjectsWithDestinationPolicy(orgID, writer, request)
+					return
+				}
+			}
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		} else if len(parts) == 1 || (len(parts) == 2 && len(parts[1]) == 0) {
+			// /api/v1/objects/orgID/type
+			// GET - get updated objects
+			// PUT - register/delete a webhook, or activate the objects selected by their labels
+			// DELETE - delete the objects selected by their labels
+			switch request.Method {
+			case http.MethodGet:
+				if strings.Contains(request.Header.Get("Accept"), textEventStream) {
+					handleStreamUpdatedObjects(orgID, parts[0], writer, request)
+					return
+				}
+
+				allObjectsString := request.URL.Query().Get("all_objects")
+				allObjects := false
+				if allObjectsString != "" {
+					var err error
+					allObjects, err = strconv.ParseBool(allObjectsString)
+					if err != nil {
+						writer.WriteHeader(http.StatusBadRequest)
+						return
+					}
+				}
 				if allObjects {
 					handleListAllObjects(orgID, parts[0], writer, request)
 				} else {
@@ -423,7 +1103,13 @@ func handleObjects(writer http.ResponseWriter, request *http.Request) {
 					handleListUpdatedObjects(orgID, parts[0], received, writer, request)
 				}
 			case http.MethodPut:
-				handleWebhook(orgID, parts[0], writer, request)
+				if request.URL.Query().Get("activate") != "" {
+					handleLabeledObjects(orgID, parts[0], writer, request)
+				} else {
+					handleWebhook(orgID, parts[0], writer, request)
+				}
+			case http.MethodDelete:
+				handleLabeledObjects(orgID, parts[0], writer, request)
 			default:
 				writer.WriteHeader(http.StatusMethodNotAllowed)
 			}
@@ -440,12 +1126,18 @@ func handleObjects(writer http.ResponseWriter, request *http.Request) {
 			// GET     /api/v1/objects/orgID/type/id/status
 			// GET/PUT /api/v1/objects/orgID/type/id/data
 			// GET/PUT /api/v1/objects/orgID/type/id/destinations
+			// GET/PUT /api/v1/objects/orgID/type/id/rollout
+			// GET     /api/v1/objects/orgID/type/id/versions
+			// PUT     /api/v1/objects/orgID/type/id/rollback
 			operation := strings.ToLower(parts[2])
 			handleObjectOperation(operation, orgID, parts[0], parts[1], writer, request)
 
 		} else {
 			writer.WriteHeader(http.StatusBadRequest)
 		}
+	} else if common.Configuration.NodeType == common.ESS && request.Method == http.MethodPost {
+		// POST    /api/v1/objects/
+		handleObjectsBatch(common.Configuration.OrgID, writer, request)
 	} else {
 		writer.WriteHeader(http.StatusBadRequest)
 	}
@@ -606,6 +1298,12 @@ func handleObjectOperation(operation string, orgID string, objectType string, ob
 		handleObjectStatus(orgID, objectType, objectID, writer, request)
 	case "destinations":
 		handleObjectDestinations(orgID, objectType, objectID, writer, request)
+	case "rollout":
+		handleObjectRollout(orgID, objectType, objectID, writer, request)
+	case "versions":
+		handleObjectVersions(orgID, objectType, objectID, writer, request)
+	case "rollback":
+		handleObjectRollback(orgID, objectType, objectID, writer, request)
 	case "data":
 		switch request.Method {
 		case http.MethodGet:
@@ -1078,22 +1776,306 @@ func handleObjectDestinations(orgID string, objectType string, objectID string,
 		if trace.IsLogging(logger.DEBUG) {
 			trace.Debug("In handleObjects. Set destinations of %s %s\n", objectType, objectID)
 		}
-		var destinationsList []string
-		err := json.NewDecoder(request.Body).Decode(&destinationsList)
-		if err == nil {
-			if err := UpdateObjectDestinations(orgID, objectType, objectID, destinationsList); err == nil {
-				writer.WriteHeader(http.StatusNoContent)
-			} else {
-				communications.SendErrorResponse(writer, err, "", 0)
-			}
+		var destinationsList []string
+		err := json.NewDecoder(request.Body).Decode(&destinationsList)
+		if err == nil {
+			if err := UpdateObjectDestinations(orgID, objectType, objectID, destinationsList); err == nil {
+				writer.WriteHeader(http.StatusNoContent)
+			} else {
+				communications.SendErrorResponse(writer, err, "", 0)
+			}
+		} else {
+			communications.SendErrorResponse(writer, err, "Invalid JSON for update. Error: ", http.StatusBadRequest)
+		}
+	} else {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func handleObjectRollout(orgID string, objectType string, objectID string, writer http.ResponseWriter, request *http.Request) {
+	if request.Method == http.MethodGet {
+		// swagger:operation GET /api/v1/objects/{orgID}/{objectType}/{objectID}/rollout handleObjectRollout
+		//
+		// Get the rollout of an object.
+		//
+		// Get the state of the rollout of the object of the specified object type and object ID, with the progress of its waves.
+		// The status of a rollout is inProgress, paused (by the user or since the error rate exceeded the limit), or completed.
+		// This is a CSS only API.
+		//
+		// ---
+		//
+		// produces:
+		// - application/json
+		// - text/plain
+		//
+		// parameters:
+		// - name: orgID
+		//   in: path
+		//   description: The orgID of the object whose rollout will be retrieved
+		//   required: true
+		//   type: string
+		// - name: objectType
+		//   in: path
+		//   description: The object type of the object whose rollout will be retrieved
+		//   required: true
+		//   type: string
+		// - name: objectID
+		//   in: path
+		//   description: The object ID of the object whose rollout will be retrieved
+		//   required: true
+		//   type: string
+		//
+		// responses:
+		//   '200':
+		//     description: Object rollout
+		//     schema:
+		//       "$ref": "#/definitions/RolloutReport"
+		//   '404':
+		//     description: The object has no rollout, or the rollout of its current instance hasn't started
+		//     schema:
+		//       type: string
+		//   '500':
+		//     description: Failed to retrieve the object's rollout
+		//     schema:
+		//       type: string
+		if trace.IsLogging(logger.DEBUG) {
+			trace.Debug("In handleObjects. Get rollout of %s %s\n", objectType, objectID)
+		}
+		if rollout, err := GetObjectRollout(orgID, objectType, objectID); err != nil {
+			communications.SendErrorResponse(writer, err, "", 0)
+		} else if rollout == nil {
+			writer.WriteHeader(http.StatusNotFound)
+		} else if data, err := json.MarshalIndent(rollout, "", "  "); err != nil {
+			communications.SendErrorResponse(writer, err, "Failed to marshal object's rollout. Error: ", 0)
+		} else {
+			writer.Header().Add(contentType, applicationJSON)
+			writer.WriteHeader(http.StatusOK)
+			if _, err := writer.Write(data); err != nil && log.IsLogging(logger.ERROR) {
+				log.Error("Failed to write response body, error: " + err.Error())
+			}
+		}
+	} else if request.Method == http.MethodPut {
+		// swagger:operation PUT /api/v1/objects/{orgID}/{objectType}/{objectID}/rollout handleObjectRolloutUpdate
+		//
+		// Pause or resume the rollout of an object.
+		//
+		// Pause or resume the rollout of the object of the specified object type and object ID.
+		// A paused rollout doesn't start more waves. The errors reported by the destinations of the waves
+		// that were started before the rollout was resumed don't pause it again.
+		// This is a CSS only API.
+		//
+		// ---
+		//
+		// consumes:
+		// - application/json
+		//
+		// produces:
+		// - text/plain
+		//
+		// parameters:
+		// - name: orgID
+		//   in: path
+		//   description: The orgID of the object whose rollout will be updated
+		//   required: true
+		//   type: string
+		// - name: objectType
+		//   in: path
+		//   description: The object type of the object whose rollout will be updated
+		//   required: true
+		//   type: string
+		// - name: objectID
+		//   in: path
+		//   description: The object ID of the object whose rollout will be updated
+		//   required: true
+		//   type: string
+		// - name: payload
+		//   in: body
+		//   description: The action
+		//   required: true
+		//   schema:
+		//     "$ref": "#/definitions/rolloutUpdate"
+		//
+		// responses:
+		//   '204':
+		//     description: Object rollout updated
+		//     schema:
+		//       type: string
+		//   '400':
+		//     description: Invalid action, or the object has no rollout in progress
+		//     schema:
+		//       type: string
+		//   '500':
+		//     description: Failed to update the object's rollout
+		//     schema:
+		//       type: string
+		if trace.IsLogging(logger.DEBUG) {
+			trace.Debug("In handleObjects. Update rollout of %s %s\n", objectType, objectID)
+		}
+		var payload rolloutUpdate
+		if err := json.NewDecoder(request.Body).Decode(&payload); err != nil {
+			communications.SendErrorResponse(writer, err, "Invalid JSON for update. Error: ", http.StatusBadRequest)
+			return
+		}
+		if payload.Action != "pause" && payload.Action != "resume" {
+			communications.SendErrorResponse(writer, nil, "Invalid action "+payload.Action, http.StatusBadRequest)
+			return
+		}
+		if err := UpdateObjectRollout(orgID, objectType, objectID, payload.Action == "pause"); err != nil {
+			communications.SendErrorResponse(writer, err, "", 0)
 		} else {
-			communications.SendErrorResponse(writer, err, "Invalid JSON for update. Error: ", http.StatusBadRequest)
+			writer.WriteHeader(http.StatusNoContent)
 		}
 	} else {
 		writer.WriteHeader(http.StatusMethodNotAllowed)
 	}
 }
 
+func handleObjectVersions(orgID string, objectType string, objectID string, writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	// swagger:operation GET /api/v1/objects/{orgID}/{objectType}/{objectID}/versions handleObjectVersions
+	//
+	// Get the previous versions of an object.
+	//
+	// Get the previous versions of the object of the specified object type and object ID, from the newest to the oldest.
+	// The number of versions kept for each object is set by the MaxObjectVersions and MaxObjectVersionsByObjectType configuration properties.
+	//
+	// ---
+	//
+	// produces:
+	// - application/json
+	// - text/plain
+	//
+	// parameters:
+	// - name: orgID
+	//   in: path
+	//   description: The orgID of the object whose versions will be retrieved. Present only when working with a CSS, removed from the path when working with an ESS
+	//   required: true
+	//   type: string
+	// - name: objectType
+	//   in: path
+	//   description: The object type of the object whose versions will be retrieved
+	//   required: true
+	//   type: string
+	// - name: objectID
+	//   in: path
+	//   description: The object ID of the object whose versions will be retrieved
+	//   required: true
+	//   type: string
+	//
+	// responses:
+	//   '200':
+	//     description: Object versions
+	//     schema:
+	//       type: array
+	//       items:
+	//         "$ref": "#/definitions/ObjectVersion"
+	//   '404':
+	//     description: The object was not found
+	//     schema:
+	//       type: string
+	//   '500':
+	//     description: Failed to retrieve the object's versions
+	//     schema:
+	//       type: string
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In handleObjects. Get versions of %s %s\n", objectType, objectID)
+	}
+	if versions, err := GetObjectVersions(orgID, objectType, objectID); err != nil {
+		communications.SendErrorResponse(writer, err, "", 0)
+	} else if versions == nil {
+		writer.WriteHeader(http.StatusNotFound)
+	} else if data, err := json.MarshalIndent(versions, "", "  "); err != nil {
+		communications.SendErrorResponse(writer, err, "Failed to marshal object's versions. Error: ", 0)
+	} else {
+		writer.Header().Add(contentType, applicationJSON)
+		writer.WriteHeader(http.StatusOK)
+		if _, err := writer.Write(data); err != nil && log.IsLogging(logger.ERROR) {
+			log.Error("Failed to write response body, error: " + err.Error())
+		}
+	}
+}
+
+func handleObjectRollback(orgID string, objectType string, objectID string, writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPut {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	// swagger:operation PUT /api/v1/objects/{orgID}/{objectType}/{objectID}/rollback handleObjectRollback
+	//
+	// Roll back an object to a previous version.
+	//
+	// Replace the object of the specified object type and object ID with a previous version of the object.
+	// The meta data and data of the version are published as a new instance of the object to all of the object's destinations.
+	// The replaced version is kept in the object's version history.
+	//
+	// ---
+	//
+	// consumes:
+	// - application/json
+	//
+	// produces:
+	// - text/plain
+	//
+	// parameters:
+	// - name: orgID
+	//   in: path
+	//   description: The orgID of the object to roll back. Present only when working with a CSS, removed from the path when working with an ESS
+	//   required: true
+	//   type: string
+	// - name: objectType
+	//   in: path
+	//   description: The object type of the object to roll back
+	//   required: true
+	//   type: string
+	// - name: objectID
+	//   in: path
+	//   description: The object ID of the object to roll back
+	//   required: true
+	//   type: string
+	// - name: payload
+	//   in: body
+	//   description: The version to roll back to
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/objectRollback"
+	//
+	// responses:
+	//   '204':
+	//     description: Object rolled back
+	//     schema:
+	//       type: string
+	//   '400':
+	//     description: Invalid payload, or the version can't be published
+	//     schema:
+	//       type: string
+	//   '404':
+	//     description: The object or the version was not found
+	//     schema:
+	//       type: string
+	//   '500':
+	//     description: Failed to roll back the object
+	//     schema:
+	//       type: string
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In handleObjects. Roll back %s %s\n", objectType, objectID)
+	}
+	var payload objectRollback
+	if err := json.NewDecoder(request.Body).Decode(&payload); err != nil {
+		communications.SendErrorResponse(writer, err, "Invalid JSON for rollback. Error: ", http.StatusBadRequest)
+		return
+	}
+	if found, err := RollbackObject(orgID, objectType, objectID, payload.Version); err != nil {
+		communications.SendErrorResponse(writer, err, "", 0)
+	} else if !found {
+		writer.WriteHeader(http.StatusNotFound)
+	} else {
+		writer.WriteHeader(http.StatusNoContent)
+	}
+}
+
 // swagger:operation GET /api/v1/objects/{orgID}/{objectType}/{objectID}/data handleObjectGetData
 //
 // Get the data of an object.
@@ -1228,7 +2210,7 @@ func handleObjectPutData(orgID string, objectType string, objectID string, write
 // Get objects of the specified type.
 //
 // Get objects of the specified object type. Either get all of the objects or just those objects that have pending (unconsumed) updates.
-// An application would typically invoke the latter API periodically to check for updates (an alternative is to use a webhook).
+// An application would typically invoke the latter API periodically to check for updates (an alternative is to use a webhook or to stream the updates).
 //
 // ---
 //
@@ -1252,14 +2234,69 @@ func handleObjectPutData(orgID string, objectType string, objectID string, write
 //   description: When returning updated objects only, whether or not to include the objects that have been marked as received by the application
 //   required: false
 //   type: boolean
+// - name: type_prefix
+//   in: query
+//   description: Return only the objects whose type starts with the prefix
+//   required: false
+//   type: string
+// - name: version
+//   in: query
+//   description: Return only the objects with the version
+//   required: false
+//   type: string
+// - name: inactive
+//   in: query
+//   description: Return only the inactive (true) or active (false) objects
+//   required: false
+//   type: boolean
+// - name: deleted
+//   in: query
+//   description: Return only the deleted (true) or not deleted (false) objects
+//   required: false
+//   type: boolean
+// - name: updated_since
+//   in: query
+//   description: Return only the objects that were updated after the update with the instance ID (the objects whose instance ID is greater)
+//   required: false
+//   type: integer
+//   format: int64
+// - name: destination_type
+//   in: query
+//   description: Return only the objects that are sent to destinations of the type
+//   required: false
+//   type: string
+// - name: labels
+//   in: query
+//   description: Return only the objects whose labels satisfy the label selector, a comma separated list of requirements (key=value, key!=value, key, or !key), e.g., env=prod,tier!=canary
+//   required: false
+//   type: string
+// - name: limit
+//   in: query
+//   description: The maximal number of objects to return. The objects are sorted by type and ID, and if there are more objects
+//        the cursor of the next page is returned in the X-Sync-Service-Next-Cursor header
+//   required: false
+//   type: integer
+// - name: cursor
+//   in: query
+//   description: The cursor of the page to return, as returned in the X-Sync-Service-Next-Cursor header of the previous page
+//   required: false
+//   type: string
 //
 // responses:
 //   '200':
 //     description: Updated objects response
+//     headers:
+//       X-Sync-Service-Next-Cursor:
+//         description: The cursor of the next page, if there are more objects
+//         type: string
 //     schema:
 //       type: array
 //       items:
 //         "$ref": "#/definitions/MetaData"
+//   '400':
+//     description: Invalid filter or page parameters
+//     schema:
+//       type: string
 //   '404':
 //     description: No updated objects found
 //     schema:
@@ -1280,9 +2317,21 @@ func handleListUpdatedObjects(orgID string, objectType string, received bool, wr
 		writer.Write(unauthorizedBytes)
 		return
 	}
-	if metaData, err := ListUpdatedObjects(orgID, objectType, received); err != nil {
+	filter, limit, err := parseObjectsFilter(request)
+	if err != nil {
+		communications.SendErrorResponse(writer, err, "", 0)
+		return
+	}
+	if metaData, err := ListUpdatedObjects(orgID, objectType, received, filter); err != nil {
 		communications.SendErrorResponse(writer, err, "Failed to fetch the list of updates. Error: ", 0)
 	} else {
+		nextPage := false
+		if limit > 0 && len(metaData) > limit {
+			metaData = metaData[:limit]
+			setNextCursor(writer, metaData[limit-1].ObjectType, metaData[limit-1].ObjectID)
+			nextPage = true
+		}
+
 		var result []common.MetaData
 		if common.Configuration.NodeType == common.CSS || code != security.AuthService {
 			result = metaData
@@ -1295,7 +2344,7 @@ func handleListUpdatedObjects(orgID string, objectType string, received bool, wr
 			}
 		}
 
-		if len(result) == 0 {
+		if len(result) == 0 && !nextPage {
 			writer.WriteHeader(http.StatusNotFound)
 		} else {
 			if data, err := json.MarshalIndent(result, "", "  "); err != nil {
@@ -1311,6 +2360,149 @@ func handleListUpdatedObjects(orgID string, objectType string, received bool, wr
 	}
 }
 
+// swagger:operation GET /api/v1/objects/{orgID}/{objectType} handleStreamUpdatedObjects
+//
+// Stream the updates of objects of the specified type.
+//
+// Stream the updates of objects of the specified object type as Server-Sent Events, when the request's Accept header
+// is text/event-stream. An update event is sent when an object is received, at the same time as the webhooks are called.
+// The data of the event is the object's metadata, and its ID is a cursor. A client that reconnects with the cursor of
+// the last event it received, in the Last-Event-ID header or the cursor query parameter, receives the updates it missed.
+// When the stream is opened without a cursor, or the updates after the cursor are no longer available,
+// the objects that have pending (unconsumed) updates are sent first.
+// The updates are streamed by the node that receives them: when several CSS instances share the storage, a stream gets
+// only the updates of the objects received by the instance it is connected to, and the cursors are valid only for that
+// instance until it restarts.
+//
+// ---
+//
+// produces:
+// - text/event-stream
+// - text/plain
+//
+// parameters:
+// - name: orgID
+//   in: path
+//   description: The orgID of the objects to stream. Present only when working with a CSS, removed from the path when working with an ESS
+//   required: true
+//   type: string
+// - name: objectType
+//   in: path
+//   description: The object type of the objects to stream
+//   required: true
+//   type: string
+// - name: Last-Event-ID
+//   in: header
+//   description: The cursor of the last update received by the client
+//   required: false
+//   type: string
+// - name: cursor
+//   in: query
+//   description: The cursor of the last update received by the client, used if the Last-Event-ID header is not provided
+//   required: false
+//   type: string
+//
+// responses:
+//   '200':
+//     description: Stream of updated objects
+//     schema:
+//       "$ref": "#/definitions/MetaData"
+//   '500':
+//     description: Failed to retrieve the updated objects
+//     schema:
+//       type: string
+func handleStreamUpdatedObjects(orgID string, objectType string, writer http.ResponseWriter, request *http.Request) {
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In handleStreamUpdatedObjects. Method %s, orgID %s, objectType %s\n",
+			request.Method, orgID, objectType)
+	}
+	code, userID := canUserAccessObject(request, orgID, objectType, "")
+	if code == security.AuthFailed {
+		writer.WriteHeader(http.StatusForbidden)
+		writer.Write(unauthorizedBytes)
+		return
+	}
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		communications.SendErrorResponse(writer, &common.InvalidRequest{Message: "Streaming is not supported"}, "", 0)
+		return
+	}
+	canAccess := func(metaData common.MetaData) bool {
+		return common.Configuration.NodeType == common.CSS || code != security.AuthService ||
+			canServiceAccessObject(userID, metaData.DestinationPolicy)
+	}
+
+	cursor := request.Header.Get("Last-Event-ID")
+	if cursor == "" {
+		cursor = request.URL.Query().Get("cursor")
+	}
+	stream, missedUpdates, currentCursor, resumed := communications.OpenObjectUpdatesStream(orgID, objectType, cursor)
+	defer communications.CloseObjectUpdatesStream(stream)
+
+	if !resumed {
+		// The updates streamed from now on are after the current cursor
+		metaData, err := ListUpdatedObjects(orgID, objectType, false, common.ObjectsFilter{})
+		if err != nil {
+			communications.SendErrorResponse(writer, err, "Failed to fetch the list of updates. Error: ", 0)
+			return
+		}
+		for _, object := range metaData {
+			missedUpdates = append(missedUpdates, communications.ObjectUpdate{Cursor: currentCursor, MetaData: object})
+		}
+	}
+
+	writer.Header().Add(contentType, textEventStream)
+	writer.Header().Add("Cache-Control", "no-cache")
+	writer.WriteHeader(http.StatusOK)
+	for _, update := range missedUpdates {
+		if canAccess(update.MetaData) && !writeObjectUpdateEvent(writer, update) {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAliveTicker := time.NewTicker(streamKeepAliveInterval)
+	defer keepAliveTicker.Stop()
+	for {
+		select {
+		case update, ok := <-stream.Updates:
+			if !ok {
+				return
+			}
+			if !canAccess(update.MetaData) {
+				continue
+			}
+			if !writeObjectUpdateEvent(writer, update) {
+				return
+			}
+		case <-keepAliveTicker.C:
+			if _, err := writer.Write([]byte(": keep-alive\n\n")); err != nil {
+				return
+			}
+		case <-request.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func writeObjectUpdateEvent(writer http.ResponseWriter, update communications.ObjectUpdate) bool {
+	data, err := json.Marshal(update.MetaData)
+	if err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Failed to marshal the updated object, error: " + err.Error())
+		}
+		return true
+	}
+	if _, err := fmt.Fprintf(writer, "id: %s\nevent: update\ndata: %s\n\n", update.Cursor, data); err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Failed to write response body, error: " + err.Error())
+		}
+		return false
+	}
+	return true
+}
+
 // swagger:operation GET /api/v1/objects/{orgID}/{objectType}?all_objects=true handleListAllObjects
 //
 // Get objects with a destination policy of the specified type.
@@ -1329,24 +2521,79 @@ func handleListUpdatedObjects(orgID string, objectType string, received bool, wr
 //   description: The orgID of the objects to return. Present only when working with a CSS, removed from the path when working with an ESS
 //   required: true
 //   type: string
-// - name: objectType
-//   in: path
-//   description: The object type of the objects to return
-//   required: true
+// - name: objectType
+//   in: path
+//   description: The object type of the objects to return
+//   required: true
+//   type: string
+// - name: all_objects
+//   in: query
+//   description: Whether or not to include all objects. If false only updated objects will be returned.
+//   required: true
+//   type: boolean
+// - name: type_prefix
+//   in: query
+//   description: Return only the objects whose type starts with the prefix
+//   required: false
+//   type: string
+// - name: version
+//   in: query
+//   description: Return only the objects with the version
+//   required: false
+//   type: string
+// - name: inactive
+//   in: query
+//   description: Return only the inactive (true) or active (false) objects
+//   required: false
+//   type: boolean
+// - name: deleted
+//   in: query
+//   description: Return only the deleted (true) or not deleted (false) objects
+//   required: false
+//   type: boolean
+// - name: updated_since
+//   in: query
+//   description: Return only the objects that were updated after the update with the instance ID (the objects whose instance ID is greater)
+//   required: false
+//   type: integer
+//   format: int64
+// - name: destination_type
+//   in: query
+//   description: Return only the objects that are sent to destinations of the type
+//   required: false
+//   type: string
+// - name: labels
+//   in: query
+//   description: Return only the objects whose labels satisfy the label selector, a comma separated list of requirements (key=value, key!=value, key, or !key), e.g., env=prod,tier!=canary
+//   required: false
 //   type: string
-// - name: all_objects
+// - name: limit
 //   in: query
-//   description: Whether or not to include all objects. If false only updated objects will be returned.
-//   required: true
-//   type: boolean
+//   description: The maximal number of objects to return. The objects are sorted by type and ID, and if there are more objects
+//        the cursor of the next page is returned in the X-Sync-Service-Next-Cursor header
+//   required: false
+//   type: integer
+// - name: cursor
+//   in: query
+//   description: The cursor of the page to return, as returned in the X-Sync-Service-Next-Cursor header of the previous page
+//   required: false
+//   type: string
 //
 // responses:
 //   '200':
 //     description: Objects with a destination policy response
+//     headers:
+//       X-Sync-Service-Next-Cursor:
+//         description: The cursor of the next page, if there are more objects
+//         type: string
 //     schema:
 //       type: array
 //       items:
 //         "$ref": "#/definitions/ObjectDestinationPolicy"
+//   '400':
+//     description: Invalid filter or page parameters
+//     schema:
+//       type: string
 //   '404':
 //     description: No objects with a destination policy found
 //     schema:
@@ -1366,9 +2613,21 @@ func handleListAllObjects(orgID string, objectType string, writer http.ResponseW
 		writer.Write(unauthorizedBytes)
 		return
 	}
-	if objects, err := ListAllObjects(orgID, objectType); err != nil {
+	filter, limit, err := parseObjectsFilter(request)
+	if err != nil {
+		communications.SendErrorResponse(writer, err, "", 0)
+		return
+	}
+	if objects, err := ListAllObjects(orgID, objectType, filter); err != nil {
 		communications.SendErrorResponse(writer, err, "Failed to fetch the list of objects. Error: ", 0)
 	} else {
+		nextPage := false
+		if limit > 0 && len(objects) > limit {
+			objects = objects[:limit]
+			setNextCursor(writer, objects[limit-1].ObjectType, objects[limit-1].ObjectID)
+			nextPage = true
+		}
+
 		var result []common.ObjectDestinationPolicy
 		if common.Configuration.NodeType == common.CSS || code != security.AuthService {
 			result = objects
@@ -1381,7 +2640,7 @@ func handleListAllObjects(orgID string, objectType string, writer http.ResponseW
 			}
 		}
 
-		if len(result) == 0 {
+		if len(result) == 0 && !nextPage {
 			writer.WriteHeader(http.StatusNotFound)
 		} else {
 			if data, err := json.MarshalIndent(result, "", "  "); err != nil {
@@ -1403,6 +2662,7 @@ func handleListAllObjects(orgID string, objectType string, writer http.ResponseW
 //
 // Get the list of objects that have destination policies.
 // An application would typically invoke this API periodically to check for updates.
+// The filter and page parameters can't be combined with the service and since parameters.
 //
 // ---
 //
@@ -1438,14 +2698,69 @@ func handleListAllObjects(orgID string, objectType string, writer http.ResponseW
 //   required: false
 //   type: integer
 //   format: int64
+// - name: type_prefix
+//   in: query
+//   description: Return only the objects whose type starts with the prefix
+//   required: false
+//   type: string
+// - name: version
+//   in: query
+//   description: Return only the objects with the version
+//   required: false
+//   type: string
+// - name: inactive
+//   in: query
+//   description: Return only the inactive (true) or active (false) objects
+//   required: false
+//   type: boolean
+// - name: deleted
+//   in: query
+//   description: Return only the deleted (true) or not deleted (false) objects
+//   required: false
+//   type: boolean
+// - name: updated_since
+//   in: query
+//   description: Return only the objects that were updated after the update with the instance ID (the objects whose instance ID is greater)
+//   required: false
+//   type: integer
+//   format: int64
+// - name: destination_type
+//   in: query
+//   description: Return only the objects that are sent to destinations of the type
+//   required: false
+//   type: string
+// - name: labels
+//   in: query
+//   description: Return only the objects whose labels satisfy the label selector, a comma separated list of requirements (key=value, key!=value, key, or !key), e.g., env=prod,tier!=canary
+//   required: false
+//   type: string
+// - name: limit
+//   in: query
+//   description: The maximal number of objects to return. The objects are sorted by type and ID, and if there are more objects
+//        the cursor of the next page is returned in the X-Sync-Service-Next-Cursor header
+//   required: false
+//   type: integer
+// - name: cursor
+//   in: query
+//   description: The cursor of the page to return, as returned in the X-Sync-Service-Next-Cursor header of the previous page
+//   required: false
+//   type: string
 //
 // responses:
 //   '200':
 //     description: Object destination policy response
+//     headers:
+//       X-Sync-Service-Next-Cursor:
+//         description: The cursor of the next page, if there are more objects
+//         type: string
 //     schema:
 //       type: array
 //       items:
 //         "$ref": "#/definitions/ObjectDestinationPolicy"
+//   '400':
+//     description: Invalid parameters
+//     schema:
+//       type: string
 //   '404':
 //     description: No updated objects found
 //     schema:
@@ -1498,8 +2813,17 @@ func handleListObjectsWithDestinationPolicy(orgID string, writer http.ResponseWr
 		}
 	}
 
+	filter, limit, err := parseObjectsFilter(request)
+	if err != nil {
+		communications.SendErrorResponse(writer, err, "", 0)
+		return
+	}
+	if (since != 0 || serviceName != "") && !filter.IsEmpty() {
+		communications.SendErrorResponse(writer, &common.InvalidRequest{Message: "The filter and page parameters can't be combined with the service and since parameters"}, "", 0)
+		return
+	}
+
 	var objects []common.ObjectDestinationPolicy
-	var err error
 
 	if since != 0 {
 		if trace.IsLogging(logger.DEBUG) {
@@ -1512,7 +2836,7 @@ func handleListObjectsWithDestinationPolicy(orgID string, writer http.ResponseWr
 			trace.Debug("In handleObjects. List DestinationPolicy, orgID %s. Include received %t\n",
 				orgID, received)
 		}
-		objects, err = ListObjectsWithDestinationPolicy(orgID, received)
+		objects, err = ListObjectsWithDestinationPolicy(orgID, received, filter)
 	} else {
 		if trace.IsLogging(logger.DEBUG) {
 			trace.Debug("In handleObjects. List DestinationPolicy, orgID %s, service %s/%s/\n",
@@ -1524,6 +2848,10 @@ func handleListObjectsWithDestinationPolicy(orgID string, writer http.ResponseWr
 	if err != nil {
 		communications.SendErrorResponse(writer, err, "Failed to fetch the list of objects with a DestinationPolicy. Error: ", 0)
 	} else {
+		if limit > 0 && len(objects) > limit {
+			objects = objects[:limit]
+			setNextCursor(writer, objects[limit-1].ObjectType, objects[limit-1].ObjectID)
+		}
 		if len(objects) == 0 {
 			writer.WriteHeader(http.StatusNotFound)
 		} else {
@@ -1540,12 +2868,253 @@ func handleListObjectsWithDestinationPolicy(orgID string, writer http.ResponseWr
 	}
 }
 
+// swagger:operation DELETE /api/v1/objects/{orgID}/{objectType} handleDeleteLabeledObjects
+//
+// Delete the objects selected by their labels.
+//
+// Delete the objects of the specified object type whose labels satisfy the label selector.
+// The objects that can't be deleted, e.g., the objects received by an ESS, are skipped.
+//
+// ---
+//
+// produces:
+// - application/json
+// - text/plain
+//
+// parameters:
+// - name: orgID
+//   in: path
+//   description: The orgID of the objects to delete. Present only when working with a CSS, removed from the path when working with an ESS
+//   required: true
+//   type: string
+// - name: objectType
+//   in: path
+//   description: The object type of the objects to delete
+//   required: true
+//   type: string
+// - name: labels
+//   in: query
+//   description: The label selector of the objects, a comma separated list of requirements (key=value, key!=value, key, or !key), e.g., env=prod,tier!=canary
+//   required: true
+//   type: string
+//
+// responses:
+//   '200':
+//     description: The IDs of the deleted objects
+//     schema:
+//       type: array
+//       items:
+//         type: string
+//   '400':
+//     description: Missing or invalid label selector
+//     schema:
+//       type: string
+//   '500':
+//     description: Failed to delete the objects
+//     schema:
+//       type: string
+
+// swagger:operation PUT /api/v1/objects/{orgID}/{objectType}?activate=true handleActivateLabeledObjects
+//
+// Activate the objects selected by their labels.
+//
+// Activate the inactive objects of the specified object type whose labels satisfy the label selector.
+// The objects that can't be activated, e.g., the objects received by an ESS, are skipped.
+//
+// ---
+//
+// produces:
+// - application/json
+// - text/plain
+//
+// parameters:
+// - name: orgID
+//   in: path
+//   description: The orgID of the objects to activate. Present only when working with a CSS, removed from the path when working with an ESS
+//   required: true
+//   type: string
+// - name: objectType
+//   in: path
+//   description: The object type of the objects to activate
+//   required: true
+//   type: string
+// - name: activate
+//   in: query
+//   description: Must be true
+//   required: true
+//   type: boolean
+// - name: labels
+//   in: query
+//   description: The label selector of the objects, a comma separated list of requirements (key=value, key!=value, key, or !key), e.g., env=prod,tier!=canary
+//   required: true
+//   type: string
+//
+// responses:
+//   '200':
+//     description: The IDs of the activated objects
+//     schema:
+//       type: array
+//       items:
+//         type: string
+//   '400':
+//     description: Missing or invalid label selector
+//     schema:
+//       type: string
+//   '500':
+//     description: Failed to activate the objects
+//     schema:
+//       type: string
+func handleLabeledObjects(orgID string, objectType string, writer http.ResponseWriter, request *http.Request) {
+	code, _ := canUserAccessObject(request, orgID, objectType, "")
+	if code == security.AuthFailed || code == security.AuthService {
+		writer.WriteHeader(http.StatusForbidden)
+		writer.Write(unauthorizedBytes)
+		return
+	}
+
+	query := request.URL.Query()
+	selector, err := common.ParseLabelSelector(query.Get("labels"))
+	if err != nil {
+		communications.SendErrorResponse(writer, err, "", 0)
+		return
+	}
+
+	var ids []string
+	operation := "delete"
+	if request.Method == http.MethodPut {
+		operation = "activate"
+		if activate, err := strconv.ParseBool(query.Get("activate")); err != nil || !activate {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		ids, err = ActivateObjects(orgID, objectType, selector)
+	} else {
+		ids, err = DeleteObjects(orgID, objectType, selector)
+	}
+	if err != nil {
+		communications.SendErrorResponse(writer, err, fmt.Sprintf("Failed to %s the objects. Error: ", operation), 0)
+		return
+	}
+
+	if data, err := json.MarshalIndent(ids, "", "  "); err != nil {
+		communications.SendErrorResponse(writer, err, "Failed to marshal the list of objects. Error: ", 0)
+	} else {
+		writer.Header().Add(contentType, applicationJSON)
+		writer.WriteHeader(http.StatusOK)
+		if _, err := writer.Write(data); err != nil && log.IsLogging(logger.ERROR) {
+			log.Error("Failed to write response body, error: " + err.Error())
+		}
+	}
+}
+
+// swagger:operation POST /api/v1/objects/{orgID} handleObjectsBatch
+//
+// Apply a batch of operations on objects.
+//
+// Apply a batch of update, delete, and activate operations on objects in order, and return the result of each operation.
+// A delete or an activate operation can select the objects of an object type by a label selector instead of an object ID,
+// in which case it has a result for each of the selected objects.
+// If the batch is atomic, the operations are applied only if all of them are valid, and if applying an operation fails
+// nonetheless, the remaining operations are skipped and the objects are restored to their state before the batch.
+// The notifications of all the operations are sent after the operations are applied.
+//
+// ---
+//
+// consumes:
+// - application/json
+//
+// produces:
+// - application/json
+// - text/plain
+//
+// parameters:
+// - name: orgID
+//   in: path
+//   description: The orgID of the objects. Present only when working with a CSS, removed from the path when working with an ESS
+//   required: true
+//   type: string
+// - name: payload
+//   in: body
+//   description: The operations
+//   required: true
+//   schema:
+//     "$ref": "#/definitions/objectsBatch"
+//
+// responses:
+//   '200':
+//     description: The results of the operations
+//     schema:
+//       type: array
+//       items:
+//         "$ref": "#/definitions/ObjectOperationResult"
+//   '400':
+//     description: Invalid batch
+//     schema:
+//       type: string
+//   '403':
+//     description: The user isn't allowed to apply one of the operations
+//     schema:
+//       type: string
+//   '500':
+//     description: Failed to apply the operations
+//     schema:
+//       type: string
+func handleObjectsBatch(orgID string, writer http.ResponseWriter, request *http.Request) {
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In handleObjects. Batch of operations in %s\n", orgID)
+	}
+
+	var payload objectsBatch
+	if err := json.NewDecoder(request.Body).Decode(&payload); err != nil {
+		communications.SendErrorResponse(writer, err, "Invalid JSON for a batch of operations. Error: ", http.StatusBadRequest)
+		return
+	}
+
+	for _, operation := range payload.Operations {
+		if !canUserApplyObjectOperation(request, orgID, operation) {
+			writer.WriteHeader(http.StatusForbidden)
+			writer.Write(unauthorizedBytes)
+			return
+		}
+	}
+
+	results, err := ApplyObjectOperations(orgID, payload.Operations, payload.Atomic)
+	if err != nil {
+		communications.SendErrorResponse(writer, err, "Failed to apply the batch of operations. Error: ", 0)
+		return
+	}
+
+	if data, err := json.MarshalIndent(results, "", "  "); err != nil {
+		communications.SendErrorResponse(writer, err, "Failed to marshal the results of the operations. Error: ", 0)
+	} else {
+		writer.Header().Add(contentType, applicationJSON)
+		writer.WriteHeader(http.StatusOK)
+		if _, err := writer.Write(data); err != nil && log.IsLogging(logger.ERROR) {
+			log.Error("Failed to write response body, error: " + err.Error())
+		}
+	}
+}
+
+// canUserApplyObjectOperation checks that the user is allowed to apply an operation of a batch,
+// as if the operation was requested by its own API
+func canUserApplyObjectOperation(request *http.Request, orgID string, operation ObjectOperation) bool {
+	if operation.Operation == BatchUpdate && operation.Meta != nil {
+		return security.CanUserCreateObject(request, orgID, operation.Meta)
+	}
+	code, _ := canUserAccessObject(request, orgID, operation.ObjectType, operation.ObjectID)
+	if operation.ObjectID == "" {
+		return code != security.AuthFailed && code != security.AuthService
+	}
+	return code != security.AuthFailed
+}
+
 // swagger:operation PUT /api/v1/objects/{orgID}/{objectType} handleWebhook
 //
 // Register or delete a webhook.
 //
 // Register or delete a webhook for the specified object type.
-// A webhook is used to process notifications on updates for objects of the specified object type.
+// A webhook is used to process notifications on updates and other events for objects of the specified object type.
+// Failed deliveries to a webhook are retried with an exponential backoff, and are listed by /api/v1/webhooks.
 //
 // ---
 //
@@ -1607,7 +3176,7 @@ func handleWebhook(orgID string, objectType string, writer http.ResponseWriter,
 			if trace.IsLogging(logger.DEBUG) {
 				trace.Debug("In handleObjects. Register webhook %s\n", objectType)
 			}
-			hookErr = RegisterWebhook(orgID, objectType, payload.URL)
+			hookErr = RegisterWebhook(orgID, objectType, payload.URL, payload.Secret, payload.Events)
 		}
 		if hookErr == nil {
 			writer.WriteHeader(http.StatusNoContent)
@@ -2284,6 +3853,7 @@ type healthReport struct {
 	GeneralInfo common.HealthStatusInfo      `json:"general"`
 	DBHealth    common.DBHealthStatusInfo    `json:"dbHealth"`
 	Usage       *common.UsageInfo            `json:"usage,omitempty"`
+	OrgUsage    []common.OrganizationUsage   `json:"orgUsage,omitempty"`
 	MQTTHealth  *common.MQTTHealthStatusInfo `json:"mqttHealth,omitempty"`
 }
 
@@ -2333,7 +3903,7 @@ func handleHealth(writer http.ResponseWriter, request *http.Request) {
 		trace.Debug("In handleHealth. Include details %t\n", details)
 	}
 
-	code, _, _ := security.Authenticate(request)
+	code, userOrg, _ := security.Authenticate(request)
 	if code == security.AuthFailed || code == security.AuthEdgeNode {
 		writer.WriteHeader(http.StatusForbidden)
 		writer.Write(unauthorizedBytes)
@@ -2356,7 +3926,17 @@ func handleHealth(writer http.ResponseWriter, request *http.Request) {
 
 	report := healthReport{GeneralInfo: common.HealthStatus, DBHealth: common.DBHealth}
 	if details {
-		report.Usage = &common.HealthUsageInfo
+		usage := common.HealthStatus.GetUsage()
+		report.Usage = &usage
+
+		// Only sync admins see the usage of all the organizations
+		usageOrg := userOrg
+		if code == security.AuthSyncAdmin {
+			usageOrg = ""
+		}
+		if orgUsage, err := store.RetrieveOrganizationsUsage(usageOrg); err == nil {
+			report.OrgUsage = orgUsage
+		}
 	}
 	if common.Configuration.CommunicationProtocol != common.HTTPProtocol {
 		report.MQTTHealth = &common.MQTTHealth
@@ -2372,3 +3952,63 @@ func handleHealth(writer http.ResponseWriter, request *http.Request) {
 		}
 	}
 }
+
+// parseObjectsFilter parses the filter and page parameters of the APIs that list objects.
+// It returns the filter and the number of objects to return. The limit of the filter is larger by one
+// than the number of objects to return, to find out whether there is a next page.
+func parseObjectsFilter(request *http.Request) (common.ObjectsFilter, int, common.SyncServiceError) {
+	query := request.URL.Query()
+	filter := common.ObjectsFilter{ObjectTypePrefix: query.Get("type_prefix"), Version: query.Get("version"),
+		DestinationType: query.Get("destination_type")}
+
+	parseBool := func(name string) (*bool, common.SyncServiceError) {
+		valueString := query.Get(name)
+		if valueString == "" {
+			return nil, nil
+		}
+		value, err := strconv.ParseBool(valueString)
+		if err != nil {
+			return nil, &common.InvalidRequest{Message: fmt.Sprintf("Invalid %s parameter %s", name, valueString)}
+		}
+		return &value, nil
+	}
+	var err common.SyncServiceError
+	if filter.Inactive, err = parseBool("inactive"); err != nil {
+		return filter, 0, err
+	}
+	if filter.Deleted, err = parseBool("deleted"); err != nil {
+		return filter, 0, err
+	}
+
+	if sinceString := query.Get("updated_since"); sinceString != "" {
+		since, err := strconv.ParseInt(sinceString, 10, 64)
+		if err != nil || since < 0 {
+			return filter, 0, &common.InvalidRequest{Message: "Invalid updated_since parameter " + sinceString}
+		}
+		filter.UpdatedSince = since
+	}
+
+	limit := 0
+	if limitString := query.Get("limit"); limitString != "" {
+		var err error
+		limit, err = strconv.Atoi(limitString)
+		if err != nil || limit <= 0 {
+			return filter, 0, &common.InvalidRequest{Message: "Invalid limit parameter " + limitString}
+		}
+		filter.Limit = limit + 1
+	}
+	if cursor := query.Get("cursor"); cursor != "" {
+		if err := filter.SetCursor(cursor); err != nil {
+			return filter, 0, err
+		}
+	}
+	if filter.Labels, err = common.ParseLabelSelector(query.Get("labels")); err != nil {
+		return filter, 0, err
+	}
+	return filter, limit, nil
+}
+
+// setNextCursor sets the cursor of the page that starts after the object in the response
+func setNextCursor(writer http.ResponseWriter, objectType string, objectID string) {
+	writer.Header().Set(nextCursorHeader, common.ObjectsCursor(objectType, objectID))
+}
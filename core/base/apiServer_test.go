@@ -2,11 +2,15 @@ package base
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -110,6 +114,330 @@ func testHandleDestinationsInvalidCalls(storageType string, t *testing.T) {
 	}
 }
 
+func TestHandleDestinationProperties(t *testing.T) {
+	testHandleDestinationProperties(common.Bolt, t)
+	testHandleDestinationProperties(common.Mongo, t)
+}
+
+func testHandleDestinationProperties(storageType string, t *testing.T) {
+	if status := testAPIServerSetup(common.CSS, storageType); status != "" {
+		t.Errorf(status)
+	}
+	defer communications.Store.Stop()
+	defer security.Stop()
+
+	destinations := []common.Destination{
+		common.Destination{DestOrgID: "myorg228", DestType: "my-type", DestID: "my01", Communication: common.MQTTProtocol,
+			Properties: map[string]string{"region": "eu", "hardware": "rpi4"}},
+		common.Destination{DestOrgID: "myorg228", DestType: "my-type", DestID: "my02", Communication: common.MQTTProtocol,
+			Properties: map[string]string{"region": "us"}},
+		common.Destination{DestOrgID: "myorg228", DestType: "my-type", DestID: "my03", Communication: common.MQTTProtocol},
+	}
+	for _, destination := range destinations {
+		if err := store.StoreDestination(destination); err != nil {
+			t.Errorf("Failed to store detination %#v. Error: %s\n", destination, err)
+		}
+	}
+
+	testData := []struct {
+		method        string
+		appKey        string
+		theURL        string
+		body          string
+		status        int
+		expectedCount int
+	}{
+		{http.MethodGet, "testerUser@myorg228", "myorg228?properties=region=eu", "", http.StatusOK, 1},
+		{http.MethodGet, "testerUser@myorg228", "myorg228?properties=region", "", http.StatusOK, 2},
+		{http.MethodGet, "testerUser@myorg228", "myorg228?properties=!region", "", http.StatusOK, 1},
+		{http.MethodGet, "testerUser@myorg228", "myorg228?properties=region!=eu,hardware!=rpi4", "", http.StatusOK, 2},
+		{http.MethodGet, "testerUser@myorg228", "myorg228?properties=region=asia", "", http.StatusNotFound, -1},
+		{http.MethodGet, "testerUser@myorg228", "myorg228?properties=re$gion=eu", "", http.StatusBadRequest, -1},
+		{http.MethodPut, "testerAdmin@myorg228", "myorg228/my-type/my03/properties", `{"region": "eu", "site": "paris"}`,
+			http.StatusNoContent, -1},
+		{http.MethodGet, "testerUser@myorg228", "myorg228?properties=region=eu", "", http.StatusOK, 2},
+		{http.MethodPut, "testerSyncAdmin@plover228", "myorg228/my-type/my01/properties/", `{}`, http.StatusNoContent, -1},
+		{http.MethodGet, "testerUser@myorg228", "myorg228?properties=region=eu", "", http.StatusOK, 1},
+		{http.MethodPut, "testerUser@myorg228", "myorg228/my-type/my02/properties", `{"region": "eu"}`, http.StatusForbidden, -1},
+		{http.MethodPut, "testerAdmin@plover228", "myorg228/my-type/my02/properties", `{"region": "eu"}`, http.StatusForbidden, -1},
+		{http.MethodPut, "testerAdmin@myorg228", "myorg228/my-type/my04/properties", `{"region": "eu"}`, http.StatusNotFound, -1},
+		{http.MethodPut, "testerAdmin@myorg228", "myorg228/my-type/my02/properties", `{"region": "eu,us"}`, http.StatusBadRequest, -1},
+		{http.MethodPut, "testerAdmin@myorg228", "myorg228/my-type/my02/properties", `["eu"]`, http.StatusBadRequest, -1},
+		{http.MethodGet, "testerAdmin@myorg228", "myorg228/my-type/my02/properties", "", http.StatusMethodNotAllowed, -1},
+		{http.MethodPut, "testerAdmin@myorg228", "myorg228", `{"region": "eu"}`, http.StatusMethodNotAllowed, -1},
+		{http.MethodGet, "testerUser@myorg228", "myorg228?properties=region=us", "", http.StatusOK, 1},
+	}
+
+	for _, test := range testData {
+		writer := newAPIServerTestResponseWriter()
+		request, _ := http.NewRequest(test.method, test.theURL, strings.NewReader(test.body))
+		request.SetBasicAuth(test.appKey, "")
+
+		handleDestinations(writer, request)
+		if writer.statusCode != test.status {
+			t.Errorf("%s of %s returned %d instead of %d\n", test.method, test.theURL, writer.statusCode, test.status)
+		} else if test.status == http.StatusOK {
+			var data []common.Destination
+			if err := json.NewDecoder(&writer.body).Decode(&data); err != nil {
+				t.Errorf("Failed to unmarshall destinations. Error: %s\n", err)
+			} else if len(data) != test.expectedCount {
+				t.Errorf("%s of %s returned %d destinations instead of %d\n", test.method, test.theURL, len(data), test.expectedCount)
+			}
+		}
+	}
+
+	if dest, err := store.RetrieveDestination("myorg228", "my-type", "my01"); err != nil || dest == nil {
+		t.Errorf("Failed to retrieve the destination. Error: %v\n", err)
+	} else if dest.Properties != nil || dest.Communication != common.MQTTProtocol {
+		t.Errorf("The properties of the destination weren't removed: %#v\n", dest)
+	}
+}
+
+func TestHandleDestinationGroups(t *testing.T) {
+	testHandleDestinationGroups(common.Bolt, t)
+	testHandleDestinationGroups(common.Mongo, t)
+}
+
+func testHandleDestinationGroups(storageType string, t *testing.T) {
+	if status := testAPIServerSetup(common.CSS, storageType); status != "" {
+		t.Errorf(status)
+	}
+	defer communications.Store.Stop()
+	defer security.Stop()
+
+	store.DeleteDestinationGroup("myorg229", "fleet1")
+	store.DeleteDestinationGroup("myorg229", "fleet2")
+
+	testData := []struct {
+		method        string
+		appKey        string
+		theURL        string
+		body          string
+		status        int
+		expectedCount int
+	}{
+		{http.MethodGet, "testerUser@myorg229", "myorg229", "", http.StatusNotFound, -1},
+		{http.MethodPut, "testerAdmin@myorg229", "myorg229/fleet1", `{"destinations": ["my-type:my01", "my-type:my02"]}`,
+			http.StatusNoContent, -1},
+		{http.MethodPut, "testerSyncAdmin@plover229", "myorg229/fleet2/", `{"destinations": []}`, http.StatusNoContent, -1},
+		{http.MethodGet, "testerUser@myorg229", "myorg229", "", http.StatusOK, 2},
+		{http.MethodGet, "testerUser@myorg229", "myorg229/fleet1", "", http.StatusOK, 2},
+		{http.MethodGet, "testerUser@myorg229", "myorg229/fleet3", "", http.StatusNotFound, -1},
+		{http.MethodGet, "testerUser@plover229", "myorg229", "", http.StatusForbidden, -1},
+		{http.MethodPut, "testerUser@myorg229", "myorg229/fleet1", `{"destinations": []}`, http.StatusForbidden, -1},
+		{http.MethodPut, "testerAdmin@myorg229", "myorg229/fleet1", `{"destinations": ["my-type"]}`, http.StatusBadRequest, -1},
+		{http.MethodPut, "testerAdmin@myorg229", "myorg229/fleet1", `{"destinations": "my-type:my01"}`, http.StatusBadRequest, -1},
+		{http.MethodPut, "testerAdmin@myorg229", "myorg229", `{"destinations": []}`, http.StatusMethodNotAllowed, -1},
+		{http.MethodPut, "testerAdmin@myorg229", "myorg229/fleet1/my-type", `{"destinations": []}`, http.StatusBadRequest, -1},
+		{http.MethodDelete, "testerUser@myorg229", "myorg229/fleet2", "", http.StatusForbidden, -1},
+		{http.MethodDelete, "testerAdmin@myorg229", "myorg229/fleet2", "", http.StatusNoContent, -1},
+		{http.MethodDelete, "testerAdmin@myorg229", "myorg229/fleet2", "", http.StatusNotFound, -1},
+		{http.MethodGet, "testerUser@myorg229", "myorg229", "", http.StatusOK, 1},
+	}
+
+	for _, test := range testData {
+		writer := newAPIServerTestResponseWriter()
+		request, _ := http.NewRequest(test.method, test.theURL, strings.NewReader(test.body))
+		request.SetBasicAuth(test.appKey, "")
+
+		handleDestinationGroups(writer, request)
+		if writer.statusCode != test.status {
+			t.Errorf("%s of %s returned %d instead of %d\n", test.method, test.theURL, writer.statusCode, test.status)
+		} else if test.status == http.StatusOK {
+			var groups []common.DestinationGroup
+			if strings.Contains(test.theURL, "/") {
+				var group common.DestinationGroup
+				if err := json.NewDecoder(&writer.body).Decode(&group); err != nil {
+					t.Errorf("Failed to unmarshall destination group. Error: %s\n", err)
+					continue
+				}
+				if len(group.Destinations) != test.expectedCount {
+					t.Errorf("%s of %s returned %d destinations instead of %d\n", test.method, test.theURL,
+						len(group.Destinations), test.expectedCount)
+				}
+			} else if err := json.NewDecoder(&writer.body).Decode(&groups); err != nil {
+				t.Errorf("Failed to unmarshall destination groups. Error: %s\n", err)
+			} else if len(groups) != test.expectedCount {
+				t.Errorf("%s of %s returned %d groups instead of %d\n", test.method, test.theURL, len(groups), test.expectedCount)
+			}
+		}
+	}
+}
+
+func TestHandleWebhookDeliveries(t *testing.T) {
+	if status := testAPIServerSetup(common.CSS, common.Bolt); status != "" {
+		t.Errorf(status)
+	}
+	defer communications.Store.Stop()
+	defer security.Stop()
+
+	deliveries := []common.WebhookDelivery{
+		common.WebhookDelivery{ID: "1", OrgID: "myorg6", ObjectType: "type1", ObjectID: "1", URL: "http://abc",
+			Status: common.WebhookDeliveryPending, CreationTime: 1},
+		common.WebhookDelivery{ID: "2", OrgID: "myorg6", ObjectType: "type1", ObjectID: "2", URL: "http://abc",
+			Status: common.WebhookDeliveryFailed, CreationTime: 2},
+		common.WebhookDelivery{ID: "3", OrgID: "plover6", ObjectType: "type1", ObjectID: "1", URL: "http://abc",
+			Status: common.WebhookDeliveryPending, CreationTime: 3},
+		common.WebhookDelivery{ID: "4", OrgID: "myorg6", ObjectType: "type2", ObjectID: "1", URL: "http://abc",
+			Status: common.WebhookDeliveryPending, CreationTime: 4},
+	}
+	for _, delivery := range deliveries {
+		if err := store.StoreWebhookDelivery(delivery); err != nil {
+			t.Errorf("Failed to store webhook delivery %#v. Error: %s\n", delivery, err)
+		}
+	}
+
+	// Users get only the deliveries of the object types they can access
+	if err := store.AddUsersToACL(common.ObjectsACLType, "myorg6", "type1", []string{"testerUser"}); err != nil {
+		t.Errorf("Failed to set up objects ACL. Error: %s\n", err.Error())
+	}
+	defer store.RemoveUsersFromACL(common.ObjectsACLType, "myorg6", "type1", []string{"testerUser"})
+
+	testData := []struct {
+		method        string
+		appKey        string
+		theURL        string
+		status        int
+		expectedCount int
+	}{
+		{http.MethodGet, "testerUser@myorg6", "myorg6", http.StatusOK, 2},
+		{http.MethodGet, "testerAdmin@myorg6", "myorg6", http.StatusOK, 3},
+		{http.MethodGet, "testerUser@myorg6", "myorg6/?status=failed", http.StatusOK, 1},
+		{http.MethodGet, "testerAdmin@plover6", "plover6?status=pending", http.StatusOK, 1},
+		{http.MethodGet, "testerAdmin@plover6", "plover6?status=failed", http.StatusNotFound, -1},
+		{http.MethodGet, "testerUser@myorg6", "myorg6?status=abc", http.StatusBadRequest, -1},
+		{http.MethodGet, "testerUser@myorg6", "plover6", http.StatusForbidden, -1},
+		{http.MethodGet, "testerUser@myorg6", "", http.StatusBadRequest, -1},
+		{http.MethodPost, "testerUser@myorg6", "myorg6", http.StatusMethodNotAllowed, -1},
+	}
+
+	for _, test := range testData {
+		writer := newAPIServerTestResponseWriter()
+		request, _ := http.NewRequest(test.method, test.theURL, nil)
+		request.SetBasicAuth(test.appKey, "")
+
+		handleWebhookDeliveries(writer, request)
+		if writer.statusCode != test.status {
+			t.Errorf("handleWebhookDeliveries of %s returned %d instead of %d\n", test.theURL, writer.statusCode, test.status)
+		} else if test.status == http.StatusOK {
+			var data []common.WebhookDelivery
+			if err := json.NewDecoder(&writer.body).Decode(&data); err != nil {
+				t.Errorf("Failed to unmarshall webhook deliveries. Error: %s\n", err)
+			} else if len(data) != test.expectedCount {
+				t.Errorf("handleWebhookDeliveries of %s returned %d deliveries instead of %d\n", test.theURL, len(data),
+					test.expectedCount)
+			}
+		}
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	if status := testAPIServerSetup(common.CSS, common.Bolt); status != "" {
+		t.Errorf(status)
+	}
+	defer communications.Store.Stop()
+	defer security.Stop()
+
+	startTime := time.Now()
+	calls := []struct {
+		resource  string
+		handler   http.HandlerFunc
+		method    string
+		appKey    string
+		theURL    string
+		operation string
+		target    string
+	}{
+		{auditObjects, handleObjects, http.MethodPut, "testerAdmin@myorg8", "myorg8/type1/1/consumed", "markObjectConsumed", "type1/1"},
+		{auditObjects, handleObjects, http.MethodDelete, "testerUser@myorg8", "myorg8/type1/1", "deleteObject", "type1/1"},
+		{auditObjects, handleObjects, http.MethodGet, "testerUser@myorg8", "myorg8/type1", "", ""},
+		{auditSecurity, handleSecurity, http.MethodPut, "testerUser@myorg8", "objects/myorg8/type1/user1", "updateACL", "objects/type1/user1"},
+		{auditSecurity, handleSecurity, http.MethodDelete, "testerAdmin@plover8", "destinations/plover8/type1/user1", "deleteACL",
+			"destinations/type1/user1"},
+		{auditOrganizations, handleOrganizations, http.MethodPut, "tester@plover8", "plover8", "updateOrganization", "plover8"},
+	}
+	codes := make([]int, 0)
+	for _, call := range calls {
+		writer := newAPIServerTestResponseWriter()
+		request, _ := http.NewRequest(call.method, call.theURL, nil)
+		request.SetBasicAuth(call.appKey, "")
+		audited(call.resource, call.handler).ServeHTTP(writer, request)
+		if call.operation != "" {
+			codes = append(codes, writer.statusCode)
+		}
+	}
+
+	entries, err := store.RetrieveAuditEntries("", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to retrieve the audit log. Error: %s\n", err)
+	} else if len(entries) != len(codes) {
+		t.Fatalf("The audit log has %d entries instead of %d\n", len(entries), len(codes))
+	} else {
+		index := 0
+		for _, call := range calls {
+			if call.operation == "" {
+				continue
+			}
+			entry := entries[index]
+			parts := strings.Split(call.appKey, "@")
+			identity, userOrgID := parts[0], parts[1]
+			if identity == "tester" {
+				// Failed to authenticate
+				identity, userOrgID = "", ""
+			}
+			if entry.Operation != call.operation || entry.Target != call.target || entry.OrgID != strings.Split(call.appKey, "@")[1] ||
+				entry.Identity != identity || entry.UserOrgID != userOrgID || entry.Code != codes[index] ||
+				entry.Timestamp.Before(startTime) || entry.ID == "" {
+				t.Errorf("Incorrect audit log entry for %s %s: %#v\n", call.method, call.theURL, entry)
+			}
+			index++
+		}
+	}
+
+	last := entries[len(entries)-1].Timestamp.UTC().Format(time.RFC3339Nano)
+	testData := []struct {
+		method        string
+		appKey        string
+		theURL        string
+		status        int
+		expectedCount int
+	}{
+		{http.MethodGet, "testerAdmin@myorg8", "myorg8", http.StatusOK, 3},
+		{http.MethodGet, "testerAdmin@plover8", "plover8/", http.StatusOK, 2},
+		{http.MethodGet, "testerSyncAdmin@plover8", "myorg8", http.StatusOK, 3},
+		{http.MethodGet, "testerSyncAdmin@plover8", "", http.StatusOK, 5},
+		{http.MethodGet, "testerSyncAdmin@plover8", "?to=" + last, http.StatusOK, 4},
+		{http.MethodGet, "testerSyncAdmin@plover8", "?from=" + last, http.StatusOK, 1},
+		{http.MethodGet, "testerAdmin@myorg8", "myorg8?from=" + startTime.Add(-time.Hour).UTC().Format(time.RFC3339) + "&to=" +
+			startTime.Add(-time.Minute).UTC().Format(time.RFC3339), http.StatusNotFound, -1},
+		{http.MethodGet, "testerAdmin@myorg8", "myorg8?from=yesterday", http.StatusBadRequest, -1},
+		{http.MethodGet, "testerAdmin@myorg8", "myorg8?from=" + last + "&to=" + last, http.StatusBadRequest, -1},
+		{http.MethodGet, "testerAdmin@myorg8", "plover8", http.StatusForbidden, -1},
+		{http.MethodGet, "testerAdmin@myorg8", "", http.StatusForbidden, -1},
+		{http.MethodGet, "testerUser@myorg8", "myorg8", http.StatusForbidden, -1},
+		{http.MethodGet, "testerSyncAdmin@plover8", "myorg8/type1", http.StatusBadRequest, -1},
+		{http.MethodDelete, "testerAdmin@myorg8", "myorg8", http.StatusMethodNotAllowed, -1},
+	}
+
+	for _, test := range testData {
+		writer := newAPIServerTestResponseWriter()
+		request, _ := http.NewRequest(test.method, test.theURL, nil)
+		request.SetBasicAuth(test.appKey, "")
+
+		handleAuditLog(writer, request)
+		if writer.statusCode != test.status {
+			t.Errorf("handleAuditLog of %s returned %d instead of %d\n", test.theURL, writer.statusCode, test.status)
+		} else if test.status == http.StatusOK {
+			var data []common.AuditEntry
+			if err := json.NewDecoder(&writer.body).Decode(&data); err != nil {
+				t.Errorf("Failed to unmarshall the audit log. Error: %s\n", err)
+			} else if len(data) != test.expectedCount {
+				t.Errorf("handleAuditLog of %s returned %d entries instead of %d\n", test.theURL, len(data), test.expectedCount)
+			}
+		}
+	}
+}
+
 func TestMisceleneousHandlers(t *testing.T) {
 	testMisceleneousHandlers(common.Mongo, t)
 	testMisceleneousHandlers(common.Bolt, t)
@@ -158,6 +486,121 @@ func testMisceleneousHandlers(storageType string, t *testing.T) {
 	}
 }
 
+func TestHandleMetrics(t *testing.T) {
+	if status := testAPIServerSetup(common.CSS, common.Bolt); status != "" {
+		t.Errorf(status)
+	}
+	defer communications.Store.Stop()
+	defer security.Stop()
+
+	notification := common.Notification{ObjectID: "1", ObjectType: "metrics", DestOrgID: "myorg", DestID: "dev1",
+		DestType: "device", Status: common.Update, InstanceID: 1}
+	if err := store.UpdateNotificationRecord(notification); err != nil {
+		t.Errorf("Failed to store notification. Error: %s", err.Error())
+	}
+	common.HealthStatus.DataSent(common.MQTTProtocol, 100)
+	common.HealthStatus.DataReceived(common.HTTPProtocol, 10)
+	traffic := common.HealthStatus.GetTraffic()
+
+	writer := newAPIServerTestResponseWriter()
+	request, _ := http.NewRequest(http.MethodGet, "", nil)
+	request.SetBasicAuth("testerAdmin@myorg", "")
+	handleMetrics(writer, request)
+	if writer.statusCode != http.StatusOK {
+		t.Fatalf("handleMetrics returned a status of %d instead of %d", writer.statusCode, http.StatusOK)
+	}
+
+	metrics := writer.body.String()
+	expectedLines := []string{
+		"# TYPE sync_service_client_requests_total counter",
+		"# TYPE sync_service_stored_objects gauge",
+		"sync_service_registered_ess 0",
+		`sync_service_notifications{status="update"} 1`,
+		fmt.Sprintf(`sync_service_bytes_sent_total{protocol="mqtt"} %d`, traffic.MQTTBytesSent),
+		fmt.Sprintf(`sync_service_bytes_received_total{protocol="http"} %d`, traffic.HTTPBytesReceived),
+		"sync_service_inflight_chunks 0",
+	}
+	for _, line := range expectedLines {
+		if !strings.Contains(metrics, line+"\n") {
+			t.Errorf("The metrics don't include %s", line)
+		}
+	}
+
+	writer = newAPIServerTestResponseWriter()
+	request, _ = http.NewRequest(http.MethodPost, "", nil)
+	request.SetBasicAuth("testerAdmin@myorg", "")
+	handleMetrics(writer, request)
+	if writer.statusCode != http.StatusMethodNotAllowed {
+		t.Errorf("handleMetrics returned a status of %d instead of %d", writer.statusCode, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestHandleStreamUpdatedObjects(t *testing.T) {
+	if status := testAPIServerSetup(common.CSS, common.Bolt); status != "" {
+		t.Errorf(status)
+	}
+	defer communications.Store.Stop()
+	defer security.Stop()
+
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "stream", DestOrgID: "myorg"}
+	if _, err := store.StoreObject(metaData, nil, common.CompletelyReceived); err != nil {
+		t.Fatalf("Failed to store object. Error: %s", err.Error())
+	}
+
+	// The client disconnects after receiving the events sent when the stream is opened
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	request, _ := http.NewRequest(http.MethodGet, "myorg/stream", nil)
+	request = request.WithContext(ctx)
+	request.Header.Set("Accept", textEventStream)
+	request.SetBasicAuth("testerAdmin@myorg", "")
+	writer := httptest.NewRecorder()
+	handleObjects(writer, request)
+	if writer.Code != http.StatusOK {
+		t.Fatalf("handleObjects returned a status of %d instead of %d", writer.Code, http.StatusOK)
+	}
+	if writer.Header().Get(contentType) != textEventStream {
+		t.Errorf("Wrong content type: %s", writer.Header().Get(contentType))
+	}
+
+	// The updated objects are sent when the stream is opened without a cursor
+	events := strings.Split(strings.TrimSuffix(writer.Body.String(), "\n\n"), "\n\n")
+	if len(events) != 1 {
+		t.Fatalf("Received %d events instead of 1: %s", len(events), writer.Body.String())
+	}
+	lines := strings.Split(events[0], "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "id: ") || lines[1] != "event: update" || !strings.HasPrefix(lines[2], "data: ") {
+		t.Fatalf("Invalid event: %s", events[0])
+	}
+	var receivedMetaData common.MetaData
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data: ")), &receivedMetaData); err != nil {
+		t.Errorf("Failed to unmarshal the data of the event. Error: %s", err.Error())
+	} else if receivedMetaData.ObjectID != "1" || receivedMetaData.ObjectType != "stream" {
+		t.Errorf("Wrong object in the event: %s:%s", receivedMetaData.ObjectType, receivedMetaData.ObjectID)
+	}
+
+	// The updated objects aren't sent again when the stream is resumed
+	request, _ = http.NewRequest(http.MethodGet, "myorg/stream", nil)
+	request = request.WithContext(ctx)
+	request.Header.Set("Accept", textEventStream)
+	request.Header.Set("Last-Event-ID", strings.TrimPrefix(lines[0], "id: "))
+	request.SetBasicAuth("testerAdmin@myorg", "")
+	writer = httptest.NewRecorder()
+	handleObjects(writer, request)
+	if writer.Code != http.StatusOK || writer.Body.Len() != 0 {
+		t.Errorf("The resumed stream returned a status of %d and the events: %s", writer.Code, writer.Body.String())
+	}
+
+	request, _ = http.NewRequest(http.MethodGet, "myorg/stream", nil)
+	request.Header.Set("Accept", textEventStream)
+	request.SetBasicAuth("testerAdmin@otherorg", "")
+	writer = httptest.NewRecorder()
+	handleObjects(writer, request)
+	if writer.Code != http.StatusForbidden {
+		t.Errorf("handleObjects returned a status of %d instead of %d for an unauthorized user", writer.Code, http.StatusForbidden)
+	}
+}
+
 func TestHandleObject(t *testing.T) {
 	testHandleObjectHelper(common.CSS, common.Mongo, t)
 	testHandleObjectHelper(common.CSS, common.Bolt, t)
@@ -219,6 +662,10 @@ func testHandleObjectHelper(nodeType string, storageType string, t *testing.T) {
 			&webhookUpdate{Action: "register", URL: "http://abc"}, 21},
 		{http.MethodPut, "testerAdmin@myorg222", "myorg222", "type1", "", "", nil, nil, http.StatusBadRequest,
 			&webhookUpdate{Action: "register", URL: "abc"}, 22},
+		{http.MethodPut, "testerAdmin@myorg222", "myorg222", "type1", "", "", nil, nil, http.StatusNoContent,
+			&webhookUpdate{Action: "register", URL: "http://abc/events", Events: []string{"consumed", "completed"}}, 22},
+		{http.MethodPut, "testerAdmin@myorg222", "myorg222", "type1", "", "", nil, nil, http.StatusBadRequest,
+			&webhookUpdate{Action: "register", URL: "http://abc/events", Events: []string{"plover"}}, 22},
 		{http.MethodPut, "testerAdmin@myorg222", "myorg222", "type1", "1", "received", nil, nil, http.StatusBadRequest, nil, 23},
 		{http.MethodPost, "testerAdmin@myorg222", "myorg222", "type1", "1", "received", nil, nil, http.StatusMethodNotAllowed, nil, 24},
 
@@ -638,6 +1085,261 @@ func testObjectsWithPolicyUpdatedSinceHelper(storageProvider string, t *testing.
 	}
 }
 
+func TestObjectsWithPolicyPages(t *testing.T) {
+	testObjectsWithPolicyPagesHelper(common.Mongo, t)
+	testObjectsWithPolicyPagesHelper(common.Bolt, t)
+}
+
+func testObjectsWithPolicyPagesHelper(storageProvider string, t *testing.T) {
+	if status := testAPIServerSetup(common.CSS, storageProvider); status != "" {
+		t.Errorf(status)
+	}
+	defer communications.Store.Stop()
+
+	_, totalCount, err := loadTestPolicyData(common.CSS, "")
+	if err != nil {
+		t.Errorf("StoreObject failed: %s", err.Error())
+	}
+
+	// Page through the objects of myorgPolicy, two objects at a time
+	ids := make([]string, 0)
+	cursor := ""
+	for page := 0; page < totalCount; page++ {
+		urlString := "myorgPolicy?destination_policy=true&type_prefix=type&limit=2"
+		if cursor != "" {
+			urlString += "&cursor=" + cursor
+		}
+		writer := newAPIServerTestResponseWriter()
+		request, _ := http.NewRequest(http.MethodGet, urlString, nil)
+		request.SetBasicAuth("testerAdmin@myorgPolicy", "")
+
+		handleObjects(writer, request)
+		if writer.statusCode != http.StatusOK {
+			t.Errorf("handleObjects of %s returned a status of %d instead of %d\n", urlString, writer.statusCode, http.StatusOK)
+			break
+		}
+		var data []common.ObjectDestinationPolicy
+		if err := json.NewDecoder(&writer.body).Decode(&data); err != nil {
+			t.Errorf("Failed to unmarshall objects. Error: %s\n", err)
+			break
+		}
+		if len(data) > 2 {
+			t.Errorf("Fetched %d objects in a page of 2 objects\n", len(data))
+		}
+		for _, object := range data {
+			ids = append(ids, object.ObjectID)
+		}
+		cursor = writer.Header().Get(nextCursorHeader)
+		if cursor == "" {
+			break
+		}
+	}
+	if len(ids) != totalCount-1 || !sort.StringsAreSorted(ids) {
+		t.Errorf("Fetched the objects %v in pages, expected %d sorted objects\n", ids, totalCount-1)
+	}
+
+	invalidURLs := []string{
+		"myorgPolicy?destination_policy=true&limit=0",
+		"myorgPolicy?destination_policy=true&cursor=abc",
+		"myorgPolicy?destination_policy=true&inactive=maybe",
+		"myorgPolicy?destination_policy=true&since=1&limit=2",
+	}
+	for _, urlString := range invalidURLs {
+		writer := newAPIServerTestResponseWriter()
+		request, _ := http.NewRequest(http.MethodGet, urlString, nil)
+		request.SetBasicAuth("testerAdmin@myorgPolicy", "")
+
+		handleObjects(writer, request)
+		if writer.statusCode != http.StatusBadRequest {
+			t.Errorf("handleObjects of %s returned a status of %d instead of %d\n", urlString, writer.statusCode, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestHandleLabeledObjects(t *testing.T) {
+	if status := testAPIServerSetup(common.CSS, common.Bolt); status != "" {
+		t.Errorf(status)
+	}
+	defer communications.Store.Stop()
+
+	for _, id := range []string{"1", "2", "3"} {
+		labels := map[string]string{"env": "prod"}
+		if id == "3" {
+			labels["env"] = "dev"
+		}
+		metaData := common.MetaData{ObjectID: id, ObjectType: "type1", DestOrgID: "myorg224", NoData: true,
+			Inactive: true, Labels: labels}
+		if err := UpdateObject("myorg224", "type1", id, metaData, nil); err != nil {
+			t.Errorf("Failed to update object %s. Error: %s", id, err.Error())
+		}
+	}
+
+	tests := []struct {
+		method             string
+		appKey             string
+		query              string
+		expectedHTTPStatus int
+		expectedIDs        string
+	}{
+		{http.MethodGet, "testerAdmin@myorg224", "?all_objects=true&labels=env%3Dprod", http.StatusOK, "1 2"},
+		{http.MethodGet, "testerAdmin@myorg224", "?all_objects=true&labels=env%3Da%20b", http.StatusBadRequest, ""},
+		{http.MethodPut, "testerAdmin@myorg224", "?activate=true&labels=env%3Ddev", http.StatusOK, "3"},
+		{http.MethodPut, "testerAdmin@myorg224", "?activate=no&labels=env%3Ddev", http.StatusBadRequest, ""},
+		{http.MethodDelete, "testerUser@myorg224", "?labels=env%3Dprod", http.StatusForbidden, ""},
+		{http.MethodDelete, "testerAdmin@myorg224", "", http.StatusBadRequest, ""},
+		{http.MethodDelete, "testerAdmin@myorg224", "?labels=env%3Dprod", http.StatusOK, "1 2"},
+		{http.MethodGet, "testerAdmin@myorg224", "?all_objects=true&labels=env%3Dprod&deleted=false", http.StatusNotFound, ""},
+	}
+
+	for index, test := range tests {
+		urlString := "myorg224/type1" + test.query
+		writer := newAPIServerTestResponseWriter()
+		request, _ := http.NewRequest(test.method, urlString, nil)
+		request.SetBasicAuth(test.appKey, "")
+
+		handleObjects(writer, request)
+		if writer.statusCode != test.expectedHTTPStatus {
+			t.Errorf("handleObjects of %s %s returned a status of %d instead of %d (test %d)\n",
+				test.method, urlString, writer.statusCode, test.expectedHTTPStatus, index)
+			continue
+		}
+		if writer.statusCode != http.StatusOK {
+			continue
+		}
+		ids := make([]string, 0)
+		if test.method == http.MethodGet {
+			var data []common.ObjectDestinationPolicy
+			if err := json.NewDecoder(&writer.body).Decode(&data); err != nil {
+				t.Errorf("Failed to unmarshall objects. Error: %s\n", err)
+			}
+			for _, object := range data {
+				ids = append(ids, object.ObjectID)
+			}
+		} else if err := json.NewDecoder(&writer.body).Decode(&ids); err != nil {
+			t.Errorf("Failed to unmarshall object IDs. Error: %s\n", err)
+		}
+		sort.Strings(ids)
+		if strings.Join(ids, " ") != test.expectedIDs {
+			t.Errorf("handleObjects of %s %s returned %v instead of %s (test %d)\n", test.method, urlString, ids, test.expectedIDs, index)
+		}
+	}
+}
+
+func TestHandleObjectsBatch(t *testing.T) {
+	if status := testAPIServerSetup(common.CSS, common.Bolt); status != "" {
+		t.Errorf(status)
+	}
+	defer communications.Store.Stop()
+
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: "myorg225", NoData: true, Inactive: true}
+	if err := UpdateObject("myorg225", "type1", "1", metaData, nil); err != nil {
+		t.Errorf("Failed to update object 1. Error: %s", err.Error())
+	}
+
+	tests := []struct {
+		appKey             string
+		body               string
+		expectedHTTPStatus int
+		expectedStatuses   string
+	}{
+		{"testerAdmin@myorg225", `{"operations": [{"operation": "activate", "objectType": "type1", "objectID": "1"},
+			{"operation": "update", "objectType": "type1", "objectID": "2",
+			"meta": {"objectID": "2", "objectType": "type1", "noData": true}}]}`, http.StatusOK, "succeeded succeeded"},
+		{"testerAdmin@myorg225", `{"atomic": true, "operations": [{"operation": "delete", "objectType": "type1", "objectID": "1"},
+			{"operation": "delete", "objectType": "type1", "objectID": "3"}]}`, http.StatusOK, "skipped failed"},
+		{"testerAdmin@myorg225", `{"operations": []}`, http.StatusBadRequest, ""},
+		{"testerAdmin@myorg225", `{"operations": `, http.StatusBadRequest, ""},
+		{"testerUser@myorg225", `{"operations": [{"operation": "delete", "objectType": "type1", "labels": "env=prod"}]}`,
+			http.StatusForbidden, ""},
+		{"testerAdmin@myorg225", `{"operations": [{"operation": "delete", "objectType": "type1", "objectID": "1"},
+			{"operation": "delete", "objectType": "type1", "objectID": "2"}]}`, http.StatusOK, "succeeded succeeded"},
+	}
+
+	for index, test := range tests {
+		writer := newAPIServerTestResponseWriter()
+		request, _ := http.NewRequest(http.MethodPost, "myorg225", strings.NewReader(test.body))
+		request.SetBasicAuth(test.appKey, "")
+
+		handleObjects(writer, request)
+		if writer.statusCode != test.expectedHTTPStatus {
+			t.Errorf("handleObjects returned a status of %d instead of %d (test %d)\n", writer.statusCode, test.expectedHTTPStatus, index)
+			continue
+		}
+		if writer.statusCode != http.StatusOK {
+			continue
+		}
+		var results []ObjectOperationResult
+		if err := json.NewDecoder(&writer.body).Decode(&results); err != nil {
+			t.Errorf("Failed to unmarshall the results. Error: %s\n", err)
+		}
+		statuses := make([]string, 0)
+		for _, result := range results {
+			statuses = append(statuses, result.Status)
+		}
+		if strings.Join(statuses, " ") != test.expectedStatuses {
+			t.Errorf("handleObjects returned %v instead of %s (test %d)\n", results, test.expectedStatuses, index)
+		}
+	}
+}
+
+func TestHandleObjectRollout(t *testing.T) {
+	if status := testAPIServerSetup(common.CSS, common.Bolt); status != "" {
+		t.Errorf(status)
+	}
+	defer communications.Store.Stop()
+
+	if err := communications.Store.StoreDestination(common.Destination{DestOrgID: "myorg226", DestType: "device", DestID: "dev1",
+		Communication: common.MQTTProtocol}); err != nil {
+		t.Errorf("Failed to store destination. Error: %s", err.Error())
+	}
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: "myorg226", NoData: true,
+		Rollout: &common.Rollout{Waves: []common.RolloutWave{{Percentage: 50}}}}
+	if err := UpdateObject("myorg226", "type1", "1", metaData, nil); err != nil {
+		t.Errorf("Failed to update object 1. Error: %s", err.Error())
+	}
+	metaData = common.MetaData{ObjectID: "2", ObjectType: "type1", DestOrgID: "myorg226", NoData: true}
+	if err := UpdateObject("myorg226", "type1", "2", metaData, nil); err != nil {
+		t.Errorf("Failed to update object 2. Error: %s", err.Error())
+	}
+
+	tests := []struct {
+		method             string
+		objectID           string
+		appKey             string
+		body               string
+		expectedHTTPStatus int
+	}{
+		{http.MethodGet, "1", "testerAdmin@myorg226", "", http.StatusOK},
+		{http.MethodGet, "2", "testerAdmin@myorg226", "", http.StatusNotFound},
+		{http.MethodPut, "1", "testerAdmin@myorg226", `{"action": "stop"}`, http.StatusBadRequest},
+		{http.MethodPut, "1", "testerAdmin@myorg226", `{"action": `, http.StatusBadRequest},
+		{http.MethodPut, "2", "testerAdmin@myorg226", `{"action": "pause"}`, http.StatusBadRequest},
+		{http.MethodDelete, "1", "testerAdmin@myorg226", "", http.StatusMethodNotAllowed},
+	}
+
+	for index, test := range tests {
+		writer := newAPIServerTestResponseWriter()
+		request, _ := http.NewRequest(test.method, "myorg226/type1/"+test.objectID+"/rollout", strings.NewReader(test.body))
+		request.SetBasicAuth(test.appKey, "")
+
+		handleObjects(writer, request)
+		if writer.statusCode != test.expectedHTTPStatus {
+			t.Errorf("handleObjects returned a status of %d instead of %d (test %d)\n", writer.statusCode, test.expectedHTTPStatus, index)
+		}
+	}
+
+	writer := newAPIServerTestResponseWriter()
+	request, _ := http.NewRequest(http.MethodGet, "myorg226/type1/1/rollout", nil)
+	request.SetBasicAuth("testerAdmin@myorg226", "")
+	handleObjects(writer, request)
+	var report common.RolloutReport
+	if err := json.NewDecoder(&writer.body).Decode(&report); err != nil {
+		t.Errorf("Failed to unmarshall the rollout. Error: %s\n", err)
+	} else if report.Status != common.RolloutCompleted || report.Wave != 1 || report.TotalDestinations != 1 || len(report.Destinations) != 1 {
+		t.Errorf("handleObjects returned an incorrect rollout: %v\n", report)
+	}
+}
+
 func loadTestPolicyData(nodeType string, orgID string) (int64, int, error) {
 	testData := []common.MetaData{
 		common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: "myorgPolicy1", NoData: true,
@@ -793,3 +1495,71 @@ func (writer *apiServerTestResponseWriter) Write(p []byte) (int, error) {
 func (writer *apiServerTestResponseWriter) WriteHeader(statusCode int) {
 	writer.statusCode = statusCode
 }
+
+func TestHandleObjectVersions(t *testing.T) {
+	if status := testAPIServerSetup(common.CSS, common.Bolt); status != "" {
+		t.Errorf(status)
+	}
+	defer communications.Store.Stop()
+
+	maxVersions := common.Configuration.MaxObjectVersions
+	common.Configuration.MaxObjectVersions = 1
+	defer func() { common.Configuration.MaxObjectVersions = maxVersions }()
+
+	communications.Store.DeleteObjectVersions("myorg227", "type1", "1")
+	for _, version := range []string{"1.0.0", "1.0.1"} {
+		metaData := common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: "myorg227", NoData: true, Version: version}
+		if err := UpdateObject("myorg227", "type1", "1", metaData, nil); err != nil {
+			t.Errorf("Failed to update object 1. Error: %s", err.Error())
+		}
+	}
+
+	writer := newAPIServerTestResponseWriter()
+	request, _ := http.NewRequest(http.MethodGet, "myorg227/type1/1/versions", nil)
+	request.SetBasicAuth("testerAdmin@myorg227", "")
+	handleObjects(writer, request)
+	var versions []common.ObjectVersion
+	if writer.statusCode != http.StatusOK {
+		t.Errorf("handleObjects returned a status of %d instead of %d\n", writer.statusCode, http.StatusOK)
+	} else if err := json.Unmarshal(writer.body.Bytes(), &versions); err != nil {
+		t.Errorf("Failed to unmarshal the object's versions. Error: %s", err.Error())
+	} else if len(versions) != 1 || versions[0].MetaData.Version != "1.0.0" {
+		t.Errorf("handleObjects returned incorrect versions: %v", versions)
+	}
+	if len(versions) == 0 {
+		return
+	}
+
+	tests := []struct {
+		method             string
+		objectID           string
+		operation          string
+		body               string
+		expectedHTTPStatus int
+	}{
+		{http.MethodGet, "2", "versions", "", http.StatusNotFound},
+		{http.MethodPut, "1", "versions", "", http.StatusMethodNotAllowed},
+		{http.MethodPut, "1", "rollback", `{"version": `, http.StatusBadRequest},
+		{http.MethodPut, "1", "rollback", `{"version": -1}`, http.StatusNotFound},
+		{http.MethodPut, "2", "rollback", fmt.Sprintf(`{"version": %d}`, versions[0].Version), http.StatusNotFound},
+		{http.MethodGet, "1", "rollback", "", http.StatusMethodNotAllowed},
+		{http.MethodPut, "1", "rollback", fmt.Sprintf(`{"version": %d}`, versions[0].Version), http.StatusNoContent},
+	}
+
+	for index, test := range tests {
+		writer := newAPIServerTestResponseWriter()
+		request, _ := http.NewRequest(test.method, "myorg227/type1/"+test.objectID+"/"+test.operation, strings.NewReader(test.body))
+		request.SetBasicAuth("testerAdmin@myorg227", "")
+
+		handleObjects(writer, request)
+		if writer.statusCode != test.expectedHTTPStatus {
+			t.Errorf("handleObjects returned a status of %d instead of %d (test %d)\n", writer.statusCode, test.expectedHTTPStatus, index)
+		}
+	}
+
+	if metaData, err := GetObject("myorg227", "type1", "1"); err != nil || metaData == nil {
+		t.Errorf("Failed to get object 1. Error: %v", err)
+	} else if metaData.Version != "1.0.0" {
+		t.Errorf("The object wasn't rolled back, its version is %s", metaData.Version)
+	}
+}
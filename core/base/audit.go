@@ -0,0 +1,211 @@
+package base
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/security"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+	"github.com/open-horizon/edge-utilities/logger/trace"
+)
+
+// The resources of the audited APIs
+const (
+	auditObjects           = "objects"
+	auditDestinations      = "destinations"
+	auditDestinationGroups = "destinationGroups"
+	auditOrganizations     = "organizations"
+	auditSecurity          = "security"
+	auditResend            = "resend"
+	auditShutdown          = "shutdown"
+)
+
+// auditResponseWriter records the status code of the response to an audited call
+type auditResponseWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (writer *auditResponseWriter) WriteHeader(code int) {
+	if writer.code == 0 {
+		writer.code = code
+	}
+	writer.ResponseWriter.WriteHeader(code)
+}
+
+func (writer *auditResponseWriter) Write(data []byte) (int, error) {
+	if writer.code == 0 {
+		writer.code = http.StatusOK
+	}
+	return writer.ResponseWriter.Write(data)
+}
+
+// audited wraps the handler of the APIs of a resource, recording the calls to the mutating APIs in the audit log.
+// The path of the request is expected to be relative to the resource's URL.
+func audited(resource string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if !isMutatingMethod(request.Method) || !common.Running {
+			handler.ServeHTTP(writer, request)
+			return
+		}
+
+		// The request is authenticated once, the handler and the audit log get the identity from the request's context
+		request = security.WithAuthentication(request)
+		auditWriter := &auditResponseWriter{ResponseWriter: writer}
+		handler.ServeHTTP(auditWriter, request)
+		if auditWriter.code == 0 {
+			auditWriter.code = http.StatusOK
+		}
+
+		orgID, operation, target := auditedOperation(resource, request.Method, request.URL.Path, request.URL.Query())
+		entry := common.AuditEntry{ID: uuid.New().String(), Timestamp: time.Now(), OrgID: orgID,
+			Operation: operation, Target: target, Code: auditWriter.code}
+		// The identity is taken from the request's context, the request isn't authenticated again
+		if code, userOrgID, identity := security.Authenticate(request); code != security.AuthFailed {
+			entry.Identity = identity
+			entry.UserOrgID = userOrgID
+		}
+		recordAuditEntry(entry)
+	})
+}
+
+func isMutatingMethod(method string) bool {
+	return method == http.MethodPut || method == http.MethodPost || method == http.MethodDelete
+}
+
+// auditedOperation returns the organization, operation and target of a call to a mutating API
+func auditedOperation(resource string, method string, path string, query url.Values) (string, string, string) {
+	parts := strings.Split(strings.TrimSuffix(path, "/"), "/")
+	if len(parts) == 1 && parts[0] == "" {
+		parts = nil
+	}
+	orgID := common.Configuration.OrgID
+
+	switch resource {
+	case auditObjects:
+		if common.Configuration.NodeType == common.CSS {
+			if len(parts) == 0 {
+				return "", "", ""
+			}
+			orgID = parts[0]
+			parts = parts[1:]
+		}
+		switch len(parts) {
+		case 0:
+			return orgID, "batchObjects", ""
+		case 1:
+			if method == http.MethodDelete {
+				return orgID, "deleteObjects", parts[0] + "?labels=" + query.Get("labels")
+			}
+			if query.Get("activate") != "" {
+				return orgID, "activateObjects", parts[0] + "?labels=" + query.Get("labels")
+			}
+			return orgID, "updateWebhook", parts[0]
+		case 2:
+			if method == http.MethodDelete {
+				return orgID, "deleteObject", parts[0] + "/" + parts[1]
+			}
+			return orgID, "updateObject", parts[0] + "/" + parts[1]
+		case 3:
+			return orgID, objectOperationName(strings.ToLower(parts[2])), parts[0] + "/" + parts[1]
+		}
+		return orgID, "", strings.Join(parts, "/")
+
+	case auditDestinations:
+		// orgID/destType/destID/properties
+		if len(parts) < 3 {
+			return "", "", strings.Join(parts, "/")
+		}
+		return parts[0], "updateDestinationProperties", parts[1] + "/" + parts[2]
+
+	case auditDestinationGroups:
+		// orgID/name
+		if len(parts) < 2 {
+			return "", "", strings.Join(parts, "/")
+		}
+		if method == http.MethodDelete {
+			return parts[0], "deleteDestinationGroup", parts[1]
+		}
+		return parts[0], "updateDestinationGroup", parts[1]
+
+	case auditOrganizations:
+		if len(parts) != 0 {
+			orgID = parts[0]
+		}
+		if method == http.MethodDelete {
+			return orgID, "deleteOrganization", orgID
+		}
+		return orgID, "updateOrganization", orgID
+
+	case auditSecurity:
+		// aclType/orgID/key[/username]
+		if len(parts) < 2 {
+			return "", "", strings.Join(parts, "/")
+		}
+		target := strings.Join(append([]string{parts[0]}, parts[2:]...), "/")
+		if method == http.MethodDelete {
+			return parts[1], "deleteACL", target
+		}
+		return parts[1], "updateACL", target
+
+	case auditResend:
+		return orgID, "resendObjects", ""
+
+	case auditShutdown:
+		return orgID, "shutdown", ""
+	}
+	return orgID, "", ""
+}
+
+func objectOperationName(operation string) string {
+	switch operation {
+	case "consumed":
+		return "markObjectConsumed"
+	case "deleted":
+		return "markObjectDeleted"
+	case "received":
+		return "markObjectReceived"
+	case "policyreceived":
+		return "markPolicyReceived"
+	case "activate":
+		return "activateObject"
+	case "data":
+		return "putObjectData"
+	case "destinations":
+		return "updateObjectDestinations"
+	case "rollout":
+		return "updateObjectRollout"
+	case "rollback":
+		return "rollbackObject"
+	}
+	return operation
+}
+
+func recordAuditEntry(entry common.AuditEntry) {
+	if store == nil {
+		return
+	}
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Audit: %s %s %s:%s by %s@%s returned %d\n", entry.ID, entry.Operation, entry.OrgID, entry.Target,
+			entry.Identity, entry.UserOrgID, entry.Code)
+	}
+	if err := store.StoreAuditEntry(entry); err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Failed to store an entry of the audit log. Error: %s\n", err)
+	}
+}
+
+// removeExpiredAuditEntries removes the entries of the audit log that are older than the retention period
+func removeExpiredAuditEntries() {
+	if common.Configuration.AuditLogRetention <= 0 {
+		return
+	}
+	before := time.Now().AddDate(0, 0, -common.Configuration.AuditLogRetention)
+	if err := store.DeleteAuditEntries(before); err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Failed to remove expired entries of the audit log. Error: %s\n", err)
+	}
+}
@@ -9,9 +9,11 @@ import (
 
 	"github.com/open-horizon/edge-sync-service/common"
 	"github.com/open-horizon/edge-sync-service/core/communications"
+	"github.com/open-horizon/edge-sync-service/core/encryption"
 	"github.com/open-horizon/edge-sync-service/core/leader"
 	"github.com/open-horizon/edge-sync-service/core/security"
 	"github.com/open-horizon/edge-sync-service/core/storage"
+	"github.com/open-horizon/edge-sync-service/core/tracing"
 	"github.com/open-horizon/edge-utilities/logger"
 	"github.com/open-horizon/edge-utilities/logger/trace"
 )
@@ -86,12 +88,30 @@ func Start(swaggerFile string, registerHandlers bool) common.SyncServiceError {
 
 	security.Start()
 
+	if common.Configuration.EncryptionKeyProvider == common.FileKeyProvider {
+		encryption.SetKeyProvider(&encryption.FileKeyProvider{Path: common.Configuration.EncryptionKeyFile})
+	}
+	if err := encryption.Init(); err != nil {
+		return &common.SetupError{Message: fmt.Sprintf("Failed to initialize the encryption key provider. Error: %s\n", err.Error())}
+	}
+
+	if err := tracing.Init(); err != nil {
+		return &common.SetupError{Message: fmt.Sprintf("Failed to initialize tracing. Error: %s\n", err.Error())}
+	}
+
+	var dataStore storage.DataStore
+	if common.Configuration.DataStorageProvider == common.S3 {
+		dataStore = &storage.S3DataStore{}
+	}
+
 	if common.Configuration.NodeType == common.CSS {
 		var cssStore storage.Storage
 		if common.Configuration.StorageProvider == common.Mongo {
-			cssStore = &storage.MongoStorage{}
+			cssStore = &storage.MongoStorage{DataStore: dataStore}
+		} else if common.Configuration.StorageProvider == common.Postgres {
+			cssStore = &storage.PostgresStorage{DataStore: dataStore}
 		} else {
-			cssStore = &storage.BoltStorage{}
+			cssStore = &storage.BoltStorage{DataStore: dataStore}
 		}
 		if common.Configuration.CommunicationProtocol == common.HybridMQTT ||
 			common.Configuration.CommunicationProtocol == common.HybridWIoTP {
@@ -101,7 +121,7 @@ func Start(swaggerFile string, registerHandlers bool) common.SyncServiceError {
 		}
 	} else {
 		if common.Configuration.StorageProvider == common.Bolt {
-			store = &storage.BoltStorage{}
+			store = &storage.BoltStorage{DataStore: dataStore}
 		} else {
 			store = &storage.InMemoryStorage{}
 		}
@@ -157,6 +177,7 @@ func Start(swaggerFile string, registerHandlers bool) common.SyncServiceError {
 			select {
 			case <-resendTimer.C:
 				communications.ResendNotifications()
+				communications.RetryWebhookDeliveries()
 
 			case <-resendStopChannel:
 				keepRunning = false
@@ -175,6 +196,9 @@ func Start(swaggerFile string, registerHandlers bool) common.SyncServiceError {
 			case <-activateTimer.C:
 				if leader.CheckIfLeader() {
 					communications.ActivateObjects()
+					if common.Configuration.NodeType == common.CSS {
+						communications.AdvanceRollouts()
+					}
 				}
 
 			case <-activateStopChannel:
@@ -185,26 +209,27 @@ func Start(swaggerFile string, registerHandlers bool) common.SyncServiceError {
 		common.GoRoutineEnded()
 	}()
 
-	if common.Configuration.NodeType == common.CSS {
-		go func() {
-			common.GoRoutineStarted()
-			keepRunning := true
-			for keepRunning {
-				maintenanceTimer = time.NewTimer(time.Second * time.Duration(common.Configuration.StorageMaintenanceInterval))
-				select {
-				case <-maintenanceTimer.C:
-					if leader.CheckIfLeader() {
+	go func() {
+		common.GoRoutineStarted()
+		keepRunning := true
+		for keepRunning {
+			maintenanceTimer = time.NewTimer(time.Second * time.Duration(common.Configuration.StorageMaintenanceInterval))
+			select {
+			case <-maintenanceTimer.C:
+				if leader.CheckIfLeader() {
+					if common.Configuration.NodeType == common.CSS {
 						store.PerformMaintenance()
 					}
-
-				case <-maintenanceStopChannel:
-					keepRunning = false
+					removeExpiredAuditEntries()
 				}
+
+			case <-maintenanceStopChannel:
+				keepRunning = false
 			}
-			maintenanceTimer = nil
-			common.GoRoutineEnded()
-		}()
-	}
+		}
+		maintenanceTimer = nil
+		common.GoRoutineEnded()
+	}()
 
 	if common.Configuration.NodeType == common.ESS {
 		pingTicker = time.NewTicker(time.Hour * time.Duration(common.Configuration.ESSPingInterval))
@@ -288,6 +313,9 @@ func Stop(quiesceTime int) {
 		<-timer.C
 	}
 
+	// The streams of updates are closed so that the HTTP servers don't wait for them to end
+	communications.CloseAllObjectUpdatesStreams()
+
 	stopHTTPServing()
 
 	communication.StopCommunication()
@@ -323,6 +351,8 @@ func Stop(quiesceTime int) {
 
 	store.Stop()
 
+	tracing.Stop()
+
 	if waitingOnBlockChannel {
 		blockChannel <- 1
 	}
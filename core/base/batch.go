@@ -0,0 +1,463 @@
+package base
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/communications"
+	"github.com/open-horizon/edge-sync-service/core/storage"
+	"github.com/open-horizon/edge-sync-service/core/tracing"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+	"github.com/open-horizon/edge-utilities/logger/trace"
+)
+
+// The operations of a batch of operations on objects
+const (
+	// BatchUpdate creates or updates an object
+	BatchUpdate = "update"
+
+	// BatchDelete deletes an object, or the objects of a type whose labels satisfy a selector
+	BatchDelete = "delete"
+
+	// BatchActivate activates an inactive object, or the inactive objects of a type whose labels satisfy a selector
+	BatchActivate = "activate"
+)
+
+// The statuses of the results of the operations in a batch
+const (
+	BatchSucceeded = "succeeded"
+	BatchFailed    = "failed"
+	BatchSkipped   = "skipped"
+)
+
+// maxBatchOperations is the maximal number of operations in a batch
+const maxBatchOperations = 1000
+
+// ObjectOperation is an operation on an object in a batch of operations
+// swagger:model
+type ObjectOperation struct {
+	// Operation is the operation: update, delete, or activate
+	Operation string `json:"operation"`
+
+	// ObjectType is the type of the object
+	ObjectType string `json:"objectType"`
+
+	// ObjectID is the ID of the object. A delete or an activate operation can provide Labels instead.
+	ObjectID string `json:"objectID,omitempty"`
+
+	// Labels is a label selector, such as env=prod,tier!=canary, that selects the objects of the type
+	// to delete or activate
+	Labels string `json:"labels,omitempty"`
+
+	// Meta is the object's metadata of an update operation
+	Meta *common.MetaData `json:"meta,omitempty"`
+
+	// Data is the object's binary data of an update operation
+	Data []byte `json:"data,omitempty"`
+}
+
+// ObjectOperationResult is the result of an operation on an object in a batch of operations
+// swagger:model
+type ObjectOperationResult struct {
+	// Operation is the operation: update, delete, or activate
+	Operation string `json:"operation"`
+
+	// ObjectType is the type of the object
+	ObjectType string `json:"objectType"`
+
+	// ObjectID is the ID of the object
+	ObjectID string `json:"objectID"`
+
+	// Status is the result of the operation: succeeded, failed, or skipped
+	Status string `json:"status"`
+
+	// Message is the reason the operation failed or was skipped
+	Message string `json:"message,omitempty"`
+}
+
+// objectSnapshot is the state of an object before a batch is applied to it, to restore the object if applying
+// an atomic batch fails
+type objectSnapshot struct {
+	objectType string
+	objectID   string
+
+	// metaData is nil if the object didn't exist before the batch
+	metaData *common.MetaData
+	status   string
+
+	// data is the stored data of the object, it is kept only if the batch replaces or deletes the data
+	data     []byte
+	keepData bool
+
+	// applied is true once an operation of the batch was applied to the object
+	applied bool
+}
+
+// batchItem is an operation on a single object in a batch. An operation with a label selector is expanded
+// to an item for each of the selected objects.
+type batchItem struct {
+	operation ObjectOperation
+	selected  bool
+	err       common.SyncServiceError
+}
+
+// ApplyObjectOperations applies a batch of operations on objects of an organization in order, and returns the result of each operation.
+// An operation with a label selector has a result for each of the selected objects.
+// The objects of the batch are locked until all the operations are applied.
+// If atomic is false, an operation that fails doesn't prevent applying the other operations.
+// If atomic is true, the operations are applied only if all of them are valid, and if applying an operation fails nonetheless,
+// e.g., due to a storage error, the remaining operations are skipped and the objects that the batch was applied to are restored
+// to their state before the batch. A restored object is stored as a new instance of the object that is sent to its destinations.
+// The data that an atomic batch replaces or deletes is kept in memory until the batch is applied.
+// A selected object that the operation can't be applied to, e.g., an object on the receiving side, is skipped.
+// The notifications of all the operations are sent after the operations are applied.
+func ApplyObjectOperations(orgID string, operations []ObjectOperation, atomic bool) ([]ObjectOperationResult, common.SyncServiceError) {
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In ApplyObjectOperations. Apply %d operations in %s, atomic: %t\n", len(operations), orgID, atomic)
+	}
+
+	common.HealthStatus.ClientRequestReceived()
+
+	if len(operations) == 0 {
+		return nil, &common.InvalidRequest{Message: "The batch doesn't include operations"}
+	}
+	if len(operations) > maxBatchOperations {
+		return nil, &common.InvalidRequest{Message: fmt.Sprintf("The batch includes more than %d operations", maxBatchOperations)}
+	}
+
+	items, err := expandObjectOperations(orgID, operations)
+	if err != nil {
+		return nil, err
+	}
+
+	// Lock all the objects before the operations are validated, so that the objects don't change until the batch is applied.
+	// The objects that the batch stores or restores may target destination groups, which aren't deleted until the batch is applied.
+	lockIndexes := make([]uint32, 0, len(items))
+	for _, item := range items {
+		if item.err == nil {
+			lockIndexes = append(lockIndexes, common.HashStrings(orgID, item.operation.ObjectType, item.operation.ObjectID))
+		}
+	}
+	destinationGroupsLock.RLock()
+	taken := apiObjectLocks.LockAll(lockIndexes)
+	results, notificationsInfo, err := applyLockedObjectOperations(orgID, items, atomic)
+	apiObjectLocks.UnlockAll(taken)
+	destinationGroupsLock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	// The objects were updated, the notifications that fail to be sent are resent later
+	if err := communications.SendBatchNotifications(notificationsInfo); err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Failed to send the notifications of a batch of operations. Error: %s\n", err)
+	}
+	return results, nil
+}
+
+// applyLockedObjectOperations validates and applies the operations of a batch, and prepares their notifications,
+// the caller sends the notifications
+// This function should not acquire an object lock (apiObjectLocks) as the caller has already acquired the locks of all the objects.
+func applyLockedObjectOperations(orgID string, items []batchItem, atomic bool) ([]ObjectOperationResult, []common.NotificationInfo,
+	common.SyncServiceError) {
+	results := make([]ObjectOperationResult, len(items))
+	valid := true
+	for index, item := range items {
+		results[index] = ObjectOperationResult{Operation: item.operation.Operation, ObjectType: item.operation.ObjectType,
+			ObjectID: item.operation.ObjectID}
+		err := item.err
+		if err == nil {
+			err = validateObjectOperation(orgID, item.operation)
+		}
+		if err == nil {
+			continue
+		}
+		if !common.IsInvalidRequest(err) {
+			return nil, nil, err
+		}
+		results[index].Message = err.Error()
+		if item.selected {
+			results[index].Status = BatchSkipped
+		} else {
+			results[index].Status = BatchFailed
+			valid = false
+		}
+	}
+
+	if atomic && !valid {
+		for index := range results {
+			if results[index].Status == "" {
+				results[index].Status = BatchSkipped
+				results[index].Message = "Another operation in the batch is invalid"
+			}
+		}
+		return results, nil, nil
+	}
+
+	var snapshots []*objectSnapshot
+	snapshotsByObject := make(map[string]*objectSnapshot)
+	if atomic {
+		var err common.SyncServiceError
+		if snapshots, err = takeObjectSnapshots(orgID, items, results); err != nil {
+			return nil, nil, err
+		}
+		for _, snapshot := range snapshots {
+			snapshotsByObject[snapshot.objectType+"/"+snapshot.objectID] = snapshot
+		}
+	}
+
+	notificationsInfo := make([]common.NotificationInfo, 0)
+	failed := false
+	for index, item := range items {
+		if results[index].Status != "" {
+			continue
+		}
+		if atomic && failed {
+			results[index].Status = BatchSkipped
+			results[index].Message = "A previous operation in the batch failed"
+			continue
+		}
+		if snapshot, ok := snapshotsByObject[item.operation.ObjectType+"/"+item.operation.ObjectID]; ok {
+			snapshot.applied = true
+		}
+		itemNotificationsInfo, err := applyObjectOperation(orgID, item.operation)
+		if err != nil {
+			results[index].Status = BatchFailed
+			results[index].Message = err.Error()
+			failed = true
+			continue
+		}
+		results[index].Status = BatchSucceeded
+		notificationsInfo = append(notificationsInfo, itemNotificationsInfo...)
+	}
+
+	if !atomic || !failed {
+		return results, notificationsInfo, nil
+	}
+
+	// Restore the objects the batch was applied to, the notifications of the undone operations are not sent
+	notificationsInfo = make([]common.NotificationInfo, 0)
+	restoreErrors := make(map[string]common.SyncServiceError)
+	for _, snapshot := range snapshots {
+		if !snapshot.applied {
+			continue
+		}
+		snapshotNotificationsInfo, err := restoreObjectSnapshot(orgID, *snapshot)
+		if err != nil {
+			if log.IsLogging(logger.ERROR) {
+				log.Error("Failed to restore the object %s %s %s after a batch of operations failed. Error: %s\n", orgID,
+					snapshot.objectType, snapshot.objectID, err)
+			}
+			restoreErrors[snapshot.objectType+"/"+snapshot.objectID] = err
+			continue
+		}
+		notificationsInfo = append(notificationsInfo, snapshotNotificationsInfo...)
+	}
+	for index, item := range items {
+		if results[index].Status != BatchSucceeded {
+			continue
+		}
+		if err, ok := restoreErrors[item.operation.ObjectType+"/"+item.operation.ObjectID]; ok {
+			results[index].Status = BatchFailed
+			results[index].Message = "Failed to undo the operation after another operation in the batch failed. Error: " + err.Error()
+		} else {
+			results[index].Status = BatchSkipped
+			results[index].Message = "The operation was undone since another operation in the batch failed"
+		}
+	}
+	return results, notificationsInfo, nil
+}
+
+// expandObjectOperations verifies the form of the operations, and expands the operations with a label selector
+// to an item for each of the selected objects
+func expandObjectOperations(orgID string, operations []ObjectOperation) ([]batchItem, common.SyncServiceError) {
+	items := make([]batchItem, 0, len(operations))
+	for _, operation := range operations {
+		if err := checkObjectOperation(orgID, operation); err != nil {
+			items = append(items, batchItem{operation: operation, err: err})
+			continue
+		}
+		if operation.Labels == "" {
+			items = append(items, batchItem{operation: operation})
+			continue
+		}
+
+		selector, err := common.ParseLabelSelector(operation.Labels)
+		if err != nil {
+			items = append(items, batchItem{operation: operation, err: err})
+			continue
+		}
+		filter := common.ObjectsFilter{Labels: selector}
+		if operation.Operation == BatchDelete {
+			deleted := false
+			filter.Deleted = &deleted
+		} else {
+			inactive := true
+			filter.Inactive = &inactive
+		}
+		objects, err := store.RetrieveAllObjects(orgID, operation.ObjectType, filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range objects {
+			items = append(items, batchItem{operation: ObjectOperation{Operation: operation.Operation,
+				ObjectType: operation.ObjectType, ObjectID: object.ObjectID}, selected: true})
+		}
+	}
+	return items, nil
+}
+
+// checkObjectOperation verifies that an operation provides the parameters of its kind
+func checkObjectOperation(orgID string, operation ObjectOperation) common.SyncServiceError {
+	if operation.ObjectType == "" {
+		return &common.InvalidRequest{Message: "The operation doesn't include the object type"}
+	}
+	switch operation.Operation {
+	case BatchUpdate:
+		if operation.ObjectID == "" || operation.Meta == nil {
+			return &common.InvalidRequest{Message: "An update operation must include the object ID and the meta data"}
+		}
+		if operation.Labels != "" {
+			return &common.InvalidRequest{Message: "An update operation can't include labels"}
+		}
+		if operation.Meta.DestOrgID != "" && operation.Meta.DestOrgID != orgID {
+			return &common.InvalidRequest{Message: "The meta data of an update operation is of another organization"}
+		}
+	case BatchDelete, BatchActivate:
+		if (operation.ObjectID == "") == (operation.Labels == "") {
+			return &common.InvalidRequest{Message: fmt.Sprintf("A %s operation must include either the object ID or labels", operation.Operation)}
+		}
+		if operation.Meta != nil || operation.Data != nil {
+			return &common.InvalidRequest{Message: fmt.Sprintf("A %s operation can't include meta data or data", operation.Operation)}
+		}
+	default:
+		return &common.InvalidRequest{Message: fmt.Sprintf("Invalid operation %s", operation.Operation)}
+	}
+	return nil
+}
+
+// validateObjectOperation verifies that an operation on a single object can be applied
+func validateObjectOperation(orgID string, operation ObjectOperation) common.SyncServiceError {
+	if operation.Operation == BatchUpdate {
+		metaData := *operation.Meta
+		return validateObject(orgID, operation.ObjectType, operation.ObjectID, &metaData, operation.Data)
+	}
+
+	metaData, status, err := store.RetrieveObjectAndStatus(orgID, operation.ObjectType, operation.ObjectID)
+	if err != nil {
+		return err
+	}
+	if metaData == nil {
+		return &common.InvalidRequest{Message: "Object not found"}
+	}
+	if status != common.NotReadyToSend && status != common.ReadyToSend {
+		if operation.Operation == BatchActivate {
+			return &common.InvalidRequest{Message: "Can't activate object on the receiving side"}
+		}
+		if common.Configuration.NodeType == common.ESS {
+			return &common.InvalidRequest{Message: "Can't delete object on the receiving side for ESS"}
+		}
+	}
+	return nil
+}
+
+// applyObjectOperation applies an operation on a single object and prepares its notifications, the caller sends the notifications
+// This function should not acquire an object lock (apiObjectLocks) as the caller has already acquired one.
+func applyObjectOperation(orgID string, operation ObjectOperation) ([]common.NotificationInfo, common.SyncServiceError) {
+	switch operation.Operation {
+	case BatchUpdate:
+		// The update starts a new trace of the delivery of the object
+		span := tracing.StartDeliverySpan("UpdateObject", orgID, operation.ObjectType, operation.ObjectID, nil)
+		notificationsInfo, err := storeUpdatedObjectLocked(orgID, operation.ObjectType, operation.ObjectID, *operation.Meta, operation.Data)
+		span.End(err)
+		return notificationsInfo, err
+	case BatchDelete:
+		return deleteObjectLocked(orgID, operation.ObjectType, operation.ObjectID)
+	default:
+		return activateObjectLocked(orgID, operation.ObjectType, operation.ObjectID)
+	}
+}
+
+// takeObjectSnapshots takes a snapshot of each of the objects of the valid operations of a batch before the batch is applied.
+// The data of an object is kept only if an operation replaces or deletes it.
+// This function should not acquire an object lock (apiObjectLocks) as the caller has already acquired the locks of all the objects.
+func takeObjectSnapshots(orgID string, items []batchItem, results []ObjectOperationResult) ([]*objectSnapshot, common.SyncServiceError) {
+	snapshots := make([]*objectSnapshot, 0, len(items))
+	snapshotsByObject := make(map[string]*objectSnapshot)
+	for index, item := range items {
+		if results[index].Status != "" {
+			continue
+		}
+		key := item.operation.ObjectType + "/" + item.operation.ObjectID
+		snapshot, ok := snapshotsByObject[key]
+		if !ok {
+			snapshot = &objectSnapshot{objectType: item.operation.ObjectType, objectID: item.operation.ObjectID, keepData: true}
+			snapshotsByObject[key] = snapshot
+			snapshots = append(snapshots, snapshot)
+		}
+		if item.operation.Operation == BatchDelete || (item.operation.Operation == BatchUpdate && !item.operation.Meta.MetaOnly) {
+			snapshot.keepData = false
+		}
+	}
+
+	for _, snapshot := range snapshots {
+		metaData, status, err := store.RetrieveObjectAndStatus(orgID, snapshot.objectType, snapshot.objectID)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.metaData = metaData
+		snapshot.status = status
+		if metaData == nil || snapshot.keepData || metaData.NoData || metaData.Link != "" || metaData.SourceDataURI != "" {
+			continue
+		}
+
+		dataReader, err := store.RetrieveObjectData(orgID, snapshot.objectType, snapshot.objectID)
+		if err != nil {
+			return nil, err
+		}
+		if dataReader == nil {
+			continue
+		}
+		snapshot.data, err = ioutil.ReadAll(dataReader)
+		store.CloseDataReader(dataReader)
+		if err != nil {
+			return nil, &common.IOError{Message: "Failed to read the object's data. Error: " + err.Error()}
+		}
+	}
+	return snapshots, nil
+}
+
+// restoreObjectSnapshot restores an object to its snapshot and prepares the notifications of the restored object,
+// the caller sends the notifications. An object that didn't exist before the batch is removed.
+// The versions that the batch added to the object's version history are kept.
+// This function should not acquire an object lock (apiObjectLocks) as the caller has already acquired one.
+func restoreObjectSnapshot(orgID string, snapshot objectSnapshot) ([]common.NotificationInfo, common.SyncServiceError) {
+	lockIndex := common.HashStrings(orgID, snapshot.objectType, snapshot.objectID)
+	common.ObjectLocks.Lock(lockIndex)
+	defer common.ObjectLocks.Unlock(lockIndex)
+
+	if snapshot.metaData == nil {
+		// The notifications of the batch weren't sent, the destinations didn't receive the object
+		metaData, err := store.RetrieveObject(orgID, snapshot.objectType, snapshot.objectID)
+		if err != nil || metaData == nil {
+			return nil, err
+		}
+		if err := store.DeleteNotificationRecords(orgID, snapshot.objectType, snapshot.objectID, "", ""); err != nil {
+			return nil, err
+		}
+		if err := store.DeleteObjectVersions(orgID, snapshot.objectType, snapshot.objectID); err != nil {
+			return nil, err
+		}
+		return nil, storage.DeleteStoredObject(store, *metaData)
+	}
+
+	metaData := *snapshot.metaData
+	metaData.MetaOnly = snapshot.keepData
+	if snapshot.status != common.NotReadyToSend && snapshot.status != common.ReadyToSend {
+		// An object on the receiving side is restored without notifying the other side
+		_, err := store.StoreObject(metaData, snapshot.data, snapshot.status)
+		return nil, err
+	}
+	return storeObjectAndPrepareNotifications(metaData, snapshot.data, snapshot.status)
+}
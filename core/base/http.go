@@ -3,7 +3,9 @@ package base
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
@@ -182,10 +184,35 @@ func setupServerTLSConfig() error {
 		}
 	}
 
-	if err == nil {
-		secureHTTPServer.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	if err != nil {
+		return err
 	}
-	return err
+	secureHTTPServer.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	if len(common.Configuration.ClientCACertificate) != 0 {
+		// Clients may authenticate with certificates signed by the client CA
+		var caFile string
+		if strings.HasPrefix(common.Configuration.ClientCACertificate, "/") {
+			caFile = common.Configuration.ClientCACertificate
+		} else {
+			caFile = common.Configuration.PersistenceRootPath + common.Configuration.ClientCACertificate
+		}
+		certificate, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			if _, ok := err.(*os.PathError); !ok {
+				return err
+			}
+			// The ClientCACertificate is likely a value rather than a path
+			certificate = []byte(common.Configuration.ClientCACertificate)
+		}
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(certificate) {
+			return &common.SetupError{Message: "Failed to parse the ClientCACertificate"}
+		}
+		secureHTTPServer.TLSConfig.ClientCAs = caCertPool
+		secureHTTPServer.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return nil
 }
 
 func setupSwaggerServing(swaggerFile string, securely bool, ipAddress string, port uint16) {
@@ -0,0 +1,176 @@
+package base
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/communications"
+	"github.com/open-horizon/edge-sync-service/core/security"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+	"github.com/open-horizon/edge-utilities/logger/trace"
+)
+
+const (
+	counterMetric = "counter"
+	gaugeMetric   = "gauge"
+
+	metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// swagger:operation GET /metrics handleMetrics
+//
+// Get the metrics of the sync service node.
+//
+// Get the metrics of the sync service node in the Prometheus text format.
+//
+// ---
+//
+// tags:
+// - Health
+//
+// produces:
+// - text/plain
+//
+// responses:
+//   '200':
+//     description: Metrics
+//     schema:
+//       type: string
+//   '403':
+//     description: Unauthorized
+//     schema:
+//       type: string
+func handleMetrics(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("In handleMetrics\n")
+	}
+
+	code, _, _ := security.Authenticate(request)
+	if code == security.AuthFailed || code == security.AuthEdgeNode {
+		writer.WriteHeader(http.StatusForbidden)
+		writer.Write(unauthorizedBytes)
+		return
+	}
+
+	writer.Header().Add(contentType, metricsContentType)
+	writer.WriteHeader(http.StatusOK)
+	if _, err := writer.Write(buildMetrics()); err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Failed to write response body, error: " + err.Error())
+	}
+}
+
+func buildMetrics() []byte {
+	var registeredESS uint32
+	var storedObjects uint32
+	var notifications map[string]uint32
+	if store != nil {
+		if nodes, err := store.GetNumberOfDestinations(); err == nil {
+			registeredESS = nodes
+		}
+		if objects, err := store.GetNumberOfStoredObjects(); err == nil {
+			storedObjects = objects
+		}
+		notifications, _ = store.GetNumberOfNotificationsByStatus()
+	}
+	common.HealthStatus.UpdateHealthInfo(true, registeredESS, storedObjects)
+	usage := common.HealthStatus.GetUsage()
+	health, dbHealth, mqttHealth := common.HealthStatus.GetHealth()
+	traffic := common.HealthStatus.GetTraffic()
+
+	buffer := new(bytes.Buffer)
+	writeMetric(buffer, "sync_service_info", gaugeMetric, "Information about the sync service node",
+		fmt.Sprintf("{node_type=%q,version=%q}", common.Configuration.NodeType, common.VersionAsString()), 1)
+	writeMetric(buffer, "sync_service_uptime_seconds", gaugeMetric, "Time since the node started", "",
+		float64(health.UpTime))
+	writeMetric(buffer, "sync_service_health_status", gaugeMetric, "Health status of the node (0 - green, 1 - yellow, 2 - red)", "",
+		healthStatusValue(health.HealthStatus))
+
+	writeMetric(buffer, "sync_service_client_requests_total", counterMetric, "Number of requests received from applications", "",
+		float64(usage.ClientRequests))
+	writeMetric(buffer, "sync_service_registered_ess", gaugeMetric, "Number of registered ESS nodes", "",
+		float64(registeredESS))
+	writeMetric(buffer, "sync_service_stored_objects", gaugeMetric, "Number of objects received from applications", "",
+		float64(storedObjects))
+
+	writeMetric(buffer, "sync_service_db_connected", gaugeMetric, "Whether the node is connected to the database", "",
+		boolValue(!dbHealth.DisconnectedFromDB))
+	writeMetric(buffer, "sync_service_db_read_failures_total", counterMetric, "Number of database read failures", "",
+		float64(dbHealth.DBReadFailures))
+	writeMetric(buffer, "sync_service_db_write_failures_total", counterMetric, "Number of database write failures", "",
+		float64(dbHealth.DBWriteFailures))
+
+	if common.Configuration.CommunicationProtocol != common.HTTPProtocol {
+		writeMetric(buffer, "sync_service_mqtt_connected", gaugeMetric, "Whether the node is connected to the MQTT broker", "",
+			boolValue(!mqttHealth.DisconnectedFromMQTTBroker))
+		writeMetric(buffer, "sync_service_mqtt_publish_failures_total", counterMetric, "Number of MQTT publish failures", "",
+			float64(mqttHealth.PublishFailures))
+		writeMetric(buffer, "sync_service_mqtt_subscribe_failures_total", counterMetric, "Number of MQTT subscribe failures", "",
+			float64(mqttHealth.SubscribeFailures))
+	}
+
+	writeMetric(buffer, "sync_service_inflight_chunks", gaugeMetric, "Number of chunks of data requested and not received yet", "",
+		float64(communications.GetNumberOfInflightChunks()))
+
+	statuses := make([]string, 0, len(notifications))
+	for status := range notifications {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	writeMetricHeader(buffer, "sync_service_notifications", gaugeMetric, "Number of notifications by status")
+	for _, status := range statuses {
+		writeMetricValue(buffer, "sync_service_notifications", fmt.Sprintf("{status=%q}", status), float64(notifications[status]))
+	}
+
+	writeMetric(buffer, "sync_service_notification_resends_total", counterMetric, "Number of notifications resent", "",
+		float64(traffic.NotificationResends))
+
+	writeMetricHeader(buffer, "sync_service_bytes_sent_total", counterMetric, "Number of bytes sent by protocol")
+	writeMetricValue(buffer, "sync_service_bytes_sent_total", `{protocol="mqtt"}`, float64(traffic.MQTTBytesSent))
+	writeMetricValue(buffer, "sync_service_bytes_sent_total", `{protocol="http"}`, float64(traffic.HTTPBytesSent))
+	writeMetricHeader(buffer, "sync_service_bytes_received_total", counterMetric, "Number of bytes received by protocol")
+	writeMetricValue(buffer, "sync_service_bytes_received_total", `{protocol="mqtt"}`, float64(traffic.MQTTBytesReceived))
+	writeMetricValue(buffer, "sync_service_bytes_received_total", `{protocol="http"}`, float64(traffic.HTTPBytesReceived))
+
+	return buffer.Bytes()
+}
+
+func writeMetric(buffer *bytes.Buffer, name string, metricType string, help string, labels string, value float64) {
+	writeMetricHeader(buffer, name, metricType, help)
+	writeMetricValue(buffer, name, labels, value)
+}
+
+func writeMetricHeader(buffer *bytes.Buffer, name string, metricType string, help string) {
+	fmt.Fprintf(buffer, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+func writeMetricValue(buffer *bytes.Buffer, name string, labels string, value float64) {
+	fmt.Fprintf(buffer, "%s%s %s\n", name, labels, strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+func healthStatusValue(status string) float64 {
+	switch status {
+	case common.Green:
+		return 0
+	case common.Yellow:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func boolValue(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
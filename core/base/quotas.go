@@ -0,0 +1,195 @@
+package base
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+// orgQuotaLocks serialize the updates of the objects of an organization whose usage is limited, so that concurrent
+// updates don't exceed the limits. An organization's quota lock is taken after the object's locks (apiObjectLocks
+// and common.ObjectLocks).
+// The locks are local to this process: when several CSS instances share the storage, concurrent updates of an
+// organization's objects through different instances may together exceed the organization's limits by the size
+// of the updates that are stored concurrently.
+var orgQuotaLocks common.Locks
+
+func init() {
+	orgQuotaLocks = *common.NewLocks("quota")
+}
+
+// orgQuota is the limits of the objects stored by an organization, a zero limit means no limit
+type orgQuota struct {
+	maxObjects    int
+	maxDataSize   int64
+	maxObjectSize int64
+}
+
+// getOrgQuota returns the limits of an organization, the limits the organization doesn't specify are taken from the configuration
+func getOrgQuota(orgID string) (orgQuota, common.SyncServiceError) {
+	quota := orgQuota{maxObjects: common.Configuration.OrgMaxObjects, maxDataSize: common.Configuration.OrgMaxDataSize,
+		maxObjectSize: common.Configuration.OrgMaxObjectSize}
+	org, err := store.RetrieveOrganizationInfo(orgID)
+	if err != nil {
+		return quota, err
+	}
+	if org != nil {
+		if org.Org.MaxObjects > 0 {
+			quota.maxObjects = org.Org.MaxObjects
+		}
+		if org.Org.MaxDataSize > 0 {
+			quota.maxDataSize = org.Org.MaxDataSize
+		}
+		if org.Org.MaxObjectSize > 0 {
+			quota.maxObjectSize = org.Org.MaxObjectSize
+		}
+	}
+	return quota, nil
+}
+
+// getOrgUsage returns the number of objects and bytes of data stored by an organization.
+// The data of the versions in the version history of the objects is included in the bytes of data.
+func getOrgUsage(orgID string) (common.OrganizationUsage, common.SyncServiceError) {
+	usage, err := store.RetrieveOrganizationsUsage(orgID)
+	if err != nil || len(usage) == 0 {
+		return common.OrganizationUsage{OrgID: orgID}, err
+	}
+	return usage[0], nil
+}
+
+// checkObjectQuota verifies that storing an object with data of the given size doesn't exceed the limits of its organization.
+// If keepData is true, the object keeps the data it already has.
+// If the organization's usage is limited, the organization's quota lock is held until the returned release function is called,
+// the caller calls it once the object is stored.
+func checkObjectQuota(metaData common.MetaData, size int64, keepData bool) (func(), common.SyncServiceError) {
+	orgID := metaData.DestOrgID
+	quota, err := getOrgQuota(orgID)
+	if err != nil {
+		return nil, err
+	}
+	if quota == (orgQuota{}) {
+		return func() {}, nil
+	}
+	if quota.maxObjects == 0 && quota.maxDataSize == 0 {
+		// Only the size of the object is limited, the organization's usage isn't checked
+		return func() {}, checkOrgUsage(metaData, size, keepData, quota)
+	}
+
+	lockIndex := common.HashStrings(orgID)
+	orgQuotaLocks.Lock(lockIndex)
+	if err := checkOrgUsage(metaData, size, keepData, quota); err != nil {
+		orgQuotaLocks.Unlock(lockIndex)
+		return nil, err
+	}
+	return func() { orgQuotaLocks.Unlock(lockIndex) }, nil
+}
+
+// checkOrgUsage verifies that storing the object doesn't exceed the limits of its organization
+// This function should not acquire the organization's quota lock (orgQuotaLocks) as the caller has already acquired it
+// if the organization's usage is limited.
+func checkOrgUsage(metaData common.MetaData, size int64, keepData bool, quota orgQuota) common.SyncServiceError {
+	orgID := metaData.DestOrgID
+
+	// The size of the data of the object that is replaced, or -1 if the object is new
+	existingSize := int64(-1)
+	existingMetaData, status, err := store.RetrieveObjectAndStatus(orgID, metaData.ObjectType, metaData.ObjectID)
+	if err != nil {
+		return err
+	}
+	if existingMetaData != nil && (status == common.ReadyToSend || status == common.NotReadyToSend) {
+		existingSize = existingMetaData.ObjectSize
+		if keepData {
+			size = existingSize
+		}
+	}
+
+	if quota.maxObjectSize > 0 && size > quota.maxObjectSize {
+		return &common.InvalidRequest{Message: fmt.Sprintf("The size of the object's data (%d bytes) exceeds the limit of %d bytes of organization %s",
+			size, quota.maxObjectSize, orgID)}
+	}
+	if quota.maxDataSize == 0 && (quota.maxObjects == 0 || existingSize >= 0) {
+		return nil
+	}
+
+	usage, err := getOrgUsage(orgID)
+	if err != nil {
+		return err
+	}
+	if existingSize < 0 {
+		if quota.maxObjects > 0 && int64(usage.StoredObjects) >= int64(quota.maxObjects) {
+			return &common.InvalidRequest{Message: fmt.Sprintf("Organization %s reached its limit of %d objects", orgID, quota.maxObjects)}
+		}
+		existingSize = 0
+	}
+	if quota.maxDataSize > 0 && usage.StoredBytes-replacedDataSize(metaData.ObjectType, existingSize)+size > quota.maxDataSize {
+		return &common.InvalidRequest{Message: fmt.Sprintf("Storing the object's data (%d bytes) exceeds the limit of %d bytes of data of organization %s",
+			size, quota.maxDataSize, orgID)}
+	}
+	return nil
+}
+
+// replacedDataSize returns the size of the data that is freed when the data of an object of the given size is replaced,
+// which is zero if the replaced data is kept in the version history of the object
+func replacedDataSize(objectType string, existingSize int64) int64 {
+	if common.GetMaxObjectVersions(objectType) > 0 {
+		return 0
+	}
+	return existingSize
+}
+
+// maxObjectDataSize returns the maximal size of the data that can replace the data of an existing object of the given size
+// without exceeding the limits of its organization, or -1 if the size isn't limited.
+// If the total size of the organization's data is limited, the organization's quota lock is held until the returned release
+// function is called, the caller calls it once the data is stored.
+func maxObjectDataSize(orgID string, objectType string, existingSize int64) (int64, func(), common.SyncServiceError) {
+	quota, err := getOrgQuota(orgID)
+	if err != nil {
+		return -1, nil, err
+	}
+	maxSize := int64(-1)
+	if quota.maxObjectSize > 0 {
+		maxSize = quota.maxObjectSize
+	}
+	release := func() {}
+	if quota.maxDataSize > 0 {
+		lockIndex := common.HashStrings(orgID)
+		orgQuotaLocks.Lock(lockIndex)
+		release = func() { orgQuotaLocks.Unlock(lockIndex) }
+
+		usage, err := getOrgUsage(orgID)
+		if err != nil {
+			release()
+			return -1, nil, err
+		}
+		available := quota.maxDataSize - usage.StoredBytes + replacedDataSize(objectType, existingSize)
+		if available < 0 {
+			available = 0
+		}
+		if maxSize < 0 || available < maxSize {
+			maxSize = available
+		}
+	}
+	return maxSize, release, nil
+}
+
+// quotaReader reads the data of an object and fails if the data is larger than the maximal size
+type quotaReader struct {
+	reader    io.Reader
+	remaining int64
+	exceeded  bool
+}
+
+func (reader *quotaReader) Read(p []byte) (int, error) {
+	if reader.remaining < int64(len(p)) {
+		// Read one byte beyond the limit to detect data that exceeds it
+		p = p[:reader.remaining+1]
+	}
+	n, err := reader.reader.Read(p)
+	reader.remaining -= int64(n)
+	if reader.remaining < 0 {
+		reader.exceeded = true
+		return 0, &common.InvalidRequest{Message: "The object's data exceeds the limits of its organization"}
+	}
+	return n, err
+}
@@ -128,10 +128,13 @@ func StandaloneSyncService(auth security.Authentication) {
 
 func censorAndDumpConfig() {
 	toBeCensored := []*string{&common.Configuration.ServerCertificate, &common.Configuration.ServerKey,
-		&common.Configuration.HTTPCSSCACertificate,
+		&common.Configuration.HTTPCSSCACertificate, &common.Configuration.HTTPCSSClientCertificate,
+		&common.Configuration.HTTPCSSClientKey, &common.Configuration.ClientCACertificate,
 		&common.Configuration.MQTTUserName, &common.Configuration.MQTTPassword,
 		&common.Configuration.MQTTCACertificate, &common.Configuration.MQTTSSLCert, &common.Configuration.MQTTSSLKey,
-		&common.Configuration.MongoUsername, &common.Configuration.MongoPassword, &common.Configuration.MongoCACertificate}
+		&common.Configuration.MongoUsername, &common.Configuration.MongoPassword, &common.Configuration.MongoCACertificate,
+		&common.Configuration.PostgresUsername, &common.Configuration.PostgresPassword,
+		&common.Configuration.S3AccessKeyID, &common.Configuration.S3SecretAccessKey}
 	backups := make([]string, len(toBeCensored))
 
 	for index, fieldPointer := range toBeCensored {
@@ -157,6 +157,15 @@ func (communication *Wrapper) GetData(metaData common.MetaData, offset int64) co
 	return comm.GetData(metaData, offset)
 }
 
+// GetDelta requests a delta of the data of an updated object from the CSS
+func (communication *Wrapper) GetDelta(metaData common.MetaData, signature []byte) common.SyncServiceError {
+	comm, err := communication.selectCommunicator("", metaData.DestOrgID, metaData.OriginType, metaData.OriginID)
+	if err != nil {
+		return err
+	}
+	return comm.GetDelta(metaData, signature)
+}
+
 // SendData sends data from the CSS to the ESS or from the ESS to the CSS
 func (communication *Wrapper) SendData(orgID string, destType string, destID string, message []byte, chunked bool) common.SyncServiceError {
 	comm, err := communication.selectCommunicator("", orgID, destType, destID)
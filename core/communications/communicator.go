@@ -50,6 +50,10 @@ type Communicator interface {
 	// GetData requests data to be sent from the CSS to the ESS or from the ESS to the CSS
 	GetData(metaData common.MetaData, offset int64) common.SyncServiceError
 
+	// GetDelta requests a delta of the data of an updated object from the version of the data described by the signature.
+	// If an error is returned, the whole data has to be requested.
+	GetDelta(metaData common.MetaData, signature []byte) common.SyncServiceError
+
 	// SendData sends data from the CSS to the ESS or from the ESS to the CSS
 	SendData(orgID string, destType string, destID string, message []byte, chunked bool) common.SyncServiceError
 
@@ -99,6 +103,14 @@ func isIgnoredByHandler(err error) bool {
 	return ok
 }
 
+// spanError returns the error to be recorded in the span of handling a message, messages ignored by the handler are not errors
+func spanError(err common.SyncServiceError) error {
+	if err == nil || isIgnoredByHandler(err) {
+		return nil
+	}
+	return err
+}
+
 // Store is a reference to the Storage being used
 var Store storage.Storage
 
@@ -154,3 +166,13 @@ func destinationExists(orgID string, destType string, destID string) bool {
 	}
 	return true
 }
+
+// destinationProperties returns the properties of the ESS that are sent to the CSS when it registers,
+// they are validated with the configuration
+func destinationProperties() map[string]string {
+	properties, _ := common.ParseDestinationProperties(common.Configuration.DestinationProperties)
+	if len(properties) == 0 {
+		return nil
+	}
+	return properties
+}
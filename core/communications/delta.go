@@ -0,0 +1,303 @@
+package communications
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/dataURI"
+	"github.com/open-horizon/edge-sync-service/core/delta"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+	"github.com/open-horizon/edge-utilities/logger/trace"
+)
+
+// The delta transfer of an updated object works as follows:
+//  1. Before storing the updated object, the ESS copies the data of the previous version of the object
+//     to a base file and computes its signature (prepareDeltaBase).
+//  2. Instead of requesting the data, the ESS sends a getdelta request with the signature (Comm.GetDelta).
+//  3. The CSS computes the delta of the new data from the signature (handleGetDelta), and sends it to the ESS.
+//     If the delta is too large, no delta is sent.
+//  4. The ESS creates the new data from the base file and the delta, and stores it (applyDelta).
+//     If there is no delta, or it can't be applied, the ESS requests the whole data.
+
+// prepareDeltaBase saves the data of the existing version of the object to be used as the base of a delta,
+// and returns the encoded signature of the data. nil is returned if the delta transfer can't be used for the object.
+// It has to be called with the object locked, before the updated object is stored.
+func prepareDeltaBase(metaData common.MetaData) []byte {
+	if !common.Configuration.EnableDeltaTransfer || common.Configuration.NodeType != common.ESS ||
+		metaData.DestinationDataURI != "" || metaData.MetaOnly || metaData.ObjectSize <= int64(common.Configuration.MaxDataChunkSize) {
+		return nil
+	}
+
+	existing, status, err := Store.RetrieveObjectAndStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if err != nil || existing == nil || existing.DataID == metaData.DataID || existing.NoData || existing.Link != "" ||
+		existing.DestinationDataURI != "" || existing.ObjectSize <= 0 ||
+		(status != common.CompletelyReceived && status != common.ObjReceived && status != common.ObjConsumed) {
+		return nil
+	}
+
+	dataReader, err := Store.RetrieveObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if err != nil || dataReader == nil {
+		return nil
+	}
+	defer Store.CloseDataReader(dataReader)
+
+	path := deltaBasePath(metaData)
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Failed to create the directory of the delta base files. Error: %s\n", err)
+		}
+		return nil
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Failed to create the delta base file of %s:%s. Error: %s\n", metaData.ObjectType, metaData.ObjectID, err)
+		}
+		return nil
+	}
+
+	signature, err := delta.ComputeSignature(io.TeeReader(dataReader, file), existing.ObjectSize)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Failed to save the delta base of %s:%s. Error: %s\n", metaData.ObjectType, metaData.ObjectID, err)
+		}
+		os.Remove(path)
+		return nil
+	}
+
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Saved the delta base of %s:%s (%d bytes)\n", metaData.ObjectType, metaData.ObjectID, signature.Size())
+	}
+	return signature.Encode()
+}
+
+func deltaBasePath(metaData common.MetaData) string {
+	name := url.QueryEscape(metaData.DestOrgID) + ":" + url.QueryEscape(metaData.ObjectType) + ":" + url.QueryEscape(metaData.ObjectID)
+	return filepath.Join(common.Configuration.PersistenceRootPath, "sync", "delta", name)
+}
+
+func removeDeltaBase(metaData common.MetaData) {
+	if err := os.Remove(deltaBasePath(metaData)); err != nil && !os.IsNotExist(err) && log.IsLogging(logger.ERROR) {
+		log.Error("Failed to remove the delta base of %s:%s. Error: %s\n", metaData.ObjectType, metaData.ObjectID, err)
+	}
+}
+
+// handleGetDelta computes the delta of the object's data from the version of the data described by the signature.
+// It returns nil and no error if the delta can't be used and the whole data has to be sent.
+func handleGetDelta(metaData common.MetaData, signatureData []byte, maxSize int) ([]byte, common.SyncServiceError) {
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Handling delta request for %s %s\n", metaData.ObjectType, metaData.ObjectID)
+	}
+
+	lockIndex := common.HashStrings(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	common.ObjectLocks.RLock(lockIndex)
+	defer common.ObjectLocks.RUnlock(lockIndex)
+
+	notification, err := Store.RetrieveNotificationRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
+		metaData.DestType, metaData.DestID)
+	if err != nil || notification == nil {
+		return nil, &ignoredByHandler{}
+	}
+	if notification.InstanceID != metaData.InstanceID ||
+		(notification.Status != common.Update && notification.Status != common.Updated && notification.Status != common.Data) {
+		// This notification doesn't match the existing notification record, ignore
+		if trace.IsLogging(logger.TRACE) {
+			trace.Trace("Ignoring delta request of %s %s\n", metaData.ObjectType, metaData.ObjectID)
+		}
+		return nil, &ignoredByHandler{}
+	}
+
+	if !common.Configuration.EnableDeltaTransfer {
+		return nil, nil
+	}
+	signature, err := delta.DecodeSignature(signatureData)
+	if err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Received an invalid signature for %s:%s. Error: %s\n", metaData.ObjectType, metaData.ObjectID, err)
+		}
+		return nil, nil
+	}
+
+	if maxSize <= 0 || maxSize > common.Configuration.MaxDeltaSize {
+		maxSize = common.Configuration.MaxDeltaSize
+	}
+	if int64(maxSize) > metaData.ObjectSize/2 {
+		maxSize = int(metaData.ObjectSize / 2)
+	}
+
+	var dataReader io.Reader
+	if metaData.SourceDataURI != "" {
+		dataReader, err = dataURI.GetData(metaData.SourceDataURI)
+	} else {
+		dataReader, err = Store.RetrieveObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if dataReader == nil {
+		return nil, &common.NotFound{}
+	}
+	defer Store.CloseDataReader(dataReader)
+
+	deltaData, err := delta.ComputeDelta(signature, dataReader, maxSize)
+	if err != nil {
+		if delta.IsTooLarge(err) {
+			if trace.IsLogging(logger.TRACE) {
+				trace.Trace("The delta of %s:%s is too large, sending the whole data\n", metaData.ObjectType, metaData.ObjectID)
+			}
+			return nil, nil
+		}
+		return nil, &notificationHandlerError{fmt.Sprintf("Error in handleGetDelta: failed to compute delta. Error: %s\n", err)}
+	}
+
+	if err := Store.UpdateNotificationRecord(
+		common.Notification{ObjectID: metaData.ObjectID, ObjectType: metaData.ObjectType,
+			DestOrgID: metaData.DestOrgID, DestID: metaData.DestID, DestType: metaData.DestType,
+			Status: common.Data, InstanceID: metaData.InstanceID, DataID: metaData.DataID},
+	); err != nil {
+		return nil, &notificationHandlerError{fmt.Sprintf("Error in handleGetDelta: failed to update notification record. Error: %s\n", err)}
+	}
+
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Computed a delta of %d bytes for %s:%s (%d bytes)\n", len(deltaData), metaData.ObjectType, metaData.ObjectID,
+			metaData.ObjectSize)
+	}
+	return deltaData, nil
+}
+
+// handleDelta handles a delta sent in response to a getdelta request. If there is no delta, or it can't be applied,
+// the whole data is requested.
+func handleDelta(metaData common.MetaData, deltaData []byte, maxInflightChunks int) common.SyncServiceError {
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Handling delta of %s %s\n", metaData.ObjectType, metaData.ObjectID)
+	}
+
+	lockIndex := common.HashStrings(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	Comm.LockDataChunks(lockIndex, &metaData)
+	defer Comm.UnlockDataChunks(lockIndex, &metaData)
+
+	common.ObjectLocks.Lock(lockIndex)
+	storedMetaData, err := Store.RetrieveObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if err != nil || storedMetaData == nil {
+		common.ObjectLocks.Unlock(lockIndex)
+		removeDeltaBase(metaData)
+		return &notificationHandlerError{"Error in handleDelta: failed to find meta data.\n"}
+	}
+	if _, err := checkNotificationRecord(*storedMetaData, storedMetaData.OriginType, storedMetaData.OriginID,
+		metaData.InstanceID, common.Getdata, 0); err != nil {
+		// This delta doesn't match the existing notification record, ignore
+		if trace.IsLogging(logger.INFO) {
+			trace.Info("Ignoring delta of %s %s (%s)\n", metaData.ObjectType, metaData.ObjectID, err.Error())
+		}
+		common.ObjectLocks.Unlock(lockIndex)
+		return &ignoredByHandler{}
+	}
+	common.ObjectLocks.Unlock(lockIndex)
+
+	if len(deltaData) > 0 {
+		err := applyDelta(*storedMetaData, deltaData)
+		if err == nil || isIgnoredByHandler(err) {
+			return nil
+		}
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Failed to apply the delta of %s:%s, requesting the whole data. Error: %s\n",
+				metaData.ObjectType, metaData.ObjectID, err)
+		}
+	} else {
+		removeDeltaBase(*storedMetaData)
+	}
+
+	return requestObjectData(*storedMetaData, maxInflightChunks)
+}
+
+// applyDelta creates the object's data from the delta and the base saved by prepareDeltaBase, stores it,
+// and marks the object as completely received
+func applyDelta(metaData common.MetaData, deltaData []byte) common.SyncServiceError {
+	defer removeDeltaBase(metaData)
+
+	base, err := os.Open(deltaBasePath(metaData))
+	if err != nil {
+		return &notificationHandlerError{"Error in applyDelta: failed to open the delta base. Error: " + err.Error()}
+	}
+	defer base.Close()
+	info, err := base.Stat()
+	if err != nil {
+		return &notificationHandlerError{"Error in applyDelta: failed to open the delta base. Error: " + err.Error()}
+	}
+
+	lockIndex := common.HashStrings(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	common.ObjectLocks.Lock(lockIndex)
+
+	storedMetaData, status, err := Store.RetrieveObjectAndStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if err != nil || storedMetaData == nil || storedMetaData.InstanceID != metaData.InstanceID || status != common.PartiallyReceived {
+		// The object has been updated or deleted in the meantime
+		common.ObjectLocks.Unlock(lockIndex)
+		return &ignoredByHandler{}
+	}
+
+	dataReader, dataWriter := io.Pipe()
+	go func() {
+		_, err := delta.ApplyDelta(base, info.Size(), deltaData, dataWriter)
+		dataWriter.CloseWithError(err)
+	}()
+	found, err := Store.StoreObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, dataReader)
+	dataReader.Close()
+	if err != nil {
+		common.ObjectLocks.Unlock(lockIndex)
+		return err
+	} else if !found {
+		common.ObjectLocks.Unlock(lockIndex)
+		return &Error{"Failed to store object's data."}
+	}
+
+	if err := verifyDataHash(metaData); err != nil {
+		// The whole data is requested
+		common.ObjectLocks.Unlock(lockIndex)
+		return err
+	}
+	if err := verifyReceivedObject(metaData); err != nil {
+		common.ObjectLocks.Unlock(lockIndex)
+		return rejectObject(metaData, err)
+	}
+	if err := Store.UpdateObjectStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, common.CompletelyReceived); err != nil {
+		common.ObjectLocks.Unlock(lockIndex)
+		return &Error{fmt.Sprintf("Error in applyDelta: %s\n", err)}
+	}
+
+	handleDataReceived(metaData)
+
+	notificationsInfo, err := PrepareObjectStatusNotification(metaData, common.Received)
+	common.ObjectLocks.Unlock(lockIndex)
+	if err != nil {
+		return err
+	}
+	if err := SendNotifications(notificationsInfo); err != nil {
+		return err
+	}
+
+	callWebhooks(&metaData)
+	return nil
+}
+
+// requestObjectData requests the whole data of the object
+func requestObjectData(metaData common.MetaData, maxInflightChunks int) common.SyncServiceError {
+	if metaData.ChunkSize <= 0 || metaData.ObjectSize <= 0 {
+		return Comm.GetData(metaData, 0)
+	}
+	var offset int64
+	for i := 0; i < maxInflightChunks && offset < metaData.ObjectSize; i++ {
+		if err := Comm.GetData(metaData, offset); err != nil {
+			return err
+		}
+		offset += int64(metaData.ChunkSize)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package communications
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/delta"
+	"github.com/open-horizon/edge-sync-service/core/storage"
+)
+
+func TestDeltaTransfer(t *testing.T) {
+	common.InitObjectLocks()
+
+	dir, _ := os.Getwd()
+	common.Configuration.PersistenceRootPath = dir + "/persist"
+	common.Configuration.NodeType = common.ESS
+	common.Configuration.StorageProvider = common.Bolt
+	common.Configuration.MaxDataChunkSize = 4096
+	common.Configuration.MaxDeltaSize = 1024 * 1024
+	common.Configuration.EnableDeltaTransfer = true
+	defer func() { common.Configuration.EnableDeltaTransfer = false }()
+
+	boltStore := &storage.BoltStorage{}
+	boltStore.Cleanup()
+	Store = boltStore
+	if err := Store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+	}
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	random := rand.New(rand.NewSource(1))
+	baseData := make([]byte, 64*1024)
+	random.Read(baseData)
+	newData := append([]byte{}, baseData...)
+	copy(newData[30000:], []byte("some new data"))
+
+	tests := []struct {
+		objectID   string
+		sendDelta  bool
+		corrupt    bool
+		complete   bool
+		expectData []byte
+	}{
+		{"1", true, false, true, newData},
+		{"2", false, false, false, nil},
+		{"3", true, true, false, nil},
+	}
+
+	for _, row := range tests {
+		metaData := common.MetaData{ObjectID: row.objectID, ObjectType: "type1", DestOrgID: "myorg", DestID: "dev1", DestType: "device",
+			OriginID: "123", OriginType: "type2", ObjectSize: int64(len(baseData)), ChunkSize: 4096, InstanceID: 1, DataID: 1}
+		if _, err := Store.StoreObject(metaData, baseData, common.CompletelyReceived); err != nil {
+			t.Errorf("Failed to store object (objectID = %s). Error: %s", row.objectID, err.Error())
+			continue
+		}
+
+		metaData.InstanceID = 2
+		metaData.DataID = 2
+		metaData.ObjectSize = int64(len(newData))
+		if err := handleUpdate(metaData, 1, nil); err != nil {
+			t.Errorf("handleUpdate failed (objectID = %s). Error: %s", row.objectID, err.Error())
+			continue
+		}
+		base, err := ioutil.ReadFile(deltaBasePath(metaData))
+		if err != nil || !bytes.Equal(base, baseData) {
+			t.Errorf("The delta base wasn't saved (objectID = %s). Error: %v", row.objectID, err)
+			continue
+		}
+
+		var deltaData []byte
+		if row.sendDelta {
+			signature, _ := delta.ComputeSignature(bytes.NewReader(baseData), int64(len(baseData)))
+			deltaData, err = delta.ComputeDelta(signature, bytes.NewReader(newData), len(newData)/2)
+			if err != nil {
+				t.Errorf("Failed to compute delta (objectID = %s). Error: %s", row.objectID, err.Error())
+				continue
+			}
+			if row.corrupt {
+				deltaData[len(deltaData)-1] ^= 0xff
+			}
+		}
+
+		if err := handleDelta(metaData, deltaData, 1); err != nil {
+			t.Errorf("handleDelta failed (objectID = %s). Error: %s", row.objectID, err.Error())
+		}
+		if _, err := os.Stat(deltaBasePath(metaData)); !os.IsNotExist(err) {
+			t.Errorf("The delta base wasn't removed (objectID = %s)", row.objectID)
+		}
+
+		status, err := Store.RetrieveObjectStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+		if err != nil {
+			t.Errorf("Failed to retrieve object's status (objectID = %s). Error: %s", row.objectID, err.Error())
+			continue
+		}
+		if row.complete {
+			if status != common.CompletelyReceived {
+				t.Errorf("Wrong status (objectID = %s): %s instead of %s", row.objectID, status, common.CompletelyReceived)
+			}
+			dataReader, err := Store.RetrieveObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+			if err != nil || dataReader == nil {
+				t.Errorf("Failed to retrieve object's data (objectID = %s). Error: %v", row.objectID, err)
+				continue
+			}
+			data, _ := ioutil.ReadAll(dataReader)
+			Store.CloseDataReader(dataReader)
+			if !bytes.Equal(data, row.expectData) {
+				t.Errorf("Wrong data (objectID = %s)", row.objectID)
+			}
+		} else {
+			// The whole data was requested
+			if status != common.PartiallyReceived {
+				t.Errorf("Wrong status (objectID = %s): %s instead of %s", row.objectID, status, common.PartiallyReceived)
+			}
+			notification, err := Store.RetrieveNotificationRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
+				metaData.OriginType, metaData.OriginID)
+			if err != nil || notification == nil || notification.Status != common.Getdata {
+				t.Errorf("No getdata notification (objectID = %s). Error: %v", row.objectID, err)
+			}
+		}
+	}
+
+	// No delta for objects without previous data
+	metaData := common.MetaData{ObjectID: "4", ObjectType: "type1", DestOrgID: "myorg", DestID: "dev1", DestType: "device",
+		OriginID: "123", OriginType: "type2", ObjectSize: int64(len(newData)), ChunkSize: 4096, InstanceID: 1, DataID: 1}
+	if err := handleUpdate(metaData, 1, nil); err != nil {
+		t.Errorf("handleUpdate failed. Error: %s", err.Error())
+	}
+	if _, err := os.Stat(deltaBasePath(metaData)); !os.IsNotExist(err) {
+		t.Errorf("A delta base was saved for a new object")
+	}
+}
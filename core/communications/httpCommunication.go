@@ -17,6 +17,7 @@ import (
 	"github.com/open-horizon/edge-sync-service/common"
 	"github.com/open-horizon/edge-sync-service/core/dataURI"
 	"github.com/open-horizon/edge-sync-service/core/security"
+	"github.com/open-horizon/edge-sync-service/core/tracing"
 	"github.com/open-horizon/edge-utilities/logger"
 	"github.com/open-horizon/edge-utilities/logger/log"
 	"github.com/open-horizon/edge-utilities/logger/trace"
@@ -39,8 +40,9 @@ type HTTP struct {
 }
 
 type updateMessage struct {
-	Type     string
-	MetaData common.MetaData
+	Type         string
+	MetaData     common.MetaData
+	TraceContext map[string]string
 }
 
 type feedbackMessage struct {
@@ -52,12 +54,13 @@ type feedbackMessage struct {
 // StartCommunication starts communications
 func (communication *HTTP) StartCommunication() common.SyncServiceError {
 	if common.Configuration.NodeType == common.CSS {
-		http.Handle(registerURL, http.StripPrefix(registerURL, http.HandlerFunc(communication.handleRegister)))
-		http.Handle(registerNewURL, http.StripPrefix(registerNewURL, http.HandlerFunc(communication.handleRegisterNew)))
-		http.Handle(pingURL, http.StripPrefix(pingURL, http.HandlerFunc(communication.handlePing)))
-		http.Handle(objectRequestURL, http.StripPrefix(objectRequestURL, http.HandlerFunc(communication.handleObjects)))
+		http.Handle(registerURL, countTraffic(http.StripPrefix(registerURL, http.HandlerFunc(communication.handleRegister))))
+		http.Handle(registerNewURL, countTraffic(http.StripPrefix(registerNewURL, http.HandlerFunc(communication.handleRegisterNew))))
+		http.Handle(pingURL, countTraffic(http.StripPrefix(pingURL, http.HandlerFunc(communication.handlePing))))
+		http.Handle(objectRequestURL, countTraffic(http.StripPrefix(objectRequestURL, http.HandlerFunc(communication.handleObjects))))
 	} else {
 		communication.httpClient = http.Client{Transport: &http.Transport{}}
+		var tlsConfig *tls.Config
 		if common.Configuration.HTTPCSSUseSSL && len(common.Configuration.HTTPCSSCACertificate) > 0 {
 			var caFile string
 			if strings.HasPrefix(common.Configuration.HTTPCSSCACertificate, "/") {
@@ -77,7 +80,20 @@ func (communication *HTTP) StartCommunication() common.SyncServiceError {
 			}
 			caCertPool := x509.NewCertPool()
 			caCertPool.AppendCertsFromPEM(certificate)
-			tlsConfig := &tls.Config{RootCAs: caCertPool}
+			tlsConfig = &tls.Config{RootCAs: caCertPool}
+		}
+		if common.Configuration.HTTPCSSUseSSL && len(common.Configuration.HTTPCSSClientCertificate) > 0 {
+			// The ESS authenticates with its client certificate
+			clientCert, err := loadHTTPClientCertificate()
+			if err != nil {
+				return &Error{"Failed to load the HTTP client certificate. Error: " + err.Error()}
+			}
+			if tlsConfig == nil {
+				tlsConfig = &tls.Config{}
+			}
+			tlsConfig.Certificates = []tls.Certificate{clientCert}
+		}
+		if tlsConfig != nil {
 			communication.httpClient.Transport = &http.Transport{TLSClientConfig: tlsConfig}
 		}
 		communication.httpPollStopChannel = make(chan int, 1)
@@ -88,6 +104,30 @@ func (communication *HTTP) StartCommunication() common.SyncServiceError {
 	return nil
 }
 
+func loadHTTPClientCertificate() (tls.Certificate, error) {
+	var certFile, keyFile string
+	if strings.HasPrefix(common.Configuration.HTTPCSSClientCertificate, "/") {
+		certFile = common.Configuration.HTTPCSSClientCertificate
+	} else {
+		certFile = common.Configuration.PersistenceRootPath + common.Configuration.HTTPCSSClientCertificate
+	}
+	if strings.HasPrefix(common.Configuration.HTTPCSSClientKey, "/") {
+		keyFile = common.Configuration.HTTPCSSClientKey
+	} else {
+		keyFile = common.Configuration.PersistenceRootPath + common.Configuration.HTTPCSSClientKey
+	}
+
+	clientCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		if _, ok := err.(*os.PathError); ok {
+			// The HTTPCSSClientCertificate and HTTPCSSClientKey are likely pem file contents
+			clientCert, err = tls.X509KeyPair([]byte(common.Configuration.HTTPCSSClientCertificate),
+				[]byte(common.Configuration.HTTPCSSClientKey))
+		}
+	}
+	return clientCert, err
+}
+
 func (communication *HTTP) startPolling() {
 	configuredInterval := int(common.Configuration.HTTPPollingInterval) * 1000
 	go func() {
@@ -167,6 +207,14 @@ func (communication *HTTP) handleGetUpdates(writer http.ResponseWriter, request
 		return
 	}
 
+	if wait := security.CheckESSPollingRateLimit(orgID, destType, destID); wait > 0 {
+		if trace.IsLogging(logger.DEBUG) {
+			trace.Debug("Polling rate limit exceeded by %s/%s/%s, retry after %s\n", orgID, destType, destID, wait)
+		}
+		security.SendTooManyRequests(writer, wait)
+		return
+	}
+
 	if trace.IsLogging(logger.DEBUG) {
 		trace.Debug("In handleGetUpdates. orgID: %s destType: %s destID: %s\n", orgID, destType, destID)
 	}
@@ -213,7 +261,7 @@ func (communication *HTTP) handleGetUpdates(writer http.ResponseWriter, request
 			status = common.Received
 		}
 		metaData.DestID = n.DestID
-		message := updateMessage{status, *metaData}
+		message := updateMessage{status, *metaData, tracing.GetTraceContext(n.DestOrgID, n.ObjectType, n.ObjectID)}
 		payload = append(payload, message)
 	}
 	body, err := json.MarshalIndent(payload, "", "  ")
@@ -276,6 +324,7 @@ func (communication *HTTP) SendNotificationMessage(notificationTopic string, des
 		request, err = http.NewRequest("PUT", url, nil)
 	}
 	security.AddIdentityToSPIRequest(request, url)
+	tracing.AddTraceContextHeaders(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, request.Header)
 
 	response, err := communication.requestWrapper.do(request)
 	if err != nil {
@@ -360,6 +409,16 @@ func (communication *HTTP) handleRegisterOrPing(url string, writer http.Response
 		destination := common.Destination{DestOrgID: orgID, DestType: destType, DestID: destID, Communication: common.HTTPProtocol,
 			// The version is 1.0 as the URL is /spi/v1/register...
 			CodeVersion: "1.0"}
+		if url != pingURL && request.Body != nil {
+			// The body of a registration is optional, it contains the policy and the properties of the ESS
+			var payload common.Destination
+			if err := json.NewDecoder(request.Body).Decode(&payload); err != nil && err != io.EOF {
+				writer.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			destination.Policy = payload.Policy
+			destination.Properties = payload.Properties
+		}
 		switch url {
 		case registerURL:
 			err = handleRegistration(destination, persistentStorage)
@@ -400,8 +459,28 @@ func (communication *HTTP) registerOrPing(url string) common.SyncServiceError {
 		return nil
 	}
 
+	// The policy and the properties of the ESS are sent in the body of a registration
+	var body io.Reader
+	if url == registerURL || url == registerNewURL {
+		policy, err := readDestinationPolicy()
+		if err != nil {
+			return err
+		}
+		properties := destinationProperties()
+		if policy != nil || len(properties) != 0 {
+			payload, err := json.Marshal(common.Destination{Policy: policy, Properties: properties})
+			if err != nil {
+				return &Error{"Failed to marshal the destination policy and properties. Error: " + err.Error()}
+			}
+			body = bytes.NewReader(payload)
+		}
+	}
+
 	requestURL := buildRegisterOrPingURL(url, common.Configuration.OrgID, common.Configuration.DestinationType, common.Configuration.DestinationID)
-	request, err := http.NewRequest("PUT", requestURL, nil)
+	request, err := http.NewRequest("PUT", requestURL, body)
+	if body != nil {
+		request.Header.Add("Content-Type", "application/json")
+	}
 	q := request.URL.Query() // Get a copy of the query values.
 	q.Add("persistent-storage", strconv.FormatBool(Store.IsPersistent()))
 	request.URL.RawQuery = q.Encode() // Encode and assign back to the original query.
@@ -477,6 +556,7 @@ func (communication *HTTP) GetData(metaData common.MetaData, offset int64) commo
 		return &Error{"Failed to create data request. Error: " + err.Error()}
 	}
 	security.AddIdentityToSPIRequest(request, url)
+	tracing.AddTraceContextHeaders(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, request.Header)
 
 	response, err := communication.requestWrapper.do(request)
 	if err != nil {
@@ -508,6 +588,17 @@ func (communication *HTTP) GetData(metaData common.MetaData, offset int64) commo
 			return &Error{"Failed to store object's data."}
 		}
 	}
+	if retry, err := verifyReceivedData(metaData); err != nil {
+		common.ObjectLocks.Unlock(lockIndex)
+		if retry {
+			return communication.GetData(metaData, offset)
+		}
+		return rejectObject(metaData, err)
+	}
+	if err := verifyReceivedObject(metaData); err != nil {
+		common.ObjectLocks.Unlock(lockIndex)
+		return rejectObject(metaData, err)
+	}
 	if err := Store.UpdateObjectStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, common.CompletelyReceived); err != nil {
 		common.ObjectLocks.Unlock(lockIndex)
 		return &Error{fmt.Sprintf("Error in GetData: %s\n", err)}
@@ -528,6 +619,49 @@ func (communication *HTTP) GetData(metaData common.MetaData, offset int64) commo
 	return nil
 }
 
+// GetDelta requests a delta of the data of an updated object from the CSS, and creates the data from it
+func (communication *HTTP) GetDelta(metaData common.MetaData, signature []byte) common.SyncServiceError {
+	if common.Configuration.NodeType != common.ESS {
+		return &Error{"Delta transfer is not supported by the CSS"}
+	}
+
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("In http.GetDelta %s %s", metaData.ObjectType, metaData.ObjectID)
+	}
+
+	if err := updateGetDataNotification(metaData, metaData.OriginType, metaData.OriginID, 0); err != nil {
+		return err
+	}
+
+	url := buildObjectURL(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.InstanceID, metaData.DataID, common.Getdelta)
+	request, err := http.NewRequest("POST", url, bytes.NewReader(signature))
+	if err != nil {
+		return &Error{"Failed to create delta request. Error: " + err.Error()}
+	}
+	security.AddIdentityToSPIRequest(request, url)
+
+	response, err := communication.requestWrapper.do(request)
+	if err != nil {
+		return &Error{"Error in GetDelta: failed to get delta. Error: " + err.Error()}
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNoContent {
+		return &Error{"No delta was sent"}
+	}
+	if response.StatusCode != http.StatusOK {
+		return &notificationHandlerError{"Error in GetDelta: failed to receive delta from the other side"}
+	}
+
+	deltaData, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return &Error{"Error in GetDelta: failed to read delta. Error: " + err.Error()}
+	}
+	if err := applyDelta(metaData, deltaData); err != nil && !isIgnoredByHandler(err) {
+		return err
+	}
+	return nil
+}
+
 // SendData sends data from the CSS to the ESS or from the ESS to the CSS
 func (communication *HTTP) SendData(orgID string, destType string, destID string, message []byte, chunked bool) common.SyncServiceError {
 	return nil
@@ -564,6 +698,14 @@ func (communication *HTTP) Poll() bool {
 		return false
 	}
 
+	if response.StatusCode == http.StatusTooManyRequests {
+		// Poll again in the next polling interval
+		if trace.IsLogging(logger.DEBUG) {
+			trace.Debug("Polling rate limit exceeded, retry after %s seconds\n", response.Header.Get("Retry-After"))
+		}
+		return false
+	}
+
 	if response.StatusCode != http.StatusOK {
 		if log.IsLogging(logger.ERROR) {
 			log.Error("Failed to read updates. Received code: %d\n", response.StatusCode)
@@ -586,7 +728,7 @@ func (communication *HTTP) Poll() bool {
 	for _, message := range payload {
 		switch message.Type {
 		case common.Update:
-			if err = handleUpdate(message.MetaData, 1); err != nil && !isIgnoredByHandler(err) {
+			if err = handleUpdate(message.MetaData, 1, message.TraceContext); err != nil && !isIgnoredByHandler(err) {
 				if log.IsLogging(logger.ERROR) {
 					log.Error("Failed to handle update. Error: %s\n", err)
 				}
@@ -719,7 +861,7 @@ func (communication *HTTP) handleObjects(writer http.ResponseWriter, request *ht
 			if extractErr != nil {
 				err = extractErr
 			} else {
-				err = handleUpdate(*metaData, 1)
+				err = handleUpdate(*metaData, 1, tracing.GetTraceContextFromHeaders(request.Header))
 			}
 		case common.Updated:
 			err = handleObjectUpdated(orgID, objectType, objectID, destType, destID, instanceID, dataID)
@@ -785,12 +927,30 @@ func (communication *HTTP) handleObjects(writer http.ResponseWriter, request *ht
 			return
 		}
 		communication.handleGetData(orgID, objectType, objectID, destType, destID, instanceID, dataID, writer, request)
+	} else if request.Method == http.MethodPost {
+		action, orgID, objectType, objectID, destType, destID, instanceID, _, ok := communication.extract(writer, request)
+		if !ok {
+			return
+		}
+		if action != common.Getdelta {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		communication.handleGetDelta(orgID, objectType, objectID, destType, destID, instanceID, writer, request)
 	} else {
 		writer.WriteHeader(http.StatusMethodNotAllowed)
 	}
 }
 
 func (communication *HTTP) handlePutData(orgID string, objectType string, objectID string,
+	request *http.Request) common.SyncServiceError {
+	span := tracing.StartSpan("handleData", orgID, objectType, objectID, tracing.GetTraceContextFromHeaders(request.Header))
+	err := communication.storePutData(orgID, objectType, objectID, request)
+	span.End(spanError(err))
+	return err
+}
+
+func (communication *HTTP) storePutData(orgID string, objectType string, objectID string,
 	request *http.Request) common.SyncServiceError {
 	lockIndex := common.HashStrings(orgID, objectType, objectID)
 	common.ObjectLocks.Lock(lockIndex)
@@ -802,6 +962,13 @@ func (communication *HTTP) handlePutData(orgID string, objectType string, object
 		common.ObjectLocks.Unlock(lockIndex)
 		return &common.InvalidRequest{Message: "Failed to find object to set data"}
 	}
+	if metaData, err := Store.RetrieveObject(orgID, objectType, objectID); err == nil && metaData != nil {
+		if err := verifyDataHash(*metaData); err != nil {
+			// The object remains partially received, and its data is requested again
+			common.ObjectLocks.Unlock(lockIndex)
+			return err
+		}
+	}
 	if err := Store.UpdateObjectStatus(orgID, objectType, objectID, common.CompletelyReceived); err != nil {
 		common.ObjectLocks.Unlock(lockIndex)
 		return err
@@ -828,11 +995,16 @@ func (communication *HTTP) handlePutData(orgID string, objectType string, object
 
 func (communication *HTTP) handleGetData(orgID string, objectType string, objectID string,
 	destType string, destID string, instanceID int64, dataID int64, writer http.ResponseWriter, request *http.Request) {
+	span := tracing.StartSpan("handleGetData", orgID, objectType, objectID, tracing.GetTraceContextFromHeaders(request.Header))
+	var spanErr error
+	defer func() { span.End(spanErr) }()
+
 	lockIndex := common.HashStrings(orgID, objectType, objectID)
 	common.ObjectLocks.Lock(lockIndex)
 	defer common.ObjectLocks.Unlock(lockIndex)
 
 	if dataReader, err := Store.RetrieveObjectData(orgID, objectType, objectID); err != nil {
+		spanErr = err
 		SendErrorResponse(writer, err, "", 0)
 	} else {
 		if dataReader == nil {
@@ -841,6 +1013,7 @@ func (communication *HTTP) handleGetData(orgID string, objectType string, object
 			writer.Header().Add("Content-Type", "application/octet-stream")
 			writer.WriteHeader(http.StatusOK)
 			if _, err := io.Copy(writer, dataReader); err != nil {
+				spanErr = err
 				SendErrorResponse(writer, err, "", 0)
 			}
 			if err := Store.CloseDataReader(dataReader); err != nil {
@@ -853,6 +1026,45 @@ func (communication *HTTP) handleGetData(orgID string, objectType string, object
 	}
 }
 
+func (communication *HTTP) handleGetDelta(orgID string, objectType string, objectID string,
+	destType string, destID string, instanceID int64, writer http.ResponseWriter, request *http.Request) {
+	signature, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		SendErrorResponse(writer, &common.InvalidRequest{Message: "Failed to read the signature. Error: " + err.Error()}, "", 0)
+		return
+	}
+
+	metaData, err := Store.RetrieveObject(orgID, objectType, objectID)
+	if err != nil {
+		SendErrorResponse(writer, err, "", 0)
+		return
+	}
+	if metaData == nil {
+		writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+	metaData.DestType = destType
+	metaData.DestID = destID
+	metaData.InstanceID = instanceID
+
+	deltaData, err := handleGetDelta(*metaData, signature, 0)
+	if err != nil {
+		if common.IsNotFound(err) {
+			writer.WriteHeader(http.StatusNotFound)
+		} else {
+			SendErrorResponse(writer, err, "", 0)
+		}
+		return
+	}
+	if deltaData == nil {
+		writer.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writer.Header().Add("Content-Type", "application/octet-stream")
+	writer.WriteHeader(http.StatusOK)
+	writer.Write(deltaData)
+}
+
 func (communication *HTTP) pushData(metaData *common.MetaData) common.SyncServiceError {
 	lockIndex := common.HashStrings(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
 	common.ObjectLocks.RLock(lockIndex)
@@ -877,6 +1089,7 @@ func (communication *HTTP) pushData(metaData *common.MetaData) common.SyncServic
 		return &Error{"Failed to read data. Error: " + err.Error()}
 	}
 	security.AddIdentityToSPIRequest(request, url)
+	tracing.AddTraceContextHeaders(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, request.Header)
 
 	response, err := communication.requestWrapper.do(request)
 	if err != nil {
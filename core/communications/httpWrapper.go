@@ -2,8 +2,11 @@ package communications
 
 import (
 	"context"
+	"io"
 	"net/http"
 	"sync"
+
+	"github.com/open-horizon/edge-sync-service/common"
 )
 
 type httpRequestWrapper struct {
@@ -18,6 +21,9 @@ func newHTTPRequestWrapper(httpClient http.Client) *httpRequestWrapper {
 }
 
 func (wrapper *httpRequestWrapper) do(request *http.Request) (*http.Response, error) {
+	if request.Body != nil && request.Body != http.NoBody {
+		request.Body = &countingReader{reader: request.Body, sent: true}
+	}
 	ctx, cancel := context.WithCancel(context.Background())
 	reqWithCtx := request.WithContext(ctx)
 
@@ -31,6 +37,9 @@ func (wrapper *httpRequestWrapper) do(request *http.Request) (*http.Response, er
 	delete(wrapper.inFlight, reqWithCtx)
 	wrapper.lock.Unlock()
 
+	if err == nil && response.Body != nil {
+		response.Body = &countingReader{reader: response.Body}
+	}
 	return response, err
 }
 
@@ -42,3 +51,44 @@ func (wrapper *httpRequestWrapper) cancel() {
 	}
 	wrapper.lock.Unlock()
 }
+
+// countingReader counts the bytes of HTTP bodies sent or received
+type countingReader struct {
+	reader io.ReadCloser
+	sent   bool
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if r.sent {
+		common.HealthStatus.DataSent(common.HTTPProtocol, n)
+	} else {
+		common.HealthStatus.DataReceived(common.HTTPProtocol, n)
+	}
+	return n, err
+}
+
+func (r *countingReader) Close() error {
+	return r.reader.Close()
+}
+
+// countingResponseWriter counts the bytes of HTTP responses sent
+type countingResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w *countingResponseWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	common.HealthStatus.DataSent(common.HTTPProtocol, n)
+	return n, err
+}
+
+// countTraffic wraps a handler of requests from ESS nodes to count the bytes received and sent
+func countTraffic(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Body != nil {
+			request.Body = &countingReader{reader: request.Body}
+		}
+		handler.ServeHTTP(&countingResponseWriter{writer}, request)
+	})
+}
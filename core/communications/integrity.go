@@ -0,0 +1,172 @@
+package communications
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/dataURI"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+	"github.com/open-horizon/edge-utilities/logger/trace"
+)
+
+// The integrity of transferred data is verified in two levels: each data message carries a CRC of its chunk,
+// and the meta data of an object carries the SHA-256 hash of the whole data (MetaData.DataHash).
+// A chunk with a wrong CRC is requested again. If the hash of the whole data is wrong, the whole data is requested again,
+// up to maxDataIntegrityRetries times, after which the object is rejected.
+
+const maxDataIntegrityRetries = 3
+
+type chunkChecksumError struct {
+	message string
+}
+
+func (e *chunkChecksumError) Error() string {
+	return e.message
+}
+
+func isChunkChecksumError(err error) bool {
+	_, ok := err.(*chunkChecksumError)
+	return ok
+}
+
+type dataIntegrityFailures struct {
+	instanceID int64
+	count      int
+}
+
+var integrityFailures = make(map[string]dataIntegrityFailures)
+var integrityFailuresLock sync.Mutex
+
+func chunkChecksum(data []byte) uint32 {
+	return crc32.ChecksumIEEE(data)
+}
+
+// openObjectData opens the received data of the object, from the storage or from the destination data URI.
+// The returned function closes the reader.
+func openObjectData(metaData common.MetaData) (io.Reader, func() error, common.SyncServiceError) {
+	if metaData.DestinationDataURI != "" {
+		dataReader, err := dataURI.GetData(metaData.DestinationDataURI)
+		if err != nil {
+			return nil, nil, err
+		}
+		closer := func() error { return nil }
+		if file, ok := dataReader.(io.Closer); ok {
+			closer = file.Close
+		}
+		return dataReader, closer, nil
+	}
+
+	dataReader, err := Store.RetrieveObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if dataReader == nil {
+		return nil, nil, &common.NotFound{}
+	}
+	return dataReader, func() error { return Store.CloseDataReader(dataReader) }, nil
+}
+
+// verifyDataHash verifies the hash of the data of an object that was completely received.
+// Objects without a hash (e.g., sent by older versions) are not verified.
+// Must be called with the object's lock held.
+func verifyDataHash(metaData common.MetaData) common.SyncServiceError {
+	if metaData.DataHash == "" || metaData.NoData || metaData.Link != "" {
+		return nil
+	}
+
+	dataReader, closer, err := openObjectData(metaData)
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, dataReader); err != nil {
+		return &common.IOError{Message: "Failed to read the object's data. Error: " + err.Error()}
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != metaData.DataHash {
+		return &common.IOError{Message: fmt.Sprintf("The hash of the data of %s %s doesn't match the hash in its meta data",
+			metaData.ObjectType, metaData.ObjectID)}
+	}
+
+	clearDataIntegrityFailures(metaData)
+	return nil
+}
+
+// verifyReceivedData verifies the hash of the data of an object that was completely received.
+// If the verification fails, it returns true if the data should be requested again, and false if the object was deleted
+// and should be rejected. Must be called with the object's lock held.
+func verifyReceivedData(metaData common.MetaData) (bool, common.SyncServiceError) {
+	err := verifyDataHash(metaData)
+	if err == nil {
+		return false, nil
+	}
+	if log.IsLogging(logger.ERROR) {
+		log.Error("Failed to verify the data of %s %s. Error: %s\n", metaData.ObjectType, metaData.ObjectID, err.Error())
+	}
+
+	id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
+		metaData.OriginType, metaData.OriginID)
+	integrityFailuresLock.Lock()
+	failures := integrityFailures[id]
+	if failures.instanceID != metaData.InstanceID {
+		failures = dataIntegrityFailures{instanceID: metaData.InstanceID}
+	}
+	failures.count++
+	retry := failures.count <= maxDataIntegrityRetries
+	if retry {
+		integrityFailures[id] = failures
+	} else {
+		delete(integrityFailures, id)
+	}
+	integrityFailuresLock.Unlock()
+
+	removeNotificationChunksInfo(metaData, metaData.OriginType, metaData.OriginID)
+	if !retry {
+		deleteObjectInfo(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID,
+			&metaData, true)
+	}
+	return retry, err
+}
+
+func clearDataIntegrityFailures(metaData common.MetaData) {
+	id := common.CreateNotificationID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
+		metaData.OriginType, metaData.OriginID)
+	integrityFailuresLock.Lock()
+	delete(integrityFailures, id)
+	integrityFailuresLock.Unlock()
+}
+
+// handleCorruptedChunk requests again a chunk whose CRC doesn't match its data
+func handleCorruptedChunk(orgID string, objectType string, objectID string, offset int64,
+	instanceID int64) (*common.MetaData, common.SyncServiceError) {
+	if trace.IsLogging(logger.INFO) {
+		trace.Info("Received a corrupted chunk of %s %s offset %d, requesting it again\n", objectType, objectID, offset)
+	}
+
+	lockIndex := common.HashStrings(orgID, objectType, objectID)
+	common.ObjectLocks.Lock(lockIndex)
+	metaData, err := Store.RetrieveObject(orgID, objectType, objectID)
+	if err != nil || metaData == nil {
+		common.ObjectLocks.Unlock(lockIndex)
+		return nil, &ignoredByHandler{}
+	}
+	if _, err := checkNotificationRecord(*metaData, metaData.OriginType, metaData.OriginID, instanceID,
+		common.Getdata, offset); err != nil {
+		// The chunk is not expected anymore
+		common.ObjectLocks.Unlock(lockIndex)
+		return metaData, &ignoredByHandler{}
+	}
+	common.ObjectLocks.Unlock(lockIndex)
+
+	if err := Comm.GetData(*metaData, offset); err != nil {
+		return metaData, &notificationHandlerError{fmt.Sprintf("Error in handleData: failed to request data. Error: %s\n", err)}
+	}
+	return metaData, nil
+}
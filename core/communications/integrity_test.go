@@ -0,0 +1,130 @@
+package communications
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/storage"
+)
+
+func TestDataMessageChecksum(t *testing.T) {
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: "myorg", InstanceID: 5}
+	data := []byte("0123456789")
+
+	message, err := buildDataMessage(metaData, data, len(data), 10, common.NoCompression)
+	if err != nil {
+		t.Fatalf("Failed to build data message. Error: %s", err.Error())
+	}
+	orgID, objectType, objectID, _, dataLength, _, offset, instanceID, err := parseDataMessage(message)
+	if err != nil {
+		t.Errorf("Failed to parse data message. Error: %s", err.Error())
+	} else if orgID != "myorg" || objectType != "type1" || objectID != "1" || dataLength != uint32(len(data)) ||
+		offset != 10 || instanceID != 5 {
+		t.Errorf("Wrong fields in the parsed data message")
+	}
+
+	// Corrupt the data
+	message[len(message)-1] ^= 0xff
+	orgID, objectType, objectID, _, _, _, offset, instanceID, err = parseDataMessage(message)
+	if err == nil || !isChunkChecksumError(err) {
+		t.Errorf("parseDataMessage didn't detect the corrupted data. Error: %v", err)
+	} else if orgID != "myorg" || objectType != "type1" || objectID != "1" || offset != 10 || instanceID != 5 {
+		t.Errorf("Wrong fields in the parsed corrupted data message")
+	}
+}
+
+func TestDataHashVerification(t *testing.T) {
+	common.InitObjectLocks()
+
+	dir, _ := os.Getwd()
+	common.Configuration.PersistenceRootPath = dir + "/persist"
+	common.Configuration.NodeType = common.ESS
+	common.Configuration.StorageProvider = common.Bolt
+
+	boltStore := &storage.BoltStorage{}
+	boltStore.Cleanup()
+	Store = boltStore
+	if err := Store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+	}
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	data := []byte("the data of the object")
+	corruptedData := []byte("the data of the 0bject")
+	hash := sha256.Sum256(data)
+
+	tests := []struct {
+		corruptedTransfers int
+		accepted           bool
+	}{
+		{0, true},
+		{2, true},
+		{maxDataIntegrityRetries + 1, false},
+	}
+
+	for i, test := range tests {
+		metaData := common.MetaData{ObjectID: "integrity" + strconv.Itoa(i), ObjectType: "type1", DestOrgID: "myorg",
+			DestID: "dev1", DestType: "device", OriginID: "123", OriginType: "type2", ObjectSize: int64(len(data)),
+			ChunkSize: 4096, InstanceID: 1, DataID: 1, DataHash: hex.EncodeToString(hash[:])}
+		if err := handleUpdate(metaData, 1, nil); err != nil {
+			t.Errorf("handleUpdate failed (test %d). Error: %s", i, err.Error())
+			continue
+		}
+
+		// A corrupted chunk is ignored and requested again
+		message, _ := buildDataMessage(metaData, data, len(data), 0, common.NoCompression)
+		message[len(message)-1] ^= 0xff
+		if _, err := handleData(message); err != nil {
+			t.Errorf("handleData failed for a corrupted chunk (test %d). Error: %s", i, err.Error())
+		}
+		checkObjectStatus(metaData, common.PartiallyReceived, t)
+
+		for transfer := 0; transfer <= test.corruptedTransfers; transfer++ {
+			transferredData := data
+			if transfer < test.corruptedTransfers {
+				transferredData = corruptedData
+			}
+			message, _ := buildDataMessage(metaData, transferredData, len(transferredData), 0, common.NoCompression)
+			if _, err := handleData(message); err != nil && !isIgnoredByHandler(err) {
+				t.Errorf("handleData failed (test %d). Error: %s", i, err.Error())
+			}
+			if transfer < test.corruptedTransfers && transfer < maxDataIntegrityRetries {
+				// The data is requested again
+				checkObjectStatus(metaData, common.PartiallyReceived, t)
+				notification, err := Store.RetrieveNotificationRecord(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
+					metaData.OriginType, metaData.OriginID)
+				if err != nil || notification == nil || notification.Status != common.Getdata {
+					t.Errorf("The data wasn't requested again (test %d). Error: %v", i, err)
+				}
+			}
+			if transfer == maxDataIntegrityRetries {
+				break
+			}
+		}
+
+		if test.accepted {
+			checkObjectStatus(metaData, common.CompletelyReceived, t)
+		} else if storedMetaData, err := Store.RetrieveObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID); err != nil ||
+			storedMetaData != nil {
+			t.Errorf("The object wasn't rejected (test %d). Error: %v", i, err)
+		}
+	}
+}
+
+func checkObjectStatus(metaData common.MetaData, expectedStatus string, t *testing.T) {
+	status, err := Store.RetrieveObjectStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if err != nil {
+		t.Errorf("Failed to retrieve object's status (objectID = %s). Error: %s", metaData.ObjectID, err.Error())
+	} else if status != expectedStatus {
+		t.Errorf("Wrong status (objectID = %s): %s instead of %s", metaData.ObjectID, status, expectedStatus)
+	}
+}
@@ -14,7 +14,9 @@ import (
 	"github.com/eclipse/paho.mqtt.golang"
 	"github.com/eclipse/paho.mqtt.golang/packets"
 	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/compression"
 	"github.com/open-horizon/edge-sync-service/core/leader"
+	"github.com/open-horizon/edge-sync-service/core/tracing"
 	"github.com/open-horizon/edge-utilities/logger"
 	"github.com/open-horizon/edge-utilities/logger/log"
 	"github.com/open-horizon/edge-utilities/logger/trace"
@@ -31,6 +33,10 @@ type messagePayload struct {
 	FeedbackFromOrigin bool                      `json:"feedback-from-origin,omitempty"`
 	RetryInterval      int32                     `json:"retry,omitempty"`
 	Reason             string                    `json:"reason,omitempty"`
+	Signature          []byte                    `json:"signature,omitempty"`
+	Delta              []byte                    `json:"delta,omitempty"`
+	Compression        []string                  `json:"compression,omitempty"`
+	TraceContext       map[string]string         `json:"trace-context,omitempty"`
 }
 
 type brokerAddresses struct {
@@ -132,7 +138,7 @@ func (context *mqttClientContext) parallelMessageHandler(client mqtt.Client, msg
 	}
 	messageInfo.context = context
 	command := messageInfo.messagePayload.Command
-	if command == common.Getdata || command == common.Data {
+	if command == common.Getdata || command == common.Data || command == common.Getdelta || command == common.Delta {
 		context.communicator.dataQ <- &messageInfo
 	} else if command == common.AckRegister {
 		handleRegAck()
@@ -158,6 +164,7 @@ func (context *mqttClientContext) parallelMessageHandler(client mqtt.Client, msg
 
 func parseMessage(msg mqtt.Message, messageInfo *messageHandlerInfo) bool {
 	payload := msg.Payload()
+	common.HealthStatus.DataReceived(common.MQTTProtocol, len(payload))
 
 	if len(payload) >= 4 && payload[0] == 0x01 && payload[1] == 0x01 && payload[2] == 0x01 && payload[3] == 0x01 {
 		messageInfo.messagePayload.Command = common.Data
@@ -205,6 +212,7 @@ func processMessage(messageInfo *messageHandlerInfo) {
 		if messagePayload.Command == common.Updated || messagePayload.Command == common.Consumed ||
 			messagePayload.Command == common.Received || messagePayload.Command == common.AckDelete ||
 			messagePayload.Command == common.Deleted || messagePayload.Command == common.Getdata ||
+			messagePayload.Command == common.Getdelta ||
 			(messagePayload.Command == common.Feedback && !messagePayload.FeedbackFromOrigin) {
 			destType = meta.DestType
 			destID = meta.DestID
@@ -236,7 +244,7 @@ func processMessage(messageInfo *messageHandlerInfo) {
 		if int64(meta.ChunkSize) < meta.ObjectSize && !leader.CheckIfLeader() {
 			err = &Error{"Non-leader received update message with chunked data, ignoring."}
 		} else {
-			err = handleUpdate(*meta, common.Configuration.MaxInflightChunks)
+			err = handleUpdate(*meta, common.Configuration.MaxInflightChunks, messagePayload.TraceContext)
 			if err != nil && !isIgnoredByHandler(err) {
 				context.communicator.SendErrorMessage(err, meta, true)
 			}
@@ -260,7 +268,7 @@ func processMessage(messageInfo *messageHandlerInfo) {
 	case common.AckDeleted:
 		err = handleAckObjectDeleted(meta.DestOrgID, meta.ObjectType, meta.ObjectID, meta.OriginType, meta.OriginID, meta.InstanceID)
 	case common.Getdata:
-		err = handleGetData(messagePayload.Meta, messagePayload.Offset)
+		err = handleGetData(messagePayload.Meta, messagePayload.Offset, messagePayload.Compression, messagePayload.TraceContext)
 		if err != nil && (isIgnoredByHandler(err) || common.IsNotFound(err)) {
 			context.communicator.SendErrorMessage(&common.NotFound{}, &messagePayload.Meta, false)
 		}
@@ -269,6 +277,16 @@ func processMessage(messageInfo *messageHandlerInfo) {
 		if meta != nil && err != nil && !isIgnoredByHandler(err) {
 			context.communicator.SendErrorMessage(err, meta, true)
 		}
+	case common.Getdelta:
+		err = context.communicator.handleGetDelta(messagePayload.Meta, messagePayload.Signature)
+		if err != nil && (isIgnoredByHandler(err) || common.IsNotFound(err)) {
+			context.communicator.SendErrorMessage(&common.NotFound{}, &messagePayload.Meta, false)
+		}
+	case common.Delta:
+		err = handleDelta(messagePayload.Meta, messagePayload.Delta, common.Configuration.MaxInflightChunks)
+		if err != nil && !isIgnoredByHandler(err) {
+			context.communicator.SendErrorMessage(err, meta, true)
+		}
 	case common.Resend:
 		err = handleResendRequest(messagePayload.Destination)
 	case common.AckResend:
@@ -750,6 +768,7 @@ func publish(client mqtt.Client, topic string, payload []byte) common.SyncServic
 		message := fmt.Sprintf("Failed to publish on topic %s. Error: ", topic)
 		return &Error{message + token.Error().Error()}
 	}
+	common.HealthStatus.DataSent(common.MQTTProtocol, len(payload))
 	return nil
 }
 
@@ -1006,7 +1025,8 @@ func (communication *MQTT) publishCSSOutsideWIoTP(orgID string, destType string,
 // SendNotificationMessage sends a notification message from the CSS to the ESS or from the ESS to the CSS
 func (communication *MQTT) SendNotificationMessage(notificationTopic string, destType string, destID string, instanceID int64, dataID int64,
 	metaData *common.MetaData) common.SyncServiceError {
-	messagePayload := &messagePayload{Version: common.Version, Command: notificationTopic, Meta: *metaData}
+	messagePayload := &messagePayload{Version: common.Version, Command: notificationTopic, Meta: *metaData,
+		TraceContext: tracing.GetTraceContext(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)}
 	messageJSON, err := json.Marshal(messagePayload)
 	if err != nil {
 		return &Error{"Failed to send notification. Error: " + err.Error()}
@@ -1056,6 +1076,14 @@ func (communication *MQTT) sendRegisterOrPing(command string) common.SyncService
 	destination := common.Destination{
 		DestOrgID: common.Configuration.OrgID, DestType: common.Configuration.DestinationType, DestID: common.Configuration.DestinationID,
 		Communication: common.MQTTProtocol, CodeVersion: common.VersionAsString()}
+	if command != common.Ping {
+		policy, err := readDestinationPolicy()
+		if err != nil {
+			return err
+		}
+		destination.Policy = policy
+		destination.Properties = destinationProperties()
+	}
 	messagePayload := &messagePayload{Version: common.Version, Command: command, Destination: destination,
 		PersistentStorage: Store.IsPersistent()}
 	messageJSON, err := json.Marshal(messagePayload)
@@ -1109,7 +1137,9 @@ func (communication *MQTT) SendPing() common.SyncServiceError {
 
 // GetData requests data to be sent from the CSS to the ESS or from the ESS to the CSS
 func (communication *MQTT) GetData(metaData common.MetaData, offset int64) common.SyncServiceError {
-	messagePayload := &messagePayload{Version: common.Version, Command: common.Getdata, Meta: metaData, Offset: offset}
+	// The compressions supported by this node are sent so that the other side can compress the data
+	messagePayload := &messagePayload{Version: common.Version, Command: common.Getdata, Meta: metaData, Offset: offset,
+		Compression: compression.Supported(), TraceContext: tracing.GetTraceContext(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)}
 	messageJSON, err := json.Marshal(messagePayload)
 	if err != nil {
 		return &Error{"Failed to send get data notification. Error: " + err.Error()}
@@ -1125,6 +1155,44 @@ func (communication *MQTT) GetData(metaData common.MetaData, offset int64) commo
 	return err
 }
 
+// GetDelta requests a delta of the data of an updated object from the CSS
+func (communication *MQTT) GetDelta(metaData common.MetaData, signature []byte) common.SyncServiceError {
+	messagePayload := &messagePayload{Version: common.Version, Command: common.Getdelta, Meta: metaData, Signature: signature}
+	messageJSON, err := json.Marshal(messagePayload)
+	if err != nil {
+		return &Error{"Failed to send get delta notification. Error: " + err.Error()}
+	}
+	if log.IsLogging(logger.TRACE) {
+		log.Trace("Sending getdelta notification")
+	}
+	// The request is recorded as a request of the first chunk of the data, so that the whole data is requested
+	// if the response is lost
+	if err = updateGetDataNotification(metaData, metaData.OriginType, metaData.OriginID, 0); err != nil {
+		return err
+	}
+	return communication.publishMessage(metaData.DestOrgID, metaData.OriginType, metaData.OriginID, messageJSON, false)
+}
+
+// handleGetDelta computes and sends a delta in response to a getdelta request. An empty delta is sent
+// if the delta can't be used, so that the other side requests the whole data.
+func (communication *MQTT) handleGetDelta(metaData common.MetaData, signature []byte) common.SyncServiceError {
+	// The delta is sent in one message, encoded in base64
+	deltaData, err := handleGetDelta(metaData, signature, common.Configuration.MaxDataChunkSize*3/4)
+	if err != nil {
+		return err
+	}
+
+	messagePayload := &messagePayload{Version: common.Version, Command: common.Delta, Meta: metaData, Delta: deltaData}
+	messageJSON, err := json.Marshal(messagePayload)
+	if err != nil {
+		return &Error{"Failed to send delta. Error: " + err.Error()}
+	}
+	if log.IsLogging(logger.TRACE) {
+		log.Trace("Sending delta")
+	}
+	return communication.publishMessage(metaData.DestOrgID, metaData.DestType, metaData.DestID, messageJSON, false)
+}
+
 // SendData sends data from the CSS to the ESS or from the ESS to the CSS
 func (communication *MQTT) SendData(orgID string, destType string, destID string, message []byte, chunked bool) common.SyncServiceError {
 	if log.IsLogging(logger.TRACE) {
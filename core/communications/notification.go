@@ -1,13 +1,11 @@
 package communications
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"net/http"
 
 	"github.com/open-horizon/edge-sync-service/common"
 	"github.com/open-horizon/edge-sync-service/core/leader"
+	"github.com/open-horizon/edge-sync-service/core/tracing"
 	"github.com/open-horizon/edge-utilities/logger"
 	"github.com/open-horizon/edge-utilities/logger/log"
 	"github.com/open-horizon/edge-utilities/logger/trace"
@@ -26,6 +24,9 @@ func (e *invalidNotification) Error() string {
 func PrepareObjectNotifications(metaData common.MetaData) ([]common.NotificationInfo, common.SyncServiceError) {
 	destinations, err := Store.GetObjectDestinations(metaData)
 	if err == nil {
+		if metaData.Rollout != nil && common.Configuration.NodeType == common.CSS {
+			return prepareRolloutNotifications(metaData, destinations)
+		}
 		err = Store.UpdateObjectDelivering(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
 		if err != nil && log.IsLogging(logger.ERROR) {
 			log.Error("Failed to update object's delivery status. Error: " + err.Error())
@@ -91,6 +92,40 @@ func PrepareUpdateNotification(metaData common.MetaData, destinations []common.D
 	return prepareNotifications(common.Update, metaData, destinations)
 }
 
+// PrepareObjectDestinationsNotifications prepares the notifications of the destinations that were removed from an object
+// and of the destinations that were added to it
+// The caller should hold the lock of the object.
+func PrepareObjectDestinationsNotifications(metaData common.MetaData, status string, deletedDestinations []common.StoreDestinationStatus,
+	addedDestinations []common.StoreDestinationStatus) ([]common.NotificationInfo, []common.NotificationInfo, common.SyncServiceError) {
+	var deleteNotificationsInfo, updateNotificationsInfo []common.NotificationInfo
+	var err common.SyncServiceError
+	if len(deletedDestinations) != 0 {
+		deleteNotificationsInfo, err = PrepareNotificationsForDestinations(metaData, deletedDestinations, common.Delete)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if len(addedDestinations) != 0 && status == common.ReadyToSend {
+		if metaData.Rollout != nil {
+			// The rollout of the object notifies the added destinations by its next waves
+			destinations := make([]common.Destination, 0, len(addedDestinations))
+			for _, dest := range addedDestinations {
+				destinations = append(destinations, dest.Destination)
+			}
+			if destinations, err = FilterRolloutDestinations(metaData, destinations); err == nil {
+				updateNotificationsInfo, err = PrepareUpdateNotification(metaData, destinations)
+			}
+		} else {
+			updateNotificationsInfo, err = PrepareNotificationsForDestinations(metaData, addedDestinations, common.Update)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return deleteNotificationsInfo, updateNotificationsInfo, nil
+}
+
 // PrepareObjectStatusNotification sends an object status message to the other side
 // This function should not acquire an object lock (common.ObjectLocks) as the caller has already acquired one.
 func PrepareObjectStatusNotification(metaData common.MetaData, status string) ([]common.NotificationInfo, common.SyncServiceError) {
@@ -108,15 +143,81 @@ func PrepareObjectStatusNotification(metaData common.MetaData, status string) ([
 	return []common.NotificationInfo{notificationInfo}, nil
 }
 
-// SendNotifications calls the communication to send the notification messages
+// SendNotifications calls the communication to send the notification messages.
+// The sending of the notifications of each object is traced in a span of the object.
 func SendNotifications(notifications []common.NotificationInfo) common.SyncServiceError {
+	spans := make(map[string]*tracing.Span)
+	var result common.SyncServiceError
+	var failedObjectKey string
 	for _, notification := range notifications {
+		metaData := notification.MetaData
+		objectKey := metaData.DestOrgID + "/" + metaData.ObjectType + "/" + metaData.ObjectID
+		if _, ok := spans[objectKey]; !ok {
+			spans[objectKey] = tracing.StartSpan("SendNotifications", metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, nil)
+		}
 		if err := Comm.SendNotificationMessage(notification.NotificationTopic, notification.DestType, notification.DestID,
 			notification.InstanceID, notification.DataID, notification.MetaData); err != nil {
-			return &Error{err.Error()}
+			result = &Error{err.Error()}
+			failedObjectKey = objectKey
+			break
 		}
 	}
-	return nil
+	for objectKey, span := range spans {
+		if objectKey == failedObjectKey {
+			span.End(result)
+		} else {
+			span.End(nil)
+		}
+	}
+	return result
+}
+
+// SendBatchNotifications calls the communication to send the notification messages of a batch of operations on objects.
+// A notification that is superseded by a later notification of the same object to the same destination is not sent,
+// and the failure to send a notification doesn't prevent sending the others. Returns the first failure.
+func SendBatchNotifications(notifications []common.NotificationInfo) common.SyncServiceError {
+	type notificationKey struct {
+		orgID, objectType, objectID, destType, destID string
+	}
+	keyOf := func(notification common.NotificationInfo) notificationKey {
+		return notificationKey{notification.MetaData.DestOrgID, notification.MetaData.ObjectType, notification.MetaData.ObjectID,
+			notification.DestType, notification.DestID}
+	}
+	last := make(map[notificationKey]int, len(notifications))
+	for index, notification := range notifications {
+		last[keyOf(notification)] = index
+	}
+
+	spans := make(map[string]*tracing.Span)
+	failures := make(map[string]common.SyncServiceError)
+	var result common.SyncServiceError
+	for index, notification := range notifications {
+		if last[keyOf(notification)] != index {
+			continue
+		}
+		metaData := notification.MetaData
+		objectKey := metaData.DestOrgID + "/" + metaData.ObjectType + "/" + metaData.ObjectID
+		span, ok := spans[objectKey]
+		if !ok {
+			span = tracing.StartSpan("SendNotifications", metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, nil)
+			spans[objectKey] = span
+		}
+		if err := Comm.SendNotificationMessage(notification.NotificationTopic, notification.DestType, notification.DestID,
+			notification.InstanceID, notification.DataID, notification.MetaData); err != nil {
+			if log.IsLogging(logger.ERROR) {
+				log.Error("Failed to send a notification of %s to %s:%s. Error: %s\n", objectKey, notification.DestType,
+					notification.DestID, err)
+			}
+			failures[objectKey] = &Error{err.Error()}
+			if result == nil {
+				result = failures[objectKey]
+			}
+		}
+	}
+	for objectKey, span := range spans {
+		span.End(failures[objectKey])
+	}
+	return result
 }
 
 func resendNotificationsForDestination(dest common.Destination, resendReceivedObjects bool) common.SyncServiceError {
@@ -164,6 +265,7 @@ func resendNotificationsForDestination(dest common.Destination, resendReceivedOb
 				common.ObjectLocks.Unlock(lockIndex)
 				continue
 			}
+			common.HealthStatus.NotificationResent()
 
 			switch n.Status {
 			case common.Getdata:
@@ -296,38 +398,3 @@ func ResendObjects() common.SyncServiceError {
 	common.ResendAcked = false
 	return Comm.ResendObjects()
 }
-
-func callWebhooks(metaData *common.MetaData) {
-	if webhooks, err := Store.RetrieveWebhooks(metaData.DestOrgID, metaData.ObjectType); err == nil {
-		body, err := json.MarshalIndent(metaData, "", "  ")
-		if err != nil {
-			if log.IsLogging(logger.ERROR) {
-				log.Error("Error in callWebhooks, failed to marshal meta data: %s\n", err)
-			}
-			return
-		}
-		for _, url := range webhooks {
-			request, err := http.NewRequest("POST", url, bytes.NewReader(body))
-			request.ContentLength = int64(len(body))
-			request.Header.Add("Content-Type", "Application/JSON")
-			response, err := http.DefaultClient.Do(request)
-			if err != nil {
-				if log.IsLogging(logger.ERROR) {
-					log.Error("Error in callWebhooks, failed to post meta data to %s: %s\n", url, err)
-				}
-				continue
-			}
-			if response.StatusCode != http.StatusOK &&
-				response.StatusCode != http.StatusNoContent &&
-				log.IsLogging(logger.ERROR) {
-				log.Error("Error in callWebhooks: received status: %d for %s\n", response.StatusCode, url)
-			}
-			err = response.Body.Close()
-			if err != nil {
-				if log.IsLogging(logger.ERROR) {
-					log.Error("Error in callWebhooks, failed to close response body")
-				}
-			}
-		}
-	}
-}
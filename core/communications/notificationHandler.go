@@ -11,9 +11,11 @@ import (
 	"time"
 
 	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/compression"
 	"github.com/open-horizon/edge-sync-service/core/dataURI"
 	"github.com/open-horizon/edge-sync-service/core/leader"
 	"github.com/open-horizon/edge-sync-service/core/storage"
+	"github.com/open-horizon/edge-sync-service/core/tracing"
 	"github.com/open-horizon/edge-utilities/logger"
 	"github.com/open-horizon/edge-utilities/logger/log"
 	"github.com/open-horizon/edge-utilities/logger/trace"
@@ -57,6 +59,9 @@ func handleRegistration(dest common.Destination, persistentStorage bool) common.
 	if !common.IsValidName(dest.DestType) || !common.IsValidName(dest.DestID) {
 		return &notificationHandlerError{("Error in handleRegistration: destination contains invalid characters")}
 	}
+	if err := common.ValidateLabels(dest.Properties); err != nil {
+		return &notificationHandlerError{"Error in handleRegistration: invalid destination properties. " + err.Error()}
+	}
 
 	if trace.IsLogging(logger.TRACE) {
 		trace.Trace("Handling registration of %s %s\n", dest.DestType, dest.DestID)
@@ -74,6 +79,14 @@ func handleRegistration(dest common.Destination, persistentStorage bool) common.
 		return &ignoredByHandler{}
 	}
 
+	// The destination keeps its stored properties if it didn't publish properties,
+	// and is matched with the destination policies of objects if its policy changed
+	storedDest, err := Store.RetrieveDestination(dest.DestOrgID, dest.DestType, dest.DestID)
+	if err != nil {
+		return &notificationHandlerError{fmt.Sprintf("Error in handleRegistration: failed to retrieve destination. Error: %s\n", err)}
+	}
+	keepDestinationProperties(&dest, storedDest)
+
 	// Add to the destinations list
 	if err := Store.StoreDestination(dest); err != nil {
 		return &notificationHandlerError{fmt.Sprintf("Error in handleRegistration: failed to store destination. Error: %s\n", err)}
@@ -93,6 +106,12 @@ func handleRegistration(dest common.Destination, persistentStorage bool) common.
 		return &notificationHandlerError{fmt.Sprintf("Error in handleRegistration. Error: %s\n", err)}
 	}
 
+	if IsPolicyEvaluated() && isDestinationPolicyChanged(storedDest, dest) {
+		if err := evaluateDestinationPolicy(dest); err != nil {
+			return &notificationHandlerError{fmt.Sprintf("Error in handleRegistration: failed to evaluate destination policies. Error: %s\n", err)}
+		}
+	}
+
 	return nil
 }
 
@@ -105,11 +124,26 @@ func handleRegisterNew(dest common.Destination, persistentStorage bool) common.S
 	if !common.IsValidName(dest.DestType) || !common.IsValidName(dest.DestID) {
 		return &notificationHandlerError{("Error in handleRegisterNew: destination contains invalid characters")}
 	}
+	if err := common.ValidateLabels(dest.Properties); err != nil {
+		return &notificationHandlerError{"Error in handleRegisterNew: invalid destination properties. " + err.Error()}
+	}
 
 	if trace.IsLogging(logger.TRACE) {
 		trace.Trace("Handling registration of a new ESS: %s %s\n", dest.DestType, dest.DestID)
 	}
 
+	// The destination keeps its stored properties if it didn't publish properties,
+	// and is matched with the destination policies of objects if its policy changed
+	var storedDest *common.Destination
+	exists, err := Store.DestinationExists(dest.DestOrgID, dest.DestType, dest.DestID)
+	if err == nil && exists {
+		storedDest, err = Store.RetrieveDestination(dest.DestOrgID, dest.DestType, dest.DestID)
+	}
+	if err != nil {
+		return &notificationHandlerError{fmt.Sprintf("Error in handleRegisterNew: failed to retrieve destination. Error: %s\n", err)}
+	}
+	keepDestinationProperties(&dest, storedDest)
+
 	// Add to the destinations list
 	if err := Store.StoreDestination(dest); err != nil {
 		return &notificationHandlerError{fmt.Sprintf("Error in handleRegisterNew: failed to store destination. Error: %s\n", err)}
@@ -139,7 +173,12 @@ func handleRegisterNew(dest common.Destination, persistentStorage bool) common.S
 		for _, metaData := range objects {
 			lockIndex := common.HashStrings(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
 			common.ObjectLocks.Lock(lockIndex)
-			notificationsInfo, err := PrepareUpdateNotification(metaData, destinations)
+			objectDestinations, err := FilterRolloutDestinations(metaData, destinations)
+			if err != nil {
+				common.ObjectLocks.Unlock(lockIndex)
+				return err
+			}
+			notificationsInfo, err := PrepareUpdateNotification(metaData, objectDestinations)
 			common.ObjectLocks.Unlock(lockIndex)
 			if err == nil {
 				if err := SendNotifications(notificationsInfo); err != nil {
@@ -151,9 +190,23 @@ func handleRegisterNew(dest common.Destination, persistentStorage bool) common.S
 		}
 	}
 
+	if IsPolicyEvaluated() && isDestinationPolicyChanged(storedDest, dest) {
+		if err := evaluateDestinationPolicy(dest); err != nil {
+			return &notificationHandlerError{fmt.Sprintf("Error in handleRegisterNew: failed to evaluate destination policies. Error: %s\n", err)}
+		}
+	}
+
 	return nil
 }
 
+// keepDestinationProperties sets the properties of a registering destination that didn't publish properties
+// to its stored properties, which may have been edited by an admin
+func keepDestinationProperties(dest *common.Destination, storedDest *common.Destination) {
+	if dest.Properties == nil && storedDest != nil {
+		dest.Properties = storedDest.Properties
+	}
+}
+
 // CSS: handle ESS ping
 func handlePing(dest common.Destination) common.SyncServiceError {
 	if common.Configuration.NodeType == common.ESS {
@@ -254,7 +307,15 @@ func handleRegAck() {
 }
 
 // Handle a notification about object update
-func handleUpdate(metaData common.MetaData, maxInflightChunks int) common.SyncServiceError {
+// The handling starts the delivery of the object on this node, continuing the trace received from the other side
+func handleUpdate(metaData common.MetaData, maxInflightChunks int, traceContext map[string]string) common.SyncServiceError {
+	span := tracing.StartDeliverySpan("handleUpdate", metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, traceContext)
+	err := processUpdate(metaData, maxInflightChunks)
+	span.End(spanError(err))
+	return err
+}
+
+func processUpdate(metaData common.MetaData, maxInflightChunks int) common.SyncServiceError {
 	if trace.IsLogging(logger.TRACE) {
 		trace.Trace("Handling update of %s %s\n", metaData.ObjectType, metaData.ObjectID)
 	}
@@ -292,13 +353,29 @@ func handleUpdate(metaData common.MetaData, maxInflightChunks int) common.SyncSe
 		status = common.CompletelyReceived
 	}
 
+	// Save the data of the existing version of the object before it is removed, to be used as the base of a delta
+	var signature []byte
+	if status == common.PartiallyReceived {
+		signature = prepareDeltaBase(metaData)
+	}
+
 	// Store the object
 	if _, err := Store.StoreObject(metaData, nil, status); err != nil {
 		common.ObjectLocks.Unlock(lockIndex)
+		if signature != nil {
+			removeDeltaBase(metaData)
+		}
 		return &notificationHandlerError{fmt.Sprintf("Error in handleUpdate: failed to store object. Error: %s\n", err)}
 	}
 
 	if status == common.CompletelyReceived {
+		if metaData.MetaOnly {
+			// The existing data is kept, verify it against the signature in the updated meta data
+			if err := verifyReceivedObject(metaData); err != nil {
+				common.ObjectLocks.Unlock(lockIndex)
+				return rejectObject(metaData, err)
+			}
+		}
 		notificationsInfo, err := PrepareObjectStatusNotification(metaData, common.Received)
 		common.ObjectLocks.Unlock(lockIndex)
 		if err != nil {
@@ -312,26 +389,27 @@ func handleUpdate(metaData common.MetaData, maxInflightChunks int) common.SyncSe
 	// Call Notification module to send notification to object’s sender
 	if err := Comm.SendNotificationMessage(common.Updated, metaData.OriginType, metaData.OriginID, metaData.InstanceID, metaData.DataID,
 		&metaData); err != nil {
+		if signature != nil {
+			removeDeltaBase(metaData)
+		}
 		return &notificationHandlerError{fmt.Sprintf("Error in handleUpdate: failed to send notification. Error: %s\n", err)}
 	}
 
 	Comm.LockDataChunks(lockIndex, &metaData)
 	defer Comm.UnlockDataChunks(lockIndex, &metaData)
-	if metaData.ChunkSize <= 0 || metaData.ObjectSize <= 0 {
-		if err := Comm.GetData(metaData, 0); err != nil {
-			return err
+
+	if signature != nil {
+		err := Comm.GetDelta(metaData, signature)
+		if err == nil {
+			return nil
 		}
-	} else {
-		var offset int64
-		for i := 0; i < maxInflightChunks && offset < metaData.ObjectSize; i++ {
-			if err := Comm.GetData(metaData, offset); err != nil {
-				return err
-			}
-			offset += int64(metaData.ChunkSize)
+		if trace.IsLogging(logger.TRACE) {
+			trace.Trace("Delta of %s %s is not available, requesting the whole data (%s)\n", metaData.ObjectType, metaData.ObjectID, err)
 		}
+		removeDeltaBase(metaData)
 	}
 
-	return nil
+	return requestObjectData(metaData, maxInflightChunks)
 }
 
 // Handle a notification that an object's update was received by the other side
@@ -361,6 +439,9 @@ func handleObjectUpdated(orgID string, objectType string, objectID string, destT
 		common.Notification{ObjectID: objectID, ObjectType: objectType,
 			DestOrgID: orgID, DestID: destID, DestType: destType, Status: common.Updated, InstanceID: instanceID, DataID: dataID})
 
+	callWebhooksForEvent(common.WebhookEvent{Event: common.WebhookEventReceived, OrgID: orgID, ObjectType: objectType,
+		ObjectID: objectID, InstanceID: instanceID, DestType: destType, DestID: destID, Status: common.Delivering})
+
 	return nil
 }
 
@@ -448,10 +529,14 @@ func handleObjectConsumed(orgID string, objectType string, objectID string, dest
 
 		removeNotificationChunksInfo(*metaData, metaData.OriginType, metaData.OriginID)
 	} else {
+		dests, _ := Store.GetObjectDestinationsList(orgID, objectType, objectID)
 		// Mark that the object was consumed by this destination
 		_, err = Store.UpdateObjectDeliveryStatus(common.Consumed, "", orgID, objectType, objectID, destType, destID)
 		if err != nil && log.IsLogging(logger.ERROR) {
 			log.Error("Error in handleObjectConsumed: failed to mark object as delivered to the destination. Error: %s\n", err)
+		} else if err == nil && completesDelivery(dests, destType, destID) {
+			callWebhooksForEvent(common.WebhookEvent{Event: common.WebhookEventCompleted, OrgID: orgID, ObjectType: objectType,
+				ObjectID: objectID, InstanceID: instanceID})
 		}
 		// Mark the corresponding update notification as "consumed by destination"
 		if err := Store.UpdateNotificationRecord(
@@ -466,6 +551,9 @@ func handleObjectConsumed(orgID string, objectType string, objectID string, dest
 
 	common.ObjectLocks.Unlock(lockIndex)
 
+	callWebhooksForEvent(common.WebhookEvent{Event: common.WebhookEventConsumed, OrgID: orgID, ObjectType: objectType,
+		ObjectID: objectID, InstanceID: instanceID, DestType: destType, DestID: destID, Status: common.Consumed})
+
 	// Send ack
 	if err := Comm.SendNotificationMessage(common.AckConsumed, destType, destID, instanceID, dataID, metaData); err != nil {
 		return &notificationHandlerError{fmt.Sprintf("Error in handleObjectConsumed: failed to send notification. Error: %s\n",
@@ -558,10 +646,12 @@ func handleObjectReceived(orgID string, objectType string, objectID string, dest
 	}
 
 	// Mark that the object was delivered to this destination
+	dests, _ := Store.GetObjectDestinationsList(orgID, objectType, objectID)
 	_, err = Store.UpdateObjectDeliveryStatus(common.Delivered, "", orgID, objectType, objectID, destType, destID)
 	if err != nil && log.IsLogging(logger.ERROR) {
 		log.Error("Error in handleObjectReceived: failed to mark object as delivered to the destination. Error: %s\n", err)
 	}
+	completed := err == nil && completesDelivery(dests, destType, destID)
 	// Mark the corresponding update notification as "received by destination"
 	if err := Store.UpdateNotificationRecord(
 		common.Notification{ObjectID: objectID, ObjectType: objectType,
@@ -573,6 +663,13 @@ func handleObjectReceived(orgID string, objectType string, objectID string, dest
 
 	common.ObjectLocks.Unlock(lockIndex)
 
+	callWebhooksForEvent(common.WebhookEvent{Event: common.WebhookEventDelivered, OrgID: orgID, ObjectType: objectType,
+		ObjectID: objectID, InstanceID: instanceID, DestType: destType, DestID: destID, Status: common.Delivered})
+	if completed {
+		callWebhooksForEvent(common.WebhookEvent{Event: common.WebhookEventCompleted, OrgID: orgID, ObjectType: objectType,
+			ObjectID: objectID, InstanceID: instanceID})
+	}
+
 	// Send ack
 	if err := Comm.SendNotificationMessage(common.AckReceived, destType, destID, instanceID, dataID, metaData); err != nil {
 		return &notificationHandlerError{fmt.Sprintf("Error in handleObjectReceived: failed to send notification. Error: %s\n",
@@ -711,6 +808,10 @@ func handleAckDelete(orgID string, objectType string, objectID string, destType
 
 	// Mark object destination status as deleted by the destination
 	deleteObject, err := Store.UpdateObjectDeliveryStatus(common.Deleted, "", orgID, objectType, objectID, destType, destID)
+	if err == nil {
+		callWebhooksForEvent(common.WebhookEvent{Event: common.WebhookEventDeleted, OrgID: orgID, ObjectType: objectType,
+			ObjectID: objectID, InstanceID: instanceID, DestType: destType, DestID: destID, Status: common.Deleted})
+	}
 	if err == nil && deleteObject {
 		if trace.IsLogging(logger.TRACE) {
 			trace.Trace("Deleting object %s:%s:%s\n", orgID, objectType, objectID)
@@ -826,7 +927,11 @@ func handleResendRequest(dest common.Destination) common.SyncServiceError {
 		destinations := make([]common.Destination, 1)
 		destinations[0] = dest
 		for _, metaData := range objects {
-			notificationsInfo, err := PrepareUpdateNotification(metaData, destinations)
+			objectDestinations, err := FilterRolloutDestinations(metaData, destinations)
+			if err != nil {
+				return &notificationHandlerError{fmt.Sprintf("Error in handleResendRequest. Error: %s\n", err)}
+			}
+			notificationsInfo, err := PrepareUpdateNotification(metaData, objectDestinations)
 			if err != nil {
 				return &notificationHandlerError{fmt.Sprintf("Error in handleResendRequest. Error: %s\n", err)}
 			}
@@ -869,6 +974,13 @@ func handleFeedback(orgID string, objectType string, objectID string, destType s
 		return &ignoredByHandler{}
 	}
 
+	event := common.WebhookEvent{Event: common.WebhookEventFeedback, OrgID: orgID, ObjectType: objectType, ObjectID: objectID,
+		InstanceID: instanceID, DestType: destType, DestID: destID, Code: code, Message: reason}
+	if common.IsErrorFeedback(code) {
+		event.Status = common.Error
+	}
+	callWebhooksForEvent(event)
+
 	if code == common.InvalidObject {
 		deleteObjectInfo(orgID, objectType, objectID, destType, destID, nil, notification.Status == common.Getdata)
 	} else {
@@ -902,11 +1014,20 @@ func handleFeedback(orgID string, objectType string, objectID string, destType s
 }
 
 func handleData(dataMessage []byte) (*common.MetaData, common.SyncServiceError) {
-	orgID, objectType, objectID, dataReader, dataLength, offset, instanceID, err := parseDataMessage(dataMessage)
-	if err != nil {
+	orgID, objectType, objectID, dataReader, dataLength, dataCompression, offset, instanceID, err := parseDataMessage(dataMessage)
+	if err != nil && !isChunkChecksumError(err) {
 		return nil, &notificationHandlerError{fmt.Sprintf("Error in handleData: failed to parse data. Error: %s\n", err.Error())}
 	}
 
+	span := tracing.StartSpan("handleData", orgID, objectType, objectID, nil)
+	metaData, handleErr := processData(orgID, objectType, objectID, dataReader, dataLength, dataCompression, offset, instanceID,
+		err != nil)
+	span.End(spanError(handleErr))
+	return metaData, handleErr
+}
+
+func processData(orgID string, objectType string, objectID string, dataReader io.Reader, dataLength uint32, dataCompression string,
+	offset int64, instanceID int64, corruptedChunk bool) (*common.MetaData, common.SyncServiceError) {
 	if trace.IsLogging(logger.TRACE) {
 		trace.Trace("Handling data of %s %s offset %d\n", objectType, objectID, offset)
 	}
@@ -915,6 +1036,10 @@ func handleData(dataMessage []byte) (*common.MetaData, common.SyncServiceError)
 	Comm.LockDataChunks(lockIndex, nil)
 	defer Comm.UnlockDataChunks(lockIndex, nil)
 
+	if corruptedChunk {
+		return handleCorruptedChunk(orgID, objectType, objectID, offset, instanceID)
+	}
+
 	common.ObjectLocks.Lock(lockIndex)
 
 	metaData, err := Store.RetrieveObject(orgID, objectType, objectID)
@@ -934,6 +1059,17 @@ func handleData(dataMessage []byte) (*common.MetaData, common.SyncServiceError)
 		return metaData, &notificationHandlerError{fmt.Sprintf("Error in handleData: checkNotificationRecord failed. Error: %s\n", err.Error())}
 	}
 
+	if dataCompression != common.NoCompression {
+		// The chunk can't be larger than the rest of the object
+		data, err := compression.Decompress(dataCompression, dataReader, metaData.ObjectSize-offset)
+		if err != nil {
+			common.ObjectLocks.Unlock(lockIndex)
+			return metaData, &notificationHandlerError{fmt.Sprintf("Error in handleData: %s\n", err.Error())}
+		}
+		dataReader = bytes.NewReader(data)
+		dataLength = uint32(len(data))
+	}
+
 	isFirstChunk := total == 0
 	isLastChunk := total+int64(dataLength) >= metaData.ObjectSize
 
@@ -971,6 +1107,18 @@ func handleData(dataMessage []byte) (*common.MetaData, common.SyncServiceError)
 	if isLastChunk {
 		removeNotificationChunksInfo(*metaData, metaData.OriginType, metaData.OriginID)
 
+		if retry, err := verifyReceivedData(*metaData); err != nil {
+			common.ObjectLocks.Unlock(lockIndex)
+			if retry {
+				return metaData, requestObjectData(*metaData, common.Configuration.MaxInflightChunks)
+			}
+			return metaData, rejectObject(*metaData, err)
+		}
+		if err := verifyReceivedObject(*metaData); err != nil {
+			common.ObjectLocks.Unlock(lockIndex)
+			return metaData, rejectObject(*metaData, err)
+		}
+
 		if err := Store.UpdateObjectStatus(orgID, objectType, objectID, common.CompletelyReceived); err != nil {
 			common.ObjectLocks.Unlock(lockIndex)
 			return metaData, &notificationHandlerError{fmt.Sprintf("Error in handleData: %s\n", err)}
@@ -1002,7 +1150,15 @@ func handleData(dataMessage []byte) (*common.MetaData, common.SyncServiceError)
 	return metaData, nil
 }
 
-func handleGetData(metaData common.MetaData, offset int64) common.SyncServiceError {
+// handleGetData sends the requested chunk of the data, compressed if the requesting side accepts the configured compression
+func handleGetData(metaData common.MetaData, offset int64, acceptedCompressions []string, traceContext map[string]string) common.SyncServiceError {
+	span := tracing.StartSpan("handleGetData", metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, traceContext)
+	err := processGetData(metaData, offset, acceptedCompressions)
+	span.End(spanError(err))
+	return err
+}
+
+func processGetData(metaData common.MetaData, offset int64, acceptedCompressions []string) common.SyncServiceError {
 	if trace.IsLogging(logger.TRACE) {
 		trace.Trace("Handling data request for %s %s (offset %d)\n", metaData.ObjectType, metaData.ObjectID, offset)
 	}
@@ -1041,7 +1197,26 @@ func handleGetData(metaData common.MetaData, offset int64) common.SyncServiceErr
 		return err
 	}
 
-	dataMessage, err := buildDataMessage(metaData, objectData, length, offset)
+	// Encrypted data was already compressed before it was encrypted
+	dataCompression := common.NoCompression
+	if !metaData.Encrypted {
+		dataCompression = compression.Select(metaData.DestOrgID, metaData.ObjectType, acceptedCompressions)
+	}
+	if dataCompression != common.NoCompression {
+		compressedData, compressed, err := compression.Compress(dataCompression, objectData[:length])
+		if err != nil {
+			common.ObjectLocks.RUnlock(lockIndex)
+			return &notificationHandlerError{fmt.Sprintf("Error in handleGetData: failed to compress data. %s\n", err)}
+		}
+		if compressed {
+			objectData = compressedData
+			length = len(compressedData)
+		} else {
+			dataCompression = common.NoCompression
+		}
+	}
+
+	dataMessage, err := buildDataMessage(metaData, objectData, length, offset, dataCompression)
 	if err != nil {
 		common.ObjectLocks.RUnlock(lockIndex)
 		return &notificationHandlerError{fmt.Sprintf("Error in handleGetData: failed to build data message. %s\n", err)}
@@ -1071,16 +1246,21 @@ func handleGetData(metaData common.MetaData, offset int64) common.SyncServiceErr
 }
 
 const (
-	orgIDField      = 1
-	objectTypeField = 2
-	objectIDField   = 3
-	offsetField     = 4
-	dataField       = 5
-	instanceIDField = 6
-	fieldCount      = 6
+	orgIDField       = 1
+	objectTypeField  = 2
+	objectIDField    = 3
+	offsetField      = 4
+	dataField        = 5
+	instanceIDField  = 6
+	checksumField    = 7
+	compressionField = 8
+	fieldCount       = 7
 )
 
-func buildDataMessage(metaData common.MetaData, data []byte, dataLength int, offset int64) ([]byte, common.SyncServiceError) {
+// buildDataMessage builds a data message. The compression field is included only if the data is compressed,
+// so that messages of uncompressed data can be handled by older versions.
+func buildDataMessage(metaData common.MetaData, data []byte, dataLength int, offset int64,
+	dataCompression string) ([]byte, common.SyncServiceError) {
 	message := new(bytes.Buffer)
 
 	// magic
@@ -1105,6 +1285,10 @@ func buildDataMessage(metaData common.MetaData, data []byte, dataLength int, off
 
 	// fieldCount
 	value = fieldCount
+	compressed := dataCompression != "" && dataCompression != common.NoCompression
+	if compressed {
+		value++
+	}
 	err = binary.Write(message, binary.BigEndian, value)
 	if err != nil {
 		return nil, &notificationHandlerError{"Failed to write field count to data message. Error: " + err.Error()}
@@ -1209,6 +1393,47 @@ func buildDataMessage(metaData common.MetaData, data []byte, dataLength int, off
 		return nil, &notificationHandlerError{"Failed to write instance ID to data message. Error: " + err.Error()}
 	}
 
+	// checksum
+	// field type
+	value = checksumField
+	if err = binary.Write(message, binary.BigEndian, value); err != nil {
+		return nil, &notificationHandlerError{"Failed to write field type to data message. Error: " + err.Error()}
+	}
+
+	// checksum length
+	checksum := chunkChecksum(data[:dataLength])
+	value = uint32(binary.Size(checksum))
+	if err = binary.Write(message, binary.BigEndian, value); err != nil {
+		return nil, &notificationHandlerError{"Failed to write checksum length to data message. Error: " + err.Error()}
+	}
+
+	// checksum
+	if err = binary.Write(message, binary.BigEndian, checksum); err != nil {
+		return nil, &notificationHandlerError{"Failed to write checksum to data message. Error: " + err.Error()}
+	}
+
+	if compressed {
+		// compression
+		compressionName := []byte(dataCompression)
+
+		// field type
+		value = compressionField
+		if err = binary.Write(message, binary.BigEndian, value); err != nil {
+			return nil, &notificationHandlerError{"Failed to write field type to data message. Error: " + err.Error()}
+		}
+
+		// length
+		value = uint32(len(compressionName))
+		if err = binary.Write(message, binary.BigEndian, value); err != nil {
+			return nil, &notificationHandlerError{"Failed to write field length to data message. Error: " + err.Error()}
+		}
+
+		// compression name
+		if err = binary.Write(message, binary.BigEndian, compressionName); err != nil {
+			return nil, &notificationHandlerError{"Failed to write compression to data message. Error: " + err.Error()}
+		}
+	}
+
 	// field type
 	value = dataField
 	if err = binary.Write(message, binary.BigEndian, value); err != nil {
@@ -1232,8 +1457,10 @@ func buildDataMessage(metaData common.MetaData, data []byte, dataLength int, off
 	return message.Bytes(), nil
 }
 
+// parseDataMessage parses a data message. The returned data is compressed with the returned compression,
+// the returned data length is the length of the compressed data.
 func parseDataMessage(message []byte) (orgID string, objectType string, objectID string, dataReader io.Reader, dataLength uint32,
-	offset int64, instanceID int64, err common.SyncServiceError) {
+	dataCompression string, offset int64, instanceID int64, err common.SyncServiceError) {
 	var (
 		magicValue   uint32
 		versionMajor uint32
@@ -1244,7 +1471,10 @@ func parseDataMessage(message []byte) (orgID string, objectType string, objectID
 		rawString    []byte
 		count        int
 		dataOffset   int64
+		checksum     uint32
+		hasChecksum  bool
 	)
+	dataCompression = common.NoCompression
 
 	messageReader := bytes.NewReader(message)
 	if err = binary.Read(messageReader, binary.BigEndian, &magicValue); err != nil {
@@ -1339,6 +1569,29 @@ func parseDataMessage(message []byte) (orgID string, objectType string, objectID
 				return
 			}
 
+		case checksumField:
+			if fieldLength != uint32(binary.Size(checksum)) {
+				err = &notificationHandlerError{fmt.Sprintf("Length field for checksum wasn't %d, it was %d", uint32(binary.Size(checksum)),
+					fieldLength)}
+				return
+			}
+			if err = binary.Read(messageReader, binary.BigEndian, &checksum); err != nil {
+				return
+			}
+			hasChecksum = true
+
+		case compressionField:
+			rawString = make([]byte, fieldLength)
+			count, err = messageReader.Read(rawString)
+			if err != nil {
+				return
+			}
+			if count != int(fieldLength) {
+				err = &notificationHandlerError{fmt.Sprintf("Read %d bytes for the compression, instead of %d", count, fieldLength)}
+				return
+			}
+			dataCompression = string(rawString)
+
 		case dataField:
 			dataLength = fieldLength
 			dataOffset, err = messageReader.Seek(0, os.SEEK_CUR)
@@ -1361,11 +1614,17 @@ func parseDataMessage(message []byte) (orgID string, objectType string, objectID
 		}
 	}
 
-	if objectType == "" || objectID == "" || dataOffset == 0 {
+	if objectType == "" || objectID == "" || dataOffset == 0 || dataOffset+int64(dataLength) > int64(len(message)) {
 		err = &notificationHandlerError{"Invalid data message\n"}
 		return
 	}
 
+	// Messages sent by older versions have no checksum
+	if hasChecksum && chunkChecksum(message[dataOffset:dataOffset+int64(dataLength)]) != checksum {
+		err = &chunkChecksumError{fmt.Sprintf("Checksum mismatch in the data of %s %s offset %d", objectType, objectID, offset)}
+		return
+	}
+
 	_, err = messageReader.Seek(dataOffset, os.SEEK_SET)
 	if err != nil {
 		return
@@ -1457,6 +1716,18 @@ func updateNotificationChunkInfo(createNotification bool, metaData common.MetaDa
 	return nil
 }
 
+// GetNumberOfInflightChunks returns the number of chunks of data that were requested and not received yet
+func GetNumberOfInflightChunks() int {
+	notificationLock.RLock()
+	defer notificationLock.RUnlock()
+
+	count := 0
+	for _, chunksInfo := range notificationChunks {
+		count += len(chunksInfo.chunkResendTimes)
+	}
+	return count
+}
+
 func removeNotificationChunksInfo(metaData common.MetaData, destType string, destID string) {
 	deleteNotificationChunksInfo(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, destType, destID)
 }
@@ -1,11 +1,17 @@
 package communications
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/compression"
 	"github.com/open-horizon/edge-sync-service/core/storage"
 )
 
@@ -55,10 +61,12 @@ func TestNotificationHandler(t *testing.T) {
 		t.Errorf("Failed to re-register destination. Error: %s", err.Error())
 	}
 
+	// Data messages without a checksum, as sent by older versions
+	var oldFieldCount byte = 6
 	data1 := []byte{1, 1, 1, 1, // magic
 		0, 0, 0, byte(common.Version.Major),
 		0, 0, 0, byte(common.Version.Minor),
-		0, 0, 0, fieldCount,
+		0, 0, 0, oldFieldCount,
 		0, 0, 0, orgIDField, 0, 0, 0, 7, 's', 'o', 'm', 'e', 'o', 'r', 'g',
 		0, 0, 0, objectTypeField, 0, 0, 0, 5, 't', 'y', 'p', 'e', '1',
 		0, 0, 0, objectIDField, 0, 0, 0, 1, '1',
@@ -69,7 +77,7 @@ func TestNotificationHandler(t *testing.T) {
 	data2 := []byte{1, 1, 1, 1, // magic
 		0, 0, 0, byte(common.Version.Major),
 		0, 0, 0, byte(common.Version.Minor),
-		0, 0, 0, fieldCount,
+		0, 0, 0, oldFieldCount,
 		0, 0, 0, orgIDField, 0, 0, 0, 7, 's', 'o', 'm', 'e', 'o', 'r', 'g',
 		0, 0, 0, objectTypeField, 0, 0, 0, 5, 't', 'y', 'p', 'e', '1',
 		0, 0, 0, objectIDField, 0, 0, 0, 1, '4',
@@ -80,7 +88,7 @@ func TestNotificationHandler(t *testing.T) {
 	data3 := []byte{1, 1, 1, 1, // magic
 		0, 0, 0, byte(common.Version.Major),
 		0, 0, 0, byte(common.Version.Minor),
-		0, 0, 0, fieldCount,
+		0, 0, 0, oldFieldCount,
 		0, 0, 0, orgIDField, 0, 0, 0, 7, 's', 'o', 'm', 'e', 'o', 'r', 'g',
 		0, 0, 0, objectTypeField, 0, 0, 0, 5, 't', 'y', 'p', 'e', '1',
 		0, 0, 0, objectIDField, 0, 0, 0, 1, '4',
@@ -91,7 +99,7 @@ func TestNotificationHandler(t *testing.T) {
 	data4 := []byte{1, 1, 1, 1, // magic
 		0, 0, 0, byte(common.Version.Major),
 		0, 0, 0, byte(common.Version.Minor),
-		0, 0, 0, fieldCount,
+		0, 0, 0, oldFieldCount,
 		0, 0, 0, orgIDField, 0, 0, 0, 7, 's', 'o', 'm', 'e', 'o', 'r', 'g',
 		0, 0, 0, objectTypeField, 0, 0, 0, 5, 't', 'y', 'p', 'e', '1',
 		0, 0, 0, objectIDField, 0, 0, 0, 1, '5',
@@ -138,7 +146,7 @@ func TestNotificationHandler(t *testing.T) {
 
 		// The receiving side
 		// Object update
-		if err := handleUpdate(row.metaData, 1); err != nil {
+		if err := handleUpdate(row.metaData, 1, nil); err != nil {
 			t.Errorf("handleUpdate failed (objectID = %s). Error: %s", row.metaData.ObjectID, err.Error())
 		}
 		// Retrieve object's meta data and status, and check them
@@ -324,7 +332,7 @@ func TestNotificationHandler(t *testing.T) {
 			continue
 		}
 		// Object update
-		if err := handleUpdate(row.metaData, 1); err != nil {
+		if err := handleUpdate(row.metaData, 1, nil); err != nil {
 			t.Errorf("handleUpdate failed (objectID = %s). Error: %s", row.metaData.ObjectID, err.Error())
 		}
 
@@ -415,7 +423,7 @@ func TestNotificationHandler(t *testing.T) {
 			// Get data
 			if row.metaData.DestType != "" {
 				// Can't check handleGetData with destinations list
-				if err := handleGetData(row.metaData, row.metaData.InstanceID); err != nil {
+				if err := handleGetData(row.metaData, row.metaData.InstanceID, nil, nil); err != nil {
 					t.Errorf("handleGetData failed (objectID = %s). Error: %s", row.metaData.ObjectID, err.Error())
 				} else {
 					notification, err := Store.RetrieveNotificationRecord(row.metaData.DestOrgID, row.metaData.ObjectType, row.metaData.ObjectID,
@@ -709,7 +717,7 @@ func testPingAndRegisterNew(storageType string, t *testing.T) {
 		} else if len(storedDests) != 1 {
 			t.Errorf("GetObjectDestinationsList returned %d destinations instead of 1.", len(storedDests))
 		} else {
-			if storedDests[0].Destination != dest {
+			if !reflect.DeepEqual(storedDests[0].Destination, dest) {
 				t.Errorf("GetObjectDestinationsList returned incorrect destination.")
 			}
 			if storedDests[0].Status != common.Delivering {
@@ -946,6 +954,161 @@ func TestRegisterDestinationValidity(t *testing.T) {
 	}
 }
 
+func TestRegisterDestinationProperties(t *testing.T) {
+	testRegisterDestinationProperties(common.Bolt, t)
+	testRegisterDestinationProperties(common.Mongo, t)
+}
+
+func testRegisterDestinationProperties(storageType string, t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.CSS
+
+	var err error
+	Store, err = setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	if err := Store.DeleteDestination("proporg", "device", "dev1"); err != nil {
+		t.Errorf("DeleteDestination failed. Error: %s", err.Error())
+	}
+
+	checkProperties := func(expected map[string]string) {
+		dest, err := Store.RetrieveDestination("proporg", "device", "dev1")
+		if err != nil || dest == nil {
+			t.Errorf("Failed to retrieve the destination. Error: %v", err)
+		} else if !reflect.DeepEqual(dest.Properties, expected) {
+			t.Errorf("The destination has the properties %v instead of %v", dest.Properties, expected)
+		}
+	}
+
+	dest := common.Destination{DestOrgID: "proporg", DestType: "device", DestID: "dev1", Communication: common.MQTTProtocol,
+		Properties: map[string]string{"region": "eu", "hardware": "rpi4"}}
+	if err := handleRegisterNew(dest, false); err != nil {
+		t.Errorf("handleRegisterNew failed. Error: %s", err.Error())
+	}
+	checkProperties(dest.Properties)
+
+	// The stored properties are kept if the destination doesn't publish properties
+	edited := map[string]string{"region": "eu", "site": "paris"}
+	stored := dest
+	stored.Properties = edited
+	if err := Store.StoreDestination(stored); err != nil {
+		t.Errorf("StoreDestination failed. Error: %s", err.Error())
+	}
+	dest.Properties = nil
+	if err := handleRegistration(dest, false); err != nil {
+		t.Errorf("handleRegistration failed. Error: %s", err.Error())
+	}
+	checkProperties(edited)
+	if err := handleRegisterNew(dest, true); err != nil {
+		t.Errorf("handleRegisterNew failed. Error: %s", err.Error())
+	}
+	checkProperties(edited)
+
+	// Published properties replace the stored properties
+	dest.Properties = map[string]string{"region": "us"}
+	if err := handleRegistration(dest, false); err != nil {
+		t.Errorf("handleRegistration failed. Error: %s", err.Error())
+	}
+	checkProperties(dest.Properties)
+
+	dest.Properties = map[string]string{"region": "eu,us"}
+	if err := handleRegistration(dest, false); err == nil {
+		t.Errorf("handleRegistration accepted invalid properties")
+	}
+	if err := handleRegisterNew(dest, false); err == nil {
+		t.Errorf("handleRegisterNew accepted invalid properties")
+	}
+	checkProperties(map[string]string{"region": "us"})
+}
+
+func TestCompressedData(t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.ESS
+
+	var err error
+	Store, err = setUpStorage(common.Bolt)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	data := []byte(strings.Repeat("compressed data ", 128))
+	chunkSize := len(data) / 2
+
+	for i, dataCompression := range compression.Supported() {
+		metaData := common.MetaData{ObjectID: "compressed" + strconv.Itoa(i), ObjectType: "type1", DestOrgID: "myorg",
+			DestID: "dev1", DestType: "device", OriginID: "123", OriginType: "type2", ObjectSize: int64(len(data)),
+			ChunkSize: chunkSize, InstanceID: 1, DataID: 1}
+		if err := handleUpdate(metaData, 1, nil); err != nil {
+			t.Errorf("handleUpdate failed (%s). Error: %s", dataCompression, err.Error())
+			continue
+		}
+
+		for offset := 0; offset < len(data); offset += chunkSize {
+			compressedData, compressed, err := compression.Compress(dataCompression, data[offset:offset+chunkSize])
+			if err != nil || !compressed {
+				t.Errorf("Failed to compress data (%s). Error: %v", dataCompression, err)
+				break
+			}
+			message, err := buildDataMessage(metaData, compressedData, len(compressedData), int64(offset), dataCompression)
+			if err != nil {
+				t.Errorf("Failed to build data message (%s). Error: %s", dataCompression, err.Error())
+				break
+			}
+			if _, _, _, _, _, messageCompression, _, _, err := parseDataMessage(message); err != nil ||
+				messageCompression != dataCompression {
+				t.Errorf("Wrong compression in the parsed data message: %s instead of %s. Error: %v", messageCompression,
+					dataCompression, err)
+			}
+			if _, err := handleData(message); err != nil {
+				t.Errorf("handleData failed (%s). Error: %s", dataCompression, err.Error())
+			}
+		}
+
+		status, err := Store.RetrieveObjectStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+		if err != nil || status != common.CompletelyReceived {
+			t.Errorf("The object wasn't received (%s): status %s. Error: %v", dataCompression, status, err)
+			continue
+		}
+		dataReader, err := Store.RetrieveObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+		if err != nil || dataReader == nil {
+			t.Errorf("Failed to retrieve the object's data (%s). Error: %v", dataCompression, err)
+			continue
+		}
+		storedData, _ := ioutil.ReadAll(dataReader)
+		Store.CloseDataReader(dataReader)
+		if !bytes.Equal(storedData, data) {
+			t.Errorf("The stored data doesn't match the data (%s)", dataCompression)
+		}
+	}
+
+	// Uncompressed data messages have no compression field
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: "myorg"}
+	message, _ := buildDataMessage(metaData, data, len(data), 0, common.NoCompression)
+	if message[15] != fieldCount {
+		t.Errorf("Wrong field count in an uncompressed data message: %d instead of %d", message[15], fieldCount)
+	}
+	if _, _, _, _, _, messageCompression, _, _, err := parseDataMessage(message); err != nil ||
+		messageCompression != common.NoCompression {
+		t.Errorf("Wrong compression in the parsed data message: %s. Error: %v", messageCompression, err)
+	}
+}
+
 func setUpStorage(storageType string) (storage.Storage, error) {
 	var store storage.Storage
 	if storageType == common.InMemory {
@@ -0,0 +1,140 @@
+package communications
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+// Applications can stream the updates of the objects of a type instead of polling for them or registering a webhook.
+// An update is pushed to the streams when the webhooks are called. Each update is identified by a cursor, and the
+// recent updates are kept, so that a client that reconnects with the cursor of the last update it received gets
+// the updates it missed. A cursor consists of the start time of the node and a sequence number.
+//
+// The recent updates and the streams are kept in the memory of the node, so a stream gets only the updates of the
+// objects that are received by the node it is connected to. When several CSS instances share the storage, a client
+// gets the updates received by the other instances only when it reconnects: its cursor isn't recognized by another
+// instance, or by the same instance after a restart, and the objects that have pending updates are sent first.
+
+const (
+	objectUpdatesHistorySize = 1000
+	objectUpdatesBufferSize  = 100
+)
+
+// ObjectUpdate is an update of an object pushed to the streams of updates of the objects of its type
+type ObjectUpdate struct {
+	Cursor   string
+	MetaData common.MetaData
+}
+
+// ObjectUpdatesStream is a stream of updates of the objects of a type
+type ObjectUpdatesStream struct {
+	orgID      string
+	objectType string
+
+	// Updates is closed when the stream is closed, or if the client falls behind and the stream's buffer fills up
+	Updates chan ObjectUpdate
+}
+
+var objectUpdatesLock sync.Mutex
+var objectUpdatesEpoch = strconv.FormatInt(time.Now().UnixNano(), 36)
+var objectUpdatesSequence uint64
+var objectUpdatesHistory = make([]ObjectUpdate, 0, objectUpdatesHistorySize)
+var objectUpdatesStreams = make(map[*ObjectUpdatesStream]bool)
+
+// OpenObjectUpdatesStream opens a stream of updates of the objects of the given type.
+// If a cursor is provided, the updates after it are returned, and resumed is true. If the cursor is empty, or the
+// updates after it are no longer kept, resumed is false, and the caller should send the currently updated objects
+// to the client before the streamed updates. The cursor to be used for these objects is returned.
+func OpenObjectUpdatesStream(orgID string, objectType string, cursor string) (stream *ObjectUpdatesStream,
+	missedUpdates []ObjectUpdate, currentCursor string, resumed bool) {
+	objectUpdatesLock.Lock()
+	defer objectUpdatesLock.Unlock()
+
+	stream = &ObjectUpdatesStream{orgID: orgID, objectType: objectType, Updates: make(chan ObjectUpdate, objectUpdatesBufferSize)}
+	objectUpdatesStreams[stream] = true
+	currentCursor = buildObjectUpdatesCursor(objectUpdatesSequence)
+
+	sequence, ok := parseObjectUpdatesCursor(cursor)
+	if !ok || sequence > objectUpdatesSequence {
+		return stream, nil, currentCursor, false
+	}
+	// The history holds the updates with sequence numbers from objectUpdatesSequence-len(history)+1 to objectUpdatesSequence
+	missed := objectUpdatesSequence - sequence
+	if missed > uint64(len(objectUpdatesHistory)) {
+		return stream, nil, currentCursor, false
+	}
+	missedUpdates = make([]ObjectUpdate, 0)
+	for _, update := range objectUpdatesHistory[len(objectUpdatesHistory)-int(missed):] {
+		if update.MetaData.DestOrgID == orgID && update.MetaData.ObjectType == objectType {
+			missedUpdates = append(missedUpdates, update)
+		}
+	}
+	return stream, missedUpdates, currentCursor, true
+}
+
+// CloseObjectUpdatesStream closes a stream of updates of objects
+func CloseObjectUpdatesStream(stream *ObjectUpdatesStream) {
+	objectUpdatesLock.Lock()
+	defer objectUpdatesLock.Unlock()
+	if objectUpdatesStreams[stream] {
+		delete(objectUpdatesStreams, stream)
+		close(stream.Updates)
+	}
+}
+
+// CloseAllObjectUpdatesStreams closes all the streams of updates of objects, to be called when the Sync Service stops
+func CloseAllObjectUpdatesStreams() {
+	objectUpdatesLock.Lock()
+	defer objectUpdatesLock.Unlock()
+	for stream := range objectUpdatesStreams {
+		delete(objectUpdatesStreams, stream)
+		close(stream.Updates)
+	}
+}
+
+func publishObjectUpdate(metaData *common.MetaData) {
+	objectUpdatesLock.Lock()
+	defer objectUpdatesLock.Unlock()
+
+	objectUpdatesSequence++
+	update := ObjectUpdate{Cursor: buildObjectUpdatesCursor(objectUpdatesSequence), MetaData: *metaData}
+	if len(objectUpdatesHistory) == objectUpdatesHistorySize {
+		copy(objectUpdatesHistory, objectUpdatesHistory[1:])
+		objectUpdatesHistory = objectUpdatesHistory[:objectUpdatesHistorySize-1]
+	}
+	objectUpdatesHistory = append(objectUpdatesHistory, update)
+
+	for stream := range objectUpdatesStreams {
+		if stream.orgID != metaData.DestOrgID || stream.objectType != metaData.ObjectType {
+			continue
+		}
+		select {
+		case stream.Updates <- update:
+		default:
+			// The client falls behind, it will resume from its last cursor when it reconnects
+			delete(objectUpdatesStreams, stream)
+			close(stream.Updates)
+		}
+	}
+}
+
+func buildObjectUpdatesCursor(sequence uint64) string {
+	return fmt.Sprintf("%s-%d", objectUpdatesEpoch, sequence)
+}
+
+func parseObjectUpdatesCursor(cursor string) (uint64, bool) {
+	parts := strings.Split(cursor, "-")
+	if len(parts) != 2 || parts[0] != objectUpdatesEpoch {
+		return 0, false
+	}
+	sequence, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return sequence, true
+}
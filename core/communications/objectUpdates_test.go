@@ -0,0 +1,85 @@
+package communications
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+func TestObjectUpdatesStream(t *testing.T) {
+	stream, missedUpdates, cursor, resumed := OpenObjectUpdatesStream("myorg", "stream1", "")
+	if resumed || len(missedUpdates) != 0 {
+		t.Errorf("A stream opened without a cursor was resumed")
+	}
+
+	publishObjectUpdate(&common.MetaData{ObjectID: "1", ObjectType: "stream1", DestOrgID: "myorg"})
+	publishObjectUpdate(&common.MetaData{ObjectID: "2", ObjectType: "stream2", DestOrgID: "myorg"})
+	publishObjectUpdate(&common.MetaData{ObjectID: "3", ObjectType: "stream1", DestOrgID: "myorg"})
+
+	var lastCursor string
+	for _, id := range []string{"1", "3"} {
+		update := <-stream.Updates
+		if update.MetaData.ObjectID != id {
+			t.Errorf("Received update of object %s instead of %s", update.MetaData.ObjectID, id)
+		}
+		if update.Cursor == lastCursor || update.Cursor == cursor {
+			t.Errorf("The update of object %s has a reused cursor %s", id, update.Cursor)
+		}
+		lastCursor = update.Cursor
+	}
+	if len(stream.Updates) != 0 {
+		t.Errorf("Received an update of an object of another type")
+	}
+	CloseObjectUpdatesStream(stream)
+	if _, ok := <-stream.Updates; ok {
+		t.Errorf("The updates of a closed stream weren't closed")
+	}
+
+	// Resume from the cursor of the stream's opening
+	stream, missedUpdates, _, resumed = OpenObjectUpdatesStream("myorg", "stream1", cursor)
+	if !resumed || len(missedUpdates) != 2 || missedUpdates[0].MetaData.ObjectID != "1" || missedUpdates[1].MetaData.ObjectID != "3" {
+		t.Errorf("Wrong missed updates after resuming the stream: %v", missedUpdates)
+	}
+	CloseObjectUpdatesStream(stream)
+
+	// Resume from the last update
+	stream, missedUpdates, _, resumed = OpenObjectUpdatesStream("myorg", "stream1", lastCursor)
+	if !resumed || len(missedUpdates) != 0 {
+		t.Errorf("Wrong missed updates after resuming the stream from its last update: %v", missedUpdates)
+	}
+	CloseObjectUpdatesStream(stream)
+
+	// Cursors of another run of the node aren't resumed
+	for _, invalidCursor := range []string{"abc-1", "1", objectUpdatesEpoch + "-x", objectUpdatesEpoch + "-1000000"} {
+		stream, _, _, resumed = OpenObjectUpdatesStream("myorg", "stream1", invalidCursor)
+		if resumed {
+			t.Errorf("The stream was resumed from the invalid cursor %s", invalidCursor)
+		}
+		CloseObjectUpdatesStream(stream)
+	}
+
+	// A client that falls behind is disconnected
+	stream, _, _, _ = OpenObjectUpdatesStream("myorg", "stream1", "")
+	for i := 0; i <= objectUpdatesBufferSize; i++ {
+		publishObjectUpdate(&common.MetaData{ObjectID: strconv.Itoa(i), ObjectType: "stream1", DestOrgID: "myorg"})
+	}
+	received := 0
+	for range stream.Updates {
+		received++
+	}
+	if received != objectUpdatesBufferSize {
+		t.Errorf("Received %d updates before the stream was closed instead of %d", received, objectUpdatesBufferSize)
+	}
+	CloseObjectUpdatesStream(stream)
+
+	// The updates are no longer kept
+	for i := 0; i < objectUpdatesHistorySize; i++ {
+		publishObjectUpdate(&common.MetaData{ObjectID: strconv.Itoa(i), ObjectType: "stream2", DestOrgID: "myorg"})
+	}
+	stream, _, _, resumed = OpenObjectUpdatesStream("myorg", "stream1", lastCursor)
+	if resumed {
+		t.Errorf("The stream was resumed from a cursor of an update that is no longer kept")
+	}
+	CloseObjectUpdatesStream(stream)
+}
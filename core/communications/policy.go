@@ -0,0 +1,226 @@
+package communications
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+	"github.com/open-horizon/edge-utilities/logger/trace"
+)
+
+// When the PolicyEvaluation configuration property is set, the CSS resolves the destination policies of objects
+// to destinations, instead of an external agent. The destinations of an object with a destination policy are the
+// destinations whose policies, sent by the ESSs when they register, match the object's policy. The properties of
+// a destination are added to the properties of its policy. The object's destinations are evaluated when the object
+// is stored, when a destination registers with a changed policy or properties, and when an admin edits the properties
+// of a destination.
+
+// IsPolicyEvaluated returns true if the CSS resolves the destination policies of objects to destinations
+func IsPolicyEvaluated() bool {
+	return common.Configuration.PolicyEvaluation && common.Configuration.NodeType == common.CSS
+}
+
+// UpdatePolicyDestinations sets the destinations of an object with a destination policy to the destinations
+// of its organization that match the policy. Returns the destinations that were removed from the object.
+// This function should not acquire an object lock (common.ObjectLocks) as the caller has already acquired one.
+func UpdatePolicyDestinations(metaData common.MetaData) ([]common.StoreDestinationStatus, common.SyncServiceError) {
+	destinations, err := Store.RetrieveDestinations(metaData.DestOrgID, "")
+	if err != nil {
+		return nil, err
+	}
+	destinationsList := make([]string, 0)
+	for _, destination := range destinations {
+		if matchesDestinationPolicy(metaData, destination) {
+			destinationsList = append(destinationsList, destination.DestType+":"+destination.DestID)
+		}
+	}
+	_, _, deletedDestinations, _, err := Store.UpdateObjectDestinations(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
+		destinationsList)
+	if err != nil {
+		return nil, err
+	}
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("The destination policy of %s:%s:%s matches %d destinations\n", metaData.DestOrgID, metaData.ObjectType,
+			metaData.ObjectID, len(destinationsList))
+	}
+	return deletedDestinations, nil
+}
+
+// matchesDestinationPolicy returns true if the policy of the destination matches the destination policy of the object.
+// An invalid constraint doesn't match any policy.
+func matchesDestinationPolicy(metaData common.MetaData, destination common.Destination) bool {
+	matches, err := common.PoliciesMatch(metaData.DestinationPolicy, destinationPolicy(destination))
+	if err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Failed to match the destination policy of %s:%s:%s with the policy of %s:%s. Error: %s\n", metaData.DestOrgID,
+				metaData.ObjectType, metaData.ObjectID, destination.DestType, destination.DestID, err)
+		}
+		return false
+	}
+	return matches
+}
+
+// destinationPolicy returns the policy of a destination that is matched with the destination policies of objects:
+// the destination's policy with the destination's properties added to its properties.
+// A property of the destination's policy takes precedence over a destination property with the same name.
+func destinationPolicy(destination common.Destination) *common.Policy {
+	if len(destination.Properties) == 0 {
+		return destination.Policy
+	}
+	policy := common.Policy{}
+	if destination.Policy != nil {
+		policy = *destination.Policy
+	}
+	names := make([]string, 0, len(destination.Properties))
+	for name := range destination.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	properties := make([]common.PolicyProperty, 0, len(policy.Properties)+len(names))
+	properties = append(properties, policy.Properties...)
+	for _, name := range names {
+		found := false
+		for _, property := range policy.Properties {
+			if property.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			properties = append(properties, common.PolicyProperty{Name: name, Value: destination.Properties[name]})
+		}
+	}
+	policy.Properties = properties
+	return &policy
+}
+
+// isDestinationPolicyChanged returns true if a destination may match different objects than when it was stored
+func isDestinationPolicyChanged(stored *common.Destination, destination common.Destination) bool {
+	if stored == nil {
+		return true
+	}
+	// The values of the properties are compared as JSON, as their types may change when they are stored
+	storedPolicy, _ := json.Marshal(destinationPolicy(*stored))
+	policy, _ := json.Marshal(destinationPolicy(destination))
+	return string(storedPolicy) != string(policy)
+}
+
+// EvaluateChangedDestinationPolicy updates the objects with a destination policy after the policy or the properties
+// of a destination were changed, if the CSS resolves the destination policies of objects
+func EvaluateChangedDestinationPolicy(stored *common.Destination, destination common.Destination) common.SyncServiceError {
+	if !IsPolicyEvaluated() || !isDestinationPolicyChanged(stored, destination) {
+		return nil
+	}
+	return evaluateDestinationPolicy(destination)
+}
+
+// evaluateDestinationPolicy adds a destination to the objects with a destination policy that it matches,
+// and removes it from the objects that it no longer matches. The failure to update an object is logged
+// and doesn't prevent updating the other objects and sending their notifications.
+func evaluateDestinationPolicy(destination common.Destination) common.SyncServiceError {
+	objects, err := Store.RetrieveObjectsWithDestinationPolicy(destination.DestOrgID, true, common.ObjectsFilter{})
+	if err != nil {
+		return err
+	}
+
+	notificationsInfo := make([]common.NotificationInfo, 0)
+	for _, object := range objects {
+		included := false
+		for _, objectDestination := range object.Destinations {
+			if objectDestination.DestType == destination.DestType && objectDestination.DestID == destination.DestID {
+				included = true
+				break
+			}
+		}
+		metaData := common.MetaData{DestOrgID: object.OrgID, ObjectType: object.ObjectType, ObjectID: object.ObjectID,
+			DestinationPolicy: object.DestinationPolicy}
+		if matchesDestinationPolicy(metaData, destination) == included {
+			continue
+		}
+
+		lockIndex := common.HashStrings(object.OrgID, object.ObjectType, object.ObjectID)
+		common.ObjectLocks.Lock(lockIndex)
+		objectNotificationsInfo, err := updatePolicyDestination(object, destination, !included)
+		common.ObjectLocks.Unlock(lockIndex)
+		if err != nil {
+			if log.IsLogging(logger.ERROR) {
+				log.Error("Failed to update the destination %s:%s of %s:%s:%s by its policy. Error: %s\n", destination.DestType,
+					destination.DestID, object.OrgID, object.ObjectType, object.ObjectID, err.Error())
+			}
+			continue
+		}
+		notificationsInfo = append(notificationsInfo, objectNotificationsInfo...)
+	}
+
+	return SendNotifications(notificationsInfo)
+}
+
+// updatePolicyDestination adds a destination to an object with a destination policy or removes it from the object,
+// and prepares the notifications of the destination
+// This function should not acquire an object lock (common.ObjectLocks) as the caller has already acquired one.
+func updatePolicyDestination(object common.ObjectDestinationPolicy, destination common.Destination, add bool) ([]common.NotificationInfo,
+	common.SyncServiceError) {
+	destinations, err := Store.GetObjectDestinationsList(object.OrgID, object.ObjectType, object.ObjectID)
+	if err != nil {
+		return nil, err
+	}
+	destinationsList := make([]string, 0, len(destinations)+1)
+	for _, objectDestination := range destinations {
+		if objectDestination.Destination.DestType != destination.DestType || objectDestination.Destination.DestID != destination.DestID {
+			destinationsList = append(destinationsList, objectDestination.Destination.DestType+":"+objectDestination.Destination.DestID)
+		}
+	}
+	if add {
+		destinationsList = append(destinationsList, destination.DestType+":"+destination.DestID)
+	}
+
+	metaData, status, deletedDestinations, addedDestinations, err := Store.UpdateObjectDestinations(object.OrgID, object.ObjectType,
+		object.ObjectID, destinationsList)
+	if err != nil || metaData == nil {
+		return nil, err
+	}
+	if log.IsLogging(logger.INFO) {
+		action := "Removed"
+		if add {
+			action = "Added"
+		}
+		log.Info("%s %s:%s as a destination of %s:%s:%s by its policy", action, destination.DestType, destination.DestID,
+			object.OrgID, object.ObjectType, object.ObjectID)
+	}
+
+	deleteNotificationsInfo, updateNotificationsInfo, err := PrepareObjectDestinationsNotifications(*metaData, status,
+		deletedDestinations, addedDestinations)
+	if err != nil {
+		return nil, err
+	}
+	return append(deleteNotificationsInfo, updateNotificationsInfo...), nil
+}
+
+// readDestinationPolicy reads the policy of the ESS from the DestinationPolicyFile, or returns nil if it isn't set
+func readDestinationPolicy() (*common.Policy, common.SyncServiceError) {
+	if common.Configuration.DestinationPolicyFile == "" {
+		return nil, nil
+	}
+	content, err := ioutil.ReadFile(common.Configuration.DestinationPolicyFile)
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to read the destination policy file %s. Error: %s", common.Configuration.DestinationPolicyFile, err)}
+	}
+	var policy common.Policy
+	if err := json.Unmarshal(content, &policy); err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to parse the destination policy file %s. Error: %s", common.Configuration.DestinationPolicyFile, err)}
+	}
+	for _, property := range policy.Properties {
+		if property.Name == "" {
+			return nil, &Error{"A property in the destination policy must have a name"}
+		}
+	}
+	if err := common.ValidateConstraints(policy.Constraints); err != nil {
+		return nil, &Error{"Invalid destination policy. " + err.Error()}
+	}
+	return &policy, nil
+}
@@ -0,0 +1,240 @@
+package communications
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+func TestDestinationPolicyEvaluation(t *testing.T) {
+	testDestinationPolicyEvaluation(common.Bolt, t)
+	testDestinationPolicyEvaluation(common.Mongo, t)
+}
+
+func testDestinationPolicyEvaluation(storageType string, t *testing.T) {
+	common.InitObjectLocks()
+	common.Configuration.NodeType = common.CSS
+	common.Configuration.PolicyEvaluation = true
+	defer func() { common.Configuration.PolicyEvaluation = false }()
+
+	var err error
+	Store, err = setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	objects := []common.MetaData{
+		{ObjectID: "1", ObjectType: "type1", DestOrgID: "policyorg", OriginID: "123", OriginType: "type2",
+			DestinationPolicy: &common.Policy{Constraints: []string{"hardware == gpu"}}},
+		{ObjectID: "2", ObjectType: "type1", DestOrgID: "policyorg", OriginID: "123", OriginType: "type2",
+			DestinationPolicy: &common.Policy{Properties: []common.PolicyProperty{{Name: "purpose", Value: "config"}},
+				Constraints: []string{"hardware == cpu"}}},
+	}
+	for _, metaData := range objects {
+		if _, err := Store.StoreObject(metaData, []byte("hello"), common.ReadyToSend); err != nil {
+			t.Errorf("StoreObject failed. Error: %s", err.Error())
+		}
+	}
+	for _, destID := range []string{"dev1", "dev2"} {
+		if err := Store.DeleteDestination("policyorg", "device", destID); err != nil {
+			t.Errorf("DeleteDestination failed. Error: %s", err.Error())
+		}
+	}
+
+	checkDestinations := func(objectID string, expected ...string) {
+		metaData, err := Store.RetrieveObject("policyorg", "type1", objectID)
+		if err != nil || metaData == nil {
+			t.Errorf("Failed to retrieve object %s. Error: %v", objectID, err)
+			return
+		}
+		destinations, err := Store.GetObjectDestinations(*metaData)
+		if err != nil {
+			t.Errorf("GetObjectDestinations failed. Error: %s", err.Error())
+			return
+		}
+		if len(destinations) != len(expected) {
+			t.Errorf("Object %s has %d destinations instead of %d", objectID, len(destinations), len(expected))
+			return
+		}
+		for _, destID := range expected {
+			found := false
+			for _, destination := range destinations {
+				if destination.DestID == destID {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("%s isn't a destination of object %s", destID, objectID)
+			}
+		}
+	}
+	checkNotification := func(objectID string, status string) {
+		notification, err := Store.RetrieveNotificationRecord("policyorg", "type1", objectID, "device", "dev1")
+		if err != nil || notification == nil {
+			t.Errorf("No notification of object %s. Error: %v", objectID, err)
+		} else if notification.Status != status {
+			t.Errorf("Wrong notification status of object %s: %s instead of %s", objectID, notification.Status, status)
+		}
+	}
+
+	dest := common.Destination{DestOrgID: "policyorg", DestType: "device", DestID: "dev1", Communication: common.MQTTProtocol,
+		Policy: &common.Policy{Properties: []common.PolicyProperty{{Name: "hardware", Value: "gpu"}}}}
+	if err := handleRegisterNew(dest, false); err != nil {
+		t.Errorf("handleRegisterNew failed. Error: %s", err.Error())
+	}
+	checkDestinations("1", "dev1")
+	checkDestinations("2")
+	checkNotification("1", common.Update)
+
+	if _, err := Store.UpdateObjectDeliveryStatus(common.Delivered, "", "policyorg", "type1", "1", "device", "dev1"); err != nil {
+		t.Errorf("UpdateObjectDeliveryStatus failed. Error: %s", err.Error())
+	}
+
+	// The destination registers with a policy that matches the other object
+	dest.Policy = &common.Policy{Properties: []common.PolicyProperty{{Name: "hardware", Value: "cpu"}},
+		Constraints: []string{"purpose == config"}}
+	if err := handleRegistration(dest, false); err != nil {
+		t.Errorf("handleRegistration failed. Error: %s", err.Error())
+	}
+	checkDestinations("1")
+	checkDestinations("2", "dev1")
+	checkNotification("1", common.Delete)
+	checkNotification("2", common.Update)
+
+	// An object without constraints matches all the destinations whose constraints it satisfies
+	dest2 := common.Destination{DestOrgID: "policyorg", DestType: "device", DestID: "dev2", Communication: common.MQTTProtocol}
+	if err := handleRegisterNew(dest2, false); err != nil {
+		t.Errorf("handleRegisterNew failed. Error: %s", err.Error())
+	}
+	metaData := common.MetaData{ObjectID: "3", ObjectType: "type1", DestOrgID: "policyorg", OriginID: "123", OriginType: "type2",
+		DestinationPolicy: &common.Policy{Properties: []common.PolicyProperty{{Name: "purpose", Value: "config"}}}}
+	if _, err := Store.StoreObject(metaData, []byte("hello"), common.ReadyToSend); err != nil {
+		t.Errorf("StoreObject failed. Error: %s", err.Error())
+	}
+	if deleted, err := UpdatePolicyDestinations(metaData); err != nil {
+		t.Errorf("UpdatePolicyDestinations failed. Error: %s", err.Error())
+	} else if len(deleted) != 0 {
+		t.Errorf("UpdatePolicyDestinations deleted destinations of a new object")
+	}
+	checkDestinations("3", "dev1", "dev2")
+
+	metaData.DestinationPolicy.Constraints = []string{"hardware == cpu"}
+	if deleted, err := UpdatePolicyDestinations(metaData); err != nil {
+		t.Errorf("UpdatePolicyDestinations failed. Error: %s", err.Error())
+	} else if len(deleted) != 1 || deleted[0].Destination.DestID != "dev2" {
+		t.Errorf("UpdatePolicyDestinations returned incorrect deleted destinations: %v", deleted)
+	}
+	checkDestinations("3", "dev1")
+
+	// The properties of a destination are matched with the constraints too
+	if _, err := Store.StoreObject(metaData, []byte("hello"), common.ReadyToSend); err != nil {
+		t.Errorf("StoreObject failed. Error: %s", err.Error())
+	}
+	if _, err := UpdatePolicyDestinations(metaData); err != nil {
+		t.Errorf("UpdatePolicyDestinations failed. Error: %s", err.Error())
+	}
+	stored := dest2
+	dest2.Properties = map[string]string{"hardware": "cpu"}
+	if err := Store.StoreDestination(dest2); err != nil {
+		t.Errorf("StoreDestination failed. Error: %s", err.Error())
+	}
+	if err := EvaluateChangedDestinationPolicy(&stored, dest2); err != nil {
+		t.Errorf("EvaluateChangedDestinationPolicy failed. Error: %s", err.Error())
+	}
+	checkDestinations("3", "dev1", "dev2")
+
+	// A property of the destination's policy takes precedence
+	stored = dest2
+	dest2.Policy = &common.Policy{Properties: []common.PolicyProperty{{Name: "hardware", Value: "gpu"}}}
+	if err := Store.StoreDestination(dest2); err != nil {
+		t.Errorf("StoreDestination failed. Error: %s", err.Error())
+	}
+	if err := EvaluateChangedDestinationPolicy(&stored, dest2); err != nil {
+		t.Errorf("EvaluateChangedDestinationPolicy failed. Error: %s", err.Error())
+	}
+	checkDestinations("3", "dev1")
+
+	// A destination that starts matching an object with a rollout is notified by the waves of the rollout
+	metaData = common.MetaData{ObjectID: "4", ObjectType: "type1", DestOrgID: "policyorg", OriginID: "123", OriginType: "type2",
+		DestinationPolicy: &common.Policy{Constraints: []string{"hardware == tpu"}},
+		Rollout:           &common.Rollout{Waves: []common.RolloutWave{{Count: 1}}}}
+	if _, err := Store.StoreObject(metaData, []byte("hello"), common.ReadyToSend); err != nil {
+		t.Errorf("StoreObject failed. Error: %s", err.Error())
+	}
+	if _, err := UpdatePolicyDestinations(metaData); err != nil {
+		t.Errorf("UpdatePolicyDestinations failed. Error: %s", err.Error())
+	}
+	checkDestinations("4")
+	stored = dest2
+	dest2.Policy = &common.Policy{Properties: []common.PolicyProperty{{Name: "hardware", Value: "tpu"}}}
+	if err := Store.StoreDestination(dest2); err != nil {
+		t.Errorf("StoreDestination failed. Error: %s", err.Error())
+	}
+	if err := EvaluateChangedDestinationPolicy(&stored, dest2); err != nil {
+		t.Errorf("EvaluateChangedDestinationPolicy failed. Error: %s", err.Error())
+	}
+	checkDestinations("4", "dev2")
+	if notification, _ := Store.RetrieveNotificationRecord("policyorg", "type1", "4", "device", "dev2"); notification != nil {
+		t.Errorf("The destination was notified before the rollout of the object started")
+	}
+
+	for _, objectID := range []string{"1", "2", "3", "4"} {
+		Store.DeleteStoredObject("policyorg", "type1", objectID)
+	}
+}
+
+func TestReadDestinationPolicy(t *testing.T) {
+	file, err := ioutil.TempFile("", "policy")
+	if err != nil {
+		t.Errorf("Failed to create a temporary file. Error: %s", err.Error())
+		return
+	}
+	defer os.Remove(file.Name())
+	defer func() { common.Configuration.DestinationPolicyFile = "" }()
+
+	common.Configuration.DestinationPolicyFile = ""
+	if policy, err := readDestinationPolicy(); err != nil || policy != nil {
+		t.Errorf("readDestinationPolicy returned a policy without a policy file. Error: %v", err)
+	}
+
+	common.Configuration.DestinationPolicyFile = file.Name()
+	tests := []struct {
+		content string
+		valid   bool
+	}{
+		{`{"properties": [{"name": "hardware", "value": "gpu"}], "constraints": ["purpose == model"]}`, true},
+		{`{"properties": [{"name": "hardware", "value": "gpu"}`, false},
+		{`{"properties": [{"value": "gpu"}]}`, false},
+		{`{"constraints": ["purpose =="]}`, false},
+	}
+	for index, test := range tests {
+		if err := ioutil.WriteFile(file.Name(), []byte(test.content), 0600); err != nil {
+			t.Errorf("Failed to write the policy file. Error: %s", err.Error())
+			continue
+		}
+		policy, err := readDestinationPolicy()
+		if test.valid {
+			if err != nil {
+				t.Errorf("readDestinationPolicy failed (test %d). Error: %s", index, err.Error())
+			} else if policy == nil || len(policy.Properties) != 1 || len(policy.Constraints) != 1 {
+				t.Errorf("readDestinationPolicy returned an incorrect policy (test %d): %v", index, policy)
+			}
+		} else if err == nil {
+			t.Errorf("readDestinationPolicy accepted an invalid policy (test %d)", index)
+		}
+	}
+
+	common.Configuration.DestinationPolicyFile = file.Name() + "-missing"
+	if _, err := readDestinationPolicy(); err == nil {
+		t.Errorf("readDestinationPolicy didn't fail for a missing file")
+	}
+}
@@ -0,0 +1,202 @@
+package communications
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+	"github.com/open-horizon/edge-utilities/logger/trace"
+)
+
+// The CSS delivers an object with a rollout to its destinations in waves. The first wave is notified when the object
+// becomes ready to be sent, and starts a new rollout state for the object's instance. The following waves are notified
+// by AdvanceRollouts, which is called periodically by the leader. The destinations that weren't notified by a wave
+// are not sent the object by the other flows, e.g., registration of a new ESS, until the rollout completes.
+
+// prepareRolloutNotifications prepares the notifications of an object with a rollout to the destinations the rollout
+// allows to notify. A new instance of the object starts a new rollout by notifying its first wave.
+// This function should not acquire an object lock (common.ObjectLocks) as the caller has already acquired one.
+func prepareRolloutNotifications(metaData common.MetaData, destinations []common.Destination) ([]common.NotificationInfo, common.SyncServiceError) {
+	rollout, err := Store.RetrieveRollout(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if err != nil {
+		return nil, err
+	}
+	if rollout == nil || rollout.InstanceID != metaData.InstanceID {
+		rollout = &common.RolloutStatus{OrgID: metaData.DestOrgID, ObjectType: metaData.ObjectType, ObjectID: metaData.ObjectID,
+			InstanceID: metaData.InstanceID, Status: common.RolloutInProgress}
+		return startRolloutWave(metaData, rollout, destinations)
+	}
+	return PrepareUpdateNotification(metaData, filterRolloutDestinations(rollout, destinations))
+}
+
+// startRolloutWave notifies the next wave of the rollout of an object, and stores the rollout's state.
+// The wave is taken from the destinations that weren't notified, in the order of their types and IDs.
+// This function should not acquire an object lock (common.ObjectLocks) as the caller has already acquired one.
+func startRolloutWave(metaData common.MetaData, rollout *common.RolloutStatus, destinations []common.Destination) ([]common.NotificationInfo,
+	common.SyncServiceError) {
+	notified := make(map[string]bool, len(rollout.Destinations))
+	for _, destination := range rollout.Destinations {
+		notified[destination.DestType+":"+destination.DestID] = true
+	}
+	pending := make([]common.Destination, 0, len(destinations))
+	for _, destination := range destinations {
+		if !notified[destination.DestType+":"+destination.DestID] {
+			pending = append(pending, destination)
+		}
+	}
+	sort.Slice(pending, func(i int, j int) bool {
+		return pending[i].DestType < pending[j].DestType ||
+			(pending[i].DestType == pending[j].DestType && pending[i].DestID < pending[j].DestID)
+	})
+
+	rollout.Wave++
+	size := metaData.Rollout.WaveSize(rollout.Wave, len(destinations))
+	if size >= len(pending) {
+		size = len(pending)
+		rollout.Status = common.RolloutCompleted
+	}
+	wave := pending[:size]
+	for _, destination := range wave {
+		rollout.Destinations = append(rollout.Destinations,
+			common.RolloutDestination{DestType: destination.DestType, DestID: destination.DestID, Wave: rollout.Wave})
+		if _, err := Store.UpdateObjectDeliveryStatus(common.Delivering, "", metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID,
+			destination.DestType, destination.DestID); err != nil && log.IsLogging(logger.ERROR) {
+			log.Error("Failed to update object's delivery status. Error: " + err.Error())
+		}
+	}
+	rollout.WaveStartTime = time.Now()
+	if err := Store.StoreRollout(*rollout); err != nil {
+		return nil, err
+	}
+
+	if trace.IsLogging(logger.DEBUG) {
+		trace.Debug("Started wave %d of the rollout of %s:%s:%s with %d destinations\n", rollout.Wave, metaData.DestOrgID,
+			metaData.ObjectType, metaData.ObjectID, len(wave))
+	}
+	return PrepareUpdateNotification(metaData, wave)
+}
+
+// filterRolloutDestinations returns the destinations the rollout allows to notify: the notified destinations,
+// or all the destinations once the rollout completes
+func filterRolloutDestinations(rollout *common.RolloutStatus, destinations []common.Destination) []common.Destination {
+	if rollout.Status == common.RolloutCompleted {
+		return destinations
+	}
+	notified := make(map[string]bool, len(rollout.Destinations))
+	for _, destination := range rollout.Destinations {
+		notified[destination.DestType+":"+destination.DestID] = true
+	}
+	result := make([]common.Destination, 0, len(destinations))
+	for _, destination := range destinations {
+		if notified[destination.DestType+":"+destination.DestID] {
+			result = append(result, destination)
+		}
+	}
+	return result
+}
+
+// FilterRolloutDestinations returns the destinations of an object that may be notified of its update.
+// If the object has a rollout, these are the destinations the rollout already notified, or all the destinations
+// once the rollout completes.
+// This function should not acquire an object lock (common.ObjectLocks) as the caller has already acquired one.
+func FilterRolloutDestinations(metaData common.MetaData, destinations []common.Destination) ([]common.Destination, common.SyncServiceError) {
+	if metaData.Rollout == nil || common.Configuration.NodeType != common.CSS {
+		return destinations, nil
+	}
+	rollout, err := Store.RetrieveRollout(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if err != nil {
+		return nil, err
+	}
+	if rollout == nil || rollout.InstanceID != metaData.InstanceID {
+		// The rollout of the instance hasn't started
+		return nil, nil
+	}
+	return filterRolloutDestinations(rollout, destinations), nil
+}
+
+// AdvanceRollouts starts the next waves of the rollouts whose current waves succeeded, and pauses the rollouts
+// whose error rates exceed their limits
+func AdvanceRollouts() {
+	rollouts, err := Store.RetrieveRollouts(common.RolloutInProgress)
+	if err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Error in AdvanceRollouts, failed to retrieve rollouts. Error: %s\n", err)
+		}
+		return
+	}
+
+	notificationsInfo := make([]common.NotificationInfo, 0)
+	for _, rollout := range rollouts {
+		lockIndex := common.HashStrings(rollout.OrgID, rollout.ObjectType, rollout.ObjectID)
+		common.ObjectLocks.Lock(lockIndex)
+		rolloutNotificationsInfo, err := advanceRollout(rollout)
+		common.ObjectLocks.Unlock(lockIndex)
+		if err != nil {
+			if log.IsLogging(logger.ERROR) {
+				log.Error("Error in AdvanceRollouts, failed to advance the rollout of %s:%s:%s. Error: %s\n", rollout.OrgID,
+					rollout.ObjectType, rollout.ObjectID, err)
+			}
+			continue
+		}
+		notificationsInfo = append(notificationsInfo, rolloutNotificationsInfo...)
+	}
+
+	if err := SendBatchNotifications(notificationsInfo); err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Error in AdvanceRollouts: %s\n", err)
+	}
+}
+
+// advanceRollout starts the next wave of a rollout if its current wave succeeded, or pauses it if its error rate exceeds its limit
+// This function should not acquire an object lock (common.ObjectLocks) as the caller has already acquired one.
+func advanceRollout(rollout common.RolloutStatus) ([]common.NotificationInfo, common.SyncServiceError) {
+	metaData, status, err := Store.RetrieveObjectAndStatus(rollout.OrgID, rollout.ObjectType, rollout.ObjectID)
+	if err != nil {
+		return nil, err
+	}
+	if metaData == nil || metaData.Deleted || metaData.Rollout == nil || metaData.InstanceID != rollout.InstanceID {
+		// The object was deleted or updated since the rollout started
+		return nil, Store.DeleteRollout(rollout.OrgID, rollout.ObjectType, rollout.ObjectID)
+	}
+	if status != common.ReadyToSend || metaData.Inactive {
+		return nil, nil
+	}
+
+	destinationsList, err := Store.GetObjectDestinationsList(rollout.OrgID, rollout.ObjectType, rollout.ObjectID)
+	if err != nil {
+		return nil, err
+	}
+	progress := rollout.Progress(destinationsList)
+
+	notified := 0
+	errors := 0
+	for _, wave := range progress {
+		if wave.Wave > rollout.ResumedWave {
+			notified += wave.Destinations
+			errors += wave.Errors
+		}
+	}
+	if metaData.Rollout.IsErrorRateExceeded(notified, errors) {
+		rollout.Status = common.RolloutPaused
+		rollout.Message = fmt.Sprintf("%d of the %d notified destinations reported an error", errors, notified)
+		if log.IsLogging(logger.INFO) {
+			log.Info("Paused the rollout of %s:%s:%s: %s", rollout.OrgID, rollout.ObjectType, rollout.ObjectID, rollout.Message)
+		}
+		return nil, Store.StoreRollout(rollout)
+	}
+
+	if len(progress) != 0 {
+		wave := progress[len(progress)-1]
+		if !metaData.Rollout.IsWaveSucceeded(rollout.WaveStartTime, wave.Destinations, wave.Succeeded) {
+			return nil, nil
+		}
+	}
+
+	destinations := make([]common.Destination, 0, len(destinationsList))
+	for _, destination := range destinationsList {
+		destinations = append(destinations, destination.Destination)
+	}
+	return startRolloutWave(*metaData, &rollout, destinations)
+}
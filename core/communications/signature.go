@@ -0,0 +1,103 @@
+package communications
+
+import (
+	"crypto"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/encryption"
+	"github.com/open-horizon/edge-sync-service/core/signature"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+)
+
+// verifyObjectSignature verifies the signature of an object whose data was completely received by the ESS.
+// The signature is of the object's data as provided by the application, i.e., before it was encrypted.
+// The signature is verified only with a trusted key from SigningKeysDir, the public key in the object's meta data
+// is never trusted by itself, it only identifies the trusted key if the object has no signing key ID.
+// Must be called with the object's lock held.
+func verifyObjectSignature(metaData common.MetaData) common.SyncServiceError {
+	if common.Configuration.NodeType != common.ESS || metaData.NoData || metaData.Link != "" {
+		return nil
+	}
+	if metaData.Signature == "" {
+		if common.Configuration.RequireSignedObjects {
+			return &common.SecurityError{Message: "The object is not signed"}
+		}
+		return nil
+	}
+
+	sig, err := signature.DecodeSignature(metaData.Signature)
+	if err != nil {
+		return &common.SecurityError{Message: err.Error()}
+	}
+
+	var publicKey crypto.PublicKey
+	if common.Configuration.SigningKeysDir == "" {
+		return &common.SecurityError{Message: "No trusted keys are configured to verify the signature of the object with"}
+	}
+	if metaData.SigningKeyID != "" {
+		publicKey, err = signature.LoadTrustedKey(common.Configuration.SigningKeysDir, metaData.SigningKeyID)
+	} else if metaData.PublicKey != "" {
+		publicKey, err = signature.FindTrustedKey(common.Configuration.SigningKeysDir, metaData.PublicKey)
+	} else {
+		return &common.SecurityError{Message: "The object is not signed with a trusted key"}
+	}
+	if err != nil {
+		return &common.SecurityError{Message: err.Error()}
+	}
+
+	digest, syncErr := objectDataDigest(metaData)
+	if syncErr != nil {
+		return syncErr
+	}
+	if err := signature.Verify(publicKey, digest, sig); err != nil {
+		return &common.SecurityError{Message: "Failed to verify the signature of the object. Error: " + err.Error()}
+	}
+	return nil
+}
+
+func objectDataDigest(metaData common.MetaData) ([]byte, common.SyncServiceError) {
+	dataReader, closer, err := openObjectData(metaData)
+	if err != nil {
+		if common.IsNotFound(err) {
+			return nil, &common.SecurityError{Message: "The signed object has no data"}
+		}
+		return nil, err
+	}
+
+	decryptedReader, err := encryption.Decrypt(metaData.DestOrgID, metaData.Encrypted, dataReader, closer)
+	if err != nil {
+		closer()
+		return nil, err
+	}
+	defer decryptedReader.Close()
+
+	digest, digestErr := signature.Digest(decryptedReader)
+	if digestErr != nil {
+		return nil, &common.IOError{Message: "Failed to read the object's data. Error: " + digestErr.Error()}
+	}
+	return digest, nil
+}
+
+// verifyReceivedObject verifies the signature of an object whose data was completely received by the ESS,
+// and deletes the object if the verification fails. Must be called with the object's lock held.
+func verifyReceivedObject(metaData common.MetaData) common.SyncServiceError {
+	err := verifyObjectSignature(metaData)
+	if err != nil {
+		deleteObjectInfo(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, metaData.OriginType, metaData.OriginID,
+			&metaData, true)
+	}
+	return err
+}
+
+// rejectObject reports to the object's sender that the object was rejected since it failed the verification.
+// The error is reported here, so the returned error is ignored by the callers of the handlers.
+func rejectObject(metaData common.MetaData, err common.SyncServiceError) common.SyncServiceError {
+	if log.IsLogging(logger.ERROR) {
+		log.Error("Rejected the object %s %s. Error: %s\n", metaData.ObjectType, metaData.ObjectID, err.Error())
+	}
+	if sendErr := Comm.SendErrorMessage(err, &metaData, true); sendErr != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Failed to send error message. Error: %s\n", sendErr)
+	}
+	return &ignoredByHandler{}
+}
@@ -0,0 +1,127 @@
+package communications
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/storage"
+)
+
+func TestSignedObjects(t *testing.T) {
+	common.InitObjectLocks()
+
+	dir, _ := os.Getwd()
+	common.Configuration.PersistenceRootPath = dir + "/persist"
+	common.Configuration.NodeType = common.ESS
+	common.Configuration.StorageProvider = common.Bolt
+	defer func() {
+		common.Configuration.SigningKeysDir = ""
+		common.Configuration.RequireSignedObjects = false
+	}()
+
+	boltStore := &storage.BoltStorage{}
+	boltStore.Cleanup()
+	Store = boltStore
+	if err := Store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+	}
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate a key. Error: %s", err.Error())
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	publicKey := base64.StdEncoding.EncodeToString(der)
+
+	keysDir, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatalf("Failed to create the keys directory. Error: %s", err.Error())
+	}
+	defer os.RemoveAll(keysDir)
+	if err := ioutil.WriteFile(keysDir+"/key1.pem", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600); err != nil {
+		t.Fatalf("Failed to write the key file. Error: %s", err.Error())
+	}
+
+	data := []byte("the data of the signed object")
+	digest := sha256.Sum256(data)
+	sig, _ := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	signature := base64.StdEncoding.EncodeToString(sig)
+	otherDigest := sha256.Sum256([]byte("other data"))
+	otherSig, _ := key.Sign(rand.Reader, otherDigest[:], crypto.SHA256)
+	otherSignature := base64.StdEncoding.EncodeToString(otherSig)
+
+	// A key that isn't trusted
+	untrustedKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	untrustedDER, _ := x509.MarshalPKIXPublicKey(&untrustedKey.PublicKey)
+	untrustedPublicKey := base64.StdEncoding.EncodeToString(untrustedDER)
+	untrustedSig, _ := untrustedKey.Sign(rand.Reader, digest[:], crypto.SHA256)
+	untrustedSignature := base64.StdEncoding.EncodeToString(untrustedSig)
+
+	tests := []struct {
+		signature    string
+		publicKey    string
+		signingKeyID string
+		keysDir      string
+		requireSign  bool
+		accepted     bool
+	}{
+		{signature, publicKey, "", "", false, false},
+		{otherSignature, publicKey, "", keysDir, false, false},
+		{"", "", "", "", false, true},
+		{"", "", "", keysDir, true, false},
+		{signature, "", "", keysDir, false, false},
+		{signature, "", "key1", keysDir, true, true},
+		{signature, publicKey, "", keysDir, false, true},
+		{signature, "", "key2", keysDir, false, false},
+		{untrustedSignature, untrustedPublicKey, "", keysDir, false, false},
+		{untrustedSignature, untrustedPublicKey, "", "", false, false},
+	}
+
+	for i, test := range tests {
+		common.Configuration.SigningKeysDir = test.keysDir
+		common.Configuration.RequireSignedObjects = test.requireSign
+
+		metaData := common.MetaData{ObjectID: "signed" + strconv.Itoa(i), ObjectType: "type1", DestOrgID: "myorg", DestID: "dev1",
+			DestType: "device", OriginID: "123", OriginType: "type2", ObjectSize: int64(len(data)), ChunkSize: 4096,
+			InstanceID: 1, DataID: 1, Signature: test.signature, PublicKey: test.publicKey, SigningKeyID: test.signingKeyID}
+
+		if err := handleUpdate(metaData, 1, nil); err != nil {
+			t.Errorf("handleUpdate failed (test %d). Error: %s", i, err.Error())
+			continue
+		}
+		dataMessage, err := buildDataMessage(metaData, data, len(data), 0, common.NoCompression)
+		if err != nil {
+			t.Errorf("Failed to build data message (test %d). Error: %s", i, err.Error())
+			continue
+		}
+		if _, err := handleData(dataMessage); err != nil && !isIgnoredByHandler(err) {
+			t.Errorf("handleData failed (test %d). Error: %s", i, err.Error())
+		}
+
+		storedMetaData, status, err := Store.RetrieveObjectAndStatus(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+		if err != nil {
+			t.Errorf("Failed to retrieve the object (test %d). Error: %s", i, err.Error())
+		} else if test.accepted && (storedMetaData == nil || status != common.CompletelyReceived) {
+			t.Errorf("The object wasn't accepted (test %d): status %s", i, status)
+		} else if !test.accepted && storedMetaData != nil {
+			t.Errorf("The object wasn't rejected (test %d): status %s", i, status)
+		}
+	}
+}
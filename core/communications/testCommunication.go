@@ -61,6 +61,11 @@ func (communication *TestComm) GetData(metaData common.MetaData, offset int64) c
 	return err
 }
 
+// GetDelta requests a delta of the data of an updated object from the CSS
+func (communication *TestComm) GetDelta(metaData common.MetaData, signature []byte) common.SyncServiceError {
+	return updateGetDataNotification(metaData, metaData.OriginType, metaData.OriginID, 0)
+}
+
 // SendData sends data from the CSS to the ESS or from the ESS to the CSS
 func (communication *TestComm) SendData(orgID string, destType string, destID string, message []byte, chunked bool) common.SyncServiceError {
 	return nil
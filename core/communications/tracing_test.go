@@ -0,0 +1,101 @@
+package communications
+
+import (
+	"os"
+	"testing"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/storage"
+	"github.com/open-horizon/edge-sync-service/core/tracing"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestDeliveryTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+
+	common.InitObjectLocks()
+
+	dir, _ := os.Getwd()
+	common.Configuration.PersistenceRootPath = dir + "/persist"
+	common.Configuration.NodeType = common.ESS
+	common.Configuration.StorageProvider = common.Bolt
+
+	boltStore := &storage.BoltStorage{}
+	boltStore.Cleanup()
+	Store = boltStore
+	if err := Store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+	}
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	data := []byte("the data of the object")
+	metaData := common.MetaData{ObjectID: "traced", ObjectType: "type1", DestOrgID: "myorg",
+		DestID: "dev1", DestType: "device", OriginID: "123", OriginType: "type2", ObjectSize: int64(len(data)),
+		ChunkSize: 4096, InstanceID: 1, DataID: 1}
+
+	// The trace context sent by the origin of the object
+	originSpan := tracing.StartDeliverySpan("UpdateObject", "origin", metaData.ObjectType, metaData.ObjectID, nil)
+	originSpan.End(nil)
+	traceContext := tracing.GetTraceContext("origin", metaData.ObjectType, metaData.ObjectID)
+
+	if err := handleUpdate(metaData, 1, traceContext); err != nil {
+		t.Fatalf("handleUpdate failed. Error: %s", err.Error())
+	}
+	message, _ := buildDataMessage(metaData, data, len(data), 0, common.NoCompression)
+	if _, err := handleData(message); err != nil {
+		t.Fatalf("handleData failed. Error: %s", err.Error())
+	}
+	checkObjectStatus(metaData, common.CompletelyReceived, t)
+
+	spans := exporter.GetSpans()
+	spansByName := make(map[string]tracetest.SpanStub)
+	for _, span := range spans {
+		if span.SpanContext.TraceID() != spans[0].SpanContext.TraceID() {
+			t.Errorf("The span %s doesn't belong to the trace of the delivery", span.Name)
+		}
+		spansByName[span.Name] = span
+	}
+	for _, name := range []string{"UpdateObject", "handleUpdate", "handleData", "SendNotifications"} {
+		if _, ok := spansByName[name]; !ok {
+			t.Errorf("No %s span", name)
+		}
+	}
+	if spansByName["handleUpdate"].Parent.SpanID() != spansByName["UpdateObject"].SpanContext.SpanID() {
+		t.Errorf("The parent of the handleUpdate span isn't the span of the origin")
+	}
+	if spansByName["handleData"].Parent.SpanID() != spansByName["handleUpdate"].SpanContext.SpanID() {
+		t.Errorf("The parent of the handleData span isn't the handleUpdate span")
+	}
+
+	// The notifications of each object are traced in a span of the object
+	exporter.Reset()
+	notifications := []common.NotificationInfo{}
+	for _, objectID := range []string{"traced1", "traced2", "traced1"} {
+		objectMetaData := metaData
+		objectMetaData.ObjectID = objectID
+		notifications = append(notifications, common.NotificationInfo{NotificationTopic: common.Update, DestType: "device",
+			DestID: "dev1", InstanceID: 1, DataID: 1, MetaData: &objectMetaData})
+	}
+	if err := SendNotifications(notifications); err != nil {
+		t.Errorf("SendNotifications failed. Error: %s", err.Error())
+	}
+	objectIDs := make(map[string]int)
+	for _, span := range exporter.GetSpans() {
+		for _, attr := range span.Attributes {
+			if span.Name == "SendNotifications" && attr.Key == "sync.object_id" {
+				objectIDs[attr.Value.AsString()]++
+			}
+		}
+	}
+	if len(objectIDs) != 2 || objectIDs["traced1"] != 1 || objectIDs["traced2"] != 1 {
+		t.Errorf("Expected one SendNotifications span of each object, found %v", objectIDs)
+	}
+}
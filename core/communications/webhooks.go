@@ -0,0 +1,246 @@
+package communications
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/leader"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+	"github.com/open-horizon/edge-utilities/logger/trace"
+)
+
+// The events of objects are posted to the webhooks registered for the objects' type and subscribed to the events.
+// The meta data of the object is posted for the updated event, and a common.WebhookEvent for the other events.
+// Each post is stored as a delivery before it is attempted, so that it survives a restart of the node.
+// A failed delivery is retried with an exponential backoff until it succeeds or the maximal number of
+// attempts is reached. A delivery that reaches the maximal number of attempts is kept in the failed status
+// (dead letter) until the webhook is deleted.
+
+const (
+	// WebhookSignatureHeader is the header of the signature of the posted payload, sent to webhooks with a secret.
+	// Its value is sha256= followed by the hex encoded HMAC-SHA256 of the request's body, computed with the secret.
+	WebhookSignatureHeader = "X-Sync-Service-Signature"
+
+	// WebhookDeliveryHeader is the header of the ID of the delivery, which is the same in all the attempts of a delivery
+	WebhookDeliveryHeader = "X-Sync-Service-Delivery"
+
+	// WebhookEventHeader is the header of the posted event
+	WebhookEventHeader = "X-Sync-Service-Event"
+)
+
+const (
+	webhookTimeout          = 10 * time.Second
+	maxWebhookRetryInterval = time.Hour
+)
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// The deliveries being attempted, a delivery isn't retried while its previous attempt is in progress
+var webhookDeliveriesInProgress = make(map[string]bool)
+var webhookDeliveriesLock sync.Mutex
+
+// SignWebhookPayload returns the hex encoded HMAC-SHA256 of the payload posted to a webhook, computed with the webhook's secret
+func SignWebhookPayload(payload []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// RetryWebhookDeliveries retries the pending deliveries to webhooks whose time of the next attempt has come
+func RetryWebhookDeliveries() {
+	if !leader.CheckIfLeader() {
+		return
+	}
+	deliveries, err := Store.RetrieveWebhookDeliveries("", common.WebhookDeliveryPending)
+	if err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Error in RetryWebhookDeliveries, failed to retrieve the deliveries: %s\n", err)
+		}
+		return
+	}
+	currentTime := time.Now().Unix()
+	for _, delivery := range deliveries {
+		if delivery.NextAttemptTime <= currentTime {
+			attemptWebhookDelivery(delivery)
+		}
+	}
+}
+
+// DeleteWebhookDeliveries deletes the deliveries to a webhook, to be called when the webhook is deleted
+func DeleteWebhookDeliveries(orgID string, objectType string, url string) common.SyncServiceError {
+	deliveries, err := Store.RetrieveWebhookDeliveries(orgID, "")
+	if err != nil {
+		return err
+	}
+	for _, delivery := range deliveries {
+		if delivery.ObjectType == objectType && strings.EqualFold(delivery.URL, url) {
+			if err := Store.DeleteWebhookDelivery(delivery.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func callWebhooks(metaData *common.MetaData) {
+	publishObjectUpdate(metaData)
+
+	deliverToWebhooks(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, common.WebhookEventUpdated,
+		func() ([]byte, error) { return json.MarshalIndent(metaData, "", "  ") }, false)
+}
+
+// callWebhooksForEvent posts an event of an object to the webhooks subscribed to it.
+// The handlers of notifications call it while holding the object's lock, hence the first attempts are made in the background.
+func callWebhooksForEvent(event common.WebhookEvent) {
+	event.Timestamp = time.Now().Unix()
+	deliverToWebhooks(event.OrgID, event.ObjectType, event.ObjectID, event.Event,
+		func() ([]byte, error) { return json.MarshalIndent(event, "", "  ") }, true)
+}
+
+func deliverToWebhooks(orgID string, objectType string, objectID string, event string,
+	buildPayload func() ([]byte, error), background bool) {
+	webhooks, err := Store.RetrieveWebhooks(orgID, objectType)
+	if err != nil {
+		return
+	}
+	var body []byte
+	currentTime := time.Now().Unix()
+	for _, webhook := range webhooks {
+		if !webhook.SubscribedTo(event) {
+			continue
+		}
+		if body == nil {
+			if body, err = buildPayload(); err != nil {
+				if log.IsLogging(logger.ERROR) {
+					log.Error("Error in deliverToWebhooks, failed to marshal the %s event: %s\n", event, err)
+				}
+				return
+			}
+		}
+		delivery := common.WebhookDelivery{ID: uuid.New().String(), OrgID: orgID, ObjectType: objectType,
+			ObjectID: objectID, URL: webhook.URL, Event: event, Payload: body,
+			Status: common.WebhookDeliveryPending, CreationTime: currentTime,
+			NextAttemptTime: currentTime + int64(common.Configuration.WebhookRetryInterval)}
+		if webhook.Secret != "" {
+			delivery.Signature = SignWebhookPayload(body, webhook.Secret)
+		}
+		if err := Store.StoreWebhookDelivery(delivery); err != nil && log.IsLogging(logger.ERROR) {
+			log.Error("Error in deliverToWebhooks, failed to store the delivery to %s: %s\n", webhook.URL, err)
+		}
+		if background {
+			go attemptWebhookDelivery(delivery)
+		} else {
+			attemptWebhookDelivery(delivery)
+		}
+	}
+}
+
+// completesDelivery returns true if the delivery of an object to all its destinations is completed when the object
+// is delivered to or consumed by the given destination. dests are the object's destinations before the update.
+func completesDelivery(dests []common.StoreDestinationStatus, destType string, destID string) bool {
+	found := false
+	for _, dest := range dests {
+		completed := dest.Status == common.Delivered || dest.Status == common.Consumed
+		if dest.Destination.DestType == destType && dest.Destination.DestID == destID {
+			if completed {
+				// The delivery to this destination was already completed
+				return false
+			}
+			found = true
+		} else if !completed {
+			return false
+		}
+	}
+	return found
+}
+
+func attemptWebhookDelivery(delivery common.WebhookDelivery) {
+	webhookDeliveriesLock.Lock()
+	if webhookDeliveriesInProgress[delivery.ID] {
+		webhookDeliveriesLock.Unlock()
+		return
+	}
+	webhookDeliveriesInProgress[delivery.ID] = true
+	webhookDeliveriesLock.Unlock()
+	defer func() {
+		webhookDeliveriesLock.Lock()
+		delete(webhookDeliveriesInProgress, delivery.ID)
+		webhookDeliveriesLock.Unlock()
+	}()
+
+	err := postToWebhook(delivery)
+	if err == nil {
+		if err := Store.DeleteWebhookDelivery(delivery.ID); err != nil && log.IsLogging(logger.ERROR) {
+			log.Error("Error in attemptWebhookDelivery, failed to delete the delivery %s: %s\n", delivery.ID, err)
+		}
+		return
+	}
+
+	delivery.Attempts++
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= common.Configuration.WebhookMaxAttempts {
+		delivery.Status = common.WebhookDeliveryFailed
+		delivery.NextAttemptTime = 0
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Failed to deliver the %s event of %s:%s:%s to %s after %d attempts: %s\n", delivery.Event, delivery.OrgID,
+				delivery.ObjectType, delivery.ObjectID, delivery.URL, delivery.Attempts, err)
+		}
+	} else {
+		delivery.NextAttemptTime = time.Now().Add(webhookRetryInterval(delivery.Attempts)).Unix()
+		if trace.IsLogging(logger.DEBUG) {
+			trace.Debug("Failed to deliver the %s event of %s:%s:%s to %s, attempt %d: %s\n", delivery.Event, delivery.OrgID,
+				delivery.ObjectType, delivery.ObjectID, delivery.URL, delivery.Attempts, err)
+		}
+	}
+	if err := Store.StoreWebhookDelivery(delivery); err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Error in attemptWebhookDelivery, failed to store the delivery %s: %s\n", delivery.ID, err)
+	}
+}
+
+func postToWebhook(delivery common.WebhookDelivery) error {
+	request, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	request.ContentLength = int64(len(delivery.Payload))
+	request.Header.Add("Content-Type", "Application/JSON")
+	request.Header.Add(WebhookDeliveryHeader, delivery.ID)
+	request.Header.Add(WebhookEventHeader, delivery.Event)
+	if delivery.Signature != "" {
+		request.Header.Add(WebhookSignatureHeader, "sha256="+delivery.Signature)
+	}
+	response, err := webhookClient.Do(request)
+	if err != nil {
+		return err
+	}
+	if err := response.Body.Close(); err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Error in postToWebhook, failed to close response body")
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return &Error{fmt.Sprintf("Received status: %d", response.StatusCode)}
+	}
+	return nil
+}
+
+// webhookRetryInterval returns the time to wait after the given number of failed attempts of a delivery
+func webhookRetryInterval(attempts int) time.Duration {
+	interval := time.Duration(common.Configuration.WebhookRetryInterval) * time.Second
+	for i := 1; i < attempts && interval < maxWebhookRetryInterval; i++ {
+		interval *= 2
+	}
+	if interval > maxWebhookRetryInterval {
+		interval = maxWebhookRetryInterval
+	}
+	return interval
+}
@@ -0,0 +1,255 @@
+package communications
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/storage"
+)
+
+func TestWebhookDeliveries(t *testing.T) {
+	dir, _ := os.Getwd()
+	common.Configuration.PersistenceRootPath = dir + "/persist"
+	common.Configuration.NodeType = common.ESS
+	common.Configuration.WebhookMaxAttempts = 3
+	common.Configuration.WebhookRetryInterval = 1
+	defer func() {
+		common.Configuration.WebhookMaxAttempts = 10
+		common.Configuration.WebhookRetryInterval = 10
+	}()
+
+	boltStore := &storage.BoltStorage{}
+	boltStore.Cleanup()
+	Store = boltStore
+	if err := Store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+	}
+	defer Store.Stop()
+
+	var lock sync.Mutex
+	fail := true
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		requests++
+		body, _ := ioutil.ReadAll(request.Body)
+		if request.Header.Get(WebhookSignatureHeader) != "sha256="+SignWebhookPayload(body, "secret") {
+			t.Errorf("Wrong signature header: %s", request.Header.Get(WebhookSignatureHeader))
+		}
+		if request.Header.Get(WebhookDeliveryHeader) == "" {
+			t.Errorf("No delivery header")
+		}
+		if fail {
+			writer.WriteHeader(http.StatusInternalServerError)
+		} else {
+			writer.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	if err := Store.AddWebhook("myorg", "webhooks", common.Webhook{URL: server.URL, Secret: "secret"}); err != nil {
+		t.Fatalf("Failed to add webhook. Error: %s", err.Error())
+	}
+
+	// The first attempt fails, and the delivery is kept
+	callWebhooks(&common.MetaData{ObjectID: "1", ObjectType: "webhooks", DestOrgID: "myorg"})
+	delivery := checkWebhookDelivery(common.WebhookDeliveryPending, 1, t)
+	if delivery.NextAttemptTime <= time.Now().Unix() || delivery.LastError == "" {
+		t.Errorf("Wrong next attempt time or error of a failed delivery: %#v", delivery)
+	}
+
+	// Deliveries aren't retried before their next attempt time
+	RetryWebhookDeliveries()
+	checkWebhookDelivery(common.WebhookDeliveryPending, 1, t)
+
+	// The delivery is retried until it reaches the maximal number of attempts
+	for attempts := 2; attempts <= common.Configuration.WebhookMaxAttempts; attempts++ {
+		delivery.NextAttemptTime = 0
+		Store.StoreWebhookDelivery(*delivery)
+		RetryWebhookDeliveries()
+		delivery = checkWebhookDelivery(common.WebhookDeliveryPending, attempts, t)
+		if delivery == nil {
+			return
+		}
+	}
+	if delivery.Status != common.WebhookDeliveryFailed {
+		t.Errorf("The delivery wasn't marked as failed after %d attempts", delivery.Attempts)
+	}
+
+	// Failed deliveries aren't retried
+	delivery.NextAttemptTime = 0
+	Store.StoreWebhookDelivery(*delivery)
+	RetryWebhookDeliveries()
+	lock.Lock()
+	if requests != common.Configuration.WebhookMaxAttempts {
+		t.Errorf("The webhook received %d requests instead of %d", requests, common.Configuration.WebhookMaxAttempts)
+	}
+	fail = false
+	lock.Unlock()
+
+	// A successful delivery isn't kept
+	callWebhooks(&common.MetaData{ObjectID: "2", ObjectType: "webhooks", DestOrgID: "myorg"})
+	if deliveries, _ := Store.RetrieveWebhookDeliveries("myorg", common.WebhookDeliveryPending); len(deliveries) != 0 {
+		t.Errorf("A successful delivery was kept")
+	}
+
+	if err := DeleteWebhookDeliveries("myorg", "webhooks", server.URL); err != nil {
+		t.Errorf("Failed to delete the webhook deliveries. Error: %s", err.Error())
+	}
+	if deliveries, _ := Store.RetrieveWebhookDeliveries("myorg", ""); len(deliveries) != 0 {
+		t.Errorf("The deliveries weren't deleted with the webhook")
+	}
+}
+
+func TestWebhookEvents(t *testing.T) {
+	common.InitObjectLocks()
+
+	dir, _ := os.Getwd()
+	common.Configuration.PersistenceRootPath = dir + "/persist"
+	common.Configuration.NodeType = common.CSS
+	common.Configuration.StorageProvider = common.Bolt
+
+	boltStore := &storage.BoltStorage{}
+	boltStore.Cleanup()
+	Store = boltStore
+	if err := Store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+	}
+	defer Store.Stop()
+
+	Comm = &TestComm{}
+	if err := Comm.StartCommunication(); err != nil {
+		t.Errorf("Failed to start communication. Error: %s", err.Error())
+	}
+
+	events := make(chan common.WebhookEvent, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		var event common.WebhookEvent
+		body, _ := ioutil.ReadAll(request.Body)
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Errorf("Failed to unmarshal the posted event. Error: %s", err.Error())
+		}
+		if request.Header.Get(WebhookEventHeader) != event.Event {
+			t.Errorf("The event header is %s instead of %s", request.Header.Get(WebhookEventHeader), event.Event)
+		}
+		writer.WriteHeader(http.StatusNoContent)
+		events <- event
+	}))
+	defer server.Close()
+
+	webhook := common.Webhook{URL: server.URL, Events: []string{common.WebhookEventDelivered, common.WebhookEventConsumed,
+		common.WebhookEventCompleted}}
+	if err := Store.AddWebhook("myorg", "events", webhook); err != nil {
+		t.Fatalf("Failed to add webhook. Error: %s", err.Error())
+	}
+
+	destIDs := []string{"dev1", "dev2"}
+	for _, destID := range destIDs {
+		if err := Store.StoreDestination(common.Destination{DestOrgID: "myorg", DestType: "device", DestID: destID,
+			Communication: common.MQTTProtocol}); err != nil {
+			t.Fatalf("Failed to store destination. Error: %s", err.Error())
+		}
+	}
+	metaData := common.MetaData{ObjectID: "1", ObjectType: "events", DestOrgID: "myorg", DestType: "device", NoData: true}
+	if _, err := Store.StoreObject(metaData, nil, common.ReadyToSend); err != nil {
+		t.Fatalf("Failed to store object. Error: %s", err.Error())
+	}
+	storedMetaData, err := Store.RetrieveObject("myorg", "events", "1")
+	if err != nil || storedMetaData == nil {
+		t.Fatalf("Failed to retrieve object")
+	}
+	instanceID := storedMetaData.InstanceID
+	for _, destID := range destIDs {
+		if err := Store.UpdateNotificationRecord(common.Notification{ObjectID: "1", ObjectType: "events", DestOrgID: "myorg",
+			DestType: "device", DestID: destID, Status: common.Updated, InstanceID: instanceID}); err != nil {
+			t.Fatalf("Failed to store notification record. Error: %s", err.Error())
+		}
+	}
+
+	// The delivery is completed when the object is delivered to the last destination
+	if err := handleObjectReceived("myorg", "events", "1", "device", "dev1", instanceID, 0); err != nil {
+		t.Errorf("handleObjectReceived failed. Error: %s", err.Error())
+	}
+	checkWebhookEvents(events, map[string]int{common.WebhookEventDelivered: 1}, t)
+	if err := handleObjectReceived("myorg", "events", "1", "device", "dev2", instanceID, 0); err != nil {
+		t.Errorf("handleObjectReceived failed. Error: %s", err.Error())
+	}
+	checkWebhookEvents(events, map[string]int{common.WebhookEventDelivered: 1, common.WebhookEventCompleted: 1}, t)
+
+	// Consuming a delivered object doesn't complete its delivery again
+	if err := handleObjectConsumed("myorg", "events", "1", "device", "dev1", instanceID, 0); err != nil {
+		t.Errorf("handleObjectConsumed failed. Error: %s", err.Error())
+	}
+	checkWebhookEvents(events, map[string]int{common.WebhookEventConsumed: 1}, t)
+}
+
+func TestWebhookRetryInterval(t *testing.T) {
+	common.Configuration.WebhookRetryInterval = 10
+	expected := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, 80 * time.Second}
+	for i, interval := range expected {
+		if webhookRetryInterval(i+1) != interval {
+			t.Errorf("The retry interval after %d attempts is %s instead of %s", i+1, webhookRetryInterval(i+1), interval)
+		}
+	}
+	if webhookRetryInterval(100) != maxWebhookRetryInterval {
+		t.Errorf("The retry interval isn't limited: %s", webhookRetryInterval(100))
+	}
+}
+
+func checkWebhookDelivery(status string, attempts int, t *testing.T) *common.WebhookDelivery {
+	deliveries, err := Store.RetrieveWebhookDeliveries("myorg", "")
+	if err != nil {
+		t.Errorf("Failed to retrieve the webhook deliveries. Error: %s", err.Error())
+		return nil
+	}
+	if len(deliveries) != 1 {
+		t.Errorf("Retrieved %d webhook deliveries instead of 1", len(deliveries))
+		return nil
+	}
+	if attempts == common.Configuration.WebhookMaxAttempts {
+		status = common.WebhookDeliveryFailed
+	}
+	if deliveries[0].Status != status || deliveries[0].Attempts != attempts {
+		t.Errorf("The delivery has the status %s after %d attempts instead of %s after %d attempts", deliveries[0].Status,
+			deliveries[0].Attempts, status, attempts)
+	}
+	return &deliveries[0]
+}
+
+func checkWebhookEvents(events chan common.WebhookEvent, expected map[string]int, t *testing.T) {
+	count := 0
+	for _, n := range expected {
+		count += n
+	}
+	received := make(map[string]int)
+	for i := 0; i < count; i++ {
+		select {
+		case event := <-events:
+			if event.ObjectID != "1" || event.Timestamp == 0 {
+				t.Errorf("Wrong event posted: %#v", event)
+			}
+			received[event.Event]++
+		case <-time.After(5 * time.Second):
+			t.Errorf("Timed out waiting for webhook events, received %v instead of %v", received, expected)
+			return
+		}
+	}
+	select {
+	case event := <-events:
+		t.Errorf("Unexpected %s event posted", event.Event)
+	case <-time.After(100 * time.Millisecond):
+	}
+	for event, n := range expected {
+		if received[event] != n {
+			t.Errorf("Received %d %s events instead of %d", received[event], event, n)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+// The data of objects is compressed chunk by chunk, each data message carries a complete compressed stream.
+
+// Error is the error used in the compression package
+type Error struct {
+	message string
+}
+
+func (e *Error) Error() string {
+	return e.message
+}
+
+// The zstd encoder is safe for concurrent use of EncodeAll
+var zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+
+// Supported returns the compressions that can be decompressed by this node
+func Supported() []string {
+	return []string{common.GzipCompression, common.ZstdCompression}
+}
+
+// Select returns the configured compression of the data of the object if it is supported by the receiving side,
+// and common.NoCompression otherwise
+func Select(orgID string, objectType string, accepted []string) string {
+	compression := common.GetDataCompression(orgID, objectType)
+	if compression == common.NoCompression {
+		return compression
+	}
+	for _, name := range accepted {
+		if name == compression {
+			return compression
+		}
+	}
+	return common.NoCompression
+}
+
+// Compress compresses the data. It returns false if the compressed data isn't smaller than the data,
+// in which case the data should be sent uncompressed.
+func Compress(compression string, data []byte) ([]byte, bool, error) {
+	if compression == common.NoCompression || len(data) == 0 {
+		return data, false, nil
+	}
+
+	var compressed []byte
+	switch compression {
+	case common.GzipCompression:
+		buffer := new(bytes.Buffer)
+		writer := gzip.NewWriter(buffer)
+		if _, err := writer.Write(data); err != nil {
+			return nil, false, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, false, err
+		}
+		compressed = buffer.Bytes()
+	case common.ZstdCompression:
+		compressed = zstdEncoder.EncodeAll(data, nil)
+	default:
+		return nil, false, &Error{"Unsupported compression " + compression}
+	}
+
+	if len(compressed) >= len(data) {
+		return data, false, nil
+	}
+	return compressed, true, nil
+}
+
+// Decompress decompresses the data. It fails if the decompressed data is larger than maxSize.
+func Decompress(compression string, reader io.Reader, maxSize int64) ([]byte, error) {
+	var decompressedReader io.Reader
+	switch compression {
+	case common.NoCompression:
+		decompressedReader = reader
+	case common.GzipCompression:
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, &Error{"Failed to decompress data. Error: " + err.Error()}
+		}
+		defer gzipReader.Close()
+		decompressedReader = gzipReader
+	case common.ZstdCompression:
+		// The frames are decoded in memory, limiting the size of the decoded data
+		compressed, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return nil, &Error{"Failed to read compressed data. Error: " + err.Error()}
+		}
+		// The window of small frames may be larger than their content, so the memory limit isn't set below 1MB
+		maxMemory := uint64(maxSize) + 1
+		if maxMemory < 1024*1024 {
+			maxMemory = 1024 * 1024
+		}
+		decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(maxMemory))
+		if err != nil {
+			return nil, &Error{"Failed to decompress data. Error: " + err.Error()}
+		}
+		defer decoder.Close()
+		data, err := decoder.DecodeAll(compressed, nil)
+		if err != nil {
+			return nil, &Error{"Failed to decompress data. Error: " + err.Error()}
+		}
+		decompressedReader = bytes.NewReader(data)
+	default:
+		return nil, &Error{"Unsupported compression " + compression}
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(decompressedReader, maxSize+1))
+	if err != nil {
+		return nil, &Error{"Failed to decompress data. Error: " + err.Error()}
+	}
+	if int64(len(data)) > maxSize {
+		return nil, &Error{"The decompressed data is too large"}
+	}
+	return data, nil
+}
+
+// NewCompressingReader returns a reader of the compressed data of the reader, as a single compressed stream.
+// The reader is returned as is if the compression is common.NoCompression.
+func NewCompressingReader(compression string, reader io.Reader) (io.Reader, error) {
+	if compression == common.NoCompression {
+		return reader, nil
+	}
+	compressingReader := &compressingReader{source: reader, chunk: make([]byte, 32*1024)}
+	switch compression {
+	case common.GzipCompression:
+		compressingReader.writer = gzip.NewWriter(&compressingReader.buffer)
+	case common.ZstdCompression:
+		// With a concurrency of 1 the data is compressed synchronously when it is written
+		writer, err := zstd.NewWriter(&compressingReader.buffer, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, &Error{"Failed to compress data. Error: " + err.Error()}
+		}
+		compressingReader.writer = writer
+	default:
+		return nil, &Error{"Unsupported compression " + compression}
+	}
+	return compressingReader, nil
+}
+
+// NewDecompressingReader returns a reader of the decompressed data of the reader.
+// The returned reader should be closed to release the resources of the decompression.
+func NewDecompressingReader(compression string, reader io.Reader) (io.ReadCloser, error) {
+	switch compression {
+	case common.NoCompression:
+		return ioutil.NopCloser(reader), nil
+	case common.GzipCompression:
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, &Error{"Failed to decompress data. Error: " + err.Error()}
+		}
+		return gzipReader, nil
+	case common.ZstdCompression:
+		decoder, err := zstd.NewReader(reader, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, &Error{"Failed to decompress data. Error: " + err.Error()}
+		}
+		return decoder.IOReadCloser(), nil
+	default:
+		return nil, &Error{"Unsupported compression " + compression}
+	}
+}
+
+// compressingReader compresses the data of its source as it is read, without a goroutine,
+// so nothing is left behind if the reader isn't read to its end
+type compressingReader struct {
+	source io.Reader
+	writer io.WriteCloser
+	buffer bytes.Buffer
+	chunk  []byte
+	done   bool
+}
+
+func (reader *compressingReader) Read(p []byte) (int, error) {
+	for reader.buffer.Len() == 0 {
+		if reader.done {
+			return 0, io.EOF
+		}
+		n, err := reader.source.Read(reader.chunk)
+		if n > 0 {
+			if _, writeErr := reader.writer.Write(reader.chunk[:n]); writeErr != nil {
+				return 0, writeErr
+			}
+		}
+		if err == io.EOF {
+			if closeErr := reader.writer.Close(); closeErr != nil {
+				return 0, closeErr
+			}
+			reader.done = true
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	return reader.buffer.Read(p)
+}
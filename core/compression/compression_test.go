@@ -0,0 +1,92 @@
+package compression
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+func TestCompression(t *testing.T) {
+	data := []byte(strings.Repeat(`{"name": "config", "value": 12345}`, 100))
+
+	for _, compression := range Supported() {
+		compressed, ok, err := Compress(compression, data)
+		if err != nil {
+			t.Errorf("Failed to compress data (%s). Error: %s", compression, err.Error())
+			continue
+		}
+		if !ok || len(compressed) >= len(data) {
+			t.Errorf("The data wasn't compressed (%s)", compression)
+			continue
+		}
+
+		decompressed, err := Decompress(compression, bytes.NewReader(compressed), int64(len(data)))
+		if err != nil {
+			t.Errorf("Failed to decompress data (%s). Error: %s", compression, err.Error())
+		} else if !bytes.Equal(decompressed, data) {
+			t.Errorf("The decompressed data doesn't match the data (%s)", compression)
+		}
+
+		if _, err := Decompress(compression, bytes.NewReader(compressed), int64(len(data)-1)); err == nil {
+			t.Errorf("Decompressed data larger than the maximal size (%s)", compression)
+		}
+		if _, err := Decompress(compression, bytes.NewReader(data), int64(len(data))); err == nil {
+			t.Errorf("Decompressed data that isn't compressed (%s)", compression)
+		}
+
+		// Data that doesn't compress is sent uncompressed
+		if result, ok, err := Compress(compression, []byte("a")); err != nil || ok || !bytes.Equal(result, []byte("a")) {
+			t.Errorf("Data that doesn't compress was compressed (%s). Error: %v", compression, err)
+		}
+	}
+
+	if _, _, err := Compress("lzw", data); err == nil {
+		t.Errorf("Compressed data with an unsupported compression")
+	}
+}
+
+func TestSelect(t *testing.T) {
+	defer func(config common.Config) { common.Configuration = config }(common.Configuration)
+
+	common.Configuration.NodeType = common.CSS
+	common.Configuration.DestinationType = "cloud"
+	common.Configuration.DestinationID = "cloud"
+	common.Configuration.DataCompression = common.GzipCompression
+	common.Configuration.DataCompressionByOrg = "myorg1:zstd, myorg2:none"
+	common.Configuration.DataCompressionByObjectType = "model:zstd,video:none"
+	if err := common.ValidateConfig(); err != nil {
+		t.Fatalf("Failed to validate the configuration. Error: %s", err.Error())
+	}
+	defer func() {
+		common.Configuration.DataCompressionByOrg = ""
+		common.Configuration.DataCompressionByObjectType = ""
+		common.ValidateConfig()
+	}()
+
+	tests := []struct {
+		orgID       string
+		objectType  string
+		accepted    []string
+		compression string
+	}{
+		{"myorg", "type1", Supported(), common.GzipCompression},
+		{"myorg1", "type1", Supported(), common.ZstdCompression},
+		{"myorg2", "type1", Supported(), common.NoCompression},
+		{"myorg2", "model", Supported(), common.ZstdCompression},
+		{"myorg1", "video", Supported(), common.NoCompression},
+		{"myorg", "type1", nil, common.NoCompression},
+		{"myorg1", "type1", []string{common.GzipCompression}, common.NoCompression},
+	}
+	for _, test := range tests {
+		if compression := Select(test.orgID, test.objectType, test.accepted); compression != test.compression {
+			t.Errorf("Wrong compression for %s %s: %s instead of %s", test.orgID, test.objectType, compression, test.compression)
+		}
+	}
+
+	common.Configuration.DataCompressionByObjectType = "model:lzw"
+	if err := common.ValidateConfig(); err == nil {
+		t.Errorf("ValidateConfig didn't fail for an invalid compression")
+	}
+}
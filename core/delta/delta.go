@@ -0,0 +1,421 @@
+package delta
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// The package computes binary deltas the way rsync does:
+// the receiver of an object computes a signature of the version of the data it already has, i.e., a weak rolling
+// checksum and a strong hash of each block of the data.
+// The sender scans its version of the data looking for blocks that match the signature, and creates a delta
+// made of references to the receiver's blocks and of literal data that was not found in the receiver's version.
+
+const (
+	formatVersion = byte(1)
+	minBlockSize  = 4096
+	maxBlocks     = 8192
+	strongSize    = 16
+	hashSize      = sha256.Size
+
+	copyOperation    = byte('C')
+	literalOperation = byte('L')
+
+	signatureHeaderSize = 1 + 4 + 8
+	signatureBlockSize  = 4 + strongSize
+	deltaHeaderSize     = 1 + 4 + 8 + 8 + hashSize
+	maxLiteralSize      = 64 * 1024
+)
+
+// Error is the error used in the delta package
+type Error struct {
+	message string
+}
+
+func (e *Error) Error() string {
+	return e.message
+}
+
+// TooLarge is the error returned when the delta is larger than the maximal size
+type TooLarge struct {
+	maxSize int
+}
+
+func (e *TooLarge) Error() string {
+	return fmt.Sprintf("The delta is larger than %d bytes", e.maxSize)
+}
+
+// IsTooLarge returns true if the error is a TooLarge error
+func IsTooLarge(err error) bool {
+	_, ok := err.(*TooLarge)
+	return ok
+}
+
+// Signature holds the checksums of the blocks of the base version of the data
+type Signature struct {
+	blockSize int
+	size      int64
+	weak      []uint32
+	strong    [][strongSize]byte
+}
+
+// Size returns the size of the data the signature was computed for
+func (signature *Signature) Size() int64 {
+	return signature.size
+}
+
+// ComputeSignature computes the signature of the data read from the reader.
+// The size is the expected size of the data, it is used to choose the size of the blocks.
+func ComputeSignature(reader io.Reader, size int64) (*Signature, error) {
+	blockSize := minBlockSize
+	for size/int64(blockSize) >= maxBlocks {
+		blockSize *= 2
+	}
+
+	signature := &Signature{blockSize: blockSize}
+	block := make([]byte, blockSize)
+	for {
+		n, err := io.ReadFull(reader, block)
+		if n > 0 {
+			signature.weak = append(signature.weak, weakChecksum(block[:n]))
+			signature.strong = append(signature.strong, strongHash(block[:n]))
+			signature.size += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, &Error{"Failed to read the data to compute its signature. Error: " + err.Error()}
+		}
+	}
+	return signature, nil
+}
+
+// Encode returns the binary encoding of the signature
+func (signature *Signature) Encode() []byte {
+	data := make([]byte, signatureHeaderSize+len(signature.weak)*signatureBlockSize)
+	data[0] = formatVersion
+	binary.BigEndian.PutUint32(data[1:], uint32(signature.blockSize))
+	binary.BigEndian.PutUint64(data[5:], uint64(signature.size))
+	position := signatureHeaderSize
+	for i, weak := range signature.weak {
+		binary.BigEndian.PutUint32(data[position:], weak)
+		copy(data[position+4:], signature.strong[i][:])
+		position += signatureBlockSize
+	}
+	return data
+}
+
+// DecodeSignature parses the binary encoding of a signature
+func DecodeSignature(data []byte) (*Signature, error) {
+	if len(data) < signatureHeaderSize || data[0] != formatVersion {
+		return nil, &Error{"Invalid signature"}
+	}
+	signature := &Signature{blockSize: int(binary.BigEndian.Uint32(data[1:])), size: int64(binary.BigEndian.Uint64(data[5:]))}
+	if signature.blockSize < minBlockSize || signature.size < 0 {
+		return nil, &Error{"Invalid signature"}
+	}
+	blocks := (len(data) - signatureHeaderSize) / signatureBlockSize
+	if (len(data)-signatureHeaderSize)%signatureBlockSize != 0 ||
+		int64(blocks) != (signature.size+int64(signature.blockSize)-1)/int64(signature.blockSize) {
+		return nil, &Error{"Invalid signature: the number of blocks doesn't match the size of the data"}
+	}
+	signature.weak = make([]uint32, blocks)
+	signature.strong = make([][strongSize]byte, blocks)
+	position := signatureHeaderSize
+	for i := 0; i < blocks; i++ {
+		signature.weak[i] = binary.BigEndian.Uint32(data[position:])
+		copy(signature.strong[i][:], data[position+4:position+signatureBlockSize])
+		position += signatureBlockSize
+	}
+	return signature, nil
+}
+
+// ComputeDelta computes the delta between the version of the data described by the signature and the data read
+// from the reader. A TooLarge error is returned if the size of the delta exceeds maxSize.
+func ComputeDelta(signature *Signature, reader io.Reader, maxSize int) ([]byte, error) {
+	builder := newDeltaBuilder(signature, maxSize)
+	if err := builder.scan(bufio.NewReaderSize(reader, maxLiteralSize)); err != nil {
+		return nil, err
+	}
+	return builder.delta()
+}
+
+// ApplyDelta writes the data created by applying the delta to the base version of the data. The base must be the data
+// the signature, used to compute the delta, was computed for.
+// ApplyDelta returns the number of bytes written, and an error if the written data doesn't match the hash of the data
+// the delta was computed from.
+func ApplyDelta(base io.ReaderAt, baseSize int64, delta []byte, writer io.Writer) (int64, error) {
+	if len(delta) < deltaHeaderSize || delta[0] != formatVersion {
+		return 0, &Error{"Invalid delta"}
+	}
+	blockSize := int64(binary.BigEndian.Uint32(delta[1:]))
+	expectedBaseSize := int64(binary.BigEndian.Uint64(delta[5:]))
+	targetSize := int64(binary.BigEndian.Uint64(delta[13:]))
+	expectedHash := delta[21:deltaHeaderSize]
+	if blockSize < minBlockSize {
+		return 0, &Error{"Invalid delta"}
+	}
+	if expectedBaseSize != baseSize {
+		return 0, &Error{fmt.Sprintf("The size of the base data %d doesn't match the delta (%d)", baseSize, expectedBaseSize)}
+	}
+
+	hash := sha256.New()
+	output := io.MultiWriter(writer, hash)
+	var written int64
+	block := make([]byte, blockSize)
+	operations := delta[deltaHeaderSize:]
+	for len(operations) > 0 {
+		switch operations[0] {
+		case copyOperation:
+			if len(operations) < 9 {
+				return written, &Error{"Invalid delta: truncated copy operation"}
+			}
+			start := int64(binary.BigEndian.Uint32(operations[1:]))
+			count := int64(binary.BigEndian.Uint32(operations[5:]))
+			operations = operations[9:]
+			for index := start; index < start+count; index++ {
+				offset := index * blockSize
+				if offset >= baseSize {
+					return written, &Error{"Invalid delta: block out of range"}
+				}
+				length := blockSize
+				if offset+length > baseSize {
+					length = baseSize - offset
+				}
+				if _, err := base.ReadAt(block[:length], offset); err != nil && err != io.EOF {
+					return written, &Error{"Failed to read the base data. Error: " + err.Error()}
+				}
+				n, err := output.Write(block[:length])
+				written += int64(n)
+				if err != nil {
+					return written, err
+				}
+			}
+
+		case literalOperation:
+			if len(operations) < 5 {
+				return written, &Error{"Invalid delta: truncated literal operation"}
+			}
+			length := int(binary.BigEndian.Uint32(operations[1:]))
+			if len(operations) < 5+length {
+				return written, &Error{"Invalid delta: truncated literal data"}
+			}
+			n, err := output.Write(operations[5 : 5+length])
+			written += int64(n)
+			if err != nil {
+				return written, err
+			}
+			operations = operations[5+length:]
+
+		default:
+			return written, &Error{"Invalid delta: unknown operation"}
+		}
+	}
+
+	if written != targetSize || !bytes.Equal(hash.Sum(nil), expectedHash) {
+		return written, &Error{"The data created from the delta doesn't match the hash of the new data"}
+	}
+	return written, nil
+}
+
+type deltaBuilder struct {
+	signature  *Signature
+	blocks     map[uint32][]int
+	maxSize    int
+	operations bytes.Buffer
+	hash       [hashSize]byte
+	size       int64
+	copyStart  int
+	copyCount  int
+}
+
+func newDeltaBuilder(signature *Signature, maxSize int) *deltaBuilder {
+	builder := &deltaBuilder{signature: signature, maxSize: maxSize, blocks: make(map[uint32][]int)}
+	for i, weak := range signature.weak {
+		// Only full blocks can be matched while scanning, the last block is checked separately
+		if int64(i+1)*int64(signature.blockSize) <= signature.size {
+			builder.blocks[weak] = append(builder.blocks[weak], i)
+		}
+	}
+	return builder
+}
+
+// scan reads the new data and creates the operations of the delta.
+// buffer[:position] holds data that didn't match any block and has to be sent as literal data, and
+// buffer[position:position+blockSize] is the window being compared to the blocks of the signature.
+func (builder *deltaBuilder) scan(reader io.Reader) error {
+	blockSize := builder.signature.blockSize
+	hash := sha256.New()
+	buffer := make([]byte, 0, 2*blockSize+maxLiteralSize)
+	position := 0
+	eof := false
+	var weak uint32
+	validWeak := false
+
+	for {
+		// Make sure the buffer holds the window and the byte following it
+		if !eof && len(buffer) < position+blockSize+1 {
+			if position+blockSize+1 > cap(buffer) {
+				if err := builder.addLiteral(buffer[:position]); err != nil {
+					return err
+				}
+				buffer = buffer[:copy(buffer[:cap(buffer)], buffer[position:])]
+				position = 0
+			}
+			n, err := io.ReadFull(reader, buffer[len(buffer):cap(buffer)])
+			hash.Write(buffer[len(buffer) : len(buffer)+n])
+			buffer = buffer[:len(buffer)+n]
+			builder.size += int64(n)
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				eof = true
+			} else if err != nil {
+				return &Error{"Failed to read the data to compute a delta. Error: " + err.Error()}
+			}
+		}
+
+		if len(buffer)-position < blockSize {
+			break
+		}
+		if !validWeak {
+			weak = weakChecksum(buffer[position : position+blockSize])
+			validWeak = true
+		}
+		if index := builder.findBlock(weak, buffer[position:position+blockSize]); index != -1 {
+			if err := builder.addLiteral(buffer[:position]); err != nil {
+				return err
+			}
+			builder.addCopy(index)
+			buffer = buffer[:copy(buffer[:cap(buffer)], buffer[position+blockSize:])]
+			position = 0
+			validWeak = false
+			continue
+		}
+		if position+blockSize == len(buffer) {
+			break
+		}
+		weak = rollChecksum(weak, buffer[position], buffer[position+blockSize], blockSize)
+		position++
+	}
+
+	// The remaining data may end with the last block of the base version, if it is smaller than the block size
+	lastBlock := len(builder.signature.weak) - 1
+	lastBlockSize := int(builder.signature.size - int64(lastBlock)*int64(blockSize))
+	if lastBlock >= 0 && lastBlockSize < blockSize && len(buffer) >= lastBlockSize {
+		tail := buffer[len(buffer)-lastBlockSize:]
+		if weakChecksum(tail) == builder.signature.weak[lastBlock] && strongHash(tail) == builder.signature.strong[lastBlock] {
+			if err := builder.addLiteral(buffer[:len(buffer)-lastBlockSize]); err != nil {
+				return err
+			}
+			builder.addCopy(lastBlock)
+			buffer = buffer[:0]
+		}
+	}
+	if err := builder.addLiteral(buffer); err != nil {
+		return err
+	}
+	copy(builder.hash[:], hash.Sum(nil))
+	return nil
+}
+
+func (builder *deltaBuilder) findBlock(weak uint32, window []byte) int {
+	indexes, ok := builder.blocks[weak]
+	if !ok {
+		return -1
+	}
+	strong := strongHash(window)
+	for _, index := range indexes {
+		// Prefer the block following the previous match, so that the copy operations can be merged
+		if builder.copyCount > 0 && index == builder.copyStart+builder.copyCount && builder.signature.strong[index] == strong {
+			return index
+		}
+	}
+	for _, index := range indexes {
+		if builder.signature.strong[index] == strong {
+			return index
+		}
+	}
+	return -1
+}
+
+func (builder *deltaBuilder) addCopy(index int) {
+	if builder.copyCount > 0 && index == builder.copyStart+builder.copyCount {
+		builder.copyCount++
+		return
+	}
+	builder.flushCopy()
+	builder.copyStart = index
+	builder.copyCount = 1
+}
+
+func (builder *deltaBuilder) flushCopy() {
+	if builder.copyCount == 0 {
+		return
+	}
+	var operation [9]byte
+	operation[0] = copyOperation
+	binary.BigEndian.PutUint32(operation[1:], uint32(builder.copyStart))
+	binary.BigEndian.PutUint32(operation[5:], uint32(builder.copyCount))
+	builder.operations.Write(operation[:])
+	builder.copyCount = 0
+}
+
+func (builder *deltaBuilder) addLiteral(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	builder.flushCopy()
+	var operation [5]byte
+	operation[0] = literalOperation
+	binary.BigEndian.PutUint32(operation[1:], uint32(len(data)))
+	builder.operations.Write(operation[:])
+	builder.operations.Write(data)
+	if deltaHeaderSize+builder.operations.Len() > builder.maxSize {
+		return &TooLarge{builder.maxSize}
+	}
+	return nil
+}
+
+func (builder *deltaBuilder) delta() ([]byte, error) {
+	builder.flushCopy()
+	size := deltaHeaderSize + builder.operations.Len()
+	if size > builder.maxSize {
+		return nil, &TooLarge{builder.maxSize}
+	}
+	delta := make([]byte, deltaHeaderSize, size)
+	delta[0] = formatVersion
+	binary.BigEndian.PutUint32(delta[1:], uint32(builder.signature.blockSize))
+	binary.BigEndian.PutUint64(delta[5:], uint64(builder.signature.size))
+	binary.BigEndian.PutUint64(delta[13:], uint64(builder.size))
+	copy(delta[21:], builder.hash[:])
+	return append(delta, builder.operations.Bytes()...), nil
+}
+
+// weakChecksum computes the rsync rolling checksum of the block
+func weakChecksum(block []byte) uint32 {
+	var a, b uint32
+	length := uint32(len(block))
+	for i, value := range block {
+		a += uint32(value)
+		b += (length - uint32(i)) * uint32(value)
+	}
+	return (a & 0xffff) | (b << 16)
+}
+
+// rollChecksum moves the window of the checksum one byte forward
+func rollChecksum(checksum uint32, out byte, in byte, blockSize int) uint32 {
+	a := (checksum&0xffff - uint32(out) + uint32(in)) & 0xffff
+	b := ((checksum >> 16) - uint32(blockSize)*uint32(out) + a) & 0xffff
+	return a | (b << 16)
+}
+
+func strongHash(block []byte) [strongSize]byte {
+	var result [strongSize]byte
+	sum := sha256.Sum256(block)
+	copy(result[:], sum[:strongSize])
+	return result
+}
@@ -0,0 +1,121 @@
+package delta
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestDelta(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	base := make([]byte, 100*1024+123)
+	random.Read(base)
+
+	insertion := make([]byte, 3000)
+	random.Read(insertion)
+
+	modified := append([]byte{}, base...)
+	modified[50000] ^= 0xff
+
+	inserted := append(append(append([]byte{}, base[:20000]...), insertion...), base[20000:]...)
+	removed := append(append([]byte{}, base[:10000]...), base[30000:]...)
+	appended := append(append([]byte{}, base...), insertion...)
+	other := make([]byte, 50*1024)
+	random.Read(other)
+
+	tests := []struct {
+		name       string
+		base       []byte
+		newData    []byte
+		maxLiteral int
+	}{
+		{"identical", base, base, 0},
+		{"modified byte", base, modified, minBlockSize},
+		{"inserted data", base, inserted, len(insertion) + 2*minBlockSize},
+		{"removed data", base, removed, 2 * minBlockSize},
+		{"appended data", base, appended, len(insertion) + minBlockSize},
+		{"truncated data", base, base[:len(base)-5000], minBlockSize},
+		{"different data", base, other, len(other)},
+		{"empty base", []byte{}, other, len(other)},
+		{"empty new data", base, []byte{}, 0},
+	}
+
+	for _, row := range tests {
+		signature, err := ComputeSignature(bytes.NewReader(row.base), int64(len(row.base)))
+		if err != nil {
+			t.Errorf("Failed to compute signature (%s). Error: %s", row.name, err.Error())
+			continue
+		}
+		signature, err = DecodeSignature(signature.Encode())
+		if err != nil {
+			t.Errorf("Failed to decode signature (%s). Error: %s", row.name, err.Error())
+			continue
+		}
+		if signature.Size() != int64(len(row.base)) {
+			t.Errorf("Wrong signature size (%s): %d instead of %d", row.name, signature.Size(), len(row.base))
+		}
+
+		delta, err := ComputeDelta(signature, bytes.NewReader(row.newData), len(row.newData)+1024)
+		if err != nil {
+			t.Errorf("Failed to compute delta (%s). Error: %s", row.name, err.Error())
+			continue
+		}
+		// Literal data, the header and a few operations
+		if len(delta) > row.maxLiteral+deltaHeaderSize+100 {
+			t.Errorf("Delta is too large (%s): %d bytes", row.name, len(delta))
+		}
+
+		var result bytes.Buffer
+		written, err := ApplyDelta(bytes.NewReader(row.base), int64(len(row.base)), delta, &result)
+		if err != nil {
+			t.Errorf("Failed to apply delta (%s). Error: %s", row.name, err.Error())
+			continue
+		}
+		if written != int64(len(row.newData)) || !bytes.Equal(result.Bytes(), row.newData) {
+			t.Errorf("Applying the delta created wrong data (%s)", row.name)
+		}
+	}
+
+	// Delta larger than the maximal size
+	signature, _ := ComputeSignature(bytes.NewReader(base), int64(len(base)))
+	if _, err := ComputeDelta(signature, bytes.NewReader(other), 1000); err == nil || !IsTooLarge(err) {
+		t.Errorf("Computing a large delta didn't fail with TooLarge error. Error: %v", err)
+	}
+
+	// Applying a delta to the wrong base
+	delta, err := ComputeDelta(signature, bytes.NewReader(modified), len(modified))
+	if err != nil {
+		t.Errorf("Failed to compute delta. Error: %s", err.Error())
+	} else {
+		wrongBase := append([]byte{}, base...)
+		wrongBase[10] ^= 0xff
+		var result bytes.Buffer
+		if _, err := ApplyDelta(bytes.NewReader(wrongBase), int64(len(wrongBase)), delta, &result); err == nil {
+			t.Errorf("Applying a delta to the wrong base didn't fail")
+		}
+		if _, err := ApplyDelta(bytes.NewReader(base[:1000]), 1000, delta, &result); err == nil {
+			t.Errorf("Applying a delta to a base of the wrong size didn't fail")
+		}
+		if _, err := ApplyDelta(bytes.NewReader(base), int64(len(base)), delta[:len(delta)-10], &result); err == nil {
+			t.Errorf("Applying a truncated delta didn't fail")
+		}
+	}
+
+	if _, err := DecodeSignature([]byte{1, 2, 3}); err == nil {
+		t.Errorf("Decoding an invalid signature didn't fail")
+	}
+}
+
+func TestRollingChecksum(t *testing.T) {
+	random := rand.New(rand.NewSource(2))
+	data := make([]byte, 3*minBlockSize)
+	random.Read(data)
+
+	checksum := weakChecksum(data[:minBlockSize])
+	for i := 0; i < 2*minBlockSize; i++ {
+		checksum = rollChecksum(checksum, data[i], data[i+minBlockSize], minBlockSize)
+		if expected := weakChecksum(data[i+1 : i+1+minBlockSize]); checksum != expected {
+			t.Fatalf("Wrong rolling checksum at offset %d: %x instead of %x", i+1, checksum, expected)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/compression"
+)
+
+// Objects' data is encrypted using envelope encryption: the data of each object is encrypted with a random data key,
+// and the data key is encrypted with the current key of the object's organization, obtained from the KeyProvider.
+// The encrypted data key is stored in the header of the encrypted data, so the encrypted data is self contained
+// and is stored and transferred as is. It is decrypted when it is delivered to an application.
+// Whether the data of an object is encrypted is recorded in the object's meta data (the Encrypted field),
+// the data itself isn't examined to find out whether it is encrypted.
+// Encrypted data can't be compressed, so the data is compressed before it is encrypted, with the compression
+// configured for the object's organization and type.
+//
+// The format of the encrypted data is:
+//   magic (8 bytes)
+//   length of the key ID (2 bytes), key ID
+//   length of the encrypted data key (2 bytes), encrypted data key
+//   length of the name of the compression (2 bytes), name of the compression of the data
+//   segments of up to segmentSize bytes of data, each encrypted with AES-GCM
+// The nonce of a segment is its sequence number, and the last segment is marked in its additional data,
+// so that segments can't be reordered and the data can't be truncated.
+
+const (
+	segmentSize = 64 * 1024
+	dataKeySize = 32
+)
+
+var magic = []byte{0x00, 'E', 'S', 'S', 'E', 'N', 'C', 0x01}
+
+// KeyProvider provides the keys used to encrypt the data keys of the objects of organizations
+type KeyProvider interface {
+	// Init initializes the key provider
+	Init() common.SyncServiceError
+
+	// GetCurrentKey returns the ID and the value of the key to be used to encrypt the data of the organization's objects.
+	// An empty key ID is returned if the data of the organization's objects is not encrypted.
+	GetCurrentKey(orgID string) (string, []byte, common.SyncServiceError)
+
+	// GetKey returns the key of the organization with the given ID
+	GetKey(orgID string, keyID string) ([]byte, common.SyncServiceError)
+}
+
+// Error is the error used in the encryption package
+type Error struct {
+	message string
+}
+
+func (e *Error) Error() string {
+	return e.message
+}
+
+var keyProvider KeyProvider
+
+// SetKeyProvider is called by the code starting the Sync Service to set the KeyProvider implementation
+// to be used to encrypt objects' data. If no KeyProvider is set, objects' data is not encrypted.
+func SetKeyProvider(provider KeyProvider) {
+	keyProvider = provider
+}
+
+// Init initializes the key provider, if one is set
+func Init() common.SyncServiceError {
+	if keyProvider == nil {
+		return nil
+	}
+	return keyProvider.Init()
+}
+
+// Enabled returns true if a key provider is set
+func Enabled() bool {
+	return keyProvider != nil
+}
+
+// EncryptData compresses and encrypts the data of an object of the organization, and returns true if the data was encrypted.
+// The data is returned as is if the organization's data is not encrypted.
+func EncryptData(orgID string, objectType string, data []byte) ([]byte, bool, common.SyncServiceError) {
+	if keyProvider == nil {
+		return data, false, nil
+	}
+	reader, encrypted, err := Encrypt(orgID, objectType, bytes.NewReader(data))
+	if err != nil || !encrypted {
+		return data, false, err
+	}
+	var buffer bytes.Buffer
+	if _, err := buffer.ReadFrom(reader); err != nil {
+		return nil, false, &Error{"Failed to encrypt data. Error: " + err.Error()}
+	}
+	return buffer.Bytes(), true, nil
+}
+
+// Encrypt returns a reader of the compressed and encrypted data of an object of the organization,
+// and true if the data is encrypted. The reader is returned as is if the organization's data is not encrypted.
+func Encrypt(orgID string, objectType string, reader io.Reader) (io.Reader, bool, common.SyncServiceError) {
+	if keyProvider == nil {
+		return reader, false, nil
+	}
+	keyID, key, err := keyProvider.GetCurrentKey(orgID)
+	if err != nil {
+		return nil, false, err
+	}
+	if keyID == "" {
+		return reader, false, nil
+	}
+
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, false, &Error{"Failed to create a data key. Error: " + err.Error()}
+	}
+	dataCompression := common.GetDataCompression(orgID, objectType)
+	encryptedKey, err := wrapKey(orgID, dataCompression, key, dataKey)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(keyID) > 0xffff || len(encryptedKey) > 0xffff {
+		return nil, false, &Error{"Invalid key"}
+	}
+	dataCipher, err := newCipher(dataKey)
+	if err != nil {
+		return nil, false, err
+	}
+	compressedReader, compressErr := compression.NewCompressingReader(dataCompression, reader)
+	if compressErr != nil {
+		return nil, false, &Error{compressErr.Error()}
+	}
+
+	header := bytes.NewBuffer(make([]byte, 0, len(magic)+6+len(keyID)+len(encryptedKey)+len(dataCompression)))
+	header.Write(magic)
+	binary.Write(header, binary.BigEndian, uint16(len(keyID)))
+	header.WriteString(keyID)
+	binary.Write(header, binary.BigEndian, uint16(len(encryptedKey)))
+	header.Write(encryptedKey)
+	binary.Write(header, binary.BigEndian, uint16(len(dataCompression)))
+	header.WriteString(dataCompression)
+
+	return &encryptingReader{source: bufio.NewReaderSize(compressedReader, segmentSize), cipher: dataCipher,
+		pending: header.Bytes(), segment: make([]byte, segmentSize)}, true, nil
+}
+
+// Decrypt returns a reader of the decrypted and decompressed data of an object of the organization.
+// Data that is not encrypted, as recorded in the object's meta data, is read as is.
+// The closer is called when the returned reader is closed.
+func Decrypt(orgID string, encrypted bool, reader io.Reader, closer func() error) (io.ReadCloser, common.SyncServiceError) {
+	if !encrypted {
+		return &plainReader{Reader: reader, closer: closer}, nil
+	}
+	if keyProvider == nil {
+		return nil, &Error{"The data is encrypted, but no key provider is set"}
+	}
+
+	source := bufio.NewReaderSize(reader, segmentSize+16)
+	prefix := make([]byte, len(magic))
+	if _, err := io.ReadFull(source, prefix); err != nil || !bytes.Equal(prefix, magic) {
+		return nil, &Error{"Invalid header of encrypted data"}
+	}
+	keyID, err := readField(source)
+	if err != nil {
+		return nil, err
+	}
+	encryptedKey, err := readField(source)
+	if err != nil {
+		return nil, err
+	}
+	dataCompression, err := readField(source)
+	if err != nil {
+		return nil, err
+	}
+	key, err := keyProvider.GetKey(orgID, string(keyID))
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, &Error{"The key " + string(keyID) + " of the organization " + orgID + " was not found"}
+	}
+	dataKey, err := unwrapKey(orgID, string(dataCompression), key, encryptedKey)
+	if err != nil {
+		return nil, err
+	}
+	dataCipher, err := newCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	decryptedReader := &decryptingReader{source: source, cipher: dataCipher, segment: make([]byte, segmentSize+dataCipher.Overhead()),
+		closer: closer}
+	if string(dataCompression) == common.NoCompression {
+		return decryptedReader, nil
+	}
+	decompressedReader, decompressErr := compression.NewDecompressingReader(string(dataCompression), decryptedReader)
+	if decompressErr != nil {
+		return nil, &Error{decompressErr.Error()}
+	}
+	return &decompressingReader{ReadCloser: decompressedReader, decryptedReader: decryptedReader}, nil
+}
+
+func readField(reader io.Reader) ([]byte, common.SyncServiceError) {
+	var length uint16
+	if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+		return nil, &Error{"Invalid header of encrypted data"}
+	}
+	field := make([]byte, length)
+	if _, err := io.ReadFull(reader, field); err != nil {
+		return nil, &Error{"Invalid header of encrypted data"}
+	}
+	return field, nil
+}
+
+func newCipher(key []byte) (cipher.AEAD, common.SyncServiceError) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, &Error{"Invalid key. Error: " + err.Error()}
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, &Error{"Failed to create cipher. Error: " + err.Error()}
+	}
+	return aead, nil
+}
+
+// wrapKey encrypts the data key with the organization's key. The organization ID is authenticated with the data key,
+// so that data can't be moved between organizations, and so is the compression of the data, which is in the clear.
+func wrapKey(orgID string, dataCompression string, key []byte, dataKey []byte) ([]byte, common.SyncServiceError) {
+	keyCipher, err := newCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, keyCipher.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, &Error{"Failed to create a nonce. Error: " + err.Error()}
+	}
+	return keyCipher.Seal(nonce, nonce, dataKey, keyAdditionalData(orgID, dataCompression)), nil
+}
+
+func unwrapKey(orgID string, dataCompression string, key []byte, encryptedKey []byte) ([]byte, common.SyncServiceError) {
+	keyCipher, err := newCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(encryptedKey) < keyCipher.NonceSize() {
+		return nil, &Error{"Invalid encrypted data key"}
+	}
+	nonceSize := keyCipher.NonceSize()
+	dataKey, openErr := keyCipher.Open(nil, encryptedKey[:nonceSize], encryptedKey[nonceSize:],
+		keyAdditionalData(orgID, dataCompression))
+	if openErr != nil {
+		return nil, &Error{"Failed to decrypt the data key. Error: " + openErr.Error()}
+	}
+	return dataKey, nil
+}
+
+func keyAdditionalData(orgID string, dataCompression string) []byte {
+	return []byte(orgID + "\x00" + dataCompression)
+}
+
+func segmentNonce(aead cipher.AEAD, sequence uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], sequence)
+	return nonce
+}
+
+var lastSegment = []byte{1}
+
+type encryptingReader struct {
+	source   *bufio.Reader
+	cipher   cipher.AEAD
+	pending  []byte
+	segment  []byte
+	sequence uint64
+	done     bool
+}
+
+func (reader *encryptingReader) Read(p []byte) (int, error) {
+	for len(reader.pending) == 0 {
+		if reader.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(reader.source, reader.segment)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		var additionalData []byte
+		if _, peekErr := reader.source.Peek(1); peekErr == io.EOF {
+			additionalData = lastSegment
+			reader.done = true
+		}
+		reader.pending = reader.cipher.Seal(nil, segmentNonce(reader.cipher, reader.sequence), reader.segment[:n], additionalData)
+		reader.sequence++
+	}
+	n := copy(p, reader.pending)
+	reader.pending = reader.pending[n:]
+	return n, nil
+}
+
+type decryptingReader struct {
+	source   *bufio.Reader
+	cipher   cipher.AEAD
+	pending  []byte
+	segment  []byte
+	sequence uint64
+	done     bool
+	closer   func() error
+}
+
+func (reader *decryptingReader) Read(p []byte) (int, error) {
+	for len(reader.pending) == 0 {
+		if reader.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(reader.source, reader.segment)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		var additionalData []byte
+		if _, peekErr := reader.source.Peek(1); peekErr == io.EOF {
+			additionalData = lastSegment
+			reader.done = true
+		}
+		data, err := reader.cipher.Open(nil, segmentNonce(reader.cipher, reader.sequence), reader.segment[:n], additionalData)
+		if err != nil {
+			return 0, &Error{"Failed to decrypt data. Error: " + err.Error()}
+		}
+		reader.pending = data
+		reader.sequence++
+	}
+	n := copy(p, reader.pending)
+	reader.pending = reader.pending[n:]
+	return n, nil
+}
+
+func (reader *decryptingReader) Close() error {
+	if reader.closer == nil {
+		return nil
+	}
+	return reader.closer()
+}
+
+// decompressingReader closes the decompression and the decrypted data when it is closed
+type decompressingReader struct {
+	io.ReadCloser
+	decryptedReader io.Closer
+}
+
+func (reader *decompressingReader) Close() error {
+	reader.ReadCloser.Close()
+	return reader.decryptedReader.Close()
+}
+
+type plainReader struct {
+	io.Reader
+	closer func() error
+}
+
+func (reader *plainReader) Close() error {
+	if reader.closer == nil {
+		return nil
+	}
+	return reader.closer()
+}
@@ -0,0 +1,238 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+func TestEncryption(t *testing.T) {
+	provider, path := setUpKeyProvider(t, map[string]string{"key1": newKey(t)}, "key1")
+	defer os.Remove(path)
+	SetKeyProvider(provider)
+	defer SetKeyProvider(nil)
+
+	sizes := []int{0, 1, 100, segmentSize - 1, segmentSize, segmentSize + 1, 3*segmentSize + 17}
+	for _, size := range sizes {
+		data := make([]byte, size)
+		rand.Read(data)
+
+		encrypted, isEncrypted, err := EncryptData("myorg", "mytype", data)
+		if err != nil || !isEncrypted {
+			t.Errorf("Failed to encrypt %d bytes. Error: %v", size, err)
+			continue
+		}
+		// Short data may appear in the random encrypted data by chance, it can't appear in all of several encryptions
+		for attempt := 0; size > 0 && bytes.Contains(encrypted, data) && attempt < 10; attempt++ {
+			encrypted, _, _ = EncryptData("myorg", "mytype", data)
+		}
+		if size > 0 && bytes.Contains(encrypted, data) {
+			t.Errorf("The encrypted data contains the data (size %d)", size)
+		}
+
+		closed := false
+		reader, err := Decrypt("myorg", true, bytes.NewReader(encrypted), func() error { closed = true; return nil })
+		if err != nil {
+			t.Errorf("Failed to decrypt %d bytes. Error: %s", size, err.Error())
+			continue
+		}
+		decrypted, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Errorf("Failed to read the decrypted data (size %d). Error: %s", size, err.Error())
+		} else if !bytes.Equal(decrypted, data) {
+			t.Errorf("The decrypted data doesn't match the data (size %d)", size)
+		}
+		reader.Close()
+		if !closed {
+			t.Errorf("Closing the decrypted reader didn't close the data reader")
+		}
+
+		// Data of another organization
+		if reader, err := Decrypt("otherorg", true, bytes.NewReader(encrypted), nil); err == nil {
+			if _, err := ioutil.ReadAll(reader); err == nil {
+				t.Errorf("Decrypted data with the key of another organization (size %d)", size)
+			}
+		}
+
+		// Truncated data
+		if size > segmentSize {
+			reader, err := Decrypt("myorg", true, bytes.NewReader(encrypted[:len(encrypted)-segmentSize]), nil)
+			if err == nil {
+				if _, err := ioutil.ReadAll(reader); err == nil {
+					t.Errorf("Decrypted truncated data (size %d)", size)
+				}
+			}
+		}
+	}
+
+	// Organizations without keys aren't encrypted
+	data := []byte("plain data")
+	if encrypted, isEncrypted, err := EncryptData("otherorg", "mytype", data); err != nil || isEncrypted || !bytes.Equal(encrypted, data) {
+		t.Errorf("The data of an organization without keys was encrypted. Error: %v", err)
+	}
+	reader, err := Decrypt("otherorg", false, bytes.NewReader(data), nil)
+	if err != nil {
+		t.Errorf("Failed to read plain data. Error: %s", err.Error())
+	} else if plain, _ := ioutil.ReadAll(reader); !bytes.Equal(plain, data) {
+		t.Errorf("Plain data was modified by Decrypt")
+	}
+
+	// Plain data is read as is even if it looks like encrypted data
+	encrypted, _, _ := EncryptData("myorg", "mytype", data)
+	reader, err = Decrypt("myorg", false, bytes.NewReader(encrypted), nil)
+	if err != nil {
+		t.Errorf("Failed to read plain data that starts like encrypted data. Error: %s", err.Error())
+	} else if plain, _ := ioutil.ReadAll(reader); !bytes.Equal(plain, encrypted) {
+		t.Errorf("Plain data that starts like encrypted data was modified by Decrypt")
+	}
+
+	// Data that is recorded as encrypted must be encrypted
+	if _, err := Decrypt("myorg", true, bytes.NewReader(data), nil); err == nil {
+		t.Errorf("Decrypt didn't fail for encrypted data without a header")
+	}
+
+	// Encrypted data can't be read without a key provider
+	SetKeyProvider(nil)
+	if _, err := Decrypt("myorg", true, bytes.NewReader(encrypted), nil); err == nil {
+		t.Errorf("Decrypt didn't fail without a key provider")
+	}
+}
+
+func TestCompressedEncryption(t *testing.T) {
+	provider, path := setUpKeyProvider(t, map[string]string{"key1": newKey(t)}, "key1")
+	defer os.Remove(path)
+	SetKeyProvider(provider)
+	defer SetKeyProvider(nil)
+	defer func() { common.Configuration.DataCompression = common.NoCompression }()
+
+	data := bytes.Repeat([]byte("compressible data of an object "), 10000)
+	compressions := []string{common.GzipCompression, common.ZstdCompression}
+	for index, dataCompression := range compressions {
+		common.Configuration.DataCompression = dataCompression
+		encrypted, _, err := EncryptData("myorg", "mytype", data)
+		if err != nil {
+			t.Errorf("Failed to encrypt data compressed with %s. Error: %s", dataCompression, err.Error())
+			continue
+		}
+		if len(encrypted) >= len(data)/2 {
+			t.Errorf("The data wasn't compressed with %s before it was encrypted: %d bytes", dataCompression, len(encrypted))
+		}
+
+		common.Configuration.DataCompression = common.NoCompression
+		closed := false
+		reader, err := Decrypt("myorg", true, bytes.NewReader(encrypted), func() error { closed = true; return nil })
+		if err != nil {
+			t.Errorf("Failed to decrypt data compressed with %s. Error: %s", dataCompression, err.Error())
+			continue
+		}
+		if decrypted, err := ioutil.ReadAll(reader); err != nil || !bytes.Equal(decrypted, data) {
+			t.Errorf("The decrypted data doesn't match the data compressed with %s. Error: %v", dataCompression, err)
+		}
+		reader.Close()
+		if !closed {
+			t.Errorf("Closing the decompressed reader didn't close the data reader")
+		}
+
+		// The compression in the header is authenticated
+		other := compressions[(index+1)%len(compressions)]
+		tampered := bytes.Replace(encrypted, []byte(dataCompression), []byte(other), 1)
+		if _, err := Decrypt("myorg", true, bytes.NewReader(tampered), nil); err == nil {
+			t.Errorf("Decrypted data with a modified compression %s", other)
+		}
+	}
+}
+
+func TestFileKeyProvider(t *testing.T) {
+	key1 := newKey(t)
+	provider, path := setUpKeyProvider(t, map[string]string{"key1": key1}, "key1")
+	defer os.Remove(path)
+	SetKeyProvider(provider)
+	defer SetKeyProvider(nil)
+
+	data := []byte("some data to encrypt")
+	encrypted, _, err := EncryptData("myorg", "mytype", data)
+	if err != nil {
+		t.Fatalf("Failed to encrypt data. Error: %s", err.Error())
+	}
+
+	// Rotate the key, the old key is still available for decryption
+	time.Sleep(10 * time.Millisecond)
+	writeKeysFile(t, path, map[string]string{"key1": key1, "key2": newKey(t)}, "key2")
+	if keyID, _, err := provider.GetCurrentKey("myorg"); err != nil || keyID != "key2" {
+		t.Errorf("The keys file wasn't reloaded: current key is %s. Error: %v", keyID, err)
+	}
+	reader, err := Decrypt("myorg", true, bytes.NewReader(encrypted), nil)
+	if err != nil {
+		t.Errorf("Failed to decrypt data after key rotation. Error: %s", err.Error())
+	} else if decrypted, _ := ioutil.ReadAll(reader); !bytes.Equal(decrypted, data) {
+		t.Errorf("The decrypted data doesn't match the data")
+	}
+
+	// Remove the old key
+	time.Sleep(10 * time.Millisecond)
+	writeKeysFile(t, path, map[string]string{"key2": newKey(t)}, "key2")
+	if _, err := Decrypt("myorg", true, bytes.NewReader(encrypted), nil); err == nil {
+		t.Errorf("Decrypted data encrypted with a removed key")
+	}
+
+	// Invalid files
+	invalidFiles := []string{
+		"not json",
+		`{"myorg": {"currentKey": "key1", "keys": {"key1": "c2hvcnQ="}}}`,
+		`{"myorg": {"currentKey": "key3", "keys": {}}}`,
+	}
+	for _, content := range invalidFiles {
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write the keys file. Error: %s", err.Error())
+		}
+		if err := (&FileKeyProvider{Path: path}).Init(); err == nil {
+			t.Errorf("Init didn't fail for an invalid keys file: %s", content)
+		}
+	}
+	if err := (&FileKeyProvider{Path: path + ".missing"}).Init(); err == nil {
+		t.Errorf("Init didn't fail for a missing keys file")
+	}
+}
+
+func newKey(t *testing.T) string {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("Failed to create a key. Error: %s", err.Error())
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func writeKeysFile(t *testing.T, path string, keys map[string]string, currentKey string) {
+	content := fmt.Sprintf(`{"myorg": {"currentKey": "%s", "keys": {`, currentKey)
+	separator := ""
+	for keyID, key := range keys {
+		content += fmt.Sprintf(`%s"%s": "%s"`, separator, keyID, key)
+		separator = ", "
+	}
+	content += "}}}"
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write the keys file. Error: %s", err.Error())
+	}
+}
+
+func setUpKeyProvider(t *testing.T, keys map[string]string, currentKey string) (*FileKeyProvider, string) {
+	file, err := ioutil.TempFile("", "keys")
+	if err != nil {
+		t.Fatalf("Failed to create the keys file. Error: %s", err.Error())
+	}
+	file.Close()
+	writeKeysFile(t, file.Name(), keys, currentKey)
+
+	provider := &FileKeyProvider{Path: file.Name()}
+	if err := provider.Init(); err != nil {
+		t.Fatalf("Failed to initialize the key provider. Error: %s", err.Error())
+	}
+	return provider, file.Name()
+}
@@ -0,0 +1,131 @@
+package encryption
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+)
+
+// FileKeyProvider is a KeyProvider that reads the keys of the organizations from a JSON file of the form:
+//
+//	{
+//	  "myorg": {
+//	    "currentKey": "key2",
+//	    "keys": { "key1": "<base64 encoded key>", "key2": "<base64 encoded key>" }
+//	  }
+//	}
+//
+// The keys are AES keys of 16, 24, or 32 bytes. Keys that are no longer current should be kept in the file
+// as long as there is data encrypted with them.
+// The file is read again when it is modified, so keys can be rotated without restarting the Sync Service.
+type FileKeyProvider struct {
+	// Path is the path of the keys file
+	Path string
+
+	orgs    map[string]orgKeys
+	modTime time.Time
+	lock    sync.RWMutex
+}
+
+type orgKeys struct {
+	CurrentKey string            `json:"currentKey"`
+	Keys       map[string]string `json:"keys"`
+	decoded    map[string][]byte
+}
+
+// Init initializes the FileKeyProvider
+func (provider *FileKeyProvider) Init() common.SyncServiceError {
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+	return provider.load()
+}
+
+// GetCurrentKey returns the ID and the value of the key to be used to encrypt the data of the organization's objects.
+// An empty key ID is returned if the file has no keys for the organization.
+func (provider *FileKeyProvider) GetCurrentKey(orgID string) (string, []byte, common.SyncServiceError) {
+	provider.reloadIfModified()
+
+	provider.lock.RLock()
+	defer provider.lock.RUnlock()
+	keys, ok := provider.orgs[orgID]
+	if !ok || keys.CurrentKey == "" {
+		return "", nil, nil
+	}
+	return keys.CurrentKey, keys.decoded[keys.CurrentKey], nil
+}
+
+// GetKey returns the key of the organization with the given ID, or nil if there is no such key
+func (provider *FileKeyProvider) GetKey(orgID string, keyID string) ([]byte, common.SyncServiceError) {
+	provider.reloadIfModified()
+
+	provider.lock.RLock()
+	defer provider.lock.RUnlock()
+	return provider.orgs[orgID].decoded[keyID], nil
+}
+
+func (provider *FileKeyProvider) reloadIfModified() {
+	info, err := os.Stat(provider.Path)
+	if err != nil {
+		return
+	}
+	provider.lock.RLock()
+	modified := !info.ModTime().Equal(provider.modTime)
+	provider.lock.RUnlock()
+	if !modified {
+		return
+	}
+
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+	if err := provider.load(); err != nil {
+		// Keep the previous keys until the file is modified again
+		provider.modTime = info.ModTime()
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Failed to reload the encryption keys. Error: %s\n", err)
+		}
+	}
+}
+
+// load reads the keys file, it must be called with the lock held
+func (provider *FileKeyProvider) load() common.SyncServiceError {
+	file, err := os.Open(provider.Path)
+	if err != nil {
+		return &common.SetupError{Message: fmt.Sprintf("Failed to open the encryption keys file %s. Error: %s", provider.Path, err)}
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return &common.SetupError{Message: fmt.Sprintf("Failed to open the encryption keys file %s. Error: %s", provider.Path, err)}
+	}
+
+	orgs := make(map[string]orgKeys)
+	if err := json.NewDecoder(file).Decode(&orgs); err != nil {
+		return &common.SetupError{Message: fmt.Sprintf("Failed to parse the encryption keys file %s. Error: %s", provider.Path, err)}
+	}
+	for orgID, keys := range orgs {
+		keys.decoded = make(map[string][]byte, len(keys.Keys))
+		for keyID, value := range keys.Keys {
+			key, err := base64.StdEncoding.DecodeString(value)
+			if err != nil || (len(key) != 16 && len(key) != 24 && len(key) != 32) {
+				return &common.SetupError{Message: fmt.Sprintf("Invalid encryption key %s of the organization %s", keyID, orgID)}
+			}
+			keys.decoded[keyID] = key
+		}
+		if _, ok := keys.decoded[keys.CurrentKey]; keys.CurrentKey != "" && !ok {
+			return &common.SetupError{Message: fmt.Sprintf("The current encryption key %s of the organization %s was not found",
+				keys.CurrentKey, orgID)}
+		}
+		orgs[orgID] = keys
+	}
+
+	provider.orgs = orgs
+	provider.modTime = info.ModTime()
+	return nil
+}
@@ -1,6 +1,9 @@
 package security
 
-import "net/http"
+import (
+	"net/http"
+	"strings"
+)
 
 // Authentication is the interface invoked by the Sync Service for authentication
 // related stuff. An implementation of this interface is provided by the code
@@ -39,3 +42,37 @@ const (
 	// AuthService is returned by Authenticate when the authenticated user is a Service
 	AuthService
 )
+
+// userTypeCode returns the code of a user type: admin, edgenode, user, syncadmin or service
+func userTypeCode(userType string) int {
+	switch strings.ToLower(userType) {
+	case "admin":
+		return AuthAdmin
+	case "edgenode":
+		return AuthEdgeNode
+	case "user":
+		return AuthUser
+	case "syncadmin":
+		return AuthSyncAdmin
+	case "service":
+		return AuthService
+	}
+	return AuthFailed
+}
+
+// userTypeName returns the user type of a code returned by Authenticate
+func userTypeName(code int) string {
+	switch code {
+	case AuthAdmin:
+		return "admin"
+	case AuthEdgeNode:
+		return "edgenode"
+	case AuthUser:
+		return "user"
+	case AuthSyncAdmin:
+		return "syncadmin"
+	case AuthService:
+		return "service"
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+package security
+
+import (
+	"crypto/x509"
+	"net/http"
+	"strings"
+)
+
+// CertificateAuthenticate is an implementation of the Authenticate interface that authenticates requests
+// with client certificates (mutual TLS). The certificates are verified by the HTTPS server with the CA
+// certificate ClientCACertificate, requests without a verified certificate fail to authenticate.
+//
+// The user is taken from a URI SAN of the certificate of the form sync-service://orgID/type/identity,
+// for example sync-service://myorg/edgenode/destType/destID. If the certificate doesn't have such a SAN,
+// the user is taken from the subject of the certificate: the organization (O) is the user's org,
+// the organizational unit (OU) is the user's type and the common name (CN) is the user's identity.
+//
+// The values for the type are admin, edgenode, user, syncadmin, and service. The identity of an edge node
+// is of the form destType/destID and for a service it is of the form serviceOrg/version/serviceName.
+//
+// An ESS communicating with the CSS via HTTP authenticates with the certificate HTTPCSSClientCertificate.
+type CertificateAuthenticate struct {
+}
+
+// CertificateURIScheme is the scheme of the URI SANs of client certificates that identify users
+const CertificateURIScheme = "sync-service"
+
+// Start initializes the CertificateAuthenticate struct
+func (auth *CertificateAuthenticate) Start() {
+}
+
+// Authenticate  authenticates a particular HTTP request and indicates
+// whether it is an edge node, org admin, or plain user. Also returned is the
+// user's org and identitity. An edge node's identity is destType/destID. A
+// service's identity is serviceOrg/version/serviceName.
+func (auth *CertificateAuthenticate) Authenticate(request *http.Request) (int, string, string) {
+	if request.TLS == nil || len(request.TLS.VerifiedChains) == 0 || len(request.TLS.VerifiedChains[0]) == 0 {
+		return AuthFailed, "", ""
+	}
+	code, orgID, identity := certificateUser(request.TLS.VerifiedChains[0][0])
+	if code == AuthFailed || identity == "" || (orgID == "" && code != AuthSyncAdmin) {
+		return AuthFailed, "", ""
+	}
+	return code, orgID, identity
+}
+
+// KeyandSecretForURL returns an app key and an app secret pair to be
+// used by the ESS when communicating with the specified URL.
+func (auth *CertificateAuthenticate) KeyandSecretForURL(url string) (string, string) {
+	// The ESS authenticates with its client certificate
+	return "", ""
+}
+
+func certificateUser(certificate *x509.Certificate) (int, string, string) {
+	for _, uri := range certificate.URIs {
+		if uri.Scheme != CertificateURIScheme {
+			continue
+		}
+		// The host is the org, and the path is /type/identity
+		parts := strings.SplitN(strings.TrimPrefix(uri.Path, "/"), "/", 2)
+		if len(parts) != 2 {
+			return AuthFailed, "", ""
+		}
+		return userTypeCode(parts[0]), uri.Host, parts[1]
+	}
+
+	subject := certificate.Subject
+	if len(subject.OrganizationalUnit) == 0 {
+		return AuthFailed, "", ""
+	}
+	var orgID string
+	if len(subject.Organization) != 0 {
+		orgID = subject.Organization[0]
+	}
+	return userTypeCode(subject.OrganizationalUnit[0]), orgID, subject.CommonName
+}
@@ -0,0 +1,118 @@
+package security
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestCertificateAuthenticate(t *testing.T) {
+	caCert, caKey := createTestCertificate(&x509.Certificate{Subject: pkix.Name{CommonName: "ca"}, IsCA: true,
+		BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}, nil, nil, t)
+	otherCACert, otherCAKey := createTestCertificate(&x509.Certificate{Subject: pkix.Name{CommonName: "other"}, IsCA: true,
+		BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}, nil, nil, t)
+
+	auth := &CertificateAuthenticate{}
+	auth.Start()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		code, orgID, identity := auth.Authenticate(request)
+		fmt.Fprintf(writer, "%d %s %s", code, orgID, identity)
+	}))
+	caCertPool := x509.NewCertPool()
+	caCertPool.AddCert(caCert)
+	server.TLS = &tls.Config{ClientCAs: caCertPool, ClientAuth: tls.VerifyClientCertIfGiven}
+	server.StartTLS()
+	defer server.Close()
+
+	edgeURI, _ := url.Parse("sync-service://myorg/edgenode/dev/dev1")
+	adminURI, _ := url.Parse("sync-service:///syncadmin/admin1")
+	otherURI, _ := url.Parse("spiffe://myorg/user/user1")
+
+	tests := []struct {
+		template *x509.Certificate
+		signedBy *x509.Certificate
+		expected string
+	}{
+		{&x509.Certificate{Subject: pkix.Name{CommonName: "dev1"}, URIs: []*url.URL{edgeURI}}, caCert,
+			fmt.Sprintf("%d myorg dev/dev1", AuthEdgeNode)},
+		{&x509.Certificate{Subject: pkix.Name{CommonName: "admin1"}, URIs: []*url.URL{adminURI}}, caCert,
+			fmt.Sprintf("%d  admin1", AuthSyncAdmin)},
+		{&x509.Certificate{Subject: pkix.Name{CommonName: "user1", Organization: []string{"myorg"},
+			OrganizationalUnit: []string{"User"}}, URIs: []*url.URL{otherURI}}, caCert, fmt.Sprintf("%d myorg user1", AuthUser)},
+		{&x509.Certificate{Subject: pkix.Name{CommonName: "myorg/1.0/srv", Organization: []string{"myorg"},
+			OrganizationalUnit: []string{"service"}}}, caCert, fmt.Sprintf("%d myorg myorg/1.0/srv", AuthService)},
+		{&x509.Certificate{Subject: pkix.Name{CommonName: "user1", Organization: []string{"myorg"}}}, caCert,
+			fmt.Sprintf("%d  ", AuthFailed)},
+		{&x509.Certificate{Subject: pkix.Name{CommonName: "user1", OrganizationalUnit: []string{"admin"}}}, caCert,
+			fmt.Sprintf("%d  ", AuthFailed)},
+		{&x509.Certificate{Subject: pkix.Name{CommonName: "user1", Organization: []string{"myorg"},
+			OrganizationalUnit: []string{"admin"}}}, otherCACert, fmt.Sprintf("%d  ", AuthFailed)},
+		{nil, nil, fmt.Sprintf("%d  ", AuthFailed)},
+	}
+
+	for index, test := range tests {
+		tlsConfig := &tls.Config{InsecureSkipVerify: true}
+		if test.template != nil {
+			signingKey := caKey
+			if test.signedBy == otherCACert {
+				signingKey = otherCAKey
+			}
+			test.template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+			cert, key := createTestCertificate(test.template, test.signedBy, signingKey, t)
+			tlsConfig.Certificates = []tls.Certificate{{Certificate: [][]byte{cert.Raw}, PrivateKey: key}}
+		}
+		client := http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		response, err := client.Get(server.URL)
+		if err != nil {
+			// The handshake fails if the certificate can't be verified
+			if test.signedBy != otherCACert {
+				t.Errorf("Request failed (test %d). Error: %s", index, err.Error())
+			}
+			continue
+		}
+		body := make([]byte, 100)
+		n, _ := response.Body.Read(body)
+		response.Body.Close()
+		if string(body[:n]) != test.expected {
+			t.Errorf("Authenticate returned %s instead of %s (test %d)", string(body[:n]), test.expected, index)
+		}
+	}
+
+	if key, secret := auth.KeyandSecretForURL("http://css:8080"); key != "" || secret != "" {
+		t.Errorf("KeyandSecretForURL returned credentials")
+	}
+}
+
+func createTestCertificate(template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey,
+	t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key. Error: %s", err.Error())
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent = template
+		parentKey = key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("Failed to create certificate. Error: %s", err.Error())
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate. Error: %s", err.Error())
+	}
+	return cert, key
+}
@@ -0,0 +1,277 @@
+package security
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-sync-service/core/signature"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+	"github.com/open-horizon/edge-utilities/logger/trace"
+)
+
+// JWTAuthenticate is an implementation of the Authenticate interface that authenticates requests
+// with JSON Web Tokens, for example the tokens issued by an OpenID Connect provider.
+//
+// The token is sent as a bearer token in the Authorization header, or as the password of basic authentication.
+// The signature of the token is verified with the public keys in the JWKS file JWTKeysFile, or with the public key
+// in the PEM file JWTIssuerKeyFile. RSA and ECDSA signatures are supported. Expired tokens are rejected, and if
+// JWTIssuer and JWTAudience are set, the iss and aud claims of the token must match them.
+//
+// The type, organization and identity of the user are taken from the claims JWTTypeClaim, JWTOrgClaim and
+// JWTIdentityClaim. The values of the type claim are mapped to user types by JWTTypes, and values that aren't
+// mapped are used as user types. The user types are admin, edgenode, user, syncadmin, and service. If the type
+// claim is a list, the first value that is a user type is used. The identity of an edge node is of the form
+// destType/destID and the identity of a service is of the form serviceOrg/version/serviceName.
+//
+// An ESS communicating with the CSS via HTTP sends the token in the file JWTTokenFile.
+type JWTAuthenticate struct {
+	keys       map[string]crypto.PublicKey
+	issuerKey  crypto.PublicKey
+	types      map[string]string
+	parserOpts []jwt.ParserOption
+}
+
+// The user name sent with the token when it is sent as the password of basic authentication
+const jwtBasicAuthUsername = "token"
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+// Start initializes the JWTAuthenticate struct
+func (auth *JWTAuthenticate) Start() {
+	auth.keys = make(map[string]crypto.PublicKey)
+	if common.Configuration.JWTKeysFile != "" {
+		keys, err := loadJSONWebKeys(common.Configuration.JWTKeysFile)
+		if err != nil {
+			if log.IsLogging(logger.ERROR) {
+				log.Error("Failed to load the JWT keys from %s. Error: %s\n", common.Configuration.JWTKeysFile, err)
+			}
+		} else {
+			auth.keys = keys
+		}
+	} else if common.Configuration.JWTIssuerKeyFile != "" {
+		key, err := ioutil.ReadFile(common.Configuration.JWTIssuerKeyFile)
+		if err == nil {
+			auth.issuerKey, err = signature.ParsePublicKey(string(key))
+		}
+		if err != nil && log.IsLogging(logger.ERROR) {
+			log.Error("Failed to load the JWT issuer key from %s. Error: %s\n", common.Configuration.JWTIssuerKeyFile, err)
+		}
+	}
+
+	auth.types, _ = common.ParseJWTTypes(common.Configuration.JWTTypes)
+
+	auth.parserOpts = []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithExpirationRequired(),
+	}
+	if common.Configuration.JWTIssuer != "" {
+		auth.parserOpts = append(auth.parserOpts, jwt.WithIssuer(common.Configuration.JWTIssuer))
+	}
+	if common.Configuration.JWTAudience != "" {
+		auth.parserOpts = append(auth.parserOpts, jwt.WithAudience(common.Configuration.JWTAudience))
+	}
+}
+
+// Authenticate  authenticates a particular HTTP request and indicates
+// whether it is an edge node, org admin, or plain user. Also returned is the
+// user's org and identitity. An edge node's identity is destType/destID. A
+// service's identity is serviceOrg/version/serviceName.
+func (auth *JWTAuthenticate) Authenticate(request *http.Request) (int, string, string) {
+	var tokenString string
+	authorization := request.Header.Get("Authorization")
+	if len(authorization) > 7 && strings.EqualFold(authorization[:7], "Bearer ") {
+		tokenString = strings.TrimSpace(authorization[7:])
+	} else if _, password, ok := request.BasicAuth(); ok {
+		tokenString = password
+	}
+	if tokenString == "" {
+		return AuthFailed, "", ""
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(tokenString, claims, auth.getKey, auth.parserOpts...); err != nil {
+		if trace.IsLogging(logger.DEBUG) {
+			trace.Debug("Failed to verify JWT. Error: %s\n", err)
+		}
+		return AuthFailed, "", ""
+	}
+
+	code := auth.claimUserTypeCode(getClaim(claims, common.Configuration.JWTTypeClaim))
+	orgID, _ := getClaim(claims, common.Configuration.JWTOrgClaim).(string)
+	identity, _ := getClaim(claims, common.Configuration.JWTIdentityClaim).(string)
+	if code == AuthFailed || identity == "" || (orgID == "" && code != AuthSyncAdmin) {
+		return AuthFailed, "", ""
+	}
+	return code, orgID, identity
+}
+
+// KeyandSecretForURL returns an app key and an app secret pair to be
+// used by the ESS when communicating with the specified URL.
+func (auth *JWTAuthenticate) KeyandSecretForURL(url string) (string, string) {
+	if !strings.HasPrefix(url, common.HTTPCSSURL) || common.Configuration.JWTTokenFile == "" {
+		return "", ""
+	}
+	token, err := ioutil.ReadFile(common.Configuration.JWTTokenFile)
+	if err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Failed to read the JWT token file %s. Error: %s\n", common.Configuration.JWTTokenFile, err)
+		}
+		return "", ""
+	}
+	return jwtBasicAuthUsername, strings.TrimSpace(string(token))
+}
+
+func (auth *JWTAuthenticate) getKey(token *jwt.Token) (interface{}, error) {
+	if auth.issuerKey != nil {
+		return auth.issuerKey, nil
+	}
+	keyID, _ := token.Header["kid"].(string)
+	if key, ok := auth.keys[keyID]; ok {
+		return key, nil
+	}
+	if keyID == "" && len(auth.keys) == 1 {
+		// A token without a key ID is accepted if there is a single key
+		for _, key := range auth.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown JWT key %s", keyID)
+}
+
+func (auth *JWTAuthenticate) claimUserTypeCode(claim interface{}) int {
+	var values []interface{}
+	if list, ok := claim.([]interface{}); ok {
+		values = list
+	} else {
+		values = []interface{}{claim}
+	}
+	for _, value := range values {
+		name, ok := value.(string)
+		if !ok {
+			continue
+		}
+		if userType, ok := auth.types[name]; ok {
+			name = userType
+		}
+		if code := userTypeCode(name); code != AuthFailed {
+			return code
+		}
+	}
+	return AuthFailed
+}
+
+// getClaim returns the value of a claim, the names of nested claims are separated with dots
+func getClaim(claims jwt.MapClaims, name string) interface{} {
+	var value interface{} = map[string]interface{}(claims)
+	for _, part := range strings.Split(name, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[part]
+	}
+	return value
+}
+
+func loadJSONWebKeys(fileName string) (map[string]crypto.PublicKey, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var keySet jsonWebKeySet
+	if err := json.Unmarshal(data, &keySet); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, webKey := range keySet.Keys {
+		if webKey.Use != "" && webKey.Use != "sig" {
+			continue
+		}
+		key, err := webKey.publicKey()
+		if err != nil {
+			if log.IsLogging(logger.WARNING) {
+				log.Warning("Ignoring the JWT key %s. Error: %s\n", webKey.KeyID, err)
+			}
+			continue
+		}
+		keys[webKey.KeyID] = key
+	}
+	return keys, nil
+}
+
+func (webKey *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch webKey.KeyType {
+	case "RSA":
+		n, err := decodeJSONWebKeyInt(webKey.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeJSONWebKeyInt(webKey.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("Invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch webKey.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("Unsupported curve %s", webKey.Curve)
+		}
+		x, err := decodeJSONWebKeyInt(webKey.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeJSONWebKeyInt(webKey.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("Invalid EC key, the point isn't on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("Unsupported key type %s", webKey.KeyType)
+	}
+}
+
+func decodeJSONWebKeyInt(value string) (*big.Int, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil || len(bytes) == 0 {
+		return nil, fmt.Errorf("Invalid key parameter %s", value)
+	}
+	return new(big.Int).SetBytes(bytes), nil
+}
@@ -0,0 +1,164 @@
+package security
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+func TestJWTAuthenticate(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	dir, err := ioutil.TempDir("", "jwt")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory. Error: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	encode := func(value *big.Int) string { return base64.RawURLEncoding.EncodeToString(value.Bytes()) }
+	keySet := jsonWebKeySet{Keys: []jsonWebKey{
+		{KeyType: "RSA", KeyID: "rsa1", Use: "sig", N: encode(rsaKey.N), E: encode(big.NewInt(int64(rsaKey.E)))},
+		{KeyType: "EC", KeyID: "ec1", Curve: "P-256", X: encode(ecKey.X), Y: encode(ecKey.Y)},
+		{KeyType: "RSA", KeyID: "enc1", Use: "enc", N: encode(otherKey.N), E: encode(big.NewInt(int64(otherKey.E)))},
+	}}
+	keysJSON, _ := json.Marshal(keySet)
+	if err := ioutil.WriteFile(dir+"/jwks.json", keysJSON, 0600); err != nil {
+		t.Fatalf("Failed to write JWKS file. Error: %s", err.Error())
+	}
+
+	common.Configuration.JWTKeysFile = dir + "/jwks.json"
+	common.Configuration.JWTIssuer = "https://issuer"
+	common.Configuration.JWTAudience = "sync-service"
+	common.Configuration.JWTTypeClaim = "realm_access.roles"
+	common.Configuration.JWTTypes = "org-admin:admin,device:edgenode"
+	defer func() {
+		common.Configuration.JWTKeysFile = ""
+		common.Configuration.JWTIssuerKeyFile = ""
+		common.Configuration.JWTIssuer = ""
+		common.Configuration.JWTAudience = ""
+		common.Configuration.JWTTypeClaim = "type"
+		common.Configuration.JWTTypes = ""
+	}()
+
+	auth := &JWTAuthenticate{}
+	auth.Start()
+
+	claims := func(roles []string, org string, sub string) jwt.MapClaims {
+		return jwt.MapClaims{"iss": "https://issuer", "aud": "sync-service", "exp": time.Now().Add(time.Hour).Unix(),
+			"realm_access": map[string]interface{}{"roles": roles}, "org": org, "sub": sub}
+	}
+	expired := claims([]string{"user"}, "myorg", "user1")
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	wrongIssuer := claims([]string{"user"}, "myorg", "user1")
+	wrongIssuer["iss"] = "https://other"
+	wrongAudience := claims([]string{"user"}, "myorg", "user1")
+	wrongAudience["aud"] = "other"
+	noExpiration := claims([]string{"user"}, "myorg", "user1")
+	delete(noExpiration, "exp")
+
+	tests := []struct {
+		method   jwt.SigningMethod
+		keyID    string
+		key      interface{}
+		claims   jwt.MapClaims
+		basic    bool
+		code     int
+		orgID    string
+		identity string
+	}{
+		{jwt.SigningMethodRS256, "rsa1", rsaKey, claims([]string{"offline_access", "org-admin"}, "myorg", "admin1"), false, AuthAdmin, "myorg", "admin1"},
+		{jwt.SigningMethodES256, "ec1", ecKey, claims([]string{"device"}, "myorg", "dev/dev1"), false, AuthEdgeNode, "myorg", "dev/dev1"},
+		{jwt.SigningMethodRS256, "rsa1", rsaKey, claims([]string{"SyncAdmin"}, "", "admin"), true, AuthSyncAdmin, "", "admin"},
+		{jwt.SigningMethodPS256, "rsa1", rsaKey, claims([]string{"service"}, "myorg", "org/1.0/srv"), false, AuthService, "myorg", "org/1.0/srv"},
+		{jwt.SigningMethodRS256, "rsa1", rsaKey, claims([]string{"offline_access"}, "myorg", "user1"), false, AuthFailed, "", ""},
+		{jwt.SigningMethodRS256, "rsa1", rsaKey, claims([]string{"user"}, "", "user1"), false, AuthFailed, "", ""},
+		{jwt.SigningMethodRS256, "rsa1", otherKey, claims([]string{"user"}, "myorg", "user1"), false, AuthFailed, "", ""},
+		{jwt.SigningMethodRS256, "enc1", otherKey, claims([]string{"user"}, "myorg", "user1"), false, AuthFailed, "", ""},
+		{jwt.SigningMethodRS256, "", rsaKey, claims([]string{"user"}, "myorg", "user1"), false, AuthFailed, "", ""},
+		{jwt.SigningMethodHS256, "rsa1", []byte("secret"), claims([]string{"user"}, "myorg", "user1"), false, AuthFailed, "", ""},
+		{jwt.SigningMethodRS256, "rsa1", rsaKey, expired, false, AuthFailed, "", ""},
+		{jwt.SigningMethodRS256, "rsa1", rsaKey, wrongIssuer, false, AuthFailed, "", ""},
+		{jwt.SigningMethodRS256, "rsa1", rsaKey, wrongAudience, false, AuthFailed, "", ""},
+		{jwt.SigningMethodRS256, "rsa1", rsaKey, noExpiration, false, AuthFailed, "", ""},
+	}
+
+	for index, test := range tests {
+		token := jwt.NewWithClaims(test.method, test.claims)
+		if test.keyID != "" {
+			token.Header["kid"] = test.keyID
+		}
+		tokenString, err := token.SignedString(test.key)
+		if err != nil {
+			t.Errorf("Failed to sign token (test %d). Error: %s", index, err.Error())
+			continue
+		}
+		request, _ := http.NewRequest(http.MethodGet, "/api/v1/objects/myorg/type1", nil)
+		if test.basic {
+			request.SetBasicAuth(jwtBasicAuthUsername, tokenString)
+		} else {
+			request.Header.Set("Authorization", "Bearer "+tokenString)
+		}
+		code, orgID, identity := auth.Authenticate(request)
+		if code != test.code || orgID != test.orgID || identity != test.identity {
+			t.Errorf("Authenticate returned (%d, %s, %s) instead of (%d, %s, %s) (test %d)", code, orgID, identity,
+				test.code, test.orgID, test.identity, index)
+		}
+	}
+
+	request, _ := http.NewRequest(http.MethodGet, "/api/v1/objects/myorg/type1", nil)
+	if code, _, _ := auth.Authenticate(request); code != AuthFailed {
+		t.Errorf("A request without a token was authenticated")
+	}
+
+	// Verify tokens with the issuer's key, with the default claims
+	der, _ := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	if err := ioutil.WriteFile(dir+"/issuer.pem", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600); err != nil {
+		t.Fatalf("Failed to write issuer key file. Error: %s", err.Error())
+	}
+	common.Configuration.JWTKeysFile = ""
+	common.Configuration.JWTIssuerKeyFile = dir + "/issuer.pem"
+	common.Configuration.JWTTypeClaim = "type"
+	auth = &JWTAuthenticate{}
+	auth.Start()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"iss": "https://issuer", "aud": "sync-service",
+		"exp": time.Now().Add(time.Hour).Unix(), "type": "user", "org": "myorg", "sub": "user1"})
+	tokenString, _ := token.SignedString(ecKey)
+	request.Header.Set("Authorization", "Bearer "+tokenString)
+	if code, orgID, identity := auth.Authenticate(request); code != AuthUser || orgID != "myorg" || identity != "user1" {
+		t.Errorf("Authenticate returned (%d, %s, %s) for a token verified with the issuer's key", code, orgID, identity)
+	}
+
+	// The ESS sends the token in the token file to the CSS
+	if err := ioutil.WriteFile(dir+"/token", []byte(tokenString+"\n"), 0600); err != nil {
+		t.Fatalf("Failed to write token file. Error: %s", err.Error())
+	}
+	common.Configuration.JWTTokenFile = dir + "/token"
+	common.HTTPCSSURL = "http://css:8080"
+	defer func() {
+		common.Configuration.JWTTokenFile = ""
+		common.HTTPCSSURL = ""
+	}()
+	if key, secret := auth.KeyandSecretForURL(common.HTTPCSSURL + "/spi/v1"); key != jwtBasicAuthUsername || secret != tokenString {
+		t.Errorf("KeyandSecretForURL returned (%s, %s) instead of the token", key, secret)
+	}
+	if key, secret := auth.KeyandSecretForURL("http://other"); key != "" || secret != "" {
+		t.Errorf("KeyandSecretForURL returned the token for a URL other than the CSS")
+	}
+}
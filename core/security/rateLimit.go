@@ -0,0 +1,187 @@
+package security
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/trace"
+)
+
+// tokenBucket allows requests at a constant rate, with bursts of up to capacity requests
+type tokenBucket struct {
+	rate     float64 // tokens per second
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+var rateLimitByRole map[string]int
+var rateLimitByOrg map[string]int
+var rateLimitBuckets map[string]*tokenBucket
+var rateLimitLock sync.Mutex
+
+var tooManyRequestsBytes = []byte("Too Many Requests")
+
+func newTokenBucket(ratePerMinute int, now time.Time) *tokenBucket {
+	rate := float64(ratePerMinute) / 60
+	burst := common.Configuration.RateLimitBurst
+	if burst <= 0 {
+		burst = 1
+	}
+	capacity := math.Max(1, rate*float64(burst))
+	return &tokenBucket{rate: rate, capacity: capacity, tokens: capacity, last: now}
+}
+
+// take takes a token from the bucket. If the bucket is empty, it returns the time until a token is available.
+func (bucket *tokenBucket) take(now time.Time) time.Duration {
+	bucket.refill(now)
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return 0
+	}
+	return time.Duration((1 - bucket.tokens) / bucket.rate * float64(time.Second))
+}
+
+func (bucket *tokenBucket) refill(now time.Time) {
+	if now.After(bucket.last) {
+		bucket.tokens = math.Min(bucket.capacity, bucket.tokens+now.Sub(bucket.last).Seconds()*bucket.rate)
+		bucket.last = now
+	}
+}
+
+func startRateLimiting() {
+	rateLimitLock.Lock()
+	defer rateLimitLock.Unlock()
+
+	rateLimitBuckets = make(map[string]*tokenBucket)
+	rateLimitByRole = nil
+	rateLimitByOrg = nil
+	if common.Configuration.NodeType != common.CSS {
+		return
+	}
+	// The limits were validated with the rest of the configuration
+	rateLimitByRole, _ = common.ParseRateLimits(common.Configuration.RateLimitByRole, true)
+	rateLimitByOrg, _ = common.ParseRateLimits(common.Configuration.RateLimitByOrg, false)
+}
+
+// takeToken takes a token from the bucket of the key, creating the bucket if needed.
+// Must be called with rateLimitLock held.
+func takeToken(key string, ratePerMinute int, now time.Time) time.Duration {
+	bucket, ok := rateLimitBuckets[key]
+	if !ok {
+		bucket = newTokenBucket(ratePerMinute, now)
+		rateLimitBuckets[key] = bucket
+	}
+	return bucket.take(now)
+}
+
+// checkAPIRateLimits checks whether a call of a user is within the limits of the user's role and organization.
+// It returns the time the user should wait before calling again, or zero if the call is allowed.
+func checkAPIRateLimits(code int, orgID string, identity string) time.Duration {
+	rateLimitLock.Lock()
+	defer rateLimitLock.Unlock()
+
+	if len(rateLimitByRole) == 0 && len(rateLimitByOrg) == 0 {
+		return 0
+	}
+	now := time.Now()
+
+	var userBucket *tokenBucket
+	role := userTypeName(code)
+	if rate, ok := rateLimitByRole[role]; ok {
+		key := "user:" + role + ":" + orgID + "/" + identity
+		if wait := takeToken(key, rate, now); wait > 0 {
+			return wait
+		}
+		userBucket = rateLimitBuckets[key]
+	}
+
+	rate, ok := rateLimitByOrg[orgID]
+	if !ok {
+		rate, ok = rateLimitByOrg["*"]
+	}
+	if ok && orgID != "" {
+		if wait := takeToken("org:"+orgID, rate, now); wait > 0 {
+			if userBucket != nil {
+				// The call isn't made, return the user's token
+				userBucket.tokens++
+			}
+			return wait
+		}
+	}
+	return 0
+}
+
+// CheckESSPollingRateLimit checks whether a poll for updates of an ESS is within the polling limit.
+// The polls of an ESS have their own budget, separate from its other calls.
+// It returns the time the ESS should wait before polling again, or zero if the poll is allowed.
+func CheckESSPollingRateLimit(orgID string, destType string, destID string) time.Duration {
+	if common.Configuration.NodeType != common.CSS || common.Configuration.RateLimitESSPolling <= 0 {
+		return 0
+	}
+	rateLimitLock.Lock()
+	defer rateLimitLock.Unlock()
+
+	if rateLimitBuckets == nil {
+		return 0
+	}
+	return takeToken("poll:"+orgID+"/"+destType+"/"+destID, common.Configuration.RateLimitESSPolling, time.Now())
+}
+
+// RateLimited wraps the handler of API calls, rejecting the calls of users that exceed
+// the rate limits of their role or organization
+func RateLimited(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if common.Configuration.NodeType == common.CSS && rateLimitsConfigured() {
+			// Calls that fail to authenticate are rejected by the handler
+			if code, orgID, identity := Authenticate(request); code != AuthFailed {
+				if wait := checkAPIRateLimits(code, orgID, identity); wait > 0 {
+					if trace.IsLogging(logger.DEBUG) {
+						trace.Debug("Rate limit exceeded by %s/%s, retry after %s\n", orgID, identity, wait)
+					}
+					SendTooManyRequests(writer, wait)
+					return
+				}
+			}
+		}
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+func rateLimitsConfigured() bool {
+	rateLimitLock.Lock()
+	defer rateLimitLock.Unlock()
+	return len(rateLimitByRole) != 0 || len(rateLimitByOrg) != 0
+}
+
+// SendTooManyRequests rejects a call that exceeds a rate limit with the status code 429 (Too Many Requests),
+// and a Retry-After header with the number of seconds to wait before calling again
+func SendTooManyRequests(writer http.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	writer.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writer.WriteHeader(http.StatusTooManyRequests)
+	writer.Write(tooManyRequestsBytes)
+}
+
+// flushRateLimitBuckets removes the buckets that are full, they are recreated full when needed
+func flushRateLimitBuckets() {
+	now := time.Now()
+
+	rateLimitLock.Lock()
+	defer rateLimitLock.Unlock()
+
+	for key, bucket := range rateLimitBuckets {
+		bucket.refill(now)
+		if bucket.tokens >= bucket.capacity {
+			delete(rateLimitBuckets, key)
+		}
+	}
+}
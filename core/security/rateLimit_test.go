@@ -0,0 +1,102 @@
+package security
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+func TestTokenBucket(t *testing.T) {
+	common.Configuration.RateLimitBurst = 2
+	now := time.Now()
+
+	// 60 calls per minute with bursts of 2 seconds
+	bucket := newTokenBucket(60, now)
+	for i := 0; i < 2; i++ {
+		if wait := bucket.take(now); wait != 0 {
+			t.Errorf("Call %d was rejected", i)
+		}
+	}
+	if wait := bucket.take(now); wait != time.Second {
+		t.Errorf("The wait time is %s instead of 1s", wait)
+	}
+	if wait := bucket.take(now.Add(500 * time.Millisecond)); wait != 500*time.Millisecond {
+		t.Errorf("The wait time is %s instead of 500ms", wait)
+	}
+	if wait := bucket.take(now.Add(time.Second)); wait != 0 {
+		t.Errorf("The call after the wait time was rejected")
+	}
+	if wait := bucket.take(now.Add(time.Hour)); wait != 0 || bucket.tokens != bucket.capacity-1 {
+		t.Errorf("The bucket wasn't refilled up to its capacity")
+	}
+}
+
+func TestRateLimited(t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	common.Configuration.RateLimitByRole = "user:60,admin:600"
+	common.Configuration.RateLimitByOrg = "myorg2:60"
+	common.Configuration.RateLimitESSPolling = 60
+	common.Configuration.RateLimitBurst = 2
+	defer func() {
+		common.Configuration.RateLimitByRole = ""
+		common.Configuration.RateLimitByOrg = ""
+		common.Configuration.RateLimitESSPolling = 0
+		startRateLimiting()
+	}()
+
+	SetAuthentication(&TestAuthenticate{})
+	Start()
+	defer Stop()
+
+	handler := RateLimited(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		appKey   string
+		expected int
+	}{
+		{"testerUser@myorg1", http.StatusOK},
+		{"testerUser@myorg1", http.StatusOK},
+		{"testerUser@myorg1", http.StatusTooManyRequests}, // the user's limit
+		{"testerAdmin@myorg1", http.StatusOK},
+		{"testerService1@myorg1", http.StatusOK}, // no limit for services
+		{"testerService1@myorg1", http.StatusOK},
+		{"testerService1@myorg1", http.StatusOK},
+		{"testerAdmin@myorg2", http.StatusOK},
+		{"testerService1@myorg2", http.StatusOK},
+		{"testerService1@myorg2", http.StatusTooManyRequests}, // the organization's limit
+		{"testerAdmin@myorg2", http.StatusTooManyRequests},
+		{"unknown@myorg1", http.StatusOK}, // rejected by the handler
+		{"unknown@myorg1", http.StatusOK},
+		{"unknown@myorg1", http.StatusOK},
+	}
+
+	for index, test := range tests {
+		request, _ := http.NewRequest(http.MethodGet, "/api/v1/objects", nil)
+		request.SetBasicAuth(test.appKey, "")
+		writer := httptest.NewRecorder()
+		handler.ServeHTTP(writer, request)
+		if writer.Code != test.expected {
+			t.Errorf("Returned code %d instead of %d (test %d)", writer.Code, test.expected, index)
+		} else if writer.Code == http.StatusTooManyRequests && writer.Header().Get("Retry-After") != "1" {
+			t.Errorf("Retry-After is %s instead of 1 (test %d)", writer.Header().Get("Retry-After"), index)
+		}
+	}
+
+	// The polls of an ESS have their own budget
+	for i := 0; i < 2; i++ {
+		if wait := CheckESSPollingRateLimit("myorg1", "dev", "dev1"); wait != 0 {
+			t.Errorf("Poll %d was rejected", i)
+		}
+	}
+	if wait := CheckESSPollingRateLimit("myorg1", "dev", "dev1"); wait == 0 {
+		t.Errorf("Poll exceeding the limit was allowed")
+	}
+	if wait := CheckESSPollingRateLimit("myorg1", "dev", "dev2"); wait != 0 {
+		t.Errorf("Poll of another ESS was rejected")
+	}
+}
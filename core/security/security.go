@@ -1,6 +1,7 @@
 package security
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
@@ -30,6 +31,15 @@ type authenticationCacheElement struct {
 	expiration time.Time
 }
 
+// authenticationContextKey is the key of the result of the authentication of a request in the request's context
+type authenticationContextKey struct{}
+
+type authenticationResult struct {
+	code     int
+	orgID    string
+	identity string
+}
+
 type destinationACLCacheElement struct {
 	users      []string
 	expiration time.Time
@@ -66,6 +76,7 @@ func Start() {
 
 	authenticationCache = make(map[string]authenticationCacheElement)
 	destinationACLCache = make(map[string]destinationACLCacheElement)
+	startRateLimiting()
 
 	cacheFlushStopChannel = make(chan int, 1)
 	cacheFlushTicker = time.NewTicker(2 * cacheDuration)
@@ -77,6 +88,7 @@ func Start() {
 			case <-cacheFlushTicker.C:
 				flushAuthenticationCache()
 				flushDestinationACLCache()
+				flushRateLimitBuckets()
 
 			case <-cacheFlushStopChannel:
 				keepRunning = false
@@ -105,7 +117,26 @@ func SetAuthentication(auth Authentication) {
 // whether it is an edge node, org admin, or plain user. Also returned is the
 // user's org and identitity. An edge node's identity is destType/destID. A
 // service's identity is serviceOrg/arch/version/serviceName.
+// A request returned by WithAuthentication isn't authenticated again, the result in its context is returned.
 func Authenticate(request *http.Request) (int, string, string) {
+	if result, ok := request.Context().Value(authenticationContextKey{}).(authenticationResult); ok {
+		return result.code, result.orgID, result.identity
+	}
+	return authenticate(request)
+}
+
+// WithAuthentication authenticates a request, and returns the request with the result of the authentication in its context,
+// so that the handlers of the request get the result without authenticating the request again
+func WithAuthentication(request *http.Request) *http.Request {
+	if _, ok := request.Context().Value(authenticationContextKey{}).(authenticationResult); ok {
+		return request
+	}
+	code, orgID, identity := authenticate(request)
+	return request.WithContext(context.WithValue(request.Context(), authenticationContextKey{},
+		authenticationResult{code: code, orgID: orgID, identity: identity}))
+}
+
+func authenticate(request *http.Request) (int, string, string) {
 	appKey, appSecret, ok := request.BasicAuth()
 	if !ok {
 		return AuthFailed, "", ""
@@ -229,8 +260,11 @@ func KeyandSecretForURL(url string) (string, string) {
 
 // AddIdentityToSPIRequest Adds identity related stuff to SPI requests made by an ESS
 func AddIdentityToSPIRequest(request *http.Request, requestURL string) {
-	username, password := authenticator.KeyandSecretForURL(requestURL)
-	request.SetBasicAuth(username, password)
+	if common.Configuration.HTTPCSSClientCertificate == "" {
+		// An ESS with a client certificate authenticates with the certificate
+		username, password := authenticator.KeyandSecretForURL(requestURL)
+		request.SetBasicAuth(username, password)
+	}
 
 	request.Header.Add(SPIRequestIdentityHeader, spiRequestIdentity)
 }
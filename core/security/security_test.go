@@ -1,6 +1,7 @@
 package security
 
 import (
+	"net/http"
 	"sort"
 	"testing"
 
@@ -33,3 +34,22 @@ func TestGetDestinationTypes(t *testing.T) {
 		}
 	}
 }
+
+func TestWithAuthentication(t *testing.T) {
+	SetAuthentication(&TestAuthenticate{})
+	Start()
+	defer Stop()
+
+	request, _ := http.NewRequest(http.MethodGet, "/api/v1/objects", nil)
+	request.SetBasicAuth("testerAdmin@myorg1", "")
+	request = WithAuthentication(request)
+
+	// The result of the authentication is taken from the request's context
+	request.SetBasicAuth("testerUser@myorg2", "")
+	if code, orgID, identity := Authenticate(request); code != AuthAdmin || orgID != "myorg1" || identity != "testerAdmin" {
+		t.Errorf("Authenticate returned %d, %s, %s instead of the result in the request's context", code, orgID, identity)
+	}
+	if authenticated := WithAuthentication(request); authenticated != request {
+		t.Errorf("WithAuthentication authenticated an authenticated request again")
+	}
+}
@@ -0,0 +1,135 @@
+package signature
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strings"
+)
+
+// Objects are signed by signing the SHA-256 digest of their data.
+// RSA signatures (PKCS #1 v1.5 or PSS) and ECDSA signatures (ASN.1 encoded) are supported.
+
+// Error is the error used in the signature package
+type Error struct {
+	message string
+}
+
+func (e *Error) Error() string {
+	return e.message
+}
+
+// DecodeSignature decodes a base64 encoded signature
+func DecodeSignature(signature string) ([]byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || len(decoded) == 0 {
+		return nil, &Error{"Invalid signature, the signature must be base64 encoded"}
+	}
+	return decoded, nil
+}
+
+// ParsePublicKey parses a PEM encoded or a base64 encoded DER (PKIX) public key
+func ParsePublicKey(key string) (crypto.PublicKey, error) {
+	var der []byte
+	if block, _ := pem.Decode([]byte(key)); block != nil {
+		der = block.Bytes
+	} else {
+		var err error
+		if der, err = base64.StdEncoding.DecodeString(strings.TrimSpace(key)); err != nil {
+			return nil, &Error{"Invalid public key, the key must be PEM or base64 encoded"}
+		}
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, &Error{"Invalid public key. Error: " + err.Error()}
+	}
+	switch publicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return publicKey, nil
+	default:
+		return nil, &Error{"Unsupported public key type, only RSA and ECDSA keys are supported"}
+	}
+}
+
+// LoadTrustedKey reads the trusted public key with the given ID from the keyID.pem file in the directory
+func LoadTrustedKey(dir string, keyID string) (crypto.PublicKey, error) {
+	if keyID == "" || keyID != filepath.Base(keyID) || strings.HasPrefix(keyID, ".") {
+		return nil, &Error{"Invalid signing key ID " + keyID}
+	}
+	key, err := ioutil.ReadFile(filepath.Join(dir, keyID+".pem"))
+	if err != nil {
+		return nil, &Error{"Failed to read the signing key " + keyID + ". Error: " + err.Error()}
+	}
+	return ParsePublicKey(string(key))
+}
+
+// FindTrustedKey returns the trusted public key, read from a .pem file in the directory, that is the same key
+// as the given PEM encoded or base64 encoded DER (PKIX) public key
+func FindTrustedKey(dir string, key string) (crypto.PublicKey, error) {
+	publicKey, err := ParsePublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, &Error{"Invalid public key. Error: " + err.Error()}
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, &Error{"Failed to list the signing keys. Error: " + err.Error()}
+	}
+	for _, file := range files {
+		keyID := strings.TrimSuffix(filepath.Base(file), ".pem")
+		trustedKey, err := LoadTrustedKey(dir, keyID)
+		if err != nil {
+			continue
+		}
+		if trustedDER, err := x509.MarshalPKIXPublicKey(trustedKey); err == nil && bytes.Equal(trustedDER, der) {
+			return trustedKey, nil
+		}
+	}
+	return nil, &Error{"The public key is not a trusted signing key"}
+}
+
+// Digest returns the SHA-256 digest of the data
+func Digest(reader io.Reader) ([]byte, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, reader); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+// Verify verifies the signature of the SHA-256 digest with the public key
+func Verify(publicKey crypto.PublicKey, digest []byte, signature []byte) error {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, signature) == nil {
+			return nil
+		}
+		if rsa.VerifyPSS(key, crypto.SHA256, digest, signature, nil) == nil {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		var ecdsaSignature struct{ R, S *big.Int }
+		if rest, err := asn1.Unmarshal(signature, &ecdsaSignature); err == nil && len(rest) == 0 &&
+			ecdsaSignature.R != nil && ecdsaSignature.S != nil &&
+			ecdsa.Verify(key, digest, ecdsaSignature.R, ecdsaSignature.S) {
+			return nil
+		}
+	default:
+		return &Error{"Unsupported public key type"}
+	}
+	return &Error{"Invalid signature"}
+}
@@ -0,0 +1,126 @@
+package signature
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key. Error: %s", err.Error())
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ECDSA key. Error: %s", err.Error())
+	}
+
+	data := []byte("the data of the object")
+	digest := sha256.Sum256(data)
+
+	pkcs1Signature, _ := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+	pssSignature, _ := rsa.SignPSS(rand.Reader, rsaKey, crypto.SHA256, digest[:], nil)
+	ecdsaSignature, _ := ecdsaKey.Sign(rand.Reader, digest[:], crypto.SHA256)
+
+	tests := []struct {
+		name      string
+		key       crypto.PublicKey
+		signature []byte
+		valid     bool
+	}{
+		{"RSA PKCS #1 v1.5", &rsaKey.PublicKey, pkcs1Signature, true},
+		{"RSA PSS", &rsaKey.PublicKey, pssSignature, true},
+		{"ECDSA", &ecdsaKey.PublicKey, ecdsaSignature, true},
+		{"RSA with ECDSA signature", &rsaKey.PublicKey, ecdsaSignature, false},
+		{"ECDSA with RSA signature", &ecdsaKey.PublicKey, pkcs1Signature, false},
+	}
+
+	for _, test := range tests {
+		// Encode and parse the key as done with keys in objects' meta data
+		der, _ := x509.MarshalPKIXPublicKey(test.key)
+		for _, encodedKey := range []string{
+			base64.StdEncoding.EncodeToString(der),
+			string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+		} {
+			key, err := ParsePublicKey(encodedKey)
+			if err != nil {
+				t.Errorf("Failed to parse the public key (%s). Error: %s", test.name, err.Error())
+				continue
+			}
+			signature, err := DecodeSignature(base64.StdEncoding.EncodeToString(test.signature))
+			if err != nil {
+				t.Errorf("Failed to decode the signature (%s). Error: %s", test.name, err.Error())
+				continue
+			}
+			dataDigest, _ := Digest(bytes.NewReader(data))
+			err = Verify(key, dataDigest, signature)
+			if test.valid && err != nil {
+				t.Errorf("Failed to verify a valid signature (%s). Error: %s", test.name, err.Error())
+			} else if !test.valid && err == nil {
+				t.Errorf("Verified an invalid signature (%s)", test.name)
+			}
+
+			modifiedDigest, _ := Digest(bytes.NewReader([]byte("modified data")))
+			if Verify(key, modifiedDigest, signature) == nil {
+				t.Errorf("Verified the signature of modified data (%s)", test.name)
+			}
+		}
+	}
+
+	if _, err := ParsePublicKey("not a key"); err == nil {
+		t.Errorf("ParsePublicKey didn't fail for an invalid key")
+	}
+	if _, err := DecodeSignature("not base64!"); err == nil {
+		t.Errorf("DecodeSignature didn't fail for an invalid signature")
+	}
+}
+
+func TestLoadTrustedKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatalf("Failed to create the keys directory. Error: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err := ioutil.WriteFile(filepath.Join(dir, "key1.pem"),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600); err != nil {
+		t.Fatalf("Failed to write the key file. Error: %s", err.Error())
+	}
+
+	if trustedKey, err := LoadTrustedKey(dir, "key1"); err != nil {
+		t.Errorf("Failed to load the trusted key. Error: %s", err.Error())
+	} else if trustedKey.(*ecdsa.PublicKey).X.Cmp(key.PublicKey.X) != 0 {
+		t.Errorf("Loaded the wrong key")
+	}
+
+	for _, keyID := range []string{"key2", "", "../key1", ".."} {
+		if _, err := LoadTrustedKey(dir, keyID); err == nil {
+			t.Errorf("LoadTrustedKey didn't fail for the key ID %s", keyID)
+		}
+	}
+
+	if trustedKey, err := FindTrustedKey(dir, base64.StdEncoding.EncodeToString(der)); err != nil {
+		t.Errorf("Failed to find the trusted key. Error: %s", err.Error())
+	} else if trustedKey.(*ecdsa.PublicKey).X.Cmp(key.PublicKey.X) != 0 {
+		t.Errorf("Found the wrong key")
+	}
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherDER, _ := x509.MarshalPKIXPublicKey(&otherKey.PublicKey)
+	if _, err := FindTrustedKey(dir, base64.StdEncoding.EncodeToString(otherDER)); err == nil {
+		t.Errorf("FindTrustedKey returned a key that isn't trusted")
+	}
+}
@@ -2,16 +2,17 @@ package storage
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"strings"
 	"time"
 
 	bolt "github.com/etcd-io/bbolt"
 	"github.com/open-horizon/edge-sync-service/common"
-	"github.com/open-horizon/edge-sync-service/core/dataURI"
 	"github.com/open-horizon/edge-utilities/logger"
 	"github.com/open-horizon/edge-utilities/logger/log"
 	"github.com/open-horizon/edge-utilities/logger/trace"
@@ -19,8 +20,14 @@ import (
 
 const timebaseBucketName = "syncTimebase"
 
+// labelsBucketName is the name of the bucket of the index of the objects' labels
+const labelsBucketName = "syncObjectLabels"
+
 // BoltStorage is a Bolt based store
 type BoltStorage struct {
+	// DataStore, if set, keeps the objects' data instead of the local files
+	DataStore DataStore
+
 	db            *bolt.DB
 	timebase      int64
 	lockChannel   chan int
@@ -38,6 +45,11 @@ type boltObject struct {
 	Destinations       []common.StoreDestinationStatus `json:"destinations"`
 }
 
+type boltObjectVersion struct {
+	Version  common.ObjectVersion `json:"version"`
+	DataPath string               `json:"data-path"`
+}
+
 type boltDestination struct {
 	Destination  common.Destination `json:"destination"`
 	LastPingTime time.Time          `json:"last-ping-time"`
@@ -59,12 +71,20 @@ type boltACL struct {
 var (
 	objectsBucket         []byte
 	webhooksBucket        []byte
+	webhookSecretsBucket  []byte
+	webhookEventsBucket   []byte
+	deliveriesBucket      []byte
 	notificationsBucket   []byte
 	timebaseBucket        []byte
 	destinationsBucket    []byte
+	destGroupsBucket      []byte
 	messagingGroupsBucket []byte
 	organizationsBucket   []byte
 	aclBucket             []byte
+	auditBucket           []byte
+	labelsBucket          []byte
+	rolloutsBucket        []byte
+	versionsBucket        []byte
 )
 
 // Init initializes the Bolt store
@@ -90,12 +110,20 @@ func (store *BoltStorage) Init() common.SyncServiceError {
 
 	objectsBucket = []byte(objects)
 	webhooksBucket = []byte(webhooks)
+	webhookSecretsBucket = []byte(webhookSecrets)
+	webhookEventsBucket = []byte(webhookEvents)
+	deliveriesBucket = []byte(deliveries)
 	notificationsBucket = []byte(notifications)
 	timebaseBucket = []byte(timebaseBucketName)
 	destinationsBucket = []byte(destinations)
+	destGroupsBucket = []byte(destinationGroups)
 	messagingGroupsBucket = []byte(messagingGroups)
 	organizationsBucket = []byte(organizations)
 	aclBucket = []byte(acls)
+	auditBucket = []byte(auditLog)
+	labelsBucket = []byte(labelsBucketName)
+	rolloutsBucket = []byte(rollouts)
+	versionsBucket = []byte(objectVersions)
 
 	err = store.db.Update(func(tx *bolt.Tx) error {
 		_, err = tx.CreateBucketIfNotExists(objectsBucket)
@@ -106,6 +134,34 @@ func (store *BoltStorage) Init() common.SyncServiceError {
 		if err != nil {
 			return err
 		}
+		_, err = tx.CreateBucketIfNotExists(webhookSecretsBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(webhookEventsBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(deliveriesBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(auditBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(rolloutsBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(versionsBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(destGroupsBucket)
+		if err != nil {
+			return err
+		}
 		_, err = tx.CreateBucketIfNotExists(notificationsBucket)
 		if err != nil {
 			return err
@@ -126,6 +182,10 @@ func (store *BoltStorage) Init() common.SyncServiceError {
 		if err != nil {
 			return err
 		}
+		_, err = tx.CreateBucketIfNotExists(labelsBucket)
+		if err != nil {
+			return err
+		}
 		b, err := tx.CreateBucketIfNotExists(timebaseBucket)
 		if err != nil {
 			return err
@@ -160,6 +220,9 @@ func (store *BoltStorage) Init() common.SyncServiceError {
 	}
 	err = os.MkdirAll(path, 0750)
 	store.localDataPath = "file://" + path
+	if err == nil && store.DataStore != nil {
+		err = store.DataStore.Init()
+	}
 	if err == nil {
 		common.HealthStatus.ReconnectedToDatabase()
 	}
@@ -263,12 +326,12 @@ func (store *BoltStorage) StoreObject(metaData common.MetaData, data []byte, sta
 
 	var dataPath string
 	if !metaData.NoData && data != nil {
-		dataPath = createDataPathFromMeta(store.localDataPath, metaData)
-		if _, err := dataURI.StoreData(dataPath, bytes.NewReader(data), uint32(len(data))); err != nil {
+		dataPath = store.createDataPathFromMeta(metaData)
+		if _, err := store.storeData(dataPath, bytes.NewReader(data), uint32(len(data))); err != nil {
 			return nil, err
 		}
 	} else if !metaData.MetaOnly {
-		if err := dataURI.DeleteStoredData(createDataPathFromMeta(store.localDataPath, metaData)); err != nil {
+		if err := store.deleteStoredData(store.createDataPathFromMeta(metaData)); err != nil {
 			return nil, err
 		}
 	}
@@ -295,6 +358,9 @@ func (store *BoltStorage) StoreObject(metaData common.MetaData, data []byte, sta
 		}
 		id := getObjectCollectionID(metaData)
 		err = store.db.Update(func(tx *bolt.Tx) error {
+			if err := updateLabelsIndex(tx, []byte(id), nil, &newObject.Meta); err != nil {
+				return err
+			}
 			err = tx.Bucket(objectsBucket).Put([]byte(id), []byte(encoded))
 			return err
 		})
@@ -308,8 +374,8 @@ func (store *BoltStorage) StoreObject(metaData common.MetaData, data []byte, sta
 // Return false and no error, if the object doesn't exist
 func (store *BoltStorage) StoreObjectData(orgID string, objectType string, objectID string, dataReader io.Reader) (bool, common.SyncServiceError) {
 
-	dataPath := createDataPath(store.localDataPath, orgID, objectType, objectID)
-	written, err := dataURI.StoreData(dataPath, dataReader, 0)
+	dataPath := store.createDataPath(orgID, objectType, objectID)
+	written, err := store.storeData(dataPath, dataReader, 0)
 	if err != nil {
 		return false, err
 	}
@@ -361,7 +427,7 @@ func (store *BoltStorage) RetrieveObjectData(orgID string, objectType string, ob
 	function := func(object boltObject) common.SyncServiceError {
 		var err error
 		if object.DataPath != "" {
-			dataReader, err = dataURI.GetData(object.DataPath)
+			dataReader, err = store.getData(object.DataPath)
 			return err
 		}
 		return nil
@@ -411,20 +477,20 @@ func (store *BoltStorage) RetrieveObjectStatus(orgID string, objectType string,
 
 // RetrieveUpdatedObjects returns the list of all the edge updated objects that are not marked as consumed
 // If received is true, return objects marked as received
-func (store *BoltStorage) RetrieveUpdatedObjects(orgID string, objectType string, received bool) ([]common.MetaData, common.SyncServiceError) {
-	result := make([]common.MetaData, 0)
-	function := func(object boltObject) {
-		if orgID == object.Meta.DestOrgID && objectType == object.Meta.ObjectType &&
+func (store *BoltStorage) RetrieveUpdatedObjects(orgID string, objectType string, received bool, filter common.ObjectsFilter) ([]common.MetaData, common.SyncServiceError) {
+	function := func(object boltObject) bool {
+		return orgID == object.Meta.DestOrgID && objectType == object.Meta.ObjectType &&
 			(object.Status == common.CompletelyReceived || object.Status == common.ObjDeleted ||
-				(object.Status == common.ObjReceived && received)) {
-			result = append(result, object.Meta)
-		}
+				(object.Status == common.ObjReceived && received))
 	}
-	if err := store.retrieveObjectsHelper(function); err != nil {
+	objects, err := store.retrieveFilteredObjects(orgID, filter, function)
+	if err != nil {
 		return nil, err
 	}
-	if len(common.Configuration.ObjectsDataPath) > 0 {
-		for i := 0; i < len(result); i++ {
+	result := make([]common.MetaData, len(objects))
+	for i, object := range objects {
+		result[i] = object.Meta
+		if len(common.Configuration.ObjectsDataPath) > 0 {
 			result[i].DestinationDataURI = createDataPathFromMeta(store.localDataPath, result[i])
 		}
 	}
@@ -433,17 +499,19 @@ func (store *BoltStorage) RetrieveUpdatedObjects(orgID string, objectType string
 
 // RetrieveObjectsWithDestinationPolicy returns the list of all the objects that have a Destination Policy
 // If received is true, return objects marked as policy received
-func (store *BoltStorage) RetrieveObjectsWithDestinationPolicy(orgID string, received bool) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
-	result := make([]common.ObjectDestinationPolicy, 0)
-	function := func(object boltObject) {
-		if orgID == object.Meta.DestOrgID && object.Meta.DestinationPolicy != nil &&
-			(received || !object.PolicyReceived) {
-			result = append(result, createObjectDestinationPolicy(object))
-		}
+func (store *BoltStorage) RetrieveObjectsWithDestinationPolicy(orgID string, received bool, filter common.ObjectsFilter) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
+	function := func(object boltObject) bool {
+		return orgID == object.Meta.DestOrgID && object.Meta.DestinationPolicy != nil &&
+			(received || !object.PolicyReceived)
 	}
-	if err := store.retrieveObjectsHelper(function); err != nil {
+	objects, err := store.retrieveFilteredObjects(orgID, filter, function)
+	if err != nil {
 		return nil, err
 	}
+	result := make([]common.ObjectDestinationPolicy, len(objects))
+	for i, object := range objects {
+		result[i] = createObjectDestinationPolicy(object)
+	}
 	return result, nil
 }
 
@@ -480,12 +548,12 @@ func (store *BoltStorage) RetrieveObjectsWithDestinationPolicyUpdatedSince(orgID
 	return result, nil
 }
 
-// RetrieveAllObjects returns the list of all the objects of the specified type
-func (store *BoltStorage) RetrieveAllObjects(orgID string, objectType string) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
-	result := make([]common.ObjectDestinationPolicy, 0)
+// RetrieveObjectsWithDestinationGroup returns the list of all the objects whose destinations list includes the destination group
+func (store *BoltStorage) RetrieveObjectsWithDestinationGroup(orgID string, name string) ([]common.MetaData, common.SyncServiceError) {
+	result := make([]common.MetaData, 0)
 	function := func(object boltObject) {
-		if orgID == object.Meta.DestOrgID && object.Meta.ObjectType == objectType {
-			result = append(result, createObjectDestinationPolicy(object))
+		if orgID == object.Meta.DestOrgID && common.TargetsDestinationGroup(object.Meta.DestinationsList, name) {
+			result = append(result, object.Meta)
 		}
 	}
 	if err := store.retrieveObjectsHelper(function); err != nil {
@@ -494,6 +562,22 @@ func (store *BoltStorage) RetrieveAllObjects(orgID string, objectType string) ([
 	return result, nil
 }
 
+// RetrieveAllObjects returns the list of all the objects of the specified type
+func (store *BoltStorage) RetrieveAllObjects(orgID string, objectType string, filter common.ObjectsFilter) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
+	function := func(object boltObject) bool {
+		return orgID == object.Meta.DestOrgID && object.Meta.ObjectType == objectType
+	}
+	objects, err := store.retrieveFilteredObjects(orgID, filter, function)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]common.ObjectDestinationPolicy, len(objects))
+	for i, object := range objects {
+		result[i] = createObjectDestinationPolicy(object)
+	}
+	return result, nil
+}
+
 // RetrieveObjects returns the list of all the objects that need to be sent to the destination
 // For CSS: adds the new destination to the destinations lists of the relevant objects.
 func (store *BoltStorage) RetrieveObjects(orgID string, destType string, destID string, resend int) ([]common.MetaData, common.SyncServiceError) {
@@ -528,7 +612,7 @@ func (store *BoltStorage) RetrieveObjects(orgID string, destType string, destID
 			if dest, err := store.RetrieveDestination(orgID, destType, destID); err == nil && dest != nil {
 				existingDestIndex := -1
 				for i, d := range object.Destinations {
-					if d.Destination == *dest {
+					if isSameDestination(d.Destination, *dest) {
 						existingDestIndex = i
 						break
 					}
@@ -607,7 +691,7 @@ func (store *BoltStorage) AppendObjectData(orgID string, objectType string, obje
 			if !isFirstChunk {
 				return object, &Error{"No path to store data"}
 			}
-			dataPath = createDataPathFromMeta(store.localDataPath, object.Meta)
+			dataPath = store.createDataPathFromMeta(object.Meta)
 			object.DataPath = dataPath
 		}
 		return object, nil
@@ -615,7 +699,7 @@ func (store *BoltStorage) AppendObjectData(orgID string, objectType string, obje
 	if err := store.updateObjectHelper(orgID, objectType, objectID, function); err != nil {
 		return err
 	}
-	return dataURI.AppendData(dataPath, dataReader, dataLength, offset, total, isFirstChunk, isLastChunk)
+	return store.appendData(dataPath, dataReader, dataLength, offset, total, isFirstChunk, isLastChunk)
 }
 
 // UpdateObjectStatus updates an object's status
@@ -639,6 +723,18 @@ func (store *BoltStorage) UpdateObjectSourceDataURI(orgID string, objectType str
 	return store.updateObjectHelper(orgID, objectType, objectID, function)
 }
 
+// UpdateObjectDataInfo updates the hash of object's data, its size as it was provided by the application, and whether it is encrypted
+func (store *BoltStorage) UpdateObjectDataInfo(orgID string, objectType string, objectID string, dataHash string,
+	originalSize int64, encrypted bool) common.SyncServiceError {
+	function := func(object boltObject) (boltObject, common.SyncServiceError) {
+		object.Meta.DataHash = dataHash
+		object.Meta.OriginalSize = originalSize
+		object.Meta.Encrypted = encrypted
+		return object, nil
+	}
+	return store.updateObjectHelper(orgID, objectType, objectID, function)
+}
+
 // RetrieveObjectRemainingConsumers finds the object and returns the number of remaining consumers
 // that haven't consumed the object yet
 func (store *BoltStorage) RetrieveObjectRemainingConsumers(orgID string, objectType string, objectID string) (int, common.SyncServiceError) {
@@ -697,7 +793,7 @@ func (store *BoltStorage) DecrementAndReturnRemainingReceivers(orgID string, obj
 // CloseDataReader closes the data reader if necessary
 func (store *BoltStorage) CloseDataReader(dataReader io.Reader) common.SyncServiceError {
 	switch v := dataReader.(type) {
-	case *os.File:
+	case io.Closer:
 		return v.Close()
 	}
 	return nil
@@ -708,7 +804,7 @@ func (store *BoltStorage) ReadObjectData(orgID string, objectType string, object
 	eof bool, length int, err common.SyncServiceError) {
 	function := func(object boltObject) common.SyncServiceError {
 		if object.DataPath != "" {
-			data, eof, length, err = dataURI.GetDataChunk(object.DataPath, size, offset)
+			data, eof, length, err = store.getDataChunk(object.DataPath, size, offset)
 			return err
 		}
 		eof = true
@@ -753,6 +849,15 @@ func (store *BoltStorage) DeleteStoredObject(orgID string, objectType string, ob
 	}
 	id := createObjectCollectionID(orgID, objectType, objectID)
 	err := store.db.Update(func(tx *bolt.Tx) error {
+		if encoded := tx.Bucket(objectsBucket).Get([]byte(id)); encoded != nil {
+			var object boltObject
+			if err := json.Unmarshal(encoded, &object); err != nil {
+				return err
+			}
+			if err := updateLabelsIndex(tx, []byte(id), &object.Meta, nil); err != nil {
+				return err
+			}
+		}
 		err := tx.Bucket(objectsBucket).Delete([]byte(id))
 		return err
 	})
@@ -765,7 +870,7 @@ func (store *BoltStorage) DeleteStoredData(orgID string, objectType string, obje
 		if object.DataPath == "" {
 			return object, nil
 		}
-		if err := dataURI.DeleteStoredData(object.DataPath); err != nil {
+		if err := store.deleteStoredData(object.DataPath); err != nil {
 			return object, err
 		}
 		object.DataPath = ""
@@ -946,9 +1051,58 @@ func (store *BoltStorage) GetNumberOfStoredObjects() (uint32, common.SyncService
 	return count, nil
 }
 
-// AddWebhook stores a webhook for an object type
-func (store *BoltStorage) AddWebhook(orgID string, objectType string, url string) common.SyncServiceError {
-	function := func(hooks []string) []string {
+// RetrieveOrganizationsUsage returns the number of objects received from the application that are currently
+// stored in this node's storage and the total size of their data and the data of their versions,
+// for the organization with the provided orgID.
+// An empty orgID returns the usage of all the organizations that have stored objects.
+func (store *BoltStorage) RetrieveOrganizationsUsage(orgID string) ([]common.OrganizationUsage, common.SyncServiceError) {
+	usage := newOrganizationsUsage(orgID)
+	function := func(object boltObject) {
+		if object.Status == common.ReadyToSend || object.Status == common.NotReadyToSend {
+			usage.add(object.Meta.DestOrgID, object.Meta.ObjectSize)
+		}
+	}
+
+	if err := store.retrieveObjectsHelper(function); err != nil {
+		return nil, err
+	}
+
+	// Versions that share data point to the same data file, which is counted once
+	dataPaths := make(map[string]bool)
+	err := store.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(versionsBucket).Cursor()
+		for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+			var version boltObjectVersion
+			if err := json.Unmarshal(value, &version); err != nil {
+				return err
+			}
+			if version.DataPath != "" && !dataPaths[version.DataPath] {
+				dataPaths[version.DataPath] = true
+				usage.addVersion(version.Version.MetaData.DestOrgID, version.Version.MetaData.ObjectSize)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return usage.result(), nil
+}
+
+// AddWebhook stores a webhook for an object type, the secret and events of an existing webhook are replaced
+func (store *BoltStorage) AddWebhook(orgID string, objectType string, webhook common.Webhook) common.SyncServiceError {
+	url := webhook.URL
+	function := func(hooks []string, secrets map[string]string, events map[string][]string) []string {
+		if webhook.Secret == "" {
+			delete(secrets, url)
+		} else {
+			secrets[url] = webhook.Secret
+		}
+		if len(webhook.Events) == 0 {
+			delete(events, url)
+		} else {
+			events[url] = webhook.Events
+		}
 		// Don't add the webhook if it already is in the list
 		for _, hook := range hooks {
 			if url == hook {
@@ -966,12 +1120,14 @@ func (store *BoltStorage) AddWebhook(orgID string, objectType string, url string
 
 // DeleteWebhook deletes a webhook for an object type
 func (store *BoltStorage) DeleteWebhook(orgID string, objectType string, url string) common.SyncServiceError {
-	function := func(hooks []string) []string {
+	function := func(hooks []string, secrets map[string]string, events map[string][]string) []string {
 		if hooks == nil {
 			return nil
 		}
 		for i, hook := range hooks {
 			if strings.EqualFold(hook, url) {
+				delete(secrets, hook)
+				delete(events, hook)
 				hooks[i] = hooks[len(hooks)-1]
 				return hooks[:len(hooks)-1]
 			}
@@ -982,10 +1138,12 @@ func (store *BoltStorage) DeleteWebhook(orgID string, objectType string, url str
 }
 
 // RetrieveWebhooks gets the webhooks for the object type
-func (store *BoltStorage) RetrieveWebhooks(orgID string, objectType string) ([]string, common.SyncServiceError) {
-	var encoded []byte
+func (store *BoltStorage) RetrieveWebhooks(orgID string, objectType string) ([]common.Webhook, common.SyncServiceError) {
+	var encoded, encodedSecrets, encodedEvents []byte
 	store.db.View(func(tx *bolt.Tx) error {
 		encoded = tx.Bucket(webhooksBucket).Get([]byte(objectType))
+		encodedSecrets = tx.Bucket(webhookSecretsBucket).Get([]byte(objectType))
+		encodedEvents = tx.Bucket(webhookEventsBucket).Get([]byte(objectType))
 		return nil
 	})
 
@@ -1000,7 +1158,342 @@ func (store *BoltStorage) RetrieveWebhooks(orgID string, objectType string) ([]s
 	if len(hooks) == 0 {
 		return nil, &NotFound{"No webhooks"}
 	}
-	return hooks, nil
+	var secrets map[string]string
+	if encodedSecrets != nil {
+		if err := json.Unmarshal(encodedSecrets, &secrets); err != nil {
+			return nil, err
+		}
+	}
+	var events map[string][]string
+	if encodedEvents != nil {
+		if err := json.Unmarshal(encodedEvents, &events); err != nil {
+			return nil, err
+		}
+	}
+	webhooks := make([]common.Webhook, 0, len(hooks))
+	for _, hook := range hooks {
+		webhooks = append(webhooks, common.Webhook{URL: hook, Secret: secrets[hook], Events: events[hook]})
+	}
+	return webhooks, nil
+}
+
+// StoreWebhookDelivery stores a delivery to a webhook, replacing the delivery with the same ID
+func (store *BoltStorage) StoreWebhookDelivery(delivery common.WebhookDelivery) common.SyncServiceError {
+	encoded, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+	err = store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(deliveriesBucket).Put([]byte(delivery.ID), encoded)
+	})
+	return err
+}
+
+// DeleteWebhookDelivery deletes a delivery to a webhook
+func (store *BoltStorage) DeleteWebhookDelivery(id string) common.SyncServiceError {
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(deliveriesBucket).Delete([]byte(id))
+	})
+	return err
+}
+
+// RetrieveWebhookDeliveries returns the deliveries to webhooks with the provided orgID and status.
+// An empty orgID or status matches all the deliveries.
+func (store *BoltStorage) RetrieveWebhookDeliveries(orgID string, status string) ([]common.WebhookDelivery, common.SyncServiceError) {
+	result := make([]common.WebhookDelivery, 0)
+	err := store.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(deliveriesBucket).Cursor()
+		for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+			var delivery common.WebhookDelivery
+			if err := json.Unmarshal(value, &delivery); err != nil {
+				return err
+			}
+			if (orgID == "" || delivery.OrgID == orgID) && (status == "" || delivery.Status == status) {
+				result = append(result, delivery)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// StoreRollout stores the state of the rollout of an object, replacing the object's previous rollout state
+func (store *BoltStorage) StoreRollout(rollout common.RolloutStatus) common.SyncServiceError {
+	encoded, err := json.Marshal(rollout)
+	if err != nil {
+		return err
+	}
+	id := createObjectCollectionID(rollout.OrgID, rollout.ObjectType, rollout.ObjectID)
+	err = store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(rolloutsBucket).Put([]byte(id), encoded)
+	})
+	return err
+}
+
+// RetrieveRollout returns the state of the rollout of an object, or nil if the object has no rollout state
+func (store *BoltStorage) RetrieveRollout(orgID string, objectType string, objectID string) (*common.RolloutStatus, common.SyncServiceError) {
+	var rollout *common.RolloutStatus
+	err := store.db.View(func(tx *bolt.Tx) error {
+		encoded := tx.Bucket(rolloutsBucket).Get([]byte(createObjectCollectionID(orgID, objectType, objectID)))
+		if encoded == nil {
+			return nil
+		}
+		rollout = &common.RolloutStatus{}
+		return json.Unmarshal(encoded, rollout)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rollout, nil
+}
+
+// RetrieveRollouts returns the states of the rollouts with the provided status. An empty status matches all the rollouts.
+func (store *BoltStorage) RetrieveRollouts(status string) ([]common.RolloutStatus, common.SyncServiceError) {
+	result := make([]common.RolloutStatus, 0)
+	err := store.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(rolloutsBucket).Cursor()
+		for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+			var rollout common.RolloutStatus
+			if err := json.Unmarshal(value, &rollout); err != nil {
+				return err
+			}
+			if status == "" || rollout.Status == status {
+				result = append(result, rollout)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DeleteRollout deletes the state of the rollout of an object
+func (store *BoltStorage) DeleteRollout(orgID string, objectType string, objectID string) common.SyncServiceError {
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(rolloutsBucket).Delete([]byte(createObjectCollectionID(orgID, objectType, objectID)))
+	})
+	return err
+}
+
+// StoreObjectVersion stores the current version of an object in the object's version history before the object is replaced,
+// and removes the oldest versions of the object so that at most maxVersions versions are kept
+func (store *BoltStorage) StoreObjectVersion(version common.ObjectVersion, maxVersions int) common.SyncServiceError {
+	metaData := version.MetaData
+	versions, err := store.retrieveObjectVersions(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if err != nil {
+		return err
+	}
+	object := boltObjectVersion{Version: version}
+	if !metaData.NoData {
+		for _, v := range versions {
+			if v.DataPath != "" && hasSameObjectVersionData(version, v.Version) {
+				object.DataPath = v.DataPath
+				break
+			}
+		}
+		if object.DataPath == "" {
+			if object.DataPath, err = store.copyObjectVersionData(metaData, version.Version); err != nil {
+				return err
+			}
+		}
+	}
+	encoded, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+	id := createObjectVersionID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, version.Version)
+	if err := store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(versionsBucket).Put([]byte(id), encoded)
+	}); err != nil {
+		return err
+	}
+
+	versions, err = store.retrieveObjectVersions(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if err != nil || len(versions) <= maxVersions {
+		return err
+	}
+	return store.deleteObjectVersions(versions[maxVersions:], versions[:maxVersions])
+}
+
+// RetrieveObjectVersions returns the versions in the version history of an object, from the newest to the oldest
+func (store *BoltStorage) RetrieveObjectVersions(orgID string, objectType string, objectID string) ([]common.ObjectVersion, common.SyncServiceError) {
+	versions, err := store.retrieveObjectVersions(orgID, objectType, objectID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]common.ObjectVersion, 0, len(versions))
+	for _, version := range versions {
+		result = append(result, version.Version)
+	}
+	return result, nil
+}
+
+// RetrieveObjectVersionData returns the data of a version of an object, or nil if the version has no data
+func (store *BoltStorage) RetrieveObjectVersionData(orgID string, objectType string, objectID string, version int64) ([]byte, common.SyncServiceError) {
+	var object *boltObjectVersion
+	err := store.db.View(func(tx *bolt.Tx) error {
+		encoded := tx.Bucket(versionsBucket).Get([]byte(createObjectVersionID(orgID, objectType, objectID, version)))
+		if encoded == nil {
+			return nil
+		}
+		object = &boltObjectVersion{}
+		return json.Unmarshal(encoded, object)
+	})
+	if err != nil || object == nil || object.DataPath == "" {
+		return nil, err
+	}
+	dataReader, err := store.getData(object.DataPath)
+	if err != nil {
+		return nil, err
+	}
+	defer store.CloseDataReader(dataReader)
+	data, err := ioutil.ReadAll(dataReader)
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to read the data of a version. Error: %s.", err)}
+	}
+	return data, nil
+}
+
+// DeleteObjectVersions deletes the version history of an object
+func (store *BoltStorage) DeleteObjectVersions(orgID string, objectType string, objectID string) common.SyncServiceError {
+	versions, err := store.retrieveObjectVersions(orgID, objectType, objectID)
+	if err != nil {
+		return err
+	}
+	return store.deleteObjectVersions(versions, nil)
+}
+
+// StoreDestinationGroup stores a destination group, replacing the destinations of an existing group
+func (store *BoltStorage) StoreDestinationGroup(group common.DestinationGroup) common.SyncServiceError {
+	encoded, err := json.Marshal(group)
+	if err != nil {
+		return err
+	}
+	err = store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(destGroupsBucket).Put([]byte(group.OrgID+":"+group.Name), encoded)
+	})
+	return err
+}
+
+// RetrieveDestinationGroup returns a destination group, or nil if the group doesn't exist
+func (store *BoltStorage) RetrieveDestinationGroup(orgID string, name string) (*common.DestinationGroup, common.SyncServiceError) {
+	var group *common.DestinationGroup
+	err := store.db.View(func(tx *bolt.Tx) error {
+		encoded := tx.Bucket(destGroupsBucket).Get([]byte(orgID + ":" + name))
+		if encoded == nil {
+			return nil
+		}
+		group = &common.DestinationGroup{}
+		return json.Unmarshal(encoded, group)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// RetrieveDestinationGroups returns the destination groups of an organization
+func (store *BoltStorage) RetrieveDestinationGroups(orgID string) ([]common.DestinationGroup, common.SyncServiceError) {
+	result := make([]common.DestinationGroup, 0)
+	err := store.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(destGroupsBucket).Cursor()
+		prefix := []byte(orgID + ":")
+		for key, value := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, value = cursor.Next() {
+			var group common.DestinationGroup
+			if err := json.Unmarshal(value, &group); err != nil {
+				return err
+			}
+			result = append(result, group)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DeleteDestinationGroup deletes a destination group
+func (store *BoltStorage) DeleteDestinationGroup(orgID string, name string) common.SyncServiceError {
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(destGroupsBucket).Delete([]byte(orgID + ":" + name))
+	})
+	return err
+}
+
+// StoreAuditEntry stores an entry of the audit log
+func (store *BoltStorage) StoreAuditEntry(entry common.AuditEntry) common.SyncServiceError {
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	err = store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(auditBucket).Put(append(auditKeyPrefix(entry.Timestamp), []byte(entry.ID)...), encoded)
+	})
+	return err
+}
+
+// RetrieveAuditEntries returns the entries of the audit log with the provided orgID and timestamps in the range [from, to),
+// sorted by their timestamps. An empty orgID matches all the entries, and a zero from or to leaves the range open.
+func (store *BoltStorage) RetrieveAuditEntries(orgID string, from time.Time, to time.Time) ([]common.AuditEntry, common.SyncServiceError) {
+	result := make([]common.AuditEntry, 0)
+	err := store.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(auditBucket).Cursor()
+		var key, value []byte
+		if from.IsZero() {
+			key, value = cursor.First()
+		} else {
+			key, value = cursor.Seek(auditKeyPrefix(from))
+		}
+		var toPrefix []byte
+		if !to.IsZero() {
+			toPrefix = auditKeyPrefix(to)
+		}
+		for ; key != nil; key, value = cursor.Next() {
+			if toPrefix != nil && bytes.Compare(key[:len(toPrefix)], toPrefix) >= 0 {
+				break
+			}
+			var entry common.AuditEntry
+			if err := json.Unmarshal(value, &entry); err != nil {
+				return err
+			}
+			if orgID == "" || entry.OrgID == orgID {
+				result = append(result, entry)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DeleteAuditEntries deletes the entries of the audit log with timestamps before the provided time
+func (store *BoltStorage) DeleteAuditEntries(before time.Time) common.SyncServiceError {
+	beforePrefix := auditKeyPrefix(before)
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(auditBucket).Cursor()
+		for key, _ := cursor.First(); key != nil && bytes.Compare(key[:len(beforePrefix)], beforePrefix) < 0; key, _ = cursor.First() {
+			if err := cursor.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// The keys of the audit log's bucket are the entries' timestamps followed by their IDs, so that the keys are sorted by time
+func auditKeyPrefix(timestamp time.Time) []byte {
+	prefix := make([]byte, 8)
+	binary.BigEndian.PutUint64(prefix, uint64(timestamp.UnixNano()))
+	return prefix
 }
 
 // RetrieveDestinations returns all the destinations with the provided orgID and destType
@@ -1333,6 +1826,18 @@ func (store *BoltStorage) RetrievePendingNotifications(orgID string, destType st
 	return result, nil
 }
 
+// GetNumberOfNotificationsByStatus returns the number of notifications in each status
+func (store *BoltStorage) GetNumberOfNotificationsByStatus() (map[string]uint32, common.SyncServiceError) {
+	result := make(map[string]uint32)
+	function := func(notification common.Notification) {
+		result[notification.Status]++
+	}
+	if err := store.retrieveNotificationsHelper(function); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 // InsertInitialLeader inserts the initial leader entry
 func (store *BoltStorage) InsertInitialLeader(leaderID string) (bool, common.SyncServiceError) {
 	return true, nil
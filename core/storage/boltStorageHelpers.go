@@ -1,7 +1,12 @@
 package storage
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
 
 	bolt "github.com/etcd-io/bbolt"
 	"github.com/open-horizon/edge-sync-service/common"
@@ -25,6 +30,89 @@ func (store *BoltStorage) retrieveObjectsHelper(retrieve func(boltObject)) commo
 	return err
 }
 
+// retrieveFilteredObjects returns the objects of the organization that match and are selected by the filter, sorted by type and ID.
+// If the filter requires a label to have a value, only the objects with the label in the labels index are examined.
+func (store *BoltStorage) retrieveFilteredObjects(orgID string, filter common.ObjectsFilter, match func(boltObject) bool) ([]boltObject, common.SyncServiceError) {
+	result := make([]boltObject, 0)
+	function := func(object boltObject) {
+		if match(object) && filter.Matches(object.Meta) {
+			result = append(result, object)
+		}
+	}
+	if requirement, ok := filter.Labels.EqualityRequirement(); ok && orgID != "" {
+		if err := store.retrieveLabeledObjectsHelper(orgID, requirement.Key, requirement.Value, function); err != nil {
+			return nil, err
+		}
+	} else if err := store.retrieveObjectsHelper(function); err != nil {
+		return nil, err
+	}
+	sort.Slice(result, func(i int, j int) bool {
+		return common.IsObjectBefore(result[i].Meta.ObjectType, result[i].Meta.ObjectID, result[j].Meta.ObjectType, result[j].Meta.ObjectID)
+	})
+	if filter.Limit > 0 && len(result) > filter.Limit {
+		result = result[:filter.Limit]
+	}
+	return result, nil
+}
+
+// retrieveLabeledObjectsHelper retrieves the objects of the organization that have the label with the value
+func (store *BoltStorage) retrieveLabeledObjectsHelper(orgID string, key string, value string, retrieve func(boltObject)) common.SyncServiceError {
+	err := store.db.View(func(tx *bolt.Tx) error {
+		prefix := labelIndexPrefix(orgID, key, value)
+		cursor := tx.Bucket(labelsBucket).Cursor()
+
+		for indexKey, id := cursor.Seek(prefix); indexKey != nil && bytes.HasPrefix(indexKey, prefix); indexKey, id = cursor.Next() {
+			encoded := tx.Bucket(objectsBucket).Get(id)
+			if encoded == nil {
+				continue
+			}
+			var object boltObject
+			if err := json.Unmarshal(encoded, &object); err != nil {
+				return err
+			}
+			retrieve(object)
+		}
+		return nil
+	})
+
+	return err
+}
+
+// labelIndexPrefix returns the prefix of the keys of the entries of the labels index of the objects
+// of the organization that have the label with the value
+func labelIndexPrefix(orgID string, key string, value string) []byte {
+	return []byte(orgID + "\x00" + key + "=" + value + "\x00")
+}
+
+// updateLabelsIndex updates the entries of the labels index of the object with the given key when its meta data changes.
+// The old meta data is nil when the object is inserted, and the new meta data is nil when the object is deleted.
+func updateLabelsIndex(tx *bolt.Tx, id []byte, oldMeta *common.MetaData, newMeta *common.MetaData) error {
+	var oldLabels, newLabels map[string]string
+	if oldMeta != nil {
+		oldLabels = oldMeta.Labels
+	}
+	if newMeta != nil {
+		newLabels = newMeta.Labels
+	}
+	bucket := tx.Bucket(labelsBucket)
+	id = append([]byte(nil), id...)
+	for key, value := range oldLabels {
+		if newValue, ok := newLabels[key]; !ok || newValue != value {
+			if err := bucket.Delete(append(labelIndexPrefix(oldMeta.DestOrgID, key, value), id...)); err != nil {
+				return err
+			}
+		}
+	}
+	for key, value := range newLabels {
+		if oldValue, ok := oldLabels[key]; !ok || oldValue != value {
+			if err := bucket.Put(append(labelIndexPrefix(newMeta.DestOrgID, key, value), id...), id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (store *BoltStorage) updateObjectHelper(orgID string, objectType string, objectID string,
 	update func(boltObject) (boltObject, common.SyncServiceError)) common.SyncServiceError {
 	id := createObjectCollectionID(orgID, objectType, objectID)
@@ -39,6 +127,7 @@ func (store *BoltStorage) updateObjectHelper(orgID string, objectType string, ob
 		if err = json.Unmarshal(encoded, &object); err != nil {
 			return err
 		}
+		oldMeta := object.Meta
 
 		object, err = update(object)
 		if err != nil {
@@ -48,6 +137,9 @@ func (store *BoltStorage) updateObjectHelper(orgID string, objectType string, ob
 		if err != nil {
 			return err
 		}
+		if err = updateLabelsIndex(tx, []byte(id), &oldMeta, &object.Meta); err != nil {
+			return err
+		}
 		err = tx.Bucket(objectsBucket).Put([]byte(id), []byte(encoded))
 		return err
 	})
@@ -74,6 +166,9 @@ func (store *BoltStorage) updateObjectsHelper(update func(boltObject) (*boltObje
 			if err != nil {
 				return err
 			}
+			if err = updateLabelsIndex(tx, key, &object.Meta, &updatedObject.Meta); err != nil {
+				return err
+			}
 			err = tx.Bucket(objectsBucket).Put(key, []byte(encoded))
 			if err != nil {
 				return err
@@ -96,11 +191,14 @@ func (store *BoltStorage) deleteObjectsHelper(match func(boltObject) bool) commo
 			}
 			if match(object) {
 				if object.DataPath != "" {
-					if err := dataURI.DeleteStoredData(object.DataPath); err != nil {
+					if err := store.deleteStoredData(object.DataPath); err != nil {
 						return err
 					}
 					object.DataPath = ""
 				}
+				if err := updateLabelsIndex(tx, key, &object.Meta, nil); err != nil {
+					return err
+				}
 				if err := tx.Bucket(objectsBucket).Delete(key); err != nil {
 					return err
 				}
@@ -123,11 +221,14 @@ func (store *BoltStorage) deleteObjectsAndNotificationsHelper(match func(boltObj
 			}
 			if match(object) {
 				if object.DataPath != "" {
-					if err := dataURI.DeleteStoredData(object.DataPath); err != nil {
+					if err := store.deleteStoredData(object.DataPath); err != nil {
 						return err
 					}
 					object.DataPath = ""
 				}
+				if err := updateLabelsIndex(tx, objectKey, &object.Meta, nil); err != nil {
+					return err
+				}
 				if err := tx.Bucket(objectsBucket).Delete(objectKey); err != nil {
 					return err
 				}
@@ -173,7 +274,7 @@ func (store *BoltStorage) viewObjectHelper(orgID string, objectType string, obje
 }
 
 func (store *BoltStorage) updateWebhookHelper(objectType string,
-	update func(hooks []string) []string) common.SyncServiceError {
+	update func(hooks []string, secrets map[string]string, events map[string][]string) []string) common.SyncServiceError {
 	err := store.db.Update(func(tx *bolt.Tx) error {
 		encoded := tx.Bucket(webhooksBucket).Get([]byte(objectType))
 		var hooks []string
@@ -183,8 +284,21 @@ func (store *BoltStorage) updateWebhookHelper(objectType string,
 				return err
 			}
 		}
+		secrets := make(map[string]string)
+		if encodedSecrets := tx.Bucket(webhookSecretsBucket).Get([]byte(objectType)); encodedSecrets != nil {
+			if err := json.Unmarshal(encodedSecrets, &secrets); err != nil {
+				return err
+			}
+		}
 
-		hooks = update(hooks)
+		events := make(map[string][]string)
+		if encodedEvents := tx.Bucket(webhookEventsBucket).Get([]byte(objectType)); encodedEvents != nil {
+			if err := json.Unmarshal(encodedEvents, &events); err != nil {
+				return err
+			}
+		}
+
+		hooks = update(hooks, secrets, events)
 		if hooks == nil {
 			// No need to write back
 			return nil
@@ -194,6 +308,25 @@ func (store *BoltStorage) updateWebhookHelper(objectType string,
 			return err
 		}
 		err = tx.Bucket(webhooksBucket).Put([]byte(objectType), []byte(encoded))
+		if err != nil {
+			return err
+		}
+		if len(secrets) == 0 {
+			err = tx.Bucket(webhookSecretsBucket).Delete([]byte(objectType))
+		} else if encoded, err = json.Marshal(secrets); err == nil {
+			err = tx.Bucket(webhookSecretsBucket).Put([]byte(objectType), encoded)
+		}
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return tx.Bucket(webhookEventsBucket).Delete([]byte(objectType))
+		}
+		encoded, err = json.Marshal(events)
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket(webhookEventsBucket).Put([]byte(objectType), encoded)
 		return err
 	})
 	return err
@@ -216,6 +349,70 @@ func (store *BoltStorage) retrieveNotificationsHelper(retrieve func(common.Notif
 	return err
 }
 
+// retrieveObjectVersions returns the versions of an object from the newest to the oldest
+func (store *BoltStorage) retrieveObjectVersions(orgID string, objectType string, objectID string) ([]boltObjectVersion, common.SyncServiceError) {
+	versions := make([]boltObjectVersion, 0)
+	prefix := []byte(createObjectCollectionID(orgID, objectType, objectID) + ":")
+	err := store.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(versionsBucket).Cursor()
+		for key, value := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, value = cursor.Next() {
+			var version boltObjectVersion
+			if err := json.Unmarshal(value, &version); err != nil {
+				return err
+			}
+			versions = append(versions, version)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(versions, func(i int, j int) bool {
+		return isNewerObjectVersion(versions[i].Version, versions[j].Version)
+	})
+	return versions, nil
+}
+
+// copyObjectVersionData copies the current data of an object to the data of a version of the object,
+// and returns the path of the version's data, or an empty path if the object has no data
+func (store *BoltStorage) copyObjectVersionData(metaData common.MetaData, version int64) (string, common.SyncServiceError) {
+	dataReader, err := store.RetrieveObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if err != nil || dataReader == nil {
+		return "", err
+	}
+	defer store.CloseDataReader(dataReader)
+	dataPath := store.createDataPathFromMeta(metaData) + ":" + strconv.FormatInt(version, 10)
+	if _, err := store.storeData(dataPath, dataReader, 0); err != nil {
+		return "", err
+	}
+	return dataPath, nil
+}
+
+// deleteObjectVersions deletes versions of an object and their data, except for the data shared with the kept versions
+func (store *BoltStorage) deleteObjectVersions(versions []boltObjectVersion, kept []boltObjectVersion) common.SyncServiceError {
+	keptData := make(map[string]bool)
+	for _, version := range kept {
+		keptData[version.DataPath] = true
+	}
+	for _, version := range versions {
+		if version.DataPath != "" && !keptData[version.DataPath] {
+			if err := store.deleteStoredData(version.DataPath); err != nil {
+				return err
+			}
+			// Data shared by several of the deleted versions is deleted once
+			keptData[version.DataPath] = true
+		}
+		metaData := version.Version.MetaData
+		id := createObjectVersionID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, version.Version.Version)
+		if err := store.db.Update(func(tx *bolt.Tx) error {
+			return tx.Bucket(versionsBucket).Delete([]byte(id))
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (store *BoltStorage) deleteNotificationsHelper(match func(common.Notification) bool) common.SyncServiceError {
 	err := store.db.Update(func(tx *bolt.Tx) error {
 		cursor := tx.Bucket(notificationsBucket).Cursor()
@@ -482,3 +679,58 @@ func (store *BoltStorage) lock() {
 func (store *BoltStorage) unLock() {
 	store.lockChannel <- 1
 }
+
+// createDataPath returns the path of the object's data.
+// When a DataStore is used, the path is the object's ID in the DataStore.
+func (store *BoltStorage) createDataPath(orgID string, objectType string, objectID string) string {
+	if store.DataStore != nil {
+		return createObjectCollectionID(orgID, objectType, objectID)
+	}
+	return createDataPath(store.localDataPath, orgID, objectType, objectID)
+}
+
+func (store *BoltStorage) createDataPathFromMeta(metaData common.MetaData) string {
+	return store.createDataPath(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+}
+
+// inDataStore returns true if the data path refers to the DataStore, data stored in files before
+// the DataStore was set is still accessed through its file URI
+func (store *BoltStorage) inDataStore(dataPath string) bool {
+	return store.DataStore != nil && !strings.HasPrefix(dataPath, "file:")
+}
+
+func (store *BoltStorage) storeData(dataPath string, dataReader io.Reader, dataLength uint32) (int64, common.SyncServiceError) {
+	if store.inDataStore(dataPath) {
+		return store.DataStore.StoreData(dataPath, dataReader, dataLength)
+	}
+	return dataURI.StoreData(dataPath, dataReader, dataLength)
+}
+
+func (store *BoltStorage) appendData(dataPath string, dataReader io.Reader, dataLength uint32, offset int64, total int64,
+	isFirstChunk bool, isLastChunk bool) common.SyncServiceError {
+	if store.inDataStore(dataPath) {
+		return store.DataStore.AppendData(dataPath, dataReader, dataLength, offset, total, isFirstChunk, isLastChunk)
+	}
+	return dataURI.AppendData(dataPath, dataReader, dataLength, offset, total, isFirstChunk, isLastChunk)
+}
+
+func (store *BoltStorage) getData(dataPath string) (io.Reader, common.SyncServiceError) {
+	if store.inDataStore(dataPath) {
+		return store.DataStore.GetData(dataPath)
+	}
+	return dataURI.GetData(dataPath)
+}
+
+func (store *BoltStorage) getDataChunk(dataPath string, size int, offset int64) ([]byte, bool, int, common.SyncServiceError) {
+	if store.inDataStore(dataPath) {
+		return store.DataStore.GetDataChunk(dataPath, size, offset)
+	}
+	return dataURI.GetDataChunk(dataPath, size, offset)
+}
+
+func (store *BoltStorage) deleteStoredData(dataPath string) common.SyncServiceError {
+	if store.inDataStore(dataPath) {
+		return store.DataStore.DeleteData(dataPath)
+	}
+	return dataURI.DeleteStoredData(dataPath)
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"os"
+	"reflect"
 	"testing"
 
 	"github.com/open-horizon/edge-sync-service/common"
@@ -201,7 +202,7 @@ func TestBoltCacheStorageDestinations(t *testing.T) {
 		t.Errorf("RetrieveDestinations failed. Error: %s\n", err.Error())
 	} else if len(dests) != 1 {
 		t.Errorf("Wrong number of destinations: %d instead of 1\n", len(dests))
-	} else if dests[0] != tests[0].dest {
+	} else if !reflect.DeepEqual(dests[0], tests[0].dest) {
 		t.Errorf("Wrong destination\n")
 	}
 
@@ -237,6 +238,26 @@ func TestBoltStorageWebhooks(t *testing.T) {
 	testStorageWebhooks(common.Bolt, t)
 }
 
+func TestBoltStorageWebhookDeliveries(t *testing.T) {
+	testStorageWebhookDeliveries(common.Bolt, t)
+}
+
+func TestBoltStorageOrganizationsUsage(t *testing.T) {
+	testStorageOrganizationsUsage(common.Bolt, t)
+}
+
+func TestBoltStorageObjectsFilter(t *testing.T) {
+	testStorageObjectsFilter(common.Bolt, t)
+}
+
+func TestBoltStorageObjectLabels(t *testing.T) {
+	testStorageObjectLabels(common.Bolt, t)
+}
+
+func TestBoltStorageAuditLog(t *testing.T) {
+	testStorageAuditLog(common.Bolt, t)
+}
+
 func TestBoltStorageObjectExpiration(t *testing.T) {
 	testStorageObjectExpiration(common.Bolt, t)
 }
@@ -264,3 +285,15 @@ func TestBoltStorageOrganizations(t *testing.T) {
 func TestBoltStorageInactiveDestinations(t *testing.T) {
 	testStorageInactiveDestinations(common.Bolt, t)
 }
+
+func TestBoltStorageRollouts(t *testing.T) {
+	testStorageRollouts(common.Bolt, t)
+}
+
+func TestBoltStorageObjectVersions(t *testing.T) {
+	testStorageObjectVersions(common.Bolt, t)
+}
+
+func TestBoltStorageDestinationGroups(t *testing.T) {
+	testStorageDestinationGroups(common.Bolt, t)
+}
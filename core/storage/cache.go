@@ -83,6 +83,12 @@ func (store *Cache) UpdateObjectSourceDataURI(orgID string, objectType string, o
 	return store.Store.UpdateObjectSourceDataURI(orgID, objectType, objectID, sourceDataURI)
 }
 
+// UpdateObjectDataInfo updates the hash of object's data, its size as it was provided by the application, and whether it is encrypted
+func (store *Cache) UpdateObjectDataInfo(orgID string, objectType string, objectID string, dataHash string,
+	originalSize int64, encrypted bool) common.SyncServiceError {
+	return store.Store.UpdateObjectDataInfo(orgID, objectType, objectID, dataHash, originalSize, encrypted)
+}
+
 // RetrieveObjectStatus finds the object and return its status
 func (store *Cache) RetrieveObjectStatus(orgID string, objectType string, objectID string) (string, common.SyncServiceError) {
 	return store.Store.RetrieveObjectStatus(orgID, objectType, objectID)
@@ -113,14 +119,14 @@ func (store *Cache) ResetObjectRemainingConsumers(orgID string, objectType strin
 
 // RetrieveUpdatedObjects returns the list of all the edge updated objects that are not marked as consumed or received
 // If received is true, return objects marked as received
-func (store *Cache) RetrieveUpdatedObjects(orgID string, objectType string, received bool) ([]common.MetaData, common.SyncServiceError) {
-	return store.Store.RetrieveUpdatedObjects(orgID, objectType, received)
+func (store *Cache) RetrieveUpdatedObjects(orgID string, objectType string, received bool, filter common.ObjectsFilter) ([]common.MetaData, common.SyncServiceError) {
+	return store.Store.RetrieveUpdatedObjects(orgID, objectType, received, filter)
 }
 
 // RetrieveObjectsWithDestinationPolicy returns the list of all the objects that have a Destination Policy
 // If received is true, return objects marked as policy received
-func (store *Cache) RetrieveObjectsWithDestinationPolicy(orgID string, received bool) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
-	return store.Store.RetrieveObjectsWithDestinationPolicy(orgID, received)
+func (store *Cache) RetrieveObjectsWithDestinationPolicy(orgID string, received bool, filter common.ObjectsFilter) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
+	return store.Store.RetrieveObjectsWithDestinationPolicy(orgID, received, filter)
 }
 
 // RetrieveObjectsWithDestinationPolicyByService returns the list of all the object Policies for a particular service
@@ -133,9 +139,14 @@ func (store *Cache) RetrieveObjectsWithDestinationPolicyUpdatedSince(orgID strin
 	return store.Store.RetrieveObjectsWithDestinationPolicyUpdatedSince(orgID, since)
 }
 
+// RetrieveObjectsWithDestinationGroup returns the list of all the objects whose destinations list includes the destination group
+func (store *Cache) RetrieveObjectsWithDestinationGroup(orgID string, name string) ([]common.MetaData, common.SyncServiceError) {
+	return store.Store.RetrieveObjectsWithDestinationGroup(orgID, name)
+}
+
 // RetrieveAllObjects returns the list of all the objects of the specified type
-func (store *Cache) RetrieveAllObjects(orgID string, objectType string) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
-	return store.Store.RetrieveAllObjects(orgID, objectType)
+func (store *Cache) RetrieveAllObjects(orgID string, objectType string, filter common.ObjectsFilter) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
+	return store.Store.RetrieveAllObjects(orgID, objectType, filter)
 }
 
 // RetrieveObjects returns the list of all the objects that need to be sent to the destination
@@ -245,9 +256,17 @@ func (store *Cache) GetNumberOfStoredObjects() (uint32, common.SyncServiceError)
 	return store.Store.GetNumberOfStoredObjects()
 }
 
-// AddWebhook stores a webhook for an object type
-func (store *Cache) AddWebhook(orgID string, objectType string, url string) common.SyncServiceError {
-	return store.Store.AddWebhook(orgID, objectType, url)
+// RetrieveOrganizationsUsage returns the number of objects received from the application that are currently
+// stored in this node's storage and the total size of their data and the data of their versions,
+// for the organization with the provided orgID.
+// An empty orgID returns the usage of all the organizations that have stored objects.
+func (store *Cache) RetrieveOrganizationsUsage(orgID string) ([]common.OrganizationUsage, common.SyncServiceError) {
+	return store.Store.RetrieveOrganizationsUsage(orgID)
+}
+
+// AddWebhook stores a webhook for an object type, the secret and events of an existing webhook are replaced
+func (store *Cache) AddWebhook(orgID string, objectType string, webhook common.Webhook) common.SyncServiceError {
+	return store.Store.AddWebhook(orgID, objectType, webhook)
 }
 
 // DeleteWebhook deletes a webhook for an object type
@@ -256,10 +275,103 @@ func (store *Cache) DeleteWebhook(orgID string, objectType string, url string) c
 }
 
 // RetrieveWebhooks gets the webhooks for the object type
-func (store *Cache) RetrieveWebhooks(orgID string, objectType string) ([]string, common.SyncServiceError) {
+func (store *Cache) RetrieveWebhooks(orgID string, objectType string) ([]common.Webhook, common.SyncServiceError) {
 	return store.Store.RetrieveWebhooks(orgID, objectType)
 }
 
+// StoreWebhookDelivery stores a delivery to a webhook, replacing the delivery with the same ID
+func (store *Cache) StoreWebhookDelivery(delivery common.WebhookDelivery) common.SyncServiceError {
+	return store.Store.StoreWebhookDelivery(delivery)
+}
+
+// DeleteWebhookDelivery deletes a delivery to a webhook
+func (store *Cache) DeleteWebhookDelivery(id string) common.SyncServiceError {
+	return store.Store.DeleteWebhookDelivery(id)
+}
+
+// RetrieveWebhookDeliveries returns the deliveries to webhooks with the provided orgID and status.
+// An empty orgID or status matches all the deliveries.
+func (store *Cache) RetrieveWebhookDeliveries(orgID string, status string) ([]common.WebhookDelivery, common.SyncServiceError) {
+	return store.Store.RetrieveWebhookDeliveries(orgID, status)
+}
+
+// StoreRollout stores the state of the rollout of an object, replacing the object's previous rollout state
+func (store *Cache) StoreRollout(rollout common.RolloutStatus) common.SyncServiceError {
+	return store.Store.StoreRollout(rollout)
+}
+
+// RetrieveRollout returns the state of the rollout of an object, or nil if the object has no rollout state
+func (store *Cache) RetrieveRollout(orgID string, objectType string, objectID string) (*common.RolloutStatus, common.SyncServiceError) {
+	return store.Store.RetrieveRollout(orgID, objectType, objectID)
+}
+
+// RetrieveRollouts returns the states of the rollouts with the provided status. An empty status matches all the rollouts.
+func (store *Cache) RetrieveRollouts(status string) ([]common.RolloutStatus, common.SyncServiceError) {
+	return store.Store.RetrieveRollouts(status)
+}
+
+// DeleteRollout deletes the state of the rollout of an object
+func (store *Cache) DeleteRollout(orgID string, objectType string, objectID string) common.SyncServiceError {
+	return store.Store.DeleteRollout(orgID, objectType, objectID)
+}
+
+// StoreObjectVersion stores the current version of an object in the object's version history before the object is replaced,
+// and removes the oldest versions of the object so that at most maxVersions versions are kept
+func (store *Cache) StoreObjectVersion(version common.ObjectVersion, maxVersions int) common.SyncServiceError {
+	return store.Store.StoreObjectVersion(version, maxVersions)
+}
+
+// RetrieveObjectVersions returns the versions in the version history of an object, from the newest to the oldest
+func (store *Cache) RetrieveObjectVersions(orgID string, objectType string, objectID string) ([]common.ObjectVersion, common.SyncServiceError) {
+	return store.Store.RetrieveObjectVersions(orgID, objectType, objectID)
+}
+
+// RetrieveObjectVersionData returns the data of a version of an object, or nil if the version has no data
+func (store *Cache) RetrieveObjectVersionData(orgID string, objectType string, objectID string, version int64) ([]byte, common.SyncServiceError) {
+	return store.Store.RetrieveObjectVersionData(orgID, objectType, objectID, version)
+}
+
+// DeleteObjectVersions deletes the version history of an object
+func (store *Cache) DeleteObjectVersions(orgID string, objectType string, objectID string) common.SyncServiceError {
+	return store.Store.DeleteObjectVersions(orgID, objectType, objectID)
+}
+
+// StoreDestinationGroup stores a destination group, replacing the destinations of an existing group
+func (store *Cache) StoreDestinationGroup(group common.DestinationGroup) common.SyncServiceError {
+	return store.Store.StoreDestinationGroup(group)
+}
+
+// RetrieveDestinationGroup returns a destination group, or nil if the group doesn't exist
+func (store *Cache) RetrieveDestinationGroup(orgID string, name string) (*common.DestinationGroup, common.SyncServiceError) {
+	return store.Store.RetrieveDestinationGroup(orgID, name)
+}
+
+// RetrieveDestinationGroups returns the destination groups of an organization
+func (store *Cache) RetrieveDestinationGroups(orgID string) ([]common.DestinationGroup, common.SyncServiceError) {
+	return store.Store.RetrieveDestinationGroups(orgID)
+}
+
+// DeleteDestinationGroup deletes a destination group
+func (store *Cache) DeleteDestinationGroup(orgID string, name string) common.SyncServiceError {
+	return store.Store.DeleteDestinationGroup(orgID, name)
+}
+
+// StoreAuditEntry stores an entry of the audit log
+func (store *Cache) StoreAuditEntry(entry common.AuditEntry) common.SyncServiceError {
+	return store.Store.StoreAuditEntry(entry)
+}
+
+// RetrieveAuditEntries returns the entries of the audit log with the provided orgID and timestamps in the range [from, to),
+// sorted by their timestamps. An empty orgID matches all the entries, and a zero from or to leaves the range open.
+func (store *Cache) RetrieveAuditEntries(orgID string, from time.Time, to time.Time) ([]common.AuditEntry, common.SyncServiceError) {
+	return store.Store.RetrieveAuditEntries(orgID, from, to)
+}
+
+// DeleteAuditEntries deletes the entries of the audit log with timestamps before the provided time
+func (store *Cache) DeleteAuditEntries(before time.Time) common.SyncServiceError {
+	return store.Store.DeleteAuditEntries(before)
+}
+
 // RetrieveDestinations returns all the destinations with the provided orgID and destType
 func (store *Cache) RetrieveDestinations(orgID string, destType string) ([]common.Destination, common.SyncServiceError) {
 	store.lock.RLock()
@@ -399,6 +511,11 @@ func (store *Cache) RetrievePendingNotifications(orgID string, destType string,
 	return store.Store.RetrievePendingNotifications(orgID, destType, destID)
 }
 
+// GetNumberOfNotificationsByStatus returns the number of notifications in each status
+func (store *Cache) GetNumberOfNotificationsByStatus() (map[string]uint32, common.SyncServiceError) {
+	return store.Store.GetNumberOfNotificationsByStatus()
+}
+
 // InsertInitialLeader inserts the initial leader entry
 func (store *Cache) InsertInitialLeader(leaderID string) (bool, common.SyncServiceError) {
 	return store.Store.InsertInitialLeader(leaderID)
@@ -7,6 +7,7 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
@@ -22,10 +23,18 @@ type InMemoryStorage struct {
 	lockChannel   chan int
 	objects       map[string]inMemoryObject
 	notifications map[string]common.Notification
-	webhooks      map[string][]string
+	webhooks      map[string][]common.Webhook
+	deliveries    map[string]common.WebhookDelivery
+	auditLog      []common.AuditEntry
+	rollouts      map[string]common.RolloutStatus
+	versions      map[string][]inMemoryObjectVersion
+	destGroups    map[string]common.DestinationGroup
 	timebase      int64
 }
 
+// The maximal number of entries kept in the audit log, the oldest entries are dropped when it is full
+const inMemoryAuditLogSize = 10000
+
 type inMemoryObject struct {
 	meta               common.MetaData
 	data               []byte
@@ -35,13 +44,32 @@ type inMemoryObject struct {
 	consumedTimestamp  time.Time
 }
 
+type inMemoryObjectVersion struct {
+	version common.ObjectVersion
+	data    []byte
+}
+
+// sharesObjectVersionData returns true if the data of a version is shared with one of the provided versions
+func sharesObjectVersionData(versions []inMemoryObjectVersion, version inMemoryObjectVersion) bool {
+	for _, v := range versions {
+		if v.data != nil && hasSameObjectVersionData(version.version, v.version) {
+			return true
+		}
+	}
+	return false
+}
+
 // Init initializes the InMemory store
 func (store *InMemoryStorage) Init() common.SyncServiceError {
 	store.lockChannel = make(chan int, 1)
 	store.lockChannel <- 1
 	store.objects = make(map[string]inMemoryObject)
 	store.notifications = make(map[string]common.Notification)
-	store.webhooks = make(map[string][]string)
+	store.webhooks = make(map[string][]common.Webhook)
+	store.deliveries = make(map[string]common.WebhookDelivery)
+	store.rollouts = make(map[string]common.RolloutStatus)
+	store.versions = make(map[string][]inMemoryObjectVersion)
+	store.destGroups = make(map[string]common.DestinationGroup)
 
 	currentTime := time.Now().UnixNano()
 	store.timebase = currentTime
@@ -231,6 +259,24 @@ func (store *InMemoryStorage) UpdateObjectSourceDataURI(orgID string, objectType
 	return notFound
 }
 
+// UpdateObjectDataInfo updates the hash of object's data, its size as it was provided by the application, and whether it is encrypted
+func (store *InMemoryStorage) UpdateObjectDataInfo(orgID string, objectType string, objectID string, dataHash string,
+	originalSize int64, encrypted bool) common.SyncServiceError {
+	store.lock()
+	defer store.unLock()
+
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if object, ok := store.objects[id]; ok {
+		object.meta.DataHash = dataHash
+		object.meta.OriginalSize = originalSize
+		object.meta.Encrypted = encrypted
+		store.objects[id] = object
+		return nil
+	}
+
+	return notFound
+}
+
 // RetrieveObjectStatus finds the object and returns its status
 func (store *InMemoryStorage) RetrieveObjectStatus(orgID string, objectType string, objectID string) (string, common.SyncServiceError) {
 	store.lock()
@@ -307,7 +353,7 @@ func (store *InMemoryStorage) DecrementAndReturnRemainingReceivers(orgID string,
 
 // RetrieveUpdatedObjects returns the list of all the edge updated objects that are not marked as consumed or received
 // If received is true, return objects marked as received
-func (store *InMemoryStorage) RetrieveUpdatedObjects(orgID string, objectType string, received bool) ([]common.MetaData, common.SyncServiceError) {
+func (store *InMemoryStorage) RetrieveUpdatedObjects(orgID string, objectType string, received bool, filter common.ObjectsFilter) ([]common.MetaData, common.SyncServiceError) {
 	store.lock()
 	defer store.unLock()
 
@@ -315,16 +361,16 @@ func (store *InMemoryStorage) RetrieveUpdatedObjects(orgID string, objectType st
 	for _, obj := range store.objects {
 		if objectType == obj.meta.ObjectType &&
 			(obj.status == common.CompletelyReceived || obj.status == common.ObjDeleted ||
-				(obj.status == common.ObjReceived && received)) {
+				(obj.status == common.ObjReceived && received)) && filter.Matches(obj.meta) {
 			result = append(result, obj.meta)
 		}
 	}
-	return result, nil
+	return sortObjectsPage(result, filter), nil
 }
 
 // RetrieveObjectsWithDestinationPolicy returns the list of all the objects that have a Destination Policy
 // If received is true, return objects marked as policy received
-func (store *InMemoryStorage) RetrieveObjectsWithDestinationPolicy(orgID string, received bool) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
+func (store *InMemoryStorage) RetrieveObjectsWithDestinationPolicy(orgID string, received bool, filter common.ObjectsFilter) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
 	return nil, nil
 }
 
@@ -338,20 +384,30 @@ func (store *InMemoryStorage) RetrieveObjectsWithDestinationPolicyUpdatedSince(o
 	return nil, nil
 }
 
+// RetrieveObjectsWithDestinationGroup returns the list of all the objects whose destinations list includes the destination group
+func (store *InMemoryStorage) RetrieveObjectsWithDestinationGroup(orgID string, name string) ([]common.MetaData, common.SyncServiceError) {
+	return nil, nil
+}
+
 // RetrieveAllObjects returns the list of all the objects of the specified type
-func (store *InMemoryStorage) RetrieveAllObjects(orgID string, objectType string) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
+func (store *InMemoryStorage) RetrieveAllObjects(orgID string, objectType string, filter common.ObjectsFilter) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
 	store.lock()
 	defer store.unLock()
 
-	result := make([]common.ObjectDestinationPolicy, 0)
+	metaDatas := make([]common.MetaData, 0)
 	for _, obj := range store.objects {
-		if objectType == obj.meta.ObjectType {
-			object := common.ObjectDestinationPolicy{
-				OrgID: orgID, ObjectType: objectType, ObjectID: obj.meta.ObjectID,
-				DestinationPolicy: obj.meta.DestinationPolicy}
-			result = append(result, object)
+		if objectType == obj.meta.ObjectType && filter.Matches(obj.meta) {
+			metaDatas = append(metaDatas, obj.meta)
 		}
 	}
+	metaDatas = sortObjectsPage(metaDatas, filter)
+
+	result := make([]common.ObjectDestinationPolicy, len(metaDatas))
+	for i, metaData := range metaDatas {
+		result[i] = common.ObjectDestinationPolicy{
+			OrgID: orgID, ObjectType: objectType, ObjectID: metaData.ObjectID,
+			DestinationPolicy: metaData.DestinationPolicy}
+	}
 	return result, nil
 }
 
@@ -430,7 +486,7 @@ func (store *InMemoryStorage) RetrieveObjectData(orgID string, objectType string
 // CloseDataReader closes the data reader if necessary
 func (store *InMemoryStorage) CloseDataReader(dataReader io.Reader) common.SyncServiceError {
 	switch v := dataReader.(type) {
-	case *os.File:
+	case io.Closer:
 		return v.Close()
 	}
 	return nil
@@ -597,26 +653,50 @@ func (store *InMemoryStorage) GetNumberOfStoredObjects() (uint32, common.SyncSer
 	return count, nil
 }
 
-// AddWebhook stores a webhook for an object type
-func (store *InMemoryStorage) AddWebhook(orgID string, objectType string, url string) common.SyncServiceError {
+// RetrieveOrganizationsUsage returns the number of objects received from the application that are currently
+// stored in this node's storage and the total size of their data and the data of their versions,
+// for the organization with the provided orgID.
+// An empty orgID returns the usage of all the organizations that have stored objects.
+func (store *InMemoryStorage) RetrieveOrganizationsUsage(orgID string) ([]common.OrganizationUsage, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+	usage := newOrganizationsUsage(orgID)
+	for _, object := range store.objects {
+		if object.status == common.ReadyToSend || object.status == common.NotReadyToSend {
+			usage.add(object.meta.DestOrgID, object.meta.ObjectSize)
+		}
+	}
+	for _, versions := range store.versions {
+		for i, v := range versions {
+			if v.data != nil && !sharesObjectVersionData(versions[:i], v) {
+				usage.addVersion(v.version.MetaData.DestOrgID, v.version.MetaData.ObjectSize)
+			}
+		}
+	}
+	return usage.result(), nil
+}
+
+// AddWebhook stores a webhook for an object type, the secret and events of an existing webhook are replaced
+func (store *InMemoryStorage) AddWebhook(orgID string, objectType string, webhook common.Webhook) common.SyncServiceError {
 	store.lock()
 	defer store.unLock()
 
-	var hooks []string
+	var hooks []common.Webhook
 	if h := store.webhooks[objectType]; h != nil {
 		hooks = h
 	} else {
-		hooks = make([]string, 0)
+		hooks = make([]common.Webhook, 0)
 	}
 
 	// Don't add the webhook if it already is in the list
-	for _, hook := range hooks {
-		if url == hook {
+	for i, hook := range hooks {
+		if webhook.URL == hook.URL {
+			hooks[i] = webhook
 			return nil
 		}
 	}
 
-	hooks = append(hooks, url)
+	hooks = append(hooks, webhook)
 	store.webhooks[objectType] = hooks
 
 	return nil
@@ -629,7 +709,7 @@ func (store *InMemoryStorage) DeleteWebhook(orgID string, objectType string, url
 
 	if hooks := store.webhooks[objectType]; hooks != nil {
 		for i, hook := range hooks {
-			if strings.EqualFold(hook, url) {
+			if strings.EqualFold(hook.URL, url) {
 				hooks[i] = hooks[len(hooks)-1]
 				store.webhooks[objectType] = hooks[:len(hooks)-1]
 				return nil
@@ -641,18 +721,237 @@ func (store *InMemoryStorage) DeleteWebhook(orgID string, objectType string, url
 }
 
 // RetrieveWebhooks gets the webhooks for the object type
-func (store *InMemoryStorage) RetrieveWebhooks(orgID string, objectType string) ([]string, common.SyncServiceError) {
+func (store *InMemoryStorage) RetrieveWebhooks(orgID string, objectType string) ([]common.Webhook, common.SyncServiceError) {
 	store.lock()
 	defer store.unLock()
 	if hooks := store.webhooks[objectType]; hooks != nil {
 		if len(hooks) == 0 {
 			return nil, &NotFound{"No webhooks"}
 		}
-		return hooks, nil
+		result := make([]common.Webhook, len(hooks))
+		copy(result, hooks)
+		return result, nil
 	}
 	return nil, &NotFound{"No webhooks"}
 }
 
+// StoreWebhookDelivery stores a delivery to a webhook, replacing the delivery with the same ID
+func (store *InMemoryStorage) StoreWebhookDelivery(delivery common.WebhookDelivery) common.SyncServiceError {
+	store.lock()
+	defer store.unLock()
+	store.deliveries[delivery.ID] = delivery
+	return nil
+}
+
+// DeleteWebhookDelivery deletes a delivery to a webhook
+func (store *InMemoryStorage) DeleteWebhookDelivery(id string) common.SyncServiceError {
+	store.lock()
+	defer store.unLock()
+	delete(store.deliveries, id)
+	return nil
+}
+
+// RetrieveWebhookDeliveries returns the deliveries to webhooks with the provided orgID and status.
+// An empty orgID or status matches all the deliveries.
+func (store *InMemoryStorage) RetrieveWebhookDeliveries(orgID string, status string) ([]common.WebhookDelivery, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+	result := make([]common.WebhookDelivery, 0)
+	for _, delivery := range store.deliveries {
+		if (orgID == "" || delivery.OrgID == orgID) && (status == "" || delivery.Status == status) {
+			result = append(result, delivery)
+		}
+	}
+	return result, nil
+}
+
+// StoreRollout stores the state of the rollout of an object, replacing the object's previous rollout state
+func (store *InMemoryStorage) StoreRollout(rollout common.RolloutStatus) common.SyncServiceError {
+	store.lock()
+	defer store.unLock()
+	store.rollouts[createObjectCollectionID(rollout.OrgID, rollout.ObjectType, rollout.ObjectID)] = rollout
+	return nil
+}
+
+// RetrieveRollout returns the state of the rollout of an object, or nil if the object has no rollout state
+func (store *InMemoryStorage) RetrieveRollout(orgID string, objectType string, objectID string) (*common.RolloutStatus, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+	if rollout, ok := store.rollouts[createObjectCollectionID(orgID, objectType, objectID)]; ok {
+		return &rollout, nil
+	}
+	return nil, nil
+}
+
+// RetrieveRollouts returns the states of the rollouts with the provided status. An empty status matches all the rollouts.
+func (store *InMemoryStorage) RetrieveRollouts(status string) ([]common.RolloutStatus, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+	result := make([]common.RolloutStatus, 0)
+	for _, rollout := range store.rollouts {
+		if status == "" || rollout.Status == status {
+			result = append(result, rollout)
+		}
+	}
+	return result, nil
+}
+
+// DeleteRollout deletes the state of the rollout of an object
+func (store *InMemoryStorage) DeleteRollout(orgID string, objectType string, objectID string) common.SyncServiceError {
+	store.lock()
+	defer store.unLock()
+	delete(store.rollouts, createObjectCollectionID(orgID, objectType, objectID))
+	return nil
+}
+
+// StoreObjectVersion stores the current version of an object in the object's version history before the object is replaced,
+// and removes the oldest versions of the object so that at most maxVersions versions are kept
+func (store *InMemoryStorage) StoreObjectVersion(version common.ObjectVersion, maxVersions int) common.SyncServiceError {
+	store.lock()
+	defer store.unLock()
+	id := createObjectCollectionID(version.MetaData.DestOrgID, version.MetaData.ObjectType, version.MetaData.ObjectID)
+	object := inMemoryObjectVersion{version: version}
+	if !version.MetaData.NoData {
+		for _, v := range store.versions[id] {
+			if v.data != nil && hasSameObjectVersionData(version, v.version) {
+				object.data = v.data
+				break
+			}
+		}
+		if object.data == nil {
+			if current, ok := store.objects[id]; ok && current.data != nil {
+				object.data = append([]byte{}, current.data...)
+			}
+		}
+	}
+	versions := []inMemoryObjectVersion{object}
+	for _, v := range store.versions[id] {
+		if v.version.Version != version.Version {
+			versions = append(versions, v)
+		}
+	}
+	sort.Slice(versions, func(i int, j int) bool {
+		return isNewerObjectVersion(versions[i].version, versions[j].version)
+	})
+	if len(versions) > maxVersions {
+		versions = versions[:maxVersions]
+	}
+	store.versions[id] = versions
+	return nil
+}
+
+// RetrieveObjectVersions returns the versions in the version history of an object, from the newest to the oldest
+func (store *InMemoryStorage) RetrieveObjectVersions(orgID string, objectType string, objectID string) ([]common.ObjectVersion, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+	versions := store.versions[createObjectCollectionID(orgID, objectType, objectID)]
+	result := make([]common.ObjectVersion, 0, len(versions))
+	for _, v := range versions {
+		result = append(result, v.version)
+	}
+	return result, nil
+}
+
+// RetrieveObjectVersionData returns the data of a version of an object, or nil if the version has no data
+func (store *InMemoryStorage) RetrieveObjectVersionData(orgID string, objectType string, objectID string, version int64) ([]byte, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+	for _, v := range store.versions[createObjectCollectionID(orgID, objectType, objectID)] {
+		if v.version.Version == version {
+			return v.data, nil
+		}
+	}
+	return nil, nil
+}
+
+// DeleteObjectVersions deletes the version history of an object
+func (store *InMemoryStorage) DeleteObjectVersions(orgID string, objectType string, objectID string) common.SyncServiceError {
+	store.lock()
+	defer store.unLock()
+	delete(store.versions, createObjectCollectionID(orgID, objectType, objectID))
+	return nil
+}
+
+// StoreDestinationGroup stores a destination group, replacing the destinations of an existing group
+func (store *InMemoryStorage) StoreDestinationGroup(group common.DestinationGroup) common.SyncServiceError {
+	store.lock()
+	defer store.unLock()
+	store.destGroups[group.OrgID+":"+group.Name] = group
+	return nil
+}
+
+// RetrieveDestinationGroup returns a destination group, or nil if the group doesn't exist
+func (store *InMemoryStorage) RetrieveDestinationGroup(orgID string, name string) (*common.DestinationGroup, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+	if group, ok := store.destGroups[orgID+":"+name]; ok {
+		return &group, nil
+	}
+	return nil, nil
+}
+
+// RetrieveDestinationGroups returns the destination groups of an organization
+func (store *InMemoryStorage) RetrieveDestinationGroups(orgID string) ([]common.DestinationGroup, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+	result := make([]common.DestinationGroup, 0)
+	for _, group := range store.destGroups {
+		if group.OrgID == orgID {
+			result = append(result, group)
+		}
+	}
+	return result, nil
+}
+
+// DeleteDestinationGroup deletes a destination group
+func (store *InMemoryStorage) DeleteDestinationGroup(orgID string, name string) common.SyncServiceError {
+	store.lock()
+	defer store.unLock()
+	delete(store.destGroups, orgID+":"+name)
+	return nil
+}
+
+// StoreAuditEntry stores an entry of the audit log
+func (store *InMemoryStorage) StoreAuditEntry(entry common.AuditEntry) common.SyncServiceError {
+	store.lock()
+	defer store.unLock()
+	if len(store.auditLog) >= inMemoryAuditLogSize {
+		store.auditLog = store.auditLog[len(store.auditLog)-inMemoryAuditLogSize+1:]
+	}
+	store.auditLog = append(store.auditLog, entry)
+	return nil
+}
+
+// RetrieveAuditEntries returns the entries of the audit log with the provided orgID and timestamps in the range [from, to),
+// sorted by their timestamps. An empty orgID matches all the entries, and a zero from or to leaves the range open.
+func (store *InMemoryStorage) RetrieveAuditEntries(orgID string, from time.Time, to time.Time) ([]common.AuditEntry, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+	result := make([]common.AuditEntry, 0)
+	for _, entry := range store.auditLog {
+		if (orgID == "" || entry.OrgID == orgID) && (from.IsZero() || !entry.Timestamp.Before(from)) &&
+			(to.IsZero() || entry.Timestamp.Before(to)) {
+			result = append(result, entry)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Timestamp.Before(result[j].Timestamp) })
+	return result, nil
+}
+
+// DeleteAuditEntries deletes the entries of the audit log with timestamps before the provided time
+func (store *InMemoryStorage) DeleteAuditEntries(before time.Time) common.SyncServiceError {
+	store.lock()
+	defer store.unLock()
+	auditLog := make([]common.AuditEntry, 0, len(store.auditLog))
+	for _, entry := range store.auditLog {
+		if !entry.Timestamp.Before(before) {
+			auditLog = append(auditLog, entry)
+		}
+	}
+	store.auditLog = auditLog
+	return nil
+}
+
 // RetrieveDestinations returns all the destinations with the provided orgID and destType
 func (store *InMemoryStorage) RetrieveDestinations(orgID string, destType string) ([]common.Destination, common.SyncServiceError) {
 	return nil, nil
@@ -800,6 +1099,18 @@ func (store *InMemoryStorage) RetrievePendingNotifications(orgID string, destTyp
 	return nil, nil
 }
 
+// GetNumberOfNotificationsByStatus returns the number of notifications in each status
+func (store *InMemoryStorage) GetNumberOfNotificationsByStatus() (map[string]uint32, common.SyncServiceError) {
+	store.lock()
+	defer store.unLock()
+
+	result := make(map[string]uint32)
+	for _, notification := range store.notifications {
+		result[notification.Status]++
+	}
+	return result, nil
+}
+
 // InsertInitialLeader inserts the initial leader entry
 func (store *InMemoryStorage) InsertInitialLeader(leaderID string) (bool, common.SyncServiceError) {
 	return true, nil
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/open-horizon/edge-sync-service/common"
@@ -136,7 +137,7 @@ func TestInMemoryCacheStorageDestinations(t *testing.T) {
 		t.Errorf("RetrieveDestinations failed. Error: %s\n", err.Error())
 	} else if len(dests) != 1 {
 		t.Errorf("Wrong number of destinations: %d instead of 1\n", len(dests))
-	} else if dests[0] != tests[0].dest {
+	} else if !reflect.DeepEqual(dests[0], tests[0].dest) {
 		t.Errorf("Wrong destination\n")
 	}
 
@@ -171,3 +172,35 @@ func TestInMemoryCacheStorageDestinations(t *testing.T) {
 func TestInMemoryStorageWebhooks(t *testing.T) {
 	testStorageWebhooks(common.InMemory, t)
 }
+
+func TestInMemoryStorageWebhookDeliveries(t *testing.T) {
+	testStorageWebhookDeliveries(common.InMemory, t)
+}
+
+func TestInMemoryStorageOrganizationsUsage(t *testing.T) {
+	testStorageOrganizationsUsage(common.InMemory, t)
+}
+
+func TestInMemoryStorageObjectsFilter(t *testing.T) {
+	testStorageObjectsFilter(common.InMemory, t)
+}
+
+func TestInMemoryStorageObjectLabels(t *testing.T) {
+	testStorageObjectLabels(common.InMemory, t)
+}
+
+func TestInMemoryStorageAuditLog(t *testing.T) {
+	testStorageAuditLog(common.InMemory, t)
+}
+
+func TestInMemoryStorageRollouts(t *testing.T) {
+	testStorageRollouts(common.InMemory, t)
+}
+
+func TestInMemoryStorageObjectVersions(t *testing.T) {
+	testStorageObjectVersions(common.InMemory, t)
+}
+
+func TestInMemoryStorageDestinationGroups(t *testing.T) {
+	testStorageDestinationGroups(common.InMemory, t)
+}
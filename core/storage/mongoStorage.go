@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
@@ -28,6 +29,9 @@ type fileHandle struct {
 
 // MongoStorage is a MongoDB based store
 type MongoStorage struct {
+	// DataStore, if set, keeps the objects' data instead of GridFS
+	DataStore DataStore
+
 	session      *mgo.Session
 	dialInfo     *mgo.DialInfo
 	openFiles    map[string]*fileHandle
@@ -48,6 +52,7 @@ type object struct {
 	RemainingReceivers int                             `bson:"remaining-receivers"`
 	Destinations       []common.StoreDestinationStatus `bson:"destinations"`
 	LastUpdate         bson.MongoTimestamp             `bson:"last-update"`
+	LabelsIndex        []string                        `bson:"labels-index,omitempty"`
 }
 
 type destinationObject struct {
@@ -90,9 +95,50 @@ type organizationObject struct {
 }
 
 type webhookObject struct {
-	ID         string              `bson:"_id"`
-	Hooks      []string            `bson:"hooks"`
-	LastUpdate bson.MongoTimestamp `bson:"last-update"`
+	ID         string                `bson:"_id"`
+	Hooks      []string              `bson:"hooks"`
+	Secrets    []webhookSecret       `bson:"secrets,omitempty"`
+	Events     []webhookSubscription `bson:"events,omitempty"`
+	LastUpdate bson.MongoTimestamp   `bson:"last-update"`
+}
+
+// The secrets and events are kept in lists since URLs can't be used as keys
+type webhookSecret struct {
+	URL    string `bson:"url"`
+	Secret string `bson:"secret"`
+}
+
+type webhookSubscription struct {
+	URL    string   `bson:"url"`
+	Events []string `bson:"events"`
+}
+
+type webhookDeliveryObject struct {
+	ID       string                 `bson:"_id"`
+	Delivery common.WebhookDelivery `bson:"delivery"`
+}
+
+type auditEntryObject struct {
+	ID    string            `bson:"_id"`
+	Entry common.AuditEntry `bson:"entry"`
+}
+
+type destinationGroupObject struct {
+	ID    string                  `bson:"_id"`
+	Group common.DestinationGroup `bson:"group"`
+}
+
+type rolloutObject struct {
+	ID      string               `bson:"_id"`
+	Rollout common.RolloutStatus `bson:"rollout"`
+}
+
+type objectVersionObject struct {
+	ID       string               `bson:"_id"`
+	ObjectID string               `bson:"object-id"`
+	Version  common.ObjectVersion `bson:"version"`
+	HasData  bool                 `bson:"has-data"`
+	DataFile string               `bson:"data-file,omitempty"`
 }
 
 type aclObject struct {
@@ -204,6 +250,8 @@ func (store *MongoStorage) Init() common.SyncServiceError {
 	notificationsCollection.EnsureIndexKey("notification.resend-time", "notification.status")
 	objectsCollection := db.C(objects)
 	objectsCollection.EnsureIndexKey("metadata.destination-org-id")
+	objectsCollection.EnsureIndexKey("metadata.destination-org-id", "metadata.object-type", "metadata.object-id")
+	objectsCollection.EnsureIndexKey("metadata.destination-org-id", "labels-index")
 	err = objectsCollection.EnsureIndex(
 		mgo.Index{
 			Key: []string{
@@ -235,6 +283,8 @@ func (store *MongoStorage) Init() common.SyncServiceError {
 		log.Error("Failed to create an index on %s. Error: %s", objects, err)
 	}
 	db.C(acls).EnsureIndexKey("org-id", "acl-type")
+	db.C(auditLog).EnsureIndexKey("entry.timestamp")
+	db.C(objectVersions).EnsureIndexKey("object-id")
 
 	store.session = session
 	store.cacheSize = common.Configuration.MongoSessionCacheSize
@@ -247,6 +297,12 @@ func (store *MongoStorage) Init() common.SyncServiceError {
 
 	store.openFiles = make(map[string]*fileHandle)
 
+	if store.DataStore != nil {
+		if err := store.DataStore.Init(); err != nil {
+			return err
+		}
+	}
+
 	if trace.IsLogging(logger.TRACE) {
 		trace.Trace("Successfully initialized mongo driver")
 	}
@@ -351,7 +407,7 @@ func (store *MongoStorage) StoreObject(metaData common.MetaData, data []byte, st
 
 	newObject := object{ID: id, MetaData: metaData, Status: status, PolicyReceived: false,
 		RemainingConsumers: metaData.ExpectedConsumers,
-		RemainingReceivers: metaData.ExpectedConsumers, Destinations: dests}
+		RemainingReceivers: metaData.ExpectedConsumers, Destinations: dests, LabelsIndex: mongoLabelsIndex(metaData.Labels)}
 	if err := store.upsert(objects, bson.M{"_id": id, "metadata.destination-org-id": metaData.DestOrgID}, newObject); err != nil {
 		return nil, &Error{fmt.Sprintf("Failed to store an object. Error: %s.", err)}
 	}
@@ -605,9 +661,9 @@ func (store *MongoStorage) ResetObjectRemainingConsumers(orgID string, objectTyp
 
 // RetrieveUpdatedObjects returns the list of all the edge updated objects that are not marked as consumed or received
 // If received is true, return objects marked as received
-func (store *MongoStorage) RetrieveUpdatedObjects(orgID string, objectType string, received bool) ([]common.MetaData, common.SyncServiceError) {
+func (store *MongoStorage) RetrieveUpdatedObjects(orgID string, objectType string, received bool, filter common.ObjectsFilter) ([]common.MetaData, common.SyncServiceError) {
 	result := []object{}
-	var query interface{}
+	var query bson.M
 	if received {
 		query = bson.M{"$or": []bson.M{
 			bson.M{"status": common.CompletelyReceived},
@@ -620,7 +676,7 @@ func (store *MongoStorage) RetrieveUpdatedObjects(orgID string, objectType strin
 			bson.M{"status": common.ObjDeleted}},
 			"metadata.destination-org-id": orgID, "metadata.object-type": objectType}
 	}
-	if err := store.fetchAll(objects, query, nil, &result); err != nil {
+	if err := store.fetchObjectsPage(addObjectsFilter(query, filter), nil, filter.Limit, &result); err != nil {
 		switch err {
 		case mgo.ErrNotFound:
 			return nil, nil
@@ -638,8 +694,8 @@ func (store *MongoStorage) RetrieveUpdatedObjects(orgID string, objectType strin
 
 // RetrieveObjectsWithDestinationPolicy returns the list of all the objects that have a Destination Policy
 // If received is true, return objects marked as policy received
-func (store *MongoStorage) RetrieveObjectsWithDestinationPolicy(orgID string, received bool) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
-	var query interface{}
+func (store *MongoStorage) RetrieveObjectsWithDestinationPolicy(orgID string, received bool, filter common.ObjectsFilter) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
+	var query bson.M
 	if received {
 		query = bson.M{
 			"metadata.destination-org-id": orgID,
@@ -658,7 +714,7 @@ func (store *MongoStorage) RetrieveObjectsWithDestinationPolicy(orgID string, re
 			},
 		}
 	}
-	return store.retrievePolicies(query)
+	return store.retrievePoliciesPage(addObjectsFilter(query, filter), filter.Limit)
 }
 
 // RetrieveObjectsWithDestinationPolicyByService returns the list of all the object Policies for a particular service
@@ -682,14 +738,34 @@ func (store *MongoStorage) RetrieveObjectsWithDestinationPolicyUpdatedSince(orgI
 	return store.retrievePolicies(query)
 }
 
+// RetrieveObjectsWithDestinationGroup returns the list of all the objects whose destinations list includes the destination group
+func (store *MongoStorage) RetrieveObjectsWithDestinationGroup(orgID string, name string) ([]common.MetaData, common.SyncServiceError) {
+	result := []object{}
+	query := bson.M{"metadata.destination-org-id": orgID, "metadata.destinations-list": common.DestinationGroupPrefix + name}
+	if err := store.fetchAll(objects, query, nil, &result); err != nil {
+		switch err {
+		case mgo.ErrNotFound:
+			return nil, nil
+		default:
+			return nil, &Error{fmt.Sprintf("Failed to fetch the objects. Error: %s.", err)}
+		}
+	}
+
+	metaDatas := make([]common.MetaData, len(result))
+	for i, r := range result {
+		metaDatas[i] = r.MetaData
+	}
+	return metaDatas, nil
+}
+
 // RetrieveAllObjects returns the list of all the objects of the specified type
-func (store *MongoStorage) RetrieveAllObjects(orgID string, objectType string) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
+func (store *MongoStorage) RetrieveAllObjects(orgID string, objectType string, filter common.ObjectsFilter) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
 	query := bson.M{
 		"metadata.destination-org-id": orgID,
 		"metadata.object-type":        objectType,
 	}
 
-	return store.retrievePolicies(query)
+	return store.retrievePoliciesPage(addObjectsFilter(query, filter), filter.Limit)
 }
 
 // RetrieveObjects returns the list of all the objects that need to be sent to the destination.
@@ -729,7 +805,7 @@ OUTER:
 				if dest, err := store.RetrieveDestination(orgID, destType, destID); err == nil {
 					existingDestIndex := -1
 					for i, d := range r.Destinations {
-						if d.Destination == *dest {
+						if isSameDestination(d.Destination, *dest) {
 							existingDestIndex = i
 							break
 						}
@@ -810,6 +886,16 @@ func (store *MongoStorage) RetrieveObjectAndStatus(orgID string, objectType stri
 // RetrieveObjectData returns the object data with the specified parameters
 func (store *MongoStorage) RetrieveObjectData(orgID string, objectType string, objectID string) (io.Reader, common.SyncServiceError) {
 	id := createObjectCollectionID(orgID, objectType, objectID)
+	if store.DataStore != nil {
+		dataReader, err := store.DataStore.GetData(id)
+		if err != nil {
+			if common.IsNotFound(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		return dataReader, nil
+	}
 	fileHandle, err := store.openFile(id)
 	if err != nil {
 		switch err {
@@ -834,6 +920,8 @@ func (store *MongoStorage) CloseDataReader(dataReader io.Reader) common.SyncServ
 			}
 		}
 		return err
+	case io.Closer:
+		return v.Close()
 	default:
 		return nil
 	}
@@ -842,6 +930,9 @@ func (store *MongoStorage) CloseDataReader(dataReader io.Reader) common.SyncServ
 // ReadObjectData returns the object data with the specified parameters
 func (store *MongoStorage) ReadObjectData(orgID string, objectType string, objectID string, size int, offset int64) ([]byte, bool, int, common.SyncServiceError) {
 	id := createObjectCollectionID(orgID, objectType, objectID)
+	if store.DataStore != nil {
+		return store.DataStore.GetDataChunk(id, size, offset)
+	}
 	fileHandle, err := store.openFile(id)
 	if err != nil {
 		if err == mgo.ErrNotFound {
@@ -911,7 +1002,13 @@ func (store *MongoStorage) StoreObjectData(orgID string, objectType string, obje
 		}
 	}
 
-	_, size, err := store.copyDataToFile(id, dataReader, true, true)
+	var size int64
+	var err common.SyncServiceError
+	if store.DataStore != nil {
+		size, err = store.DataStore.StoreData(id, dataReader, 0)
+	} else {
+		_, size, err = store.copyDataToFile(id, dataReader, true, true)
+	}
 	if err != nil {
 		return false, err
 	}
@@ -928,6 +1025,9 @@ func (store *MongoStorage) StoreObjectData(orgID string, objectType string, obje
 func (store *MongoStorage) AppendObjectData(orgID string, objectType string, objectID string, dataReader io.Reader,
 	dataLength uint32, offset int64, total int64, isFirstChunk bool, isLastChunk bool) common.SyncServiceError {
 	id := createObjectCollectionID(orgID, objectType, objectID)
+	if store.DataStore != nil {
+		return store.DataStore.AppendData(id, dataReader, dataLength, offset, total, isFirstChunk, isLastChunk)
+	}
 	var fileHandle *fileHandle
 	if isFirstChunk {
 		store.removeFile(id)
@@ -1031,6 +1131,21 @@ func (store *MongoStorage) UpdateObjectSourceDataURI(orgID string, objectType st
 	return nil
 }
 
+// UpdateObjectDataInfo updates the hash of object's data, its size as it was provided by the application, and whether it is encrypted
+func (store *MongoStorage) UpdateObjectDataInfo(orgID string, objectType string, objectID string, dataHash string,
+	originalSize int64, encrypted bool) common.SyncServiceError {
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if err := store.update(objects, bson.M{"_id": id},
+		bson.M{
+			"$set": bson.M{"metadata.data-hash": dataHash, "metadata.original-size": originalSize,
+				"metadata.encrypted": encrypted},
+			"$currentDate": bson.M{"last-update": bson.M{"$type": "timestamp"}},
+		}); err != nil {
+		return &Error{fmt.Sprintf("Failed to update the hash and the size of object's data. Error: %s.", err)}
+	}
+	return nil
+}
+
 // MarkObjectDeleted marks the object as deleted
 func (store *MongoStorage) MarkObjectDeleted(orgID string, objectType string, objectID string) common.SyncServiceError {
 	id := createObjectCollectionID(orgID, objectType, objectID)
@@ -1107,9 +1222,54 @@ func (store *MongoStorage) GetNumberOfStoredObjects() (uint32, common.SyncServic
 	return store.count(objects, query)
 }
 
-// AddWebhook stores a webhook for an object type
-func (store *MongoStorage) AddWebhook(orgID string, objectType string, url string) common.SyncServiceError {
+// RetrieveOrganizationsUsage returns the number of objects received from the application that are currently
+// stored in this node's storage and the total size of their data and the data of their versions,
+// for the organization with the provided orgID.
+// An empty orgID returns the usage of all the organizations that have stored objects.
+func (store *MongoStorage) RetrieveOrganizationsUsage(orgID string) ([]common.OrganizationUsage, common.SyncServiceError) {
+	query := bson.M{"status": bson.M{"$in": []string{common.ReadyToSend, common.NotReadyToSend}}}
+	if orgID != "" {
+		query["metadata.destination-org-id"] = orgID
+	}
+	pipeline := []bson.M{
+		bson.M{"$match": query},
+		bson.M{"$group": bson.M{"_id": "$metadata.destination-org-id", "objects": bson.M{"$sum": 1},
+			"bytes": bson.M{"$sum": "$metadata.object-size"}}},
+	}
+	result := []struct {
+		OrgID   string `bson:"_id"`
+		Objects uint32 `bson:"objects"`
+		Bytes   int64  `bson:"bytes"`
+	}{}
+	if err := store.aggregate(objects, pipeline, &result); err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the usage of the organizations. Error: %s.", err)}
+	}
+	usage := newOrganizationsUsage(orgID)
+	for _, r := range result {
+		usage.orgs[r.OrgID] = &common.OrganizationUsage{OrgID: r.OrgID, StoredObjects: r.Objects, StoredBytes: r.Bytes}
+	}
+
+	// Versions that share the data of another version are counted once, by the version that owns the data
+	versionsQuery := bson.M{"has-data": true}
+	if orgID != "" {
+		versionsQuery["version.meta.destination-org-id"] = orgID
+	}
+	versions := []objectVersionObject{}
+	if err := store.fetchAll(objectVersions, versionsQuery, nil, &versions); err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the usage of the organizations. Error: %s.", err)}
+	}
+	for _, v := range versions {
+		if v.dataID() == v.ID {
+			usage.addVersion(v.Version.MetaData.DestOrgID, v.Version.MetaData.ObjectSize)
+		}
+	}
+	return usage.result(), nil
+}
+
+// AddWebhook stores a webhook for an object type, the secret and events of an existing webhook are replaced
+func (store *MongoStorage) AddWebhook(orgID string, objectType string, webhook common.Webhook) common.SyncServiceError {
 	id := orgID + ":" + objectType
+	url := webhook.URL
 	if trace.IsLogging(logger.TRACE) {
 		trace.Trace("Adding a webhook for %s\n", id)
 	}
@@ -1119,6 +1279,8 @@ func (store *MongoStorage) AddWebhook(orgID string, objectType string, url strin
 			if err == mgo.ErrNotFound {
 				result.Hooks = make([]string, 0)
 				result.Hooks = append(result.Hooks, url)
+				result.Secrets = setWebhookSecret(nil, url, webhook.Secret)
+				result.Events = setWebhookEvents(nil, url, webhook.Events)
 				result.ID = id
 				if err = store.insert(webhooks, result); err != nil {
 					if mgo.IsDup(err) {
@@ -1132,15 +1294,21 @@ func (store *MongoStorage) AddWebhook(orgID string, objectType string, url strin
 		}
 
 		// Don't add the webhook if it already is in the list
+		found := false
 		for _, hook := range result.Hooks {
 			if url == hook {
-				return nil
+				found = true
+				break
 			}
 		}
-		result.Hooks = append(result.Hooks, url)
+		if !found {
+			result.Hooks = append(result.Hooks, url)
+		}
+		result.Secrets = setWebhookSecret(result.Secrets, url, webhook.Secret)
+		result.Events = setWebhookEvents(result.Events, url, webhook.Events)
 		if err := store.update(webhooks, bson.M{"_id": id, "last-update": result.LastUpdate},
 			bson.M{
-				"$set":         bson.M{"hooks": result.Hooks},
+				"$set":         bson.M{"hooks": result.Hooks, "secrets": result.Secrets, "events": result.Events},
 				"$currentDate": bson.M{"last-update": bson.M{"$type": "timestamp"}},
 			}); err != nil {
 			if err == mgo.ErrNotFound {
@@ -1167,6 +1335,8 @@ func (store *MongoStorage) DeleteWebhook(orgID string, objectType string, url st
 		deleted := false
 		for i, hook := range result.Hooks {
 			if strings.EqualFold(hook, url) {
+				result.Secrets = setWebhookSecret(result.Secrets, hook, "")
+				result.Events = setWebhookEvents(result.Events, hook, nil)
 				result.Hooks[i] = result.Hooks[len(result.Hooks)-1]
 				result.Hooks = result.Hooks[:len(result.Hooks)-1]
 				deleted = true
@@ -1178,7 +1348,7 @@ func (store *MongoStorage) DeleteWebhook(orgID string, objectType string, url st
 		}
 		if err := store.update(webhooks, bson.M{"_id": id, "last-update": result.LastUpdate},
 			bson.M{
-				"$set":         bson.M{"hooks": result.Hooks},
+				"$set":         bson.M{"hooks": result.Hooks, "secrets": result.Secrets, "events": result.Events},
 				"$currentDate": bson.M{"last-update": bson.M{"$type": "timestamp"}},
 			}); err != nil {
 			if err == mgo.ErrNotFound {
@@ -1192,7 +1362,7 @@ func (store *MongoStorage) DeleteWebhook(orgID string, objectType string, url st
 }
 
 // RetrieveWebhooks gets the webhooks for the object type
-func (store *MongoStorage) RetrieveWebhooks(orgID string, objectType string) ([]string, common.SyncServiceError) {
+func (store *MongoStorage) RetrieveWebhooks(orgID string, objectType string) ([]common.Webhook, common.SyncServiceError) {
 	id := orgID + ":" + objectType
 	if trace.IsLogging(logger.TRACE) {
 		trace.Trace("Retrieving a webhook for %s\n", id)
@@ -1204,7 +1374,274 @@ func (store *MongoStorage) RetrieveWebhooks(orgID string, objectType string) ([]
 	if len(result.Hooks) == 0 {
 		return nil, &NotFound{"No webhooks"}
 	}
-	return result.Hooks, nil
+	hooks := make([]common.Webhook, 0, len(result.Hooks))
+	for _, hook := range result.Hooks {
+		webhook := common.Webhook{URL: hook}
+		for _, secret := range result.Secrets {
+			if secret.URL == hook {
+				webhook.Secret = secret.Secret
+				break
+			}
+		}
+		for _, events := range result.Events {
+			if events.URL == hook {
+				webhook.Events = events.Events
+				break
+			}
+		}
+		hooks = append(hooks, webhook)
+	}
+	return hooks, nil
+}
+
+// StoreWebhookDelivery stores a delivery to a webhook, replacing the delivery with the same ID
+func (store *MongoStorage) StoreWebhookDelivery(delivery common.WebhookDelivery) common.SyncServiceError {
+	if err := store.upsert(deliveries, bson.M{"_id": delivery.ID},
+		webhookDeliveryObject{ID: delivery.ID, Delivery: delivery}); err != nil {
+		return &Error{fmt.Sprintf("Failed to store a webhook delivery. Error: %s.", err)}
+	}
+	return nil
+}
+
+// DeleteWebhookDelivery deletes a delivery to a webhook
+func (store *MongoStorage) DeleteWebhookDelivery(id string) common.SyncServiceError {
+	if err := store.removeAll(deliveries, bson.M{"_id": id}); err != nil {
+		return &Error{fmt.Sprintf("Failed to delete a webhook delivery. Error: %s.", err)}
+	}
+	return nil
+}
+
+// RetrieveWebhookDeliveries returns the deliveries to webhooks with the provided orgID and status.
+// An empty orgID or status matches all the deliveries.
+func (store *MongoStorage) RetrieveWebhookDeliveries(orgID string, status string) ([]common.WebhookDelivery, common.SyncServiceError) {
+	query := bson.M{}
+	if orgID != "" {
+		query["delivery.org-id"] = orgID
+	}
+	if status != "" {
+		query["delivery.status"] = status
+	}
+	result := []webhookDeliveryObject{}
+	if err := store.fetchAll(deliveries, query, nil, &result); err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the webhook deliveries. Error: %s.", err)}
+	}
+	webhookDeliveries := make([]common.WebhookDelivery, 0, len(result))
+	for _, r := range result {
+		webhookDeliveries = append(webhookDeliveries, r.Delivery)
+	}
+	return webhookDeliveries, nil
+}
+
+// StoreDestinationGroup stores a destination group, replacing the destinations of an existing group
+func (store *MongoStorage) StoreDestinationGroup(group common.DestinationGroup) common.SyncServiceError {
+	id := group.OrgID + ":" + group.Name
+	if err := store.upsert(destinationGroups, bson.M{"_id": id}, destinationGroupObject{ID: id, Group: group}); err != nil {
+		return &Error{fmt.Sprintf("Failed to store a destination group. Error: %s.", err)}
+	}
+	return nil
+}
+
+// RetrieveDestinationGroup returns a destination group, or nil if the group doesn't exist
+func (store *MongoStorage) RetrieveDestinationGroup(orgID string, name string) (*common.DestinationGroup, common.SyncServiceError) {
+	result := destinationGroupObject{}
+	if err := store.fetchOne(destinationGroups, bson.M{"_id": orgID + ":" + name}, nil, &result); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, nil
+		}
+		return nil, &Error{fmt.Sprintf("Failed to fetch a destination group. Error: %s.", err)}
+	}
+	return &result.Group, nil
+}
+
+// RetrieveDestinationGroups returns the destination groups of an organization
+func (store *MongoStorage) RetrieveDestinationGroups(orgID string) ([]common.DestinationGroup, common.SyncServiceError) {
+	result := []destinationGroupObject{}
+	if err := store.fetchAll(destinationGroups, bson.M{"group.org-id": orgID}, nil, &result); err != nil && err != mgo.ErrNotFound {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the destination groups. Error: %s.", err)}
+	}
+	groups := make([]common.DestinationGroup, 0, len(result))
+	for _, r := range result {
+		groups = append(groups, r.Group)
+	}
+	return groups, nil
+}
+
+// DeleteDestinationGroup deletes a destination group
+func (store *MongoStorage) DeleteDestinationGroup(orgID string, name string) common.SyncServiceError {
+	if err := store.removeAll(destinationGroups, bson.M{"_id": orgID + ":" + name}); err != nil && err != mgo.ErrNotFound {
+		return &Error{fmt.Sprintf("Failed to delete a destination group. Error: %s.", err)}
+	}
+	return nil
+}
+
+// StoreRollout stores the state of the rollout of an object, replacing the object's previous rollout state
+func (store *MongoStorage) StoreRollout(rollout common.RolloutStatus) common.SyncServiceError {
+	id := createObjectCollectionID(rollout.OrgID, rollout.ObjectType, rollout.ObjectID)
+	if err := store.upsert(rollouts, bson.M{"_id": id}, rolloutObject{ID: id, Rollout: rollout}); err != nil {
+		return &Error{fmt.Sprintf("Failed to store a rollout. Error: %s.", err)}
+	}
+	return nil
+}
+
+// RetrieveRollout returns the state of the rollout of an object, or nil if the object has no rollout state
+func (store *MongoStorage) RetrieveRollout(orgID string, objectType string, objectID string) (*common.RolloutStatus, common.SyncServiceError) {
+	result := rolloutObject{}
+	if err := store.fetchOne(rollouts, bson.M{"_id": createObjectCollectionID(orgID, objectType, objectID)}, nil, &result); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, nil
+		}
+		return nil, &Error{fmt.Sprintf("Failed to fetch a rollout. Error: %s.", err)}
+	}
+	return &result.Rollout, nil
+}
+
+// RetrieveRollouts returns the states of the rollouts with the provided status. An empty status matches all the rollouts.
+func (store *MongoStorage) RetrieveRollouts(status string) ([]common.RolloutStatus, common.SyncServiceError) {
+	query := bson.M{}
+	if status != "" {
+		query["rollout.status"] = status
+	}
+	result := []rolloutObject{}
+	if err := store.fetchAll(rollouts, query, nil, &result); err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the rollouts. Error: %s.", err)}
+	}
+	statuses := make([]common.RolloutStatus, 0, len(result))
+	for _, r := range result {
+		statuses = append(statuses, r.Rollout)
+	}
+	return statuses, nil
+}
+
+// DeleteRollout deletes the state of the rollout of an object
+func (store *MongoStorage) DeleteRollout(orgID string, objectType string, objectID string) common.SyncServiceError {
+	if err := store.removeAll(rollouts, bson.M{"_id": createObjectCollectionID(orgID, objectType, objectID)}); err != nil &&
+		err != mgo.ErrNotFound {
+		return &Error{fmt.Sprintf("Failed to delete a rollout. Error: %s.", err)}
+	}
+	return nil
+}
+
+// StoreObjectVersion stores the current version of an object in the object's version history before the object is replaced,
+// and removes the oldest versions of the object so that at most maxVersions versions are kept
+func (store *MongoStorage) StoreObjectVersion(version common.ObjectVersion, maxVersions int) common.SyncServiceError {
+	metaData := version.MetaData
+	id := createObjectVersionID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, version.Version)
+	versions, err := store.retrieveObjectVersions(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if err != nil {
+		return err
+	}
+	object := objectVersionObject{ID: id, ObjectID: createObjectCollectionID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID),
+		Version: version}
+	if !metaData.NoData {
+		for _, v := range versions {
+			if v.dataID() != "" && hasSameObjectVersionData(version, v.Version) {
+				object.DataFile = v.dataID()
+				break
+			}
+		}
+		if object.DataFile == "" {
+			copied, err := store.copyObjectVersionData(metaData, id)
+			if err != nil {
+				return err
+			}
+			if copied {
+				object.DataFile = id
+			}
+		}
+	}
+	object.HasData = object.DataFile != ""
+	if err := store.upsert(objectVersions, bson.M{"_id": id}, object); err != nil {
+		return &Error{fmt.Sprintf("Failed to store a version of an object. Error: %s.", err)}
+	}
+
+	versions, err = store.retrieveObjectVersions(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if err != nil || len(versions) <= maxVersions {
+		return err
+	}
+	return store.deleteObjectVersions(versions[maxVersions:], versions[:maxVersions])
+}
+
+// RetrieveObjectVersions returns the versions in the version history of an object, from the newest to the oldest
+func (store *MongoStorage) RetrieveObjectVersions(orgID string, objectType string, objectID string) ([]common.ObjectVersion, common.SyncServiceError) {
+	versions, err := store.retrieveObjectVersions(orgID, objectType, objectID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]common.ObjectVersion, 0, len(versions))
+	for _, v := range versions {
+		result = append(result, v.Version)
+	}
+	return result, nil
+}
+
+// RetrieveObjectVersionData returns the data of a version of an object, or nil if the version has no data
+func (store *MongoStorage) RetrieveObjectVersionData(orgID string, objectType string, objectID string, version int64) ([]byte, common.SyncServiceError) {
+	id := createObjectVersionID(orgID, objectType, objectID, version)
+	result := objectVersionObject{}
+	if err := store.fetchOne(objectVersions, bson.M{"_id": id}, nil, &result); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, nil
+		}
+		return nil, &Error{fmt.Sprintf("Failed to fetch a version of an object. Error: %s.", err)}
+	}
+	if result.dataID() == "" {
+		return nil, nil
+	}
+	return store.readDataFromFile(result.dataID())
+}
+
+// DeleteObjectVersions deletes the version history of an object
+func (store *MongoStorage) DeleteObjectVersions(orgID string, objectType string, objectID string) common.SyncServiceError {
+	versions, err := store.retrieveObjectVersions(orgID, objectType, objectID)
+	if err != nil {
+		return err
+	}
+	return store.deleteObjectVersions(versions, nil)
+}
+
+// StoreAuditEntry stores an entry of the audit log
+func (store *MongoStorage) StoreAuditEntry(entry common.AuditEntry) common.SyncServiceError {
+	if err := store.upsert(auditLog, bson.M{"_id": entry.ID}, auditEntryObject{ID: entry.ID, Entry: entry}); err != nil {
+		return &Error{fmt.Sprintf("Failed to store an audit log entry. Error: %s.", err)}
+	}
+	return nil
+}
+
+// RetrieveAuditEntries returns the entries of the audit log with the provided orgID and timestamps in the range [from, to),
+// sorted by their timestamps. An empty orgID matches all the entries, and a zero from or to leaves the range open.
+func (store *MongoStorage) RetrieveAuditEntries(orgID string, from time.Time, to time.Time) ([]common.AuditEntry, common.SyncServiceError) {
+	query := bson.M{}
+	if orgID != "" {
+		query["entry.org-id"] = orgID
+	}
+	timestampQuery := bson.M{}
+	if !from.IsZero() {
+		timestampQuery["$gte"] = from
+	}
+	if !to.IsZero() {
+		timestampQuery["$lt"] = to
+	}
+	if len(timestampQuery) != 0 {
+		query["entry.timestamp"] = timestampQuery
+	}
+	result := []auditEntryObject{}
+	if err := store.fetchAll(auditLog, query, nil, &result); err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the audit log entries. Error: %s.", err)}
+	}
+	entries := make([]common.AuditEntry, 0, len(result))
+	for _, r := range result {
+		entries = append(entries, r.Entry)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Timestamp.Before(entries[j].Timestamp) })
+	return entries, nil
+}
+
+// DeleteAuditEntries deletes the entries of the audit log with timestamps before the provided time
+func (store *MongoStorage) DeleteAuditEntries(before time.Time) common.SyncServiceError {
+	if err := store.removeAll(auditLog, bson.M{"entry.timestamp": bson.M{"$lt": before}}); err != nil {
+		return &Error{fmt.Sprintf("Failed to delete the audit log entries. Error: %s.", err)}
+	}
+	return nil
 }
 
 // RetrieveDestinations returns all the destinations with the provided orgID and destType
@@ -1544,6 +1981,26 @@ func (store *MongoStorage) RetrievePendingNotifications(orgID string, destType s
 	return notifications, nil
 }
 
+// GetNumberOfNotificationsByStatus returns the number of notifications in each status
+func (store *MongoStorage) GetNumberOfNotificationsByStatus() (map[string]uint32, common.SyncServiceError) {
+	pipeline := []bson.M{
+		bson.M{"$group": bson.M{"_id": "$notification.status", "count": bson.M{"$sum": 1}}},
+	}
+	counts := []struct {
+		Status string `bson:"_id"`
+		Count  uint32 `bson:"count"`
+	}{}
+	if err := store.aggregate(notifications, pipeline, &counts); err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to count the notifications. Error: %s.", err)}
+	}
+
+	result := make(map[string]uint32)
+	for _, c := range counts {
+		result[c.Status] = c.Count
+	}
+	return result, nil
+}
+
 // InsertInitialLeader inserts the initial leader document if the collection is empty
 func (store *MongoStorage) InsertInitialLeader(leaderID string) (bool, common.SyncServiceError) {
 	doc := leaderDocument{ID: 1, UUID: leaderID, HeartbeatTimeout: common.Configuration.LeadershipTimeout, Version: 1}
@@ -1,8 +1,12 @@
 package storage
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -119,6 +123,10 @@ func (store *MongoStorage) copyDataToFile(id string, dataReader io.Reader, isFir
 }
 
 func (store *MongoStorage) storeDataInFile(id string, data []byte) common.SyncServiceError {
+	if store.DataStore != nil {
+		_, err := store.DataStore.StoreData(id, bytes.NewReader(data), uint32(len(data)))
+		return err
+	}
 	store.removeFile(id)
 	fileHanlde, err := store.createFile(id)
 	if err != nil {
@@ -138,6 +146,11 @@ func (store *MongoStorage) storeDataInFile(id string, data []byte) common.SyncSe
 }
 
 func (store *MongoStorage) retrievePolicies(query interface{}) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
+	return store.retrievePoliciesPage(query, 0)
+}
+
+// retrievePoliciesPage returns the policies of the objects that match the query sorted by type and ID, up to limit objects if limit is set
+func (store *MongoStorage) retrievePoliciesPage(query interface{}, limit int) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
 	results := []object{}
 
 	selectedFields := bson.M{"metadata.destination-org-id": bson.ElementString,
@@ -145,7 +158,7 @@ func (store *MongoStorage) retrievePolicies(query interface{}) ([]common.ObjectD
 		"metadata.destination-policy": bson.ElementDocument,
 		"destinations":                bson.ElementArray,
 	}
-	if err := store.fetchAll(objects, query, selectedFields, &results); err != nil {
+	if err := store.fetchObjectsPage(query, selectedFields, limit, &results); err != nil {
 		switch err {
 		case mgo.ErrNotFound:
 			return nil, nil
@@ -204,6 +217,82 @@ func (store *MongoStorage) fetchAll(collectionName string, query interface{}, se
 	return nil
 }
 
+// fetchObjectsPage fetches the objects that match the query sorted by type and ID, up to limit objects if limit is set
+func (store *MongoStorage) fetchObjectsPage(query interface{}, selector interface{}, limit int, result interface{}) common.SyncServiceError {
+	function := func(collection *mgo.Collection) error {
+		return collection.Find(query).Select(selector).Sort("metadata.object-type", "metadata.object-id").Limit(limit).All(result)
+	}
+
+	retry, err := store.withCollectionHelper(objects, function, true)
+	if err != nil {
+		return err
+	}
+
+	if retry {
+		return store.fetchObjectsPage(query, selector, limit, result)
+	}
+	return nil
+}
+
+// mongoLabelsIndex returns the entries of the labels index of an object, the key of each label
+// and its key=value pair, label keys can't contain '='
+func mongoLabelsIndex(labels map[string]string) []string {
+	if len(labels) == 0 {
+		return nil
+	}
+	result := make([]string, 0, 2*len(labels))
+	for key, value := range labels {
+		result = append(result, key, key+"="+value)
+	}
+	return result
+}
+
+// addObjectsFilter adds the conditions of the filter to a query of objects
+func addObjectsFilter(query bson.M, filter common.ObjectsFilter) bson.M {
+	conditions := []bson.M{query}
+	if filter.ObjectTypePrefix != "" {
+		conditions = append(conditions, bson.M{"metadata.object-type": bson.M{"$regex": "^" + regexp.QuoteMeta(filter.ObjectTypePrefix)}})
+	}
+	if filter.Version != "" {
+		conditions = append(conditions, bson.M{"metadata.version": filter.Version})
+	}
+	if filter.Inactive != nil {
+		conditions = append(conditions, bson.M{"metadata.inactive": *filter.Inactive})
+	}
+	if filter.Deleted != nil {
+		conditions = append(conditions, bson.M{"metadata.deleted": *filter.Deleted})
+	}
+	if filter.UpdatedSince != 0 {
+		conditions = append(conditions, bson.M{"metadata.instance-id": bson.M{"$gt": filter.UpdatedSince}})
+	}
+	if filter.DestinationType != "" {
+		conditions = append(conditions, bson.M{"$or": []bson.M{
+			bson.M{"metadata.destination-type": filter.DestinationType},
+			bson.M{"metadata.destinations-list": bson.M{"$regex": "^" + regexp.QuoteMeta(filter.DestinationType+":")}}}})
+	}
+	for _, requirement := range filter.Labels {
+		switch requirement.Operator {
+		case common.LabelEquals:
+			conditions = append(conditions, bson.M{"labels-index": requirement.Key + "=" + requirement.Value})
+		case common.LabelNotEquals:
+			conditions = append(conditions, bson.M{"labels-index": bson.M{"$ne": requirement.Key + "=" + requirement.Value}})
+		case common.LabelExists:
+			conditions = append(conditions, bson.M{"labels-index": requirement.Key})
+		case common.LabelNotExists:
+			conditions = append(conditions, bson.M{"labels-index": bson.M{"$ne": requirement.Key}})
+		}
+	}
+	if filter.AfterObjectType != "" {
+		conditions = append(conditions, bson.M{"$or": []bson.M{
+			bson.M{"metadata.object-type": bson.M{"$gt": filter.AfterObjectType}},
+			bson.M{"metadata.object-type": filter.AfterObjectType, "metadata.object-id": bson.M{"$gt": filter.AfterObjectID}}}})
+	}
+	if len(conditions) == 1 {
+		return query
+	}
+	return bson.M{"$and": conditions}
+}
+
 func (store *MongoStorage) fetchOne(collectionName string, query interface{}, selector interface{}, result interface{}) common.SyncServiceError {
 	function := func(collection *mgo.Collection) error {
 		return collection.Find(query).Select(selector).One(result)
@@ -269,6 +358,22 @@ func (store *MongoStorage) insert(collectionName string, doc interface{}) common
 	return nil
 }
 
+func (store *MongoStorage) aggregate(collectionName string, pipeline interface{}, result interface{}) common.SyncServiceError {
+	function := func(collection *mgo.Collection) error {
+		return collection.Pipe(pipeline).All(result)
+	}
+
+	retry, err := store.withCollectionHelper(collectionName, function, true)
+	if err != nil {
+		return err
+	}
+
+	if retry {
+		return store.aggregate(collectionName, pipeline, result)
+	}
+	return nil
+}
+
 func (store *MongoStorage) count(collectionName string, selector interface{}) (uint32, common.SyncServiceError) {
 	var count uint32
 	function := func(collection *mgo.Collection) error {
@@ -289,7 +394,102 @@ func (store *MongoStorage) count(collectionName string, selector interface{}) (u
 	return count, nil
 }
 
+// readDataFromFile returns the whole data stored with the given ID
+func (store *MongoStorage) readDataFromFile(id string) ([]byte, common.SyncServiceError) {
+	if store.DataStore != nil {
+		dataReader, err := store.DataStore.GetData(id)
+		if err != nil {
+			return nil, err
+		}
+		defer store.CloseDataReader(dataReader)
+		data, err := ioutil.ReadAll(dataReader)
+		if err != nil {
+			return nil, &Error{fmt.Sprintf("Failed to read the data. Error: %s.", err)}
+		}
+		return data, nil
+	}
+	fileHandle, err := store.openFile(id)
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to open file to read the data. Error: %s.", err)}
+	}
+	defer fileHandle.file.Close()
+	data, err := ioutil.ReadAll(fileHandle.file)
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to read the data from the file. Error: %s.", err)}
+	}
+	return data, nil
+}
+
+// retrieveObjectVersions returns the versions of an object from the newest to the oldest
+func (store *MongoStorage) retrieveObjectVersions(orgID string, objectType string, objectID string) ([]objectVersionObject, common.SyncServiceError) {
+	versions := []objectVersionObject{}
+	if err := store.fetchAll(objectVersions, bson.M{"object-id": createObjectCollectionID(orgID, objectType, objectID)}, nil,
+		&versions); err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the versions of an object. Error: %s.", err)}
+	}
+	sort.Slice(versions, func(i int, j int) bool {
+		return isNewerObjectVersion(versions[i].Version, versions[j].Version)
+	})
+	return versions, nil
+}
+
+// dataID returns the ID of the data of a version, which may be the data of another version of the object,
+// or an empty ID if the version has no data
+func (version objectVersionObject) dataID() string {
+	if version.DataFile != "" {
+		return version.DataFile
+	}
+	if version.HasData {
+		return version.ID
+	}
+	return ""
+}
+
+// copyObjectVersionData copies the current data of an object to the data of a version of the object
+// Returns false if the object has no data
+func (store *MongoStorage) copyObjectVersionData(metaData common.MetaData, id string) (bool, common.SyncServiceError) {
+	dataReader, err := store.RetrieveObjectData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if err != nil || dataReader == nil {
+		return false, err
+	}
+	defer store.CloseDataReader(dataReader)
+	if store.DataStore != nil {
+		if _, err := store.DataStore.StoreData(id, dataReader, 0); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	if _, _, err := store.copyDataToFile(id, dataReader, true, true); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// deleteObjectVersions deletes versions of an object and their data, except for the data shared with the kept versions
+func (store *MongoStorage) deleteObjectVersions(versions []objectVersionObject, kept []objectVersionObject) common.SyncServiceError {
+	keptData := make(map[string]bool)
+	for _, version := range kept {
+		keptData[version.dataID()] = true
+	}
+	for _, version := range versions {
+		if dataID := version.dataID(); dataID != "" && !keptData[dataID] {
+			if err := store.removeFile(dataID); err != nil && err != mgo.ErrNotFound && !common.IsNotFound(err) {
+				return &Error{fmt.Sprintf("Failed to delete the data of a version of an object. Error: %s.", err)}
+			}
+			// Data shared by several of the deleted versions is deleted once
+			keptData[dataID] = true
+		}
+		if err := store.removeAll(objectVersions, bson.M{"_id": version.ID}); err != nil && err != mgo.ErrNotFound {
+			return &Error{fmt.Sprintf("Failed to delete a version of an object. Error: %s.", err)}
+		}
+	}
+	return nil
+}
+
 func (store *MongoStorage) removeFile(id string) common.SyncServiceError {
+	if store.DataStore != nil {
+		return store.DataStore.DeleteData(id)
+	}
 	function := func(db *mgo.Database) error {
 		return db.GridFS("fs").Remove(id)
 	}
@@ -738,3 +938,29 @@ func (store *MongoStorage) getInstanceID() int64 {
 	}
 	return currentTime.UnixNano() / (int64(time.Millisecond) / int64(time.Nanosecond))
 }
+
+func setWebhookSecret(secrets []webhookSecret, url string, secret string) []webhookSecret {
+	result := make([]webhookSecret, 0, len(secrets)+1)
+	for _, s := range secrets {
+		if s.URL != url {
+			result = append(result, s)
+		}
+	}
+	if secret != "" {
+		result = append(result, webhookSecret{URL: url, Secret: secret})
+	}
+	return result
+}
+
+func setWebhookEvents(events []webhookSubscription, url string, urlEvents []string) []webhookSubscription {
+	result := make([]webhookSubscription, 0, len(events)+1)
+	for _, e := range events {
+		if e.URL != url {
+			result = append(result, e)
+		}
+	}
+	if len(urlEvents) != 0 {
+		result = append(result, webhookSubscription{URL: url, Events: urlEvents})
+	}
+	return result
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/open-horizon/edge-sync-service/common"
@@ -80,7 +81,7 @@ func TestMongoStorageDestinations(t *testing.T) {
 		t.Errorf("RetrieveDestinations failed. Error: %s\n", err.Error())
 	} else if len(dests) != 1 {
 		t.Errorf("Wrong number of destinations: %d instead of 1\n", len(dests))
-	} else if dests[0] != tests[0].dest {
+	} else if !reflect.DeepEqual(dests[0], tests[0].dest) {
 		t.Errorf("Wrong destination\n")
 	}
 
@@ -152,6 +153,26 @@ func TestMongoStorageWebhooks(t *testing.T) {
 	testStorageWebhooks(common.Mongo, t)
 }
 
+func TestMongoStorageWebhookDeliveries(t *testing.T) {
+	testStorageWebhookDeliveries(common.Mongo, t)
+}
+
+func TestMongoStorageOrganizationsUsage(t *testing.T) {
+	testStorageOrganizationsUsage(common.Mongo, t)
+}
+
+func TestMongoStorageObjectsFilter(t *testing.T) {
+	testStorageObjectsFilter(common.Mongo, t)
+}
+
+func TestMongoStorageObjectLabels(t *testing.T) {
+	testStorageObjectLabels(common.Mongo, t)
+}
+
+func TestMongoStorageAuditLog(t *testing.T) {
+	testStorageAuditLog(common.Mongo, t)
+}
+
 func TestMongoStorageOrganizations(t *testing.T) {
 	testStorageOrganizations(common.Mongo, t)
 }
@@ -159,3 +180,15 @@ func TestMongoStorageOrganizations(t *testing.T) {
 func TestMongoStorageInactiveDestinations(t *testing.T) {
 	testStorageInactiveDestinations(common.Mongo, t)
 }
+
+func TestMongoStorageRollouts(t *testing.T) {
+	testStorageRollouts(common.Mongo, t)
+}
+
+func TestMongoStorageObjectVersions(t *testing.T) {
+	testStorageObjectVersions(common.Mongo, t)
+}
+
+func TestMongoStorageDestinationGroups(t *testing.T) {
+	testStorageDestinationGroups(common.Mongo, t)
+}
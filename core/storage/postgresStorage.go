@@ -0,0 +1,2066 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	// Register the PostgreSQL driver with database/sql
+	_ "github.com/lib/pq"
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+	"github.com/open-horizon/edge-utilities/logger/trace"
+)
+
+// objectsData is the table holding the objects' data, split into chunks
+const objectsData = "syncObjectsData"
+
+// PostgresStorage is a PostgreSQL based store
+type PostgresStorage struct {
+	// DataStore, if set, keeps the objects' data instead of the objects' data table
+	DataStore DataStore
+
+	db          *sql.DB
+	connected   bool
+	lockChannel chan int
+}
+
+type postgresObject struct {
+	metaData           common.MetaData
+	status             string
+	policyReceived     bool
+	remainingConsumers int
+	remainingReceivers int
+	destinations       []common.StoreDestinationStatus
+	lastUpdate         time.Time
+}
+
+// postgresQueryer is implemented by both *sql.DB and *sql.Tx
+type postgresQueryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+const postgresObjectColumns = "metadata, status, policy_received, remaining_consumers, remaining_receivers, destinations, last_update"
+
+var postgresSchema = []string{
+	`CREATE TABLE IF NOT EXISTS ` + objects + ` (
+		id TEXT PRIMARY KEY,
+		org_id TEXT NOT NULL,
+		object_type TEXT NOT NULL,
+		object_id TEXT NOT NULL,
+		metadata JSONB NOT NULL,
+		status TEXT NOT NULL,
+		policy_received BOOLEAN NOT NULL DEFAULT FALSE,
+		remaining_consumers INTEGER NOT NULL DEFAULT 0,
+		remaining_receivers INTEGER NOT NULL DEFAULT 0,
+		destinations JSONB NOT NULL DEFAULT '[]',
+		last_update TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp())`,
+	`CREATE INDEX IF NOT EXISTS syncObjects_org_type ON ` + objects + ` (org_id, object_type)`,
+	`CREATE INDEX IF NOT EXISTS syncObjects_org_type_id ON ` + objects + ` (org_id, object_type COLLATE "C", object_id COLLATE "C")`,
+	`CREATE INDEX IF NOT EXISTS syncObjects_status ON ` + objects + ` (status)`,
+	`CREATE INDEX IF NOT EXISTS syncObjects_labels ON ` + objects + ` USING GIN ((metadata->'labels'))`,
+	`CREATE TABLE IF NOT EXISTS ` + objectsData + ` (
+		id TEXT NOT NULL,
+		chunk_offset BIGINT NOT NULL,
+		data BYTEA NOT NULL,
+		PRIMARY KEY (id, chunk_offset))`,
+	`CREATE TABLE IF NOT EXISTS ` + destinations + ` (
+		id TEXT PRIMARY KEY,
+		org_id TEXT NOT NULL,
+		dest_type TEXT NOT NULL,
+		dest_id TEXT NOT NULL,
+		destination JSONB NOT NULL,
+		last_ping_time TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp())`,
+	`CREATE INDEX IF NOT EXISTS syncDestinations_org ON ` + destinations + ` (org_id, dest_type)`,
+	`CREATE TABLE IF NOT EXISTS ` + destinationGroups + ` (
+		id TEXT PRIMARY KEY,
+		org_id TEXT NOT NULL,
+		destination_group JSONB NOT NULL)`,
+	`CREATE TABLE IF NOT EXISTS ` + notifications + ` (
+		id TEXT PRIMARY KEY,
+		org_id TEXT NOT NULL,
+		object_type TEXT NOT NULL,
+		object_id TEXT NOT NULL,
+		dest_type TEXT NOT NULL,
+		dest_id TEXT NOT NULL,
+		status TEXT NOT NULL,
+		instance_id BIGINT NOT NULL DEFAULT 0,
+		data_id BIGINT NOT NULL DEFAULT 0,
+		resend_time BIGINT NOT NULL DEFAULT 0)`,
+	`CREATE INDEX IF NOT EXISTS syncNotifications_dest ON ` + notifications + ` (org_id, dest_id, dest_type)`,
+	`CREATE INDEX IF NOT EXISTS syncNotifications_resend ON ` + notifications + ` (resend_time, status)`,
+	`CREATE TABLE IF NOT EXISTS ` + leader + ` (
+		id INTEGER PRIMARY KEY,
+		uuid TEXT NOT NULL,
+		last_heartbeat_ts TIMESTAMPTZ NOT NULL,
+		heartbeat_timeout INTEGER NOT NULL,
+		version BIGINT NOT NULL)`,
+	`CREATE TABLE IF NOT EXISTS ` + messagingGroups + ` (
+		id TEXT PRIMARY KEY,
+		group_name TEXT NOT NULL,
+		last_update TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp())`,
+	`CREATE TABLE IF NOT EXISTS ` + organizations + ` (
+		id TEXT PRIMARY KEY,
+		org JSONB NOT NULL,
+		last_update TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp())`,
+	`CREATE TABLE IF NOT EXISTS ` + webhooks + ` (
+		id TEXT PRIMARY KEY,
+		hooks JSONB NOT NULL,
+		last_update TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp())`,
+	`ALTER TABLE ` + webhooks + ` ADD COLUMN IF NOT EXISTS secrets JSONB NOT NULL DEFAULT '{}'`,
+	`ALTER TABLE ` + webhooks + ` ADD COLUMN IF NOT EXISTS events JSONB NOT NULL DEFAULT '{}'`,
+	`CREATE TABLE IF NOT EXISTS ` + deliveries + ` (
+		id TEXT PRIMARY KEY,
+		org_id TEXT NOT NULL,
+		status TEXT NOT NULL,
+		delivery JSONB NOT NULL)`,
+	`CREATE INDEX IF NOT EXISTS syncWebhookDeliveries_org_status ON ` + deliveries + ` (org_id, status)`,
+	`CREATE TABLE IF NOT EXISTS ` + auditLog + ` (
+		id TEXT PRIMARY KEY,
+		org_id TEXT NOT NULL,
+		timestamp TIMESTAMPTZ NOT NULL,
+		entry JSONB NOT NULL)`,
+	`CREATE INDEX IF NOT EXISTS syncAuditLog_timestamp ON ` + auditLog + ` (timestamp)`,
+	`CREATE TABLE IF NOT EXISTS ` + rollouts + ` (
+		id TEXT PRIMARY KEY,
+		status TEXT NOT NULL,
+		rollout JSONB NOT NULL)`,
+	`CREATE TABLE IF NOT EXISTS ` + objectVersions + ` (
+		id TEXT PRIMARY KEY,
+		object_id TEXT NOT NULL,
+		has_data BOOLEAN NOT NULL DEFAULT FALSE,
+		version JSONB NOT NULL)`,
+	`CREATE INDEX IF NOT EXISTS syncObjectVersions_object ON ` + objectVersions + ` (object_id)`,
+	`ALTER TABLE ` + objectVersions + ` ADD COLUMN IF NOT EXISTS data_id TEXT`,
+	`CREATE TABLE IF NOT EXISTS ` + acls + ` (
+		id TEXT PRIMARY KEY,
+		org_id TEXT NOT NULL,
+		acl_type TEXT NOT NULL,
+		usernames JSONB NOT NULL,
+		last_update TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp())`,
+	`CREATE INDEX IF NOT EXISTS syncACLs_org_type ON ` + acls + ` (org_id, acl_type)`,
+}
+
+// Init initializes the PostgresStorage store
+func (store *PostgresStorage) Init() common.SyncServiceError {
+	store.lockChannel = make(chan int, 1)
+	store.lockChannel <- 1
+
+	db, err := sql.Open("postgres", store.connectionString())
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to open the postgres database. Error: %s.", err)}
+	}
+	db.SetMaxOpenConns(common.Configuration.PostgresMaxOpenConnections)
+
+	if trace.IsLogging(logger.INFO) {
+		trace.Info("Connecting to postgres...")
+	}
+	for connectTime := 0; connectTime < common.Configuration.DatabaseConnectTimeout; connectTime += 10 {
+		err = db.Ping()
+		if err == nil {
+			break
+		}
+		if connectTime == 0 && trace.IsLogging(logger.ERROR) {
+			trace.Error("Failed to connect to postgres. Error: " + err.Error())
+		}
+		if strings.Contains(err.Error(), "authentication failed") ||
+			strings.Contains(err.Error(), "does not exist") {
+			break
+		}
+		if connectTime == 0 && trace.IsLogging(logger.ERROR) {
+			trace.Error("Retrying to connect to postgres")
+		}
+		time.Sleep(10 * time.Second)
+	}
+	if err != nil {
+		db.Close()
+		return &Error{fmt.Sprintf("Failed to connect to postgres. Error: %s.", err)}
+	}
+
+	for _, statement := range postgresSchema {
+		if _, err := db.Exec(statement); err != nil {
+			db.Close()
+			return &Error{fmt.Sprintf("Failed to create the postgres schema. Error: %s.", err)}
+		}
+	}
+
+	store.db = db
+	store.connected = true
+	common.HealthStatus.ReconnectedToDatabase()
+	if trace.IsLogging(logger.INFO) {
+		trace.Info("Connected to the database")
+	}
+	if log.IsLogging(logger.INFO) {
+		log.Info("Connected to the database")
+	}
+
+	if store.DataStore != nil {
+		if err := store.DataStore.Init(); err != nil {
+			return err
+		}
+	}
+
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Successfully initialized postgres driver")
+	}
+
+	return nil
+}
+
+// Stop stops the PostgresStorage store
+func (store *PostgresStorage) Stop() {
+	if store.db != nil {
+		store.db.Close()
+	}
+}
+
+// PerformMaintenance performs store's maintenance
+func (store *PostgresStorage) PerformMaintenance() {
+	store.checkObjects()
+}
+
+// GetObjectsToActivate returns inactive objects that are ready to be activated
+func (store *PostgresStorage) GetObjectsToActivate() ([]common.MetaData, common.SyncServiceError) {
+	currentTime := time.Now().UTC().Format(time.RFC3339)
+	result, err := store.fetchObjects(store.db,
+		`WHERE status IN ($1, $2) AND (metadata->>'inactive')::boolean AND
+			metadata->>'activationTime' <> '' AND metadata->>'activationTime' <= $3`,
+		common.NotReadyToSend, common.ReadyToSend, currentTime)
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the objects to activate. Error: %s.", err)}
+	}
+
+	metaDatas := make([]common.MetaData, len(result))
+	for i, r := range result {
+		metaDatas[i] = r.metaData
+	}
+	return metaDatas, nil
+}
+
+// StoreObject stores an object
+// If the object already exists, return the changes in its destinations list (for CSS) - return the list of deleted destinations
+func (store *PostgresStorage) StoreObject(metaData common.MetaData, data []byte, status string) ([]common.StoreDestinationStatus, common.SyncServiceError) {
+	id := getObjectCollectionID(metaData)
+	if !metaData.NoData && data != nil {
+		if err := store.storeData(id, data); err != nil {
+			return nil, err
+		}
+	} else if !metaData.MetaOnly {
+		store.removeData(id)
+	}
+
+	if metaData.DestinationPolicy != nil {
+		metaData.DestinationPolicy.Timestamp = time.Now().UTC().UnixNano()
+	}
+
+	var dests []common.StoreDestinationStatus
+	var deletedDests []common.StoreDestinationStatus
+	if status == common.NotReadyToSend || status == common.ReadyToSend {
+		// The object was receieved from a service, i.e. this node is the origin of the object:
+		// set its instance id and create destinations array
+		newID := store.getInstanceID()
+		metaData.InstanceID = newID
+		if data != nil && !metaData.NoData && !metaData.MetaOnly {
+			metaData.DataID = newID
+		}
+
+		var err error
+		dests, deletedDests, err = createDestinationsFromMeta(store, metaData)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := store.withTx(func(tx *sql.Tx) error {
+		existingObject, err := store.fetchObject(tx, id, true)
+		if err != nil && err != sql.ErrNoRows {
+			return &Error{fmt.Sprintf("Failed to retrieve object's status. Error: %s.", err)}
+		}
+
+		if existingObject != nil {
+			if (metaData.DestinationPolicy != nil && existingObject.metaData.DestinationPolicy == nil) ||
+				(metaData.DestinationPolicy == nil && existingObject.metaData.DestinationPolicy != nil) {
+				return &common.InvalidRequest{Message: "Can't update the existence of Destination Policy"}
+			}
+			if metaData.MetaOnly {
+				metaData.DataID = existingObject.metaData.DataID
+				metaData.ObjectSize = existingObject.metaData.ObjectSize
+				metaData.ChunkSize = existingObject.metaData.ChunkSize
+			}
+			if metaData.DestinationPolicy != nil {
+				dests = existingObject.destinations
+			}
+		}
+
+		newObject := postgresObject{metaData: metaData, status: status, policyReceived: false,
+			remainingConsumers: metaData.ExpectedConsumers,
+			remainingReceivers: metaData.ExpectedConsumers, destinations: dests}
+		if err := store.upsertObject(tx, id, newObject); err != nil {
+			return &Error{fmt.Sprintf("Failed to store an object. Error: %s.", err)}
+		}
+		return nil
+	}, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return deletedDests, nil
+}
+
+// GetObjectDestinations gets destinations that the object has to be sent to
+func (store *PostgresStorage) GetObjectDestinations(metaData common.MetaData) ([]common.Destination, common.SyncServiceError) {
+	id := getObjectCollectionID(metaData)
+	result, err := store.fetchObject(store.db, id, false)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, nil
+		default:
+			return nil, &Error{fmt.Sprintf("Failed to retrieve object's destinations. Error: %s.", err)}
+		}
+	}
+	dests := make([]common.Destination, 0)
+	for _, d := range result.destinations {
+		dests = append(dests, d.Destination)
+	}
+	return dests, nil
+}
+
+// GetObjectDestinationsList gets destinations that the object has to be sent to and their status
+func (store *PostgresStorage) GetObjectDestinationsList(orgID string, objectType string,
+	objectID string) ([]common.StoreDestinationStatus, common.SyncServiceError) {
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	result, err := store.fetchObject(store.db, id, false)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, nil
+		default:
+			return nil, &Error{fmt.Sprintf("Failed to retrieve object's destinations. Error: %s.", err)}
+		}
+	}
+
+	return result.destinations, nil
+}
+
+// UpdateObjectDestinations updates object's destinations
+// Returns the meta data, object's status, an array of deleted destinations, and an array of added destinations
+func (store *PostgresStorage) UpdateObjectDestinations(orgID string, objectType string, objectID string, destinationsList []string) (*common.MetaData, string,
+	[]common.StoreDestinationStatus, []common.StoreDestinationStatus, common.SyncServiceError) {
+	var result *postgresObject
+	var deletedDests, addedDests []common.StoreDestinationStatus
+	id := createObjectCollectionID(orgID, objectType, objectID)
+
+	err := store.withTx(func(tx *sql.Tx) error {
+		var err error
+		if result, err = store.fetchObject(tx, id, true); err != nil {
+			return &Error{fmt.Sprintf("Failed to retrieve object's destinations. Error: %s.", err)}
+		}
+
+		var dests []common.StoreDestinationStatus
+		dests, deletedDests, addedDests, err = createDestinations(orgID, store, result.destinations, destinationsList)
+		if err != nil {
+			return err
+		}
+
+		if err := store.updateObjectDestinations(tx, id, dests); err != nil {
+			return &Error{fmt.Sprintf("Failed to update object's destinations. Error: %s.", err)}
+		}
+		return nil
+	}, false)
+	if err != nil {
+		return nil, "", nil, nil, err
+	}
+	return &result.metaData, result.status, deletedDests, addedDests, nil
+}
+
+// UpdateObjectDeliveryStatus changes the object's delivery status and message for the destination
+// Returns true if the status is Deleted and all the destinations are in status Deleted
+func (store *PostgresStorage) UpdateObjectDeliveryStatus(status string, message string, orgID string, objectType string, objectID string,
+	destType string, destID string) (bool, common.SyncServiceError) {
+	if status == "" && message == "" {
+		return false, nil
+	}
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	allDeleted := true
+
+	err := store.withTx(func(tx *sql.Tx) error {
+		result, err := store.fetchObject(tx, id, true)
+		if err != nil {
+			return &Error{fmt.Sprintf("Failed to retrieve object. Error: %s.", err)}
+		}
+		found := false
+		allConsumed := true
+		for i, d := range result.destinations {
+			if !found && d.Destination.DestType == destType && d.Destination.DestID == destID {
+				if message != "" || d.Status == common.Error {
+					d.Message = message
+				}
+				if status != "" {
+					d.Status = status
+				}
+				found = true
+				result.destinations[i] = d
+			} else {
+				if d.Status != common.Consumed {
+					allConsumed = false
+				}
+				if d.Status != common.Deleted {
+					allDeleted = false
+				}
+			}
+		}
+		if !found {
+			return &Error{"Failed to find destination."}
+		}
+
+		if result.metaData.AutoDelete && status == common.Consumed && allConsumed && result.metaData.Expiration == "" {
+			// Delete the object by setting its expiration time to one hour
+			result.metaData.Expiration = time.Now().Add(time.Hour * time.Duration(1)).UTC().Format(time.RFC3339)
+			if err := store.upsertObject(tx, id, *result); err != nil {
+				return &Error{fmt.Sprintf("Failed to update object's destinations. Error: %s.", err)}
+			}
+			return nil
+		}
+		if err := store.updateObjectDestinations(tx, id, result.destinations); err != nil {
+			return &Error{fmt.Sprintf("Failed to update object's destinations. Error: %s.", err)}
+		}
+		return nil
+	}, false)
+	if err != nil {
+		return false, err
+	}
+	return (allDeleted && status == common.Deleted), nil
+}
+
+// UpdateObjectDelivering marks the object as being delivered to all its destinations
+func (store *PostgresStorage) UpdateObjectDelivering(orgID string, objectType string, objectID string) common.SyncServiceError {
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	return store.withTx(func(tx *sql.Tx) error {
+		result, err := store.fetchObject(tx, id, true)
+		if err != nil {
+			return &Error{fmt.Sprintf("Failed to retrieve object. Error: %s.", err)}
+		}
+		for i, d := range result.destinations {
+			d.Status = common.Delivering
+			result.destinations[i] = d
+		}
+		if err := store.updateObjectDestinations(tx, id, result.destinations); err != nil {
+			return &Error{fmt.Sprintf("Failed to update object's destinations. Error: %s.", err)}
+		}
+		return nil
+	}, false)
+}
+
+// RetrieveObjectStatus finds the object and return its status
+func (store *PostgresStorage) RetrieveObjectStatus(orgID string, objectType string, objectID string) (string, common.SyncServiceError) {
+	var status string
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if err := store.fetchOne(store.db, "SELECT status FROM "+objects+" WHERE id = $1", []interface{}{id}, &status); err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return "", nil
+		default:
+			return "", &Error{fmt.Sprintf("Failed to retrieve object's status. Error: %s.", err)}
+		}
+	}
+	return status, nil
+}
+
+// RetrieveObjectRemainingConsumers finds the object and returns the number remaining consumers that
+// haven't consumed the object yet
+func (store *PostgresStorage) RetrieveObjectRemainingConsumers(orgID string, objectType string, objectID string) (int, common.SyncServiceError) {
+	var remainingConsumers int
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if err := store.fetchOne(store.db, "SELECT remaining_consumers FROM "+objects+" WHERE id = $1", []interface{}{id},
+		&remainingConsumers); err != nil {
+		return 0, &Error{fmt.Sprintf("Failed to retrieve object's remaining comsumers. Error: %s.", err)}
+	}
+	return remainingConsumers, nil
+}
+
+// DecrementAndReturnRemainingConsumers decrements the number of remaining consumers of the object
+func (store *PostgresStorage) DecrementAndReturnRemainingConsumers(orgID string, objectType string, objectID string) (int,
+	common.SyncServiceError) {
+	var remainingConsumers int
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if err := store.fetchOne(store.db,
+		"UPDATE "+objects+" SET remaining_consumers = remaining_consumers - 1, last_update = clock_timestamp() WHERE id = $1 RETURNING remaining_consumers",
+		[]interface{}{id}, &remainingConsumers); err != nil {
+		return 0, &Error{fmt.Sprintf("Failed to decrement object's remaining consumers. Error: %s.", err)}
+	}
+	return remainingConsumers, nil
+}
+
+// DecrementAndReturnRemainingReceivers decrements the number of remaining receivers of the object
+func (store *PostgresStorage) DecrementAndReturnRemainingReceivers(orgID string, objectType string, objectID string) (int,
+	common.SyncServiceError) {
+	var remainingReceivers int
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if err := store.fetchOne(store.db,
+		"UPDATE "+objects+" SET remaining_receivers = remaining_receivers - 1, last_update = clock_timestamp() WHERE id = $1 RETURNING remaining_receivers",
+		[]interface{}{id}, &remainingReceivers); err != nil {
+		return 0, &Error{fmt.Sprintf("Failed to decrement object's remaining receivers. Error: %s.", err)}
+	}
+	return remainingReceivers, nil
+}
+
+// ResetObjectRemainingConsumers sets the remaining consumers count to the original ExpectedConsumers value
+func (store *PostgresStorage) ResetObjectRemainingConsumers(orgID string, objectType string, objectID string) common.SyncServiceError {
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if err := store.update(
+		"UPDATE "+objects+" SET remaining_consumers = (metadata->>'consumers')::integer, last_update = clock_timestamp() WHERE id = $1",
+		id); err != nil {
+		return &Error{fmt.Sprintf("Failed to reset object's remaining comsumers. Error: %s.", err)}
+	}
+	return nil
+}
+
+// RetrieveUpdatedObjects returns the list of all the edge updated objects that are not marked as consumed or received
+// If received is true, return objects marked as received
+func (store *PostgresStorage) RetrieveUpdatedObjects(orgID string, objectType string, received bool, filter common.ObjectsFilter) ([]common.MetaData, common.SyncServiceError) {
+	var where string
+	var args []interface{}
+	if received {
+		where, args = postgresObjectsFilter("WHERE org_id = $1 AND object_type = $2 AND status IN ($3, $4, $5)",
+			filter, orgID, objectType, common.CompletelyReceived, common.ObjReceived, common.ObjDeleted)
+	} else {
+		where, args = postgresObjectsFilter("WHERE org_id = $1 AND object_type = $2 AND status IN ($3, $4)",
+			filter, orgID, objectType, common.CompletelyReceived, common.ObjDeleted)
+	}
+	result, err := store.fetchObjects(store.db, where, args...)
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the objects. Error: %s.", err)}
+	}
+
+	metaDatas := make([]common.MetaData, len(result))
+	for i, r := range result {
+		metaDatas[i] = r.metaData
+	}
+	return metaDatas, nil
+}
+
+// RetrieveObjectsWithDestinationPolicy returns the list of all the objects that have a Destination Policy
+// If received is true, return objects marked as policy received
+func (store *PostgresStorage) RetrieveObjectsWithDestinationPolicy(orgID string, received bool, filter common.ObjectsFilter) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
+	var where string
+	var args []interface{}
+	if received {
+		where, args = postgresObjectsFilter(
+			"WHERE org_id = $1 AND status <> $2 AND jsonb_typeof(metadata->'destinationPolicy') = 'object'",
+			filter, orgID, common.ObjDeleted)
+	} else {
+		where, args = postgresObjectsFilter(
+			"WHERE org_id = $1 AND NOT policy_received AND status <> $2 AND jsonb_typeof(metadata->'destinationPolicy') = 'object'",
+			filter, orgID, common.ObjDeleted)
+	}
+	return store.retrievePolicies(where, args...)
+}
+
+// RetrieveObjectsWithDestinationPolicyByService returns the list of all the object Policies for a particular service
+func (store *PostgresStorage) RetrieveObjectsWithDestinationPolicyByService(orgID, serviceOrgID, serviceName string) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
+	service, err := json.Marshal([]map[string]string{{"orgID": serviceOrgID, "serviceName": serviceName}})
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to marshal the service. Error: %s.", err)}
+	}
+	return store.retrievePolicies("WHERE org_id = $1 AND metadata->'destinationPolicy'->'services' @> $2::jsonb",
+		orgID, string(service))
+}
+
+// RetrieveObjectsWithDestinationPolicyUpdatedSince returns the list of all the objects that have a Destination Policy updated since the specified time
+func (store *PostgresStorage) RetrieveObjectsWithDestinationPolicyUpdatedSince(orgID string, since int64) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
+	return store.retrievePolicies(
+		`WHERE org_id = $1 AND jsonb_typeof(metadata->'destinationPolicy') = 'object' AND
+			(metadata->'destinationPolicy'->>'timestamp')::bigint >= $2`,
+		orgID, since)
+}
+
+// RetrieveObjectsWithDestinationGroup returns the list of all the objects whose destinations list includes the destination group
+func (store *PostgresStorage) RetrieveObjectsWithDestinationGroup(orgID string, name string) ([]common.MetaData, common.SyncServiceError) {
+	groupJSON, err := json.Marshal([]string{common.DestinationGroupPrefix + name})
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to marshal the destination group. Error: %s.", err)}
+	}
+	result, err := store.fetchObjects(store.db, "WHERE org_id = $1 AND metadata->'destinationsList' @> $2::JSONB", orgID, string(groupJSON))
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the objects. Error: %s.", err)}
+	}
+
+	metaDatas := make([]common.MetaData, len(result))
+	for i, r := range result {
+		metaDatas[i] = r.metaData
+	}
+	return metaDatas, nil
+}
+
+// RetrieveAllObjects returns the list of all the objects of the specified type
+func (store *PostgresStorage) RetrieveAllObjects(orgID string, objectType string, filter common.ObjectsFilter) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
+	where, args := postgresObjectsFilter("WHERE org_id = $1 AND object_type = $2", filter, orgID, objectType)
+	return store.retrievePolicies(where, args...)
+}
+
+// RetrieveObjects returns the list of all the objects that need to be sent to the destination.
+// Adds the new destination to the destinations lists of the relevant objects.
+func (store *PostgresStorage) RetrieveObjects(orgID string, destType string, destID string, resend int) ([]common.MetaData, common.SyncServiceError) {
+	var metaDatas []common.MetaData
+	err := store.withTx(func(tx *sql.Tx) error {
+		result, err := store.fetchObjects(tx, "WHERE org_id = $1 AND status IN ($2, $3) FOR UPDATE",
+			orgID, common.ReadyToSend, common.NotReadyToSend)
+		if err != nil {
+			return &Error{fmt.Sprintf("Failed to fetch the objects. Error: %s.", err)}
+		}
+
+		metaDatas = make([]common.MetaData, 0)
+		for _, r := range result {
+			if r.metaData.DestinationPolicy != nil {
+				continue
+			}
+			if (r.metaData.DestType == "" || r.metaData.DestType == destType) &&
+				(r.metaData.DestID == "" || r.metaData.DestID == destID) {
+				status := common.Pending
+				if r.status == common.ReadyToSend && !r.metaData.Inactive {
+					status = common.Delivering
+				}
+				needToUpdate := false
+				// Add destination if it doesn't exist
+				if dest, err := store.RetrieveDestination(orgID, destType, destID); err == nil {
+					existingDestIndex := -1
+					for i, d := range r.destinations {
+						if isSameDestination(d.Destination, *dest) {
+							existingDestIndex = i
+							break
+						}
+					}
+					if existingDestIndex != -1 {
+						d := r.destinations[existingDestIndex]
+						if status == common.Delivering &&
+							(resend == common.ResendAll || (resend == common.ResendDelivered && d.Status != common.Consumed) ||
+								(resend == common.ResendUndelivered && d.Status != common.Consumed && d.Status != common.Delivered)) {
+							metaDatas = append(metaDatas, r.metaData)
+							r.destinations[existingDestIndex].Status = common.Delivering
+							needToUpdate = true
+						}
+					} else {
+						if status == common.Delivering {
+							metaDatas = append(metaDatas, r.metaData)
+						}
+						needToUpdate = true
+						r.destinations = append(r.destinations, common.StoreDestinationStatus{Destination: *dest, Status: status})
+					}
+					if needToUpdate {
+						id := createObjectCollectionID(orgID, r.metaData.ObjectType, r.metaData.ObjectID)
+						if err := store.updateObjectDestinations(tx, id, r.destinations); err != nil {
+							return &Error{fmt.Sprintf("Failed to update object's destinations. Error: %s.", err)}
+						}
+					}
+				}
+			}
+		}
+		return nil
+	}, false)
+	if err != nil {
+		return nil, err
+	}
+	return metaDatas, nil
+}
+
+// RetrieveConsumedObjects returns all the consumed objects originated from this node
+// ESS only API
+func (store *PostgresStorage) RetrieveConsumedObjects() ([]common.ConsumedObject, common.SyncServiceError) {
+	return nil, nil
+}
+
+// RetrieveObject returns the object meta data with the specified parameters
+func (store *PostgresStorage) RetrieveObject(orgID string, objectType string, objectID string) (*common.MetaData, common.SyncServiceError) {
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	result, err := store.fetchObject(store.db, id, false)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, nil
+		default:
+			return nil, &Error{fmt.Sprintf("Failed to fetch the object. Error: %s.", err)}
+		}
+	}
+	return &result.metaData, nil
+}
+
+// RetrieveObjectAndStatus returns the object meta data and status with the specified parameters
+func (store *PostgresStorage) RetrieveObjectAndStatus(orgID string, objectType string, objectID string) (*common.MetaData, string, common.SyncServiceError) {
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	result, err := store.fetchObject(store.db, id, false)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, "", nil
+		default:
+			return nil, "", &Error{fmt.Sprintf("Failed to fetch the object. Error: %s.", err)}
+		}
+	}
+	return &result.metaData, result.status, nil
+}
+
+// RetrieveObjectData returns the object data with the specified parameters
+func (store *PostgresStorage) RetrieveObjectData(orgID string, objectType string, objectID string) (io.Reader, common.SyncServiceError) {
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if store.DataStore != nil {
+		dataReader, err := store.DataStore.GetData(id)
+		if err != nil {
+			if common.IsNotFound(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		return dataReader, nil
+	}
+	size, exists, err := store.dataSize(id)
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to open the data for reading. Error: %s.", err)}
+	}
+	if !exists {
+		return nil, nil
+	}
+	return &postgresDataReader{store: store, id: id, size: size}, nil
+}
+
+// CloseDataReader closes the data reader if necessary
+func (store *PostgresStorage) CloseDataReader(dataReader io.Reader) common.SyncServiceError {
+	if closer, ok := dataReader.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// ReadObjectData returns the object data with the specified parameters
+func (store *PostgresStorage) ReadObjectData(orgID string, objectType string, objectID string, size int, offset int64) ([]byte, bool, int, common.SyncServiceError) {
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if store.DataStore != nil {
+		return store.DataStore.GetDataChunk(id, size, offset)
+	}
+	dataSize, exists, err := store.dataSize(id)
+	if err != nil {
+		return nil, true, 0, &Error{fmt.Sprintf("Failed to read the data. Error: %s.", err)}
+	}
+	if !exists {
+		return nil, true, 0, &common.NotFound{}
+	}
+
+	if offset >= dataSize {
+		return make([]byte, 0), true, 0, nil
+	}
+
+	s := int64(size)
+	if s > dataSize-offset {
+		s = dataSize - offset
+	}
+	b, err := store.readData(id, int(s), offset)
+	if err != nil {
+		return nil, true, 0, &Error{fmt.Sprintf("Failed to read the data. Error: %s.", err)}
+	}
+	eof := false
+	if dataSize-offset == int64(len(b)) {
+		eof = true
+	}
+
+	return b, eof, len(b), nil
+}
+
+// StoreObjectData stores object's data
+// Return true if the object was found and updated
+// Return false and no error, if the object doesn't exist
+func (store *PostgresStorage) StoreObjectData(orgID string, objectType string, objectID string, dataReader io.Reader) (bool, common.SyncServiceError) {
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	var status string
+	if err := store.fetchOne(store.db, "SELECT status FROM "+objects+" WHERE id = $1", []interface{}{id}, &status); err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return false, nil
+		default:
+			return false, &Error{fmt.Sprintf("Failed to store the data. Error: %s.", err)}
+		}
+	}
+
+	if status == common.NotReadyToSend {
+		store.UpdateObjectStatus(orgID, objectType, objectID, common.ReadyToSend)
+	}
+	if status == common.NotReadyToSend || status == common.ReadyToSend {
+		newID := store.getInstanceID()
+		if err := store.update(
+			`UPDATE `+objects+` SET metadata = metadata || jsonb_build_object('dataID', $2::bigint, 'instanceID', $2::bigint),
+				last_update = clock_timestamp() WHERE id = $1`,
+			id, newID); err != nil {
+			return false, &Error{fmt.Sprintf("Failed to set instance id. Error: %s.", err)}
+		}
+	}
+
+	size, err := store.copyData(id, dataReader)
+	if err != nil {
+		return false, err
+	}
+
+	// Update object size
+	if err := store.update(
+		"UPDATE "+objects+" SET metadata = metadata || jsonb_build_object('objectSize', $2::bigint) WHERE id = $1",
+		id, size); err != nil {
+		return false, &Error{fmt.Sprintf("Failed to update object's size. Error: %s.", err)}
+	}
+
+	return true, nil
+}
+
+// AppendObjectData appends a chunk of data to the object's data
+func (store *PostgresStorage) AppendObjectData(orgID string, objectType string, objectID string, dataReader io.Reader,
+	dataLength uint32, offset int64, total int64, isFirstChunk bool, isLastChunk bool) common.SyncServiceError {
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if store.DataStore != nil {
+		return store.DataStore.AppendData(id, dataReader, dataLength, offset, total, isFirstChunk, isLastChunk)
+	}
+
+	var n int
+	var err error
+	var data []byte
+	if dataLength > 0 {
+		data = make([]byte, dataLength)
+		n, err = io.ReadFull(dataReader, data)
+	} else {
+		data, err = ioutil.ReadAll(dataReader)
+		n = len(data)
+	}
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to read the data from the dataReader. Error: %s.", err)}
+	}
+	if uint32(n) != dataLength && dataLength > 0 {
+		return &Error{fmt.Sprintf("Failed to read all the data from the dataReader. Read %d instead of %d.", n, dataLength)}
+	}
+
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace(" Put data (%d) in %s at offset %d\n", len(data), objectsData, offset)
+	}
+	return store.withTx(func(tx *sql.Tx) error {
+		if isFirstChunk {
+			if _, err := tx.Exec("DELETE FROM "+objectsData+" WHERE id = $1", id); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(
+			"INSERT INTO "+objectsData+" (id, chunk_offset, data) VALUES ($1, $2, $3) ON CONFLICT (id, chunk_offset) DO UPDATE SET data = EXCLUDED.data",
+			id, offset, data); err != nil {
+			return err
+		}
+		return nil
+	}, false)
+}
+
+// UpdateObjectStatus updates object's status
+func (store *PostgresStorage) UpdateObjectStatus(orgID string, objectType string, objectID string, status string) common.SyncServiceError {
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if err := store.update("UPDATE "+objects+" SET status = $2, last_update = clock_timestamp() WHERE id = $1", id, status); err != nil {
+		return &Error{fmt.Sprintf("Failed to update object's status. Error: %s.", err)}
+	}
+	return nil
+}
+
+// UpdateObjectSourceDataURI updates object's source data URI
+func (store *PostgresStorage) UpdateObjectSourceDataURI(orgID string, objectType string, objectID string, sourceDataURI string) common.SyncServiceError {
+	return nil
+}
+
+// UpdateObjectDataInfo updates the hash of object's data, its size as it was provided by the application, and whether it is encrypted
+func (store *PostgresStorage) UpdateObjectDataInfo(orgID string, objectType string, objectID string, dataHash string,
+	originalSize int64, encrypted bool) common.SyncServiceError {
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if err := store.update(
+		"UPDATE "+objects+" SET metadata = metadata || "+
+			"jsonb_build_object('dataHash', $2::text, 'originalSize', $3::bigint, 'encrypted', $4::boolean), "+
+			"last_update = clock_timestamp() WHERE id = $1",
+		id, dataHash, originalSize, encrypted); err != nil {
+		return &Error{fmt.Sprintf("Failed to update the hash and the size of object's data. Error: %s.", err)}
+	}
+	return nil
+}
+
+// MarkObjectDeleted marks the object as deleted
+func (store *PostgresStorage) MarkObjectDeleted(orgID string, objectType string, objectID string) common.SyncServiceError {
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if err := store.update(
+		`UPDATE `+objects+` SET status = $2, metadata = metadata || '{"deleted": true}'::jsonb, last_update = clock_timestamp()
+			WHERE id = $1`,
+		id, common.ObjDeleted); err != nil {
+		return &Error{fmt.Sprintf("Failed to mark object as deleted. Error: %s.", err)}
+	}
+	return nil
+}
+
+// MarkDestinationPolicyReceived marks an object's destination policy as having been received
+func (store *PostgresStorage) MarkDestinationPolicyReceived(orgID string, objectType string, objectID string) common.SyncServiceError {
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if err := store.update("UPDATE "+objects+" SET policy_received = TRUE, last_update = clock_timestamp() WHERE id = $1", id); err != nil {
+		return &Error{fmt.Sprintf("Failed to mark an object's destination policy as received. Error: %s", err)}
+	}
+	return nil
+}
+
+// ActivateObject marks object as active
+func (store *PostgresStorage) ActivateObject(orgID string, objectType string, objectID string) common.SyncServiceError {
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if err := store.update(
+		`UPDATE `+objects+` SET metadata = metadata || '{"inactive": false}'::jsonb, last_update = clock_timestamp() WHERE id = $1`,
+		id); err != nil {
+		return &Error{fmt.Sprintf("Failed to mark object as active. Error: %s.", err)}
+	}
+	return nil
+}
+
+// DeleteStoredObject deletes the object
+func (store *PostgresStorage) DeleteStoredObject(orgID string, objectType string, objectID string) common.SyncServiceError {
+	return store.deleteObject(orgID, objectType, objectID, nil)
+}
+
+// DeleteStoredData deletes the object's data
+func (store *PostgresStorage) DeleteStoredData(orgID string, objectType string, objectID string) common.SyncServiceError {
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Deleting object's data %s\n", id)
+	}
+	if err := store.removeData(id); err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Error in DeleteStoredData: failed to delete data. Error: %s\n", err)
+		}
+		return err
+	}
+	return nil
+}
+
+// CleanObjects removes the objects received from the other side.
+// For persistant storage only partially recieved objects are removed.
+func (store *PostgresStorage) CleanObjects() common.SyncServiceError {
+	// ESS only function
+	return nil
+}
+
+// GetNumberOfStoredObjects returns the number of objects received from the application that are
+// currently stored in this node's storage
+func (store *PostgresStorage) GetNumberOfStoredObjects() (uint32, common.SyncServiceError) {
+	var count uint32
+	if err := store.fetchOne(store.db, "SELECT count(*) FROM "+objects+" WHERE status IN ($1, $2)",
+		[]interface{}{common.ReadyToSend, common.NotReadyToSend}, &count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// RetrieveOrganizationsUsage returns the number of objects received from the application that are currently
+// stored in this node's storage and the total size of their data and the data of their versions,
+// for the organization with the provided orgID.
+// An empty orgID returns the usage of all the organizations that have stored objects.
+func (store *PostgresStorage) RetrieveOrganizationsUsage(orgID string) ([]common.OrganizationUsage, common.SyncServiceError) {
+	usage := newOrganizationsUsage(orgID)
+	err := store.fetchAll(store.db,
+		"SELECT org_id, count(*), COALESCE(SUM((metadata->>'objectSize')::BIGINT), 0) FROM "+objects+
+			" WHERE status IN ($1, $2) AND ($3 = '' OR org_id = $3) GROUP BY org_id",
+		[]interface{}{common.ReadyToSend, common.NotReadyToSend, orgID},
+		func(rows *sql.Rows) error {
+			var org common.OrganizationUsage
+			if err := rows.Scan(&org.OrgID, &org.StoredObjects, &org.StoredBytes); err != nil {
+				return err
+			}
+			usage.orgs[org.OrgID] = &org
+			return nil
+		})
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the usage of the organizations. Error: %s.", err)}
+	}
+
+	// Versions that share the data of another version are counted once, by the version that owns the data
+	err = store.fetchAll(store.db,
+		"SELECT version->'meta'->>'destinationOrgID', COALESCE(SUM((version->'meta'->>'objectSize')::BIGINT), 0) FROM "+
+			objectVersions+" WHERE has_data AND (data_id IS NULL OR data_id = '' OR data_id = id) AND "+
+			"($1 = '' OR version->'meta'->>'destinationOrgID' = $1) GROUP BY version->'meta'->>'destinationOrgID'",
+		[]interface{}{orgID},
+		func(rows *sql.Rows) error {
+			var versionsOrgID string
+			var size int64
+			if err := rows.Scan(&versionsOrgID, &size); err != nil {
+				return err
+			}
+			usage.addVersion(versionsOrgID, size)
+			return nil
+		})
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the usage of the organizations. Error: %s.", err)}
+	}
+	return usage.result(), nil
+}
+
+// AddWebhook stores a webhook for an object type, the secret and events of an existing webhook are replaced
+func (store *PostgresStorage) AddWebhook(orgID string, objectType string, webhook common.Webhook) common.SyncServiceError {
+	id := orgID + ":" + objectType
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Adding a webhook for %s\n", id)
+	}
+	url := webhook.URL
+	err := store.withTx(func(tx *sql.Tx) error {
+		hooks, settings, err := store.fetchWebhooks(tx, "SELECT hooks, secrets, events FROM "+webhooks+" WHERE id = $1 FOR UPDATE", id)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		// Don't add the webhook if it already is in the list
+		found := false
+		for _, hook := range hooks {
+			if url == hook {
+				found = true
+				break
+			}
+		}
+		if !found {
+			hooks = append(hooks, url)
+		}
+		if webhook.Secret == "" {
+			delete(settings.secrets, url)
+		} else {
+			settings.secrets[url] = webhook.Secret
+		}
+		if len(webhook.Events) == 0 {
+			delete(settings.events, url)
+		} else {
+			settings.events[url] = webhook.Events
+		}
+		secretsJSON, eventsJSON, err := settings.marshal()
+		if err != nil {
+			return err
+		}
+		return store.upsertStringList(tx,
+			"INSERT INTO "+webhooks+" (id, hooks, secrets, events, last_update) VALUES ($1, $2, $3, $4, clock_timestamp()) "+
+				"ON CONFLICT (id) DO UPDATE SET hooks = EXCLUDED.hooks, secrets = EXCLUDED.secrets, events = EXCLUDED.events, "+
+				"last_update = EXCLUDED.last_update",
+			id, hooks, secretsJSON, eventsJSON)
+	}, false)
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to add a webhook. Error: %s.", err)}
+	}
+	return nil
+}
+
+// DeleteWebhook deletes a webhook for an object type
+func (store *PostgresStorage) DeleteWebhook(orgID string, objectType string, url string) common.SyncServiceError {
+	id := orgID + ":" + objectType
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Deleting a webhook for %s\n", id)
+	}
+	err := store.withTx(func(tx *sql.Tx) error {
+		hooks, settings, err := store.fetchWebhooks(tx, "SELECT hooks, secrets, events FROM "+webhooks+" WHERE id = $1 FOR UPDATE", id)
+		if err != nil {
+			return err
+		}
+		deleted := false
+		for i, hook := range hooks {
+			if strings.EqualFold(hook, url) {
+				delete(settings.secrets, hook)
+				delete(settings.events, hook)
+				hooks[i] = hooks[len(hooks)-1]
+				hooks = hooks[:len(hooks)-1]
+				deleted = true
+				break
+			}
+		}
+		if !deleted {
+			return nil
+		}
+		secretsJSON, eventsJSON, err := settings.marshal()
+		if err != nil {
+			return err
+		}
+		return store.upsertStringList(tx,
+			"UPDATE "+webhooks+" SET hooks = $2, secrets = $3, events = $4, last_update = clock_timestamp() WHERE id = $1",
+			id, hooks, secretsJSON, eventsJSON)
+	}, false)
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to delete a webhook. Error: %s.", err)}
+	}
+	return nil
+}
+
+// RetrieveWebhooks gets the webhooks for the object type
+func (store *PostgresStorage) RetrieveWebhooks(orgID string, objectType string) ([]common.Webhook, common.SyncServiceError) {
+	id := orgID + ":" + objectType
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Retrieving a webhook for %s\n", id)
+	}
+	hooks, settings, err := store.fetchWebhooks(store.db, "SELECT hooks, secrets, events FROM "+webhooks+" WHERE id = $1", id)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if len(hooks) == 0 {
+		return nil, &NotFound{"No webhooks"}
+	}
+	result := make([]common.Webhook, 0, len(hooks))
+	for _, hook := range hooks {
+		result = append(result, common.Webhook{URL: hook, Secret: settings.secrets[hook], Events: settings.events[hook]})
+	}
+	return result, nil
+}
+
+// StoreWebhookDelivery stores a delivery to a webhook, replacing the delivery with the same ID
+func (store *PostgresStorage) StoreWebhookDelivery(delivery common.WebhookDelivery) common.SyncServiceError {
+	deliveryJSON, err := json.Marshal(delivery)
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to marshal a webhook delivery. Error: %s.", err)}
+	}
+	err = store.update(
+		"INSERT INTO "+deliveries+" (id, org_id, status, delivery) VALUES ($1, $2, $3, $4) "+
+			"ON CONFLICT (id) DO UPDATE SET status = EXCLUDED.status, delivery = EXCLUDED.delivery",
+		delivery.ID, delivery.OrgID, delivery.Status, string(deliveryJSON))
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to store a webhook delivery. Error: %s.", err)}
+	}
+	return nil
+}
+
+// DeleteWebhookDelivery deletes a delivery to a webhook
+func (store *PostgresStorage) DeleteWebhookDelivery(id string) common.SyncServiceError {
+	if err := store.update("DELETE FROM "+deliveries+" WHERE id = $1", id); err != nil {
+		return &Error{fmt.Sprintf("Failed to delete a webhook delivery. Error: %s.", err)}
+	}
+	return nil
+}
+
+// RetrieveWebhookDeliveries returns the deliveries to webhooks with the provided orgID and status.
+// An empty orgID or status matches all the deliveries.
+func (store *PostgresStorage) RetrieveWebhookDeliveries(orgID string, status string) ([]common.WebhookDelivery, common.SyncServiceError) {
+	result := make([]common.WebhookDelivery, 0)
+	err := store.fetchAll(store.db,
+		"SELECT delivery FROM "+deliveries+" WHERE ($1 = '' OR org_id = $1) AND ($2 = '' OR status = $2)",
+		[]interface{}{orgID, status},
+		func(rows *sql.Rows) error {
+			var deliveryJSON []byte
+			if err := rows.Scan(&deliveryJSON); err != nil {
+				return err
+			}
+			delivery := common.WebhookDelivery{}
+			if err := json.Unmarshal(deliveryJSON, &delivery); err != nil {
+				return err
+			}
+			result = append(result, delivery)
+			return nil
+		})
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the webhook deliveries. Error: %s.", err)}
+	}
+	return result, nil
+}
+
+// StoreDestinationGroup stores a destination group, replacing the destinations of an existing group
+func (store *PostgresStorage) StoreDestinationGroup(group common.DestinationGroup) common.SyncServiceError {
+	groupJSON, err := json.Marshal(group)
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to marshal a destination group. Error: %s.", err)}
+	}
+	err = store.update(
+		"INSERT INTO "+destinationGroups+" (id, org_id, destination_group) VALUES ($1, $2, $3) "+
+			"ON CONFLICT (id) DO UPDATE SET destination_group = EXCLUDED.destination_group",
+		group.OrgID+":"+group.Name, group.OrgID, string(groupJSON))
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to store a destination group. Error: %s.", err)}
+	}
+	return nil
+}
+
+// RetrieveDestinationGroup returns a destination group, or nil if the group doesn't exist
+func (store *PostgresStorage) RetrieveDestinationGroup(orgID string, name string) (*common.DestinationGroup, common.SyncServiceError) {
+	result, err := store.retrieveDestinationGroups("SELECT destination_group FROM "+destinationGroups+" WHERE id = $1", orgID+":"+name)
+	if err != nil || len(result) == 0 {
+		return nil, err
+	}
+	return &result[0], nil
+}
+
+// RetrieveDestinationGroups returns the destination groups of an organization
+func (store *PostgresStorage) RetrieveDestinationGroups(orgID string) ([]common.DestinationGroup, common.SyncServiceError) {
+	return store.retrieveDestinationGroups("SELECT destination_group FROM "+destinationGroups+" WHERE org_id = $1", orgID)
+}
+
+func (store *PostgresStorage) retrieveDestinationGroups(query string, args ...interface{}) ([]common.DestinationGroup, common.SyncServiceError) {
+	result := make([]common.DestinationGroup, 0)
+	err := store.fetchAll(store.db, query, args,
+		func(rows *sql.Rows) error {
+			var groupJSON []byte
+			if err := rows.Scan(&groupJSON); err != nil {
+				return err
+			}
+			group := common.DestinationGroup{}
+			if err := json.Unmarshal(groupJSON, &group); err != nil {
+				return err
+			}
+			result = append(result, group)
+			return nil
+		})
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the destination groups. Error: %s.", err)}
+	}
+	return result, nil
+}
+
+// DeleteDestinationGroup deletes a destination group
+func (store *PostgresStorage) DeleteDestinationGroup(orgID string, name string) common.SyncServiceError {
+	if err := store.update("DELETE FROM "+destinationGroups+" WHERE id = $1", orgID+":"+name); err != nil {
+		return &Error{fmt.Sprintf("Failed to delete a destination group. Error: %s.", err)}
+	}
+	return nil
+}
+
+// StoreRollout stores the state of the rollout of an object, replacing the object's previous rollout state
+func (store *PostgresStorage) StoreRollout(rollout common.RolloutStatus) common.SyncServiceError {
+	rolloutJSON, err := json.Marshal(rollout)
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to marshal a rollout. Error: %s.", err)}
+	}
+	err = store.update(
+		"INSERT INTO "+rollouts+" (id, status, rollout) VALUES ($1, $2, $3) "+
+			"ON CONFLICT (id) DO UPDATE SET status = EXCLUDED.status, rollout = EXCLUDED.rollout",
+		createObjectCollectionID(rollout.OrgID, rollout.ObjectType, rollout.ObjectID), rollout.Status, string(rolloutJSON))
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to store a rollout. Error: %s.", err)}
+	}
+	return nil
+}
+
+// RetrieveRollout returns the state of the rollout of an object, or nil if the object has no rollout state
+func (store *PostgresStorage) RetrieveRollout(orgID string, objectType string, objectID string) (*common.RolloutStatus, common.SyncServiceError) {
+	result, err := store.retrieveRollouts("SELECT rollout FROM "+rollouts+" WHERE id = $1",
+		createObjectCollectionID(orgID, objectType, objectID))
+	if err != nil || len(result) == 0 {
+		return nil, err
+	}
+	return &result[0], nil
+}
+
+// RetrieveRollouts returns the states of the rollouts with the provided status. An empty status matches all the rollouts.
+func (store *PostgresStorage) RetrieveRollouts(status string) ([]common.RolloutStatus, common.SyncServiceError) {
+	return store.retrieveRollouts("SELECT rollout FROM "+rollouts+" WHERE ($1 = '' OR status = $1)", status)
+}
+
+func (store *PostgresStorage) retrieveRollouts(query string, args ...interface{}) ([]common.RolloutStatus, common.SyncServiceError) {
+	result := make([]common.RolloutStatus, 0)
+	err := store.fetchAll(store.db, query, args,
+		func(rows *sql.Rows) error {
+			var rolloutJSON []byte
+			if err := rows.Scan(&rolloutJSON); err != nil {
+				return err
+			}
+			rollout := common.RolloutStatus{}
+			if err := json.Unmarshal(rolloutJSON, &rollout); err != nil {
+				return err
+			}
+			result = append(result, rollout)
+			return nil
+		})
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the rollouts. Error: %s.", err)}
+	}
+	return result, nil
+}
+
+// DeleteRollout deletes the state of the rollout of an object
+func (store *PostgresStorage) DeleteRollout(orgID string, objectType string, objectID string) common.SyncServiceError {
+	if err := store.update("DELETE FROM "+rollouts+" WHERE id = $1", createObjectCollectionID(orgID, objectType, objectID)); err != nil {
+		return &Error{fmt.Sprintf("Failed to delete a rollout. Error: %s.", err)}
+	}
+	return nil
+}
+
+// StoreObjectVersion stores the current version of an object in the object's version history before the object is replaced,
+// and removes the oldest versions of the object so that at most maxVersions versions are kept
+func (store *PostgresStorage) StoreObjectVersion(version common.ObjectVersion, maxVersions int) common.SyncServiceError {
+	metaData := version.MetaData
+	objectID := createObjectCollectionID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	id := createObjectVersionID(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID, version.Version)
+	versions, err := store.retrieveObjectVersions(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if err != nil {
+		return err
+	}
+	var dataID string
+	if !metaData.NoData {
+		for _, v := range versions {
+			if v.dataID() != "" && hasSameObjectVersionData(version, v.version) {
+				dataID = v.dataID()
+				break
+			}
+		}
+		if dataID == "" {
+			copied, err := store.copyStoredData(objectID, id)
+			if err != nil {
+				return err
+			}
+			if copied {
+				dataID = id
+			}
+		}
+	}
+	versionJSON, err := json.Marshal(version)
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to marshal a version of an object. Error: %s.", err)}
+	}
+	err = store.update(
+		"INSERT INTO "+objectVersions+" (id, object_id, has_data, data_id, version) VALUES ($1, $2, $3, $4, $5) "+
+			"ON CONFLICT (id) DO UPDATE SET has_data = EXCLUDED.has_data, data_id = EXCLUDED.data_id, version = EXCLUDED.version",
+		id, objectID, dataID != "", dataID, string(versionJSON))
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to store a version of an object. Error: %s.", err)}
+	}
+
+	versions, err = store.retrieveObjectVersions(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+	if err != nil || len(versions) <= maxVersions {
+		return err
+	}
+	return store.deleteObjectVersions(versions[maxVersions:], versions[:maxVersions])
+}
+
+// RetrieveObjectVersions returns the versions in the version history of an object, from the newest to the oldest
+func (store *PostgresStorage) RetrieveObjectVersions(orgID string, objectType string, objectID string) ([]common.ObjectVersion, common.SyncServiceError) {
+	versions, err := store.retrieveObjectVersions(orgID, objectType, objectID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]common.ObjectVersion, 0, len(versions))
+	for _, v := range versions {
+		result = append(result, v.version)
+	}
+	return result, nil
+}
+
+// RetrieveObjectVersionData returns the data of a version of an object, or nil if the version has no data
+func (store *PostgresStorage) RetrieveObjectVersionData(orgID string, objectType string, objectID string, version int64) ([]byte, common.SyncServiceError) {
+	v := postgresObjectVersion{id: createObjectVersionID(orgID, objectType, objectID, version)}
+	var dataID sql.NullString
+	if err := store.fetchOne(store.db, "SELECT has_data, data_id FROM "+objectVersions+" WHERE id = $1", []interface{}{v.id},
+		&v.hasData, &dataID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, &Error{fmt.Sprintf("Failed to fetch a version of an object. Error: %s.", err)}
+	}
+	v.sharedDataID = dataID.String
+	id := v.dataID()
+	if id == "" {
+		return nil, nil
+	}
+	if store.DataStore != nil {
+		dataReader, err := store.DataStore.GetData(id)
+		if err != nil {
+			return nil, err
+		}
+		defer store.CloseDataReader(dataReader)
+		data, err := ioutil.ReadAll(dataReader)
+		if err != nil {
+			return nil, &Error{fmt.Sprintf("Failed to read the data of a version of an object. Error: %s.", err)}
+		}
+		return data, nil
+	}
+	size, _, err := store.dataSize(id)
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to read the data of a version of an object. Error: %s.", err)}
+	}
+	data, err := store.readData(id, int(size), 0)
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to read the data of a version of an object. Error: %s.", err)}
+	}
+	return data, nil
+}
+
+// DeleteObjectVersions deletes the version history of an object
+func (store *PostgresStorage) DeleteObjectVersions(orgID string, objectType string, objectID string) common.SyncServiceError {
+	versions, err := store.retrieveObjectVersions(orgID, objectType, objectID)
+	if err != nil {
+		return err
+	}
+	return store.deleteObjectVersions(versions, nil)
+}
+
+type postgresObjectVersion struct {
+	id           string
+	hasData      bool
+	sharedDataID string
+	version      common.ObjectVersion
+}
+
+// dataID returns the ID of the data of a version, which may be the data of another version of the object,
+// or an empty ID if the version has no data
+func (v postgresObjectVersion) dataID() string {
+	if v.sharedDataID != "" {
+		return v.sharedDataID
+	}
+	if v.hasData {
+		return v.id
+	}
+	return ""
+}
+
+// retrieveObjectVersions returns the versions of an object from the newest to the oldest
+func (store *PostgresStorage) retrieveObjectVersions(orgID string, objectType string, objectID string) ([]postgresObjectVersion, common.SyncServiceError) {
+	versions := make([]postgresObjectVersion, 0)
+	err := store.fetchAll(store.db, "SELECT id, has_data, data_id, version FROM "+objectVersions+" WHERE object_id = $1",
+		[]interface{}{createObjectCollectionID(orgID, objectType, objectID)},
+		func(rows *sql.Rows) error {
+			var v postgresObjectVersion
+			var dataID sql.NullString
+			var versionJSON []byte
+			if err := rows.Scan(&v.id, &v.hasData, &dataID, &versionJSON); err != nil {
+				return err
+			}
+			v.sharedDataID = dataID.String
+			if err := json.Unmarshal(versionJSON, &v.version); err != nil {
+				return err
+			}
+			versions = append(versions, v)
+			return nil
+		})
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the versions of an object. Error: %s.", err)}
+	}
+	sort.Slice(versions, func(i int, j int) bool {
+		return isNewerObjectVersion(versions[i].version, versions[j].version)
+	})
+	return versions, nil
+}
+
+// deleteObjectVersions deletes versions of an object and their data, except for the data shared with the kept versions
+func (store *PostgresStorage) deleteObjectVersions(versions []postgresObjectVersion, kept []postgresObjectVersion) common.SyncServiceError {
+	keptData := make(map[string]bool)
+	for _, v := range kept {
+		keptData[v.dataID()] = true
+	}
+	for _, v := range versions {
+		if dataID := v.dataID(); dataID != "" && !keptData[dataID] {
+			if err := store.removeData(dataID); err != nil && !common.IsNotFound(err) {
+				return err
+			}
+			// Data shared by several of the deleted versions is deleted once
+			keptData[dataID] = true
+		}
+		if err := store.update("DELETE FROM "+objectVersions+" WHERE id = $1", v.id); err != nil {
+			return &Error{fmt.Sprintf("Failed to delete a version of an object. Error: %s.", err)}
+		}
+	}
+	return nil
+}
+
+// StoreAuditEntry stores an entry of the audit log
+func (store *PostgresStorage) StoreAuditEntry(entry common.AuditEntry) common.SyncServiceError {
+	entryJSON, err := json.Marshal(entry)
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to marshal an audit log entry. Error: %s.", err)}
+	}
+	err = store.update(
+		"INSERT INTO "+auditLog+" (id, org_id, timestamp, entry) VALUES ($1, $2, $3, $4) "+
+			"ON CONFLICT (id) DO UPDATE SET org_id = EXCLUDED.org_id, timestamp = EXCLUDED.timestamp, entry = EXCLUDED.entry",
+		entry.ID, entry.OrgID, entry.Timestamp, string(entryJSON))
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to store an audit log entry. Error: %s.", err)}
+	}
+	return nil
+}
+
+// RetrieveAuditEntries returns the entries of the audit log with the provided orgID and timestamps in the range [from, to),
+// sorted by their timestamps. An empty orgID matches all the entries, and a zero from or to leaves the range open.
+func (store *PostgresStorage) RetrieveAuditEntries(orgID string, from time.Time, to time.Time) ([]common.AuditEntry, common.SyncServiceError) {
+	result := make([]common.AuditEntry, 0)
+	err := store.fetchAll(store.db,
+		"SELECT entry FROM "+auditLog+" WHERE ($1 = '' OR org_id = $1) AND ($2 OR timestamp >= $3) AND ($4 OR timestamp < $5) "+
+			"ORDER BY timestamp",
+		[]interface{}{orgID, from.IsZero(), from, to.IsZero(), to},
+		func(rows *sql.Rows) error {
+			var entryJSON []byte
+			if err := rows.Scan(&entryJSON); err != nil {
+				return err
+			}
+			entry := common.AuditEntry{}
+			if err := json.Unmarshal(entryJSON, &entry); err != nil {
+				return err
+			}
+			result = append(result, entry)
+			return nil
+		})
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the audit log entries. Error: %s.", err)}
+	}
+	return result, nil
+}
+
+// DeleteAuditEntries deletes the entries of the audit log with timestamps before the provided time
+func (store *PostgresStorage) DeleteAuditEntries(before time.Time) common.SyncServiceError {
+	if err := store.update("DELETE FROM "+auditLog+" WHERE timestamp < $1", before); err != nil {
+		return &Error{fmt.Sprintf("Failed to delete the audit log entries. Error: %s.", err)}
+	}
+	return nil
+}
+
+// RetrieveDestinations returns all the destinations with the provided orgID and destType
+func (store *PostgresStorage) RetrieveDestinations(orgID string, destType string) ([]common.Destination, common.SyncServiceError) {
+	var dests []common.Destination
+	var err error
+
+	if orgID == "" {
+		if destType == "" {
+			dests, err = store.fetchDestinations("")
+		} else {
+			dests, err = store.fetchDestinations("WHERE dest_type = $1", destType)
+		}
+	} else {
+		if destType == "" {
+			dests, err = store.fetchDestinations("WHERE org_id = $1", orgID)
+		} else {
+			dests, err = store.fetchDestinations("WHERE org_id = $1 AND dest_type = $2", orgID, destType)
+		}
+	}
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the destinations. Error: %s.", err)}
+	}
+	return dests, nil
+}
+
+// DestinationExists returns true if the destination exists, and false otherwise
+func (store *PostgresStorage) DestinationExists(orgID string, destType string, destID string) (bool, common.SyncServiceError) {
+	var exists bool
+	id := createDestinationCollectionID(orgID, destType, destID)
+	if err := store.fetchOne(store.db, "SELECT EXISTS (SELECT 1 FROM "+destinations+" WHERE id = $1)", []interface{}{id},
+		&exists); err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+// StoreDestination stores the destination
+func (store *PostgresStorage) StoreDestination(destination common.Destination) common.SyncServiceError {
+	id := getDestinationCollectionID(destination)
+	destinationJSON, err := json.Marshal(destination)
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to marshal the destination. Error: %s.", err)}
+	}
+	if err := store.update(
+		"INSERT INTO "+destinations+" (id, org_id, dest_type, dest_id, destination) VALUES ($1, $2, $3, $4, $5) "+
+			"ON CONFLICT (id) DO UPDATE SET destination = EXCLUDED.destination",
+		id, destination.DestOrgID, destination.DestType, destination.DestID, string(destinationJSON)); err != nil {
+		return &Error{fmt.Sprintf("Failed to store a destination. Error: %s.", err)}
+	}
+	return nil
+}
+
+// DeleteDestination deletes the destination
+func (store *PostgresStorage) DeleteDestination(orgID string, destType string, destID string) common.SyncServiceError {
+	id := createDestinationCollectionID(orgID, destType, destID)
+	if err := store.update("DELETE FROM "+destinations+" WHERE id = $1", id); err != nil {
+		return &Error{fmt.Sprintf("Failed to delete destination. Error: %s.", err)}
+	}
+	return nil
+}
+
+// UpdateDestinationLastPingTime updates the last ping time for the destination
+func (store *PostgresStorage) UpdateDestinationLastPingTime(destination common.Destination) common.SyncServiceError {
+	id := getDestinationCollectionID(destination)
+	updated, err := store.updateAndCount("UPDATE "+destinations+" SET last_ping_time = clock_timestamp() WHERE id = $1", id)
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to update the last ping time for destination. Error: %s\n", err)}
+	}
+	if updated == 0 {
+		return &NotFound{}
+	}
+
+	return nil
+}
+
+// RemoveInactiveDestinations removes destinations that haven't sent ping since the provided timestamp
+func (store *PostgresStorage) RemoveInactiveDestinations(lastTimestamp time.Time) {
+	dests, err := store.fetchDestinations("WHERE last_ping_time <= $1", lastTimestamp)
+	if err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Error in postgresStorage.RemoveInactiveDestinations: failed to remove inactive destinations. Error: %s\n", err)
+		}
+		return
+	}
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Removing inactive destinations")
+	}
+	for _, d := range dests {
+		if err := store.DeleteNotificationRecords(d.DestOrgID, "", "", d.DestType, d.DestID); err != nil && log.IsLogging(logger.ERROR) {
+			log.Error("Error in postgresStorage.RemoveInactiveDestinations: failed to remove notifications for inactive destinations. Error: %s\n", err)
+		}
+		if err := store.DeleteDestination(d.DestOrgID, d.DestType, d.DestID); err != nil && log.IsLogging(logger.ERROR) {
+			log.Error("Error in postgresStorage.RemoveInactiveDestinations: failed to remove inactive destination. Error: %s\n", err)
+		}
+	}
+}
+
+// GetNumberOfDestinations returns the number of currently registered ESS nodes (for CSS)
+func (store *PostgresStorage) GetNumberOfDestinations() (uint32, common.SyncServiceError) {
+	var count uint32
+	if err := store.fetchOne(store.db, "SELECT count(*) FROM "+destinations, nil, &count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// RetrieveDestinationProtocol retrieves the communication protocol for the destination
+func (store *PostgresStorage) RetrieveDestinationProtocol(orgID string, destType string, destID string) (string, common.SyncServiceError) {
+	var protocol string
+	id := createDestinationCollectionID(orgID, destType, destID)
+	if err := store.fetchOne(store.db, "SELECT destination->>'communication' FROM "+destinations+" WHERE id = $1",
+		[]interface{}{id}, &protocol); err != nil {
+		return "", &Error{fmt.Sprintf("Failed to fetch the destination. Error: %s.", err)}
+	}
+	return protocol, nil
+}
+
+// RetrieveDestination retrieves a destination
+func (store *PostgresStorage) RetrieveDestination(orgID string, destType string, destID string) (*common.Destination, common.SyncServiceError) {
+	id := createDestinationCollectionID(orgID, destType, destID)
+	dests, err := store.fetchDestinations("WHERE id = $1", id)
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the destination. Error: %s.", err)}
+	}
+	if len(dests) == 0 {
+		return nil, &NotFound{fmt.Sprintf(" The destination %s:%s does not exist", destType, destID)}
+	}
+	return &dests[0], nil
+}
+
+// GetObjectsForDestination retrieves objects that are in use on a given node
+func (store *PostgresStorage) GetObjectsForDestination(orgID string, destType string, destID string) ([]common.ObjectStatus, common.SyncServiceError) {
+	notificationRecords, err := store.fetchNotifications(
+		"WHERE org_id = $1 AND dest_id = $2 AND dest_type = $3 AND status IN ($4, $5, $6, $7, $8, $9)",
+		orgID, destID, destType, common.Update, common.UpdatePending, common.Updated, common.ReceivedByDestination,
+		common.ConsumedByDestination, common.Error)
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the notifications. Error: %s.", err)}
+	}
+
+	var status string
+	objectStatuses := make([]common.ObjectStatus, 0)
+	for _, n := range notificationRecords {
+		switch n.Status {
+		case common.Update:
+			status = common.Delivering
+		case common.UpdatePending:
+			status = common.Delivering
+		case common.Updated:
+			status = common.Delivering
+		case common.ReceivedByDestination:
+			status = common.Delivered
+		case common.ConsumedByDestination:
+			status = common.Consumed
+		case common.Error:
+			status = common.Error
+		}
+		objectStatus := common.ObjectStatus{OrgID: orgID, ObjectType: n.ObjectType, ObjectID: n.ObjectID, Status: status}
+		objectStatuses = append(objectStatuses, objectStatus)
+	}
+	return objectStatuses, nil
+}
+
+// UpdateNotificationRecord updates/adds a notification record to the object
+func (store *PostgresStorage) UpdateNotificationRecord(notification common.Notification) common.SyncServiceError {
+	id := getNotificationCollectionID(&notification)
+	if notification.ResendTime == 0 {
+		resendTime := time.Now().Unix() + int64(common.Configuration.ResendInterval*6)
+		notification.ResendTime = resendTime
+	}
+	err := store.update(
+		`INSERT INTO `+notifications+` (id, org_id, object_type, object_id, dest_type, dest_id, status, instance_id, data_id, resend_time)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			ON CONFLICT (id) DO UPDATE SET status = EXCLUDED.status, instance_id = EXCLUDED.instance_id,
+				data_id = EXCLUDED.data_id, resend_time = EXCLUDED.resend_time`,
+		id, notification.DestOrgID, notification.ObjectType, notification.ObjectID, notification.DestType, notification.DestID,
+		notification.Status, notification.InstanceID, notification.DataID, notification.ResendTime)
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to update notification record. Error: %s.", err)}
+	}
+	return nil
+}
+
+// UpdateNotificationResendTime sets the resend time of the notification to common.Configuration.ResendInterval*6
+func (store *PostgresStorage) UpdateNotificationResendTime(notification common.Notification) common.SyncServiceError {
+	id := getNotificationCollectionID(&notification)
+	resendTime := time.Now().Unix() + int64(common.Configuration.ResendInterval*6)
+	if err := store.update("UPDATE "+notifications+" SET resend_time = $2 WHERE id = $1", id, resendTime); err != nil {
+		return &Error{fmt.Sprintf("Failed to update notification resend time. Error: %s.", err)}
+	}
+	return nil
+}
+
+// RetrieveNotificationRecord retrieves notification
+func (store *PostgresStorage) RetrieveNotificationRecord(orgID string, objectType string, objectID string, destType string,
+	destID string) (*common.Notification, common.SyncServiceError) {
+	id := createNotificationCollectionID(orgID, objectType, objectID, destType, destID)
+	result, err := store.fetchNotifications("WHERE id = $1", id)
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the notification. Error: %s.", err)}
+	}
+	if len(result) == 0 {
+		return nil, nil
+	}
+	return &result[0], nil
+}
+
+// DeleteNotificationRecords deletes notification records to an object
+func (store *PostgresStorage) DeleteNotificationRecords(orgID string, objectType string, objectID string, destType string, destID string) common.SyncServiceError {
+	var err error
+	if objectType != "" && objectID != "" {
+		if destType != "" && destID != "" {
+			id := createNotificationCollectionID(orgID, objectType, objectID, destType, destID)
+			err = store.update("DELETE FROM "+notifications+" WHERE id = $1", id)
+		} else {
+			err = store.update("DELETE FROM "+notifications+" WHERE org_id = $1 AND object_type = $2 AND object_id = $3",
+				orgID, objectType, objectID)
+		}
+	} else {
+		err = store.update("DELETE FROM "+notifications+" WHERE org_id = $1 AND dest_type = $2 AND dest_id = $3",
+			orgID, destType, destID)
+	}
+
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to delete notification records. Error: %s.", err)}
+	}
+	return nil
+}
+
+// RetrieveNotifications returns the list of all the notifications that need to be resent to the destination
+func (store *PostgresStorage) RetrieveNotifications(orgID string, destType string, destID string, retrieveReceived bool) ([]common.Notification, common.SyncServiceError) {
+	var result []common.Notification
+	var err error
+	if destType == "" && destID == "" {
+		currentTime := time.Now().Unix()
+		result, err = store.fetchNotifications(
+			"WHERE status = $1 OR (resend_time <= $2 AND status IN ($3, $4, $5, $6, $7, $8))",
+			common.Getdata, currentTime, common.Update, common.Received, common.Consumed, common.Getdata,
+			common.Delete, common.Deleted)
+	} else {
+		if retrieveReceived {
+			result, err = store.fetchNotifications(
+				"WHERE org_id = $1 AND dest_id = $2 AND dest_type = $3 AND status IN ($4, $5, $6, $7, $8, $9, $10, $11)",
+				orgID, destID, destType, common.Update, common.Received, common.Consumed, common.Getdata, common.Data,
+				common.ReceivedByDestination, common.Delete, common.Deleted)
+		} else {
+			result, err = store.fetchNotifications(
+				"WHERE org_id = $1 AND dest_id = $2 AND dest_type = $3 AND status IN ($4, $5, $6, $7, $8, $9)",
+				orgID, destID, destType, common.Update, common.Received, common.Consumed, common.Getdata,
+				common.Delete, common.Deleted)
+		}
+	}
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the notifications. Error: %s.", err)}
+	}
+	return result, nil
+}
+
+// RetrievePendingNotifications returns the list of pending notifications that are waiting to be sent to the destination
+func (store *PostgresStorage) RetrievePendingNotifications(orgID string, destType string, destID string) ([]common.Notification, common.SyncServiceError) {
+	var result []common.Notification
+	var err error
+
+	if destType == "" && destID == "" {
+		result, err = store.fetchNotifications("WHERE org_id = $1 AND status IN ($2, $3, $4, $5)",
+			orgID, common.UpdatePending, common.ConsumedPending, common.DeletePending, common.DeletedPending)
+	} else {
+		result, err = store.fetchNotifications(
+			"WHERE org_id = $1 AND dest_id = $2 AND dest_type = $3 AND status IN ($4, $5, $6, $7)",
+			orgID, destID, destType, common.UpdatePending, common.ConsumedPending, common.DeletePending, common.DeletedPending)
+	}
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the notifications. Error: %s.", err)}
+	}
+	return result, nil
+}
+
+// GetNumberOfNotificationsByStatus returns the number of notifications in each status
+func (store *PostgresStorage) GetNumberOfNotificationsByStatus() (map[string]uint32, common.SyncServiceError) {
+	result := make(map[string]uint32)
+	function := func(rows *sql.Rows) error {
+		var status string
+		var count uint32
+		if err := rows.Scan(&status, &count); err != nil {
+			return err
+		}
+		result[status] = count
+		return nil
+	}
+	if err := store.fetchAll(store.db, "SELECT status, count(*) FROM "+notifications+" GROUP BY status", nil, function); err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to count the notifications. Error: %s.", err)}
+	}
+	return result, nil
+}
+
+// InsertInitialLeader inserts the initial leader entry if the table is empty
+func (store *PostgresStorage) InsertInitialLeader(leaderID string) (bool, common.SyncServiceError) {
+	inserted, err := store.updateAndCount(
+		"INSERT INTO "+leader+" (id, uuid, last_heartbeat_ts, heartbeat_timeout, version) VALUES (1, $1, clock_timestamp(), $2, 1) "+
+			"ON CONFLICT (id) DO NOTHING",
+		leaderID, common.Configuration.LeadershipTimeout)
+	if err != nil {
+		return false, &Error{fmt.Sprintf("Failed to insert a row into the syncLeaderElection table. Error: %s\n", err)}
+	}
+
+	return inserted != 0, nil
+}
+
+// LeaderPeriodicUpdate does the periodic update of the leader entry by the leader
+func (store *PostgresStorage) LeaderPeriodicUpdate(leaderID string) (bool, common.SyncServiceError) {
+	updated, err := store.updateAndCount(
+		"UPDATE "+leader+" SET last_heartbeat_ts = clock_timestamp() WHERE id = 1 AND uuid = $1", leaderID)
+	if err != nil {
+		return false, &Error{fmt.Sprintf("Failed to update the row in the syncLeaderElection table. Error: %s\n", err)}
+	}
+
+	return updated != 0, nil
+}
+
+// RetrieveLeader retrieves the Heartbeat timeout and Last heartbeat time stamp from the leader entry
+func (store *PostgresStorage) RetrieveLeader() (string, int32, time.Time, int64, common.SyncServiceError) {
+	var uuid string
+	var heartbeatTimeout int32
+	var lastHeartbeatTS time.Time
+	var version int64
+	err := store.fetchOne(store.db, "SELECT uuid, heartbeat_timeout, last_heartbeat_ts, version FROM "+leader+" WHERE id = 1", nil,
+		&uuid, &heartbeatTimeout, &lastHeartbeatTS, &version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", 0, time.Now(), 0, &NotFound{}
+		}
+		return "", 0, time.Now(), 0, &Error{fmt.Sprintf("Failed to fetch the row in the syncLeaderElection table. Error: %s", err)}
+	}
+	return uuid, heartbeatTimeout, lastHeartbeatTS, version, nil
+}
+
+// UpdateLeader updates the leader entry for a leadership takeover
+func (store *PostgresStorage) UpdateLeader(leaderID string, version int64) (bool, common.SyncServiceError) {
+	updated, err := store.updateAndCount(
+		"UPDATE "+leader+" SET uuid = $1, heartbeat_timeout = $2, version = $3 + 1, last_heartbeat_ts = clock_timestamp() "+
+			"WHERE id = 1 AND version = $3",
+		leaderID, common.Configuration.LeadershipTimeout, version)
+	if err != nil {
+		// Only complain if someone else didn't steal the leadership
+		return false, &Error{fmt.Sprintf("Failed to update the row in the syncLeaderElection table. Error: %s\n", err)}
+	}
+	return updated != 0, nil
+}
+
+// ResignLeadership causes this sync service to give up the Leadership
+func (store *PostgresStorage) ResignLeadership(leaderID string) common.SyncServiceError {
+	err := store.update("UPDATE "+leader+" SET last_heartbeat_ts = 'epoch' WHERE id = 1 AND uuid = $1", leaderID)
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to update the row in the syncLeaderElection table. Error: %s\n", err)}
+	}
+
+	return nil
+}
+
+// RetrieveTimeOnServer retrieves the current time on the database server
+func (store *PostgresStorage) RetrieveTimeOnServer() (time.Time, error) {
+	var currentTime time.Time
+	err := store.fetchOne(store.db, "SELECT clock_timestamp()", nil, &currentTime)
+	return currentTime, err
+}
+
+// StoreOrgToMessagingGroup inserts organization to messaging groups table
+func (store *PostgresStorage) StoreOrgToMessagingGroup(orgID string, messagingGroup string) common.SyncServiceError {
+	err := store.update(
+		"INSERT INTO "+messagingGroups+" (id, group_name, last_update) VALUES ($1, $2, clock_timestamp()) "+
+			"ON CONFLICT (id) DO UPDATE SET group_name = EXCLUDED.group_name, last_update = EXCLUDED.last_update",
+		orgID, messagingGroup)
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to store organization's messaging group. Error: %s.", err)}
+	}
+	return nil
+}
+
+// DeleteOrgToMessagingGroup deletes organization from messaging groups table
+func (store *PostgresStorage) DeleteOrgToMessagingGroup(orgID string) common.SyncServiceError {
+	return store.update("DELETE FROM "+messagingGroups+" WHERE id = $1", orgID)
+}
+
+// RetrieveMessagingGroup retrieves messaging group for organization
+func (store *PostgresStorage) RetrieveMessagingGroup(orgID string) (string, common.SyncServiceError) {
+	var groupName string
+	if err := store.fetchOne(store.db, "SELECT group_name FROM "+messagingGroups+" WHERE id = $1", []interface{}{orgID},
+		&groupName); err != nil {
+		if err != sql.ErrNoRows {
+			return "", err
+		}
+		return "", nil
+	}
+	return groupName, nil
+}
+
+// RetrieveUpdatedMessagingGroups retrieves messaging groups that were updated after the specified time
+func (store *PostgresStorage) RetrieveUpdatedMessagingGroups(time time.Time) ([]common.MessagingGroup,
+	common.SyncServiceError) {
+	groups := make([]common.MessagingGroup, 0)
+	err := store.fetchAll(store.db, "SELECT id, group_name FROM "+messagingGroups+" WHERE last_update >= $1", []interface{}{time},
+		func(rows *sql.Rows) error {
+			group := common.MessagingGroup{}
+			if err := rows.Scan(&group.OrgID, &group.GroupName); err != nil {
+				return err
+			}
+			groups = append(groups, group)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// DeleteOrganization cleans up the storage from all the records associated with the organization
+func (store *PostgresStorage) DeleteOrganization(orgID string) common.SyncServiceError {
+	if err := store.DeleteOrgToMessagingGroup(orgID); err != nil {
+		return err
+	}
+
+	if err := store.update("DELETE FROM "+destinations+" WHERE org_id = $1", orgID); err != nil {
+		return &Error{fmt.Sprintf("Failed to delete destinations. Error: %s.", err)}
+	}
+
+	if err := store.update("DELETE FROM "+notifications+" WHERE org_id = $1", orgID); err != nil {
+		return &Error{fmt.Sprintf("Failed to delete notifications. Error: %s.", err)}
+	}
+
+	if store.DataStore != nil {
+		err := store.fetchAll(store.db, "SELECT id FROM "+objects+" WHERE org_id = $1", []interface{}{orgID},
+			func(rows *sql.Rows) error {
+				var id string
+				if err := rows.Scan(&id); err != nil {
+					return err
+				}
+				return store.DataStore.DeleteData(id)
+			})
+		if err != nil {
+			return &Error{fmt.Sprintf("Failed to delete objects' data. Error: %s.", err)}
+		}
+	} else if err := store.update("DELETE FROM "+objectsData+" WHERE id IN (SELECT id FROM "+objects+" WHERE org_id = $1)", orgID); err != nil {
+		return &Error{fmt.Sprintf("Failed to delete objects' data. Error: %s.", err)}
+	}
+
+	if err := store.update("DELETE FROM "+objects+" WHERE org_id = $1", orgID); err != nil {
+		return &Error{fmt.Sprintf("Failed to delete objects. Error: %s.", err)}
+	}
+
+	return nil
+}
+
+// IsConnected returns false if the storage cannont be reached, and true otherwise
+func (store *PostgresStorage) IsConnected() bool {
+	return store.connected
+}
+
+// StoreOrganization stores organization information
+// Returns the stored record timestamp for multiple CSS updates
+func (store *PostgresStorage) StoreOrganization(org common.Organization) (time.Time, common.SyncServiceError) {
+	orgJSON, err := json.Marshal(org)
+	if err != nil {
+		return time.Now(), &Error{fmt.Sprintf("Failed to marshal organization's info. Error: %s.", err)}
+	}
+	var lastUpdate time.Time
+	if err := store.fetchOne(store.db,
+		"INSERT INTO "+organizations+" (id, org, last_update) VALUES ($1, $2, clock_timestamp()) "+
+			"ON CONFLICT (id) DO UPDATE SET org = EXCLUDED.org, last_update = EXCLUDED.last_update RETURNING last_update",
+		[]interface{}{org.OrgID, string(orgJSON)}, &lastUpdate); err != nil {
+		return time.Now(), &Error{fmt.Sprintf("Failed to store organization's info. Error: %s.", err)}
+	}
+
+	return lastUpdate, nil
+}
+
+// RetrieveOrganizationInfo retrieves organization information
+func (store *PostgresStorage) RetrieveOrganizationInfo(orgID string) (*common.StoredOrganization, common.SyncServiceError) {
+	orgs, err := store.fetchOrganizations("WHERE id = $1", orgID)
+	if err != nil {
+		return nil, err
+	}
+	if len(orgs) == 0 {
+		return nil, nil
+	}
+	return &orgs[0], nil
+}
+
+// DeleteOrganizationInfo deletes organization information
+func (store *PostgresStorage) DeleteOrganizationInfo(orgID string) common.SyncServiceError {
+	return store.update("DELETE FROM "+organizations+" WHERE id = $1", orgID)
+}
+
+// RetrieveOrganizations retrieves stored organizations' info
+func (store *PostgresStorage) RetrieveOrganizations() ([]common.StoredOrganization, common.SyncServiceError) {
+	return store.fetchOrganizations("")
+}
+
+// RetrieveUpdatedOrganizations retrieves organizations that were updated after the specified time
+func (store *PostgresStorage) RetrieveUpdatedOrganizations(time time.Time) ([]common.StoredOrganization, common.SyncServiceError) {
+	return store.fetchOrganizations("WHERE last_update >= $1", time)
+}
+
+// AddUsersToACL adds users to an ACL
+func (store *PostgresStorage) AddUsersToACL(aclType string, orgID string, key string, usernames []string) common.SyncServiceError {
+	return store.addUsersToACLHelper(aclType, orgID, key, usernames)
+}
+
+// RemoveUsersFromACL removes users from an ACL
+func (store *PostgresStorage) RemoveUsersFromACL(aclType string, orgID string, key string, usernames []string) common.SyncServiceError {
+	return store.removeUsersFromACLHelper(aclType, orgID, key, usernames)
+}
+
+// RetrieveACL retrieves the list of usernames on an ACL
+func (store *PostgresStorage) RetrieveACL(aclType string, orgID string, key string) ([]string, common.SyncServiceError) {
+	return store.retrieveACLHelper(aclType, orgID, key)
+}
+
+// RetrieveACLsInOrg retrieves the list of ACLs in an organization
+func (store *PostgresStorage) RetrieveACLsInOrg(aclType string, orgID string) ([]string, common.SyncServiceError) {
+	return store.retrieveACLsInOrgHelper(aclType, orgID)
+}
+
+// IsPersistent returns true if the storage is persistent, and false otherwise
+func (store *PostgresStorage) IsPersistent() bool {
+	return true
+}
+
+func (store *PostgresStorage) connectionString() string {
+	host := common.Configuration.PostgresAddress
+	port := ""
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		host = h
+		port = p
+	}
+
+	params := []string{"host=" + quotePostgresParam(host), "dbname=" + quotePostgresParam(common.Configuration.PostgresDbName),
+		"sslmode=" + quotePostgresParam(common.Configuration.PostgresSSLMode),
+		"connect_timeout=20"}
+	if port != "" {
+		params = append(params, "port="+quotePostgresParam(port))
+	}
+	if common.Configuration.PostgresUsername != "" {
+		params = append(params, "user="+quotePostgresParam(common.Configuration.PostgresUsername))
+	}
+	if common.Configuration.PostgresPassword != "" {
+		params = append(params, "password="+quotePostgresParam(common.Configuration.PostgresPassword))
+	}
+	if common.Configuration.PostgresCACertificate != "" {
+		caFile := common.Configuration.PostgresCACertificate
+		if !strings.HasPrefix(caFile, "/") {
+			caFile = common.Configuration.PersistenceRootPath + caFile
+		}
+		params = append(params, "sslrootcert="+quotePostgresParam(caFile))
+	}
+	return strings.Join(params, " ")
+}
+
+func quotePostgresParam(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `'`, `\'`, -1)
+	return "'" + value + "'"
+}
@@ -0,0 +1,810 @@
+package storage
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+	"github.com/open-horizon/edge-utilities/logger/trace"
+)
+
+// postgresDataReader reads an object's data chunk by chunk from the syncObjectsData table
+type postgresDataReader struct {
+	store  *PostgresStorage
+	id     string
+	offset int64
+	size   int64
+}
+
+func (reader *postgresDataReader) Read(p []byte) (int, error) {
+	if reader.offset >= reader.size {
+		return 0, io.EOF
+	}
+	length := int64(len(p))
+	if length > reader.size-reader.offset {
+		length = reader.size - reader.offset
+	}
+	data, err := reader.store.readData(reader.id, int(length), reader.offset)
+	if err != nil {
+		return 0, err
+	}
+	n := copy(p, data)
+	reader.offset += int64(n)
+	return n, nil
+}
+
+func (store *PostgresStorage) checkObjects() {
+	if !store.connected {
+		return
+	}
+
+	currentTime := time.Now().UTC().Format(time.RFC3339)
+	result, err := store.fetchObjects(store.db,
+		"WHERE metadata->>'expiration' <> '' AND metadata->>'expiration' <= $1 AND status IN ($2, $3)",
+		currentTime, common.NotReadyToSend, common.ReadyToSend)
+	if err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Error in postgresStorage.checkObjects: failed to remove expired objects. Error: %s\n", err)
+		}
+		return
+	}
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Removing expired objects")
+	}
+
+	for _, object := range result {
+		lastUpdate := object.lastUpdate
+		err := store.deleteObject(object.metaData.DestOrgID, object.metaData.ObjectType, object.metaData.ObjectID, &lastUpdate)
+		if err == nil {
+			store.DeleteNotificationRecords(object.metaData.DestOrgID, object.metaData.ObjectType, object.metaData.ObjectID, "", "")
+		} else if log.IsLogging(logger.ERROR) {
+			log.Error("Error in postgresStorage.checkObjects: failed to remove expired objects. Error: %s\n", err)
+		}
+	}
+}
+
+// deleteObject deletes the object and its data. If lastUpdate is not nil, the object is deleted only
+// if it wasn't updated since lastUpdate.
+func (store *PostgresStorage) deleteObject(orgID string, objectType string, objectID string, lastUpdate *time.Time) common.SyncServiceError {
+	id := createObjectCollectionID(orgID, objectType, objectID)
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Deleting object %s\n", id)
+	}
+
+	var deleted int64
+	var err error
+	if lastUpdate == nil {
+		deleted, err = store.updateAndCount("DELETE FROM "+objects+" WHERE id = $1", id)
+	} else {
+		deleted, err = store.updateAndCount("DELETE FROM "+objects+" WHERE id = $1 AND last_update = $2", id, *lastUpdate)
+	}
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to delete object. Error: %s.", err)}
+	}
+	if deleted == 0 && lastUpdate != nil {
+		// The object was updated after it was fetched, it will be handled by the next maintenance cycle
+		return nil
+	}
+
+	if err := store.removeData(id); err != nil {
+		if log.IsLogging(logger.ERROR) {
+			log.Error("Error in deleteStoredObject: failed to delete data. Error: %s\n", err)
+		}
+	}
+	return nil
+}
+
+func (store *PostgresStorage) retrievePolicies(where string, args ...interface{}) ([]common.ObjectDestinationPolicy, common.SyncServiceError) {
+	results, err := store.fetchObjects(store.db, where, args...)
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to fetch the objects with a Destination Policy. Error: %s", err)}
+	}
+
+	objects := make([]common.ObjectDestinationPolicy, len(results))
+	for index, oneResult := range results {
+		destinationList := make([]common.DestinationsStatus, len(oneResult.destinations))
+		for destIndex, destination := range oneResult.destinations {
+			destinationList[destIndex] = common.DestinationsStatus{
+				DestType: destination.Destination.DestType, DestID: destination.Destination.DestID,
+				Status: destination.Status, Message: destination.Message,
+			}
+		}
+		objects[index] = common.ObjectDestinationPolicy{
+			OrgID: oneResult.metaData.DestOrgID, ObjectType: oneResult.metaData.ObjectType, ObjectID: oneResult.metaData.ObjectID,
+			DestinationPolicy: oneResult.metaData.DestinationPolicy, Destinations: destinationList,
+		}
+	}
+	return objects, nil
+}
+
+// postgresObjectsFilter adds the conditions of the filter to the where clause of a query of objects,
+// and sorts the objects by type and ID, up to the limit of the filter. It returns the where clause and its arguments.
+func postgresObjectsFilter(where string, filter common.ObjectsFilter, args ...interface{}) (string, []interface{}) {
+	addCondition := func(condition string, values ...interface{}) {
+		for _, value := range values {
+			args = append(args, value)
+			condition = strings.Replace(condition, "?", fmt.Sprintf("$%d", len(args)), 1)
+		}
+		where += " AND " + condition
+	}
+	if filter.ObjectTypePrefix != "" {
+		addCondition("starts_with(object_type, ?)", filter.ObjectTypePrefix)
+	}
+	if filter.Version != "" {
+		addCondition("metadata->>'version' = ?", filter.Version)
+	}
+	if filter.Inactive != nil {
+		addCondition("COALESCE((metadata->>'inactive')::BOOLEAN, FALSE) = ?", *filter.Inactive)
+	}
+	if filter.Deleted != nil {
+		addCondition("COALESCE((metadata->>'deleted')::BOOLEAN, FALSE) = ?", *filter.Deleted)
+	}
+	if filter.UpdatedSince != 0 {
+		addCondition("(metadata->>'instanceID')::BIGINT > ?", filter.UpdatedSince)
+	}
+	if filter.DestinationType != "" {
+		addCondition(`(metadata->>'destinationType' = ? OR EXISTS (SELECT 1 FROM jsonb_array_elements_text(
+			CASE WHEN jsonb_typeof(metadata->'destinationsList') = 'array' THEN metadata->'destinationsList' ELSE '[]'::JSONB END) AS dest
+			WHERE starts_with(dest, ?)))`, filter.DestinationType, filter.DestinationType+":")
+	}
+	for _, requirement := range filter.Labels {
+		switch requirement.Operator {
+		case common.LabelEquals:
+			addCondition("COALESCE(metadata->'labels' @> ?::JSONB, FALSE)", postgresLabelJSON(requirement))
+		case common.LabelNotEquals:
+			addCondition("NOT COALESCE(metadata->'labels' @> ?::JSONB, FALSE)", postgresLabelJSON(requirement))
+		case common.LabelExists:
+			addCondition("COALESCE(jsonb_exists(metadata->'labels', ?), FALSE)", requirement.Key)
+		case common.LabelNotExists:
+			addCondition("NOT COALESCE(jsonb_exists(metadata->'labels', ?), FALSE)", requirement.Key)
+		}
+	}
+	if filter.AfterObjectType != "" {
+		addCondition(`(object_type COLLATE "C" > ? OR (object_type = ? AND object_id COLLATE "C" > ?))`,
+			filter.AfterObjectType, filter.AfterObjectType, filter.AfterObjectID)
+	}
+	where += ` ORDER BY object_type COLLATE "C", object_id COLLATE "C"`
+	if filter.Limit > 0 {
+		where += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+	return where, args
+}
+
+// postgresLabelJSON returns the label required by a requirement of a label selector as a JSON object
+func postgresLabelJSON(requirement common.LabelRequirement) string {
+	encoded, _ := json.Marshal(map[string]string{requirement.Key: requirement.Value})
+	return string(encoded)
+}
+
+func scanPostgresObject(scanner interface{ Scan(...interface{}) error }) (*postgresObject, error) {
+	var metaData, destinations []byte
+	result := &postgresObject{}
+	if err := scanner.Scan(&metaData, &result.status, &result.policyReceived, &result.remainingConsumers,
+		&result.remainingReceivers, &destinations, &result.lastUpdate); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(metaData, &result.metaData); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(destinations, &result.destinations); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// fetchObject fetches one object, locking its row until the end of the transaction if forUpdate is true
+func (store *PostgresStorage) fetchObject(q postgresQueryer, id string, forUpdate bool) (*postgresObject, error) {
+	query := "SELECT " + postgresObjectColumns + " FROM " + objects + " WHERE id = $1"
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+	if !store.connected {
+		return nil, &NotConnected{"Disconnected from the database"}
+	}
+	result, err := scanPostgresObject(q.QueryRow(query, id))
+	if err != nil {
+		store.checkError(err, true)
+		return nil, err
+	}
+	return result, nil
+}
+
+func (store *PostgresStorage) fetchObjects(q postgresQueryer, where string, args ...interface{}) ([]postgresObject, error) {
+	result := make([]postgresObject, 0)
+	err := store.fetchAll(q, "SELECT "+postgresObjectColumns+" FROM "+objects+" "+where, args,
+		func(rows *sql.Rows) error {
+			object, err := scanPostgresObject(rows)
+			if err != nil {
+				return err
+			}
+			result = append(result, *object)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (store *PostgresStorage) upsertObject(tx *sql.Tx, id string, object postgresObject) error {
+	metaData, err := json.Marshal(object.metaData)
+	if err != nil {
+		return err
+	}
+	if object.destinations == nil {
+		object.destinations = make([]common.StoreDestinationStatus, 0)
+	}
+	destinations, err := json.Marshal(object.destinations)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		`INSERT INTO `+objects+` (id, org_id, object_type, object_id, metadata, status, policy_received,
+			remaining_consumers, remaining_receivers, destinations, last_update)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, clock_timestamp())
+			ON CONFLICT (id) DO UPDATE SET org_id = EXCLUDED.org_id, object_type = EXCLUDED.object_type,
+				object_id = EXCLUDED.object_id, metadata = EXCLUDED.metadata, status = EXCLUDED.status,
+				policy_received = EXCLUDED.policy_received, remaining_consumers = EXCLUDED.remaining_consumers,
+				remaining_receivers = EXCLUDED.remaining_receivers, destinations = EXCLUDED.destinations,
+				last_update = EXCLUDED.last_update`,
+		id, object.metaData.DestOrgID, object.metaData.ObjectType, object.metaData.ObjectID, string(metaData), object.status,
+		object.policyReceived, object.remainingConsumers, object.remainingReceivers, string(destinations))
+	return err
+}
+
+func (store *PostgresStorage) updateObjectDestinations(tx *sql.Tx, id string, dests []common.StoreDestinationStatus) error {
+	if dests == nil {
+		dests = make([]common.StoreDestinationStatus, 0)
+	}
+	destinations, err := json.Marshal(dests)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE "+objects+" SET destinations = $2, last_update = clock_timestamp() WHERE id = $1", id, string(destinations))
+	return err
+}
+
+func (store *PostgresStorage) fetchDestinations(where string, args ...interface{}) ([]common.Destination, error) {
+	dests := make([]common.Destination, 0)
+	err := store.fetchAll(store.db, "SELECT destination FROM "+destinations+" "+where, args,
+		func(rows *sql.Rows) error {
+			var destination []byte
+			if err := rows.Scan(&destination); err != nil {
+				return err
+			}
+			dest := common.Destination{}
+			if err := json.Unmarshal(destination, &dest); err != nil {
+				return err
+			}
+			dests = append(dests, dest)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return dests, nil
+}
+
+func (store *PostgresStorage) fetchNotifications(where string, args ...interface{}) ([]common.Notification, error) {
+	result := make([]common.Notification, 0)
+	err := store.fetchAll(store.db,
+		"SELECT org_id, object_type, object_id, dest_type, dest_id, status, instance_id, data_id, resend_time FROM "+
+			notifications+" "+where, args,
+		func(rows *sql.Rows) error {
+			n := common.Notification{}
+			if err := rows.Scan(&n.DestOrgID, &n.ObjectType, &n.ObjectID, &n.DestType, &n.DestID, &n.Status,
+				&n.InstanceID, &n.DataID, &n.ResendTime); err != nil {
+				return err
+			}
+			result = append(result, n)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (store *PostgresStorage) fetchOrganizations(where string, args ...interface{}) ([]common.StoredOrganization, common.SyncServiceError) {
+	orgs := make([]common.StoredOrganization, 0)
+	err := store.fetchAll(store.db, "SELECT org, last_update FROM "+organizations+" "+where, args,
+		func(rows *sql.Rows) error {
+			var org []byte
+			storedOrg := common.StoredOrganization{}
+			if err := rows.Scan(&org, &storedOrg.Timestamp); err != nil {
+				return err
+			}
+			if err := json.Unmarshal(org, &storedOrg.Org); err != nil {
+				return err
+			}
+			orgs = append(orgs, storedOrg)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return orgs, nil
+}
+
+func (store *PostgresStorage) fetchStringList(q postgresQueryer, query string, id string) ([]string, error) {
+	var list []byte
+	if err := store.fetchOne(q, query, []interface{}{id}, &list); err != nil {
+		return nil, err
+	}
+	result := make([]string, 0)
+	if err := json.Unmarshal(list, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// postgresWebhookSettings are the secrets and events of the webhooks of a type, by their URLs
+type postgresWebhookSettings struct {
+	secrets map[string]string
+	events  map[string][]string
+}
+
+func (settings *postgresWebhookSettings) marshal() (string, string, error) {
+	secretsJSON, err := json.Marshal(settings.secrets)
+	if err != nil {
+		return "", "", err
+	}
+	eventsJSON, err := json.Marshal(settings.events)
+	if err != nil {
+		return "", "", err
+	}
+	return string(secretsJSON), string(eventsJSON), nil
+}
+
+// fetchWebhooks returns the URLs of the webhooks and their settings
+func (store *PostgresStorage) fetchWebhooks(q postgresQueryer, query string, id string) ([]string, *postgresWebhookSettings, error) {
+	var list, secretsJSON, eventsJSON []byte
+	settings := &postgresWebhookSettings{secrets: make(map[string]string), events: make(map[string][]string)}
+	if err := store.fetchOne(q, query, []interface{}{id}, &list, &secretsJSON, &eventsJSON); err != nil {
+		return nil, settings, err
+	}
+	result := make([]string, 0)
+	if err := json.Unmarshal(list, &result); err != nil {
+		return nil, settings, err
+	}
+	if err := json.Unmarshal(secretsJSON, &settings.secrets); err != nil {
+		return nil, settings, err
+	}
+	if err := json.Unmarshal(eventsJSON, &settings.events); err != nil {
+		return nil, settings, err
+	}
+	return result, settings, nil
+}
+
+func (store *PostgresStorage) upsertStringList(tx *sql.Tx, query string, id string, list []string, args ...interface{}) error {
+	listJSON, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(query, append([]interface{}{id, string(listJSON)}, args...)...)
+	return err
+}
+
+func (store *PostgresStorage) removeData(id string) common.SyncServiceError {
+	if store.DataStore != nil {
+		return store.DataStore.DeleteData(id)
+	}
+	return store.update("DELETE FROM "+objectsData+" WHERE id = $1", id)
+}
+
+// storeData replaces the object's data with the provided data
+func (store *PostgresStorage) storeData(id string, data []byte) common.SyncServiceError {
+	if store.DataStore != nil {
+		_, err := store.DataStore.StoreData(id, bytes.NewReader(data), uint32(len(data)))
+		return err
+	}
+	err := store.withTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("DELETE FROM "+objectsData+" WHERE id = $1", id); err != nil {
+			return err
+		}
+		chunkSize := common.Configuration.MaxDataChunkSize
+		offset := 0
+		for {
+			end := offset + chunkSize
+			if end > len(data) {
+				end = len(data)
+			}
+			if _, err := tx.Exec("INSERT INTO "+objectsData+" (id, chunk_offset, data) VALUES ($1, $2, $3)",
+				id, offset, data[offset:end]); err != nil {
+				return err
+			}
+			offset = end
+			if offset >= len(data) {
+				// An empty chunk is stored for empty data, marking that the data exists
+				return nil
+			}
+		}
+	}, false)
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to store the data. Error: %s.", err)}
+	}
+	return nil
+}
+
+// copyData replaces the object's data with the data read from the reader and returns the data size
+func (store *PostgresStorage) copyData(id string, dataReader io.Reader) (int64, common.SyncServiceError) {
+	if store.DataStore != nil {
+		return store.DataStore.StoreData(id, dataReader, 0)
+	}
+	var written int64
+	err := store.withTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("DELETE FROM "+objectsData+" WHERE id = $1", id); err != nil {
+			return err
+		}
+		chunk := make([]byte, common.Configuration.MaxDataChunkSize)
+		for {
+			n, err := io.ReadFull(dataReader, chunk)
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return err
+			}
+			if n > 0 || written == 0 {
+				if _, err := tx.Exec("INSERT INTO "+objectsData+" (id, chunk_offset, data) VALUES ($1, $2, $3)",
+					id, written, chunk[:n]); err != nil {
+					return err
+				}
+				written += int64(n)
+			}
+			if err != nil {
+				return nil
+			}
+		}
+	}, false)
+	if err != nil {
+		return 0, &Error{fmt.Sprintf("Failed to write the data. Error: %s.", err)}
+	}
+	return written, nil
+}
+
+// copyStoredData replaces the data stored with the target ID with a copy of the data stored with the source ID,
+// and returns false if no data is stored with the source ID
+func (store *PostgresStorage) copyStoredData(sourceID string, targetID string) (bool, common.SyncServiceError) {
+	if store.DataStore != nil {
+		dataReader, err := store.DataStore.GetData(sourceID)
+		if err != nil {
+			if common.IsNotFound(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		defer store.CloseDataReader(dataReader)
+		if _, err := store.DataStore.StoreData(targetID, dataReader, 0); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	var copied int64
+	err := store.withTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("DELETE FROM "+objectsData+" WHERE id = $1", targetID); err != nil {
+			return err
+		}
+		result, err := tx.Exec("INSERT INTO "+objectsData+" (id, chunk_offset, data) SELECT $1, chunk_offset, data FROM "+
+			objectsData+" WHERE id = $2", targetID, sourceID)
+		if err != nil {
+			return err
+		}
+		copied, err = result.RowsAffected()
+		return err
+	}, false)
+	if err != nil {
+		return false, &Error{fmt.Sprintf("Failed to copy the data. Error: %s.", err)}
+	}
+	return copied != 0, nil
+}
+
+// dataSize returns the size of the object's data and whether the object has data
+func (store *PostgresStorage) dataSize(id string) (int64, bool, error) {
+	var chunks, size int64
+	if err := store.fetchOne(store.db, "SELECT count(*), COALESCE(SUM(octet_length(data)), 0) FROM "+objectsData+" WHERE id = $1",
+		[]interface{}{id}, &chunks, &size); err != nil {
+		return 0, false, err
+	}
+	return size, chunks != 0, nil
+}
+
+// readData reads up to size bytes of the object's data starting at offset
+func (store *PostgresStorage) readData(id string, size int, offset int64) ([]byte, error) {
+	result := make([]byte, 0, size)
+	end := offset + int64(size)
+	err := store.fetchAll(store.db,
+		"SELECT chunk_offset, data FROM "+objectsData+
+			" WHERE id = $1 AND chunk_offset < $3 AND chunk_offset + octet_length(data) > $2 ORDER BY chunk_offset",
+		[]interface{}{id, offset, end},
+		func(rows *sql.Rows) error {
+			var chunkOffset int64
+			var data []byte
+			if err := rows.Scan(&chunkOffset, &data); err != nil {
+				return err
+			}
+			current := offset + int64(len(result))
+			if chunkOffset > current {
+				return &Error{fmt.Sprintf("Missing data at offset %d.", current)}
+			}
+			start := current - chunkOffset
+			stop := int64(len(data))
+			if chunkOffset+stop > end {
+				stop = end - chunkOffset
+			}
+			if start < stop {
+				result = append(result, data[start:stop]...)
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (store *PostgresStorage) getInstanceID() int64 {
+	currentTime, err := store.RetrieveTimeOnServer()
+	if err != nil {
+		currentTime = time.Now()
+	}
+	return currentTime.UnixNano() / (int64(time.Millisecond) / int64(time.Nanosecond))
+}
+
+func (store *PostgresStorage) addUsersToACLHelper(aclType string, orgID string, key string, usernames []string) common.SyncServiceError {
+	id := orgID + ":" + aclType + ":" + key
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Adding a %s ACL for %s\n", aclType, id)
+	}
+	err := store.withTx(func(tx *sql.Tx) error {
+		entries, err := store.fetchStringList(tx, "SELECT usernames FROM "+acls+" WHERE id = $1 FOR UPDATE", id)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		added := entries == nil
+		for _, username := range usernames {
+			notFound := true
+			// Don't add the username if it already is in the list
+			for _, entry := range entries {
+				if username == entry {
+					notFound = false
+					break
+				}
+			}
+			if notFound {
+				entries = append(entries, username)
+				added = true
+			}
+		}
+		if !added {
+			return nil
+		}
+		return store.upsertStringList(tx,
+			"INSERT INTO "+acls+" (id, usernames, org_id, acl_type, last_update) VALUES ($1, $2, $3, $4, clock_timestamp()) "+
+				"ON CONFLICT (id) DO UPDATE SET usernames = EXCLUDED.usernames, last_update = EXCLUDED.last_update",
+			id, entries, orgID, aclType)
+	}, false)
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to add a %s ACL. Error: %s.", aclType, err)}
+	}
+	return nil
+}
+
+func (store *PostgresStorage) removeUsersFromACLHelper(aclType string, orgID string, key string, usernames []string) common.SyncServiceError {
+	id := orgID + ":" + aclType + ":" + key
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Deleting a %s ACL for %s\n", aclType, id)
+	}
+	err := store.withTx(func(tx *sql.Tx) error {
+		entries, err := store.fetchStringList(tx, "SELECT usernames FROM "+acls+" WHERE id = $1 FOR UPDATE", id)
+		if err != nil {
+			return err
+		}
+		deleted := false
+		for _, username := range usernames {
+			for i, entry := range entries {
+				if strings.EqualFold(entry, username) {
+					if len(entries) == 1 {
+						// Deleting the last username, delete the ACL
+						_, err := tx.Exec("DELETE FROM "+acls+" WHERE id = $1", id)
+						return err
+					}
+
+					entries[i] = entries[len(entries)-1]
+					entries = entries[:len(entries)-1]
+					deleted = true
+					break
+				}
+			}
+		}
+		if !deleted {
+			return nil
+		}
+		return store.upsertStringList(tx, "UPDATE "+acls+" SET usernames = $2, last_update = clock_timestamp() WHERE id = $1",
+			id, entries)
+	}, false)
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to delete a %s ACL. Error: %s.", aclType, err)}
+	}
+	return nil
+}
+
+func (store *PostgresStorage) retrieveACLHelper(aclType string, orgID string, key string) ([]string, common.SyncServiceError) {
+	id := orgID + ":" + aclType + ":" + key
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Retrieving a %s ACL for %s\n", aclType, id)
+	}
+	usernames, err := store.fetchStringList(store.db, "SELECT usernames FROM "+acls+" WHERE id = $1", id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return make([]string, 0), nil
+		}
+		return nil, err
+	}
+	return usernames, nil
+}
+
+func (store *PostgresStorage) retrieveACLsInOrgHelper(aclType string, orgID string) ([]string, common.SyncServiceError) {
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Retrieving the %s ACL for %s\n", aclType, orgID)
+	}
+
+	result := make([]string, 0)
+	err := store.fetchAll(store.db, "SELECT id FROM "+acls+" WHERE org_id = $1 AND acl_type = $2", []interface{}{orgID, aclType},
+		func(rows *sql.Rows) error {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			parts := strings.Split(id, ":")
+			result = append(result, parts[2])
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (store *PostgresStorage) fetchOne(q postgresQueryer, query string, args []interface{}, result ...interface{}) error {
+	if !store.connected {
+		return &NotConnected{"Disconnected from the database"}
+	}
+	err := q.QueryRow(query, args...).Scan(result...)
+	store.checkError(err, true)
+	return err
+}
+
+func (store *PostgresStorage) fetchAll(q postgresQueryer, query string, args []interface{}, function func(*sql.Rows) error) error {
+	if !store.connected {
+		return &NotConnected{"Disconnected from the database"}
+	}
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		store.checkError(err, true)
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := function(rows); err != nil {
+			return err
+		}
+	}
+	err = rows.Err()
+	store.checkError(err, true)
+	return err
+}
+
+func (store *PostgresStorage) update(query string, args ...interface{}) common.SyncServiceError {
+	_, err := store.updateAndCount(query, args...)
+	return err
+}
+
+// updateAndCount executes the statement and returns the number of affected rows
+func (store *PostgresStorage) updateAndCount(query string, args ...interface{}) (int64, common.SyncServiceError) {
+	if !store.connected {
+		return 0, &NotConnected{"Disconnected from the database"}
+	}
+	result, err := store.db.Exec(query, args...)
+	if err != nil {
+		store.checkError(err, false)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// withTx runs the function in a transaction. The transaction is committed if the function succeeds,
+// and rolled back otherwise.
+func (store *PostgresStorage) withTx(function func(*sql.Tx) error, isRead bool) common.SyncServiceError {
+	if !store.connected {
+		return &NotConnected{"Disconnected from the database"}
+	}
+	tx, err := store.db.Begin()
+	if err != nil {
+		store.checkError(err, isRead)
+		return err
+	}
+	if err := function(tx); err != nil {
+		tx.Rollback()
+		store.checkError(err, isRead)
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		store.checkError(err, isRead)
+		return err
+	}
+	return nil
+}
+
+// checkError updates the health status after a failed database operation,
+// and starts reconnecting if the database can't be reached
+func (store *PostgresStorage) checkError(err error, isRead bool) {
+	if err == nil || err == sql.ErrNoRows {
+		return
+	}
+	switch err.(type) {
+	case *Error, *NotFound, *NotConnected, *Discarded, *common.InvalidRequest, *common.NotFound:
+		return
+	}
+
+	if pingErr := store.db.Ping(); pingErr == nil {
+		if isRead {
+			common.HealthStatus.DBReadFailed()
+		} else {
+			common.HealthStatus.DBWriteFailed()
+		}
+		return
+	}
+
+	store.lock()
+	defer store.unLock()
+	if !store.connected {
+		return
+	}
+	store.connected = false
+
+	common.HealthStatus.DisconnectedFromDatabase()
+	if trace.IsLogging(logger.ERROR) {
+		trace.Error("Disconnected from the database")
+	}
+	if log.IsLogging(logger.ERROR) {
+		log.Error("Disconnected from the database")
+	}
+	go store.reconnect()
+}
+
+func (store *PostgresStorage) reconnect() {
+	common.GoRoutineStarted()
+	defer common.GoRoutineEnded()
+
+	for {
+		time.Sleep(5 * time.Second)
+		if err := store.db.Ping(); err == nil {
+			break
+		}
+	}
+
+	store.lock()
+	store.connected = true
+	store.unLock()
+
+	common.HealthStatus.ReconnectedToDatabase()
+	if trace.IsLogging(logger.INFO) {
+		trace.Info("Reconnected to the database")
+	}
+	if log.IsLogging(logger.INFO) {
+		log.Info("Reconnected to the database")
+	}
+}
+
+func (store *PostgresStorage) lock() {
+	<-store.lockChannel
+}
+
+func (store *PostgresStorage) unLock() {
+	store.lockChannel <- 1
+}
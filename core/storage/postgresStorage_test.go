@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+func TestPostgresStorageObjects(t *testing.T) {
+	testStorageObjects(common.Postgres, t)
+}
+
+func TestPostgresStorageObjectsWithPolicy(t *testing.T) {
+	testStorageObjectsWithPolicy(common.Postgres, t)
+}
+
+func TestPostgresStorageObjectActivation(t *testing.T) {
+	testStorageObjectActivation(common.Postgres, t)
+}
+
+func TestPostgresStorageObjectExpiration(t *testing.T) {
+	testStorageObjectExpiration(common.Postgres, t)
+}
+
+func TestPostgresStorageObjectData(t *testing.T) {
+	testStorageObjectData(common.Postgres, t)
+}
+
+func TestPostgresStorageOrgDeleteObjects(t *testing.T) {
+	testStorageOrgDeleteObjects(common.Postgres, t)
+}
+
+func TestPostgresStorageNotifications(t *testing.T) {
+	testStorageNotifications(common.Postgres, t)
+}
+
+func TestPostgresStorageOrgDeleteNotifications(t *testing.T) {
+	testStorageOrgDeleteNotifications(common.Postgres, t)
+}
+
+func TestPostgresStorageMessagingGroups(t *testing.T) {
+	testStorageMessagingGroups(common.Postgres, t)
+}
+
+func TestPostgresStorageObjectDestinations(t *testing.T) {
+	testStorageObjectDestinations(common.Postgres, t)
+}
+
+func TestPostgresStorageWebhooks(t *testing.T) {
+	testStorageWebhooks(common.Postgres, t)
+}
+
+func TestPostgresStorageWebhookDeliveries(t *testing.T) {
+	testStorageWebhookDeliveries(common.Postgres, t)
+}
+
+func TestPostgresStorageOrganizationsUsage(t *testing.T) {
+	testStorageOrganizationsUsage(common.Postgres, t)
+}
+
+func TestPostgresStorageObjectsFilter(t *testing.T) {
+	testStorageObjectsFilter(common.Postgres, t)
+}
+
+func TestPostgresStorageObjectLabels(t *testing.T) {
+	testStorageObjectLabels(common.Postgres, t)
+}
+
+func TestPostgresStorageAuditLog(t *testing.T) {
+	testStorageAuditLog(common.Postgres, t)
+}
+
+func TestPostgresStorageRollouts(t *testing.T) {
+	testStorageRollouts(common.Postgres, t)
+}
+
+func TestPostgresStorageObjectVersions(t *testing.T) {
+	testStorageObjectVersions(common.Postgres, t)
+}
+
+func TestPostgresStorageDestinationGroups(t *testing.T) {
+	testStorageDestinationGroups(common.Postgres, t)
+}
+
+func TestPostgresStorageOrganizations(t *testing.T) {
+	testStorageOrganizations(common.Postgres, t)
+}
+
+func TestPostgresStorageInactiveDestinations(t *testing.T) {
+	testStorageInactiveDestinations(common.Postgres, t)
+}
+
+func TestPostgresStorageLeader(t *testing.T) {
+	common.Configuration.PostgresDbName = "d_test_db"
+	store := &PostgresStorage{}
+	if err := store.Init(); err != nil {
+		t.Errorf("Failed to initialize storage driver. Error: %s\n", err.Error())
+		return
+	}
+	defer store.Stop()
+
+	if err := store.update("DELETE FROM " + leader); err != nil {
+		t.Errorf("Failed to clean the leader table. Error: %s\n", err.Error())
+	}
+
+	if ok, err := store.InsertInitialLeader("leader1"); err != nil {
+		t.Errorf("InsertInitialLeader failed. Error: %s\n", err.Error())
+	} else if !ok {
+		t.Errorf("InsertInitialLeader didn't insert the leader\n")
+	}
+	if ok, err := store.InsertInitialLeader("leader2"); err != nil {
+		t.Errorf("InsertInitialLeader failed. Error: %s\n", err.Error())
+	} else if ok {
+		t.Errorf("InsertInitialLeader inserted a second leader\n")
+	}
+
+	leaderID, _, _, version, err := store.RetrieveLeader()
+	if err != nil {
+		t.Errorf("RetrieveLeader failed. Error: %s\n", err.Error())
+	} else if leaderID != "leader1" || version != 1 {
+		t.Errorf("RetrieveLeader returned %s (version %d) instead of leader1 (version 1)\n", leaderID, version)
+	}
+
+	if ok, err := store.LeaderPeriodicUpdate("leader1"); err != nil || !ok {
+		t.Errorf("LeaderPeriodicUpdate failed for the leader\n")
+	}
+	if ok, err := store.LeaderPeriodicUpdate("leader2"); err != nil || ok {
+		t.Errorf("LeaderPeriodicUpdate succeeded for a non-leader\n")
+	}
+
+	if ok, err := store.UpdateLeader("leader2", version+1); err != nil || ok {
+		t.Errorf("UpdateLeader succeeded with a wrong version\n")
+	}
+	if ok, err := store.UpdateLeader("leader2", version); err != nil || !ok {
+		t.Errorf("UpdateLeader failed\n")
+	}
+	if leaderID, _, _, version, err := store.RetrieveLeader(); err != nil {
+		t.Errorf("RetrieveLeader failed. Error: %s\n", err.Error())
+	} else if leaderID != "leader2" || version != 2 {
+		t.Errorf("RetrieveLeader returned %s (version %d) instead of leader2 (version 2)\n", leaderID, version)
+	}
+
+	if err := store.ResignLeadership("leader2"); err != nil {
+		t.Errorf("ResignLeadership failed. Error: %s\n", err.Error())
+	}
+	if _, _, heartbeat, _, err := store.RetrieveLeader(); err != nil {
+		t.Errorf("RetrieveLeader failed. Error: %s\n", err.Error())
+	} else if heartbeat.Unix() != 0 {
+		t.Errorf("ResignLeadership didn't reset the heartbeat timestamp\n")
+	}
+}
@@ -0,0 +1,304 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+	"github.com/open-horizon/edge-utilities/logger/trace"
+)
+
+// S3DataStore is a data store that keeps the objects' data in a bucket of an S3 compatible service.
+// The chunks of data that is appended chunk by chunk are kept in the bucket as well, so that no state of an append
+// is kept in memory: the chunks may be received by different instances of the CSS, or before and after a restart.
+// Each chunk is stored as an object under the prefix of the object's chunks, with its offset in its name.
+// When the last chunk arrives, the chunks are combined into the object's data and removed.
+type S3DataStore struct {
+	endpoint *url.URL
+	client   *http.Client
+	partSize int64
+}
+
+// s3Upload is the state of a multipart upload of an object's data.
+// Data that fits in a single part is uploaded as a regular object, otherwise a multipart upload is used.
+type s3Upload struct {
+	uploadID string
+	uploaded map[int64]string
+}
+
+// The prefix of the names of the objects of the chunks of appended data. Object keys start with the ID
+// of their organization, which can't contain a slash, so the names of chunks don't collide with them.
+const s3ChunksPrefix = "_chunks/"
+
+// Init initializes the S3DataStore
+func (store *S3DataStore) Init() common.SyncServiceError {
+	store.partSize = common.Configuration.S3PartSize
+	if store.partSize <= 0 {
+		store.partSize = 5 * 1024 * 1024
+	}
+
+	endpoint, err := url.Parse(common.Configuration.S3Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return &Error{fmt.Sprintf("Invalid S3 endpoint %s.", common.Configuration.S3Endpoint)}
+	}
+	store.endpoint = endpoint
+	store.client = &http.Client{}
+
+	response, err := store.doRequest(http.MethodHead, "", nil, nil, nil)
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to connect to S3 at %s. Error: %s.", common.Configuration.S3Endpoint, err)}
+	}
+	response.Body.Close()
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		if err := store.createBucket(); err != nil {
+			return err
+		}
+		if log.IsLogging(logger.INFO) {
+			log.Info("Created the S3 bucket %s", common.Configuration.S3Bucket)
+		}
+	default:
+		return &Error{fmt.Sprintf("Failed to access the S3 bucket %s. Status: %s.", common.Configuration.S3Bucket, response.Status)}
+	}
+
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Successfully initialized the S3 data store")
+	}
+	return nil
+}
+
+// StoreData stores the data read from the reader, and returns the number of bytes written
+func (store *S3DataStore) StoreData(id string, dataReader io.Reader, dataLength uint32) (int64, common.SyncServiceError) {
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Storing data of %s in S3", id)
+	}
+	// The data replaces data that was being appended
+	if err := store.deleteChunks(id); err != nil {
+		return 0, err
+	}
+	return store.storeData(id, dataReader, dataLength)
+}
+
+func (store *S3DataStore) storeData(id string, dataReader io.Reader, dataLength uint32) (int64, common.SyncServiceError) {
+	buffer := make([]byte, store.partSize)
+	n, err := io.ReadFull(dataReader, buffer)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		// The data fits in a single part
+		if dataLength != 0 && int64(n) != int64(dataLength) {
+			return 0, &common.IOError{Message: "Failed to read all the data."}
+		}
+		if err := store.putObject(id, buffer[:n]); err != nil {
+			return 0, err
+		}
+		return int64(n), nil
+	}
+	if err != nil {
+		return 0, &common.IOError{Message: "Failed to read the data. Error: " + err.Error()}
+	}
+
+	upload := &s3Upload{uploaded: make(map[int64]string)}
+	if upload.uploadID, err = store.createMultipartUpload(id); err != nil {
+		return 0, err
+	}
+	var written int64
+	for partIndex := int64(0); n > 0; partIndex++ {
+		etag, err := store.uploadPart(id, upload.uploadID, partIndex+1, buffer[:n])
+		if err != nil {
+			store.abortUpload(id, upload)
+			return 0, err
+		}
+		upload.uploaded[partIndex] = etag
+		written += int64(n)
+
+		n, err = io.ReadFull(dataReader, buffer)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			store.abortUpload(id, upload)
+			return 0, &common.IOError{Message: "Failed to read the data. Error: " + err.Error()}
+		}
+	}
+	if dataLength != 0 && written != int64(dataLength) {
+		store.abortUpload(id, upload)
+		return 0, &common.IOError{Message: "Failed to read all the data."}
+	}
+	if err := store.completeMultipartUpload(id, upload); err != nil {
+		store.abortUpload(id, upload)
+		return 0, err
+	}
+	return written, nil
+}
+
+// AppendData stores a chunk of data at the given offset.
+// The chunk is stored in the bucket, and the data is created from the stored chunks when its last chunk arrives.
+func (store *S3DataStore) AppendData(id string, dataReader io.Reader, dataLength uint32, offset int64, total int64,
+	isFirstChunk bool, isLastChunk bool) common.SyncServiceError {
+	var data []byte
+	var err error
+	if dataLength > 0 {
+		data = make([]byte, dataLength)
+		_, err = io.ReadFull(dataReader, data)
+	} else {
+		data, err = ioutil.ReadAll(dataReader)
+	}
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to read the data from the dataReader. Error: %s.", err)}
+	}
+	if offset < 0 || offset+int64(len(data)) > total {
+		return &Error{fmt.Sprintf("Failed to append the data at offset %d, the chunk exceeds the data size %d.", offset, total)}
+	}
+
+	if isFirstChunk {
+		// Remove the chunks of an earlier append that didn't complete
+		if err := store.deleteChunks(id); err != nil {
+			return err
+		}
+	}
+	if len(data) > 0 {
+		if trace.IsLogging(logger.TRACE) {
+			trace.Trace(" Store chunk (%d) of %s at offset %d in S3\n", len(data), id, offset)
+		}
+		if err := store.putObject(s3ChunkKey(id, offset), data); err != nil {
+			return err
+		}
+	}
+	if !isLastChunk {
+		return nil
+	}
+
+	chunks, err := store.listChunks(id)
+	if err != nil {
+		return err
+	}
+	var size int64
+	for _, chunk := range chunks {
+		if chunk.offset != size {
+			break
+		}
+		size += chunk.size
+	}
+	if size != total {
+		return &Error{fmt.Sprintf("Failed to complete the data of %s, %d of its %d bytes were received.", id, size, total)}
+	}
+	reader := &s3ChunksReader{store: store, id: id, chunks: chunks}
+	written, err := store.storeData(id, reader, 0)
+	reader.close()
+	if err != nil {
+		return err
+	}
+	if written != total {
+		return &Error{fmt.Sprintf("Failed to complete the data of %s, %d bytes were written instead of %d.", id, written, total)}
+	}
+	return store.deleteChunks(id)
+}
+
+// GetData returns a reader of the data
+func (store *S3DataStore) GetData(id string) (io.Reader, common.SyncServiceError) {
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Retrieving data of %s from S3", id)
+	}
+	response, err := store.doRequest(http.MethodGet, id, nil, nil, nil)
+	if err != nil {
+		return nil, &common.IOError{Message: "Failed to read the data from S3. Error: " + err.Error()}
+	}
+	if response.StatusCode == http.StatusNotFound {
+		response.Body.Close()
+		return nil, &common.NotFound{}
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, s3ResponseError("read the data", response)
+	}
+	return &s3DataReader{body: response.Body}, nil
+}
+
+// GetDataChunk returns a chunk of the data
+func (store *S3DataStore) GetDataChunk(id string, size int, offset int64) ([]byte, bool, int, common.SyncServiceError) {
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Retrieving data chunk of %s from S3", id)
+	}
+	if size <= 0 {
+		return make([]byte, 0), false, 0, nil
+	}
+	headers := map[string]string{"Range": fmt.Sprintf("bytes=%d-%d", offset, offset+int64(size)-1)}
+	response, err := store.doRequest(http.MethodGet, id, nil, headers, nil)
+	if err != nil {
+		return nil, true, 0, &common.IOError{Message: "Failed to read the data from S3. Error: " + err.Error()}
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusNotFound:
+		return nil, true, 0, &common.NotFound{}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The offset is beyond the end of the data
+		return make([]byte, 0), true, 0, nil
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// The range was ignored, skip to the offset
+		if _, err := io.CopyN(ioutil.Discard, response.Body, offset); err != nil {
+			return make([]byte, 0), true, 0, nil
+		}
+	default:
+		return nil, true, 0, s3ResponseError("read the data", response)
+	}
+
+	result := make([]byte, size)
+	n, err := io.ReadFull(response.Body, result)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, true, 0, &common.IOError{Message: "Failed to read the data from S3. Error: " + err.Error()}
+	}
+	eof := n < size
+	if !eof {
+		if dataSize, ok := s3ContentRangeSize(response); ok && dataSize == offset+int64(n) {
+			eof = true
+		}
+	}
+	return result, eof, n, nil
+}
+
+// DeleteData deletes the data
+func (store *S3DataStore) DeleteData(id string) common.SyncServiceError {
+	if trace.IsLogging(logger.TRACE) {
+		trace.Trace("Deleting data of %s from S3", id)
+	}
+	if err := store.deleteChunks(id); err != nil {
+		return err
+	}
+
+	response, err := store.doRequest(http.MethodDelete, id, nil, nil, nil)
+	if err != nil {
+		return &common.IOError{Message: "Failed to delete the data from S3. Error: " + err.Error()}
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusNoContent && response.StatusCode != http.StatusOK &&
+		response.StatusCode != http.StatusNotFound {
+		return s3ResponseError("delete the data", response)
+	}
+	return nil
+}
+
+// sortedPartIndexes returns the indexes of the uploaded parts in ascending order
+func (upload *s3Upload) sortedPartIndexes() []int64 {
+	indexes := make([]int64, 0, len(upload.uploaded))
+	for index := range upload.uploaded {
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+	return indexes
+}
+
+func s3ResponseError(operation string, response *http.Response) common.SyncServiceError {
+	body, _ := ioutil.ReadAll(io.LimitReader(response.Body, 4096))
+	response.Body.Close()
+	code, message := parseS3Error(bytes.NewReader(body))
+	if code == "" {
+		return &Error{fmt.Sprintf("Failed to %s in S3. Status: %s.", operation, response.Status)}
+	}
+	return &Error{fmt.Sprintf("Failed to %s in S3. Status: %s. Code: %s. Message: %s", operation, response.Status, code, message)}
+}
@@ -0,0 +1,417 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"github.com/open-horizon/edge-utilities/logger"
+	"github.com/open-horizon/edge-utilities/logger/log"
+)
+
+const s3EmptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+type s3CompletePart struct {
+	PartNumber int64  `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type s3CompleteMultipartUpload struct {
+	XMLName xml.Name         `xml:"CompleteMultipartUpload"`
+	Parts   []s3CompletePart `xml:"Part"`
+}
+
+type s3InitiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type s3ListBucketResult struct {
+	Contents []struct {
+		Key  string `xml:"Key"`
+		Size int64  `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+type s3ErrorResponse struct {
+	XMLName xml.Name
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// s3DataReader reads an object's data from the body of an S3 response.
+// The error returned together with the last bytes of the body is returned by the next Read.
+type s3DataReader struct {
+	body io.ReadCloser
+	err  error
+}
+
+func (reader *s3DataReader) Read(p []byte) (int, error) {
+	if reader.err != nil {
+		return 0, reader.err
+	}
+	n, err := reader.body.Read(p)
+	if err != nil && n > 0 {
+		reader.err = err
+		return n, nil
+	}
+	return n, err
+}
+
+func (reader *s3DataReader) Close() error {
+	return reader.body.Close()
+}
+
+// s3Chunk is a chunk of appended data that is stored in the bucket
+type s3Chunk struct {
+	key    string
+	offset int64
+	size   int64
+}
+
+// s3ChunksReader reads the data combined from the chunks, one chunk at a time
+type s3ChunksReader struct {
+	store   *S3DataStore
+	id      string
+	chunks  []s3Chunk
+	current io.Reader
+}
+
+func (reader *s3ChunksReader) Read(p []byte) (int, error) {
+	for {
+		if reader.current == nil {
+			if len(reader.chunks) == 0 {
+				return 0, io.EOF
+			}
+			current, err := reader.store.GetData(reader.chunks[0].key)
+			if err != nil {
+				return 0, err
+			}
+			reader.current = current
+			reader.chunks = reader.chunks[1:]
+		}
+		n, err := reader.current.Read(p)
+		if err == io.EOF {
+			reader.close()
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (reader *s3ChunksReader) close() {
+	if reader.current != nil {
+		reader.current.(*s3DataReader).Close()
+		reader.current = nil
+	}
+}
+
+// s3ChunkKey returns the name of the object of the chunk at the offset of the data
+func s3ChunkKey(id string, offset int64) string {
+	return fmt.Sprintf("%s%s/%020d", s3ChunksPrefix, id, offset)
+}
+
+// listChunks returns the stored chunks of the data, ordered by their offsets
+func (store *S3DataStore) listChunks(id string) ([]s3Chunk, common.SyncServiceError) {
+	prefix := s3ChunksPrefix + id + "/"
+	chunks := make([]s3Chunk, 0)
+	query := map[string]string{"list-type": "2", "prefix": prefix}
+	for {
+		response, err := store.doRequest(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, &common.IOError{Message: "Failed to list the data chunks in S3. Error: " + err.Error()}
+		}
+		if response.StatusCode != http.StatusOK {
+			return nil, s3ResponseError("list the data chunks", response)
+		}
+		result := s3ListBucketResult{}
+		decodeErr := xml.NewDecoder(response.Body).Decode(&result)
+		response.Body.Close()
+		if decodeErr != nil {
+			return nil, &Error{fmt.Sprintf("Failed to list the data chunks in S3, invalid response. Error: %s.", decodeErr)}
+		}
+
+		for _, object := range result.Contents {
+			// The chunks of objects whose IDs extend the ID with a slash have the same prefix
+			name := strings.TrimPrefix(object.Key, prefix)
+			if len(name) != 20 {
+				continue
+			}
+			offset, err := strconv.ParseInt(name, 10, 64)
+			if err != nil {
+				continue
+			}
+			chunks = append(chunks, s3Chunk{key: object.Key, offset: offset, size: object.Size})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		query["continuation-token"] = result.NextContinuationToken
+	}
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].offset < chunks[j].offset })
+	return chunks, nil
+}
+
+// deleteChunks deletes the stored chunks of the data
+func (store *S3DataStore) deleteChunks(id string) common.SyncServiceError {
+	chunks, err := store.listChunks(id)
+	if err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		response, err := store.doRequest(http.MethodDelete, chunk.key, nil, nil, nil)
+		if err != nil {
+			return &common.IOError{Message: "Failed to delete a data chunk from S3. Error: " + err.Error()}
+		}
+		if response.StatusCode != http.StatusNoContent && response.StatusCode != http.StatusOK &&
+			response.StatusCode != http.StatusNotFound {
+			return s3ResponseError("delete a data chunk", response)
+		}
+		response.Body.Close()
+	}
+	return nil
+}
+
+func (store *S3DataStore) createBucket() common.SyncServiceError {
+	var body []byte
+	if common.Configuration.S3Region != "" && common.Configuration.S3Region != "us-east-1" {
+		body = []byte("<CreateBucketConfiguration><LocationConstraint>" + common.Configuration.S3Region +
+			"</LocationConstraint></CreateBucketConfiguration>")
+	}
+	response, err := store.doRequest(http.MethodPut, "", nil, nil, body)
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to create the S3 bucket %s. Error: %s.", common.Configuration.S3Bucket, err)}
+	}
+	if response.StatusCode != http.StatusOK {
+		return s3ResponseError("create the bucket", response)
+	}
+	response.Body.Close()
+	return nil
+}
+
+func (store *S3DataStore) putObject(id string, data []byte) common.SyncServiceError {
+	response, err := store.doRequest(http.MethodPut, id, nil, nil, data)
+	if err != nil {
+		return &common.IOError{Message: "Failed to write the data to S3. Error: " + err.Error()}
+	}
+	if response.StatusCode != http.StatusOK {
+		return s3ResponseError("write the data", response)
+	}
+	response.Body.Close()
+	return nil
+}
+
+func (store *S3DataStore) createMultipartUpload(id string) (string, common.SyncServiceError) {
+	response, err := store.doRequest(http.MethodPost, id, map[string]string{"uploads": ""}, nil, nil)
+	if err != nil {
+		return "", &common.IOError{Message: "Failed to start a multipart upload to S3. Error: " + err.Error()}
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", s3ResponseError("start a multipart upload", response)
+	}
+	defer response.Body.Close()
+
+	result := s3InitiateMultipartUploadResult{}
+	if err := xml.NewDecoder(response.Body).Decode(&result); err != nil || result.UploadID == "" {
+		return "", &Error{fmt.Sprintf("Failed to start a multipart upload to S3, invalid response. Error: %v.", err)}
+	}
+	return result.UploadID, nil
+}
+
+func (store *S3DataStore) uploadPart(id string, uploadID string, partNumber int64, data []byte) (string, common.SyncServiceError) {
+	query := map[string]string{"partNumber": strconv.FormatInt(partNumber, 10), "uploadId": uploadID}
+	response, err := store.doRequest(http.MethodPut, id, query, nil, data)
+	if err != nil {
+		return "", &common.IOError{Message: "Failed to upload a part to S3. Error: " + err.Error()}
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", s3ResponseError("upload a part", response)
+	}
+	response.Body.Close()
+	return response.Header.Get("ETag"), nil
+}
+
+func (store *S3DataStore) completeMultipartUpload(id string, upload *s3Upload) common.SyncServiceError {
+	request := s3CompleteMultipartUpload{}
+	for _, index := range upload.sortedPartIndexes() {
+		request.Parts = append(request.Parts, s3CompletePart{PartNumber: index + 1, ETag: upload.uploaded[index]})
+	}
+	body, err := xml.Marshal(request)
+	if err != nil {
+		return &Error{fmt.Sprintf("Failed to complete a multipart upload to S3. Error: %s.", err)}
+	}
+
+	response, err := store.doRequest(http.MethodPost, id, map[string]string{"uploadId": upload.uploadID}, nil, body)
+	if err != nil {
+		return &common.IOError{Message: "Failed to complete a multipart upload to S3. Error: " + err.Error()}
+	}
+	if response.StatusCode != http.StatusOK {
+		return s3ResponseError("complete a multipart upload", response)
+	}
+	defer response.Body.Close()
+
+	// S3 may report a failure of the completion in the body of a successful response
+	if code, message := parseS3Error(response.Body); code != "" {
+		return &Error{fmt.Sprintf("Failed to complete a multipart upload to S3. Code: %s. Message: %s", code, message)}
+	}
+	return nil
+}
+
+// abortUpload aborts the multipart upload, if there is one. Failures are only logged, since the service
+// removes the parts of aborted uploads, and its lifecycle rules can remove uploads that weren't aborted.
+func (store *S3DataStore) abortUpload(id string, upload *s3Upload) {
+	if upload == nil || upload.uploadID == "" {
+		return
+	}
+	response, err := store.doRequest(http.MethodDelete, id, map[string]string{"uploadId": upload.uploadID}, nil, nil)
+	if err == nil {
+		if response.StatusCode != http.StatusNoContent && response.StatusCode != http.StatusOK &&
+			response.StatusCode != http.StatusNotFound {
+			err = s3ResponseError("abort a multipart upload", response)
+		} else {
+			response.Body.Close()
+		}
+	}
+	if err != nil && log.IsLogging(logger.ERROR) {
+		log.Error("Failed to abort the multipart upload of %s. Error: %s\n", id, err)
+	}
+}
+
+// doRequest sends a request, signed with AWS signature version 4, for the given key of the bucket.
+// An empty key addresses the bucket itself.
+func (store *S3DataStore) doRequest(method string, key string, query map[string]string, headers map[string]string,
+	body []byte) (*http.Response, error) {
+	path := "/" + common.Configuration.S3Bucket
+	if key != "" {
+		path += "/" + key
+	}
+	requestURL := *store.endpoint
+	requestURL.Path = strings.TrimSuffix(store.endpoint.Path, "/") + path
+	requestURL.RawPath = strings.TrimSuffix(store.endpoint.EscapedPath(), "/") + s3Escape(path, false)
+	requestURL.RawQuery = s3CanonicalQuery(query)
+
+	request, err := http.NewRequest(method, requestURL.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	if common.Configuration.S3AccessKeyID != "" {
+		store.signRequest(request, requestURL.RawPath, body, time.Now())
+	}
+	return store.client.Do(request)
+}
+
+// signRequest adds the authorization headers of AWS signature version 4 to the request
+func (store *S3DataStore) signRequest(request *http.Request, canonicalURI string, body []byte, now time.Time) {
+	payloadHash := s3EmptyPayloadHash
+	if len(body) > 0 {
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+	}
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		canonicalURI,
+		request.URL.RawQuery,
+		"host:" + request.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := date + "/" + common.Configuration.S3Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	signingKey := s3HMAC([]byte("AWS4"+common.Configuration.S3SecretAccessKey), date)
+	signingKey = s3HMAC(signingKey, common.Configuration.S3Region)
+	signingKey = s3HMAC(signingKey, "s3")
+	signingKey = s3HMAC(signingKey, "aws4_request")
+	signature := hex.EncodeToString(s3HMAC(signingKey, stringToSign))
+
+	request.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+common.Configuration.S3AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Escape URI encodes the string as required by AWS signature version 4
+func s3Escape(value string, escapeSlash bool) string {
+	var strBuilder strings.Builder
+	for _, b := range []byte(value) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') ||
+			b == '-' || b == '_' || b == '.' || b == '~' || (b == '/' && !escapeSlash) {
+			strBuilder.WriteByte(b)
+		} else {
+			fmt.Fprintf(&strBuilder, "%%%02X", b)
+		}
+	}
+	return strBuilder.String()
+}
+
+func s3CanonicalQuery(query map[string]string) string {
+	if len(query) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	params := make([]string, len(keys))
+	for i, key := range keys {
+		params[i] = s3Escape(key, true) + "=" + s3Escape(query[key], true)
+	}
+	return strings.Join(params, "&")
+}
+
+// s3ContentRangeSize returns the complete size of the data from the Content-Range header of the response
+func s3ContentRangeSize(response *http.Response) (int64, bool) {
+	contentRange := response.Header.Get("Content-Range")
+	index := strings.LastIndex(contentRange, "/")
+	if index == -1 {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(contentRange[index+1:], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return size, true
+}
+
+// parseS3Error returns the code and the message of an S3 error document, or empty strings
+// if the document isn't an error
+func parseS3Error(reader io.Reader) (string, string) {
+	result := s3ErrorResponse{}
+	if err := xml.NewDecoder(reader).Decode(&result); err != nil || result.XMLName.Local != "Error" {
+		return "", ""
+	}
+	return result.Code, result.Message
+}
@@ -0,0 +1,445 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/open-horizon/edge-sync-service/common"
+)
+
+// testDataStore is set on the stores created by setUpStorage
+var testDataStore DataStore
+
+func TestS3DataStore(t *testing.T) {
+	server := setUpS3(5 * 1024 * 1024)
+	defer server.Close()
+
+	store := &S3DataStore{}
+	if err := store.Init(); err != nil {
+		t.Fatalf("Failed to initialize the S3 data store. Error: %s", err.Error())
+	}
+	if !server.s3.buckets["sync-test"] {
+		t.Errorf("The bucket wasn't created")
+	}
+
+	id := "myorg:type1:some/object id"
+	data := []byte("abcdefghijklmnopqrstuvwxyz")
+	if written, err := store.StoreData(id, bytes.NewReader(data), uint32(len(data))); err != nil {
+		t.Errorf("StoreData failed. Error: %s", err.Error())
+	} else if written != int64(len(data)) {
+		t.Errorf("StoreData wrote %d bytes instead of %d", written, len(data))
+	}
+	checkS3Data(t, store, id, data)
+
+	tests := []struct {
+		size   int
+		offset int64
+		eof    bool
+		length int
+	}{
+		{10, 0, false, 10},
+		{10, 16, true, 10},
+		{10, 20, true, 6},
+		{10, 26, true, 0},
+		{10, 100, true, 0},
+	}
+	for _, test := range tests {
+		chunk, eof, length, err := store.GetDataChunk(id, test.size, test.offset)
+		if err != nil {
+			t.Errorf("GetDataChunk (%d, %d) failed. Error: %s", test.size, test.offset, err.Error())
+			continue
+		}
+		if eof != test.eof || length != test.length {
+			t.Errorf("GetDataChunk (%d, %d) returned eof %t and length %d instead of %t and %d",
+				test.size, test.offset, eof, length, test.eof, test.length)
+		} else if length > 0 && !bytes.Equal(chunk[:length], data[test.offset:test.offset+int64(length)]) {
+			t.Errorf("GetDataChunk (%d, %d) returned wrong data: %s", test.size, test.offset, chunk[:length])
+		}
+	}
+
+	if err := store.DeleteData(id); err != nil {
+		t.Errorf("DeleteData failed. Error: %s", err.Error())
+	}
+	if _, err := store.GetData(id); err == nil || !common.IsNotFound(err) {
+		t.Errorf("GetData of deleted data didn't return NotFound. Error: %v", err)
+	}
+	if _, _, _, err := store.GetDataChunk(id, 10, 0); err == nil || !common.IsNotFound(err) {
+		t.Errorf("GetDataChunk of deleted data didn't return NotFound. Error: %v", err)
+	}
+
+	common.Configuration.S3SecretAccessKey = "wrong"
+	if _, err := store.StoreData(id, bytes.NewReader(data), 0); err == nil {
+		t.Errorf("StoreData with a wrong secret didn't fail")
+	}
+}
+
+func TestS3DataStoreMultipart(t *testing.T) {
+	server := setUpS3(10)
+	defer server.Close()
+
+	store := &S3DataStore{}
+	if err := store.Init(); err != nil {
+		t.Fatalf("Failed to initialize the S3 data store. Error: %s", err.Error())
+	}
+
+	id := "myorg:type1:multipart"
+	data := []byte("abcdefghijklmnopqrstuvwxyz")
+	if written, err := store.StoreData(id, bytes.NewReader(data), 0); err != nil {
+		t.Errorf("StoreData failed. Error: %s", err.Error())
+	} else if written != int64(len(data)) {
+		t.Errorf("StoreData wrote %d bytes instead of %d", written, len(data))
+	}
+	checkS3Data(t, store, id, data)
+	if server.s3.completed != 1 {
+		t.Errorf("StoreData of %d bytes didn't use a multipart upload", len(data))
+	}
+
+	// Chunks of 7 bytes arrive out of order, with a duplicate, and are combined into parts of 10 bytes.
+	// The chunks are appended by two instances of the data store, no state is kept in memory between chunks.
+	data = []byte("0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	offsets := []int64{14, 0, 28, 7, 0, 21, 35}
+	otherStore := &S3DataStore{}
+	if err := otherStore.Init(); err != nil {
+		t.Fatalf("Failed to initialize the S3 data store. Error: %s", err.Error())
+	}
+	for i, offset := range offsets {
+		end := offset + 7
+		if end > int64(len(data)) {
+			end = int64(len(data))
+		}
+		isFirstChunk := i == 0
+		isLastChunk := i == len(offsets)-1
+		appendingStore := store
+		if i%2 == 1 {
+			appendingStore = otherStore
+		}
+		if err := appendingStore.AppendData(id, bytes.NewReader(data[offset:end]), uint32(end-offset), offset, int64(len(data)),
+			isFirstChunk, isLastChunk); err != nil {
+			t.Errorf("AppendData at offset %d failed. Error: %s", offset, err.Error())
+		}
+		if !isLastChunk {
+			// The previous data is kept until the upload completes
+			checkS3Data(t, store, id, []byte("abcdefghijklmnopqrstuvwxyz"))
+		}
+	}
+	checkS3Data(t, store, id, data)
+	if server.s3.completed != 2 {
+		t.Errorf("AppendData of %d bytes didn't use a multipart upload", len(data))
+	}
+	if len(server.s3.uploads) != 0 {
+		t.Errorf("%d multipart uploads were left behind", len(server.s3.uploads))
+	}
+	if chunks := server.s3.chunks(); chunks != 0 {
+		t.Errorf("%d chunks were left behind", chunks)
+	}
+
+	// Data that fits in a single part is uploaded as a regular object
+	data = []byte("small")
+	if err := store.AppendData(id, bytes.NewReader(data[3:]), 2, 3, int64(len(data)), true, false); err != nil {
+		t.Errorf("AppendData failed. Error: %s", err.Error())
+	}
+	if err := store.AppendData(id, bytes.NewReader(data[:3]), 3, 0, int64(len(data)), false, true); err != nil {
+		t.Errorf("AppendData failed. Error: %s", err.Error())
+	}
+	checkS3Data(t, store, id, data)
+
+	// Empty data is stored as an empty object
+	if err := store.AppendData(id, bytes.NewReader(nil), 0, 0, 0, true, true); err != nil {
+		t.Errorf("AppendData of empty data failed. Error: %s", err.Error())
+	}
+	checkS3Data(t, store, id, []byte{})
+
+	// The chunks of an abandoned append are removed when a new append starts
+	data = []byte("0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	if err := store.AppendData(id, bytes.NewReader(data[7:14]), 7, 7, int64(len(data)), true, false); err != nil {
+		t.Errorf("AppendData failed. Error: %s", err.Error())
+	}
+	if err := store.AppendData(id, bytes.NewReader(data[:7]), 7, 0, int64(len(data)), true, false); err != nil {
+		t.Errorf("AppendData failed. Error: %s", err.Error())
+	}
+	if chunks := server.s3.chunks(); chunks != 1 {
+		t.Errorf("Expected 1 chunk, found %d", chunks)
+	}
+
+	// The data isn't completed if chunks are missing
+	if err := store.AppendData(id, bytes.NewReader(data[28:]), uint32(len(data)-28), 28, int64(len(data)), false, true); err == nil {
+		t.Errorf("AppendData completed the data with missing chunks")
+	}
+	checkS3Data(t, store, id, []byte{})
+
+	if err := store.DeleteData(id); err != nil {
+		t.Errorf("DeleteData failed. Error: %s", err.Error())
+	}
+	if chunks := server.s3.chunks(); chunks != 0 {
+		t.Errorf("DeleteData didn't delete the chunks, found %d", chunks)
+	}
+}
+
+func TestBoltStorageS3ObjectData(t *testing.T) {
+	server := setUpS3(10)
+	defer server.Close()
+	testDataStore = &S3DataStore{}
+	defer func() { testDataStore = nil }()
+
+	testStorageObjectData(common.Bolt, t)
+	if len(server.s3.objects) == 0 {
+		t.Errorf("The objects' data wasn't stored in S3")
+	}
+}
+
+func TestBoltStorageS3OrgDeleteObjects(t *testing.T) {
+	server := setUpS3(10)
+	defer server.Close()
+	testDataStore = &S3DataStore{}
+	defer func() { testDataStore = nil }()
+
+	testStorageOrgDeleteObjects(common.Bolt, t)
+}
+
+func checkS3Data(t *testing.T, store *S3DataStore, id string, expected []byte) {
+	dataReader, err := store.GetData(id)
+	if err != nil {
+		t.Errorf("GetData failed. Error: %s", err.Error())
+		return
+	}
+	data, err := ioutil.ReadAll(dataReader)
+	dataReader.(interface{ Close() error }).Close()
+	if err != nil {
+		t.Errorf("Failed to read the data. Error: %s", err.Error())
+	} else if !bytes.Equal(data, expected) {
+		t.Errorf("GetData returned %s instead of %s", data, expected)
+	}
+}
+
+type testS3Server struct {
+	*httptest.Server
+	s3 *fakeS3
+}
+
+func setUpS3(partSize int64) *testS3Server {
+	s3 := &fakeS3{buckets: make(map[string]bool), objects: make(map[string][]byte),
+		uploads: make(map[string]map[int][]byte), minPartSize: int(partSize)}
+	server := &testS3Server{Server: httptest.NewServer(s3), s3: s3}
+
+	common.Configuration.S3Endpoint = server.URL
+	common.Configuration.S3Region = "us-east-1"
+	common.Configuration.S3Bucket = "sync-test"
+	common.Configuration.S3AccessKeyID = "test-key"
+	common.Configuration.S3SecretAccessKey = "test-secret"
+	common.Configuration.S3PartSize = partSize
+	s3.secret = common.Configuration.S3SecretAccessKey
+	return server
+}
+
+// fakeS3 is a minimal in-memory stand-in for an S3 compatible service
+type fakeS3 struct {
+	lock        sync.Mutex
+	secret      string
+	minPartSize int
+	buckets     map[string]bool
+	objects     map[string][]byte
+	uploads     map[string]map[int][]byte
+	nextUpload  int
+	completed   int
+}
+
+func (s3 *fakeS3) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	s3.lock.Lock()
+	defer s3.lock.Unlock()
+
+	body, _ := ioutil.ReadAll(request.Body)
+	if !s3.checkSignature(request, body) {
+		s3.writeError(writer, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+
+	path := strings.TrimPrefix(request.URL.Path, "/")
+	bucket, key := path, ""
+	if index := strings.Index(path, "/"); index != -1 {
+		bucket, key = path[:index], path[index+1:]
+	}
+	query := request.URL.Query()
+	_, initiate := query["uploads"]
+
+	if key == "" {
+		switch request.Method {
+		case http.MethodHead:
+			if !s3.buckets[bucket] {
+				writer.WriteHeader(http.StatusNotFound)
+			}
+		case http.MethodPut:
+			s3.buckets[bucket] = true
+		case http.MethodGet:
+			s3.list(writer, bucket, query.Get("prefix"), query.Get("continuation-token"))
+		default:
+			writer.WriteHeader(http.StatusMethodNotAllowed)
+		}
+		return
+	}
+	if !s3.buckets[bucket] {
+		s3.writeError(writer, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	name := bucket + "/" + key
+
+	switch {
+	case request.Method == http.MethodPost && initiate:
+		s3.nextUpload++
+		uploadID := strconv.Itoa(s3.nextUpload)
+		s3.uploads[uploadID] = make(map[int][]byte)
+		fmt.Fprintf(writer, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", uploadID)
+
+	case request.Method == http.MethodPut && query.Get("uploadId") != "":
+		parts, ok := s3.uploads[query.Get("uploadId")]
+		if !ok {
+			s3.writeError(writer, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		partNumber, _ := strconv.Atoi(query.Get("partNumber"))
+		parts[partNumber] = body
+		writer.Header().Set("ETag", fmt.Sprintf("\"etag-%d\"", partNumber))
+
+	case request.Method == http.MethodPost && query.Get("uploadId") != "":
+		parts, ok := s3.uploads[query.Get("uploadId")]
+		if !ok {
+			s3.writeError(writer, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		complete := s3CompleteMultipartUpload{}
+		if err := xml.Unmarshal(body, &complete); err != nil || len(complete.Parts) == 0 {
+			s3.writeError(writer, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		var data []byte
+		for i, part := range complete.Parts {
+			partData, ok := parts[int(part.PartNumber)]
+			if !ok || part.ETag != fmt.Sprintf("\"etag-%d\"", part.PartNumber) {
+				s3.writeError(writer, http.StatusBadRequest, "InvalidPart")
+				return
+			}
+			if i < len(complete.Parts)-1 && len(partData) < s3.minPartSize {
+				s3.writeError(writer, http.StatusBadRequest, "EntityTooSmall")
+				return
+			}
+			data = append(data, partData...)
+		}
+		delete(s3.uploads, query.Get("uploadId"))
+		s3.objects[name] = data
+		s3.completed++
+		fmt.Fprint(writer, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+
+	case request.Method == http.MethodDelete && query.Get("uploadId") != "":
+		delete(s3.uploads, query.Get("uploadId"))
+		writer.WriteHeader(http.StatusNoContent)
+
+	case request.Method == http.MethodPut:
+		s3.objects[name] = body
+
+	case request.Method == http.MethodGet:
+		data, ok := s3.objects[name]
+		if !ok {
+			s3.writeError(writer, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		rangeHeader := request.Header.Get("Range")
+		if rangeHeader == "" {
+			writer.Write(data)
+			return
+		}
+		var start, end int
+		fmt.Sscanf(rangeHeader, "bytes=%d-%d", &start, &end)
+		if start >= len(data) {
+			s3.writeError(writer, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+			return
+		}
+		if end >= len(data) {
+			end = len(data) - 1
+		}
+		writer.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+		writer.WriteHeader(http.StatusPartialContent)
+		writer.Write(data[start : end+1])
+
+	case request.Method == http.MethodDelete:
+		delete(s3.objects, name)
+		writer.WriteHeader(http.StatusNoContent)
+
+	default:
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// checkSignature verifies the payload hash and recomputes the signature with the secret of the fake service
+func (s3 *fakeS3) checkSignature(request *http.Request, body []byte) bool {
+	sum := sha256.Sum256(body)
+	if request.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		return false
+	}
+	authorization := request.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=test-key/") {
+		return false
+	}
+
+	secret := common.Configuration.S3SecretAccessKey
+	common.Configuration.S3SecretAccessKey = s3.secret
+	defer func() { common.Configuration.S3SecretAccessKey = secret }()
+
+	signed, _ := http.NewRequest(request.Method, "http://"+request.Host+request.URL.RequestURI(), nil)
+	signed.Header.Set("X-Amz-Date", request.Header.Get("X-Amz-Date"))
+	amzDate, _ := time.Parse("20060102T150405Z", request.Header.Get("X-Amz-Date"))
+	(&S3DataStore{}).signRequest(signed, request.URL.EscapedPath(), body, amzDate)
+	return signed.Header.Get("Authorization") == authorization
+}
+
+// list writes a page of the keys of the bucket with the prefix, the pages are small to test the continuation of listings
+func (s3 *fakeS3) list(writer http.ResponseWriter, bucket string, prefix string, token string) {
+	keys := make([]string, 0)
+	for name := range s3.objects {
+		key := strings.TrimPrefix(name, bucket+"/")
+		if strings.HasPrefix(name, bucket+"/") && strings.HasPrefix(key, prefix) && key > token {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	truncated := len(keys) > 3
+	if truncated {
+		keys = keys[:3]
+	}
+	fmt.Fprint(writer, "<ListBucketResult>")
+	for _, key := range keys {
+		fmt.Fprintf(writer, "<Contents><Key>%s</Key><Size>%d</Size></Contents>", key, len(s3.objects[bucket+"/"+key]))
+	}
+	if truncated {
+		fmt.Fprintf(writer, "<IsTruncated>true</IsTruncated><NextContinuationToken>%s</NextContinuationToken>", keys[len(keys)-1])
+	}
+	fmt.Fprint(writer, "</ListBucketResult>")
+}
+
+// chunks returns the number of stored chunks of appended data
+func (s3 *fakeS3) chunks() int {
+	s3.lock.Lock()
+	defer s3.lock.Unlock()
+	count := 0
+	for name := range s3.objects {
+		if strings.HasPrefix(name, "sync-test/"+s3ChunksPrefix) {
+			count++
+		}
+	}
+	return count
+}
+
+func (s3 *fakeS3) writeError(writer http.ResponseWriter, status int, code string) {
+	writer.WriteHeader(status)
+	fmt.Fprintf(writer, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
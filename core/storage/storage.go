@@ -3,6 +3,8 @@ package storage
 import (
 	"fmt"
 	"io"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -11,14 +13,21 @@ import (
 )
 
 const (
-	destinations    = "syncDestinations"
-	leader          = "syncLeaderElection"
-	notifications   = "syncNotifications"
-	objects         = "syncObjects"
-	messagingGroups = "syncMessagingGroups"
-	webhooks        = "syncWebhooks"
-	organizations   = "syncOrganizations"
-	acls            = "syncACLs"
+	destinations      = "syncDestinations"
+	destinationGroups = "syncDestinationGroups"
+	leader            = "syncLeaderElection"
+	notifications     = "syncNotifications"
+	objects           = "syncObjects"
+	messagingGroups   = "syncMessagingGroups"
+	webhooks          = "syncWebhooks"
+	webhookSecrets    = "syncWebhookSecrets"
+	webhookEvents     = "syncWebhookEvents"
+	deliveries        = "syncWebhookDeliveries"
+	auditLog          = "syncAuditLog"
+	rollouts          = "syncRollouts"
+	objectVersions    = "syncObjectVersions"
+	organizations     = "syncOrganizations"
+	acls              = "syncACLs"
 )
 
 // Storage is the interface for stores
@@ -50,6 +59,10 @@ type Storage interface {
 	// Update object's source data URI
 	UpdateObjectSourceDataURI(orgID string, objectType string, objectID string, sourceDataURI string) common.SyncServiceError
 
+	// Update the hash of object's data, its size as it was provided by the application, and whether it is encrypted
+	UpdateObjectDataInfo(orgID string, objectType string, objectID string, dataHash string, originalSize int64,
+		encrypted bool) common.SyncServiceError
+
 	// Find the object and return its status
 	RetrieveObjectStatus(orgID string, objectType string, objectID string) (string, common.SyncServiceError)
 
@@ -67,11 +80,13 @@ type Storage interface {
 
 	// Return the list of all the edge updated objects that are not marked as consumed or received
 	// If received is true, return objects marked as received
-	RetrieveUpdatedObjects(orgID string, objectType string, received bool) ([]common.MetaData, common.SyncServiceError)
+	// The objects are selected by the filter, and are sorted by type and ID when the filter specifies a page
+	RetrieveUpdatedObjects(orgID string, objectType string, received bool, filter common.ObjectsFilter) ([]common.MetaData, common.SyncServiceError)
 
 	// RetrieveObjectsWithDestinationPolicy returns the list of all the objects that have a Destination Policy
 	// If received is true, return objects marked as policy received
-	RetrieveObjectsWithDestinationPolicy(orgID string, received bool) ([]common.ObjectDestinationPolicy, common.SyncServiceError)
+	// The objects are selected by the filter, and are sorted by type and ID when the filter specifies a page
+	RetrieveObjectsWithDestinationPolicy(orgID string, received bool, filter common.ObjectsFilter) ([]common.ObjectDestinationPolicy, common.SyncServiceError)
 
 	// RetrieveObjectsWithDestinationPolicyByService returns the list of all the object Policies for a particular service
 	RetrieveObjectsWithDestinationPolicyByService(orgID, serviceOrgID, serviceName string) ([]common.ObjectDestinationPolicy, common.SyncServiceError)
@@ -79,8 +94,12 @@ type Storage interface {
 	// RetrieveObjectsWithDestinationPolicyUpdatedSince returns the list of all the objects that have a Destination Policy updated since the specified time
 	RetrieveObjectsWithDestinationPolicyUpdatedSince(orgID string, since int64) ([]common.ObjectDestinationPolicy, common.SyncServiceError)
 
+	// RetrieveObjectsWithDestinationGroup returns the list of all the objects whose destinations list includes the destination group
+	RetrieveObjectsWithDestinationGroup(orgID string, name string) ([]common.MetaData, common.SyncServiceError)
+
 	// RetrieveAllObjects returns the list of all the objects of the specified type
-	RetrieveAllObjects(orgID string, objectType string) ([]common.ObjectDestinationPolicy, common.SyncServiceError)
+	// The objects are selected by the filter, and are sorted by type and ID when the filter specifies a page
+	RetrieveAllObjects(orgID string, objectType string, filter common.ObjectsFilter) ([]common.ObjectDestinationPolicy, common.SyncServiceError)
 
 	// Return the list of all the objects that need to be sent to the destination
 	RetrieveObjects(orgID string, destType string, destID string, resend int) ([]common.MetaData, common.SyncServiceError)
@@ -149,14 +168,78 @@ type Storage interface {
 	// currently stored in this node's storage
 	GetNumberOfStoredObjects() (uint32, common.SyncServiceError)
 
-	// AddWebhook stores a webhook for an object type
-	AddWebhook(orgID string, objectType string, url string) common.SyncServiceError
+	// RetrieveOrganizationsUsage returns the number of objects received from the application that are currently
+	// stored in this node's storage and the total size of their data and the data of their versions,
+	// for the organization with the provided orgID.
+	// An empty orgID returns the usage of all the organizations that have stored objects.
+	RetrieveOrganizationsUsage(orgID string) ([]common.OrganizationUsage, common.SyncServiceError)
+
+	// AddWebhook stores a webhook for an object type, the secret and events of an existing webhook are replaced
+	AddWebhook(orgID string, objectType string, webhook common.Webhook) common.SyncServiceError
 
 	// DeleteWebhook deletes a webhook for an object type
 	DeleteWebhook(orgID string, objectType string, url string) common.SyncServiceError
 
 	// RetrieveWebhooks gets the webhooks for the object type
-	RetrieveWebhooks(orgID string, objectType string) ([]string, common.SyncServiceError)
+	RetrieveWebhooks(orgID string, objectType string) ([]common.Webhook, common.SyncServiceError)
+
+	// StoreWebhookDelivery stores a delivery to a webhook, replacing the delivery with the same ID
+	StoreWebhookDelivery(delivery common.WebhookDelivery) common.SyncServiceError
+
+	// DeleteWebhookDelivery deletes a delivery to a webhook
+	DeleteWebhookDelivery(id string) common.SyncServiceError
+
+	// RetrieveWebhookDeliveries returns the deliveries to webhooks with the provided orgID and status.
+	// An empty orgID or status matches all the deliveries.
+	RetrieveWebhookDeliveries(orgID string, status string) ([]common.WebhookDelivery, common.SyncServiceError)
+
+	// StoreAuditEntry stores an entry of the audit log
+	StoreAuditEntry(entry common.AuditEntry) common.SyncServiceError
+
+	// RetrieveAuditEntries returns the entries of the audit log with the provided orgID and timestamps in the range [from, to),
+	// sorted by their timestamps. An empty orgID matches all the entries, and a zero from or to leaves the range open.
+	RetrieveAuditEntries(orgID string, from time.Time, to time.Time) ([]common.AuditEntry, common.SyncServiceError)
+
+	// DeleteAuditEntries deletes the entries of the audit log with timestamps before the provided time
+	DeleteAuditEntries(before time.Time) common.SyncServiceError
+
+	// StoreRollout stores the state of the rollout of an object, replacing the object's previous rollout state
+	StoreRollout(rollout common.RolloutStatus) common.SyncServiceError
+
+	// RetrieveRollout returns the state of the rollout of an object, or nil if the object has no rollout state
+	RetrieveRollout(orgID string, objectType string, objectID string) (*common.RolloutStatus, common.SyncServiceError)
+
+	// RetrieveRollouts returns the states of the rollouts with the provided status. An empty status matches all the rollouts.
+	RetrieveRollouts(status string) ([]common.RolloutStatus, common.SyncServiceError)
+
+	// DeleteRollout deletes the state of the rollout of an object
+	DeleteRollout(orgID string, objectType string, objectID string) common.SyncServiceError
+
+	// StoreObjectVersion stores the current version of an object in the object's version history before the object is replaced,
+	// and removes the oldest versions of the object so that at most maxVersions versions are kept.
+	// The object's data is copied within the storage, unless a version in the history has the same data, which is then shared.
+	StoreObjectVersion(version common.ObjectVersion, maxVersions int) common.SyncServiceError
+
+	// RetrieveObjectVersions returns the versions in the version history of an object, from the newest to the oldest
+	RetrieveObjectVersions(orgID string, objectType string, objectID string) ([]common.ObjectVersion, common.SyncServiceError)
+
+	// RetrieveObjectVersionData returns the data of a version of an object, or nil if the version has no data
+	RetrieveObjectVersionData(orgID string, objectType string, objectID string, version int64) ([]byte, common.SyncServiceError)
+
+	// DeleteObjectVersions deletes the version history of an object
+	DeleteObjectVersions(orgID string, objectType string, objectID string) common.SyncServiceError
+
+	// StoreDestinationGroup stores a destination group, replacing the destinations of an existing group
+	StoreDestinationGroup(group common.DestinationGroup) common.SyncServiceError
+
+	// RetrieveDestinationGroup returns a destination group, or nil if the group doesn't exist
+	RetrieveDestinationGroup(orgID string, name string) (*common.DestinationGroup, common.SyncServiceError)
+
+	// RetrieveDestinationGroups returns the destination groups of an organization
+	RetrieveDestinationGroups(orgID string) ([]common.DestinationGroup, common.SyncServiceError)
+
+	// DeleteDestinationGroup deletes a destination group
+	DeleteDestinationGroup(orgID string, name string) common.SyncServiceError
 
 	// Return all the destinations with the provided orgID and destType
 	RetrieveDestinations(orgID string, destType string) ([]common.Destination, common.SyncServiceError)
@@ -206,6 +289,9 @@ type Storage interface {
 	// Return the list of pending notifications that are waiting to be sent to the destination
 	RetrievePendingNotifications(orgID string, destType string, destID string) ([]common.Notification, common.SyncServiceError)
 
+	// GetNumberOfNotificationsByStatus returns the number of notifications in each status
+	GetNumberOfNotificationsByStatus() (map[string]uint32, common.SyncServiceError)
+
 	// InsertInitialLeader inserts the initial leader document in the collection is empty
 	InsertInitialLeader(leaderID string) (bool, common.SyncServiceError)
 
@@ -274,6 +360,36 @@ type Storage interface {
 	IsPersistent() bool
 }
 
+// DataStore is the interface for stores of objects' data.
+// A Storage that is given a DataStore keeps the objects' data in the DataStore,
+// while the objects' meta data remains in the Storage itself.
+// The data is identified by the object's collection ID (orgID:objectType:objectID).
+type DataStore interface {
+	// Initialize the data store
+	Init() common.SyncServiceError
+
+	// StoreData stores the data read from the reader, and returns the number of bytes written.
+	// If dataLength isn't zero, the reader is expected to contain exactly dataLength bytes
+	StoreData(id string, dataReader io.Reader, dataLength uint32) (int64, common.SyncServiceError)
+
+	// AppendData stores a chunk of data at the given offset. Chunks may arrive in any order.
+	// total is the size of the complete data. The data becomes available once the last chunk is appended.
+	// Calls for the same id must not run concurrently
+	AppendData(id string, dataReader io.Reader, dataLength uint32, offset int64, total int64,
+		isFirstChunk bool, isLastChunk bool) common.SyncServiceError
+
+	// GetData returns a reader of the data, or common.NotFound if there is no data.
+	// After reading, the reader has to be closed
+	GetData(id string) (io.Reader, common.SyncServiceError)
+
+	// GetDataChunk returns a chunk of the data, the eof flag, and the length of the chunk,
+	// or common.NotFound if there is no data
+	GetDataChunk(id string, size int, offset int64) ([]byte, bool, int, common.SyncServiceError)
+
+	// DeleteData deletes the data
+	DeleteData(id string) common.SyncServiceError
+}
+
 // Error is the error used in the storage layer
 type Error struct {
 	message string
@@ -387,6 +503,28 @@ func ensureArrayCapacity(data []byte, newCapacity int64) []byte {
 	return new
 }
 
+// createObjectVersionID returns the ID of a version of an object, which is also the ID of the version's data
+// unless the version shares the data of another version
+func createObjectVersionID(orgID string, objectType string, objectID string, version int64) string {
+	return createObjectCollectionID(orgID, objectType, objectID) + ":" + strconv.FormatInt(version, 10)
+}
+
+// hasSameObjectVersionData returns true if two versions of an object have the same data, in which case they share
+// the stored data. The data ID of an object changes whenever its data is replaced, and is kept by meta data only updates.
+func hasSameObjectVersionData(first common.ObjectVersion, second common.ObjectVersion) bool {
+	return !first.MetaData.NoData && !second.MetaData.NoData && first.MetaData.DataID != 0 &&
+		first.MetaData.DataID == second.MetaData.DataID
+}
+
+// isNewerObjectVersion returns true if the first version of an object replaced the second version,
+// it is used to sort the versions of an object from the newest to the oldest
+func isNewerObjectVersion(first common.ObjectVersion, second common.ObjectVersion) bool {
+	if !first.Timestamp.Equal(second.Timestamp) {
+		return first.Timestamp.After(second.Timestamp)
+	}
+	return first.Version > second.Version
+}
+
 func createDataPath(prefix string, orgID string, objectType string, objectID string) string {
 	var strBuilder strings.Builder
 	strBuilder.Grow(len(prefix) + len(orgID) + len(objectType) + len(objectID) + 3)
@@ -405,7 +543,27 @@ func createDataPathFromMeta(prefix string, metaData common.MetaData) string {
 
 func createDestinationFromList(orgID string, store Storage, destinationsList []string) ([]common.StoreDestinationStatus, common.SyncServiceError) {
 	dests := make([]common.StoreDestinationStatus, 0)
+	var groupDests []common.StoreDestinationStatus
+	// The registered destinations of the organization are fetched once for all the groups in the list
+	var orgDestinations []common.Destination
 	for _, d := range destinationsList {
+		if name, ok := common.GetDestinationGroupName(d); ok {
+			if orgDestinations == nil {
+				var err error
+				if orgDestinations, err = store.RetrieveDestinations(orgID, ""); err != nil {
+					return nil, &Error{fmt.Sprintf("Failed to find the destinations of destination group %s. Error: %s", name, err)}
+				}
+				if orgDestinations == nil {
+					orgDestinations = make([]common.Destination, 0)
+				}
+			}
+			destinations, err := createDestinationsFromGroup(orgID, store, name, orgDestinations)
+			if err != nil {
+				return nil, err
+			}
+			groupDests = append(groupDests, destinations...)
+			continue
+		}
 		parts := strings.Split(d, ":")
 		if len(parts) == 2 {
 			if dest, err := store.RetrieveDestination(orgID, parts[0], parts[1]); err == nil && dest != nil {
@@ -420,16 +578,59 @@ func createDestinationFromList(orgID string, store Storage, destinationsList []s
 			return nil, &common.InvalidRequest{Message: fmt.Sprintf("Invalid destination %s", d)}
 		}
 	}
+
+	// A destination may be in several groups, or be listed explicitly too
+	for _, groupDest := range groupDests {
+		found := false
+		for _, dest := range dests {
+			if isSameDestination(dest.Destination, groupDest.Destination) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			dests = append(dests, groupDest)
+		}
+	}
 	return dests, nil
 }
 
+// createDestinationsFromGroup returns the registered destinations of a destination group out of the registered destinations
+// of the organization, the destinations of the group that haven't registered yet are skipped
+func createDestinationsFromGroup(orgID string, store Storage, name string,
+	orgDestinations []common.Destination) ([]common.StoreDestinationStatus, common.SyncServiceError) {
+	group, err := store.RetrieveDestinationGroup(orgID, name)
+	if err != nil {
+		return nil, &Error{fmt.Sprintf("Failed to find destination group %s. Error: %s", name, err)}
+	}
+	if group == nil {
+		return nil, &common.InvalidRequest{Message: fmt.Sprintf("Invalid destination group %s", name)}
+	}
+	if len(group.Destinations) == 0 {
+		return nil, nil
+	}
+	dests := make([]common.StoreDestinationStatus, 0)
+	for _, dest := range orgDestinations {
+		if group.Contains(dest.DestType, dest.DestID) {
+			dests = append(dests, common.StoreDestinationStatus{Destination: dest, Status: common.Pending})
+		}
+	}
+	return dests, nil
+}
+
+// isSameDestination compares the addresses, protocols and code versions of destinations, ignoring their policies
+func isSameDestination(first common.Destination, second common.Destination) bool {
+	return first.DestOrgID == second.DestOrgID && first.DestType == second.DestType && first.DestID == second.DestID &&
+		first.Communication == second.Communication && first.CodeVersion == second.CodeVersion
+}
+
 func compareDestinations(oldList []common.StoreDestinationStatus, newList []common.StoreDestinationStatus, useOldStatus bool) ([]common.StoreDestinationStatus, []common.StoreDestinationStatus, []common.StoreDestinationStatus) {
 	deletedDests := make([]common.StoreDestinationStatus, 0)
 	addedDests := make([]common.StoreDestinationStatus, 0)
 	for _, dest := range oldList {
 		found := false
 		for index, newDest := range newList {
-			if dest.Destination == newDest.Destination {
+			if isSameDestination(dest.Destination, newDest.Destination) {
 				if useOldStatus {
 					newList[index] = dest
 				}
@@ -444,7 +645,7 @@ func compareDestinations(oldList []common.StoreDestinationStatus, newList []comm
 	for index, newDest := range newList {
 		found := false
 		for _, dest := range oldList {
-			if dest.Destination == newDest.Destination {
+			if isSameDestination(dest.Destination, newDest.Destination) {
 				if useOldStatus {
 					newList[index] = dest
 				}
@@ -533,3 +734,65 @@ func DeleteStoredData(store Storage, metaData common.MetaData) common.SyncServic
 
 	return store.DeleteStoredData(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
 }
+
+// sortObjectsPage sorts the meta data of objects by type and ID, and limits them to the page size of the filter
+func sortObjectsPage(metaDatas []common.MetaData, filter common.ObjectsFilter) []common.MetaData {
+	sort.Slice(metaDatas, func(i int, j int) bool {
+		return common.IsObjectBefore(metaDatas[i].ObjectType, metaDatas[i].ObjectID, metaDatas[j].ObjectType, metaDatas[j].ObjectID)
+	})
+	if filter.Limit > 0 && len(metaDatas) > filter.Limit {
+		metaDatas = metaDatas[:filter.Limit]
+	}
+	return metaDatas
+}
+
+// organizationsUsage accumulates the usage of organizations, of all of them or of a single organization if orgID is set
+type organizationsUsage struct {
+	orgID string
+	orgs  map[string]*common.OrganizationUsage
+}
+
+func newOrganizationsUsage(orgID string) *organizationsUsage {
+	return &organizationsUsage{orgID: orgID, orgs: make(map[string]*common.OrganizationUsage)}
+}
+
+func (usage *organizationsUsage) add(orgID string, size int64) {
+	if usage.orgID != "" && orgID != usage.orgID {
+		return
+	}
+	org, ok := usage.orgs[orgID]
+	if !ok {
+		org = &common.OrganizationUsage{OrgID: orgID}
+		usage.orgs[orgID] = org
+	}
+	org.StoredObjects++
+	org.StoredBytes += size
+}
+
+// addVersion adds the size of the data of a version in the version history of an object, which is counted in the
+// stored bytes of the organization but not in its stored objects
+func (usage *organizationsUsage) addVersion(orgID string, size int64) {
+	if usage.orgID != "" && orgID != usage.orgID {
+		return
+	}
+	org, ok := usage.orgs[orgID]
+	if !ok {
+		org = &common.OrganizationUsage{OrgID: orgID}
+		usage.orgs[orgID] = org
+	}
+	org.StoredBytes += size
+}
+
+// result returns the usage sorted by the organizations' IDs. The usage of a single organization is returned even if
+// it has no stored objects.
+func (usage *organizationsUsage) result() []common.OrganizationUsage {
+	if usage.orgID != "" && usage.orgs[usage.orgID] == nil {
+		usage.orgs[usage.orgID] = &common.OrganizationUsage{OrgID: usage.orgID}
+	}
+	result := make([]common.OrganizationUsage, 0, len(usage.orgs))
+	for _, org := range usage.orgs {
+		result = append(result, *org)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].OrgID < result[j].OrgID })
+	return result
+}
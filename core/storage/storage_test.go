@@ -3,7 +3,11 @@ package storage
 import (
 	"bytes"
 	"fmt"
+	"net/http"
 	"os"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -222,7 +226,7 @@ func testStorageObjects(storageType string, t *testing.T) {
 	}
 
 	// There are no updated objects
-	objects, err := store.RetrieveUpdatedObjects(tests[0].metaData.DestOrgID, tests[0].metaData.ObjectType, false)
+	objects, err := store.RetrieveUpdatedObjects(tests[0].metaData.DestOrgID, tests[0].metaData.ObjectType, false, common.ObjectsFilter{})
 	if err != nil {
 		t.Errorf("RetrieveUpdatedObjects failed. Error: %s\n", err.Error())
 	} else if len(objects) != 0 {
@@ -360,7 +364,7 @@ func testStorageObjectsWithPolicy(storageType string, t *testing.T) {
 		}
 	}
 
-	policyInfo, err := store.RetrieveObjectsWithDestinationPolicy("myorg000", false)
+	policyInfo, err := store.RetrieveObjectsWithDestinationPolicy("myorg000", false, common.ObjectsFilter{})
 	if err != nil {
 		t.Errorf("Failed to retrieve the objects with a destination policy. Error: %s\n", err)
 	}
@@ -379,7 +383,7 @@ func testStorageObjectsWithPolicy(storageType string, t *testing.T) {
 		}
 	}
 
-	policyInfo, err = store.RetrieveObjectsWithDestinationPolicy("myorg000", false)
+	policyInfo, err = store.RetrieveObjectsWithDestinationPolicy("myorg000", false, common.ObjectsFilter{})
 	if err != nil {
 		t.Errorf("Failed to retrieve the objects with a destination policy. Error: %s\n", err)
 	}
@@ -388,7 +392,7 @@ func testStorageObjectsWithPolicy(storageType string, t *testing.T) {
 			len(policyInfo), len(tests)-objectsMarkedReceived, len(tests), objectsMarkedReceived)
 	}
 
-	policyInfo, err = store.RetrieveObjectsWithDestinationPolicy("myorg000", true)
+	policyInfo, err = store.RetrieveObjectsWithDestinationPolicy("myorg000", true, common.ObjectsFilter{})
 	if err != nil {
 		t.Errorf("Failed to retrieve the objects with a destination policy. Error: %s\n", err)
 	}
@@ -406,7 +410,7 @@ func testStorageObjectsWithPolicy(storageType string, t *testing.T) {
 		}
 	}
 
-	policyInfo, err = store.RetrieveObjectsWithDestinationPolicy("myorg000", false)
+	policyInfo, err = store.RetrieveObjectsWithDestinationPolicy("myorg000", false, common.ObjectsFilter{})
 	if err != nil {
 		t.Errorf("Failed to retrieve the objects with a destination policy. Error: %s\n", err)
 	}
@@ -698,7 +702,7 @@ func testStorageObjectData(storageType string, t *testing.T) {
 		}
 	}
 
-	objects, err := store.RetrieveUpdatedObjects(tests[0].metaData.DestOrgID, tests[0].metaData.ObjectType, false)
+	objects, err := store.RetrieveUpdatedObjects(tests[0].metaData.DestOrgID, tests[0].metaData.ObjectType, false, common.ObjectsFilter{})
 	if err != nil {
 		t.Errorf("RetrieveUpdatedObjects failed. Error: %s\n", err.Error())
 	} else if len(objects) != 1 {
@@ -788,7 +792,7 @@ func testStorageNotifications(storageType string, t *testing.T) {
 	if notifications, err := store.RetrievePendingNotifications(tests[5].n.DestOrgID, tests[5].n.DestType,
 		tests[5].n.DestID); err != nil {
 		t.Errorf("RetrievePendingNotifications failed. Error: %s\n", err.Error())
-	} else if len(notifications) != 1 && storageType == common.Mongo {
+	} else if len(notifications) != 1 && (storageType == common.Mongo || storageType == common.Postgres) {
 		t.Errorf("RetrievePendingNotifications returned wrong number of notifications: %d instead of 1\n", len(notifications))
 	} else if len(notifications) != 0 && storageType == common.InMemory {
 		t.Errorf("RetrievePendingNotifications returned wrong number of notifications: %d instead of 0\n", len(notifications))
@@ -796,12 +800,19 @@ func testStorageNotifications(storageType string, t *testing.T) {
 
 	if notifications, err := store.RetrievePendingNotifications(tests[5].n.DestOrgID, "", ""); err != nil {
 		t.Errorf("RetrievePendingNotifications failed. Error: %s\n", err.Error())
-	} else if len(notifications) != 2 && storageType == common.Mongo {
+	} else if len(notifications) != 2 && (storageType == common.Mongo || storageType == common.Postgres) {
 		t.Errorf("RetrievePendingNotifications returned wrong number of notifications: %d instead of 2\n", len(notifications))
 	} else if len(notifications) != 0 && storageType == common.InMemory {
 		t.Errorf("RetrievePendingNotifications returned wrong number of notifications: %d instead of 0\n", len(notifications))
 	}
 
+	if counts, err := store.GetNumberOfNotificationsByStatus(); err != nil {
+		t.Errorf("GetNumberOfNotificationsByStatus failed. Error: %s\n", err.Error())
+	} else if counts[common.Update] != 2 || counts[common.Getdata] != 1 || counts[common.UpdatePending] != 1 ||
+		counts[common.DeletePending] != 1 {
+		t.Errorf("GetNumberOfNotificationsByStatus returned wrong numbers of notifications: %v\n", counts)
+	}
+
 	if err := store.DeleteNotificationRecords(tests[0].n.DestOrgID, tests[0].n.ObjectType, tests[0].n.ObjectID, "", ""); err != nil {
 		t.Errorf("DeleteNotificationRecords failed. Error: %s\n", err.Error())
 	} else {
@@ -856,17 +867,20 @@ func testStorageWebhooks(storageType string, t *testing.T) {
 		orgID      string
 		objectType string
 		url        string
+		secret     string
+		events     []string
 	}{
-		{"111", "t1", "abc/xyz"},
-		{"111", "t1", "http://abc/xyz/111"},
-		{"111", "t1", "http://abc/xyz"},
-		{"111", "t2", "http://abc/xyz"},
-		{"111", "t2", "http://abc/xyz/222"},
+		{"111", "t1", "abc/xyz", "", nil},
+		{"111", "t1", "http://abc/xyz/111", "secret1", nil},
+		{"111", "t1", "http://abc/xyz", "secret2", []string{common.WebhookEventConsumed, common.WebhookEventCompleted}},
+		{"111", "t2", "http://abc/xyz", "", nil},
+		{"111", "t2", "http://abc/xyz/222", "secret3", []string{common.WebhookEventFeedback}},
 	}
 
 	// Add all the webhooks
 	for _, test := range tests {
-		if err := store.AddWebhook(test.orgID, test.objectType, test.url); err != nil {
+		webhook := common.Webhook{URL: test.url, Secret: test.secret, Events: test.events}
+		if err := store.AddWebhook(test.orgID, test.objectType, webhook); err != nil {
 			t.Errorf("Failed to add webhook. Error: %s\n", err.Error())
 		}
 	}
@@ -897,13 +911,27 @@ func testStorageWebhooks(storageType string, t *testing.T) {
 			if len(hooks) != 2 {
 				t.Errorf("RetrieveWebhooks returned %d webhooks instead of 2\n", len(hooks))
 			} else {
-				if hooks[0] != tests[0].url || hooks[1] != tests[2].url {
+				if hooks[0].URL != tests[0].url || hooks[1].URL != tests[2].url {
 					t.Errorf("RetrieveWebhooks returned incorrect webhooks \n")
+				} else if hooks[0].Secret != tests[0].secret || hooks[1].Secret != tests[2].secret {
+					t.Errorf("RetrieveWebhooks returned incorrect secrets \n")
+				} else if len(hooks[0].Events) != 0 || len(hooks[1].Events) != 2 || !hooks[1].SubscribedTo(common.WebhookEventCompleted) {
+					t.Errorf("RetrieveWebhooks returned incorrect events \n")
 				}
 			}
 		}
 	}
 
+	// Registering a webhook again replaces its secret and events
+	if err := store.AddWebhook(tests[2].orgID, tests[2].objectType, common.Webhook{URL: tests[2].url, Secret: "newSecret"}); err != nil {
+		t.Errorf("Failed to add webhook. Error: %s\n", err.Error())
+	}
+	if hooks, err := store.RetrieveWebhooks(tests[0].orgID, tests[0].objectType); err != nil {
+		t.Errorf("Failed to retrieve webhooks. Error: %s\n", err.Error())
+	} else if len(hooks) != 2 || hooks[1].URL != tests[2].url || hooks[1].Secret != "newSecret" || len(hooks[1].Events) != 0 {
+		t.Errorf("RetrieveWebhooks returned incorrect webhooks after the secret was replaced: %v\n", hooks)
+	}
+
 	// Delete the remaining two t1 hooks
 	if err := store.DeleteWebhook(tests[0].orgID, tests[0].objectType, tests[0].url); err != nil {
 		t.Errorf("Failed to delete webhook. Error: %s\n", err.Error())
@@ -916,6 +944,617 @@ func testStorageWebhooks(storageType string, t *testing.T) {
 	}
 }
 
+func testStorageWebhookDeliveries(storageType string, t *testing.T) {
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	deliveries := []common.WebhookDelivery{
+		{ID: "d1", OrgID: "myorg111", ObjectType: "t1", ObjectID: "1", URL: "http://abc/xyz",
+			Payload: []byte(`{"objectID":"1"}`), Status: common.WebhookDeliveryPending, Attempts: 1},
+		{ID: "d2", OrgID: "myorg111", ObjectType: "t1", ObjectID: "2", URL: "http://abc/xyz",
+			Payload: []byte(`{"objectID":"2"}`), Signature: "abcd", Status: common.WebhookDeliveryFailed, Attempts: 10},
+		{ID: "d3", OrgID: "myorg222", ObjectType: "t1", ObjectID: "1", URL: "http://abc/xyz",
+			Payload: []byte(`{"objectID":"1"}`), Status: common.WebhookDeliveryPending},
+	}
+	for _, delivery := range deliveries {
+		if err := store.StoreWebhookDelivery(delivery); err != nil {
+			t.Errorf("Failed to store webhook delivery. Error: %s\n", err.Error())
+		}
+	}
+
+	tests := []struct {
+		orgID    string
+		status   string
+		expected int
+	}{
+		{"", "", 3},
+		{"myorg111", "", 2},
+		{"myorg111", common.WebhookDeliveryPending, 1},
+		{"myorg111", common.WebhookDeliveryFailed, 1},
+		{"", common.WebhookDeliveryPending, 2},
+		{"myorg333", "", 0},
+	}
+	for _, test := range tests {
+		if result, err := store.RetrieveWebhookDeliveries(test.orgID, test.status); err != nil {
+			t.Errorf("Failed to retrieve webhook deliveries. Error: %s\n", err.Error())
+		} else if len(result) != test.expected {
+			t.Errorf("RetrieveWebhookDeliveries(%s, %s) returned %d deliveries instead of %d\n", test.orgID, test.status,
+				len(result), test.expected)
+		}
+	}
+
+	// Update a delivery
+	deliveries[0].Status = common.WebhookDeliveryFailed
+	deliveries[0].Attempts = 10
+	deliveries[0].LastError = "Timeout"
+	if err := store.StoreWebhookDelivery(deliveries[0]); err != nil {
+		t.Errorf("Failed to store webhook delivery. Error: %s\n", err.Error())
+	}
+	if result, err := store.RetrieveWebhookDeliveries("myorg111", common.WebhookDeliveryFailed); err != nil {
+		t.Errorf("Failed to retrieve webhook deliveries. Error: %s\n", err.Error())
+	} else if len(result) != 2 {
+		t.Errorf("RetrieveWebhookDeliveries returned %d deliveries instead of 2\n", len(result))
+	} else {
+		for _, delivery := range result {
+			if delivery.ID == "d1" && (delivery.Attempts != 10 || delivery.LastError != "Timeout" ||
+				string(delivery.Payload) != string(deliveries[0].Payload)) {
+				t.Errorf("RetrieveWebhookDeliveries returned an incorrect delivery: %v\n", delivery)
+			}
+		}
+	}
+
+	for _, delivery := range deliveries {
+		if err := store.DeleteWebhookDelivery(delivery.ID); err != nil {
+			t.Errorf("Failed to delete webhook delivery. Error: %s\n", err.Error())
+		}
+	}
+	if result, err := store.RetrieveWebhookDeliveries("", ""); err != nil {
+		t.Errorf("Failed to retrieve webhook deliveries. Error: %s\n", err.Error())
+	} else if len(result) != 0 {
+		t.Errorf("RetrieveWebhookDeliveries returned %d deliveries after they were deleted\n", len(result))
+	}
+}
+
+func testStorageOrganizationsUsage(storageType string, t *testing.T) {
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	objects := []struct {
+		metaData common.MetaData
+		data     []byte
+		status   string
+	}{
+		{common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: "myorg551", ObjectSize: 3}, []byte("abc"), common.ReadyToSend},
+		{common.MetaData{ObjectID: "2", ObjectType: "type1", DestOrgID: "myorg551", ObjectSize: 5}, []byte("abcde"), common.ReadyToSend},
+		{common.MetaData{ObjectID: "3", ObjectType: "type2", DestOrgID: "myorg551"}, nil, common.NotReadyToSend},
+		{common.MetaData{ObjectID: "4", ObjectType: "type1", DestOrgID: "myorg551", ObjectSize: 4}, []byte("abcd"), common.CompletelyReceived},
+		{common.MetaData{ObjectID: "1", ObjectType: "type1", DestOrgID: "myorg552", ObjectSize: 2}, []byte("ab"), common.ReadyToSend},
+	}
+	for _, object := range objects {
+		if _, err := store.StoreObject(object.metaData, object.data, object.status); err != nil {
+			t.Errorf("Failed to store object. Error: %s\n", err.Error())
+		}
+	}
+	defer func() {
+		for _, object := range objects {
+			store.DeleteStoredObject(object.metaData.DestOrgID, object.metaData.ObjectType, object.metaData.ObjectID)
+			store.DeleteObjectVersions(object.metaData.DestOrgID, object.metaData.ObjectType, object.metaData.ObjectID)
+		}
+	}()
+
+	// The data of the versions is counted once for the versions that share it
+	for _, instanceID := range []int64{1, 2} {
+		metaData := objects[4].metaData
+		metaData.InstanceID = instanceID
+		metaData.DataID = 1
+		version := common.ObjectVersion{Version: instanceID, Timestamp: time.Now().UTC(), MetaData: metaData}
+		if err := store.StoreObjectVersion(version, 5); err != nil {
+			t.Errorf("StoreObjectVersion failed. Error: %s\n", err.Error())
+		}
+	}
+
+	tests := []struct {
+		orgID    string
+		expected []common.OrganizationUsage
+	}{
+		{"myorg551", []common.OrganizationUsage{{OrgID: "myorg551", StoredObjects: 3, StoredBytes: 8}}},
+		{"myorg552", []common.OrganizationUsage{{OrgID: "myorg552", StoredObjects: 1, StoredBytes: 4}}},
+		{"myorg553", []common.OrganizationUsage{{OrgID: "myorg553"}}},
+	}
+	for _, test := range tests {
+		if usage, err := store.RetrieveOrganizationsUsage(test.orgID); err != nil {
+			t.Errorf("Failed to retrieve the usage of %s. Error: %s\n", test.orgID, err.Error())
+		} else if fmt.Sprint(usage) != fmt.Sprint(test.expected) {
+			t.Errorf("RetrieveOrganizationsUsage(%s) returned %v instead of %v\n", test.orgID, usage, test.expected)
+		}
+	}
+
+	if usage, err := store.RetrieveOrganizationsUsage(""); err != nil {
+		t.Errorf("Failed to retrieve the usage of the organizations. Error: %s\n", err.Error())
+	} else {
+		found := 0
+		for index, org := range usage {
+			if index > 0 && usage[index-1].OrgID >= org.OrgID {
+				t.Errorf("RetrieveOrganizationsUsage returned unsorted organizations: %v\n", usage)
+			}
+			if (org.OrgID == "myorg551" && org.StoredObjects == 3) || (org.OrgID == "myorg552" && org.StoredBytes == 4) {
+				found++
+			}
+		}
+		if found != 2 {
+			t.Errorf("RetrieveOrganizationsUsage returned %v\n", usage)
+		}
+	}
+}
+
+func testStorageObjectsFilter(storageType string, t *testing.T) {
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	destinations := []common.Destination{
+		{DestOrgID: "myorg561", DestType: "dev", DestID: "dev1", Communication: common.MQTTProtocol},
+		{DestOrgID: "myorg561", DestType: "gw", DestID: "gw1", Communication: common.MQTTProtocol},
+	}
+	for _, destination := range destinations {
+		if err := store.StoreDestination(destination); err != nil {
+			t.Errorf("Failed to store destination. Error: %s\n", err.Error())
+		}
+	}
+	defer func() {
+		for _, destination := range destinations {
+			store.DeleteDestination(destination.DestOrgID, destination.DestType, destination.DestID)
+		}
+	}()
+
+	// The objects are updated in this order
+	metaDatas := []common.MetaData{
+		{ObjectID: "3", ObjectType: "filtertype", DestOrgID: "myorg561", Version: "1.0", DestType: "dev"},
+		{ObjectID: "1", ObjectType: "filtertype", DestOrgID: "myorg561", Version: "2.0", Inactive: true,
+			DestinationsList: []string{"dev:dev1", "gw:gw1"}},
+		{ObjectID: "4", ObjectType: "filtertype", DestOrgID: "myorg561", Version: "1.0", DestType: "gw"},
+		{ObjectID: "2", ObjectType: "filtertype", DestOrgID: "myorg561", Version: "1.0", Deleted: true},
+		{ObjectID: "5", ObjectType: "filtertype", DestOrgID: "myorg561", Version: "2.0", DestType: "dev"},
+	}
+	for _, metaData := range metaDatas {
+		if _, err := store.StoreObject(metaData, nil, common.NotReadyToSend); err != nil {
+			t.Errorf("Failed to store object. Error: %s\n", err.Error())
+		}
+	}
+	defer func() {
+		for _, metaData := range metaDatas {
+			store.DeleteStoredObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+		}
+	}()
+
+	// The objects updated after the third object
+	updatedSince := int64(0)
+	if metaData, err := store.RetrieveObject("myorg561", "filtertype", "4"); err != nil || metaData == nil {
+		t.Errorf("Failed to retrieve object. Error: %v\n", err)
+	} else {
+		updatedSince = metaData.InstanceID
+	}
+
+	trueValue := true
+	falseValue := false
+	tests := []struct {
+		filter   common.ObjectsFilter
+		expected string
+	}{
+		{common.ObjectsFilter{}, "1 2 3 4 5"},
+		{common.ObjectsFilter{Version: "1.0"}, "2 3 4"},
+		{common.ObjectsFilter{Inactive: &trueValue}, "1"},
+		{common.ObjectsFilter{Deleted: &falseValue}, "1 3 4 5"},
+		{common.ObjectsFilter{UpdatedSince: updatedSince}, "2 5"},
+		{common.ObjectsFilter{DestinationType: "dev"}, "1 3 5"},
+		{common.ObjectsFilter{DestinationType: "gw", Version: "2.0"}, "1"},
+		{common.ObjectsFilter{Limit: 2}, "1 2"},
+		{common.ObjectsFilter{AfterObjectType: "filtertype", AfterObjectID: "2", Limit: 2}, "3 4"},
+		{common.ObjectsFilter{AfterObjectType: "filtertype", AfterObjectID: "4", Limit: 2}, "5"},
+		{common.ObjectsFilter{AfterObjectType: "filtertype", AfterObjectID: "1", Version: "1.0", Limit: 1}, "2"},
+		{common.ObjectsFilter{Version: "3.0"}, ""},
+	}
+	for index, test := range tests {
+		objects, err := store.RetrieveAllObjects("myorg561", "filtertype", test.filter)
+		if err != nil {
+			t.Errorf("Failed to retrieve the objects (test %d). Error: %s\n", index, err.Error())
+			continue
+		}
+		ids := make([]string, 0)
+		for _, object := range objects {
+			ids = append(ids, object.ObjectID)
+		}
+		if test.filter.Limit == 0 {
+			// Without a page the objects aren't necessarily sorted
+			sort.Strings(ids)
+		}
+		if strings.Join(ids, " ") != test.expected {
+			t.Errorf("RetrieveAllObjects returned %v instead of %s (test %d)\n", ids, test.expected, index)
+		}
+	}
+}
+
+func testStorageObjectLabels(storageType string, t *testing.T) {
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	metaDatas := []common.MetaData{
+		{ObjectID: "1", ObjectType: "labeltype", DestOrgID: "myorg571", Labels: map[string]string{"env": "prod", "tier": "web"}},
+		{ObjectID: "2", ObjectType: "labeltype", DestOrgID: "myorg571", Labels: map[string]string{"env": "prod", "tier": "canary"}},
+		{ObjectID: "3", ObjectType: "labeltype", DestOrgID: "myorg571", Labels: map[string]string{"env": "dev"}},
+		{ObjectID: "4", ObjectType: "labeltype", DestOrgID: "myorg571"},
+		{ObjectID: "1", ObjectType: "otherlabeltype", DestOrgID: "myorg572", Labels: map[string]string{"env": "prod"}},
+	}
+	for _, metaData := range metaDatas {
+		if _, err := store.StoreObject(metaData, nil, common.NotReadyToSend); err != nil {
+			t.Errorf("Failed to store object. Error: %s\n", err.Error())
+		}
+	}
+	defer func() {
+		for _, metaData := range metaDatas {
+			store.DeleteStoredObject(metaData.DestOrgID, metaData.ObjectType, metaData.ObjectID)
+		}
+	}()
+
+	checkSelector := func(selector string, expected string) {
+		labelSelector, err := common.ParseLabelSelector(selector)
+		if err != nil {
+			t.Errorf("Failed to parse the selector %s. Error: %s\n", selector, err.Error())
+			return
+		}
+		objects, err := store.RetrieveAllObjects("myorg571", "labeltype", common.ObjectsFilter{Labels: labelSelector, Limit: 10})
+		if err != nil {
+			t.Errorf("Failed to retrieve the objects (selector %s). Error: %s\n", selector, err.Error())
+			return
+		}
+		ids := make([]string, 0)
+		for _, object := range objects {
+			ids = append(ids, object.ObjectID)
+		}
+		if strings.Join(ids, " ") != expected {
+			t.Errorf("RetrieveAllObjects returned %v instead of %s (selector %s)\n", ids, expected, selector)
+		}
+	}
+
+	checkSelector("env=prod", "1 2")
+	checkSelector("env=prod,tier!=canary", "1")
+	checkSelector("tier!=canary", "1 3 4")
+	checkSelector("tier", "1 2")
+	checkSelector("!env", "4")
+	checkSelector("env=qa", "")
+
+	// Changing and removing the labels of objects updates the selected objects
+	metaData := metaDatas[1]
+	metaData.Labels = map[string]string{"env": "qa"}
+	if _, err := store.StoreObject(metaData, nil, common.NotReadyToSend); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+	}
+	metaData = metaDatas[0]
+	metaData.Labels = nil
+	if _, err := store.StoreObject(metaData, nil, common.NotReadyToSend); err != nil {
+		t.Errorf("Failed to store object. Error: %s\n", err.Error())
+	}
+	checkSelector("env=prod", "")
+	checkSelector("env=qa", "2")
+	checkSelector("!env", "1 4")
+
+	if err := store.DeleteStoredObject("myorg571", "labeltype", "2"); err != nil {
+		t.Errorf("Failed to delete object. Error: %s\n", err.Error())
+	}
+	checkSelector("env=qa", "")
+
+	if storedMetaData, err := store.RetrieveObject("myorg571", "labeltype", "3"); err != nil || storedMetaData == nil {
+		t.Errorf("Failed to retrieve object. Error: %v\n", err)
+	} else if len(storedMetaData.Labels) != 1 || storedMetaData.Labels["env"] != "dev" {
+		t.Errorf("The retrieved labels %v don't match the stored labels\n", storedMetaData.Labels)
+	}
+}
+
+func testStorageAuditLog(storageType string, t *testing.T) {
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	baseTime := time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC)
+	// Remove the entries of previous runs
+	if err := store.DeleteAuditEntries(baseTime.Add(time.Hour)); err != nil {
+		t.Errorf("Failed to delete audit log entries. Error: %s\n", err.Error())
+	}
+
+	entries := []common.AuditEntry{
+		{ID: "a3", Timestamp: baseTime.Add(3 * time.Minute), Identity: "admin1", UserOrgID: "myorg111", OrgID: "myorg111",
+			Operation: "deleteObject", Target: "t1/1", Code: http.StatusNoContent},
+		{ID: "a1", Timestamp: baseTime.Add(time.Minute), Identity: "user1", UserOrgID: "myorg111", OrgID: "myorg111",
+			Operation: "updateObject", Target: "t1/1", Code: http.StatusNoContent},
+		{ID: "a2", Timestamp: baseTime.Add(2 * time.Minute), Identity: "admin2", UserOrgID: "myorg222", OrgID: "myorg222",
+			Operation: "updateACL", Target: "destinations/t1", Code: http.StatusForbidden},
+		{ID: "a4", Timestamp: baseTime.Add(4 * time.Minute), Identity: "syncadmin", OrgID: "myorg222",
+			Operation: "deleteOrganization", Code: http.StatusNoContent},
+	}
+	for _, entry := range entries {
+		if err := store.StoreAuditEntry(entry); err != nil {
+			t.Errorf("Failed to store audit log entry. Error: %s\n", err.Error())
+		}
+	}
+
+	tests := []struct {
+		orgID    string
+		from     time.Time
+		to       time.Time
+		expected []string
+	}{
+		{"", time.Time{}, time.Time{}, []string{"a1", "a2", "a3", "a4"}},
+		{"myorg111", time.Time{}, time.Time{}, []string{"a1", "a3"}},
+		{"myorg222", time.Time{}, time.Time{}, []string{"a2", "a4"}},
+		{"", baseTime.Add(2 * time.Minute), time.Time{}, []string{"a2", "a3", "a4"}},
+		{"", time.Time{}, baseTime.Add(3 * time.Minute), []string{"a1", "a2"}},
+		{"myorg111", baseTime.Add(90 * time.Second), baseTime.Add(5 * time.Minute), []string{"a3"}},
+		{"myorg333", time.Time{}, time.Time{}, []string{}},
+	}
+	for _, test := range tests {
+		result, err := store.RetrieveAuditEntries(test.orgID, test.from, test.to)
+		if err != nil {
+			t.Errorf("Failed to retrieve audit log entries. Error: %s\n", err.Error())
+			continue
+		}
+		ids := make([]string, 0)
+		for _, entry := range result {
+			ids = append(ids, entry.ID)
+		}
+		if strings.Join(ids, ",") != strings.Join(test.expected, ",") {
+			t.Errorf("RetrieveAuditEntries(%s, %s, %s) returned %v instead of %v\n", test.orgID, test.from, test.to,
+				ids, test.expected)
+		}
+	}
+
+	if result, err := store.RetrieveAuditEntries("myorg222", baseTime.Add(2*time.Minute), baseTime.Add(3*time.Minute)); err != nil {
+		t.Errorf("Failed to retrieve audit log entries. Error: %s\n", err.Error())
+	} else if len(result) != 1 || result[0].Identity != "admin2" || result[0].UserOrgID != "myorg222" ||
+		result[0].Operation != "updateACL" || result[0].Target != "destinations/t1" || result[0].Code != http.StatusForbidden ||
+		!result[0].Timestamp.Equal(entries[2].Timestamp) {
+		t.Errorf("RetrieveAuditEntries returned an incorrect entry: %v\n", result)
+	}
+
+	if err := store.DeleteAuditEntries(baseTime.Add(3 * time.Minute)); err != nil {
+		t.Errorf("Failed to delete audit log entries. Error: %s\n", err.Error())
+	}
+	if result, err := store.RetrieveAuditEntries("", time.Time{}, time.Time{}); err != nil {
+		t.Errorf("Failed to retrieve audit log entries. Error: %s\n", err.Error())
+	} else if len(result) != 2 || result[0].ID != "a3" || result[1].ID != "a4" {
+		t.Errorf("RetrieveAuditEntries returned %d entries after the old entries were deleted\n", len(result))
+	}
+
+	if err := store.DeleteAuditEntries(baseTime.Add(time.Hour)); err != nil {
+		t.Errorf("Failed to delete audit log entries. Error: %s\n", err.Error())
+	}
+}
+
+func testStorageRollouts(storageType string, t *testing.T) {
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	rollouts := []common.RolloutStatus{
+		{OrgID: "myorg771", ObjectType: "type1", ObjectID: "r1", InstanceID: 3, Status: common.RolloutInProgress, Wave: 1,
+			WaveStartTime: time.Now().UTC().Truncate(time.Second),
+			Destinations:  []common.RolloutDestination{{DestType: "device", DestID: "dev1", Wave: 1}}},
+		{OrgID: "myorg771", ObjectType: "type1", ObjectID: "r2", InstanceID: 4, Status: common.RolloutPaused, Wave: 2,
+			Message: "paused", Destinations: []common.RolloutDestination{{DestType: "device", DestID: "dev1", Wave: 1},
+				{DestType: "device", DestID: "dev2", Wave: 2}}},
+		{OrgID: "myorg772", ObjectType: "type1", ObjectID: "r3", InstanceID: 5, Status: common.RolloutInProgress, Wave: 1},
+	}
+
+	// Remove the rollouts of previous runs
+	for _, rollout := range rollouts {
+		if err := store.DeleteRollout(rollout.OrgID, rollout.ObjectType, rollout.ObjectID); err != nil {
+			t.Errorf("DeleteRollout failed. Error: %s\n", err.Error())
+		}
+	}
+
+	for _, rollout := range rollouts {
+		if err := store.StoreRollout(rollout); err != nil {
+			t.Errorf("StoreRollout failed. Error: %s\n", err.Error())
+		}
+	}
+
+	for _, rollout := range rollouts {
+		stored, err := store.RetrieveRollout(rollout.OrgID, rollout.ObjectType, rollout.ObjectID)
+		if err != nil {
+			t.Errorf("RetrieveRollout failed. Error: %s\n", err.Error())
+		} else if stored == nil {
+			t.Errorf("RetrieveRollout didn't find the rollout of %s\n", rollout.ObjectID)
+		} else if stored.InstanceID != rollout.InstanceID || stored.Status != rollout.Status || stored.Wave != rollout.Wave ||
+			stored.Message != rollout.Message || len(stored.Destinations) != len(rollout.Destinations) ||
+			!stored.WaveStartTime.Equal(rollout.WaveStartTime) {
+			t.Errorf("RetrieveRollout returned an incorrect rollout: %v instead of %v\n", *stored, rollout)
+		}
+	}
+
+	if stored, err := store.RetrieveRollout("myorg771", "type1", "r4"); err != nil {
+		t.Errorf("RetrieveRollout failed. Error: %s\n", err.Error())
+	} else if stored != nil {
+		t.Errorf("RetrieveRollout returned a rollout of an object without a rollout\n")
+	}
+
+	if result, err := store.RetrieveRollouts(common.RolloutInProgress); err != nil {
+		t.Errorf("RetrieveRollouts failed. Error: %s\n", err.Error())
+	} else if len(result) != 2 {
+		t.Errorf("RetrieveRollouts returned %d rollouts instead of 2\n", len(result))
+	}
+
+	// Update
+	rollouts[0].Wave = 2
+	rollouts[0].Status = common.RolloutCompleted
+	rollouts[0].Destinations = append(rollouts[0].Destinations, common.RolloutDestination{DestType: "device", DestID: "dev2", Wave: 2})
+	if err := store.StoreRollout(rollouts[0]); err != nil {
+		t.Errorf("StoreRollout failed. Error: %s\n", err.Error())
+	}
+	if stored, err := store.RetrieveRollout("myorg771", "type1", "r1"); err != nil {
+		t.Errorf("RetrieveRollout failed. Error: %s\n", err.Error())
+	} else if stored == nil || stored.Wave != 2 || stored.Status != common.RolloutCompleted || len(stored.Destinations) != 2 {
+		t.Errorf("RetrieveRollout returned an incorrect rollout after the update: %v\n", stored)
+	}
+	if result, err := store.RetrieveRollouts(common.RolloutInProgress); err != nil {
+		t.Errorf("RetrieveRollouts failed. Error: %s\n", err.Error())
+	} else if len(result) != 1 || result[0].ObjectID != "r3" {
+		t.Errorf("RetrieveRollouts returned incorrect rollouts: %v\n", result)
+	}
+
+	// Delete
+	for _, rollout := range rollouts {
+		if err := store.DeleteRollout(rollout.OrgID, rollout.ObjectType, rollout.ObjectID); err != nil {
+			t.Errorf("DeleteRollout failed. Error: %s\n", err.Error())
+		}
+		if stored, err := store.RetrieveRollout(rollout.OrgID, rollout.ObjectType, rollout.ObjectID); err != nil {
+			t.Errorf("RetrieveRollout failed. Error: %s\n", err.Error())
+		} else if stored != nil {
+			t.Errorf("The rollout of %s wasn't deleted\n", rollout.ObjectID)
+		}
+	}
+}
+
+func testStorageObjectVersions(storageType string, t *testing.T) {
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	// Remove the versions of previous runs
+	if err := store.DeleteObjectVersions("myorg773", "type1", "v1"); err != nil {
+		t.Errorf("DeleteObjectVersions failed. Error: %s\n", err.Error())
+	}
+	if err := store.DeleteStoredObject("myorg773", "type1", "v1"); err != nil {
+		t.Errorf("DeleteStoredObject failed. Error: %s\n", err.Error())
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	versions := []struct {
+		version common.ObjectVersion
+		data    []byte
+	}{
+		{common.ObjectVersion{Version: 1, Timestamp: now.Add(-4 * time.Minute), MetaData: common.MetaData{DestOrgID: "myorg773",
+			ObjectType: "type1", ObjectID: "v1", Version: "1.0.0", InstanceID: 1, DataID: 1}}, []byte("version1")},
+		{common.ObjectVersion{Version: 2, Timestamp: now.Add(-3 * time.Minute), MetaData: common.MetaData{DestOrgID: "myorg773",
+			ObjectType: "type1", ObjectID: "v1", Version: "1.0.1", InstanceID: 2, NoData: true}}, nil},
+		{common.ObjectVersion{Version: 3, Timestamp: now.Add(-2 * time.Minute), MetaData: common.MetaData{DestOrgID: "myorg773",
+			ObjectType: "type1", ObjectID: "v1", Version: "1.0.2", InstanceID: 3, DataID: 3}}, []byte("version3")},
+		// A meta data only update keeps the data of the previous version, which is shared by the versions
+		{common.ObjectVersion{Version: 4, Timestamp: now.Add(-1 * time.Minute), MetaData: common.MetaData{DestOrgID: "myorg773",
+			ObjectType: "type1", ObjectID: "v1", Version: "1.0.3", InstanceID: 4, DataID: 3}}, []byte("not copied")},
+	}
+
+	// The storage copies the current data of the object to the version
+	for _, version := range versions {
+		if _, err := store.StoreObject(version.version.MetaData, version.data, common.ReadyToSend); err != nil {
+			t.Errorf("StoreObject failed. Error: %s\n", err.Error())
+		}
+		if err := store.StoreObjectVersion(version.version, 3); err != nil {
+			t.Errorf("StoreObjectVersion failed. Error: %s\n", err.Error())
+		}
+	}
+
+	// Only the three newest versions are kept
+	stored, err := store.RetrieveObjectVersions("myorg773", "type1", "v1")
+	if err != nil {
+		t.Errorf("RetrieveObjectVersions failed. Error: %s\n", err.Error())
+	} else if len(stored) != 3 {
+		t.Errorf("RetrieveObjectVersions returned %d versions instead of 3\n", len(stored))
+	} else {
+		for index, expected := range []common.ObjectVersion{versions[3].version, versions[2].version, versions[1].version} {
+			if stored[index].Version != expected.Version || !stored[index].Timestamp.Equal(expected.Timestamp) ||
+				stored[index].MetaData.Version != expected.MetaData.Version {
+				t.Errorf("RetrieveObjectVersions returned an incorrect version: %v instead of %v\n", stored[index], expected)
+			}
+		}
+	}
+
+	for _, version := range []int64{3, 4} {
+		if data, err := store.RetrieveObjectVersionData("myorg773", "type1", "v1", version); err != nil {
+			t.Errorf("RetrieveObjectVersionData failed. Error: %s\n", err.Error())
+		} else if string(data) != "version3" {
+			t.Errorf("RetrieveObjectVersionData returned incorrect data of version %d: %s instead of version3\n", version, string(data))
+		}
+	}
+	if data, err := store.RetrieveObjectVersionData("myorg773", "type1", "v1", 2); err != nil {
+		t.Errorf("RetrieveObjectVersionData failed. Error: %s\n", err.Error())
+	} else if data != nil {
+		t.Errorf("RetrieveObjectVersionData returned data of a version without data\n")
+	}
+	if data, err := store.RetrieveObjectVersionData("myorg773", "type1", "v1", 1); err != nil {
+		t.Errorf("RetrieveObjectVersionData failed. Error: %s\n", err.Error())
+	} else if data != nil {
+		t.Errorf("RetrieveObjectVersionData returned data of a removed version\n")
+	}
+
+	// Removing a version keeps the data it shares with a newer version
+	version := common.ObjectVersion{Version: 5, Timestamp: now, MetaData: common.MetaData{DestOrgID: "myorg773",
+		ObjectType: "type1", ObjectID: "v1", Version: "1.0.4", InstanceID: 5, DataID: 5}}
+	if _, err := store.StoreObject(version.MetaData, []byte("version5"), common.ReadyToSend); err != nil {
+		t.Errorf("StoreObject failed. Error: %s\n", err.Error())
+	}
+	if err := store.StoreObjectVersion(version, 2); err != nil {
+		t.Errorf("StoreObjectVersion failed. Error: %s\n", err.Error())
+	}
+	if data, err := store.RetrieveObjectVersionData("myorg773", "type1", "v1", 3); err != nil || data != nil {
+		t.Errorf("RetrieveObjectVersionData returned data of a removed version. Error: %v\n", err)
+	}
+	if data, err := store.RetrieveObjectVersionData("myorg773", "type1", "v1", 4); err != nil {
+		t.Errorf("RetrieveObjectVersionData failed. Error: %s\n", err.Error())
+	} else if string(data) != "version3" {
+		t.Errorf("RetrieveObjectVersionData returned incorrect data: %s instead of version3\n", string(data))
+	}
+	if data, err := store.RetrieveObjectVersionData("myorg773", "type1", "v1", 5); err != nil {
+		t.Errorf("RetrieveObjectVersionData failed. Error: %s\n", err.Error())
+	} else if string(data) != "version5" {
+		t.Errorf("RetrieveObjectVersionData returned incorrect data: %s instead of version5\n", string(data))
+	}
+
+	if stored, err := store.RetrieveObjectVersions("myorg773", "type1", "v2"); err != nil {
+		t.Errorf("RetrieveObjectVersions failed. Error: %s\n", err.Error())
+	} else if len(stored) != 0 {
+		t.Errorf("RetrieveObjectVersions returned versions of an object without versions\n")
+	}
+
+	// Delete
+	if err := store.DeleteObjectVersions("myorg773", "type1", "v1"); err != nil {
+		t.Errorf("DeleteObjectVersions failed. Error: %s\n", err.Error())
+	}
+	if stored, err := store.RetrieveObjectVersions("myorg773", "type1", "v1"); err != nil {
+		t.Errorf("RetrieveObjectVersions failed. Error: %s\n", err.Error())
+	} else if len(stored) != 0 {
+		t.Errorf("The versions weren't deleted\n")
+	}
+	if data, err := store.RetrieveObjectVersionData("myorg773", "type1", "v1", 4); err != nil {
+		t.Errorf("RetrieveObjectVersionData failed. Error: %s\n", err.Error())
+	} else if data != nil {
+		t.Errorf("The data of a version wasn't deleted\n")
+	}
+	store.DeleteStoredObject("myorg773", "type1", "v1")
+}
+
 func testStorageObjectExpiration(storageType string, t *testing.T) {
 	common.Configuration.NodeType = common.CSS
 	store, err := setUpStorage(storageType)
@@ -1062,7 +1701,7 @@ func testStorageOrgDeleteObjects(storageType string, t *testing.T) {
 		}
 	}
 
-	objects, err := store.RetrieveUpdatedObjects(tests[0].metaData.DestOrgID, tests[0].metaData.ObjectType, false)
+	objects, err := store.RetrieveUpdatedObjects(tests[0].metaData.DestOrgID, tests[0].metaData.ObjectType, false, common.ObjectsFilter{})
 	if err != nil {
 		t.Errorf("RetrieveUpdatedObjects failed. Error: %s\n", err.Error())
 	} else if len(objects) != 1 {
@@ -1071,7 +1710,7 @@ func testStorageOrgDeleteObjects(storageType string, t *testing.T) {
 		t.Errorf("RetrieveUpdatedObjects returned wrong object: %s instead of object ID = 2\n", objects[0].ObjectID)
 	}
 
-	objects, err = store.RetrieveUpdatedObjects(tests[0].metaData.DestOrgID, tests[0].metaData.ObjectType, true)
+	objects, err = store.RetrieveUpdatedObjects(tests[0].metaData.DestOrgID, tests[0].metaData.ObjectType, true, common.ObjectsFilter{})
 	if err != nil {
 		t.Errorf("RetrieveUpdatedObjects failed. Error: %s\n", err.Error())
 	} else if len(objects) != 2 {
@@ -1089,7 +1728,7 @@ func testStorageOrgDeleteObjects(storageType string, t *testing.T) {
 	if err := store.DeleteOrganization(tests[0].metaData.DestOrgID); err != nil {
 		t.Errorf("DeleteOrganization failed. Error: %s\n", err.Error())
 	}
-	objects, err = store.RetrieveUpdatedObjects(tests[0].metaData.DestOrgID, tests[0].metaData.ObjectType, true)
+	objects, err = store.RetrieveUpdatedObjects(tests[0].metaData.DestOrgID, tests[0].metaData.ObjectType, true, common.ObjectsFilter{})
 	if err != nil {
 		t.Errorf("RetrieveUpdatedObjects failed. Error: %s\n", err.Error())
 	} else if len(objects) != 0 {
@@ -1101,7 +1740,7 @@ func testStorageOrgDeleteObjects(storageType string, t *testing.T) {
 	} else if len(objects) != 0 {
 		t.Errorf("RetrieveObjects returned objects after the organization has been deleted\n")
 	}
-	objects, err = store.RetrieveUpdatedObjects(tests[3].metaData.DestOrgID, tests[3].metaData.ObjectType, false)
+	objects, err = store.RetrieveUpdatedObjects(tests[3].metaData.DestOrgID, tests[3].metaData.ObjectType, false, common.ObjectsFilter{})
 	if err != nil {
 		t.Errorf("RetrieveUpdatedObjects failed. Error: %s\n", err.Error())
 	} else if len(objects) != 1 {
@@ -1109,7 +1748,7 @@ func testStorageOrgDeleteObjects(storageType string, t *testing.T) {
 	} else if objects[0].ObjectID != "4" {
 		t.Errorf("RetrieveUpdatedObjects returned wrong object: %s instead of object ID = 4\n", objects[0].ObjectID)
 	}
-	objects, err = store.RetrieveUpdatedObjects(tests[3].metaData.DestOrgID, tests[3].metaData.ObjectType, true)
+	objects, err = store.RetrieveUpdatedObjects(tests[3].metaData.DestOrgID, tests[3].metaData.ObjectType, true, common.ObjectsFilter{})
 	if err != nil {
 		t.Errorf("RetrieveUpdatedObjects failed. Error: %s\n", err.Error())
 	} else if len(objects) != 1 {
@@ -1307,7 +1946,7 @@ func testStorageObjectDestinations(storageType string, t *testing.T) {
 			if len(deletedDests) != test.numberOfDeletedDests {
 				t.Errorf("StoreObject returned wrong number of deleted destinations: %d instead of %d (objectID = %s).\n",
 					len(deletedDests), test.numberOfDeletedDests, test.metaData.ObjectID)
-			} else if len(deletedDests) == 1 && deletedDests[0].Destination != *test.deletedDest {
+			} else if len(deletedDests) == 1 && !reflect.DeepEqual(deletedDests[0].Destination, *test.deletedDest) {
 				t.Errorf("StoreObject returned wrong deleted destination (objectID = %s).\n", test.metaData.ObjectID)
 			}
 		}
@@ -1319,7 +1958,7 @@ func testStorageObjectDestinations(storageType string, t *testing.T) {
 				if len(dests) != 1 {
 					t.Errorf("GetObjectDestinations returned wrong number of destinations: %d instead of 1 (objectID = %s).\n",
 						len(dests), test.metaData.ObjectID)
-				} else if dests[0] != dest1 {
+				} else if !reflect.DeepEqual(dests[0], dest1) {
 					t.Errorf("GetObjectDestinations returned wrong destination (objectID = %s).\n",
 						test.metaData.ObjectID)
 				}
@@ -1328,7 +1967,7 @@ func testStorageObjectDestinations(storageType string, t *testing.T) {
 					t.Errorf("GetObjectDestinations returned wrong number of destinations: %d instead of 2 (objectID = %s).\n",
 						len(dests), test.metaData.ObjectID)
 				} else {
-					if (dests[0] != dest2 && dests[0] != dest1) || (dests[1] != dest1 && dests[1] != dest2) {
+					if (!reflect.DeepEqual(dests[0], dest2) && !reflect.DeepEqual(dests[0], dest1)) || (!reflect.DeepEqual(dests[1], dest1) && !reflect.DeepEqual(dests[1], dest2)) {
 						t.Errorf("GetObjectDestinations returned wrong destination (objectID = %s).\n",
 							test.metaData.ObjectID)
 					}
@@ -1344,7 +1983,7 @@ func testStorageObjectDestinations(storageType string, t *testing.T) {
 				if len(dests) != 1 {
 					t.Errorf("GetObjectDestinationsList returned wrong number of destinations: %d instead of 1 (objectID = %s).\n",
 						len(dests), test.metaData.ObjectID)
-				} else if dests[0].Destination != dest1 {
+				} else if !reflect.DeepEqual(dests[0].Destination, dest1) {
 					t.Errorf("GetObjectDestinations returned wrong destination (objectID = %s).\n",
 						test.metaData.ObjectID)
 				} else if dests[0].Status != common.Pending {
@@ -1359,7 +1998,7 @@ func testStorageObjectDestinations(storageType string, t *testing.T) {
 					t.Errorf("GetObjectDestinationsList returned wrong number of destinations: %d instead of 2 (objectID = %s).\n",
 						len(dests), test.metaData.ObjectID)
 				} else {
-					if (dests[0].Destination != dest2 && dests[0].Destination != dest1) || (dests[1].Destination != dest1 && dests[1].Destination != dest2) {
+					if (!reflect.DeepEqual(dests[0].Destination, dest2) && !reflect.DeepEqual(dests[0].Destination, dest1)) || (!reflect.DeepEqual(dests[1].Destination, dest1) && !reflect.DeepEqual(dests[1].Destination, dest2)) {
 						t.Errorf("GetObjectDestinationsList returned wrong destination (objectID = %s).\n",
 							test.metaData.ObjectID)
 					} else {
@@ -1412,7 +2051,7 @@ func testStorageObjectDestinations(storageType string, t *testing.T) {
 				t.Errorf("GetObjectDestinationsList returned no destinations (objectID = %s).\n", test.metaData.ObjectID)
 			}
 			for _, d := range dests {
-				if d.Status != common.Delivered && d.Destination != dest2 {
+				if d.Status != common.Delivered && !reflect.DeepEqual(d.Destination, dest2) {
 					t.Errorf("GetObjectDestinations returned wrong status: %s instead of Delivered (objectID = %s).\n", d.Status,
 						test.metaData.ObjectID)
 				}
@@ -1430,7 +2069,7 @@ func testStorageObjectDestinations(storageType string, t *testing.T) {
 				t.Errorf("GetObjectDestinationsList returned no destinations (objectID = %s).\n", test.metaData.ObjectID)
 			}
 			for _, d := range dests {
-				if (d.Status != common.Error || d.Message != "Error") && d.Destination != dest2 {
+				if (d.Status != common.Error || d.Message != "Error") && !reflect.DeepEqual(d.Destination, dest2) {
 					t.Errorf("GetObjectDestinations returned wrong status or message: (%s, %s) instead of (error, Error) (objectID = %s).\n", d.Status,
 						d.Message, test.metaData.ObjectID)
 				}
@@ -1581,6 +2220,120 @@ func testStorageInactiveDestinations(storageType string, t *testing.T) {
 
 }
 
+func testStorageDestinationGroups(storageType string, t *testing.T) {
+	common.Configuration.NodeType = common.CSS
+	store, err := setUpStorage(storageType)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer store.Stop()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	groups := []common.DestinationGroup{
+		{OrgID: "myorg774", Name: "group1", Destinations: []string{"device:dev1", "device:dev2"}, LastUpdate: now},
+		{OrgID: "myorg774", Name: "group2", Destinations: []string{"device:dev3"}, LastUpdate: now},
+		{OrgID: "myorg775", Name: "group1", Destinations: []string{}, LastUpdate: now},
+	}
+
+	// Remove the groups of previous runs
+	for _, group := range groups {
+		if err := store.DeleteDestinationGroup(group.OrgID, group.Name); err != nil {
+			t.Errorf("DeleteDestinationGroup failed. Error: %s\n", err.Error())
+		}
+	}
+
+	for _, group := range groups {
+		if err := store.StoreDestinationGroup(group); err != nil {
+			t.Errorf("StoreDestinationGroup failed. Error: %s\n", err.Error())
+		}
+	}
+
+	for _, group := range groups {
+		stored, err := store.RetrieveDestinationGroup(group.OrgID, group.Name)
+		if err != nil {
+			t.Errorf("RetrieveDestinationGroup failed. Error: %s\n", err.Error())
+		} else if stored == nil {
+			t.Errorf("RetrieveDestinationGroup didn't find the group %s:%s\n", group.OrgID, group.Name)
+		} else if stored.OrgID != group.OrgID || stored.Name != group.Name || len(stored.Destinations) != len(group.Destinations) ||
+			!stored.LastUpdate.Equal(group.LastUpdate) {
+			t.Errorf("RetrieveDestinationGroup returned an incorrect group: %v instead of %v\n", *stored, group)
+		}
+	}
+
+	if stored, err := store.RetrieveDestinationGroup("myorg774", "group3"); err != nil {
+		t.Errorf("RetrieveDestinationGroup failed. Error: %s\n", err.Error())
+	} else if stored != nil {
+		t.Errorf("RetrieveDestinationGroup returned a group that doesn't exist\n")
+	}
+
+	if result, err := store.RetrieveDestinationGroups("myorg774"); err != nil {
+		t.Errorf("RetrieveDestinationGroups failed. Error: %s\n", err.Error())
+	} else if len(result) != 2 {
+		t.Errorf("RetrieveDestinationGroups returned %d groups instead of 2\n", len(result))
+	}
+
+	if storageType != common.InMemory {
+		// Objects target the registered destinations of a group
+		for _, destID := range []string{"dev1", "dev3"} {
+			dest := common.Destination{DestOrgID: "myorg774", DestType: "device", DestID: destID, Communication: common.MQTTProtocol}
+			if err := store.StoreDestination(dest); err != nil {
+				t.Errorf("StoreDestination failed. Error: %s\n", err.Error())
+			}
+		}
+		tests := []struct {
+			metaData     common.MetaData
+			destinations int
+		}{
+			{common.MetaData{ObjectID: "g1", ObjectType: "type1", DestOrgID: "myorg774",
+				DestinationsList: []string{"group:group1"}}, 1},
+			{common.MetaData{ObjectID: "g2", ObjectType: "type1", DestOrgID: "myorg774",
+				DestinationsList: []string{"device:dev1", "group:group1", "group:group2"}}, 2},
+		}
+		for _, test := range tests {
+			if err := store.DeleteStoredObject(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID); err != nil {
+				t.Errorf("Failed to delete object (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
+			}
+			if _, err := store.StoreObject(test.metaData, nil, common.ReadyToSend); err != nil {
+				t.Errorf("Failed to store object (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
+			} else if dests, err := store.GetObjectDestinations(test.metaData); err != nil {
+				t.Errorf("GetObjectDestinations failed (objectID = %s). Error: %s\n", test.metaData.ObjectID, err.Error())
+			} else if len(dests) != test.destinations {
+				t.Errorf("Object %s has %d destinations instead of %d\n", test.metaData.ObjectID, len(dests), test.destinations)
+			}
+		}
+
+		if objects, err := store.RetrieveObjectsWithDestinationGroup("myorg774", "group1"); err != nil {
+			t.Errorf("RetrieveObjectsWithDestinationGroup failed. Error: %s\n", err.Error())
+		} else if len(objects) != 2 {
+			t.Errorf("RetrieveObjectsWithDestinationGroup returned %d objects instead of 2\n", len(objects))
+		}
+		if objects, err := store.RetrieveObjectsWithDestinationGroup("myorg774", "group2"); err != nil {
+			t.Errorf("RetrieveObjectsWithDestinationGroup failed. Error: %s\n", err.Error())
+		} else if len(objects) != 1 || objects[0].ObjectID != "g2" {
+			t.Errorf("RetrieveObjectsWithDestinationGroup returned incorrect objects: %v\n", objects)
+		}
+
+		metaData := common.MetaData{ObjectID: "g3", ObjectType: "type1", DestOrgID: "myorg774", DestinationsList: []string{"group:group3"}}
+		if _, err := store.StoreObject(metaData, nil, common.ReadyToSend); err == nil {
+			t.Errorf("StoreObject accepted an object that targets a destination group that doesn't exist\n")
+		} else if !common.IsInvalidRequest(err) {
+			t.Errorf("StoreObject returned an error that isn't an InvalidRequest for a destination group that doesn't exist\n")
+		}
+
+		for _, test := range tests {
+			store.DeleteStoredObject(test.metaData.DestOrgID, test.metaData.ObjectType, test.metaData.ObjectID)
+		}
+	}
+
+	if err := store.DeleteDestinationGroup("myorg774", "group2"); err != nil {
+		t.Errorf("DeleteDestinationGroup failed. Error: %s\n", err.Error())
+	}
+	if stored, err := store.RetrieveDestinationGroup("myorg774", "group2"); err != nil || stored != nil {
+		t.Errorf("RetrieveDestinationGroup returned a deleted group. Error: %v\n", err)
+	}
+}
+
 func setUpStorage(storageType string) (Storage, error) {
 	var store Storage
 	switch storageType {
@@ -1591,11 +2344,14 @@ func setUpStorage(storageType string) (Storage, error) {
 		common.Configuration.PersistenceRootPath = dir + "/persist"
 		path := common.Configuration.PersistenceRootPath + "/sync/db/"
 		os.RemoveAll(path)
-		boltStore := &BoltStorage{}
+		boltStore := &BoltStorage{DataStore: testDataStore}
 		store = &Cache{Store: boltStore}
 	case common.Mongo:
 		common.Configuration.MongoDbName = "d_test_db"
-		store = &Cache{Store: &MongoStorage{}}
+		store = &Cache{Store: &MongoStorage{DataStore: testDataStore}}
+	case common.Postgres:
+		common.Configuration.PostgresDbName = "d_test_db"
+		store = &Cache{Store: &PostgresStorage{DataStore: testDataStore}}
 	}
 	if err := store.Init(); err != nil {
 		return nil, &Error{fmt.Sprintf("Failed to initialize storage driver. Error: %s\n", err.Error())}
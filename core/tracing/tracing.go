@@ -0,0 +1,186 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/open-horizon/edge-sync-service/common"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The delivery of an object is traced from the update of the object on its origin to its consumption on its destinations.
+// Each node remembers the span that starts the current delivery of each object: the UpdateObject span on the origin,
+// and the handleUpdate span on the destination. The spans of the operations on the object are children of its delivery span.
+// The delivery span is sent to the other side in the W3C trace context format, in MQTT messages and in HTTP headers,
+// so that the spans of both sides belong to the same trace.
+
+const tracerName = "github.com/open-horizon/edge-sync-service"
+
+// The maximal number of objects whose delivery spans are remembered
+const maxDeliveries = 10000
+
+// Error is the error used in the tracing package
+type Error struct {
+	message string
+}
+
+func (e *Error) Error() string {
+	return e.message
+}
+
+// Span is a span of an operation on an object
+type Span struct {
+	span trace.Span
+}
+
+// End records the error, if any, and ends the span
+func (s *Span) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
+
+var propagator = propagation.TraceContext{}
+
+var deliveries = make(map[string]trace.SpanContext)
+var deliveriesLock sync.RWMutex
+
+var provider *sdktrace.TracerProvider
+var tracingFile *os.File
+
+// Init sets up the export of spans to the file configured by TracingFile. If TracingFile is not set, the spans are
+// exported by the tracer provider registered by the application embedding the Sync Service, if any.
+func Init() common.SyncServiceError {
+	if common.Configuration.TracingFile == "" {
+		return nil
+	}
+
+	file, err := os.OpenFile(common.Configuration.TracingFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return &Error{"Failed to open the tracing file. Error: " + err.Error()}
+	}
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+	if err != nil {
+		file.Close()
+		return &Error{"Failed to create the span exporter. Error: " + err.Error()}
+	}
+	serviceName := "sync-service-" + common.Configuration.NodeType
+	tracingFile = file
+	provider = sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName), semconv.ServiceVersion(common.VersionAsString()))))
+	otel.SetTracerProvider(provider)
+	return nil
+}
+
+// Stop exports the remaining spans and closes the tracing file
+func Stop() {
+	if provider == nil {
+		return
+	}
+	provider.Shutdown(context.Background())
+	tracingFile.Close()
+	provider = nil
+	tracingFile = nil
+}
+
+// StartDeliverySpan starts the span of an operation that starts the delivery of an object on this node.
+// The span is a child of the span in the trace context received from the other side, if there is one.
+func StartDeliverySpan(name string, orgID string, objectType string, objectID string, traceContext map[string]string) *Span {
+	ctx := context.Background()
+	if len(traceContext) != 0 {
+		ctx = propagator.Extract(ctx, propagation.MapCarrier(traceContext))
+	}
+	span := start(ctx, name, orgID, objectType, objectID)
+
+	if span.SpanContext().IsValid() {
+		key := objectKey(orgID, objectType, objectID)
+		deliveriesLock.Lock()
+		if _, ok := deliveries[key]; !ok && len(deliveries) >= maxDeliveries {
+			for k := range deliveries {
+				delete(deliveries, k)
+				break
+			}
+		}
+		deliveries[key] = span.SpanContext()
+		deliveriesLock.Unlock()
+	}
+	return &Span{span}
+}
+
+// StartSpan starts the span of an operation on an object. The span is a child of the span in the trace context
+// received from the other side, if there is one, and of the delivery span of the object otherwise.
+func StartSpan(name string, orgID string, objectType string, objectID string, traceContext map[string]string) *Span {
+	ctx := context.Background()
+	if len(traceContext) != 0 {
+		ctx = propagator.Extract(ctx, propagation.MapCarrier(traceContext))
+	}
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		if spanContext, ok := getDelivery(orgID, objectType, objectID); ok {
+			ctx = trace.ContextWithSpanContext(ctx, spanContext)
+		}
+	}
+	return &Span{start(ctx, name, orgID, objectType, objectID)}
+}
+
+// GetTraceContext returns the trace context of the delivery of an object to be sent to the other side,
+// nil if the delivery of the object isn't traced
+func GetTraceContext(orgID string, objectType string, objectID string) map[string]string {
+	spanContext, ok := getDelivery(orgID, objectType, objectID)
+	if !ok {
+		return nil
+	}
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(trace.ContextWithSpanContext(context.Background(), spanContext), carrier)
+	return carrier
+}
+
+// AddTraceContextHeaders adds the trace context of the delivery of an object to the headers of an HTTP request
+func AddTraceContextHeaders(orgID string, objectType string, objectID string, header http.Header) {
+	for key, value := range GetTraceContext(orgID, objectType, objectID) {
+		header.Set(key, value)
+	}
+}
+
+// GetTraceContextFromHeaders returns the trace context in the headers of an HTTP request, nil if there is none
+func GetTraceContextFromHeaders(header http.Header) map[string]string {
+	var traceContext map[string]string
+	for _, field := range propagator.Fields() {
+		if value := header.Get(field); value != "" {
+			if traceContext == nil {
+				traceContext = make(map[string]string)
+			}
+			traceContext[field] = value
+		}
+	}
+	return traceContext
+}
+
+func start(ctx context.Context, name string, orgID string, objectType string, objectID string) trace.Span {
+	_, span := otel.Tracer(tracerName).Start(ctx, name,
+		trace.WithAttributes(attribute.String("sync.org_id", orgID), attribute.String("sync.object_type", objectType),
+			attribute.String("sync.object_id", objectID), attribute.String("sync.node_type", common.Configuration.NodeType)))
+	return span
+}
+
+func getDelivery(orgID string, objectType string, objectID string) (trace.SpanContext, bool) {
+	deliveriesLock.RLock()
+	defer deliveriesLock.RUnlock()
+	spanContext, ok := deliveries[objectKey(orgID, objectType, objectID)]
+	return spanContext, ok
+}
+
+func objectKey(orgID string, objectType string, objectID string) string {
+	return orgID + ":" + objectType + ":" + objectID
+}
@@ -0,0 +1,77 @@
+package tracing
+
+import (
+	"net/http"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTraceContextPropagation(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+
+	if traceContext := GetTraceContext("myorg", "type1", "none"); traceContext != nil {
+		t.Errorf("Trace context returned for an object without a delivery span: %v", traceContext)
+	}
+
+	// The origin
+	span := StartDeliverySpan("UpdateObject", "myorg", "type1", "1", nil)
+	span.End(nil)
+	traceContext := GetTraceContext("myorg", "type1", "1")
+	if traceContext["traceparent"] == "" {
+		t.Fatalf("No traceparent in the trace context of the object: %v", traceContext)
+	}
+
+	// The trace context is sent in HTTP headers
+	header := http.Header{}
+	AddTraceContextHeaders("myorg", "type1", "1", header)
+	if header.Get("traceparent") != traceContext["traceparent"] {
+		t.Errorf("Wrong traceparent header: %s instead of %s", header.Get("traceparent"), traceContext["traceparent"])
+	}
+	receivedContext := GetTraceContextFromHeaders(header)
+	if receivedContext["traceparent"] != traceContext["traceparent"] {
+		t.Errorf("Wrong trace context extracted from the headers: %v", receivedContext)
+	}
+	if GetTraceContextFromHeaders(http.Header{}) != nil {
+		t.Errorf("Trace context extracted from headers without trace context")
+	}
+
+	// The destination
+	span = StartDeliverySpan("handleUpdate", "myorg", "type1", "2", receivedContext)
+	span.End(nil)
+	span = StartSpan("handleData", "myorg", "type1", "2", nil)
+	span.End(&Error{"failed"})
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("Wrong number of spans: %d instead of 3", len(spans))
+	}
+	updateObject, handleUpdate, handleData := spans[0], spans[1], spans[2]
+	if handleUpdate.SpanContext.TraceID() != updateObject.SpanContext.TraceID() ||
+		handleData.SpanContext.TraceID() != updateObject.SpanContext.TraceID() {
+		t.Errorf("The spans don't belong to the same trace")
+	}
+	if handleUpdate.Parent.SpanID() != updateObject.SpanContext.SpanID() || !handleUpdate.Parent.IsRemote() {
+		t.Errorf("The parent of the handleUpdate span isn't the remote UpdateObject span")
+	}
+	if handleData.Parent.SpanID() != handleUpdate.SpanContext.SpanID() {
+		t.Errorf("The parent of the handleData span isn't the delivery span of the object")
+	}
+	if len(handleData.Events) != 1 || handleData.Status.Description != "failed" {
+		t.Errorf("The error wasn't recorded in the span")
+	}
+
+	// A new update starts a new trace
+	span = StartDeliverySpan("UpdateObject", "myorg", "type1", "1", nil)
+	span.End(nil)
+	if GetTraceContext("myorg", "type1", "1")["traceparent"] == traceContext["traceparent"] {
+		t.Errorf("The delivery span of the object wasn't replaced")
+	}
+	spans = exporter.GetSpans()
+	if spans[3].SpanContext.TraceID() == updateObject.SpanContext.TraceID() || spans[3].Parent.IsValid() {
+		t.Errorf("The update didn't start a new trace")
+	}
+}